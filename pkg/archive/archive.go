@@ -0,0 +1,130 @@
+// Package archive records which archive snapshot each disk deleted by
+// cleanup --mode archive was archived to, in a JSON lines index file in a
+// store, so that the thaw command can recreate the disk without searching
+// the snapshots of the project.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// Record maps an archived disk to its archive snapshot.
+type Record struct {
+	Time      time.Time `json:"time"`
+	ProjectID string    `json:"projectID"`
+	Zone      string    `json:"zone"`
+	DiskName  string    `json:"diskName"`
+	// DiskType is the type of the disk, e.g. pd-balanced.
+	DiskType string `json:"diskType,omitempty"`
+	SizeGB   int64  `json:"sizeGB"`
+	// Snapshot is the name of the archive snapshot.
+	Snapshot string `json:"snapshot"`
+}
+
+// Writer appends a Record for every disk deleted after an archive snapshot
+// was taken, as published on the event bus.
+type Writer struct {
+	// ctx is used to append records, as event handlers do not take a
+	// context.
+	ctx  context.Context
+	s    store.Store
+	path string
+
+	mu  sync.Mutex
+	err error
+}
+
+// Open returns a Writer appending to the index file at path in s, which is
+// created on the first archived disk if it does not exist.
+func Open(ctx context.Context, s store.Store, path string) *Writer {
+	return &Writer{ctx: ctx, s: s, path: path}
+}
+
+// Handle is an events.Handler that records archived disks.
+func (w *Writer) Handle(e events.Event) {
+	if e.Type != events.DiskDeleted || e.DryRun || !cleanup.IsArchive(e.Snapshot) {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return
+	}
+	data, err := json.Marshal(Record{
+		Time:      e.Time,
+		ProjectID: e.ProjectID,
+		Zone:      e.Zone,
+		DiskName:  e.Disk.GetName(),
+		DiskType:  path.Base(e.Disk.GetType()),
+		SizeGB:    e.Disk.GetSizeGb(),
+		Snapshot:  e.Snapshot.GetName(),
+	})
+	if err != nil {
+		w.err = err
+		return
+	}
+	w.err = w.s.Append(w.ctx, w.path, append(data, '\n'))
+}
+
+// Close returns the first error writing to the index file, if any.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return xerrors.Errorf("write archive index: %w", w.err)
+	}
+	return nil
+}
+
+// Read returns all records in the index file at path in s.
+func Read(ctx context.Context, s store.Store, path string) ([]Record, error) {
+	data, err := s.Get(ctx, path)
+	if err != nil {
+		return nil, xerrors.Errorf("open archive index: %w", err)
+	}
+	var records []Record
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, xerrors.Errorf("archive index %s line %d: %w", path, line, err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.Errorf("read archive index: %w", err)
+	}
+	return records, nil
+}
+
+// Find returns the latest record of the disk diskName in projectID, or false
+// if it was never archived. A disk that was thawed and archived again has a
+// record per archive snapshot.
+func Find(records []Record, projectID, diskName string) (Record, bool) {
+	var found Record
+	ok := false
+	for _, r := range records {
+		if r.ProjectID != projectID || r.DiskName != diskName {
+			continue
+		}
+		if !ok || !r.Time.Before(found.Time) {
+			found, ok = r, true
+		}
+	}
+	return found, ok
+}
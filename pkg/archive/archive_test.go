@@ -0,0 +1,53 @@
+package archive
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_WriterRead(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "archive-index.jsonl")
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	disk := &computepb.Disk{
+		Name:   pointer.String("test-disk"),
+		SizeGb: pointer.Int64(10),
+		Type:   pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/diskTypes/pd-ssd"),
+	}
+	archived := &computepb.Snapshot{Name: pointer.String("test-disk-archive"), SnapshotType: pointer.String(computepb.Snapshot_ARCHIVE.String())}
+	standard := &computepb.Snapshot{Name: pointer.String("test-disk"), SnapshotType: pointer.String(computepb.Snapshot_STANDARD.String())}
+
+	w := Open(ctx, store.Local{}, path)
+	w.Handle(events.Event{Type: events.DiskDeleted, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Snapshot: standard})
+	w.Handle(events.Event{Type: events.DiskDeleted, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Snapshot: archived, DryRun: true})
+	w.Handle(events.Event{Type: events.SnapshotCreated, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Snapshot: archived})
+	w.Handle(events.Event{Type: events.DiskDeleted, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Snapshot: archived})
+	require.NoError(t, w.Close())
+
+	// a second run appends
+	w = Open(ctx, store.Local{}, path)
+	w.Handle(events.Event{Type: events.DiskDeleted, Time: now.Add(time.Hour), ProjectID: "testing", Zone: "us-east1-c", Disk: disk, Snapshot: archived})
+	require.NoError(t, w.Close())
+
+	records, err := Read(ctx, store.Local{}, path)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, Record{Time: now, ProjectID: "testing", Zone: "us-east1-b", DiskName: "test-disk", DiskType: "pd-ssd", SizeGB: 10, Snapshot: "test-disk-archive"}, records[0])
+
+	found, ok := Find(records, "testing", "test-disk")
+	require.True(t, ok)
+	require.Equal(t, "us-east1-c", found.Zone, "the latest record")
+	_, ok = Find(records, "other", "test-disk")
+	require.False(t, ok)
+}
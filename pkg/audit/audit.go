@@ -0,0 +1,197 @@
+// Package audit keeps a durable record of every change gke-disk-cleanup makes
+// to disks and snapshots, naming who made it and the Compute Engine
+// operation, in a Cloud Storage bucket or a BigQuery table for compliance.
+package audit
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/events"
+)
+
+// batchSize is how many records are buffered before they are written.
+const batchSize = 100
+
+// closeTimeout bounds writing the last records on Close, which happens even
+// if the run was interrupted.
+const closeTimeout = 30 * time.Second
+
+// Record is a single change made to a disk or snapshot.
+type Record struct {
+	Time time.Time `json:"time"`
+	// RunID is shared by all records written by one Logger, and Seq numbers
+	// them from 1.
+	RunID   string `json:"runID"`
+	Seq     int64  `json:"seq"`
+	Command string `json:"command"`
+	// Identity is the Google account the changes were made with, empty if
+	// unknown, and Operator who ran the command.
+	Identity  string      `json:"identity,omitempty"`
+	Operator  string      `json:"operator,omitempty"`
+	Action    events.Type `json:"action"`
+	ProjectID string      `json:"projectID"`
+	Zone      string      `json:"zone,omitempty"`
+	Disk      string      `json:"disk,omitempty"`
+	DiskID    string      `json:"diskID,omitempty"`
+	SizeGB    int64       `json:"sizeGB,omitempty"`
+	// Snapshot is the snapshot deleted, the disk was restored from, or that
+	// was taken before the disk was deleted.
+	Snapshot string `json:"snapshot,omitempty"`
+	SelfLink string `json:"selfLink,omitempty"`
+	// Operation is the name of the Compute Engine operation that made the
+	// change, if known.
+	Operation string `json:"operation,omitempty"`
+	// ExportURI is the Cloud Storage object a disk was exported to, with
+	// the checksums of the object.
+	ExportURI    string `json:"exportURI,omitempty"`
+	ExportMD5    string `json:"exportMD5,omitempty"`
+	ExportCRC32C string `json:"exportCRC32C,omitempty"`
+}
+
+// audited are the event types that change a disk or snapshot.
+var audited = map[events.Type]bool{
+	events.DiskMarked:      true,
+	events.DiskUnmarked:    true,
+	events.SnapshotCreated: true,
+	events.DiskExported:    true,
+	events.DiskDeleted:     true,
+	events.DiskRestored:    true,
+	events.SnapshotDeleted: true,
+}
+
+// newRecord returns the record of e, an audited event.
+func newRecord(e events.Event) Record {
+	r := Record{
+		Time:      e.Time.UTC(),
+		Action:    e.Type,
+		ProjectID: e.ProjectID,
+		Zone:      e.Zone,
+		Operation: e.Operation,
+	}
+	if disk := e.Disk; disk != nil {
+		r.Disk, r.SizeGB, r.SelfLink = disk.GetName(), disk.GetSizeGb(), disk.GetSelfLink()
+		if disk.Id != nil {
+			r.DiskID = strconv.FormatUint(disk.GetId(), 10)
+		}
+	}
+	if snapshot := e.Snapshot; snapshot != nil {
+		r.Snapshot = snapshot.GetName()
+		if e.Disk == nil {
+			r.SelfLink = snapshot.GetSelfLink()
+		}
+	}
+	if export := e.Export; export != nil {
+		r.ExportURI, r.ExportMD5, r.ExportCRC32C = export.URI, export.MD5, export.CRC32C
+	}
+	return r
+}
+
+// Sink stores audit records durably.
+type Sink interface {
+	// Write appends records. Writing the same records again, e.g. after a
+	// failure, must not lose any.
+	Write(ctx context.Context, records []Record) error
+}
+
+// queue holds the records not written to a sink yet, so that each sink
+// retries only what it failed to write.
+type queue struct {
+	sink    Sink
+	pending []Record
+}
+
+// Logger writes a Record for every change published on the event bus to its
+// sinks, in batches.
+type Logger struct {
+	// ctx is used to write full batches, as event handlers do not take a
+	// context.
+	ctx    context.Context
+	base   Record
+	queues []*queue
+
+	mu  sync.Mutex
+	seq int64
+}
+
+// NewLogger returns a Logger writing to sinks. The Command, Identity and
+// Operator of base are set in every record.
+func NewLogger(ctx context.Context, base Record, sinks ...Sink) *Logger {
+	base.RunID = uuid.New().String()
+	l := &Logger{ctx: ctx, base: base}
+	for _, s := range sinks {
+		l.queues = append(l.queues, &queue{sink: s})
+	}
+	return l
+}
+
+// Handle is an events.Handler that records changes to disks and snapshots.
+func (l *Logger) Handle(e events.Event) {
+	if !audited[e.Type] || e.DryRun {
+		return
+	}
+	r := newRecord(e)
+	r.RunID, r.Command, r.Identity, r.Operator = l.base.RunID, l.base.Command, l.base.Identity, l.base.Operator
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	r.Seq = l.seq
+	full := false
+	for _, q := range l.queues {
+		q.pending = append(q.pending, r)
+		// a sink that failed is retried once another batch is full
+		full = full || len(q.pending)%batchSize == 0
+	}
+	if full {
+		_ = l.flush(l.ctx)
+	}
+}
+
+// Flush writes the buffered records, e.g. at the end of a run. It returns
+// the first error, after trying every sink. A nil *Logger does nothing.
+func (l *Logger) Flush(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.flush(ctx)
+}
+
+// flush writes the pending records of every queue. l.mu must be held.
+func (l *Logger) flush(ctx context.Context) error {
+	var first error
+	for _, q := range l.queues {
+		if len(q.pending) == 0 {
+			continue
+		}
+		if err := q.sink.Write(ctx, q.pending); err != nil {
+			log.Error().Err(err).Int("records", len(q.pending)).Msg("unable to write audit records, retrying with the next batch")
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		q.pending = nil
+	}
+	return first
+}
+
+// Close writes the buffered records, even if the context of the Logger is
+// done, and returns an error if any record could not be written in the end.
+func (l *Logger) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.flush(ctx); err != nil {
+		return xerrors.Errorf("write audit records: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+)
+
+// fakeSink records the batches written, and fails while failing is set.
+type fakeSink struct {
+	mu      sync.Mutex
+	batches [][]Record
+	failing bool
+}
+
+func (s *fakeSink) Write(_ context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return xerrors.New("sink unavailable")
+	}
+	s.batches = append(s.batches, append([]Record(nil), records...))
+	return nil
+}
+
+func Test_Logger(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	id := uint64(123)
+	disk := &computepb.Disk{Name: pointer.String("test-disk"), Id: &id, SizeGb: pointer.Int64(10)}
+	snapshot := &computepb.Snapshot{Name: pointer.String("test-disk"), SelfLink: pointer.String("https://compute/snapshots/test-disk")}
+
+	t.Run("records changes", func(t *testing.T) {
+		t.Parallel()
+
+		sink := &fakeSink{}
+		l := NewLogger(context.Background(), Record{Command: "cleanup", Identity: "cleanup@testing.iam.gserviceaccount.com", Operator: "ops"}, sink)
+		l.Handle(events.Event{Type: events.DiskScanned, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk})
+		l.Handle(events.Event{Type: events.DiskDeleted, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, DryRun: true})
+		l.Handle(events.Event{Type: events.DiskDeleted, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Snapshot: snapshot, Operation: "operation-1"})
+		l.Handle(events.Event{Type: events.SnapshotDeleted, Time: now, ProjectID: "testing", Snapshot: snapshot, Operation: "operation-2"})
+		require.Empty(t, sink.batches, "records are buffered")
+		require.NoError(t, l.Close())
+
+		require.Len(t, sink.batches, 1)
+		records := sink.batches[0]
+		require.Len(t, records, 2)
+		runID := records[0].RunID
+		require.NotEmpty(t, runID)
+		require.Equal(t, []Record{{
+			Time:      now,
+			RunID:     runID,
+			Seq:       1,
+			Command:   "cleanup",
+			Identity:  "cleanup@testing.iam.gserviceaccount.com",
+			Operator:  "ops",
+			Action:    events.DiskDeleted,
+			ProjectID: "testing",
+			Zone:      "us-east1-b",
+			Disk:      "test-disk",
+			DiskID:    "123",
+			SizeGB:    10,
+			Snapshot:  "test-disk",
+			Operation: "operation-1",
+		}, {
+			Time:      now,
+			RunID:     runID,
+			Seq:       2,
+			Command:   "cleanup",
+			Identity:  "cleanup@testing.iam.gserviceaccount.com",
+			Operator:  "ops",
+			Action:    events.SnapshotDeleted,
+			ProjectID: "testing",
+			Snapshot:  "test-disk",
+			SelfLink:  "https://compute/snapshots/test-disk",
+			Operation: "operation-2",
+		}}, records)
+	})
+
+	t.Run("records exports", func(t *testing.T) {
+		t.Parallel()
+
+		sink := &fakeSink{}
+		l := NewLogger(context.Background(), Record{Command: "cleanup"}, sink)
+		export := &events.Export{URI: "gs://bucket/test-disk.tar.gz", SizeBytes: 1024, MD5: "1B2M2Y8AsgTpgAmY7PhCfg==", CRC32C: "AAAAAA=="}
+		l.Handle(events.Event{Type: events.DiskExported, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Export: export})
+		require.NoError(t, l.Close())
+
+		require.Len(t, sink.batches, 1)
+		r := sink.batches[0][0]
+		require.Equal(t, events.DiskExported, r.Action)
+		require.Equal(t, "test-disk", r.Disk)
+		require.Equal(t, "gs://bucket/test-disk.tar.gz", r.ExportURI)
+		require.Equal(t, "1B2M2Y8AsgTpgAmY7PhCfg==", r.ExportMD5)
+		require.Equal(t, "AAAAAA==", r.ExportCRC32C)
+	})
+
+	t.Run("writes full batches", func(t *testing.T) {
+		t.Parallel()
+
+		sink := &fakeSink{}
+		l := NewLogger(context.Background(), Record{Command: "mark"}, sink)
+		for i := 0; i < batchSize+1; i++ {
+			l.Handle(events.Event{Type: events.DiskMarked, Time: now, ProjectID: "testing", Disk: disk})
+		}
+		require.Len(t, sink.batches, 1)
+		require.Len(t, sink.batches[0], batchSize)
+		require.NoError(t, l.Flush(context.Background()))
+		require.Len(t, sink.batches, 2)
+		require.Equal(t, int64(batchSize+1), sink.batches[1][0].Seq)
+	})
+
+	t.Run("retries failed sinks", func(t *testing.T) {
+		t.Parallel()
+
+		failing, ok := &fakeSink{failing: true}, &fakeSink{}
+		l := NewLogger(context.Background(), Record{Command: "mark"}, failing, ok)
+		l.Handle(events.Event{Type: events.DiskMarked, Time: now, ProjectID: "testing", Disk: disk})
+		require.ErrorContains(t, l.Flush(context.Background()), "sink unavailable")
+		require.Len(t, ok.batches, 1)
+
+		failing.failing = false
+		l.Handle(events.Event{Type: events.DiskUnmarked, Time: now, ProjectID: "testing", Disk: disk})
+		require.NoError(t, l.Close())
+		require.Len(t, failing.batches, 1)
+		require.Len(t, failing.batches[0], 2, "the failed record is written with the next")
+		require.Len(t, ok.batches, 2)
+		require.Len(t, ok.batches[1], 1, "written records are not written again")
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+
+		var l *Logger
+		require.NoError(t, l.Flush(context.Background()))
+	})
+}
+
+func Test_GCS(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: now, RunID: "run", Seq: 1, Action: events.DiskMarked, ProjectID: "testing", Disk: "a"},
+		{Time: now, RunID: "run", Seq: 2, Action: events.DiskMarked, ProjectID: "testing", Disk: "b"},
+	}
+
+	var mu sync.Mutex
+	objects := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/upload/storage/v1/b/audit-bucket/o", r.URL.Path)
+		require.Equal(t, "0", r.URL.Query().Get("ifGenerationMatch"))
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		metaPart, err := mr.NextPart()
+		require.NoError(t, err)
+		var object struct{ Name string }
+		require.NoError(t, json.NewDecoder(metaPart).Decode(&object))
+		mediaPart, err := mr.NextPart()
+		require.NoError(t, err)
+		media, err := io.ReadAll(mediaPart)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := objects[object.Name]; ok {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			_, _ = w.Write([]byte(`{"error":{"code":412,"message":"precondition failed"}}`))
+			return
+		}
+		objects[object.Name] = string(media)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	sink, err := NewGCS(context.Background(), "gs://audit-bucket/gke-disk-cleanup/", option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(context.Background(), records))
+	require.NoError(t, sink.Write(context.Background(), records), "writing the same records again is not an error")
+
+	require.Len(t, objects, 1)
+	media, ok := objects["gke-disk-cleanup/2022/03/01/run-000001-000002.jsonl"]
+	require.True(t, ok, "objects: %v", objects)
+	var got []Record
+	scanner := bufio.NewScanner(strings.NewReader(media))
+	for scanner.Scan() {
+		var r Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		got = append(got, r)
+	}
+	require.Equal(t, records, got)
+
+	_, err = NewGCS(context.Background(), "/audit", option.WithoutAuthentication())
+	require.ErrorContains(t, err, "invalid audit bucket")
+}
+
+func Test_BigQuery(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: now, RunID: "run", Seq: 1, Action: events.DiskDeleted, ProjectID: "testing", Disk: "a", Operation: "operation-1"},
+		{Time: now, RunID: "run", Seq: 2, Action: events.DiskDeleted, ProjectID: "testing", Disk: "b"},
+	}
+
+	var reject bool
+	var got bigquery.TableDataInsertAllRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/bigquery/v2/projects/audit-project/datasets/audit/tables/disks/insertAll", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		if reject {
+			_, _ = w.Write([]byte(`{"insertErrors":[{"index":1,"errors":[{"message":"no such field: foo"}]}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	opts := []option.ClientOption{option.WithEndpoint(srv.URL + "/bigquery/v2/"), option.WithoutAuthentication()}
+	sink, err := NewBigQuery(context.Background(), "audit-project:audit.disks", opts...)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(context.Background(), records))
+	require.Len(t, got.Rows, 2)
+	require.Equal(t, "run-1", got.Rows[0].InsertId)
+	require.Equal(t, "run-2", got.Rows[1].InsertId)
+	require.Equal(t, "2022-03-01T10:00:00Z", got.Rows[0].Json["time"])
+	require.Equal(t, "DiskDeleted", got.Rows[0].Json["action"])
+	require.Equal(t, "operation-1", got.Rows[0].Json["operation"])
+	require.NotContains(t, got.Rows[1].Json, "operation")
+
+	reject = true
+	err = sink.Write(context.Background(), records)
+	require.ErrorContains(t, err, "insert into audit-project.audit.disks: 1 of 2 rows rejected, e.g. row 1: no such field: foo")
+
+	for _, table := range []string{"audit.disks", "audit-project.audit", "a.b.c.d"} {
+		_, err := NewBigQuery(context.Background(), table, opts...)
+		require.ErrorContains(t, err, "invalid audit table", table)
+	}
+}
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"context"
+
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/bqtable"
+)
+
+// BigQuery streams records into a BigQuery table, with a column named after
+// each JSON field of Record.
+type BigQuery struct {
+	table *bqtable.Table
+}
+
+// NewBigQuery returns a BigQuery sink inserting into table, e.g.
+// my-project.audit.gke_disk_cleanup.
+func NewBigQuery(ctx context.Context, table string, opts ...option.ClientOption) (*BigQuery, error) {
+	t, err := bqtable.Open(ctx, table, "audit", opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &BigQuery{table: t}, nil
+}
+
+func (b *BigQuery) String() string {
+	return b.table.String()
+}
+
+// Write inserts records. Every record carries an insert ID made of its run
+// and sequence number, with which BigQuery drops records inserted twice.
+func (b *BigQuery) Write(ctx context.Context, records []Record) error {
+	rows := make([]bqtable.Row, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, bqtable.Row{InsertID: bqtable.InsertID(r.RunID, r.Seq), Value: r})
+	}
+	return b.table.Insert(ctx, rows)
+}
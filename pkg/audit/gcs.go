@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// GCS writes every batch of records as a JSON lines object to a Cloud
+// Storage bucket, below prefix/yyyy/mm/dd.
+type GCS struct {
+	svc    *storage.Service
+	bucket string
+	prefix string
+}
+
+// NewGCS returns a GCS sink writing to location, a bucket name optionally
+// followed by a prefix, e.g. my-bucket/audit.
+func NewGCS(ctx context.Context, location string, opts ...option.ClientOption) (*GCS, error) {
+	location = strings.TrimPrefix(location, "gs://")
+	bucket, prefix := location, ""
+	if i := strings.Index(location, "/"); i >= 0 {
+		bucket, prefix = location[:i], strings.Trim(location[i+1:], "/")
+	}
+	if bucket == "" {
+		return nil, xerrors.Errorf("invalid audit bucket %q: expected bucket or bucket/prefix", location)
+	}
+	svc, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init storage client: %w", err)
+	}
+	return &GCS{svc: svc, bucket: bucket, prefix: prefix}, nil
+}
+
+// object returns the name of the object holding records, which is the same
+// for the same records, e.g. audit/2022/03/01/<run>-000001-000100.jsonl.
+func (g *GCS) object(records []Record) string {
+	first, last := records[0], records[len(records)-1]
+	name := fmt.Sprintf("%s-%06d-%06d.jsonl", first.RunID, first.Seq, last.Seq)
+	return path.Join(g.prefix, first.Time.UTC().Format("2006/01/02"), name)
+}
+
+// Write creates an object holding records. Objects are never overwritten;
+// if the object exists, the records were written by an earlier attempt.
+func (g *GCS) Write(ctx context.Context, records []Record) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return xerrors.Errorf("encode audit record: %w", err)
+		}
+	}
+	name := g.object(records)
+	_, err := g.svc.Objects.Insert(g.bucket, &storage.Object{Name: name, ContentType: "application/x-ndjson"}).
+		Media(&buf).
+		IfGenerationMatch(0).
+		Context(ctx).
+		Do()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("write gs://%s/%s: %w", g.bucket, name, err)
+	}
+	return nil
+}
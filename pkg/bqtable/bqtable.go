@@ -0,0 +1,87 @@
+// Package bqtable streams rows into BigQuery tables, for the sinks that
+// export audit records and inventory rows.
+package bqtable
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/xerrors"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+)
+
+// pattern matches a table as project.dataset.table, or
+// project:dataset.table as written by the bq tool.
+var pattern = regexp.MustCompile(`^([^.:]+)[.:]([^.]+)\.([^.]+)$`)
+
+// Table is a BigQuery table.
+type Table struct {
+	Svc       *bigquery.Service
+	ProjectID string
+	DatasetID string
+	TableID   string
+}
+
+// Open returns table, e.g. my-project.audit.gke_disk_cleanup. kind names the
+// table in errors, e.g. audit.
+func Open(ctx context.Context, table, kind string, opts ...option.ClientOption) (*Table, error) {
+	m := pattern.FindStringSubmatch(table)
+	if m == nil {
+		return nil, xerrors.Errorf("invalid %s table %q: expected project.dataset.table", kind, table)
+	}
+	svc, err := bigquery.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init bigquery client: %w", err)
+	}
+	return &Table{Svc: svc, ProjectID: m[1], DatasetID: m[2], TableID: m[3]}, nil
+}
+
+func (t *Table) String() string {
+	return t.ProjectID + "." + t.DatasetID + "." + t.TableID
+}
+
+// Row is a row to insert, with a column named after each JSON field of
+// Value.
+type Row struct {
+	// InsertID identifies the row, with which BigQuery drops rows inserted
+	// twice.
+	InsertID string
+	Value    interface{}
+}
+
+// InsertID returns the insert ID of the row numbered seq of the run runID.
+func InsertID(runID string, seq int64) string {
+	return runID + "-" + strconv.FormatInt(seq, 10)
+}
+
+// Insert inserts rows.
+func (t *Table) Insert(ctx context.Context, rows []Row) error {
+	req := &bigquery.TableDataInsertAllRequest{}
+	for _, r := range rows {
+		raw, err := json.Marshal(r.Value)
+		if err != nil {
+			return xerrors.Errorf("encode row %s: %w", r.InsertID, err)
+		}
+		var row map[string]bigquery.JsonValue
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return xerrors.Errorf("encode row %s: %w", r.InsertID, err)
+		}
+		req.Rows = append(req.Rows, &bigquery.TableDataInsertAllRequestRows{InsertId: r.InsertID, Json: row})
+	}
+	resp, err := t.Svc.Tabledata.InsertAll(t.ProjectID, t.DatasetID, t.TableID, req).Context(ctx).Do()
+	if err != nil {
+		return xerrors.Errorf("insert into %s: %w", t, err)
+	}
+	if len(resp.InsertErrors) > 0 {
+		first := resp.InsertErrors[0]
+		msg := "unknown error"
+		if len(first.Errors) > 0 {
+			msg = first.Errors[0].Message
+		}
+		return xerrors.Errorf("insert into %s: %d of %d rows rejected, e.g. row %d: %s", t, len(resp.InsertErrors), len(rows), first.Index, msg)
+	}
+	return nil
+}
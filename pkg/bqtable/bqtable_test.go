@@ -0,0 +1,44 @@
+package bqtable
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+)
+
+func Test_Open(t *testing.T) {
+	t.Parallel()
+
+	opts := []option.ClientOption{option.WithEndpoint("http://localhost/bigquery/v2/"), option.WithoutAuthentication()}
+	testCases := []struct {
+		table    string
+		expected string
+		err      string
+	}{
+		{table: "my-project.audit.disks", expected: "my-project.audit.disks"},
+		{table: "my-project:audit.disks", expected: "my-project.audit.disks"},
+		{table: "audit.disks", err: `invalid audit table "audit.disks"`},
+		{table: "my-project.audit", err: `invalid audit table "my-project.audit"`},
+		{table: "a.b.c.d", err: `invalid audit table "a.b.c.d"`},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.table, func(t *testing.T) {
+			t.Parallel()
+			table, err := Open(context.Background(), testCase.table, "audit", opts...)
+			if testCase.err != "" {
+				require.ErrorContains(t, err, testCase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.expected, table.String())
+		})
+	}
+}
+
+func Test_InsertID(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "run-42", InsertID("run", 42))
+}
@@ -0,0 +1,177 @@
+// Package certificate writes a signed deletion certificate for every disk
+// gke-disk-cleanup deletes, so that compliance can prove when and how each
+// volume was destroyed.
+package certificate
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/signing"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// Disk identifies the deleted disk.
+type Disk struct {
+	ProjectID           string            `json:"projectID"`
+	Zone                string            `json:"zone"`
+	Name                string            `json:"name"`
+	ID                  string            `json:"id,omitempty"`
+	SelfLink            string            `json:"selfLink,omitempty"`
+	Type                string            `json:"type,omitempty"`
+	SizeGB              int64             `json:"sizeGB"`
+	Created             string            `json:"created,omitempty"`
+	LastAttachTimestamp string            `json:"lastAttachTimestamp,omitempty"`
+	LastDetachTimestamp string            `json:"lastDetachTimestamp,omitempty"`
+	Labels              map[string]string `json:"labels,omitempty"`
+}
+
+// Snapshot identifies the snapshot taken before the disk was deleted.
+type Snapshot struct {
+	Name     string `json:"name"`
+	ID       string `json:"id,omitempty"`
+	SelfLink string `json:"selfLink,omitempty"`
+	Created  string `json:"created,omitempty"`
+}
+
+// Certificate states that a disk was deleted.
+type Certificate struct {
+	Disk Disk `json:"disk"`
+	// Snapshot is nil if the disk was deleted without a snapshot.
+	Snapshot  *Snapshot `json:"snapshot,omitempty"`
+	DeletedAt time.Time `json:"deletedAt"`
+	// Operator is who ran the deletion, e.g. a service account.
+	Operator string `json:"operator"`
+}
+
+// Signed is a Certificate with its signature, as written to the store.
+// Signature signs the exact bytes of Certificate, which are kept verbatim
+// when reading a Signed.
+type Signed struct {
+	Certificate json.RawMessage   `json:"certificate"`
+	Signature   signing.Signature `json:"signature"`
+}
+
+// New returns the certificate for the deletion described by e, a
+// DiskDeleted event.
+func New(e events.Event, operator string) Certificate {
+	disk := e.Disk
+	c := Certificate{
+		Disk: Disk{
+			ProjectID:           e.ProjectID,
+			Zone:                e.Zone,
+			Name:                disk.GetName(),
+			SelfLink:            disk.GetSelfLink(),
+			SizeGB:              disk.GetSizeGb(),
+			Created:             disk.GetCreationTimestamp(),
+			LastAttachTimestamp: disk.GetLastAttachTimestamp(),
+			LastDetachTimestamp: disk.GetLastDetachTimestamp(),
+			Labels:              disk.GetLabels(),
+		},
+		DeletedAt: e.Time.UTC(),
+		Operator:  operator,
+	}
+	if disk.Id != nil {
+		c.Disk.ID = strconv.FormatUint(disk.GetId(), 10)
+	}
+	if disk.GetType() != "" {
+		c.Disk.Type = path.Base(disk.GetType())
+	}
+	if s := e.Snapshot; s != nil {
+		c.Snapshot = &Snapshot{Name: s.GetName(), SelfLink: s.GetSelfLink(), Created: s.GetCreationTimestamp()}
+		if s.Id != nil {
+			c.Snapshot.ID = strconv.FormatUint(s.GetId(), 10)
+		}
+	}
+	return c
+}
+
+// Key returns where the certificate is stored below prefix, e.g.
+// certificates/p/us-east1-b/d-123.json. The disk ID tells apart disks that
+// were recreated with the same name.
+func (c Certificate) Key(prefix string) string {
+	name := c.Disk.Name
+	if c.Disk.ID != "" {
+		name += "-" + c.Disk.ID
+	}
+	return path.Join(prefix, c.Disk.ProjectID, c.Disk.Zone, name+".json")
+}
+
+// Sign returns the signed certificate as written to the store.
+func Sign(ctx context.Context, c Certificate, signer signing.Signer) ([]byte, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return nil, xerrors.Errorf("encode certificate: %w", err)
+	}
+	sig, err := signer.Sign(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(Signed{Certificate: payload, Signature: sig})
+	if err != nil {
+		return nil, xerrors.Errorf("encode certificate: %w", err)
+	}
+	return data, nil
+}
+
+// Writer writes a certificate for every deletion published on the event bus.
+type Writer struct {
+	// ctx is used to sign and store certificates, as event handlers do not
+	// take a context.
+	ctx      context.Context
+	s        store.Store
+	prefix   string
+	signer   signing.Signer
+	operator string
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewWriter returns a Writer storing certificates below prefix in s, signed
+// by signer and naming operator.
+func NewWriter(ctx context.Context, s store.Store, prefix string, signer signing.Signer, operator string) *Writer {
+	return &Writer{ctx: ctx, s: s, prefix: prefix, signer: signer, operator: operator}
+}
+
+// Handle is an events.Handler that writes a certificate for every deleted
+// disk.
+func (w *Writer) Handle(e events.Event) {
+	if e.Type != events.DiskDeleted || e.DryRun {
+		return
+	}
+	c := New(e, w.operator)
+	key := c.Key(w.prefix)
+	data, err := Sign(w.ctx, c, w.signer)
+	if err == nil {
+		err = w.s.Put(w.ctx, key, data)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("projectID", e.ProjectID).Str("diskName", e.Disk.GetName()).Str("certificate", key).Msg("unable to write deletion certificate")
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.err == nil {
+			w.err = err
+		}
+		return
+	}
+	log.Debug().Str("projectID", e.ProjectID).Str("diskName", e.Disk.GetName()).Str("certificate", key).Msg("wrote deletion certificate")
+}
+
+// Close returns the first error writing a certificate, if any.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return xerrors.Errorf("write deletion certificate: %w", w.err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package certificate
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/signing"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_Writer(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := store.Local{Dir: t.TempDir()}
+	signer, err := signing.NewHMAC([]byte("secret"))
+	require.NoError(t, err)
+	id := uint64(123)
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	disk := &computepb.Disk{
+		Name:                pointer.String("test-disk"),
+		Id:                  &id,
+		Type:                pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/diskTypes/pd-ssd"),
+		SizeGb:              pointer.Int64(10),
+		LastAttachTimestamp: pointer.String("2022-01-01T00:00:00Z"),
+	}
+
+	snapshotID := uint64(456)
+	snapshot := &computepb.Snapshot{
+		Name:              pointer.String("test-disk"),
+		Id:                &snapshotID,
+		SelfLink:          pointer.String("https://www.googleapis.com/compute/v1/projects/testing/global/snapshots/test-disk"),
+		CreationTimestamp: pointer.String("2022-03-01T09:50:00.000-08:00"),
+	}
+
+	w := NewWriter(ctx, s, "certificates", signer, "cleanup@testing.iam.gserviceaccount.com")
+	w.Handle(events.Event{Type: events.DiskMarked, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk})
+	w.Handle(events.Event{Type: events.DiskDeleted, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, DryRun: true})
+	w.Handle(events.Event{Type: events.DiskDeleted, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Snapshot: snapshot})
+	require.NoError(t, w.Close())
+
+	data, err := s.Get(ctx, "certificates/testing/us-east1-b/test-disk-123.json")
+	require.NoError(t, err)
+	var signed Signed
+	require.NoError(t, json.Unmarshal(data, &signed))
+	require.NoError(t, signer.Verify(context.Background(), signed.Certificate, signed.Signature))
+
+	var c Certificate
+	require.NoError(t, json.Unmarshal(signed.Certificate, &c))
+	require.Equal(t, Certificate{
+		Disk: Disk{
+			ProjectID:           "testing",
+			Zone:                "us-east1-b",
+			Name:                "test-disk",
+			ID:                  "123",
+			Type:                "pd-ssd",
+			SizeGB:              10,
+			LastAttachTimestamp: "2022-01-01T00:00:00Z",
+		},
+		Snapshot: &Snapshot{
+			Name:     "test-disk",
+			ID:       "456",
+			SelfLink: "https://www.googleapis.com/compute/v1/projects/testing/global/snapshots/test-disk",
+			Created:  "2022-03-01T09:50:00.000-08:00",
+		},
+		DeletedAt: now,
+		Operator:  "cleanup@testing.iam.gserviceaccount.com",
+	}, c)
+
+	// a tampered certificate fails verification
+	var tampered map[string]interface{}
+	require.NoError(t, json.Unmarshal(signed.Certificate, &tampered))
+	tampered["operator"] = "someone else"
+	payload, err := json.Marshal(tampered)
+	require.NoError(t, err)
+	require.Error(t, signer.Verify(context.Background(), payload, signed.Signature))
+}
@@ -0,0 +1,147 @@
+// Package checkpoint persists the progress of a mark or cleanup run in a
+// store, so that a run killed at any time, e.g. on a preempted spot VM, can be
+// restarted with the same arguments and continue close to where it stopped.
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// State is the content of a checkpoint.
+type State struct {
+	// Command is the command that wrote the checkpoint, e.g. mark. Another
+	// command refuses to resume from it.
+	Command string `json:"command"`
+	// Done lists the projects that were processed completely.
+	Done []string `json:"done,omitempty"`
+	// ProjectID is the project being processed, and Cursor the page of it to
+	// continue from.
+	ProjectID string `json:"projectID,omitempty"`
+	Cursor    string `json:"cursor,omitempty"`
+	// Processed holds the IDs of the disks of the page of Cursor that were
+	// processed already, which are skipped on resume.
+	Processed []uint64  `json:"processed,omitempty"`
+	Updated   time.Time `json:"updated"`
+}
+
+// File is a checkpoint kept at a key of a store. It implements
+// cleanup.Checkpointer.
+type File struct {
+	// ctx is used to write checkpoints, as cleanup.Checkpointer does not
+	// take a context.
+	ctx  context.Context
+	s    store.Store
+	path string
+
+	mu    sync.Mutex
+	state State
+}
+
+// Open reads the checkpoint at path in s, if it exists, and returns a File
+// that records the progress of command to it.
+func Open(ctx context.Context, s store.Store, path, command string) (*File, error) {
+	f := &File{ctx: ctx, s: s, path: path, state: State{Command: command}}
+	data, err := s.Get(ctx, path)
+	if errors.Is(err, store.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read checkpoint file: %w", err)
+	}
+	if err := json.Unmarshal(data, &f.state); err != nil {
+		return nil, xerrors.Errorf("parse checkpoint file %s: %w", path, err)
+	}
+	if f.state.Command != command {
+		return nil, xerrors.Errorf("checkpoint file %s was written by %s, not %s", path, f.state.Command, command)
+	}
+	return f, nil
+}
+
+// Pending returns the projects that are not done yet, in order.
+func (f *File) Pending(projects []string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	done := make(map[string]bool, len(f.state.Done))
+	for _, projectID := range f.state.Done {
+		done[projectID] = true
+	}
+	var pending []string
+	for _, projectID := range projects {
+		if !done[projectID] {
+			pending = append(pending, projectID)
+		}
+	}
+	return pending
+}
+
+// Resume returns the cursor to continue projectID from, or nil to start at
+// the beginning.
+func (f *File) Resume(projectID string) (*cleanup.Cursor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state.ProjectID != projectID {
+		return nil, nil
+	}
+	cursor, err := cleanup.ParseCursor(f.state.Cursor)
+	if err != nil {
+		return nil, xerrors.Errorf("checkpoint file %s: %w", f.path, err)
+	}
+	cursor.Done = f.state.Processed
+	return &cursor, nil
+}
+
+// Checkpoint records that projectID is to be continued from cursor,
+// skipping the disks in cursor.Done.
+func (f *File) Checkpoint(projectID string, cursor cleanup.Cursor) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state.ProjectID = projectID
+	f.state.Cursor = cursor.String()
+	f.state.Processed = cursor.Done
+	return f.write()
+}
+
+// Complete records that projectID was processed completely.
+func (f *File) Complete(projectID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state.Done = append(f.state.Done, projectID)
+	f.state.ProjectID = ""
+	f.state.Cursor = ""
+	f.state.Processed = nil
+	return f.write()
+}
+
+// Remove deletes the checkpoint file once the whole run completed, so that
+// the next run starts from the beginning.
+func (f *File) Remove() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.s.Delete(f.ctx, f.path); err != nil {
+		return xerrors.Errorf("remove checkpoint file: %w", err)
+	}
+	return nil
+}
+
+// write replaces the checkpoint atomically, so that a process killed while
+// writing leaves the previous checkpoint intact.
+func (f *File) write() error {
+	f.state.Updated = time.Now().UTC()
+	data, err := json.Marshal(f.state)
+	if err != nil {
+		return xerrors.Errorf("encode checkpoint: %w", err)
+	}
+	if err := f.s.Put(f.ctx, f.path, data); err != nil {
+		return xerrors.Errorf("write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package checkpoint
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_File(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	projects := []string{"project-a", "project-b", "project-c"}
+
+	f, err := Open(ctx, store.Local{}, path, "mark")
+	require.NoError(t, err)
+	require.Equal(t, projects, f.Pending(projects))
+	resume, err := f.Resume("project-a")
+	require.NoError(t, err)
+	require.Nil(t, resume)
+
+	require.NoError(t, f.Checkpoint("project-a", cleanup.Cursor{Zone: "us-east1-b", PageToken: "p2"}))
+	require.NoError(t, f.Complete("project-a"))
+	require.NoError(t, f.Checkpoint("project-b", cleanup.Cursor{PageToken: "p3", Done: []uint64{7, 9}}))
+
+	// a restarted run continues where the killed one stopped
+	f, err = Open(ctx, store.Local{}, path, "mark")
+	require.NoError(t, err)
+	require.Equal(t, []string{"project-b", "project-c"}, f.Pending(projects))
+	resume, err = f.Resume("project-b")
+	require.NoError(t, err)
+	require.Equal(t, &cleanup.Cursor{PageToken: "p3", Done: []uint64{7, 9}}, resume)
+	resume, err = f.Resume("project-c")
+	require.NoError(t, err)
+	require.Nil(t, resume)
+
+	_, err = Open(ctx, store.Local{}, path, "cleanup")
+	require.EqualError(t, err, "checkpoint file "+path+" was written by mark, not cleanup")
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	require.NoError(t, f.Remove())
+	require.NoError(t, f.Remove())
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,246 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// AddressesClient is the subset of the compute addresses API used by this
+// package. *computev1.AddressesClient implements it.
+type AddressesClient interface {
+	AggregatedList(context.Context, *computepb.AggregatedListAddressesRequest, ...gax.CallOption) *computev1.AddressesScopedListPairIterator
+	Delete(context.Context, *computepb.DeleteAddressRequest, ...gax.CallOption) (*computev1.Operation, error)
+}
+
+type addressIterator interface {
+	Next() (*computepb.Address, error)
+}
+
+//go:generate moq -fmt goimports -out mock_addresses_client.go . AddressesClient:addressesClientMock
+//go:generate moq -fmt goimports -out mock_address_iterator.go . addressIterator
+
+// AddressKey returns the key of address in ResourceMarks, e.g.
+// projects/p/regions/r/addresses/a.
+func AddressKey(projectID string, address *computepb.Address) string {
+	return fmt.Sprintf("projects/%s/regions/%s/addresses/%s", projectID, path.Base(address.GetRegion()), address.GetName())
+}
+
+// AddressOptions configures a single MarkAddresses or ReleaseAddresses call.
+type AddressOptions struct {
+	ProjectID string
+	// Cutoff is how long ago a reserved address must have been created to
+	// be marked. Addresses do not tell when they were last used.
+	Cutoff time.Duration
+	// GracePeriod is how long ago an address must have been marked to be
+	// released.
+	GracePeriod time.Duration
+	// Marks holds the marks of the addresses, and is updated in place.
+	Marks      ResourceMarks
+	MaxRetries int
+	DryRun     bool
+}
+
+// AddressCleaner marks reserved static IP addresses that are not in use, and
+// releases them once they were marked long enough ago, as Marker and Cleaner
+// do for disks.
+type AddressCleaner struct {
+	client AddressesClient
+	sleep  func(context.Context, time.Duration) error
+}
+
+// NewAddressCleaner returns an AddressCleaner.
+func NewAddressCleaner(client AddressesClient) *AddressCleaner {
+	return &AddressCleaner{client: client, sleep: gax.Sleep}
+}
+
+// listAddresses returns the regional addresses of projectID in all regions.
+func listAddresses(ctx context.Context, client AddressesClient, projectID string) addressIterator {
+	return &aggregatedAddressIterator{pairs: client.AggregatedList(ctx, &computepb.AggregatedListAddressesRequest{Project: projectID})}
+}
+
+type aggregatedAddressIterator struct {
+	pairs interface {
+		Next() (computev1.AddressesScopedListPair, error)
+	}
+	buf []*computepb.Address
+}
+
+func (a *aggregatedAddressIterator) Next() (*computepb.Address, error) {
+	for len(a.buf) == 0 {
+		pair, err := a.pairs.Next()
+		if err != nil {
+			return nil, err
+		}
+		// regions without any addresses only carry a warning
+		a.buf = pair.Value.GetAddresses()
+	}
+	address := a.buf[0]
+	a.buf = a.buf[1:]
+	return address, nil
+}
+
+// MarkAddresses marks the reserved addresses of the project created before
+// the cutoff that are not in use, and unmarks those in use again. Marks of
+// addresses that no longer exist are dropped. Per-address failures are
+// logged and counted in the returned stats; an error is only returned if
+// listing addresses fails.
+func (c *AddressCleaner) MarkAddresses(ctx context.Context, opts AddressOptions) (ResourceStats, error) {
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no addresses will be marked")
+	}
+	return c.markAll(ctx, listAddresses(ctx, c.client, opts.ProjectID), opts)
+}
+
+func (c *AddressCleaner) markAll(ctx context.Context, ai addressIterator, opts AddressOptions) (ResourceStats, error) {
+	var stats ResourceStats
+	seen := make(map[string]bool)
+	err := eachAddress(ai, &stats, opts, func(address *computepb.Address) (Action, error) {
+		seen[AddressKey(opts.ProjectID, address)] = true
+		return c.markAddress(address, opts)
+	})
+	if err != nil {
+		return stats, err
+	}
+	prefix := fmt.Sprintf("projects/%s/", opts.ProjectID)
+	for key := range opts.Marks {
+		if strings.HasPrefix(key, prefix) && !seen[key] && !opts.DryRun {
+			log.Info().Str("projectID", opts.ProjectID).Str("address", key).Msg("dropping mark of address that no longer exists")
+			delete(opts.Marks, key)
+		}
+	}
+	return stats, nil
+}
+
+func (c *AddressCleaner) markAddress(address *computepb.Address, opts AddressOptions) (Action, error) {
+	key := AddressKey(opts.ProjectID, address)
+	logger := addressLogger(opts.ProjectID, address)
+	_, marked := parseMark(opts.Marks[key])
+	if address.GetStatus() != computepb.Address_RESERVED.String() {
+		if !marked {
+			return ActionSkip, nil
+		}
+		// in use again
+		if opts.DryRun {
+			return ActionUnmark, diskerr.ErrDryRun
+		}
+		delete(opts.Marks, key)
+		logger.Info().Msg("unmarked address in use")
+		return ActionUnmark, nil
+	}
+	if marked {
+		return ActionSkip, diskerr.ErrAlreadyMarked
+	}
+	created, err := time.Parse(time.RFC3339, address.GetCreationTimestamp())
+	if err != nil {
+		return ActionSkip, diskerr.Wrap(diskerr.CodeInvalidTimestamp, err, "address %s: parse creation timestamp", address.GetName())
+	}
+	if time.Since(created) < opts.Cutoff {
+		return ActionSkip, diskerr.ErrWithinCutoff
+	}
+	if opts.DryRun {
+		logger.Info().Msg("dry run -- would mark address")
+		return ActionMark, diskerr.ErrDryRun
+	}
+	opts.Marks[key] = markValue(time.Now())
+	logger.Info().Msg("marked address for release")
+	return ActionMark, nil
+}
+
+// ReleaseAddresses releases the marked addresses of the project that are
+// still reserved and not in use, once their mark is older than the grace
+// period. Per-address failures are logged and counted in the returned stats;
+// an error is only returned if listing addresses fails.
+func (c *AddressCleaner) ReleaseAddresses(ctx context.Context, opts AddressOptions) (ResourceStats, error) {
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no addresses will be released")
+	}
+	return c.releaseAll(ctx, listAddresses(ctx, c.client, opts.ProjectID), opts)
+}
+
+func (c *AddressCleaner) releaseAll(ctx context.Context, ai addressIterator, opts AddressOptions) (ResourceStats, error) {
+	var stats ResourceStats
+	err := eachAddress(ai, &stats, opts, func(address *computepb.Address) (Action, error) {
+		if _, marked := parseMark(opts.Marks[AddressKey(opts.ProjectID, address)]); !marked {
+			return ActionSkip, nil
+		}
+		return ActionDelete, c.releaseAddress(ctx, address, opts)
+	})
+	return stats, err
+}
+
+func (c *AddressCleaner) releaseAddress(ctx context.Context, address *computepb.Address, opts AddressOptions) error {
+	key := AddressKey(opts.ProjectID, address)
+	logger := addressLogger(opts.ProjectID, address)
+	markedAt, marked := parseMark(opts.Marks[key])
+	switch {
+	case !marked:
+		return diskerr.New(diskerr.CodeNotMarked, "skipping address %s: not marked", address.GetName())
+	case address.GetStatus() != computepb.Address_RESERVED.String():
+		return diskerr.New(diskerr.CodeInUse, "skipping address %s: %s by %s", address.GetName(), strings.ToLower(address.GetStatus()), strings.Join(address.GetUsers(), ", "))
+	case opts.GracePeriod > 0 && time.Since(markedAt) < opts.GracePeriod:
+		return diskerr.New(diskerr.CodeWithinGracePeriod, "skipping address %s: marked on %s, within grace period of %s", address.GetName(), opts.Marks[key], opts.GracePeriod)
+	}
+	if opts.DryRun {
+		logger.Warn().Msg("dry run -- would release address")
+		return diskerr.ErrDryRun
+	}
+	logger.Warn().Msg("releasing address")
+	req := &computepb.DeleteAddressRequest{
+		Address:   address.GetName(),
+		Project:   opts.ProjectID,
+		Region:    path.Base(address.GetRegion()),
+		RequestId: pointer.String(resourceRequestID(address.GetId(), address.GetCreationTimestamp(), "release")),
+	}
+	r := retrier{maxRetries: opts.MaxRetries, backoff: callBackoff, sleep: c.sleep}
+	err := r.do(ctx, logger, "deleteAddress", func() error {
+		_, err := c.client.Delete(ctx, req)
+		return err
+	})
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeAPI, err, "failed to release address %s", address.GetName())
+	}
+	delete(opts.Marks, key)
+	return nil
+}
+
+// eachAddress calls fn for every address returned by ai and counts the
+// outcome in stats.
+func eachAddress(ai addressIterator, stats *ResourceStats, opts AddressOptions, fn func(*computepb.Address) (Action, error)) error {
+	for {
+		address, err := ai.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return diskerr.Wrap(diskerr.CodeIterator, err, "iterating addresses")
+		}
+		action, err := fn(address)
+		stats.count(addressLogger(opts.ProjectID, address), "address", action, err)
+	}
+}
+
+// addressLogger returns a logger that includes the location of address in
+// every line.
+func addressLogger(projectID string, address *computepb.Address) *zerolog.Logger {
+	l := log.With().
+		Str("projectID", projectID).
+		Str("region", path.Base(address.GetRegion())).
+		Str("addressName", address.GetName()).
+		Str("address", address.GetAddress()).
+		Str("addressType", address.GetAddressType()).
+		Logger()
+	return &l
+}
@@ -0,0 +1,124 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_Addresses(t *testing.T) {
+	t.Parallel()
+
+	old := time.Now().Add(-90 * 24 * time.Hour).Format(time.RFC3339)
+	recent := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	address := func(name, status, created string) *computepb.Address {
+		return &computepb.Address{
+			Name:              pointer.String(name),
+			Region:            pointer.String("https://www.googleapis.com/compute/v1/projects/testing/regions/us-central1"),
+			Status:            pointer.String(status),
+			CreationTimestamp: pointer.String(created),
+		}
+	}
+	iter := func(addresses ...*computepb.Address) addressIterator {
+		return &addressIteratorMock{
+			NextFunc: func() (*computepb.Address, error) {
+				if len(addresses) == 0 {
+					return nil, iterator.Done
+				}
+				a := addresses[0]
+				addresses = addresses[1:]
+				return a, nil
+			},
+		}
+	}
+	key := func(name string) string {
+		return "projects/testing/regions/us-central1/addresses/" + name
+	}
+
+	t.Run("mark", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{
+			key("in-use"): "2020-01-01",
+			key("marked"): "2020-01-01",
+			key("gone"):   "2020-01-01",
+			"projects/other/regions/us-central1/addresses/gone": "2020-01-01",
+		}
+		c := NewAddressCleaner(&addressesClientMock{})
+		stats, err := c.markAll(context.Background(), iter(
+			address("unused", "RESERVED", old),
+			address("new", "RESERVED", recent),
+			address("in-use", "IN_USE", old),
+			address("marked", "RESERVED", old),
+		), AddressOptions{ProjectID: "testing", Cutoff: 30 * 24 * time.Hour, Marks: marks})
+		require.NoError(t, err)
+		require.Equal(t, ResourceStats{Stats: Stats{Scanned: 4}, Marked: 1, Unmarked: 1}, stats)
+		require.Equal(t, ResourceMarks{
+			key("unused"): markValue(time.Now()),
+			key("marked"): "2020-01-01",
+			"projects/other/regions/us-central1/addresses/gone": "2020-01-01",
+		}, marks)
+	})
+
+	t.Run("mark dry run", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{key("gone"): "2020-01-01"}
+		c := NewAddressCleaner(&addressesClientMock{})
+		stats, err := c.markAll(context.Background(), iter(address("unused", "RESERVED", old)), AddressOptions{ProjectID: "testing", Marks: marks, DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.Marked)
+		require.Equal(t, ResourceMarks{key("gone"): "2020-01-01"}, marks)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{
+			key("marked"): "2020-01-01",
+			key("in-use"): "2020-01-01",
+			key("grace"):  markValue(time.Now()),
+		}
+		client := &addressesClientMock{
+			DeleteFunc: func(context.Context, *computepb.DeleteAddressRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		c := NewAddressCleaner(client)
+		stats, err := c.releaseAll(context.Background(), iter(
+			address("marked", "RESERVED", old),
+			address("unmarked", "RESERVED", old),
+			address("in-use", "IN_USE", old),
+			address("grace", "RESERVED", old),
+		), AddressOptions{ProjectID: "testing", GracePeriod: 7 * 24 * time.Hour, Marks: marks})
+		require.NoError(t, err)
+		require.Equal(t, ResourceStats{Stats: Stats{Scanned: 4}, Deleted: 1}, stats)
+		require.Len(t, client.DeleteCalls(), 1)
+		req := client.DeleteCalls()[0].DeleteAddressRequest
+		require.Equal(t, "marked", req.GetAddress())
+		require.Equal(t, "us-central1", req.GetRegion())
+		require.NotEmpty(t, req.GetRequestId())
+		require.NotContains(t, marks, key("marked"))
+		require.Contains(t, marks, key("in-use"))
+	})
+
+	t.Run("release dry run", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{key("marked"): "2020-01-01"}
+		client := &addressesClientMock{}
+		c := NewAddressCleaner(client)
+		stats, err := c.releaseAll(context.Background(), iter(address("marked", "RESERVED", old)), AddressOptions{ProjectID: "testing", Marks: marks, DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.Deleted)
+		require.Empty(t, client.DeleteCalls())
+		require.Contains(t, marks, key("marked"))
+	})
+}
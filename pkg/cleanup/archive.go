@@ -0,0 +1,65 @@
+package cleanup
+
+import (
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Mode is how a Cleaner disposes of a marked disk.
+type Mode string
+
+const (
+	// ModeDelete deletes the disk, after a standard snapshot if
+	// CleanupOptions.DoSnapshot is set.
+	ModeDelete Mode = "delete"
+	// ModeArchive takes an archive snapshot of the disk, which is cheaper
+	// to keep but billed for at least 90 days and slower to restore, and
+	// then deletes the disk. The disk can be thawed from the snapshot.
+	ModeArchive Mode = "archive"
+)
+
+// ParseMode validates s as a Mode. Empty means ModeDelete.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return ModeDelete, nil
+	case ModeDelete, ModeArchive:
+		return m, nil
+	}
+	return "", xerrors.Errorf("unknown cleanup mode %q, expected delete or archive", s)
+}
+
+// SnapshotType is the type of the snapshots a Cleaner takes.
+type SnapshotType string
+
+const (
+	// SnapshotStandard takes standard snapshots, the default of the API.
+	SnapshotStandard SnapshotType = "standard"
+	// SnapshotArchive takes archive snapshots, which are cheaper to keep
+	// but billed for at least 90 days and slower to restore.
+	SnapshotArchive SnapshotType = "archive"
+)
+
+// ParseSnapshotType validates s as a SnapshotType. Empty is left to the
+// Mode: SnapshotArchive in ModeArchive, and SnapshotStandard otherwise.
+func ParseSnapshotType(s string) (SnapshotType, error) {
+	switch t := SnapshotType(s); t {
+	case "", SnapshotStandard, SnapshotArchive:
+		return t, nil
+	}
+	return "", xerrors.Errorf("unknown snapshot type %q, expected standard or archive", s)
+}
+
+// snapshotType returns the type of the snapshots taken with opts, empty for
+// the default of the API. ModeArchive always takes archive snapshots.
+func (opts CleanupOptions) snapshotType() string {
+	if opts.Mode == ModeArchive || opts.SnapshotType == SnapshotArchive {
+		return computepb.Snapshot_ARCHIVE.String()
+	}
+	return ""
+}
+
+// IsArchive reports whether snapshot is an archive snapshot.
+func IsArchive(snapshot *computepb.Snapshot) bool {
+	return snapshot.GetSnapshotType() == computepb.Snapshot_ARCHIVE.String()
+}
@@ -0,0 +1,141 @@
+package cleanup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_ParseMode(t *testing.T) {
+	t.Parallel()
+
+	m, err := ParseMode("")
+	require.NoError(t, err)
+	require.Equal(t, ModeDelete, m)
+
+	m, err = ParseMode("archive")
+	require.NoError(t, err)
+	require.Equal(t, ModeArchive, m)
+
+	_, err = ParseMode("freeze")
+	require.EqualError(t, err, `unknown cleanup mode "freeze", expected delete or archive`)
+}
+
+func Test_ParseSnapshotType(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"", "standard", "archive"} {
+		snapshotType, err := ParseSnapshotType(s)
+		require.NoError(t, err)
+		require.Equal(t, SnapshotType(s), snapshotType)
+	}
+	_, err := ParseSnapshotType("ARCHIVE")
+	require.EqualError(t, err, `unknown snapshot type "ARCHIVE", expected standard or archive`)
+
+	require.Empty(t, CleanupOptions{}.snapshotType())
+	require.Empty(t, CleanupOptions{SnapshotType: SnapshotStandard}.snapshotType())
+	require.Equal(t, "ARCHIVE", CleanupOptions{SnapshotType: SnapshotArchive}.snapshotType())
+	require.Equal(t, "ARCHIVE", CleanupOptions{Mode: ModeArchive}.snapshotType())
+}
+
+func Test_ArchiveMode(t *testing.T) {
+	t.Parallel()
+
+	id := uint64(42)
+	disk := &computepb.Disk{
+		Id:     &id,
+		Name:   pointer.String("test-disk"),
+		Labels: map[string]string{LabelMarkedForDeletion: "true"},
+	}
+	opts := CleanupOptions{
+		ProjectID:     "testing",
+		Zones:         []string{"testzone"},
+		DoSnapshot:    true,
+		Mode:          ModeArchive,
+		ReuseSnapshot: 24 * time.Hour,
+		Snapshots:     existingSnapshots(disk, computepb.Snapshot_ARCHIVE),
+	}
+	// reuse returns the snapshot reused or taken given the recent
+	// snapshot of the disk, and the snapshots created.
+	reuse := func(t *testing.T, recent *computepb.Snapshot) (*computepb.Snapshot, []*computepb.Snapshot) {
+		dc := &disksClientMock{
+			CreateSnapshotFunc: func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				// the operation cannot be faked, so stop at a snapshot taken
+				// by an earlier run
+				return nil, &googleapi.Error{Code: http.StatusConflict, Message: "already exists"}
+			},
+		}
+		si := &snapshotIteratorMock{
+			NextFunc: func() (*computepb.Snapshot, error) {
+				if recent == nil {
+					return nil, iterator.Done
+				}
+				s := recent
+				recent = nil
+				return s, nil
+			},
+		}
+		c := NewCleaner(dc, nil)
+		snapshot, err := c.reuseSnapshot(context.Background(), disk, "testzone", si, retrier{backoff: callBackoff, sleep: c.sleep}, opts)
+		require.NoError(t, err)
+		var created []*computepb.Snapshot
+		for _, call := range dc.CreateSnapshotCalls() {
+			created = append(created, call.CreateSnapshotDiskRequest.GetSnapshotResource())
+		}
+		return snapshot, created
+	}
+	snapshot := func(snapshotType computepb.Snapshot_SnapshotType) *computepb.Snapshot {
+		return &computepb.Snapshot{
+			Name:              pointer.String("test-disk"),
+			CreationTimestamp: pointer.String(time.Now().Add(-time.Hour).Format(time.RFC3339)),
+			Status:            pointer.String(computepb.Snapshot_READY.String()),
+			SnapshotType:      pointer.String(snapshotType.String()),
+		}
+	}
+
+	t.Run("takes archive snapshot", func(t *testing.T) {
+		t.Parallel()
+		_, created := reuse(t, nil)
+		require.Len(t, created, 1)
+		require.True(t, IsArchive(created[0]))
+	})
+
+	t.Run("does not reuse standard snapshot", func(t *testing.T) {
+		t.Parallel()
+		_, created := reuse(t, snapshot(computepb.Snapshot_STANDARD))
+		require.Len(t, created, 1)
+		require.True(t, IsArchive(created[0]))
+	})
+
+	t.Run("reuses archive snapshot", func(t *testing.T) {
+		t.Parallel()
+		found, created := reuse(t, snapshot(computepb.Snapshot_ARCHIVE))
+		require.Empty(t, created)
+		require.True(t, IsArchive(found))
+	})
+
+	t.Run("requires snapshots", func(t *testing.T) {
+		t.Parallel()
+		opts := opts
+		opts.DoSnapshot = false
+		_, err := NewCleaner(&disksClientMock{}, nil).CleanupDisks(context.Background(), opts)
+		require.EqualError(t, err, "cleanup mode archive requires snapshots, the snapshot policy always and a single phase")
+	})
+
+	t.Run("takes archive snapshots only", func(t *testing.T) {
+		t.Parallel()
+		opts := opts
+		opts.SnapshotType = SnapshotStandard
+		_, err := NewCleaner(&disksClientMock{}, nil).CleanupDisks(context.Background(), opts)
+		require.EqualError(t, err, "cleanup mode archive takes archive snapshots")
+	})
+}
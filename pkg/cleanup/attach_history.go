@@ -0,0 +1,87 @@
+package cleanup
+
+import (
+	"time"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// AttachHistory records when disks were last attached to or detached from an
+// instance according to a source other than the disk itself, e.g. Cloud Audit
+// Logs. A Marker uses it when the disk does not record a last attach time, or
+// an earlier one, as for disks imported from another project. The zero value
+// is not usable, use NewAttachHistory.
+type AttachHistory struct {
+	// last is keyed by project/name. Disks of the same name in different
+	// zones share an entry, which errs on the side of keeping them.
+	last map[string]time.Time
+}
+
+// NewAttachHistory returns an empty AttachHistory.
+func NewAttachHistory() *AttachHistory {
+	return &AttachHistory{last: make(map[string]time.Time)}
+}
+
+// Add records that the disk diskName in projectID was attached or detached at
+// t. Only the latest time is kept.
+func (h *AttachHistory) Add(projectID, diskName string, t time.Time) {
+	key := projectID + "/" + diskName
+	if t.After(h.last[key]) {
+		h.last[key] = t
+	}
+}
+
+// Len returns the number of disks in the history.
+func (h *AttachHistory) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.last)
+}
+
+// LastAttached returns when the disk diskName in projectID was last attached
+// or detached. It is safe to call on a nil history.
+func (h *AttachHistory) LastAttached(projectID, diskName string) (time.Time, bool) {
+	if h == nil {
+		return time.Time{}, false
+	}
+	t, ok := h.last[projectID+"/"+diskName]
+	return t, ok
+}
+
+// LastUsed returns when disk was last in use, as an RFC 3339 timestamp: the
+// latest of its creation, last attach and last detach timestamps. It is empty
+// if the disk has none.
+func LastUsed(disk *computepb.Disk) string {
+	return lastActivityTimestamp(disk, "", "", nil)
+}
+
+// lastActivityTimestamp returns when disk was last in use: the latest of its
+// creation, last attach and last detach timestamps, and of the time from
+// history. A disk detached recently is in use until then, even if it was
+// attached long ago. An invalid timestamp is returned as is, to be reported
+// by handleMarkAction, and "" if there is none.
+func lastActivityTimestamp(disk *computepb.Disk, projectID, zone string, history *AttachHistory) string {
+	var (
+		latest time.Time
+		ts     string
+	)
+	for _, s := range []string{disk.GetCreationTimestamp(), disk.GetLastAttachTimestamp(), disk.GetLastDetachTimestamp()} {
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return s
+		}
+		if t.After(latest) {
+			latest, ts = t, s
+		}
+	}
+	t, ok := history.LastAttached(projectID, disk.GetName())
+	if !ok || !t.After(latest) {
+		return ts
+	}
+	diskLogger(projectID, zone, disk).Debug().Time("lastAttachTime", t).Msg("using last attach time from attach history")
+	return t.Format(time.RFC3339)
+}
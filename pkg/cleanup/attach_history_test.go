@@ -0,0 +1,89 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_AttachHistory(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+	h := NewAttachHistory()
+	h.Add("testing", "test-disk", now.Add(-48*time.Hour))
+	h.Add("testing", "test-disk", now.Add(-time.Hour))
+	h.Add("testing", "test-disk", now.Add(-72*time.Hour))
+	require.Equal(t, 1, h.Len())
+
+	last, ok := h.LastAttached("testing", "test-disk")
+	require.True(t, ok)
+	require.Equal(t, now.Add(-time.Hour), last)
+	_, ok = h.LastAttached("other", "test-disk")
+	require.False(t, ok)
+
+	var empty *AttachHistory
+	require.Equal(t, 0, empty.Len())
+	_, ok = empty.LastAttached("testing", "test-disk")
+	require.False(t, ok)
+
+	disk := func(lastAttach string) *computepb.Disk {
+		return &computepb.Disk{Name: pointer.String("test-disk"), LastAttachTimestamp: pointer.String(lastAttach)}
+	}
+	// missing or earlier timestamps are replaced
+	require.Equal(t, now.Add(-time.Hour).Format(time.RFC3339), lastActivityTimestamp(disk(""), "testing", "testzone", h))
+	require.Equal(t, now.Add(-time.Hour).Format(time.RFC3339), lastActivityTimestamp(disk(now.AddDate(0, 0, -60).Format(time.RFC3339)), "testing", "testzone", h))
+	// later or invalid ones are kept
+	require.Equal(t, now.Format(time.RFC3339), lastActivityTimestamp(disk(now.Format(time.RFC3339)), "testing", "testzone", h))
+	require.Equal(t, "invalid", lastActivityTimestamp(disk("invalid"), "testing", "testzone", h))
+	require.Equal(t, "", lastActivityTimestamp(disk(""), "testing", "testzone", nil))
+}
+
+func Test_LastActivityTimestamp(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	ago := func(days int) string {
+		return now.AddDate(0, 0, -days).Format(time.RFC3339)
+	}
+	tests := []struct {
+		name     string
+		disk     *computepb.Disk
+		expected string
+	}{
+		{
+			name: "never used",
+			disk: &computepb.Disk{},
+		},
+		{
+			name:     "created",
+			disk:     &computepb.Disk{CreationTimestamp: pointer.String(ago(100))},
+			expected: ago(100),
+		},
+		{
+			name:     "attached after creation",
+			disk:     &computepb.Disk{CreationTimestamp: pointer.String(ago(100)), LastAttachTimestamp: pointer.String(ago(90))},
+			expected: ago(90),
+		},
+		{
+			name:     "detached recently",
+			disk:     &computepb.Disk{CreationTimestamp: pointer.String(ago(100)), LastAttachTimestamp: pointer.String(ago(90)), LastDetachTimestamp: pointer.String(ago(1))},
+			expected: ago(1),
+		},
+		{
+			name:     "invalid detach",
+			disk:     &computepb.Disk{LastAttachTimestamp: pointer.String(ago(90)), LastDetachTimestamp: pointer.String("invalid")},
+			expected: "invalid",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expected, lastActivityTimestamp(tt.disk, "testing", "testzone", nil))
+		})
+	}
+}
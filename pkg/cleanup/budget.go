@@ -0,0 +1,76 @@
+package cleanup
+
+import (
+	"sync"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// DeletionBudget limits the blast radius of a cleanup run: the number of
+// disks it deletes and their total size. Once a disk does not fit, the budget
+// is exhausted and no further disk is deleted, while the remaining ones are
+// counted. A zero limit is unlimited. It is safe for concurrent use.
+type DeletionBudget struct {
+	maxDisks int
+	maxGB    int64
+
+	mu             sync.Mutex
+	disks          int
+	gb             int64
+	exhausted      bool
+	remainingDisks int
+	remainingGB    int64
+}
+
+// NewDeletionBudget returns a budget of maxDisks disks and maxGB GB.
+func NewDeletionBudget(maxDisks int, maxGB int64) *DeletionBudget {
+	return &DeletionBudget{maxDisks: maxDisks, maxGB: maxGB}
+}
+
+// reserve takes disk out of the budget, or returns a
+// diskerr.CodeBudgetExhausted error if it does not fit. A nil budget is
+// unlimited.
+func (b *DeletionBudget) reserve(disk *computepb.Disk) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	size := disk.GetSizeGb()
+	if !b.exhausted && (b.maxDisks > 0 && b.disks+1 > b.maxDisks || b.maxGB > 0 && b.gb+size > b.maxGB) {
+		b.exhausted = true
+	}
+	if b.exhausted {
+		b.remainingDisks++
+		b.remainingGB += size
+		return diskerr.New(diskerr.CodeBudgetExhausted, "skipping disk %s: deletion budget of the run exhausted after %d disks and %d GB", disk.GetName(), b.disks, b.gb)
+	}
+	b.disks++
+	b.gb += size
+	return nil
+}
+
+// Exhausted reports whether a disk did not fit in the budget.
+func (b *DeletionBudget) Exhausted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exhausted
+}
+
+// Used returns the number and total size of the disks taken out of the
+// budget.
+func (b *DeletionBudget) Used() (disks int, gb int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.disks, b.gb
+}
+
+// Remaining returns the number and total size of the disks that were not
+// deleted as they did not fit in the budget.
+func (b *DeletionBudget) Remaining() (disks int, gb int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remainingDisks, b.remainingGB
+}
@@ -0,0 +1,42 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func Test_DeletionBudget(t *testing.T) {
+	t.Parallel()
+
+	disk := func(sizeGB int64) *computepb.Disk {
+		return &computepb.Disk{Name: pointer.String("test-disk"), SizeGb: pointer.Int64(sizeGB)}
+	}
+
+	var unlimited *DeletionBudget
+	require.NoError(t, unlimited.reserve(disk(1000)))
+
+	b := NewDeletionBudget(3, 100)
+	require.NoError(t, b.reserve(disk(50)))
+	require.NoError(t, b.reserve(disk(40)))
+	err := b.reserve(disk(20))
+	require.Equal(t, diskerr.CodeBudgetExhausted, diskerr.CodeOf(err))
+	require.False(t, IsFailure(err))
+	// a disk that would fit is not deleted either once the budget is exhausted
+	require.Error(t, b.reserve(disk(5)))
+	require.True(t, b.Exhausted())
+	disks, gb := b.Used()
+	require.Equal(t, 2, disks)
+	require.Equal(t, int64(90), gb)
+	disks, gb = b.Remaining()
+	require.Equal(t, 2, disks)
+	require.Equal(t, int64(25), gb)
+
+	b = NewDeletionBudget(1, 0)
+	require.NoError(t, b.reserve(disk(1000)))
+	require.Error(t, b.reserve(disk(1)))
+}
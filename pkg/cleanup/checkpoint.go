@@ -0,0 +1,173 @@
+package cleanup
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Checkpointer persists the progress of a run, so that a run that was killed,
+// e.g. on a preempted spot VM, can be resumed close to where it stopped.
+type Checkpointer interface {
+	// Checkpoint records that every disk of projectID listed before cursor
+	// was processed, as were those of the page in cursor.Done. Passing
+	// cursor in MarkOptions.Resume or CleanupOptions.Resume continues from
+	// there.
+	Checkpoint(projectID string, cursor Cursor) error
+}
+
+// checkpoints saves a checkpoint after every so many processed disks. As
+// disks may be processed concurrently, a checkpoint never moves past a disk
+// that is still being processed. The disks of the page of the checkpoint
+// that were processed are recorded with it, and skipped on resume.
+type checkpoints struct {
+	cp        Checkpointer
+	projectID string
+	every     int
+	// skip holds the IDs of the disks processed before the run resumed.
+	skip map[uint64]bool
+
+	mu  sync.Mutex
+	seq int
+	// inFlight holds the cursors of the disks being processed by their
+	// sequence number.
+	inFlight map[int]Cursor
+	// ids holds the IDs of the disks being processed by their sequence
+	// number.
+	ids map[int]uint64
+	// done holds the IDs of the processed disks by the page they were
+	// listed from, for the pages that may still be checkpointed.
+	done map[string][]uint64
+	// last is the cursor of the disk dispatched last, nil if the iterator
+	// does not know cursors.
+	last *Cursor
+	// pending counts the disks processed since the last checkpoint.
+	pending int
+}
+
+// newCheckpoints returns the checkpoints of a run of projectID resumed from
+// resume, or started at the beginning if nil.
+func newCheckpoints(cp Checkpointer, projectID string, every int, resume *Cursor) *checkpoints {
+	if every < 1 {
+		every = 1
+	}
+	c := &checkpoints{
+		cp:        cp,
+		projectID: projectID,
+		every:     every,
+		inFlight:  make(map[int]Cursor),
+		ids:       make(map[int]uint64),
+		done:      make(map[string][]uint64),
+	}
+	if resume != nil && len(resume.Done) > 0 {
+		c.skip = make(map[uint64]bool, len(resume.Done))
+		for _, id := range resume.Done {
+			c.skip[id] = true
+		}
+	}
+	return c
+}
+
+// skipped reports whether disk, returned last by di, was processed before
+// the run resumed. It is then still recorded as done in the checkpoints of
+// its page.
+func (c *checkpoints) skipped(di diskIterator, disk *computepb.Disk) bool {
+	if !c.skip[disk.GetId()] {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if it, ok := di.(cursorIterator); ok {
+		key := it.Cursor().String()
+		c.done[key] = append(c.done[key], disk.GetId())
+	}
+	return true
+}
+
+// dispatched records that disk, returned last by di, is being processed, and
+// returns its sequence number for completed.
+func (c *checkpoints) dispatched(di diskIterator, disk *computepb.Disk) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	if it, ok := di.(cursorIterator); ok {
+		cursor := it.Cursor()
+		c.inFlight[c.seq] = cursor
+		c.ids[c.seq] = disk.GetId()
+		c.last = &cursor
+	}
+	return c.seq
+}
+
+// completed records that the disk with sequence number seq was processed.
+func (c *checkpoints) completed(seq int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cursor, ok := c.inFlight[seq]; ok {
+		key := cursor.String()
+		c.done[key] = append(c.done[key], c.ids[seq])
+	}
+	delete(c.inFlight, seq)
+	delete(c.ids, seq)
+	c.pending++
+	if c.pending >= c.every {
+		c.save(nil)
+	}
+}
+
+// finish saves a checkpoint once processing stopped with err, which is the
+// page that could not be fetched if err is a PageError.
+func (c *checkpoints) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.save(err)
+}
+
+// save records the page of the oldest disk still being processed, or else of
+// the disk dispatched last. Nothing is saved if no disk was processed since
+// the last checkpoint. c.mu must be held.
+func (c *checkpoints) save(err error) {
+	if c.cp == nil {
+		return
+	}
+	var cursor Cursor
+	var pageErr *PageError
+	switch {
+	case errors.As(err, &pageErr):
+		cursor = pageErr.Cursor
+	case c.last != nil && c.pending > 0:
+		// the page is processed again on resume, which is safe as every
+		// action is idempotent
+		cursor = *c.last
+		oldest := 0
+		for seq, inFlight := range c.inFlight {
+			if oldest == 0 || seq < oldest {
+				oldest, cursor = seq, inFlight
+			}
+		}
+	default:
+		return
+	}
+	// pages other than those of the disks in flight and the one dispatched
+	// last are never checkpointed again
+	keep := map[string]bool{cursor.String(): true}
+	if c.last != nil {
+		keep[c.last.String()] = true
+	}
+	for _, inFlight := range c.inFlight {
+		keep[inFlight.String()] = true
+	}
+	for key := range c.done {
+		if !keep[key] {
+			delete(c.done, key)
+		}
+	}
+	cursor.Done = append([]uint64(nil), c.done[cursor.String()]...)
+	if err := c.cp.Checkpoint(c.projectID, cursor); err != nil {
+		log.Warn().Err(err).Str("projectID", c.projectID).Str("cursor", cursor.String()).Msg("failed to save checkpoint")
+		return
+	}
+	c.pending = 0
+}
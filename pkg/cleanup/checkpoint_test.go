@@ -0,0 +1,303 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+)
+
+// fakeProject holds the disks of a project in memory. Disks are listed in
+// pages of pageSize, and a page token is the name of the first disk of the
+// page, so that deleting disks does not move later disks to earlier pages.
+type fakeProject struct {
+	mu       sync.Mutex
+	disks    map[string]*computepb.Disk
+	pageSize int
+	// calls counts the SetLabels and Delete calls per disk.
+	calls map[string]int
+}
+
+func newFakeProject(n, pageSize int) *fakeProject {
+	f := &fakeProject{disks: make(map[string]*computepb.Disk), pageSize: pageSize, calls: make(map[string]int)}
+	for i := 0; i < n; i++ {
+		name, id := fmt.Sprintf("disk-%02d", i), uint64(i)
+		f.disks[name] = &computepb.Disk{
+			Id:                  &id,
+			Name:                pointer.String(name),
+			Zone:                pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b"),
+			LastAttachTimestamp: pointer.String(time.Now().Add(-90 * 24 * time.Hour).Format(time.RFC3339)),
+			LabelFingerprint:    pointer.String("0"),
+		}
+	}
+	return f
+}
+
+// list returns the list func of a retryingDiskIterator over the disks that
+// match filter.
+func (f *fakeProject) list(filter func(*computepb.Disk) bool) func(string) pagedDiskIterator {
+	return func(token string) pagedDiskIterator {
+		var buf []*computepb.Disk
+		fetched := false
+		return &pagedDiskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				if len(buf) == 0 {
+					if fetched && token == "" {
+						return nil, iterator.Done
+					}
+					buf, token = f.page(token, filter)
+					fetched = true
+					if len(buf) == 0 {
+						return nil, iterator.Done
+					}
+				}
+				disk := buf[0]
+				buf = buf[1:]
+				return disk, nil
+			},
+			PageTokenFunc: func() string {
+				return token
+			},
+		}
+	}
+}
+
+// page returns copies of the disks on the page starting at token, and the
+// token of the next page.
+func (f *fakeProject) page(token string, filter func(*computepb.Disk) bool) ([]*computepb.Disk, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for name, disk := range f.disks {
+		if name >= token && filter(disk) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var page []*computepb.Disk
+	for i, name := range names {
+		if i == f.pageSize {
+			return page, name
+		}
+		disk := f.disks[name]
+		id := disk.GetId()
+		labels := make(map[string]string, len(disk.Labels))
+		for k, v := range disk.Labels {
+			labels[k] = v
+		}
+		page = append(page, &computepb.Disk{
+			Id:                  &id,
+			Name:                pointer.String(name),
+			Zone:                pointer.String(disk.GetZone()),
+			Labels:              labels,
+			LabelFingerprint:    pointer.String(disk.GetLabelFingerprint()),
+			LastAttachTimestamp: pointer.String(disk.GetLastAttachTimestamp()),
+		})
+	}
+	return page, ""
+}
+
+// client returns a DisksClient that applies SetLabels and Delete to the
+// project and calls kill after every killEvery of those calls.
+func (f *fakeProject) client(killEvery int, kill func()) DisksClient {
+	var n int
+	count := func(name string) {
+		f.calls[name]++
+		n++
+		if n%killEvery == 0 {
+			kill()
+		}
+	}
+	return &disksClientMock{
+		SetLabelsFunc: func(_ context.Context, req *computepb.SetLabelsDiskRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			for _, disk := range f.disks {
+				if fmt.Sprintf("%d", disk.GetId()) != req.GetResource() {
+					continue
+				}
+				if disk.GetLabelFingerprint() != req.GetZoneSetLabelsRequestResource().GetLabelFingerprint() {
+					return nil, fmt.Errorf("stale fingerprint")
+				}
+				disk.Labels = req.GetZoneSetLabelsRequestResource().GetLabels()
+				disk.LabelFingerprint = pointer.String(disk.GetLabelFingerprint() + "'")
+				count(disk.GetName())
+			}
+			return nil, nil
+		},
+		DeleteFunc: func(_ context.Context, req *computepb.DeleteDiskRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			delete(f.disks, req.GetDisk())
+			count(req.GetDisk())
+			return nil, nil
+		},
+	}
+}
+
+// fakeCheckpointer keeps the last checkpoint of a process that can be killed
+// at any time: once dead, it saves nothing, as a killed process would.
+type fakeCheckpointer struct {
+	ctx    context.Context
+	cursor Cursor
+	saves  int
+}
+
+func (f *fakeCheckpointer) Checkpoint(_ string, cursor Cursor) error {
+	if f.ctx.Err() != nil {
+		return nil
+	}
+	f.cursor = cursor
+	f.saves++
+	return nil
+}
+
+func Test_KillRestartCycles(t *testing.T) {
+	t.Parallel()
+
+	// run restarts a run from the last checkpoint each time it was killed,
+	// and returns how often it ran
+	run := func(t *testing.T, f *fakeProject, filter func(*computepb.Disk) bool, processAll func(context.Context, DisksClient, diskIterator, Checkpointer) (Stats, error)) int {
+		var cursor Cursor
+		for runs := 1; ; runs++ {
+			require.Less(t, runs, 100, "run does not make progress")
+			ctx, kill := context.WithCancel(context.Background())
+			cp := &fakeCheckpointer{ctx: ctx, cursor: cursor}
+			it := newRetryingDiskIterator(ctx, "", cursor.PageToken, f.list(filter))
+			_, err := processAll(ctx, f.client(3, kill), it, cp)
+			kill()
+			if err == nil {
+				return runs
+			}
+			require.ErrorIs(t, err, context.Canceled)
+			cursor = cp.cursor
+		}
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		concurrency := concurrency
+		// a run is killed after 3 calls, so a serial run over 20 disks is
+		// restarted many times. Concurrent workers finish the calls they
+		// started before the kill, so each concurrent run gets further and
+		// fewer runs are needed.
+		minRuns := 5
+		if concurrency > 1 {
+			minRuns = 2
+		}
+		t.Run(fmt.Sprintf("mark concurrency %d", concurrency), func(t *testing.T) {
+			t.Parallel()
+			f := newFakeProject(20, 4)
+			runs := run(t, f, func(*computepb.Disk) bool { return true }, func(ctx context.Context, dc DisksClient, it diskIterator, cp Checkpointer) (Stats, error) {
+				return NewMarker(dc, events.NewBus()).markAll(ctx, it, MarkOptions{
+					ProjectID:       "testing",
+					Cutoff:          30 * 24 * time.Hour,
+					Checkpoint:      cp,
+					CheckpointEvery: 2,
+					Concurrency:     concurrency,
+				})
+			})
+			require.Greater(t, runs, minRuns)
+			require.Len(t, f.calls, 20)
+			for name, disk := range f.disks {
+				require.Equal(t, markValue(time.Now()), disk.Labels[LabelMarkedForDeletion], name)
+				require.Equal(t, 1, f.calls[name], "%s labelled more than once", name)
+			}
+		})
+
+		t.Run(fmt.Sprintf("cleanup concurrency %d", concurrency), func(t *testing.T) {
+			t.Parallel()
+			f := newFakeProject(20, 4)
+			for name, disk := range f.disks {
+				if !strings.HasSuffix(name, "7") {
+					disk.Labels = map[string]string{LabelMarkedForDeletion: "true"}
+				}
+			}
+			marked := func(disk *computepb.Disk) bool {
+				return disk.Labels[LabelMarkedForDeletion] == "true"
+			}
+			runs := run(t, f, marked, func(ctx context.Context, dc DisksClient, it diskIterator, cp Checkpointer) (Stats, error) {
+				c := NewCleaner(dc, events.NewBus())
+				c.wait = doneOperation
+				return c.cleanupAll(ctx, it, CleanupOptions{
+					ProjectID:       "testing",
+					Checkpoint:      cp,
+					CheckpointEvery: 2,
+					Concurrency:     concurrency,
+				})
+			})
+			require.Greater(t, runs, minRuns)
+			require.Len(t, f.calls, 18)
+			for name, n := range f.calls {
+				require.Equal(t, 1, n, "%s deleted more than once", name)
+			}
+			require.Len(t, f.disks, 2)
+		})
+	}
+}
+
+func Test_ResumeSkipsProcessedDisks(t *testing.T) {
+	t.Parallel()
+
+	f := newFakeProject(8, 4)
+	// the killed run labelled disk-04 and disk-06 of the second page, but
+	// died before the next checkpoint
+	resume := &Cursor{PageToken: "disk-04", Done: []uint64{4, 6}}
+	ctx := context.Background()
+	cp := &fakeCheckpointer{ctx: ctx}
+	it := newRetryingDiskIterator(ctx, "", resume.PageToken, f.list(func(*computepb.Disk) bool { return true }))
+	stats, err := NewMarker(f.client(100, func() {}), events.NewBus()).markAll(ctx, it, MarkOptions{
+		ProjectID:       "testing",
+		Cutoff:          30 * 24 * time.Hour,
+		Checkpoint:      cp,
+		CheckpointEvery: 1,
+		Concurrency:     1,
+		Resume:          resume,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.Scanned)
+	require.Equal(t, map[string]int{"disk-05": 1, "disk-07": 1}, f.calls)
+	require.Equal(t, 2, cp.saves)
+}
+
+func Test_CheckpointRecordsProcessedDisks(t *testing.T) {
+	t.Parallel()
+
+	f := newFakeProject(8, 4)
+	ctx := context.Background()
+	it := newRetryingDiskIterator(ctx, "", "", f.list(func(*computepb.Disk) bool { return true }))
+	cp := &recordingCheckpointer{}
+	_, err := NewMarker(f.client(100, func() {}), events.NewBus()).markAll(ctx, it, MarkOptions{
+		ProjectID:       "testing",
+		Cutoff:          30 * 24 * time.Hour,
+		Checkpoint:      cp,
+		CheckpointEvery: 1,
+		Concurrency:     1,
+	})
+	require.NoError(t, err)
+	// after six disks, the checkpoint is at the second page with its first
+	// two disks done
+	require.Equal(t, "disk-04", cp.cursors[5].PageToken)
+	require.Equal(t, []uint64{4, 5}, cp.cursors[5].Done)
+}
+
+// recordingCheckpointer records every checkpoint.
+type recordingCheckpointer struct {
+	cursors []Cursor
+}
+
+func (r *recordingCheckpointer) Checkpoint(_ string, cursor Cursor) error {
+	r.cursors = append(r.cursors, cursor)
+	return nil
+}
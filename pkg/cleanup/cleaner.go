@@ -0,0 +1,517 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// CleanupOptions configures a single CleanupDisks call.
+type CleanupOptions struct {
+	ProjectID string
+	// Zones to list disks in. Nil means all zones of the project.
+	Zones []string
+	// Selector selects among the listed disks those to process.
+	Selector Selector
+	// AllFields lists disks with all their fields, rather than only those
+	// read when processing them.
+	AllFields bool
+	// PageSize is how many disks are listed per page, 0 for MaxPageSize.
+	// Smaller pages are cheaper to retry when listing very large zones.
+	PageSize int
+	// Tenant restricts listing and changes to the disks of one tenant. A
+	// listed disk of another tenant fails with diskerr.CodeTenantMismatch.
+	Tenant Tenant
+	// Plan, if set, is the reviewed plan of a mark run. Only the disks it
+	// deletes are deleted, and only if they did not change since.
+	Plan *Plan
+	// ExemptLabel is the label that, set to "true", exempts a disk from being
+	// deleted even if it is marked, e.g. DefaultExemptLabel. Empty exempts
+	// no disk.
+	ExemptLabel string
+	// IncludeBootDisks deletes marked boot disks too, see checkBootDisk.
+	IncludeBootDisks bool
+	// IncludeManaged deletes marked disks managed by infrastructure as code
+	// too, see checkManaged.
+	IncludeManaged bool
+	// GracePeriod is how long ago a disk must have been marked to be
+	// deleted. Disks marked "true", which does not tell when, are only
+	// deleted without a grace period; the next Marker run dates their mark.
+	GracePeriod time.Duration
+	// DoSnapshot creates a snapshot of each disk before deleting it.
+	DoSnapshot bool
+	// Mode is how disks are disposed of. Defaults to ModeDelete.
+	// ModeArchive requires DoSnapshot, SnapshotAlways and PhaseAll.
+	Mode Mode
+	// Exporter, if set, exports every disk before it is deleted, after its
+	// snapshot. A disk whose export failed is not deleted.
+	Exporter Exporter
+	// SnapshotPolicy applies if DoSnapshot is set. Defaults to SnapshotAlways.
+	SnapshotPolicy SnapshotPolicy
+	// RecentSnapshot is how old a snapshot may be to count as recent for
+	// SnapshotRequireRecent.
+	RecentSnapshot time.Duration
+	// ReuseSnapshot is how old a snapshot taken by a Cleaner may be to be
+	// used instead of taking another one for SnapshotAlways, so that retried
+	// cleanups do not snapshot a disk twice. 0 always takes a snapshot.
+	ReuseSnapshot time.Duration
+	// SnapshotName names the snapshots taken. Nil names them after the
+	// disk.
+	SnapshotName *SnapshotNamer
+	// SnapshotLabels are set on the snapshots taken, in addition to the
+	// labels of the disk.
+	SnapshotLabels map[string]string
+	// SnapshotStorageLocation is the region or multi-region to store the
+	// snapshots taken in, e.g. us. Empty stores them in the region of the
+	// disk.
+	SnapshotStorageLocation string
+	// SnapshotType is the type of the snapshots taken. Empty takes standard
+	// snapshots, or archive ones in ModeArchive, which does not allow
+	// SnapshotStandard.
+	SnapshotType SnapshotType
+	// VerifySnapshot checks that the snapshot of a disk is ready, and of
+	// the same size and source disk, before deleting the disk.
+	VerifySnapshot bool
+	// Snapshots is used to look for recent snapshots and verify them.
+	// Required for SnapshotRequireRecent, ReuseSnapshot and VerifySnapshot.
+	Snapshots SnapshotsClient
+	// Phase splits the cleanup into a snapshot and a delete pass. Defaults
+	// to PhaseAll. PhaseSnapshot snapshots whether or not DoSnapshot is set,
+	// and does not support SnapshotRequireRecent.
+	Phase Phase
+	// Resume starts listing at the page that failed in an earlier run, see
+	// PageError or Checkpointer. May be nil.
+	Resume *Cursor
+	// Checkpoint is given a cursor every CheckpointEvery disks, before
+	// returning because ctx was cancelled, and when listing a page fails.
+	// May be nil.
+	Checkpoint      Checkpointer
+	CheckpointEvery int
+	// Pacer, if set, is waited on before each disk is snapshotted and
+	// deleted, except in dry run mode.
+	Pacer Pacer
+	// Budget, if set, limits the disks deleted, also in dry run mode. It is
+	// shared by every project of a run.
+	Budget *DeletionBudget
+	// MaxMarkedFraction, if positive, fails the cleanup of the project before
+	// any disk is deleted if more than this fraction of the disks listed
+	// with Filter in a zone are marked.
+	MaxMarkedFraction float64
+	// Filter lists the disks MaxMarkedFraction is a fraction of, e.g.
+	// FilterGKEVolumes.
+	Filter string
+	// Throttle, if set, is waited on before each disk is processed, even in
+	// dry run mode, e.g. to pause a run or limit its rate.
+	Throttle Pacer
+	// Concurrency is how many disks are processed at a time. Defaults to 1.
+	Concurrency int
+	// MaxRetries is how often a call that changes a disk is retried after
+	// a transient error, such as being rate limited.
+	MaxRetries int
+	// Fallback, if set, downgrades the rest of the run to a dry run once too
+	// many disks failed.
+	Fallback *Fallback
+	DryRun   bool
+}
+
+// Cleaner deletes disks that were previously marked by a Marker.
+type Cleaner struct {
+	client DisksClient
+	bus    *events.Bus
+	sleep  func(context.Context, time.Duration) error
+	// wait waits for the operations snapshotting and deleting disks to
+	// complete.
+	wait func(context.Context, *computev1.Operation) error
+}
+
+// NewCleaner returns a Cleaner that publishes its events on bus. bus may be nil.
+func NewCleaner(client DisksClient, bus *events.Bus) *Cleaner {
+	return &Cleaner{client: client, bus: bus, sleep: gax.Sleep, wait: WaitOperation}
+}
+
+// CleanupDisks snapshots and deletes every disk marked for deletion. Per-disk
+// failures are published as events and counted in the returned Stats; an
+// error is only returned if listing disks fails.
+func (c *Cleaner) CleanupDisks(ctx context.Context, opts CleanupOptions) (Stats, error) {
+	var stats Stats
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no delete operations will be performed")
+	}
+	if opts.DoSnapshot && opts.SnapshotPolicy == SnapshotRequireRecent && opts.Snapshots == nil {
+		return stats, xerrors.Errorf("snapshot policy %s requires a snapshots client", opts.SnapshotPolicy)
+	}
+	if opts.Mode == ModeArchive && (!opts.DoSnapshot || opts.SnapshotPolicy == SnapshotRequireRecent || (opts.Phase != "" && opts.Phase != PhaseAll)) {
+		return stats, xerrors.Errorf("cleanup mode %s requires snapshots, the snapshot policy %s and a single phase", opts.Mode, SnapshotAlways)
+	}
+	if opts.Mode == ModeArchive && opts.SnapshotType == SnapshotStandard {
+		return stats, xerrors.Errorf("cleanup mode %s takes %s snapshots", opts.Mode, SnapshotArchive)
+	}
+	if opts.Phase == PhaseSnapshot && opts.SnapshotPolicy == SnapshotRequireRecent {
+		return stats, xerrors.Errorf("snapshot policy %s does not apply to the %s phase", opts.SnapshotPolicy, opts.Phase)
+	}
+	if (opts.DoSnapshot || opts.Phase == PhaseSnapshot) && opts.ReuseSnapshot > 0 && opts.Snapshots == nil {
+		return stats, xerrors.New("reusing snapshots requires a snapshots client")
+	}
+	if opts.VerifySnapshot && opts.Snapshots == nil {
+		return stats, xerrors.New("verifying snapshots requires a snapshots client")
+	}
+	if opts.MaxMarkedFraction > 0 {
+		if err := c.checkMarkedFraction(ctx, opts); err != nil {
+			return stats, err
+		}
+	}
+	diskIter, err := listDisks(ctx, c.client, opts.ProjectID, opts.Zones, opts.Tenant.filter(markedFilter), opts.Resume, opts.AllFields, opts.PageSize)
+	if err != nil {
+		return stats, err
+	}
+	return c.cleanupAll(ctx, selectDisks(diskIter, opts.Selector), opts)
+}
+
+// cleanupAll processes every disk returned by diskIter.
+func (c *Cleaner) cleanupAll(ctx context.Context, diskIter diskIterator, opts CleanupOptions) (Stats, error) {
+	cp := newCheckpoints(opts.Checkpoint, opts.ProjectID, opts.CheckpointEvery, opts.Resume)
+	return processDisks(ctx, diskIter, opts.Concurrency, opts.Throttle, cp, func(disk *computepb.Disk) error {
+		return c.processDisk(ctx, disk, opts)
+	})
+}
+
+func (c *Cleaner) cleanupOne(ctx context.Context, di diskIterator, opts CleanupOptions) error {
+	disk, err := di.Next()
+	if err == iterator.Done {
+		return err
+	}
+
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeIterator, err, "iterating disks")
+	}
+	return c.processDisk(ctx, disk, opts)
+}
+
+// processDisk processes disk and publishes the outcome.
+func (c *Cleaner) processDisk(ctx context.Context, disk *computepb.Disk, opts CleanupOptions) error {
+	if opts.Fallback.DryRun() {
+		opts.DryRun = true
+	}
+	zone := diskZone(disk, opts.Zones)
+	err := c.cleanupDisk(ctx, disk, zone, opts)
+	switch {
+	case errors.Is(err, diskerr.ErrDryRun):
+		diskLogger(opts.ProjectID, zone, disk).Debug().Msg("not deleting disk as dry run enabled")
+	case errors.Is(err, diskerr.ErrAttached):
+		diskLogger(opts.ProjectID, zone, disk).Info().Err(err).Msg("not deleting disk attached to an instance")
+	case IsFailure(err):
+		c.bus.Publish(events.Event{Type: events.Error, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, DryRun: opts.DryRun, Err: err})
+	}
+	action := opts.Phase.action()
+	switch diskerr.CodeOf(err) {
+	case diskerr.CodeRegional, diskerr.CodeNotMarked, diskerr.CodeBeingDeleted, diskerr.CodeDeferred, diskerr.CodeExempt, diskerr.CodeWithinGracePeriod, diskerr.CodeTenantMismatch, diskerr.CodeAttached, diskerr.CodeSnapshotComplete, diskerr.CodeBootDisk, diskerr.CodeManaged, diskerr.CodeNotPlanned, diskerr.CodeBudgetExhausted:
+		action = ActionSkip
+	}
+	if !opts.DryRun {
+		opts.Fallback.observe(action, err)
+	}
+	c.bus.Publish(events.Event{Type: events.DiskProcessed, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Action: string(action), DryRun: opts.DryRun, Err: err})
+	return err
+}
+
+func (c *Cleaner) cleanupDisk(ctx context.Context, disk *computepb.Disk, zone string, opts CleanupOptions) error {
+	projectID, dryRun := opts.ProjectID, opts.DryRun
+	diskLabels := disk.GetLabels()
+	logger := diskLogger(projectID, zone, disk)
+	r := retrier{maxRetries: opts.MaxRetries, backoff: callBackoff, sleep: c.sleep}
+	err := checkRegional(disk)
+	if err == nil {
+		err = checkMarkedForDeletion(disk, opts.GracePeriod)
+	}
+	if err == nil {
+		err = opts.Plan.check(projectID, zone, disk)
+	}
+	if err == nil {
+		err = opts.Tenant.check("disk "+disk.GetName(), diskLabels)
+	}
+	if err == nil {
+		err = checkExempt(disk, opts.ExemptLabel)
+	}
+	if err == nil {
+		err = checkBootDisk(disk, opts.IncludeBootDisks)
+	}
+	if err == nil {
+		if err = checkManaged(disk, opts.IncludeManaged); err != nil {
+			logger.Info().Err(err).Msg("not deleting disk managed by infrastructure as code")
+		}
+	}
+	if err == nil {
+		err = checkAttached(disk)
+	}
+	if err == nil {
+		err = checkPhase(disk, opts.Phase)
+	}
+	scanned := events.Event{Type: events.DiskScanned, ProjectID: projectID, Zone: zone, Disk: disk, Action: string(opts.Phase.action()), DryRun: dryRun, Err: err}
+	if err != nil {
+		scanned.Action = string(ActionSkip)
+	}
+	c.bus.Publish(scanned)
+	if err != nil {
+		return err
+	}
+	if disk.GetStatus() == computepb.Disk_DELETING.String() {
+		// deleted by an earlier run that was killed before the deletion
+		// completed
+		return diskerr.ErrBeingDeleted
+	}
+	if opts.Phase != PhaseSnapshot {
+		if err := opts.Budget.reserve(disk); err != nil {
+			return err
+		}
+	}
+	if opts.Pacer != nil && !dryRun {
+		if err := opts.Pacer.Wait(ctx); err != nil {
+			return diskerr.Wrap(diskerr.CodeDeferred, err, "disk %s: deletion deferred while waiting for its turn", disk.GetName())
+		}
+	}
+
+	if opts.Phase == PhaseSnapshot {
+		return c.snapshotPhase(ctx, disk, zone, r, opts)
+	}
+	var snapshot *computepb.Snapshot
+	if opts.Phase == PhaseDelete {
+		// checkPhase made sure the snapshot phase completed a snapshot
+		snapshot = completedSnapshot(disk)
+	} else if opts.DoSnapshot {
+		switch {
+		case opts.SnapshotPolicy == SnapshotRequireRecent:
+			snapshot, err = c.requireRecentSnapshot(ctx, disk, zone, listSnapshotsOf(ctx, opts.Snapshots, projectID, disk), r, opts)
+		case opts.ReuseSnapshot > 0:
+			snapshot, err = c.reuseSnapshot(ctx, disk, zone, listOwnSnapshotsOf(ctx, opts.Snapshots, projectID, disk), r, opts)
+		default:
+			snapshot, err = c.snapshotDisk(ctx, disk, zone, r, opts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case snapshot != nil && opts.VerifySnapshot:
+		if snapshot, err = c.verifySnapshot(ctx, disk, zone, snapshot.GetName(), r, opts); err != nil {
+			return err
+		}
+	case snapshot != nil && snapshot.GetId() == 0 && opts.Snapshots != nil:
+		// only the name of a snapshot just taken is known, which does not
+		// tell e.g. a deletion certificate enough
+		snapshot = c.describeSnapshot(ctx, disk, zone, snapshot, r, opts)
+	}
+
+	if dryRun {
+		logger.Warn().Int64("sizeGB", disk.GetSizeGb()).Str("lastAttachTime", disk.GetLastAttachTimestamp()).Str("labels", fmt.Sprintf("%+v", diskLabels)).Bool("export", opts.Exporter != nil).Msg("dry run -- would delete disk")
+		return diskerr.ErrDryRun
+	}
+	if err := c.exportDisk(ctx, disk, zone, opts); err != nil {
+		return err
+	}
+
+	logger.Warn().Int64("sizeGB", disk.GetSizeGb()).Str("lastAttachTime", disk.GetLastAttachTimestamp()).Str("labels", fmt.Sprintf("%+v", diskLabels)).Msg("deleting disk")
+	req := &computepb.DeleteDiskRequest{
+		Disk:      disk.GetName(),
+		Project:   projectID,
+		RequestId: pointer.String(requestID(disk, "delete")),
+		Zone:      zone,
+	}
+	if err := checkZone(disk, req.GetZone(), opts.Zones); err != nil {
+		return err
+	}
+	var op *computev1.Operation
+	err = r.do(ctx, logger, "delete", func() (err error) {
+		op, err = c.client.Delete(ctx, req)
+		return err
+	})
+	if isInUse(err) {
+		return c.unmarkInUse(ctx, disk, zone, err, opts)
+	}
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeAPI, err, "failed to delete disk %s", disk.GetName())
+	}
+	// a deletion that failed, e.g. as the disk was attached meanwhile, is
+	// not reported as done
+	if err := c.wait(ctx, op); err != nil {
+		return diskerr.Wrap(diskerr.CodeAPI, err, "failed to wait for disk %s to be deleted", disk.GetName())
+	}
+	c.bus.Publish(events.Event{Type: events.DiskDeleted, ProjectID: projectID, Zone: zone, Disk: disk, Snapshot: snapshot, Operation: operationName(op)})
+
+	return nil
+}
+
+// snapshotDisk snapshots disk, or only logs that it would in dry run mode. A
+// snapshot of the disk left behind by an earlier run is reused. It returns
+// the snapshot, of which only the name is known if it was just taken.
+func (c *Cleaner) snapshotDisk(ctx context.Context, disk *computepb.Disk, zone string, r retrier, opts CleanupOptions) (*computepb.Snapshot, error) {
+	diskLabels := disk.GetLabels()
+	logger := diskLogger(opts.ProjectID, zone, disk)
+	if opts.DryRun {
+		logger.Info().Int64("sizeGB", disk.GetSizeGb()).Str("lastAttachTime", disk.GetLastAttachTimestamp()).Str("labels", fmt.Sprintf("%+v", diskLabels)).Msg("dry run - would snapshot disk prior to deletion")
+		return nil, nil
+	}
+	logger.Info().Int64("sizeGB", disk.GetSizeGb()).Str("lastAttachTime", disk.GetLastAttachTimestamp()).Str("labels", fmt.Sprintf("%+v", diskLabels)).Msg("snapshotting disk prior to deletion")
+	name, err := opts.SnapshotName.Name(disk, zone, opts.ProjectID, time.Now())
+	if err != nil {
+		return nil, diskerr.Wrap(diskerr.CodeUnknown, err, "disk %s: failed to name snapshot", disk.GetName())
+	}
+	// keep what is needed to restore the disk with the snapshot
+	snapshotLabels := make(map[string]string, len(diskLabels)+len(opts.SnapshotLabels)+2)
+	for k, v := range diskLabels {
+		snapshotLabels[k] = v
+	}
+	for k, v := range validLabels(opts.SnapshotLabels) {
+		snapshotLabels[k] = v
+	}
+	snapshotLabels[LabelCreatedBy] = CreatedBy
+	if disk.GetType() != "" {
+		snapshotLabels[LabelSourceDiskType] = ValidLabelValue(path.Base(disk.GetType()))
+	}
+	// the request ID covers the name, which changes with the date if the
+	// template uses it
+	req := &computepb.CreateSnapshotDiskRequest{
+		Disk:      disk.GetName(),
+		Project:   opts.ProjectID,
+		RequestId: pointer.String(requestID(disk, "createSnapshot/"+name)),
+		SnapshotResource: &computepb.Snapshot{
+			Name:             pointer.String(name),
+			Description:      pointer.String(disk.GetDescription()),
+			Labels:           snapshotLabels,
+			StorageLocations: []string{snapshotStorageLocation(disk, zone, opts.SnapshotStorageLocation)},
+		},
+		Zone: zone,
+	}
+	if t := opts.snapshotType(); t != "" {
+		req.SnapshotResource.SnapshotType = pointer.String(t)
+	}
+	if err := checkZone(disk, req.GetZone(), opts.Zones); err != nil {
+		return nil, err
+	}
+	var op *computev1.Operation
+	err = r.do(ctx, logger, "createSnapshot", func() (err error) {
+		op, err = c.client.CreateSnapshot(ctx, req)
+		return err
+	})
+	switch {
+	case isConflict(err):
+		// taken by an earlier run that was killed before the disk was
+		// deleted, or of another disk of the same name
+		snapshot, err := c.existingSnapshot(ctx, disk, zone, name, r, opts)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info().Msg("snapshot of disk already exists")
+		return snapshot, nil
+	case err != nil:
+		return nil, diskerr.Wrap(diskerr.CodeAPI, err, "disk %s: failed to create snapshot before deletion", disk.GetName())
+	default:
+		// wait for snapshot to complete
+		err = c.wait(ctx, op)
+		if err != nil {
+			return nil, diskerr.Wrap(diskerr.CodeAPI, err, "disk %s: failed to wait for snapshot to be ready", disk.GetName())
+		}
+		c.bus.Publish(events.Event{Type: events.SnapshotCreated, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Operation: operationName(op)})
+	}
+	return req.SnapshotResource, nil
+}
+
+// snapshotStorageLocation returns location, or else the region of disk in
+// zone. Regional disks carry their region, but zonal ones do not.
+func snapshotStorageLocation(disk *computepb.Disk, zone, location string) string {
+	switch {
+	case location != "":
+		return location
+	case disk.GetRegion() != "":
+		return path.Base(disk.GetRegion())
+	}
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+// unmarkInUse unmarks disk after deleting it failed with inUseErr, as it is
+// clearly in use, e.g. attached since it was listed, so that no stale mark is
+// left behind. The disk is skipped rather than failed, and retrying is
+// pointless.
+func (c *Cleaner) unmarkInUse(ctx context.Context, disk *computepb.Disk, zone string, inUseErr error, opts CleanupOptions) error {
+	labels, err := withLabel(disk, LabelMarkedForDeletion, "false", LabelBudgetSkip)
+	if err != nil {
+		return err
+	}
+	// a snapshot taken before the disk was used again is stale
+	delete(labels, LabelSnapshotComplete)
+	m := &Marker{client: c.client, bus: c.bus, sleep: c.sleep}
+	operation, err := m.setLabels(ctx, disk, zone, labels, MarkOptions{ProjectID: opts.ProjectID, Zones: opts.Zones, MaxRetries: opts.MaxRetries})
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeAPI, err, "disk %s is in use by another resource, and unmarking it failed", disk.GetName())
+	}
+	diskLogger(opts.ProjectID, zone, disk).Info().Err(inUseErr).Msg("unmarked disk in use by another resource")
+	c.bus.Publish(events.Event{Type: events.DiskUnmarked, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Operation: operation})
+	return diskerr.Wrap(diskerr.CodeAttached, inUseErr, "disk %s is in use by another resource, unmarked it", disk.GetName())
+}
+
+// isInUse reports whether err means that the disk is used by another
+// resource, e.g. attached to an instance, and cannot be deleted.
+func isInUse(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == diskerr.ReasonInUse {
+			return true
+		}
+	}
+	return false
+}
+
+// isConflict reports whether err means that the resource to create already
+// exists.
+func isConflict(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
+
+// markedFilter lists the disks that may carry the deletion mark. Whether the
+// value is a mark is checked by checkMarkedForDeletion.
+var markedFilter = fmt.Sprintf(`(labels.%[1]s:*) AND (labels.%[1]s != "false")`, LabelMarkedForDeletion)
+
+// checkMarkedForDeletion returns an error unless the disk carries the
+// deletion mark, set more than gracePeriod ago.
+func checkMarkedForDeletion(disk *computepb.Disk, gracePeriod time.Duration) error {
+	labelValue, found := disk.GetLabels()[LabelMarkedForDeletion]
+	if !found {
+		return diskerr.New(diskerr.CodeNotMarked, "skipping disk %s: missing required label", disk.GetName())
+	}
+	markedAt, marked := parseMark(labelValue)
+	if !marked {
+		return diskerr.New(diskerr.CodeNotMarked, "skipping disk %s: expected label value to be a date but got %q", disk.GetName(), labelValue)
+	}
+	if gracePeriod <= 0 {
+		return nil
+	}
+	if markedAt.IsZero() {
+		return diskerr.New(diskerr.CodeWithinGracePeriod, "skipping disk %s: mark has no date, the next mark run dates it", disk.GetName())
+	}
+	if remaining := gracePeriod - time.Since(markedAt); remaining > 0 {
+		return diskerr.New(diskerr.CodeWithinGracePeriod, "skipping disk %s: marked on %s, within grace period of %s", disk.GetName(), labelValue, gracePeriod)
+	}
+	return nil
+}
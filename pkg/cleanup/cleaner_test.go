@@ -0,0 +1,810 @@
+package cleanup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_CleanupCmd(t *testing.T) {
+	t.Parallel()
+	type params struct {
+		ctx         context.Context
+		dc          DisksClient
+		di          diskIterator
+		bus         *events.Bus
+		projectID   string
+		zone        string
+		doSnapshot  bool
+		dryRun      bool
+		gracePeriod time.Duration
+		pacer       Pacer
+		fallback    *Fallback
+		exporter    Exporter
+		sc          SnapshotsClient
+		wait        func(context.Context, *computev1.Operation) error
+	}
+
+	setup := func(t *testing.T) *params {
+		return &params{
+			ctx:        context.Background(),
+			dc:         &disksClientMock{},
+			di:         &diskIteratorMock{},
+			bus:        events.NewBus(),
+			projectID:  "testing",
+			zone:       "testzone",
+			doSnapshot: true,
+			dryRun:     true,
+			wait:       doneOperation,
+		}
+	}
+
+	cleanupOne := func(p *params) error {
+		c := NewCleaner(p.dc, p.bus)
+		c.wait = p.wait
+		return c.cleanupOne(p.ctx, p.di, CleanupOptions{
+			ProjectID:   p.projectID,
+			Zones:       []string{p.zone},
+			ExemptLabel: DefaultExemptLabel,
+			GracePeriod: p.gracePeriod,
+			Pacer:       p.pacer,
+			Fallback:    p.fallback,
+			Exporter:    p.exporter,
+			DoSnapshot:  p.doSnapshot,
+			Snapshots:   p.sc,
+			DryRun:      p.dryRun,
+		})
+	}
+
+	t.Run("done", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return nil, iterator.Done
+			},
+		}
+
+		err := cleanupOne(p)
+		require.EqualError(t, err, iterator.Done.Error())
+	})
+
+	t.Run("iteration error", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return nil, xerrors.Errorf("test error")
+			},
+		}
+
+		err := cleanupOne(p)
+		require.EqualError(t, err, "iterating disks: test error")
+	})
+
+	t.Run("disk labels nil", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: nil,
+				}, nil
+			},
+		}
+		err := cleanupOne(p)
+		require.ErrorContains(t, err, "disk test-disk: missing required label")
+	})
+
+	t.Run("disk label missing", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{},
+				}, nil
+			},
+		}
+		err := cleanupOne(p)
+		require.ErrorContains(t, err, "disk test-disk: missing required label")
+		require.Equal(t, diskerr.CodeNotMarked, diskerr.CodeOf(err))
+	})
+
+	t.Run("disk label wrong value", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "false"},
+				}, nil
+			},
+		}
+		err := cleanupOne(p)
+		require.ErrorContains(t, err, "disk test-disk: expected label value to be a date but got \"false\"")
+	})
+
+	t.Run("within grace period", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.gracePeriod = 7 * 24 * time.Hour
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: markValue(time.Now().AddDate(0, 0, -3))},
+				}, nil
+			},
+		}
+		var actions []string
+		p.bus.Subscribe(func(e events.Event) {
+			actions = append(actions, e.Action)
+		}, events.DiskProcessed)
+		err := cleanupOne(p)
+		require.ErrorIs(t, err, diskerr.ErrWithinGracePeriod)
+		require.False(t, IsFailure(err))
+		require.Equal(t, []string{string(ActionSkip)}, actions)
+	})
+
+	t.Run("create snapshot error", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+					Type:   pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/testzone/diskTypes/pd-balanced"),
+				}, nil
+			},
+		}
+
+		p.dc = &disksClientMock{
+			CreateSnapshotFunc: func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, createSnapshotDiskRequest.GetSnapshotResource().GetName(), "test-disk")
+				require.Contains(t, createSnapshotDiskRequest.GetSnapshotResource().GetStorageLocations(), "testzone")
+				require.Equal(t, map[string]string{
+					LabelMarkedForDeletion: "true",
+					LabelCreatedBy:         CreatedBy,
+					LabelSourceDiskType:    "pd-balanced",
+				}, createSnapshotDiskRequest.GetSnapshotResource().GetLabels())
+				require.Equal(t, createSnapshotDiskRequest.Disk, "test-disk")
+				require.Equal(t, createSnapshotDiskRequest.Project, p.projectID)
+				require.Equal(t, createSnapshotDiskRequest.Zone, p.zone)
+				return nil, xerrors.Errorf("google says no")
+			},
+		}
+
+		err := cleanupOne(p)
+		require.ErrorContains(t, err, "disk test-disk: failed to create snapshot before deletion: google says no")
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+		err := cleanupOne(p)
+		require.EqualError(t, err, diskerr.ErrDryRun.Error())
+	})
+
+	t.Run("delete error", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.doSnapshot = false // to side-step op.Wait(ctx) panic in unit test
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+
+		p.dc = &disksClientMock{
+			CreateSnapshotFunc: func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, createSnapshotDiskRequest.SnapshotResource.Name, "test-disk")
+				require.Equal(t, createSnapshotDiskRequest.Disk, "test-disk")
+				require.Equal(t, createSnapshotDiskRequest.Project, p.projectID)
+				require.Equal(t, createSnapshotDiskRequest.Zone, p.zone)
+				return nil, nil
+			},
+			DeleteFunc: func(contextMoqParam context.Context, deleteDiskRequest *computepb.DeleteDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, deleteDiskRequest.Disk, "test-disk")
+				require.Equal(t, deleteDiskRequest.Project, p.projectID)
+				require.NotEmpty(t, deleteDiskRequest.RequestId)
+				require.Equal(t, deleteDiskRequest.Zone, p.zone)
+
+				return nil, xerrors.Errorf("google says no")
+			},
+		}
+
+		seen := recordEvents(p.bus)
+		err := cleanupOne(p)
+		require.ErrorContains(t, err, "failed to delete disk test-disk: google says no")
+		require.Equal(t, []events.Type{events.DiskScanned, events.Error, events.DiskProcessed}, *seen)
+		require.Equal(t, diskerr.CodeAPI, diskerr.CodeOf(err))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.doSnapshot = false // to side-step op.Wait(ctx) panic in unit test
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+
+		p.dc = &disksClientMock{
+			DeleteFunc: func(contextMoqParam context.Context, deleteDiskRequest *computepb.DeleteDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, deleteDiskRequest.Disk, "test-disk")
+				require.Equal(t, deleteDiskRequest.Project, p.projectID)
+				require.NotEmpty(t, deleteDiskRequest.RequestId)
+				require.Equal(t, deleteDiskRequest.Zone, p.zone)
+
+				return nil, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := cleanupOne(p)
+		require.NoError(t, err)
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskDeleted, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("exported", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.doSnapshot = false // to side-step op.Wait(ctx) panic in unit test
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+		dc := &disksClientMock{
+			DeleteFunc: func(contextMoqParam context.Context, deleteDiskRequest *computepb.DeleteDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		p.dc = dc
+		p.exporter = &exporterMock{
+			ExportFunc: func(ctx context.Context, projectID, zone string, disk *computepb.Disk) (*events.Export, error) {
+				require.Equal(t, p.projectID, projectID)
+				require.Equal(t, p.zone, zone)
+				require.Empty(t, dc.DeleteCalls(), "exported before deletion")
+				return &events.Export{URI: "gs://bucket/test-disk.tar.gz", MD5: "md5"}, nil
+			},
+		}
+		var export *events.Export
+		p.bus.Subscribe(func(e events.Event) { export = e.Export }, events.DiskExported)
+		seen := recordEvents(p.bus)
+		err := cleanupOne(p)
+		require.NoError(t, err)
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskExported, events.DiskDeleted, events.DiskProcessed}, *seen)
+		require.Equal(t, "gs://bucket/test-disk.tar.gz", export.URI)
+	})
+
+	t.Run("export error", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.doSnapshot = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+		dc := &disksClientMock{}
+		p.dc = dc
+		p.exporter = &exporterMock{
+			ExportFunc: func(ctx context.Context, projectID, zone string, disk *computepb.Disk) (*events.Export, error) {
+				return nil, xerrors.Errorf("build failed")
+			},
+		}
+		err := cleanupOne(p)
+		require.EqualError(t, err, "disk test-disk: failed to export before deletion: build failed")
+		require.Equal(t, diskerr.CodeAPI, diskerr.CodeOf(err))
+		require.Empty(t, dc.DeleteCalls())
+	})
+
+	t.Run("paced", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.doSnapshot = false
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+		var waits int
+		p.pacer = pacerFunc(func(context.Context) error {
+			waits++
+			return nil
+		})
+		p.dc = &disksClientMock{
+			DeleteFunc: func(contextMoqParam context.Context, deleteDiskRequest *computepb.DeleteDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, 1, waits)
+				return nil, nil
+			},
+		}
+
+		// dry runs are not paced
+		require.ErrorIs(t, cleanupOne(p), diskerr.ErrDryRun)
+		require.Zero(t, waits)
+
+		p.dryRun = false
+		require.NoError(t, cleanupOne(p))
+		require.Equal(t, 1, waits)
+
+		// shutting down while waiting defers the deletion
+		p.pacer = pacerFunc(func(context.Context) error {
+			return context.Canceled
+		})
+		err := cleanupOne(p)
+		require.ErrorIs(t, err, diskerr.ErrDeferred)
+		require.False(t, IsFailure(err))
+		require.Len(t, p.dc.(*disksClientMock).DeleteCalls(), 1)
+	})
+
+	t.Run("attached", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+					Users:  []string{"https://www.googleapis.com/compute/v1/projects/testing/zones/testzone/instances/vm-1"},
+				}, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := cleanupOne(p)
+		require.EqualError(t, err, "disk test-disk is attached to vm-1")
+		require.False(t, IsFailure(err))
+		require.Empty(t, p.dc.(*disksClientMock).CreateSnapshotCalls())
+		require.Empty(t, p.dc.(*disksClientMock).DeleteCalls())
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("managed", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true", "goog-terraform-provisioned": "true"},
+				}, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := cleanupOne(p)
+		require.ErrorIs(t, err, diskerr.ErrManaged)
+		require.Empty(t, p.dc.(*disksClientMock).CreateSnapshotCalls())
+		require.Empty(t, p.dc.(*disksClientMock).DeleteCalls())
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("in use by another resource", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.doSnapshot = false
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:             pointer.String("test-disk"),
+					Labels:           map[string]string{LabelMarkedForDeletion: "2022-03-01", LabelSnapshotComplete: "test-disk"},
+					LabelFingerprint: pointer.String("fp"),
+				}, nil
+			},
+		}
+		dc := &disksClientMock{
+			DeleteFunc: func(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				// attached since it was listed
+				return nil, &googleapi.Error{Code: http.StatusBadRequest, Errors: []googleapi.ErrorItem{{Reason: diskerr.ReasonInUse}}}
+			},
+			SetLabelsFunc: func(context.Context, *computepb.SetLabelsDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		p.dc = dc
+		seen := recordEvents(p.bus)
+		err := cleanupOne(p)
+		require.EqualError(t, err, "disk test-disk is in use by another resource, unmarked it: googleapi: Error 400: , resourceInUseByAnotherResource")
+		require.False(t, IsFailure(err))
+		require.Equal(t, diskerr.Class{Category: diskerr.CategoryInUse, Reason: diskerr.ReasonInUse}, diskerr.Classify(err))
+		require.Len(t, dc.DeleteCalls(), 1, "in use is not retried")
+		require.Len(t, dc.SetLabelsCalls(), 1)
+		require.Equal(t, map[string]string{LabelMarkedForDeletion: "false"}, dc.SetLabelsCalls()[0].SetLabelsDiskRequest.GetZoneSetLabelsRequestResource().GetLabels())
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskUnmarked, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("fallback to dry run", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.doSnapshot = false
+		p.dryRun = false
+		p.fallback = NewFallback(0.5, 2)
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			DeleteFunc: func(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, xerrors.New("permission denied")
+			},
+		}
+
+		require.True(t, IsFailure(cleanupOne(p)))
+		require.False(t, p.fallback.DryRun())
+		require.True(t, IsFailure(cleanupOne(p)))
+		require.True(t, p.fallback.DryRun())
+
+		// the rest of the run only collects what would be done
+		require.ErrorIs(t, cleanupOne(p), diskerr.ErrDryRun)
+		require.Len(t, p.dc.(*disksClientMock).DeleteCalls(), 2)
+	})
+
+	t.Run("deletion failed", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.doSnapshot = false
+		p.wait = func(context.Context, *computev1.Operation) error {
+			return xerrors.New("operation operation-1 failed: RESOURCE_IN_USE_BY_ANOTHER_RESOURCE: in use")
+		}
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			DeleteFunc: func(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := cleanupOne(p)
+		require.EqualError(t, err, "failed to wait for disk test-disk to be deleted: operation operation-1 failed: RESOURCE_IN_USE_BY_ANOTHER_RESOURCE: in use")
+		require.Equal(t, diskerr.CodeAPI, diskerr.CodeOf(err))
+		require.Equal(t, []events.Type{events.DiskScanned, events.Error, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("snapshot taken", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		id := uint64(1234)
+		disk := &computepb.Disk{
+			Name:   pointer.String("test-disk"),
+			Id:     &id,
+			SizeGb: pointer.Int64(100),
+			Labels: map[string]string{LabelMarkedForDeletion: "true"},
+		}
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return disk, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			CreateSnapshotFunc: func(context.Context, *computepb.CreateSnapshotDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+			DeleteFunc: func(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		sc := existingSnapshots(disk, computepb.Snapshot_STANDARD)
+		p.sc = sc
+		var snapshot *computepb.Snapshot
+		p.bus.Subscribe(func(e events.Event) { snapshot = e.Snapshot }, events.DiskDeleted)
+		require.NoError(t, cleanupOne(p))
+		// the deleted disk carries the snapshot as got after taking it
+		require.Len(t, sc.GetCalls(), 1)
+		require.Equal(t, "test-disk", snapshot.GetName())
+		require.Equal(t, "1234", snapshot.GetSourceDiskId())
+		require.Equal(t, computepb.Snapshot_READY.String(), snapshot.GetStatus())
+	})
+
+	t.Run("snapshot in project with credentials of its own", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.projectID = "service"
+
+		id := uint64(1234)
+		disk := &computepb.Disk{
+			Name:   pointer.String("test-disk"),
+			Id:     &id,
+			SizeGb: pointer.Int64(100),
+			Labels: map[string]string{LabelMarkedForDeletion: "true"},
+		}
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return disk, nil
+			},
+		}
+		host := &disksClientMock{}
+		impersonated := &disksClientMock{
+			CreateSnapshotFunc: func(context.Context, *computepb.CreateSnapshotDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+			DeleteFunc: func(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		p.dc = ProjectDisks(host, map[string]DisksClient{"service": impersonated})
+		hostSnapshots := &snapshotsClientMock{}
+		impersonatedSnapshots := existingSnapshots(disk, computepb.Snapshot_STANDARD)
+		p.sc = ProjectSnapshots(hostSnapshots, map[string]SnapshotsClient{"service": impersonatedSnapshots})
+		require.NoError(t, cleanupOne(p))
+		// the snapshot is verified as the service account of the project
+		require.Len(t, impersonatedSnapshots.GetCalls(), 1)
+		require.Equal(t, "service", impersonatedSnapshots.GetCalls()[0].GetSnapshotRequest.GetProject())
+		require.Empty(t, hostSnapshots.GetCalls())
+		require.Len(t, impersonated.DeleteCalls(), 1)
+		require.Empty(t, host.DeleteCalls())
+	})
+
+	t.Run("snapshot from earlier run", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+
+		p.sc = existingSnapshots(&computepb.Disk{}, computepb.Snapshot_STANDARD)
+		var requestIDs []string
+		p.dc = &disksClientMock{
+			CreateSnapshotFunc: func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				requestIDs = append(requestIDs, createSnapshotDiskRequest.GetRequestId())
+				return nil, &googleapi.Error{Code: http.StatusConflict, Message: "already exists"}
+			},
+			DeleteFunc: func(contextMoqParam context.Context, deleteDiskRequest *computepb.DeleteDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				requestIDs = append(requestIDs, deleteDiskRequest.GetRequestId())
+				return nil, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		var snapshot *computepb.Snapshot
+		p.bus.Subscribe(func(e events.Event) { snapshot = e.Snapshot }, events.DiskDeleted)
+		require.NoError(t, cleanupOne(p))
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskDeleted, events.DiskProcessed}, *seen)
+		require.Equal(t, "test-disk", snapshot.GetName())
+
+		// a restarted run sends the same requests
+		require.NoError(t, cleanupOne(p))
+		require.Len(t, requestIDs, 4)
+		require.Equal(t, requestIDs[:2], requestIDs[2:])
+		require.NotEqual(t, requestIDs[0], requestIDs[1])
+	})
+
+	t.Run("exempt", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true", DefaultExemptLabel: "true"},
+				}, nil
+			},
+		}
+
+		var processed events.Event
+		p.bus.Subscribe(func(e events.Event) { processed = e }, events.DiskProcessed)
+		seen := recordEvents(p.bus)
+		err := cleanupOne(p)
+		require.ErrorIs(t, err, diskerr.ErrExempt)
+		require.EqualError(t, err, "disk test-disk is exempt from cleanup by label gke-disk-cleanup-exempt")
+		require.False(t, IsFailure(err))
+		require.Equal(t, string(ActionSkip), processed.Action)
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("being deleted", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:   pointer.String("test-disk"),
+					Labels: map[string]string{LabelMarkedForDeletion: "true"},
+					Status: pointer.String(computepb.Disk_DELETING.String()),
+				}, nil
+			},
+		}
+
+		seen := recordEvents(p.bus)
+		err := cleanupOne(p)
+		require.ErrorIs(t, err, diskerr.ErrBeingDeleted)
+		require.False(t, IsFailure(err))
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+}
+
+func Test_CheckMarkedForDeletion(t *testing.T) {
+	t.Parallel()
+
+	week := 7 * 24 * time.Hour
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		gracePeriod time.Duration
+		err         string
+	}{
+		{name: "marked long ago", labels: map[string]string{LabelMarkedForDeletion: "2022-03-01"}, gracePeriod: week},
+		{name: "marked recently", labels: map[string]string{LabelMarkedForDeletion: markValue(time.Now().AddDate(0, 0, -3))}, gracePeriod: week,
+			err: "skipping disk test-disk: marked on " + markValue(time.Now().AddDate(0, 0, -3)) + ", within grace period of 168h0m0s"},
+		// the mark counts from the end of its day
+		{name: "marked a grace period ago", labels: map[string]string{LabelMarkedForDeletion: markValue(time.Now().Add(-week))}, gracePeriod: week,
+			err: "skipping disk test-disk: marked on " + markValue(time.Now().Add(-week)) + ", within grace period of 168h0m0s"},
+		{name: "marked today without grace period", labels: map[string]string{LabelMarkedForDeletion: markValue(time.Now())}},
+		{name: "undated", labels: map[string]string{LabelMarkedForDeletion: "true"}, gracePeriod: week,
+			err: "skipping disk test-disk: mark has no date, the next mark run dates it"},
+		{name: "undated without grace period", labels: map[string]string{LabelMarkedForDeletion: "true"}},
+		{name: "unmarked", labels: map[string]string{LabelMarkedForDeletion: "false"},
+			err: `skipping disk test-disk: expected label value to be a date but got "false"`},
+		{name: "missing", err: "skipping disk test-disk: missing required label"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := checkMarkedForDeletion(&computepb.Disk{Name: pointer.String("test-disk"), Labels: tt.labels}, tt.gracePeriod)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+// pacerFunc is a Pacer calling itself.
+type pacerFunc func(context.Context) error
+
+func (f pacerFunc) Wait(ctx context.Context) error {
+	return f(ctx)
+}
+
+func Test_SnapshotStorageLocation(t *testing.T) {
+	t.Parallel()
+
+	zonal := &computepb.Disk{Name: pointer.String("zonal")}
+	regional := &computepb.Disk{Name: pointer.String("regional"), Region: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/regions/europe-west4")}
+
+	require.Equal(t, "us-east1", snapshotStorageLocation(zonal, "us-east1-b", ""))
+	require.Equal(t, "europe-west4", snapshotStorageLocation(regional, "", ""))
+	require.Equal(t, "us", snapshotStorageLocation(zonal, "us-east1-b", "us"))
+}
+
+func Test_CheckBootDisk(t *testing.T) {
+	t.Parallel()
+
+	data := &computepb.Disk{Name: pointer.String("data")}
+	image := &computepb.Disk{Name: pointer.String("image"), SourceImage: pointer.String("projects/cos-cloud/global/images/cos-101")}
+	restored := &computepb.Disk{Name: pointer.String("restored"), GuestOsFeatures: []*computepb.GuestOsFeature{{Type: pointer.String("UEFI_COMPATIBLE")}}}
+
+	require.NoError(t, checkBootDisk(data, false))
+	err := checkBootDisk(image, false)
+	require.EqualError(t, err, "disk image is a boot disk created from image cos-101")
+	require.ErrorIs(t, err, diskerr.ErrBootDisk)
+	require.False(t, IsFailure(err))
+	require.EqualError(t, checkBootDisk(restored, false), "disk restored is a boot disk with guest OS features")
+	require.NoError(t, checkBootDisk(image, true))
+}
+
+func Test_CheckManaged(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name   string
+		labels map[string]string
+		err    string
+	}{
+		{name: "unmanaged", labels: map[string]string{"env": "dev"}},
+		{name: "terraform", labels: map[string]string{"goog-terraform-provisioned": "true"}, err: "disk d is managed by Terraform according to label goog-terraform-provisioned=true"},
+		{name: "managed by", labels: map[string]string{"managed-by": "terraform"}, err: "disk d is managed by Terraform according to label managed-by=terraform"},
+		{name: "managed by other", labels: map[string]string{"managed-by": "helm"}},
+		{name: "config connector", labels: map[string]string{"managed-by-cnrm": "true"}, err: "disk d is managed by Config Connector according to label managed-by-cnrm=true"},
+		{name: "config connector lease", labels: map[string]string{"cnrm-lease-holder-id": "btpwc4xzrbsqxlrd1h0d"}, err: "disk d is managed by Config Connector according to label cnrm-lease-holder-id=btpwc4xzrbsqxlrd1h0d"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			disk := &computepb.Disk{Name: pointer.String("d"), Labels: tt.labels}
+			err := checkManaged(disk, false)
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.err)
+			require.ErrorIs(t, err, diskerr.ErrManaged)
+			require.False(t, IsFailure(err))
+			require.NoError(t, checkManaged(disk, true))
+		})
+	}
+}
+
+// doneOperation stands in for waiting on the operations of disksClientMock,
+// which returns none.
+func doneOperation(context.Context, *computev1.Operation) error {
+	return nil
+}
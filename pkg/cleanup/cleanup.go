@@ -0,0 +1,280 @@
+// Package cleanup implements the two-phase disk lifecycle: a Marker labels
+// disks that have not been attached for a while, and a Cleaner snapshots and
+// deletes the labelled disks. The gke-disk-cleanup binary is a thin wrapper
+// around this package; other Go programs can embed it directly.
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/google/uuid"
+	"github.com/googleapis/gax-go"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+const (
+	// FilterGKEVolumes matches the disks that GKE creates for persistent
+	// volumes.
+	FilterGKEVolumes = "labels.goog-gke-volume:*"
+	// LabelMarkedForDeletion is the label a Marker sets to the date it marks
+	// a disk, e.g. 2024-05-01, and a Cleaner requires before deleting a disk.
+	// Earlier versions set it to "true", which still marks the disk.
+	LabelMarkedForDeletion = "marked-for-deletion"
+	// LabelCreatedBy is set to CreatedBy on the snapshots a Cleaner creates.
+	LabelCreatedBy = "created-by"
+	// CreatedBy identifies resources created by this tool.
+	CreatedBy = "gke-disk-cleanup"
+	// LabelSourceDiskType holds the type of the deleted disk, e.g.
+	// pd-balanced, on the snapshots a Cleaner creates.
+	LabelSourceDiskType = "source-disk-type"
+	// DefaultExemptLabel is the label that, set to "true", exempts a disk
+	// from being marked and deleted.
+	DefaultExemptLabel = "gke-disk-cleanup-exempt"
+)
+
+// DisksClient is the subset of the compute disks API used by this package.
+// *computev1.DisksClient implements it.
+type DisksClient interface {
+	AggregatedList(context.Context, *computepb.AggregatedListDisksRequest, ...gax.CallOption) *computev1.DisksScopedListPairIterator
+	CreateSnapshot(context.Context, *computepb.CreateSnapshotDiskRequest, ...gax.CallOption) (*computev1.Operation, error)
+	Delete(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error)
+	Insert(context.Context, *computepb.InsertDiskRequest, ...gax.CallOption) (*computev1.Operation, error)
+	List(context.Context, *computepb.ListDisksRequest, ...gax.CallOption) *computev1.DiskIterator
+	SetLabels(context.Context, *computepb.SetLabelsDiskRequest, ...gax.CallOption) (*computev1.Operation, error)
+}
+
+type diskIterator interface {
+	Next() (*computepb.Disk, error)
+}
+
+//go:generate moq -fmt goimports -out mock_disks_client.go . DisksClient:disksClientMock
+//go:generate moq -fmt goimports -out mock_disk_iterator.go . diskIterator
+
+// Stats counts the disks handled by a single MarkDisks or CleanupDisks call.
+type Stats struct {
+	Scanned int
+	Failed  int
+}
+
+// IsFailure reports whether err, as published in events, is an actual
+// failure, as opposed to a deliberate decision not to act on a disk.
+func IsFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch diskerr.CodeOf(err) {
+	case diskerr.CodeAlreadyMarked, diskerr.CodeWithinCutoff, diskerr.CodeKeptByPolicy, diskerr.CodeUnmarked, diskerr.CodeDryRun, diskerr.CodeLabelBudgetExhausted,
+		diskerr.CodeInUse, diskerr.CodeWithinRetention, diskerr.CodeArchived, diskerr.CodeBeingDeleted, diskerr.CodeDeferred, diskerr.CodeExempt,
+		diskerr.CodeWithinGracePeriod, diskerr.CodeAttached, diskerr.CodeLowScore, diskerr.CodeSnapshotComplete,
+		diskerr.CodeBootDisk, diskerr.CodeManaged, diskerr.CodeRegional, diskerr.CodeClusterUnknown, diskerr.CodeNotPlanned,
+		diskerr.CodeBudgetExhausted:
+		return false
+	}
+	return true
+}
+
+// markDateLayout is the layout of the date in LabelMarkedForDeletion.
+const markDateLayout = "2006-01-02"
+
+// markValue returns the value of LabelMarkedForDeletion for a disk marked at
+// t.
+func markValue(t time.Time) string {
+	return t.UTC().Format(markDateLayout)
+}
+
+// parseMark parses value, the value of LabelMarkedForDeletion. marked reports
+// whether it marks the disk for deletion, either with the date of the mark,
+// with the time of the mark as written by LabelTime, or with "true". markedAt
+// is the end of the day of a date, so that a grace period is never cut short,
+// the time of a time, or zero for "true", which does not tell when the disk
+// was marked.
+func parseMark(value string) (markedAt time.Time, marked bool) {
+	if value == "true" {
+		return time.Time{}, true
+	}
+	if t, err := ParseLabelTime(value); err == nil {
+		return t, true
+	}
+	day, err := time.Parse(markDateLayout, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day.Add(24 * time.Hour), true
+}
+
+// MarkedAt reports whether disk is marked for deletion, and when, as the end
+// of the day of the mark. The time is zero for a mark set to "true", which
+// does not tell when the disk was marked.
+func MarkedAt(disk *computepb.Disk) (markedAt time.Time, marked bool) {
+	return parseMark(disk.GetLabels()[LabelMarkedForDeletion])
+}
+
+// checkExempt returns diskerr.ErrExempt if disk carries the label exemptLabel
+// set to "true". An empty exemptLabel exempts no disk.
+func checkExempt(disk *computepb.Disk, exemptLabel string) error {
+	if exemptLabel != "" && disk.GetLabels()[exemptLabel] == "true" {
+		return diskerr.New(diskerr.CodeExempt, "disk %s is exempt from cleanup by label %s", disk.GetName(), exemptLabel)
+	}
+	return nil
+}
+
+// checkRegional returns diskerr.ErrRegional if disk is a regional disk,
+// which an aggregated list returns along with zonal disks. Requests for it
+// would go to a region rather than a zone, so it is left alone.
+func checkRegional(disk *computepb.Disk) error {
+	if zoneOf(disk) == "" && (disk.GetRegion() != "" || len(disk.GetReplicaZones()) > 0) {
+		return diskerr.New(diskerr.CodeRegional, "disk %s is a regional disk in %s, which is not supported", disk.GetName(), path.Base(disk.GetRegion()))
+	}
+	return nil
+}
+
+// checkBootDisk returns diskerr.ErrBootDisk if disk looks like the boot disk
+// of an instance, i.e. was created from an image or has guest OS features,
+// unless includeBoot is set. Data disks rarely have either.
+func checkBootDisk(disk *computepb.Disk, includeBoot bool) error {
+	if includeBoot {
+		return nil
+	}
+	switch {
+	case disk.GetSourceImage() != "":
+		return diskerr.New(diskerr.CodeBootDisk, "disk %s is a boot disk created from image %s", disk.GetName(), path.Base(disk.GetSourceImage()))
+	case len(disk.GetGuestOsFeatures()) > 0:
+		return diskerr.New(diskerr.CodeBootDisk, "disk %s is a boot disk with guest OS features", disk.GetName())
+	}
+	return nil
+}
+
+// managedLabel is a label that tools managing disks as code put on them.
+type managedLabel struct {
+	key string
+	// value is the value the tool sets, empty for any.
+	value string
+	tool  string
+}
+
+// managedLabels are the labels telling that a disk is managed by
+// infrastructure as code.
+var managedLabels = []managedLabel{
+	{key: "goog-terraform-provisioned", value: "true", tool: "Terraform"},
+	{key: "managed-by", value: "terraform", tool: "Terraform"},
+	{key: "managed-by-cnrm", value: "true", tool: "Config Connector"},
+	{key: "cnrm-lease-holder-id", tool: "Config Connector"},
+	{key: "cnrm-lease-expiration", tool: "Config Connector"},
+}
+
+// checkManaged returns a diskerr.CodeManaged error naming the tool and label
+// if disk is managed by infrastructure as code, e.g. Terraform or Config
+// Connector, which would recreate it or fail on the next apply if it were
+// deleted out-of-band, unless includeManaged is set.
+func checkManaged(disk *computepb.Disk, includeManaged bool) error {
+	if includeManaged {
+		return nil
+	}
+	labels := disk.GetLabels()
+	for _, l := range managedLabels {
+		if value, ok := labels[l.key]; ok && (l.value == "" || value == l.value) {
+			return diskerr.New(diskerr.CodeManaged, "disk %s is managed by %s according to label %s=%s", disk.GetName(), l.tool, l.key, value)
+		}
+	}
+	return nil
+}
+
+// checkAttached returns a diskerr.CodeAttached error naming the instances
+// disk is attached to, if any. The last attach timestamp does not tell
+// whether a disk is still attached.
+func checkAttached(disk *computepb.Disk) error {
+	users := disk.GetUsers()
+	if len(users) == 0 {
+		return nil
+	}
+	instances := make([]string, len(users))
+	for i, user := range users {
+		// e.g. https://www.googleapis.com/compute/v1/projects/p/zones/z/instances/i
+		instances[i] = path.Base(user)
+	}
+	return diskerr.New(diskerr.CodeAttached, "disk %s is attached to %s", disk.GetName(), strings.Join(instances, ", "))
+}
+
+// diskLogger returns a logger that includes the location of disk in every
+// line, so that records from multi-zone and multi-project runs can be told
+// apart without knowing the run's arguments. The GKE cluster and the
+// PersistentVolumeClaim of the disk are included if known, so that humans
+// recognize the disk.
+func diskLogger(projectID, zone string, disk *computepb.Disk) *zerolog.Logger {
+	ctx := log.With().
+		Str("projectID", projectID).
+		Str("zone", zone).
+		Str("diskName", disk.GetName()).
+		Str("selfLink", disk.GetSelfLink())
+	if cluster := Cluster(disk); cluster != "" {
+		ctx = ctx.Str("cluster", cluster)
+	}
+	claim := ClaimOf(disk)
+	if claim.Namespace != "" {
+		ctx = ctx.Str("namespace", claim.Namespace)
+	}
+	if claim.Name != "" {
+		ctx = ctx.Str("pvc", claim.Name)
+	}
+	if claim.Volume != "" {
+		ctx = ctx.Str("pv", claim.Volume)
+	}
+	logger := ctx.Logger()
+	return &logger
+}
+
+// requestNamespace namespaces the IDs returned by requestID.
+var requestNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/coder/gke-disk-cleanup"))
+
+// requestID returns the request ID for applying op to disk. It only depends on
+// the disk and op, so the API deduplicates a request that is retried or sent
+// again by a run restarted after being killed, instead of applying it twice.
+// Ops that may be applied again once the disk changed include what changes,
+// e.g. the label fingerprint.
+func requestID(disk *computepb.Disk, op string) string {
+	return resourceRequestID(disk.GetId(), disk.GetCreationTimestamp(), op)
+}
+
+// resourceRequestID returns the request ID for applying op to the resource
+// with id created at created, like requestID for disks. The creation time
+// tells apart resources that reuse an ID.
+func resourceRequestID(id uint64, created, op string) string {
+	key := fmt.Sprintf("%d/%s/%s", id, created, op)
+	return uuid.NewSHA1(requestNamespace, []byte(key)).String()
+}
+
+// operationName returns the name of op, empty if there is none.
+func operationName(op *computev1.Operation) string {
+	if op == nil {
+		return ""
+	}
+	return op.Name()
+}
+
+// WaitOperation waits for op to complete and returns the errors it completed
+// with, which Wait leaves to the caller: an operation that failed is done all
+// the same.
+func WaitOperation(ctx context.Context, op *computev1.Operation) error {
+	if err := op.Wait(ctx); err != nil {
+		return err
+	}
+	errs := op.Proto().GetError().GetErrors()
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", e.GetCode(), e.GetMessage()))
+	}
+	return xerrors.Errorf("operation %s failed: %s", op.Name(), strings.Join(msgs, "; "))
+}
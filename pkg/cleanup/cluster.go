@@ -0,0 +1,89 @@
+package cleanup
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// LabelClusterName is the label GKE sets to the name of the cluster on the
+// resources it creates for it.
+const LabelClusterName = "goog-k8s-cluster-name"
+
+// inTreeDiskName matches the names the in-tree GCE PD provisioner gives to
+// disks in GKE: gke-<cluster>-<cluster hash>-dynamic-pvc-<uuid>. Long cluster
+// names are truncated, which may cut off the hash and the -dynamic suffix.
+var inTreeDiskName = regexp.MustCompile(`^gke-(.+?)(-[0-9a-f]{8})?(-dynamic|-dynami|-dynam|-dyna|-dyn|-dy|-d)?-pvc-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Cluster returns the name of the GKE cluster disk was created for, taken from
+// its LabelClusterName label or else from the name the in-tree provisioner
+// gave it, which may hold a truncated cluster name. It returns "" if the
+// cluster is unknown, e.g. for disks created by the PD CSI driver without
+// the label.
+func Cluster(disk *computepb.Disk) string {
+	if name := disk.GetLabels()[LabelClusterName]; name != "" {
+		return name
+	}
+	if m := inTreeDiskName.FindStringSubmatch(disk.GetName()); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// InCluster reports whether disk was created for the GKE cluster named
+// cluster, as told by Cluster. A cluster name truncated in the name of an
+// in-tree disk matches every cluster it is a prefix of.
+func InCluster(disk *computepb.Disk, cluster string) bool {
+	if name := disk.GetLabels()[LabelClusterName]; name != "" {
+		return name == cluster
+	}
+	m := inTreeDiskName.FindStringSubmatch(disk.GetName())
+	if m == nil {
+		return false
+	}
+	if m[2] == "" {
+		// the hash was cut off, and maybe part of the cluster name
+		return strings.HasPrefix(cluster, m[1])
+	}
+	return m[1] == cluster
+}
+
+// Keys in the JSON description that provisioners give to a disk provisioned
+// for a PersistentVolumeClaim.
+const (
+	claimNamespaceKey = "kubernetes.io/created-for/pvc/namespace"
+	claimNameKey      = "kubernetes.io/created-for/pvc/name"
+	volumeNameKey     = "kubernetes.io/created-for/pv/name"
+)
+
+// volumeName matches the name of the PersistentVolume at the end of the name
+// of a dynamically provisioned disk.
+var volumeName = regexp.MustCompile(`pvc-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Claim identifies the PersistentVolumeClaim and PersistentVolume a disk was
+// provisioned for. Fields are empty if unknown.
+type Claim struct {
+	Namespace string
+	Name      string
+	Volume    string
+}
+
+// ClaimOf returns the claim disk was provisioned for, taken from its JSON
+// description. The volume is taken from the name of the disk if the
+// description does not hold it, e.g. for disks that were not provisioned by
+// GKE.
+func ClaimOf(disk *computepb.Disk) Claim {
+	var description map[string]string
+	_ = json.Unmarshal([]byte(disk.GetDescription()), &description)
+	c := Claim{
+		Namespace: description[claimNamespaceKey],
+		Name:      description[claimNameKey],
+		Volume:    description[volumeNameKey],
+	}
+	if c.Volume == "" {
+		c.Volume = volumeName.FindString(disk.GetName())
+	}
+	return c
+}
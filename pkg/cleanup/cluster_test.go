@@ -0,0 +1,109 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_Cluster(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		disk   *computepb.Disk
+		expect string
+	}{
+		{
+			name: "label",
+			disk: &computepb.Disk{
+				Name:   pointer.String("pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c"),
+				Labels: map[string]string{LabelClusterName: "prod-us"},
+			},
+			expect: "prod-us",
+		},
+		{
+			name:   "in-tree",
+			disk:   &computepb.Disk{Name: pointer.String("gke-prod-us-6d8b1ed2-dynamic-pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c")},
+			expect: "prod-us",
+		},
+		{
+			name:   "in-tree truncated",
+			disk:   &computepb.Disk{Name: pointer.String("gke-my-long-cluster-na-pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c")},
+			expect: "my-long-cluster-na",
+		},
+		{
+			name:   "csi",
+			disk:   &computepb.Disk{Name: pointer.String("pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c")},
+			expect: "",
+		},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, testCase.expect, Cluster(testCase.disk))
+		})
+	}
+}
+
+func Test_ClaimOf(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name   string
+		disk   *computepb.Disk
+		expect Claim
+	}{
+		{
+			name: "csi",
+			disk: &computepb.Disk{
+				Name:        pointer.String("pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c"),
+				Description: pointer.String(`{"kubernetes.io/created-for/pv/name":"pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c","kubernetes.io/created-for/pvc/name":"data-postgres-0","kubernetes.io/created-for/pvc/namespace":"payments","storage.gke.io/created-by":"pd.csi.storage.gke.io"}`),
+			},
+			expect: Claim{Namespace: "payments", Name: "data-postgres-0", Volume: "pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c"},
+		},
+		{
+			name: "in-tree without volume in description",
+			disk: &computepb.Disk{
+				Name:        pointer.String("gke-prod-us-6d8b1ed2-dynamic-pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c"),
+				Description: pointer.String(`{"kubernetes.io/created-for/pvc/name":"data","kubernetes.io/created-for/pvc/namespace":"default"}`),
+			},
+			expect: Claim{Namespace: "default", Name: "data", Volume: "pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c"},
+		},
+		{
+			name:   "not json",
+			disk:   &computepb.Disk{Name: pointer.String("scratch"), Description: pointer.String("scratch space for builds")},
+			expect: Claim{},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expect, ClaimOf(tt.disk))
+		})
+	}
+}
+
+func Test_InCluster(t *testing.T) {
+	t.Parallel()
+
+	labelled := &computepb.Disk{
+		Name:   pointer.String("pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c"),
+		Labels: map[string]string{LabelClusterName: "prod-us"},
+	}
+	require.True(t, InCluster(labelled, "prod-us"))
+	require.False(t, InCluster(labelled, "prod"))
+
+	inTree := &computepb.Disk{Name: pointer.String("gke-prod-6d8b1ed2-dynamic-pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c")}
+	require.True(t, InCluster(inTree, "prod"))
+	require.False(t, InCluster(inTree, "prod-us"))
+
+	truncated := &computepb.Disk{Name: pointer.String("gke-my-long-cluster-na-pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c")}
+	require.True(t, InCluster(truncated, "my-long-cluster-name-that-was-cut-off"))
+	require.False(t, InCluster(truncated, "my-other-cluster"))
+
+	require.False(t, InCluster(&computepb.Disk{Name: pointer.String("pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c")}, "prod"), "unknown cluster")
+}
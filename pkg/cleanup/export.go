@@ -0,0 +1,35 @@
+package cleanup
+
+import (
+	"context"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// Exporter exports a disk to Cloud Storage before a Cleaner deletes it, e.g.
+// to keep disks holding compliance-sensitive data outside of Compute Engine.
+type Exporter interface {
+	// Export exports disk in zone of projectID and returns the object it
+	// was exported to. It must be safe for concurrent use.
+	Export(ctx context.Context, projectID, zone string, disk *computepb.Disk) (*events.Export, error)
+}
+
+//go:generate moq -fmt goimports -out mock_exporter.go . Exporter:exporterMock
+
+// exportDisk exports disk with opts.Exporter, if set, and publishes where to.
+// The disk is not deleted if the export failed.
+func (c *Cleaner) exportDisk(ctx context.Context, disk *computepb.Disk, zone string, opts CleanupOptions) error {
+	if opts.Exporter == nil {
+		return nil
+	}
+	diskLogger(opts.ProjectID, zone, disk).Info().Msg("exporting disk before deletion")
+	export, err := opts.Exporter.Export(ctx, opts.ProjectID, zone, disk)
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeAPI, err, "disk %s: failed to export before deletion", disk.GetName())
+	}
+	c.bus.Publish(events.Event{Type: events.DiskExported, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Export: export})
+	return nil
+}
@@ -0,0 +1,82 @@
+package cleanup
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Fallback downgrades the rest of a run to a dry run once too many of the
+// disks it tried to change failed, so that a systemic issue, such as missing
+// permissions or an API outage, does not keep causing destructive attempts.
+// The remaining disks are still processed, to collect what would have been
+// done. A nil Fallback never downgrades. It is safe for concurrent use, and
+// meant to be shared by all projects of a run.
+type Fallback struct {
+	maxFailureRate float64
+	minAttempts    int
+
+	mu         sync.Mutex
+	attempted  int
+	failed     int
+	downgraded bool
+}
+
+// NewFallback returns a Fallback downgrading the run once more than
+// maxFailureRate, e.g. 0.5, of the disks it tried to change failed. The rate
+// is only checked after minAttempts disks, so that a single early failure
+// does not downgrade the run.
+func NewFallback(maxFailureRate float64, minAttempts int) *Fallback {
+	return &Fallback{maxFailureRate: maxFailureRate, minAttempts: minAttempts}
+}
+
+// DryRun reports whether the run was downgraded to a dry run.
+func (f *Fallback) DryRun() bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.downgraded
+}
+
+// Counts returns how many disks the run tried to change and how many of
+// those failed, up to the downgrade.
+func (f *Fallback) Counts() (attempted, failed int) {
+	if f == nil {
+		return 0, 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.attempted, f.failed
+}
+
+// observe records the outcome of a disk processed outside of dry run mode.
+// Skipped disks are not counted, unless they failed.
+func (f *Fallback) observe(action Action, err error) {
+	if f == nil {
+		return
+	}
+	failed := IsFailure(err)
+	if action == ActionSkip && !failed {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.downgraded {
+		return
+	}
+	f.attempted++
+	if failed {
+		f.failed++
+	}
+	if f.attempted < f.minAttempts || float64(f.failed) <= f.maxFailureRate*float64(f.attempted) {
+		return
+	}
+	f.downgraded = true
+	log.Error().
+		Int("attempted", f.attempted).
+		Int("failed", f.failed).
+		Float64("maxFailureRate", f.maxFailureRate).
+		Msg("failure rate exceeded -- downgrading the rest of the run to a dry run")
+}
@@ -0,0 +1,81 @@
+package cleanup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func Test_Fallback(t *testing.T) {
+	t.Parallel()
+
+	failure := errors.New("internal error")
+	type outcome struct {
+		action Action
+		err    error
+	}
+	tests := []struct {
+		name       string
+		outcomes   []outcome
+		downgraded bool
+		attempted  int
+		failed     int
+	}{
+		{
+			name:      "below min attempts",
+			outcomes:  []outcome{{ActionDelete, failure}, {ActionDelete, failure}},
+			attempted: 2,
+			failed:    2,
+		},
+		{
+			name:      "skips are not counted",
+			outcomes:  []outcome{{ActionSkip, diskerr.ErrExempt}, {ActionSkip, nil}, {ActionSkip, diskerr.ErrWithinGracePeriod}, {ActionDelete, failure}},
+			attempted: 1,
+			failed:    1,
+		},
+		{
+			name:      "within rate",
+			outcomes:  []outcome{{ActionDelete, nil}, {ActionDelete, failure}, {ActionMark, nil}, {ActionMark, failure}},
+			attempted: 4,
+			failed:    2,
+		},
+		{
+			name:       "exceeded",
+			outcomes:   []outcome{{ActionDelete, nil}, {ActionDelete, failure}, {ActionDelete, failure}, {ActionDelete, nil}},
+			downgraded: true,
+			attempted:  3,
+			failed:     2,
+		},
+		{
+			name:       "failed skips are counted",
+			outcomes:   []outcome{{ActionSkip, diskerr.New(diskerr.CodeTenantMismatch, "other tenant")}, {ActionSkip, diskerr.New(diskerr.CodeTenantMismatch, "other tenant")}, {ActionMark, failure}},
+			downgraded: true,
+			attempted:  3,
+			failed:     3,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			f := NewFallback(0.5, 3)
+			for _, o := range tt.outcomes {
+				f.observe(o.action, o.err)
+			}
+			require.Equal(t, tt.downgraded, f.DryRun())
+			attempted, failed := f.Counts()
+			require.Equal(t, tt.attempted, attempted)
+			require.Equal(t, tt.failed, failed)
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+		var f *Fallback
+		f.observe(ActionDelete, failure)
+		require.False(t, f.DryRun())
+	})
+}
@@ -0,0 +1,78 @@
+package cleanup
+
+import (
+	"context"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// zoneCount counts the disks of a zone, and those of them that are marked.
+type zoneCount struct {
+	Disks  int
+	Marked int
+}
+
+// checkMarkedFraction lists the disks of the project selected by opts and
+// returns an error if more than opts.MaxMarkedFraction of them are marked in
+// any zone. That many marks more likely come from a wrong filter or clock
+// than from abandoned disks.
+func (c *Cleaner) checkMarkedFraction(ctx context.Context, opts CleanupOptions) error {
+	diskIter, err := listDisks(ctx, c.client, opts.ProjectID, opts.Zones, opts.Tenant.filter(opts.Filter), nil, opts.AllFields, opts.PageSize)
+	if err != nil {
+		return err
+	}
+	counts, err := countMarked(selectDisks(diskIter, opts.Selector), opts.Zones)
+	if err != nil {
+		return err
+	}
+	return checkFractions(opts.ProjectID, counts, opts.MaxMarkedFraction)
+}
+
+// countMarked counts the disks of diskIter by zone.
+func countMarked(diskIter diskIterator, zones []string) (map[string]zoneCount, error) {
+	counts := make(map[string]zoneCount)
+	for {
+		disk, err := diskIter.Next()
+		if err == iterator.Done {
+			return counts, nil
+		}
+		if err != nil {
+			return nil, diskerr.Wrap(diskerr.CodeIterator, err, "iterating disks")
+		}
+		if checkRegional(disk) != nil {
+			// never deleted, so neither counted
+			continue
+		}
+		zone := diskZone(disk, zones)
+		count := counts[zone]
+		count.Disks++
+		if _, marked := MarkedAt(disk); marked {
+			count.Marked++
+		}
+		counts[zone] = count
+	}
+}
+
+// checkFractions returns an error naming the zones of projectID in counts
+// with more than maxFraction of their disks marked.
+func checkFractions(projectID string, counts map[string]zoneCount, maxFraction float64) error {
+	zones := make([]string, 0, len(counts))
+	for zone := range counts {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	for _, zone := range zones {
+		count := counts[zone]
+		fraction := float64(count.Marked) / float64(count.Disks)
+		log.Debug().Str("projectID", projectID).Str("zone", zone).Int("disks", count.Disks).Int("marked", count.Marked).Float64("fraction", fraction).Msg("marked fraction")
+		if fraction > maxFraction {
+			return xerrors.Errorf("zone %s: %d of %d disks are marked, more than the maximum fraction of %g; check the filter and clock of mark", zone, count.Marked, count.Disks, maxFraction)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_MarkedFraction(t *testing.T) {
+	t.Parallel()
+
+	disk := func(zone, mark string) *computepb.Disk {
+		d := &computepb.Disk{Name: pointer.String("test-disk"), Zone: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/" + zone)}
+		if mark != "" {
+			d.Labels = map[string]string{LabelMarkedForDeletion: mark}
+		}
+		return d
+	}
+	disks := []*computepb.Disk{
+		disk("us-central1-a", "2022-03-01"),
+		disk("us-central1-a", ""),
+		disk("us-central1-a", "false"),
+		disk("us-central1-a", ""),
+		disk("us-central1-b", "true"),
+		disk("us-central1-b", "2022-03-01"),
+	}
+	counts, err := countMarked(&diskIteratorMock{
+		NextFunc: func() (*computepb.Disk, error) {
+			if len(disks) == 0 {
+				return nil, iterator.Done
+			}
+			d := disks[0]
+			disks = disks[1:]
+			return d, nil
+		},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]zoneCount{
+		"us-central1-a": {Disks: 4, Marked: 1},
+		"us-central1-b": {Disks: 2, Marked: 2},
+	}, counts)
+
+	require.NoError(t, checkFractions("testing", map[string]zoneCount{"us-central1-a": counts["us-central1-a"]}, 0.25))
+	require.EqualError(t, checkFractions("testing", counts, 0.25), "zone us-central1-b: 2 of 2 disks are marked, more than the maximum fraction of 0.25; check the filter and clock of mark")
+	require.NoError(t, checkFractions("testing", counts, 1))
+}
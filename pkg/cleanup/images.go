@@ -0,0 +1,351 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// ImagesClient is the subset of the compute images API used by this package.
+// *computev1.ImagesClient implements it.
+type ImagesClient interface {
+	List(context.Context, *computepb.ListImagesRequest, ...gax.CallOption) *computev1.ImageIterator
+	Delete(context.Context, *computepb.DeleteImageRequest, ...gax.CallOption) (*computev1.Operation, error)
+}
+
+// InstanceTemplatesClient is the subset of the compute instance templates API
+// used by this package. *computev1.InstanceTemplatesClient implements it.
+type InstanceTemplatesClient interface {
+	List(context.Context, *computepb.ListInstanceTemplatesRequest, ...gax.CallOption) *computev1.InstanceTemplateIterator
+}
+
+type imageIterator interface {
+	Next() (*computepb.Image, error)
+}
+
+type instanceTemplateIterator interface {
+	Next() (*computepb.InstanceTemplate, error)
+}
+
+//go:generate moq -fmt goimports -out mock_images_client.go . ImagesClient:imagesClientMock
+//go:generate moq -fmt goimports -out mock_instance_templates_client.go . InstanceTemplatesClient:instanceTemplatesClientMock
+//go:generate moq -fmt goimports -out mock_image_iterator.go . imageIterator
+//go:generate moq -fmt goimports -out mock_instance_template_iterator.go . instanceTemplateIterator
+
+// ImageKey returns the key of image in ResourceMarks, e.g.
+// projects/p/global/images/i.
+func ImageKey(projectID string, image *computepb.Image) string {
+	return fmt.Sprintf("projects/%s/global/images/%s", projectID, image.GetName())
+}
+
+// imageRef returns the image a disk or instance template refers to, as
+// projects/p/global/images/i or projects/p/global/images/family/f, and false
+// if ref, a URL or partial URL, does not name an image. Partial URLs without
+// a project, e.g. global/images/i, are in projectID.
+func imageRef(projectID, ref string) (string, bool) {
+	i := strings.Index(ref, "global/images/")
+	if i < 0 {
+		return "", false
+	}
+	if j := strings.LastIndex(ref[:i], "projects/"); j >= 0 {
+		projectID = strings.TrimSuffix(ref[j+len("projects/"):i], "/")
+	}
+	return fmt.Sprintf("projects/%s/%s", projectID, ref[i:]), true
+}
+
+// ImageUsage holds the images that disks were created from and that instance
+// templates create disks from, in all the projects of a run, as images can be
+// used across projects. The zero value is not usable, use NewImageUsage.
+type ImageUsage struct {
+	refs map[string]bool
+}
+
+// NewImageUsage returns an empty ImageUsage.
+func NewImageUsage() *ImageUsage {
+	return &ImageUsage{refs: make(map[string]bool)}
+}
+
+// Len returns the number of images and image families in use.
+func (u *ImageUsage) Len() int {
+	return len(u.refs)
+}
+
+func (u *ImageUsage) add(projectID, ref string) {
+	if key, ok := imageRef(projectID, ref); ok {
+		u.refs[key] = true
+	}
+}
+
+// usedBy returns what uses image of projectID: a disk or template that refers
+// to it, or to its family if it is the newest image of its family, as those
+// are resolved to the newest image when used. Empty if none does.
+func (u *ImageUsage) usedBy(projectID string, image *computepb.Image, newestInFamily bool) string {
+	if u.refs[ImageKey(projectID, image)] {
+		return "disks or instance templates"
+	}
+	if newestInFamily && u.refs[fmt.Sprintf("projects/%s/global/images/family/%s", projectID, image.GetFamily())] {
+		return "instance templates of family " + image.GetFamily()
+	}
+	return ""
+}
+
+// ImageOptions configures a single MarkImages or DeleteImages call.
+type ImageOptions struct {
+	ProjectID string
+	// Cutoff is how long ago an image must have been created to be marked.
+	Cutoff time.Duration
+	// GracePeriod is how long ago an image must have been marked to be
+	// deleted.
+	GracePeriod time.Duration
+	// Usage holds the images in use, see ImageCleaner.LoadUsage.
+	Usage *ImageUsage
+	// ExemptLabel is the label that, set to "true", exempts an image, e.g.
+	// DefaultExemptLabel. Empty exempts no image.
+	ExemptLabel string
+	// Marks holds the marks of the images, and is updated in place.
+	Marks      ResourceMarks
+	MaxRetries int
+	DryRun     bool
+}
+
+// ImageCleaner marks the custom images that no disk was created from and no
+// instance template creates disks from, and deletes them once they were marked
+// long enough ago, as Marker and Cleaner do for disks.
+type ImageCleaner struct {
+	images    ImagesClient
+	templates InstanceTemplatesClient
+	disks     DisksClient
+	sleep     func(context.Context, time.Duration) error
+}
+
+// NewImageCleaner returns an ImageCleaner, which looks up the images in use
+// with templates and disks.
+func NewImageCleaner(images ImagesClient, templates InstanceTemplatesClient, disks DisksClient) *ImageCleaner {
+	return &ImageCleaner{images: images, templates: templates, disks: disks, sleep: gax.Sleep}
+}
+
+// LoadUsage adds the images used by the disks and instance templates of
+// projectID to usage. The disks of instances are included, as instances only
+// refer to their images through their boot disks.
+func (c *ImageCleaner) LoadUsage(ctx context.Context, projectID string, usage *ImageUsage) error {
+	di, err := listDisks(ctx, c.disks, projectID, nil, "", nil, false, 0)
+	if err != nil {
+		return err
+	}
+	for {
+		disk, err := di.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return diskerr.Wrap(diskerr.CodeIterator, err, "iterating disks")
+		}
+		usage.add(projectID, disk.GetSourceImage())
+	}
+	return c.loadTemplateUsage(c.templates.List(ctx, &computepb.ListInstanceTemplatesRequest{Project: projectID}), projectID, usage)
+}
+
+func (c *ImageCleaner) loadTemplateUsage(ti instanceTemplateIterator, projectID string, usage *ImageUsage) error {
+	for {
+		template, err := ti.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return diskerr.Wrap(diskerr.CodeIterator, err, "iterating instance templates")
+		}
+		for _, disk := range template.GetProperties().GetDisks() {
+			usage.add(projectID, disk.GetInitializeParams().GetSourceImage())
+		}
+	}
+}
+
+// listImages returns the images of ii, and the names of the
+// newest usable image of each family.
+func listImages(ii imageIterator) ([]*computepb.Image, map[string]bool, error) {
+	var images []*computepb.Image
+	newest := make(map[string]*computepb.Image)
+	for {
+		image, err := ii.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, diskerr.Wrap(diskerr.CodeIterator, err, "iterating images")
+		}
+		images = append(images, image)
+		family := image.GetFamily()
+		if state := image.GetDeprecated().GetState(); family == "" || (state != "" && state != computepb.DeprecationStatus_ACTIVE.String()) {
+			continue
+		}
+		// RFC 3339 timestamps in the same zone sort by time
+		if n, ok := newest[family]; !ok || image.GetCreationTimestamp() > n.GetCreationTimestamp() {
+			newest[family] = image
+		}
+	}
+	newestNames := make(map[string]bool, len(newest))
+	for _, image := range newest {
+		newestNames[image.GetName()] = true
+	}
+	return images, newestNames, nil
+}
+
+// MarkImages marks the images of the project created before the cutoff that
+// are not in use, and unmarks those in use again. Marks of images that no
+// longer exist are dropped. Per-image failures are logged and counted in the
+// returned stats; an error is only returned if listing images fails.
+func (c *ImageCleaner) MarkImages(ctx context.Context, opts ImageOptions) (ResourceStats, error) {
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no images will be marked")
+	}
+	return c.markAll(c.images.List(ctx, &computepb.ListImagesRequest{Project: opts.ProjectID}), opts)
+}
+
+func (c *ImageCleaner) markAll(ii imageIterator, opts ImageOptions) (ResourceStats, error) {
+	var stats ResourceStats
+	images, newest, err := listImages(ii)
+	if err != nil {
+		return stats, err
+	}
+	seen := make(map[string]bool, len(images))
+	for _, image := range images {
+		seen[ImageKey(opts.ProjectID, image)] = true
+		action, err := c.markImage(image, newest[image.GetName()], opts)
+		stats.count(imageLogger(opts.ProjectID, image), "image", action, err)
+	}
+	prefix := fmt.Sprintf("projects/%s/", opts.ProjectID)
+	for key := range opts.Marks {
+		if strings.HasPrefix(key, prefix) && !seen[key] && !opts.DryRun {
+			log.Info().Str("projectID", opts.ProjectID).Str("image", key).Msg("dropping mark of image that no longer exists")
+			delete(opts.Marks, key)
+		}
+	}
+	return stats, nil
+}
+
+// checkImageUnused returns an error if image is exempt or in use.
+func checkImageUnused(image *computepb.Image, newestInFamily bool, opts ImageOptions) error {
+	if opts.ExemptLabel != "" && image.GetLabels()[opts.ExemptLabel] == "true" {
+		return diskerr.New(diskerr.CodeExempt, "image %s is exempt from cleanup by label %s", image.GetName(), opts.ExemptLabel)
+	}
+	if by := opts.Usage.usedBy(opts.ProjectID, image, newestInFamily); by != "" {
+		return diskerr.New(diskerr.CodeInUse, "image %s is used by %s", image.GetName(), by)
+	}
+	return nil
+}
+
+func (c *ImageCleaner) markImage(image *computepb.Image, newestInFamily bool, opts ImageOptions) (Action, error) {
+	key := ImageKey(opts.ProjectID, image)
+	logger := imageLogger(opts.ProjectID, image)
+	_, marked := parseMark(opts.Marks[key])
+	if err := checkImageUnused(image, newestInFamily, opts); err != nil {
+		if !marked {
+			return ActionSkip, err
+		}
+		// used again, or exempted since
+		if opts.DryRun {
+			return ActionUnmark, diskerr.ErrDryRun
+		}
+		delete(opts.Marks, key)
+		logger.Info().Err(err).Msg("unmarked image")
+		return ActionUnmark, nil
+	}
+	if marked {
+		return ActionSkip, diskerr.ErrAlreadyMarked
+	}
+	created, err := time.Parse(time.RFC3339, image.GetCreationTimestamp())
+	if err != nil {
+		return ActionSkip, diskerr.Wrap(diskerr.CodeInvalidTimestamp, err, "image %s: parse creation timestamp", image.GetName())
+	}
+	if time.Since(created) < opts.Cutoff {
+		return ActionSkip, diskerr.ErrWithinCutoff
+	}
+	if opts.DryRun {
+		logger.Info().Msg("dry run -- would mark image")
+		return ActionMark, diskerr.ErrDryRun
+	}
+	opts.Marks[key] = markValue(time.Now())
+	logger.Info().Msg("marked image for deletion")
+	return ActionMark, nil
+}
+
+// DeleteImages deletes the marked images of the project that are still not
+// in use, once their mark is older than the grace period. Per-image failures
+// are logged and counted in the returned stats; an error is only returned if
+// listing images fails.
+func (c *ImageCleaner) DeleteImages(ctx context.Context, opts ImageOptions) (ResourceStats, error) {
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no images will be deleted")
+	}
+	return c.deleteAll(ctx, c.images.List(ctx, &computepb.ListImagesRequest{Project: opts.ProjectID}), opts)
+}
+
+func (c *ImageCleaner) deleteAll(ctx context.Context, ii imageIterator, opts ImageOptions) (ResourceStats, error) {
+	var stats ResourceStats
+	images, newest, err := listImages(ii)
+	if err != nil {
+		return stats, err
+	}
+	for _, image := range images {
+		action, err := ActionSkip, error(nil)
+		if _, marked := parseMark(opts.Marks[ImageKey(opts.ProjectID, image)]); marked {
+			action, err = ActionDelete, c.deleteImage(ctx, image, newest[image.GetName()], opts)
+		}
+		stats.count(imageLogger(opts.ProjectID, image), "image", action, err)
+	}
+	return stats, nil
+}
+
+func (c *ImageCleaner) deleteImage(ctx context.Context, image *computepb.Image, newestInFamily bool, opts ImageOptions) error {
+	key := ImageKey(opts.ProjectID, image)
+	logger := imageLogger(opts.ProjectID, image)
+	markedAt, _ := parseMark(opts.Marks[key])
+	if err := checkImageUnused(image, newestInFamily, opts); err != nil {
+		return err
+	}
+	if opts.GracePeriod > 0 && time.Since(markedAt) < opts.GracePeriod {
+		return diskerr.New(diskerr.CodeWithinGracePeriod, "skipping image %s: marked on %s, within grace period of %s", image.GetName(), opts.Marks[key], opts.GracePeriod)
+	}
+	if opts.DryRun {
+		logger.Warn().Msg("dry run -- would delete image")
+		return diskerr.ErrDryRun
+	}
+	logger.Warn().Msg("deleting image")
+	req := &computepb.DeleteImageRequest{
+		Image:     image.GetName(),
+		Project:   opts.ProjectID,
+		RequestId: pointer.String(resourceRequestID(image.GetId(), image.GetCreationTimestamp(), "delete")),
+	}
+	r := retrier{maxRetries: opts.MaxRetries, backoff: callBackoff, sleep: c.sleep}
+	err := r.do(ctx, logger, "deleteImage", func() error {
+		_, err := c.images.Delete(ctx, req)
+		return err
+	})
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeAPI, err, "failed to delete image %s", image.GetName())
+	}
+	delete(opts.Marks, key)
+	return nil
+}
+
+// imageLogger returns a logger that includes image in every line.
+func imageLogger(projectID string, image *computepb.Image) *zerolog.Logger {
+	l := log.With().
+		Str("projectID", projectID).
+		Str("image", image.GetName()).
+		Str("family", image.GetFamily()).
+		Int64("diskSizeGB", image.GetDiskSizeGb()).
+		Logger()
+	return &l
+}
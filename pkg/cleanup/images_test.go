@@ -0,0 +1,159 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_Images(t *testing.T) {
+	t.Parallel()
+
+	old := time.Now().Add(-180 * 24 * time.Hour)
+	image := func(name, family string, created time.Time) *computepb.Image {
+		return &computepb.Image{
+			Name:              pointer.String(name),
+			Family:            pointer.String(family),
+			CreationTimestamp: pointer.String(created.Format(time.RFC3339)),
+		}
+	}
+	iter := func(images ...*computepb.Image) imageIterator {
+		return &imageIteratorMock{
+			NextFunc: func() (*computepb.Image, error) {
+				if len(images) == 0 {
+					return nil, iterator.Done
+				}
+				i := images[0]
+				images = images[1:]
+				return i, nil
+			},
+		}
+	}
+	key := func(name string) string {
+		return "projects/testing/global/images/" + name
+	}
+	usage := NewImageUsage()
+	usage.add("testing", "https://www.googleapis.com/compute/v1/projects/testing/global/images/used")
+	usage.add("other", "projects/testing/global/images/family/ws")
+	usage.add("other", "global/images/other-project")
+	usage.add("testing", "projects/debian-cloud/global/images/family/debian-11")
+	images := func() imageIterator {
+		deprecated := image("ws-3", "ws", old.Add(48*time.Hour))
+		deprecated.Deprecated = &computepb.DeprecationStatus{State: pointer.String(computepb.DeprecationStatus_DEPRECATED.String())}
+		exempt := image("exempt", "", old)
+		exempt.Labels = map[string]string{DefaultExemptLabel: "true"}
+		return iter(
+			image("unused", "", old),
+			image("used", "", old),
+			image("new", "", time.Now()),
+			image("ws-1", "ws", old),
+			image("ws-2", "ws", old.Add(24*time.Hour)),
+			deprecated,
+			exempt,
+			image("other-project", "", old),
+		)
+	}
+
+	t.Run("usage", func(t *testing.T) {
+		t.Parallel()
+
+		u := NewImageUsage()
+		template := &computepb.InstanceTemplate{Properties: &computepb.InstanceProperties{Disks: []*computepb.AttachedDisk{
+			{InitializeParams: &computepb.AttachedDiskInitializeParams{SourceImage: pointer.String("global/images/family/ws")}},
+			{Source: pointer.String("projects/testing/zones/us-central1-a/disks/data")},
+		}}}
+		templates := &instanceTemplateIteratorMock{
+			NextFunc: func() (*computepb.InstanceTemplate, error) {
+				if template == nil {
+					return nil, iterator.Done
+				}
+				t := template
+				template = nil
+				return t, nil
+			},
+		}
+		require.NoError(t, (&ImageCleaner{}).loadTemplateUsage(templates, "testing", u))
+		require.Equal(t, 1, u.Len())
+		require.Equal(t, "instance templates of family ws", u.usedBy("testing", image("ws-2", "ws", old), true))
+		require.Empty(t, u.usedBy("testing", image("ws-1", "ws", old), false))
+	})
+
+	t.Run("mark", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{
+			key("used"):                         "2020-01-01",
+			key("gone"):                         "2020-01-01",
+			"projects/other/global/images/gone": "2020-01-01",
+		}
+		c := NewImageCleaner(&imagesClientMock{}, &instanceTemplatesClientMock{}, &disksClientMock{})
+		stats, err := c.markAll(images(), ImageOptions{ProjectID: "testing", Cutoff: 90 * 24 * time.Hour, Usage: usage, ExemptLabel: DefaultExemptLabel, Marks: marks})
+		require.NoError(t, err)
+		require.Equal(t, ResourceStats{Stats: Stats{Scanned: 8}, Marked: 4, Unmarked: 1}, stats)
+		require.Equal(t, ResourceMarks{
+			key("unused"): markValue(time.Now()),
+			key("ws-1"):   markValue(time.Now()),
+			key("ws-3"):   markValue(time.Now()),
+			// referred to as global/images/other-project in project other
+			key("other-project"):                markValue(time.Now()),
+			"projects/other/global/images/gone": "2020-01-01",
+		}, marks)
+	})
+
+	t.Run("mark dry run", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{key("used"): "2020-01-01"}
+		c := NewImageCleaner(&imagesClientMock{}, &instanceTemplatesClientMock{}, &disksClientMock{})
+		stats, err := c.markAll(images(), ImageOptions{ProjectID: "testing", Cutoff: 90 * 24 * time.Hour, Usage: usage, Marks: marks, DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, 5, stats.Marked)
+		require.Equal(t, 1, stats.Unmarked)
+		require.Equal(t, ResourceMarks{key("used"): "2020-01-01"}, marks)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{
+			key("unused"): "2020-01-01",
+			key("used"):   "2020-01-01",
+			key("ws-1"):   markValue(time.Now()),
+		}
+		client := &imagesClientMock{
+			DeleteFunc: func(context.Context, *computepb.DeleteImageRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		c := NewImageCleaner(client, &instanceTemplatesClientMock{}, &disksClientMock{})
+		stats, err := c.deleteAll(context.Background(), images(), ImageOptions{ProjectID: "testing", GracePeriod: 7 * 24 * time.Hour, Usage: usage, Marks: marks})
+		require.NoError(t, err)
+		require.Equal(t, ResourceStats{Stats: Stats{Scanned: 8}, Deleted: 1}, stats)
+		require.Len(t, client.DeleteCalls(), 1)
+		req := client.DeleteCalls()[0].DeleteImageRequest
+		require.Equal(t, "unused", req.GetImage())
+		require.Equal(t, "testing", req.GetProject())
+		require.NotEmpty(t, req.GetRequestId())
+		require.Equal(t, ResourceMarks{key("used"): "2020-01-01", key("ws-1"): markValue(time.Now())}, marks)
+	})
+
+	t.Run("delete dry run", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{key("unused"): "2020-01-01"}
+		client := &imagesClientMock{}
+		c := NewImageCleaner(client, &instanceTemplatesClientMock{}, &disksClientMock{})
+		stats, err := c.deleteAll(context.Background(), images(), ImageOptions{ProjectID: "testing", Usage: usage, Marks: marks, DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.Deleted)
+		require.Empty(t, client.DeleteCalls())
+		require.Contains(t, marks, key("unused"))
+	})
+}
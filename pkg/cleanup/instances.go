@@ -0,0 +1,416 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// InstancesClient is the subset of the compute instances API used by this
+// package. *computev1.InstancesClient implements it.
+type InstancesClient interface {
+	AggregatedList(context.Context, *computepb.AggregatedListInstancesRequest, ...gax.CallOption) *computev1.InstancesScopedListPairIterator
+	Delete(context.Context, *computepb.DeleteInstanceRequest, ...gax.CallOption) (*computev1.Operation, error)
+	Stop(context.Context, *computepb.StopInstanceRequest, ...gax.CallOption) (*computev1.Operation, error)
+}
+
+type instanceIterator interface {
+	Next() (*computepb.Instance, error)
+}
+
+//go:generate moq -fmt goimports -out mock_instances_client.go . InstancesClient:instancesClientMock
+//go:generate moq -fmt goimports -out mock_instance_iterator.go . instanceIterator
+
+// InstanceAction is what InstanceCleaner.CleanupInstances does with a marked
+// instance.
+type InstanceAction string
+
+const (
+	// InstanceDelete deletes the instance, after snapshotting its boot disk.
+	InstanceDelete InstanceAction = "delete"
+	// InstanceStop stops suspended instances, which are billed for their
+	// memory, and leaves stopped ones alone.
+	InstanceStop InstanceAction = "stop"
+)
+
+// ParseInstanceAction parses the value of --instance-action.
+func ParseInstanceAction(s string) (InstanceAction, error) {
+	switch a := InstanceAction(s); a {
+	case InstanceDelete, InstanceStop:
+		return a, nil
+	}
+	return "", xerrors.Errorf("unknown instance action %q, expected delete or stop", s)
+}
+
+// InstanceKey returns the key of instance in ResourceMarks, e.g.
+// projects/p/zones/z/instances/i.
+func InstanceKey(projectID string, instance *computepb.Instance) string {
+	return fmt.Sprintf("projects/%s/zones/%s/instances/%s", projectID, path.Base(instance.GetZone()), instance.GetName())
+}
+
+// InstanceOptions configures a single MarkInstances or CleanupInstances call.
+type InstanceOptions struct {
+	ProjectID string
+	// Filter is passed to the list instances request, e.g. to only list
+	// the VMs of workspaces by their label.
+	Filter string
+	// Cutoff is how long an instance must have been stopped or suspended
+	// to be marked.
+	Cutoff time.Duration
+	// GracePeriod is how long ago an instance must have been marked to be
+	// cleaned up.
+	GracePeriod time.Duration
+	// Action is what happens to a marked instance. Defaults to
+	// InstanceDelete.
+	Action InstanceAction
+	// SnapshotBootDisk snapshots the boot disk of an instance before it is
+	// deleted, so that the workspace can be restored.
+	SnapshotBootDisk bool
+	// ExemptLabel is the label that, set to "true", exempts an instance,
+	// e.g. DefaultExemptLabel. Empty exempts no instance.
+	ExemptLabel string
+	// Marks holds the marks of the instances, and is updated in place.
+	Marks      ResourceMarks
+	MaxRetries int
+	DryRun     bool
+}
+
+// InstanceCleaner marks VMs that have been stopped or suspended for longer
+// than a cutoff, e.g. those of abandoned workspaces, and deletes or stops them
+// once they were marked long enough ago, as Marker and Cleaner do for disks.
+type InstanceCleaner struct {
+	client InstancesClient
+	disks  DisksClient
+	sleep  func(context.Context, time.Duration) error
+}
+
+// NewInstanceCleaner returns an InstanceCleaner, which snapshots boot disks
+// with disks.
+func NewInstanceCleaner(client InstancesClient, disks DisksClient) *InstanceCleaner {
+	return &InstanceCleaner{client: client, disks: disks, sleep: gax.Sleep}
+}
+
+// listInstances returns the instances of projectID matching filter in all
+// zones.
+func listInstances(ctx context.Context, client InstancesClient, projectID, filter string) instanceIterator {
+	req := &computepb.AggregatedListInstancesRequest{Project: projectID}
+	if filter != "" {
+		req.Filter = pointer.String(filter)
+	}
+	return &aggregatedInstanceIterator{pairs: client.AggregatedList(ctx, req)}
+}
+
+type aggregatedInstanceIterator struct {
+	pairs interface {
+		Next() (computev1.InstancesScopedListPair, error)
+	}
+	buf []*computepb.Instance
+}
+
+func (a *aggregatedInstanceIterator) Next() (*computepb.Instance, error) {
+	for len(a.buf) == 0 {
+		pair, err := a.pairs.Next()
+		if err != nil {
+			return nil, err
+		}
+		// zones without any instances only carry a warning
+		a.buf = pair.Value.GetInstances()
+	}
+	instance := a.buf[0]
+	a.buf = a.buf[1:]
+	return instance, nil
+}
+
+// stoppedSince returns when instance was stopped or suspended, and false if
+// it is neither.
+func stoppedSince(instance *computepb.Instance) (string, bool) {
+	var since string
+	switch instance.GetStatus() {
+	case computepb.Instance_SUSPENDED.String():
+		since = instance.GetLastSuspendedTimestamp()
+	case computepb.Instance_TERMINATED.String(), computepb.Instance_STOPPED.String():
+		since = instance.GetLastStopTimestamp()
+	default:
+		return "", false
+	}
+	if since == "" {
+		// created without ever being started
+		since = instance.GetCreationTimestamp()
+	}
+	return since, true
+}
+
+// MarkInstances marks the instances of the project that have been stopped or
+// suspended for longer than the cutoff, and unmarks those running again.
+// Marks of instances that no longer exist are dropped. Per-instance failures
+// are logged and counted in the returned stats; an error is only returned if
+// listing instances fails.
+func (c *InstanceCleaner) MarkInstances(ctx context.Context, opts InstanceOptions) (ResourceStats, error) {
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no instances will be marked")
+	}
+	return c.markAll(ctx, listInstances(ctx, c.client, opts.ProjectID, opts.Filter), opts)
+}
+
+func (c *InstanceCleaner) markAll(ctx context.Context, ii instanceIterator, opts InstanceOptions) (ResourceStats, error) {
+	var stats ResourceStats
+	seen := make(map[string]bool)
+	err := eachInstance(ii, &stats, opts, func(instance *computepb.Instance) (Action, error) {
+		seen[InstanceKey(opts.ProjectID, instance)] = true
+		return c.markInstance(instance, opts)
+	})
+	if err != nil {
+		return stats, err
+	}
+	prefix := fmt.Sprintf("projects/%s/", opts.ProjectID)
+	for key := range opts.Marks {
+		if strings.HasPrefix(key, prefix) && !seen[key] && !opts.DryRun {
+			log.Info().Str("projectID", opts.ProjectID).Str("instance", key).Msg("dropping mark of instance that no longer exists")
+			delete(opts.Marks, key)
+		}
+	}
+	return stats, nil
+}
+
+func (c *InstanceCleaner) markInstance(instance *computepb.Instance, opts InstanceOptions) (Action, error) {
+	key := InstanceKey(opts.ProjectID, instance)
+	logger := instanceLogger(opts.ProjectID, instance)
+	_, marked := parseMark(opts.Marks[key])
+	since, stopped := stoppedSince(instance)
+	if err := checkInstanceExempt(instance, opts.ExemptLabel); err != nil || !stopped {
+		if !marked {
+			return ActionSkip, err
+		}
+		// started again, or exempted since
+		if opts.DryRun {
+			return ActionUnmark, diskerr.ErrDryRun
+		}
+		delete(opts.Marks, key)
+		logger.Info().Msg("unmarked instance")
+		return ActionUnmark, nil
+	}
+	if marked {
+		return ActionSkip, diskerr.ErrAlreadyMarked
+	}
+	stoppedAt, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return ActionSkip, diskerr.Wrap(diskerr.CodeInvalidTimestamp, err, "instance %s: parse stop timestamp", instance.GetName())
+	}
+	if time.Since(stoppedAt) < opts.Cutoff {
+		return ActionSkip, diskerr.ErrWithinCutoff
+	}
+	if opts.DryRun {
+		logger.Info().Msg("dry run -- would mark instance")
+		return ActionMark, diskerr.ErrDryRun
+	}
+	opts.Marks[key] = markValue(time.Now())
+	logger.Info().Msg("marked instance for cleanup")
+	return ActionMark, nil
+}
+
+// CleanupInstances deletes or stops, see InstanceOptions.Action, the marked
+// instances of the project that are still stopped or suspended, once their
+// mark is older than the grace period. Per-instance failures are logged and
+// counted in the returned stats; an error is only returned if listing
+// instances fails.
+func (c *InstanceCleaner) CleanupInstances(ctx context.Context, opts InstanceOptions) (ResourceStats, error) {
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no instances will be deleted or stopped")
+	}
+	return c.cleanupAll(ctx, listInstances(ctx, c.client, opts.ProjectID, opts.Filter), opts)
+}
+
+func (c *InstanceCleaner) cleanupAll(ctx context.Context, ii instanceIterator, opts InstanceOptions) (ResourceStats, error) {
+	var stats ResourceStats
+	err := eachInstance(ii, &stats, opts, func(instance *computepb.Instance) (Action, error) {
+		if _, marked := parseMark(opts.Marks[InstanceKey(opts.ProjectID, instance)]); !marked {
+			return ActionSkip, nil
+		}
+		return c.cleanupInstance(ctx, instance, opts)
+	})
+	return stats, err
+}
+
+func (c *InstanceCleaner) cleanupInstance(ctx context.Context, instance *computepb.Instance, opts InstanceOptions) (Action, error) {
+	key := InstanceKey(opts.ProjectID, instance)
+	logger := instanceLogger(opts.ProjectID, instance)
+	markedAt, _ := parseMark(opts.Marks[key])
+	if _, stopped := stoppedSince(instance); !stopped {
+		return ActionSkip, diskerr.New(diskerr.CodeInUse, "skipping instance %s: %s", instance.GetName(), strings.ToLower(instance.GetStatus()))
+	}
+	if err := checkInstanceExempt(instance, opts.ExemptLabel); err != nil {
+		return ActionSkip, err
+	}
+	if opts.GracePeriod > 0 && time.Since(markedAt) < opts.GracePeriod {
+		return ActionSkip, diskerr.New(diskerr.CodeWithinGracePeriod, "skipping instance %s: marked on %s, within grace period of %s", instance.GetName(), opts.Marks[key], opts.GracePeriod)
+	}
+	zone := path.Base(instance.GetZone())
+	r := retrier{maxRetries: opts.MaxRetries, backoff: callBackoff, sleep: c.sleep}
+	if opts.Action == InstanceStop {
+		if instance.GetStatus() != computepb.Instance_SUSPENDED.String() {
+			// already stopped, nothing left to save
+			return ActionSkip, nil
+		}
+		if opts.DryRun {
+			logger.Warn().Msg("dry run -- would stop instance")
+			return ActionDelete, diskerr.ErrDryRun
+		}
+		logger.Warn().Msg("stopping suspended instance")
+		req := &computepb.StopInstanceRequest{
+			Instance:  instance.GetName(),
+			Project:   opts.ProjectID,
+			Zone:      zone,
+			RequestId: pointer.String(instanceRequestID(instance, "stop/"+instance.GetLastSuspendedTimestamp())),
+		}
+		err := r.do(ctx, logger, "stopInstance", func() error {
+			_, err := c.client.Stop(ctx, req)
+			return err
+		})
+		if err != nil {
+			return ActionDelete, diskerr.Wrap(diskerr.CodeAPI, err, "failed to stop instance %s", instance.GetName())
+		}
+		// the instance starts over as stopped, and is marked again after
+		// the cutoff
+		delete(opts.Marks, key)
+		return ActionDelete, nil
+	}
+	if opts.SnapshotBootDisk {
+		if err := c.snapshotBootDisk(ctx, instance, zone, r, opts); err != nil {
+			return ActionDelete, err
+		}
+	}
+	if opts.DryRun {
+		logger.Warn().Msg("dry run -- would delete instance")
+		return ActionDelete, diskerr.ErrDryRun
+	}
+	logger.Warn().Msg("deleting instance")
+	req := &computepb.DeleteInstanceRequest{
+		Instance:  instance.GetName(),
+		Project:   opts.ProjectID,
+		Zone:      zone,
+		RequestId: pointer.String(instanceRequestID(instance, "delete")),
+	}
+	err := r.do(ctx, logger, "deleteInstance", func() error {
+		_, err := c.client.Delete(ctx, req)
+		return err
+	})
+	if err != nil {
+		return ActionDelete, diskerr.Wrap(diskerr.CodeAPI, err, "failed to delete instance %s", instance.GetName())
+	}
+	delete(opts.Marks, key)
+	return ActionDelete, nil
+}
+
+// snapshotBootDisk snapshots the boot disk of instance, or only logs that it
+// would in dry run mode. A snapshot left behind by an earlier run is reused.
+func (c *InstanceCleaner) snapshotBootDisk(ctx context.Context, instance *computepb.Instance, zone string, r retrier, opts InstanceOptions) error {
+	var boot *computepb.AttachedDisk
+	for _, attached := range instance.GetDisks() {
+		if attached.GetBoot() {
+			boot = attached
+			break
+		}
+	}
+	if boot == nil {
+		return nil
+	}
+	logger := instanceLogger(opts.ProjectID, instance)
+	diskName := path.Base(boot.GetSource())
+	name, err := (*SnapshotNamer)(nil).Name(&computepb.Disk{Name: pointer.String(diskName)}, zone, opts.ProjectID, time.Now())
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeUnknown, err, "instance %s: failed to name snapshot", instance.GetName())
+	}
+	if opts.DryRun {
+		logger.Info().Str("disk", diskName).Str("snapshot", name).Msg("dry run -- would snapshot boot disk prior to deletion")
+		return nil
+	}
+	logger.Info().Str("disk", diskName).Str("snapshot", name).Msg("snapshotting boot disk prior to deletion")
+	labels := make(map[string]string, len(instance.GetLabels())+1)
+	for k, v := range instance.GetLabels() {
+		labels[k] = v
+	}
+	labels[LabelCreatedBy] = CreatedBy
+	req := &computepb.CreateSnapshotDiskRequest{
+		Disk:      diskName,
+		Project:   opts.ProjectID,
+		RequestId: pointer.String(instanceRequestID(instance, "createSnapshot/"+name)),
+		SnapshotResource: &computepb.Snapshot{
+			Name:        pointer.String(name),
+			Description: pointer.String(fmt.Sprintf("boot disk of instance %s", instance.GetName())),
+			Labels:      labels,
+		},
+		Zone: zone,
+	}
+	var op *computev1.Operation
+	err = r.do(ctx, logger, "createSnapshot", func() (err error) {
+		op, err = c.disks.CreateSnapshot(ctx, req)
+		return err
+	})
+	switch {
+	case isConflict(err):
+		logger.Info().Msg("snapshot of boot disk already exists")
+	case err != nil:
+		return diskerr.Wrap(diskerr.CodeAPI, err, "instance %s: failed to snapshot boot disk %s before deletion", instance.GetName(), diskName)
+	default:
+		if err := WaitOperation(ctx, op); err != nil {
+			return diskerr.Wrap(diskerr.CodeAPI, err, "instance %s: failed to wait for snapshot of boot disk to be ready", instance.GetName())
+		}
+	}
+	return nil
+}
+
+// checkInstanceExempt returns an error if instance is exempt by
+// exemptLabel, like checkExempt for disks.
+func checkInstanceExempt(instance *computepb.Instance, exemptLabel string) error {
+	if exemptLabel != "" && instance.GetLabels()[exemptLabel] == "true" {
+		return diskerr.New(diskerr.CodeExempt, "instance %s is exempt from cleanup by label %s", instance.GetName(), exemptLabel)
+	}
+	return nil
+}
+
+// instanceRequestID returns the request ID of op on instance, like requestID
+// for disks.
+func instanceRequestID(instance *computepb.Instance, op string) string {
+	return resourceRequestID(instance.GetId(), instance.GetCreationTimestamp(), op)
+}
+
+// eachInstance calls fn for every instance returned by ii and counts the
+// outcome in stats.
+func eachInstance(ii instanceIterator, stats *ResourceStats, opts InstanceOptions, fn func(*computepb.Instance) (Action, error)) error {
+	for {
+		instance, err := ii.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return diskerr.Wrap(diskerr.CodeIterator, err, "iterating instances")
+		}
+		action, err := fn(instance)
+		stats.count(instanceLogger(opts.ProjectID, instance), "instance", action, err)
+	}
+}
+
+// instanceLogger returns a logger that includes the location of instance in
+// every line.
+func instanceLogger(projectID string, instance *computepb.Instance) *zerolog.Logger {
+	l := log.With().
+		Str("projectID", projectID).
+		Str("zone", path.Base(instance.GetZone())).
+		Str("instance", instance.GetName()).
+		Str("status", instance.GetStatus()).
+		Logger()
+	return &l
+}
@@ -0,0 +1,209 @@
+package cleanup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func Test_Instances(t *testing.T) {
+	t.Parallel()
+
+	old := time.Now().Add(-90 * 24 * time.Hour).Format(time.RFC3339)
+	recent := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	instance := func(name, status, stopped string) *computepb.Instance {
+		i := &computepb.Instance{
+			Name:              pointer.String(name),
+			Zone:              pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-central1-a"),
+			Status:            pointer.String(status),
+			CreationTimestamp: pointer.String(old),
+			Disks: []*computepb.AttachedDisk{
+				{Boot: pointer.Bool(true), Source: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-central1-a/disks/" + name)},
+				{Source: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-central1-a/disks/" + name + "-home")},
+			},
+		}
+		if status == "SUSPENDED" {
+			i.LastSuspendedTimestamp = pointer.String(stopped)
+		} else {
+			i.LastStopTimestamp = pointer.String(stopped)
+		}
+		return i
+	}
+	iter := func(instances ...*computepb.Instance) instanceIterator {
+		return &instanceIteratorMock{
+			NextFunc: func() (*computepb.Instance, error) {
+				if len(instances) == 0 {
+					return nil, iterator.Done
+				}
+				i := instances[0]
+				instances = instances[1:]
+				return i, nil
+			},
+		}
+	}
+	key := func(name string) string {
+		return "projects/testing/zones/us-central1-a/instances/" + name
+	}
+
+	t.Run("mark", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{
+			key("running"): "2020-01-01",
+			key("marked"):  "2020-01-01",
+			key("gone"):    "2020-01-01",
+			"projects/other/zones/us-central1-a/instances/gone": "2020-01-01",
+		}
+		exempt := instance("exempt", "TERMINATED", old)
+		exempt.Labels = map[string]string{DefaultExemptLabel: "true"}
+		c := NewInstanceCleaner(&instancesClientMock{}, &disksClientMock{})
+		stats, err := c.markAll(context.Background(), iter(
+			instance("stopped", "TERMINATED", old),
+			instance("suspended", "SUSPENDED", old),
+			instance("new", "TERMINATED", recent),
+			instance("running", "RUNNING", old),
+			instance("marked", "TERMINATED", old),
+			exempt,
+		), InstanceOptions{ProjectID: "testing", Cutoff: 30 * 24 * time.Hour, ExemptLabel: DefaultExemptLabel, Marks: marks})
+		require.NoError(t, err)
+		require.Equal(t, ResourceStats{Stats: Stats{Scanned: 6}, Marked: 2, Unmarked: 1}, stats)
+		require.Equal(t, ResourceMarks{
+			key("stopped"):   markValue(time.Now()),
+			key("suspended"): markValue(time.Now()),
+			key("marked"):    "2020-01-01",
+			"projects/other/zones/us-central1-a/instances/gone": "2020-01-01",
+		}, marks)
+	})
+
+	t.Run("mark dry run", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{key("gone"): "2020-01-01"}
+		c := NewInstanceCleaner(&instancesClientMock{}, &disksClientMock{})
+		stats, err := c.markAll(context.Background(), iter(instance("stopped", "TERMINATED", old)), InstanceOptions{ProjectID: "testing", Marks: marks, DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.Marked)
+		require.Equal(t, ResourceMarks{key("gone"): "2020-01-01"}, marks)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{
+			key("marked"):  "2020-01-01",
+			key("running"): "2020-01-01",
+			key("grace"):   markValue(time.Now()),
+		}
+		client := &instancesClientMock{
+			DeleteFunc: func(context.Context, *computepb.DeleteInstanceRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		disks := &disksClientMock{
+			CreateSnapshotFunc: func(context.Context, *computepb.CreateSnapshotDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				// taken by an earlier run
+				return nil, &googleapi.Error{Code: http.StatusConflict}
+			},
+		}
+		c := NewInstanceCleaner(client, disks)
+		stats, err := c.cleanupAll(context.Background(), iter(
+			instance("marked", "TERMINATED", old),
+			instance("unmarked", "TERMINATED", old),
+			instance("running", "RUNNING", old),
+			instance("grace", "TERMINATED", old),
+		), InstanceOptions{ProjectID: "testing", GracePeriod: 7 * 24 * time.Hour, SnapshotBootDisk: true, Marks: marks})
+		require.NoError(t, err)
+		require.Equal(t, ResourceStats{Stats: Stats{Scanned: 4}, Deleted: 1}, stats)
+		require.Len(t, disks.CreateSnapshotCalls(), 1)
+		snapshot := disks.CreateSnapshotCalls()[0].CreateSnapshotDiskRequest
+		require.Equal(t, "marked", snapshot.GetDisk())
+		require.Equal(t, "us-central1-a", snapshot.GetZone())
+		require.Equal(t, CreatedBy, snapshot.GetSnapshotResource().GetLabels()[LabelCreatedBy])
+		require.Len(t, client.DeleteCalls(), 1)
+		req := client.DeleteCalls()[0].DeleteInstanceRequest
+		require.Equal(t, "marked", req.GetInstance())
+		require.Equal(t, "us-central1-a", req.GetZone())
+		require.NotEmpty(t, req.GetRequestId())
+		require.NotContains(t, marks, key("marked"))
+		require.Contains(t, marks, key("running"))
+	})
+
+	t.Run("snapshot fails", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{key("marked"): "2020-01-01"}
+		client := &instancesClientMock{}
+		disks := &disksClientMock{
+			CreateSnapshotFunc: func(context.Context, *computepb.CreateSnapshotDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, &googleapi.Error{Code: http.StatusForbidden}
+			},
+		}
+		c := NewInstanceCleaner(client, disks)
+		stats, err := c.cleanupAll(context.Background(), iter(instance("marked", "TERMINATED", old)), InstanceOptions{ProjectID: "testing", SnapshotBootDisk: true, Marks: marks})
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.Failed)
+		require.Empty(t, client.DeleteCalls())
+		require.Contains(t, marks, key("marked"))
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{
+			key("suspended"): "2020-01-01",
+			key("stopped"):   "2020-01-01",
+		}
+		client := &instancesClientMock{
+			StopFunc: func(context.Context, *computepb.StopInstanceRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		c := NewInstanceCleaner(client, &disksClientMock{})
+		stats, err := c.cleanupAll(context.Background(), iter(
+			instance("suspended", "SUSPENDED", old),
+			instance("stopped", "TERMINATED", old),
+		), InstanceOptions{ProjectID: "testing", Action: InstanceStop, Marks: marks})
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.Deleted)
+		require.Len(t, client.StopCalls(), 1)
+		require.Equal(t, "suspended", client.StopCalls()[0].StopInstanceRequest.GetInstance())
+		require.Equal(t, ResourceMarks{key("stopped"): "2020-01-01"}, marks)
+	})
+
+	t.Run("delete dry run", func(t *testing.T) {
+		t.Parallel()
+
+		marks := ResourceMarks{key("marked"): "2020-01-01"}
+		client := &instancesClientMock{}
+		disks := &disksClientMock{}
+		c := NewInstanceCleaner(client, disks)
+		stats, err := c.cleanupAll(context.Background(), iter(instance("marked", "TERMINATED", old)), InstanceOptions{ProjectID: "testing", SnapshotBootDisk: true, Marks: marks, DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.Deleted)
+		require.Empty(t, client.DeleteCalls())
+		require.Empty(t, disks.CreateSnapshotCalls())
+		require.Contains(t, marks, key("marked"))
+	})
+}
+
+func Test_ParseInstanceAction(t *testing.T) {
+	t.Parallel()
+
+	action, err := ParseInstanceAction("stop")
+	require.NoError(t, err)
+	require.Equal(t, InstanceStop, action)
+	_, err = ParseInstanceAction("reset")
+	require.EqualError(t, err, `unknown instance action "reset", expected delete or stop`)
+	require.Equal(t, diskerr.CodeExempt, diskerr.CodeOf(checkInstanceExempt(&computepb.Instance{Labels: map[string]string{"keep": "true"}}, "keep")))
+}
@@ -0,0 +1,135 @@
+package cleanup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// MaxLabels is the maximum number of labels GCE allows on a single disk.
+const MaxLabels = 64
+
+// maxLabelValue is the maximum length of a GCE label value, in characters.
+const maxLabelValue = 63
+
+// labelTimeLayout is the layout of LabelTime, e.g. 20240501t120000z, as the
+// colons and upper case letters of RFC 3339 are not allowed in label values.
+const labelTimeLayout = "20060102t150405z"
+
+// LabelTime returns t as a valid label value, e.g. 20240501t120000z for
+// 2024-05-01T12:00:00Z.
+func LabelTime(t time.Time) string {
+	return t.UTC().Format(labelTimeLayout)
+}
+
+// ParseLabelTime parses value, a time written by LabelTime.
+func ParseLabelTime(value string) (time.Time, error) {
+	t, err := time.Parse(labelTimeLayout, value)
+	if err != nil {
+		return time.Time{}, xerrors.Errorf("parse label time %q: %w", value, err)
+	}
+	return t, nil
+}
+
+// ValidLabelValue turns value into a valid GCE label value: lower case
+// letters, digits, underscores and hyphens, at most 63 characters long.
+// Other characters are replaced by hyphens, and truncated values end in the
+// hash of the full one, so that they stay distinct. Valid values are
+// returned as is.
+func ValidLabelValue(value string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(value) {
+		if unicode.IsLower(r) || unicode.IsDigit(r) || r == '_' || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	valid := b.String()
+	if utf8.RuneCountInString(valid) > maxLabelValue {
+		sum := sha256.Sum256([]byte(value))
+		valid = string([]rune(valid)[:maxLabelValue-9]) + "-" + hex.EncodeToString(sum[:4])
+	}
+	return valid
+}
+
+// validLabels returns a copy of labels with every value made valid by
+// ValidLabelValue.
+func validLabels(labels map[string]string) map[string]string {
+	valid := make(map[string]string, len(labels))
+	for k, v := range labels {
+		valid[k] = ValidLabelValue(v)
+	}
+	return valid
+}
+
+// LabelBudgetPolicy decides what happens when writing a label would exceed
+// MaxLabels.
+type LabelBudgetPolicy string
+
+const (
+	// LabelBudgetSkip leaves the disk untouched and reports
+	// diskerr.ErrLabelBudgetExhausted.
+	LabelBudgetSkip LabelBudgetPolicy = "skip"
+	// LabelBudgetEvict removes stale labels owned by this tool to make room,
+	// and skips the disk if that is not enough.
+	LabelBudgetEvict LabelBudgetPolicy = "evict"
+)
+
+// ParseLabelBudgetPolicy validates s as a LabelBudgetPolicy.
+func ParseLabelBudgetPolicy(s string) (LabelBudgetPolicy, error) {
+	switch p := LabelBudgetPolicy(s); p {
+	case LabelBudgetSkip, LabelBudgetEvict:
+		return p, nil
+	}
+	return "", xerrors.Errorf("unknown label budget policy %q", s)
+}
+
+// ownedLabels are the label keys written by this tool. Only these are ever
+// evicted to make room for another label.
+var ownedLabels = []string{
+	LabelMarkedForDeletion,
+	LabelSnapshotComplete,
+}
+
+// withLabel returns a copy of the disk labels with k set to v, made valid by
+// ValidLabelValue, applying policy if the result would exceed MaxLabels.
+func withLabel(disk *computepb.Disk, k, v string, policy LabelBudgetPolicy) (map[string]string, error) {
+	labels := make(map[string]string, len(disk.GetLabels())+1)
+	for lk, lv := range disk.GetLabels() {
+		labels[lk] = lv
+	}
+	labels[k] = ValidLabelValue(v)
+	if len(labels) <= MaxLabels {
+		return labels, nil
+	}
+
+	if policy == LabelBudgetEvict {
+		stale := make([]string, 0, len(ownedLabels))
+		for _, owned := range ownedLabels {
+			if _, found := labels[owned]; found && owned != k {
+				stale = append(stale, owned)
+			}
+		}
+		sort.Strings(stale)
+		for _, owned := range stale {
+			if len(labels) <= MaxLabels {
+				break
+			}
+			delete(labels, owned)
+		}
+		if len(labels) <= MaxLabels {
+			return labels, nil
+		}
+	}
+	return nil, diskerr.New(diskerr.CodeLabelBudgetExhausted, "disk %s: setting label %s would exceed the limit of %d labels", disk.GetName(), k, MaxLabels)
+}
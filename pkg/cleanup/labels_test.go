@@ -0,0 +1,121 @@
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func Test_WithLabel(t *testing.T) {
+	t.Parallel()
+
+	fullDisk := func(extra map[string]string) *computepb.Disk {
+		labels := make(map[string]string, MaxLabels)
+		for k, v := range extra {
+			labels[k] = v
+		}
+		for i := 0; len(labels) < MaxLabels; i++ {
+			labels[fmt.Sprintf("label-%d", i)] = "value"
+		}
+		return &computepb.Disk{Name: pointer.String("test-disk"), Labels: labels}
+	}
+
+	t.Run("fits", func(t *testing.T) {
+		t.Parallel()
+		disk := &computepb.Disk{Labels: map[string]string{"foo": "bar"}}
+		labels, err := withLabel(disk, LabelMarkedForDeletion, "true", LabelBudgetSkip)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"foo": "bar", LabelMarkedForDeletion: "true"}, labels)
+		require.Len(t, disk.GetLabels(), 1, "disk labels must not be modified")
+	})
+
+	t.Run("overwrite when full", func(t *testing.T) {
+		t.Parallel()
+		disk := fullDisk(map[string]string{LabelMarkedForDeletion: "true"})
+		labels, err := withLabel(disk, LabelMarkedForDeletion, "false", LabelBudgetSkip)
+		require.NoError(t, err)
+		require.Len(t, labels, MaxLabels)
+	})
+
+	t.Run("skip when full", func(t *testing.T) {
+		t.Parallel()
+		_, err := withLabel(fullDisk(nil), LabelMarkedForDeletion, "true", LabelBudgetSkip)
+		require.True(t, errors.Is(err, diskerr.ErrLabelBudgetExhausted))
+		require.EqualError(t, err, "disk test-disk: setting label marked-for-deletion would exceed the limit of 64 labels")
+	})
+
+	t.Run("evict owned label", func(t *testing.T) {
+		t.Parallel()
+		disk := fullDisk(map[string]string{LabelMarkedForDeletion: "false"})
+		labels, err := withLabel(disk, "other", "true", LabelBudgetEvict)
+		require.NoError(t, err)
+		require.Len(t, labels, MaxLabels)
+		require.NotContains(t, labels, LabelMarkedForDeletion)
+		require.Equal(t, "true", labels["other"])
+	})
+
+	t.Run("evict without owned labels", func(t *testing.T) {
+		t.Parallel()
+		_, err := withLabel(fullDisk(nil), LabelMarkedForDeletion, "true", LabelBudgetEvict)
+		require.True(t, errors.Is(err, diskerr.ErrLabelBudgetExhausted))
+	})
+}
+
+func Test_ParseLabelBudgetPolicy(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParseLabelBudgetPolicy("evict")
+	require.NoError(t, err)
+	require.Equal(t, LabelBudgetEvict, p)
+
+	_, err = ParseLabelBudgetPolicy("description")
+	require.EqualError(t, err, `unknown label budget policy "description"`)
+}
+
+func Test_ValidLabelValue(t *testing.T) {
+	t.Parallel()
+
+	for value, expected := range map[string]string{
+		"":                     "",
+		"pd-balanced":          "pd-balanced",
+		"under_score":          "under_score",
+		"2022-03-01":           "2022-03-01",
+		"2022-03-01T12:00:00Z": "2022-03-01t12-00-00z",
+		"Team Storage":         "team-storage",
+		"été":                  "été",
+	} {
+		require.Equal(t, expected, ValidLabelValue(value), value)
+	}
+
+	long := ValidLabelValue(strings.Repeat("a", 70))
+	require.Len(t, long, 63)
+	require.NotEqual(t, long, ValidLabelValue(strings.Repeat("a", 71)), "truncated values must stay distinct")
+
+	labels, err := withLabel(&computepb.Disk{}, "source", "projects/p/zones/z/disks/d", LabelBudgetSkip)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"source": "projects-p-zones-z-disks-d"}, labels)
+}
+
+func Test_LabelTime(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.Equal(t, "20240501t120000z", LabelTime(at.In(time.FixedZone("CEST", 2*60*60))))
+	parsed, err := ParseLabelTime("20240501t120000z")
+	require.NoError(t, err)
+	require.Equal(t, at, parsed)
+	_, err = ParseLabelTime("2024-05-01T12:00:00Z")
+	require.Error(t, err)
+
+	markedAt, marked := parseMark(LabelTime(at))
+	require.True(t, marked)
+	require.Equal(t, at, markedAt)
+}
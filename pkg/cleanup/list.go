@@ -0,0 +1,527 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"google.golang.org/grpc/metadata"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+type disksScopedListPairIterator interface {
+	Next() (computev1.DisksScopedListPair, error)
+	PageInfo() *iterator.PageInfo
+}
+
+//go:generate moq -fmt goimports -out mock_disks_scoped_list_pair_iterator.go . disksScopedListPairIterator
+
+// pagedDiskIterator is a diskIterator that knows the token of the page it is
+// currently fetching.
+type pagedDiskIterator interface {
+	diskIterator
+	PageToken() string
+}
+
+//go:generate moq -fmt goimports -out mock_paged_disk_iterator.go . pagedDiskIterator
+
+// partialPageIterator is a pagedDiskIterator that can tell what its current
+// page lacks. Compute lists the disks it could reach, with warnings for the
+// zones it could not, rather than failing the page.
+type partialPageIterator interface {
+	pagedDiskIterator
+	// Unreachable returns the zones or regions missing from the page.
+	Unreachable() []string
+}
+
+//go:generate moq -fmt goimports -out mock_partial_page_iterator.go . partialPageIterator
+
+// cursorIterator is a diskIterator that can tell the page of the disk it
+// returned last.
+type cursorIterator interface {
+	diskIterator
+	// Cursor returns the cursor of the page holding the disk last returned
+	// by Next. Resuming from it lists that disk again, as well as those
+	// after it on the same page.
+	Cursor() Cursor
+}
+
+// Cursor identifies a page of a disk listing, so that a run can be resumed
+// from the page that failed.
+type Cursor struct {
+	// Zone is the zone being listed, empty for the aggregated list across
+	// all zones.
+	Zone      string
+	PageToken string
+	// Done holds the IDs of the disks of the page that were processed
+	// already. A run resumed from the cursor skips them.
+	Done []uint64
+}
+
+// String returns the cursor in the form zone:token, as accepted by
+// ParseCursor.
+func (c Cursor) String() string {
+	return c.Zone + ":" + c.PageToken
+}
+
+// ParseCursor parses a cursor of the form zone:token. The zone is empty for
+// the aggregated list across all zones.
+func ParseCursor(s string) (Cursor, error) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return Cursor{}, xerrors.Errorf("invalid cursor %q: expected zone:token", s)
+	}
+	return Cursor{Zone: s[:i], PageToken: s[i+1:]}, nil
+}
+
+// PageError is the cause of a diskerr.CodeIterator error when a page of
+// disks could not be fetched after all retries. Cursor can be passed back in
+// MarkOptions.Resume or CleanupOptions.Resume to continue from that page.
+type PageError struct {
+	Cursor Cursor
+	Err    error
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf("list disks page %s: %v", e.Cursor, e.Err)
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Err
+}
+
+// pageRetries is how often fetching a page is retried before giving up.
+const pageRetries = 5
+
+// MaxPageSize is the largest number of disks compute returns per page, and
+// the default.
+const MaxPageSize = 500
+
+// pageBackoff returns the backoff between retries of a page.
+func pageBackoff() gax.Backoff {
+	return gax.Backoff{Initial: time.Second, Max: 30 * time.Second, Multiplier: 2}
+}
+
+// diskFields are the fields of a disk that are read when processing it. Only
+// these are requested when listing disks, which shrinks the list responses
+// of large projects considerably.
+var diskFields = []string{
+	"id",
+	"name",
+	"description",
+	"sizeGb",
+	"type",
+	"zone",
+	"region",
+	"status",
+	"selfLink",
+	"users",
+	"labels",
+	"labelFingerprint",
+	"creationTimestamp",
+	"lastAttachTimestamp",
+	"lastDetachTimestamp",
+	"sourceImage",
+	"sourceSnapshot",
+	"sourceDisk",
+	"guestOsFeatures",
+}
+
+// fieldMaskHeader is the system parameter header selecting the fields of a
+// partial response.
+const fieldMaskHeader = "x-goog-fieldmask"
+
+// withFieldMask returns ctx requesting only diskFields of the disks listed in
+// items, the token of the next page and the fields of the response telling
+// what the page lacks.
+func withFieldMask(ctx context.Context, items string, partial ...string) context.Context {
+	fields := append([]string{"nextPageToken"}, partial...)
+	return metadata.AppendToOutgoingContext(ctx, fieldMaskHeader, fmt.Sprintf("%s,%s(%s)", strings.Join(fields, ","), items, strings.Join(diskFields, ",")))
+}
+
+// listDisks returns an iterator over all disks matching filter in the given
+// zones. If zones is empty, the aggregated list API is used to list disks
+// across every zone in the project. If resume is given, listing starts at
+// that page. Only diskFields are fetched unless allFields is set. Pages hold
+// up to pageSize disks, or MaxPageSize if 0.
+func listDisks(ctx context.Context, dc DisksClient, projectID string, zones []string, filter string, resume *Cursor, allFields bool, pageSize int) (diskIterator, error) {
+	listCtx := ctx
+	var maxResults *uint32
+	if pageSize > 0 {
+		size := uint32(pageSize)
+		maxResults = &size
+	}
+	if len(zones) == 0 {
+		if !allFields {
+			listCtx = withFieldMask(ctx, "items/*/disks", "unreachables", "items/*/warning")
+		}
+		var token string
+		if resume != nil {
+			if resume.Zone != "" {
+				return nil, xerrors.Errorf("cannot resume listing zone %s across all zones", resume.Zone)
+			}
+			token = resume.PageToken
+		}
+		return newRetryingDiskIterator(ctx, "", token, func(pageToken string) pagedDiskIterator {
+			pairs := dc.AggregatedList(listCtx, &computepb.AggregatedListDisksRequest{
+				Project:    projectID,
+				Filter:     &filter,
+				MaxResults: maxResults,
+				PageToken:  optionalToken(pageToken),
+			})
+			return &aggregatedDiskIterator{
+				pairs:    pairs,
+				response: func() interface{} { return pairs.Response },
+			}
+		}), nil
+	}
+	if resume != nil {
+		i := indexOf(zones, resume.Zone)
+		if i < 0 {
+			return nil, xerrors.Errorf("cannot resume listing zone %q: not one of %s", resume.Zone, strings.Join(zones, ", "))
+		}
+		// zones before the cursor were already listed
+		zones = zones[i:]
+	}
+	if !allFields {
+		listCtx = withFieldMask(ctx, "items", "warning")
+	}
+	its := make([]diskIterator, 0, len(zones))
+	for i, zone := range zones {
+		zone := zone
+		var token string
+		if resume != nil && i == 0 {
+			token = resume.PageToken
+		}
+		its = append(its, newRetryingDiskIterator(ctx, zone, token, func(pageToken string) pagedDiskIterator {
+			return &zonalDiskIterator{zone: zone, it: dc.List(listCtx, &computepb.ListDisksRequest{
+				Project:    projectID,
+				Zone:       zone,
+				Filter:     &filter,
+				MaxResults: maxResults,
+				PageToken:  optionalToken(pageToken),
+			})}
+		}))
+	}
+	return &multiDiskIterator{its: its}, nil
+}
+
+func optionalToken(token string) *string {
+	if token == "" {
+		return nil
+	}
+	return &token
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// retryingDiskIterator retries failed page fetches with exponential backoff.
+// The compute iterators keep returning the same error once a fetch failed,
+// so a retry starts a new listing at the token of the failed page. Disks of
+// earlier pages were all returned already, so none are repeated or skipped.
+// Pages lacking zones that could not be reached are retried the same way,
+// before any of their disks is returned, and used as they are once the
+// retries are exhausted, so that a zone that is down does not stop a run.
+type retryingDiskIterator struct {
+	ctx  context.Context
+	zone string
+	list func(pageToken string) pagedDiskIterator
+	it   pagedDiskIterator
+	// fetched reports whether it fetched a page yet.
+	fetched bool
+	// pageStart is the token of the page holding the disk returned last.
+	pageStart string
+	retries   int
+	backoff   func() gax.Backoff
+	sleep     func(context.Context, time.Duration) error
+}
+
+func newRetryingDiskIterator(ctx context.Context, zone, pageToken string, list func(pageToken string) pagedDiskIterator) *retryingDiskIterator {
+	return &retryingDiskIterator{
+		ctx:       ctx,
+		zone:      zone,
+		list:      list,
+		it:        list(pageToken),
+		pageStart: pageToken,
+		retries:   pageRetries,
+		backoff:   pageBackoff,
+		sleep:     gax.Sleep,
+	}
+}
+
+func (r *retryingDiskIterator) Cursor() Cursor {
+	return Cursor{Zone: r.zone, PageToken: r.pageStart}
+}
+
+func (r *retryingDiskIterator) Next() (*computepb.Disk, error) {
+	backoff := r.backoff()
+	for attempt := 1; ; attempt++ {
+		// the token moves on to the next page whenever a page is fetched
+		before := r.it.PageToken()
+		disk, err := r.it.Next()
+		if err == nil && (!r.fetched || r.it.PageToken() != before) {
+			r.fetched = true
+			// if empty pages were skipped, this is an earlier page, which
+			// is safe to resume from
+			r.pageStart = before
+			if unreachable := r.unreachable(); len(unreachable) > 0 {
+				cursor := Cursor{Zone: r.zone, PageToken: before}
+				if attempt > r.retries || r.ctx.Err() != nil {
+					log.Warn().Strs("unreachable", unreachable).Str("cursor", cursor.String()).Msg("listing disks without unreachable zones")
+					return disk, nil
+				}
+				pause := backoff.Pause()
+				log.Warn().Strs("unreachable", unreachable).Str("cursor", cursor.String()).Int("attempt", attempt).Dur("backoff", pause).Msg("retrying partial disk list page")
+				if err := r.sleep(r.ctx, pause); err != nil {
+					return nil, &PageError{Cursor: cursor, Err: err}
+				}
+				r.it, r.fetched = r.list(before), false
+				continue
+			}
+		}
+		if err == nil || err == iterator.Done {
+			return disk, err
+		}
+		cursor := Cursor{Zone: r.zone, PageToken: r.it.PageToken()}
+		if attempt > r.retries || r.ctx.Err() != nil {
+			return nil, &PageError{Cursor: cursor, Err: err}
+		}
+		pause := backoff.Pause()
+		log.Warn().Err(err).Str("cursor", cursor.String()).Int("attempt", attempt).Dur("backoff", pause).Msg("retrying disk list page")
+		if err := r.sleep(r.ctx, pause); err != nil {
+			return nil, &PageError{Cursor: cursor, Err: err}
+		}
+		r.it = r.list(cursor.PageToken)
+	}
+}
+
+// unreachable returns the zones missing from the current page, if the
+// iterator can tell.
+func (r *retryingDiskIterator) unreachable() []string {
+	if it, ok := r.it.(partialPageIterator); ok {
+		return it.Unreachable()
+	}
+	return nil
+}
+
+// unreachableWarning returns the zone or region of warning if it tells that
+// compute could not reach it, e.g. during an outage, and false otherwise.
+func unreachableWarning(scope string, warning *computepb.Warning) (string, bool) {
+	if warning.GetCode() != computepb.Warning_UNREACHABLE.String() {
+		return "", false
+	}
+	for _, data := range warning.GetData() {
+		if data.GetKey() == "scope" {
+			return data.GetValue(), true
+		}
+	}
+	return scope, true
+}
+
+// zonalDiskIterator adapts the compute disk iterator to pagedDiskIterator.
+type zonalDiskIterator struct {
+	zone string
+	it   *computev1.DiskIterator
+}
+
+func (z *zonalDiskIterator) Next() (*computepb.Disk, error) {
+	return z.it.Next()
+}
+
+func (z *zonalDiskIterator) PageToken() string {
+	return z.it.PageInfo().Token
+}
+
+func (z *zonalDiskIterator) Unreachable() []string {
+	list, _ := z.it.Response.(*computepb.DiskList)
+	if scope, ok := unreachableWarning(z.zone, list.GetWarning()); ok {
+		return []string{scope}
+	}
+	return nil
+}
+
+// multiDiskIterator iterates over each of its iterators in turn.
+type multiDiskIterator struct {
+	its []diskIterator
+}
+
+func (m *multiDiskIterator) Next() (*computepb.Disk, error) {
+	for len(m.its) > 0 {
+		disk, err := m.its[0].Next()
+		if err == iterator.Done {
+			m.its = m.its[1:]
+			continue
+		}
+		return disk, err
+	}
+	return nil, iterator.Done
+}
+
+func (m *multiDiskIterator) Cursor() Cursor {
+	if len(m.its) == 0 {
+		return Cursor{}
+	}
+	if it, ok := m.its[0].(cursorIterator); ok {
+		return it.Cursor()
+	}
+	return Cursor{}
+}
+
+// aggregatedDiskIterator flattens the per-zone scoped lists returned by the
+// aggregated list API into a single stream of disks.
+type aggregatedDiskIterator struct {
+	pairs disksScopedListPairIterator
+	// response returns the raw response of the current page, a
+	// *computepb.DiskAggregatedList. Nil if unknown.
+	response func() interface{}
+	buf      []*computepb.Disk
+}
+
+func (a *aggregatedDiskIterator) Next() (*computepb.Disk, error) {
+	for len(a.buf) == 0 {
+		pair, err := a.pairs.Next()
+		if err != nil {
+			return nil, err
+		}
+		// scopes without any disks only carry a warning
+		a.buf = pair.Value.GetDisks()
+	}
+	disk := a.buf[0]
+	a.buf = a.buf[1:]
+	return disk, nil
+}
+
+func (a *aggregatedDiskIterator) PageToken() string {
+	return a.pairs.PageInfo().Token
+}
+
+func (a *aggregatedDiskIterator) Unreachable() []string {
+	if a.response == nil {
+		return nil
+	}
+	list, _ := a.response().(*computepb.DiskAggregatedList)
+	unreachable := append([]string(nil), list.GetUnreachables()...)
+	for key, scoped := range list.GetItems() {
+		if scope, ok := unreachableWarning(key, scoped.GetWarning()); ok {
+			unreachable = append(unreachable, scope)
+		}
+	}
+	sort.Strings(unreachable)
+	return unreachable
+}
+
+// zoneOf returns the name of the zone disk lives in, taken from its zone or
+// else its self link, or "" if the disk reports neither.
+func zoneOf(disk *computepb.Disk) string {
+	// both are URLs, e.g. https://www.googleapis.com/compute/v1/projects/p/zones/us-east1-a
+	if disk.GetZone() != "" {
+		return path.Base(disk.GetZone())
+	}
+	parts := strings.Split(disk.GetSelfLink(), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "zones" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+// ListMarked calls fn for every disk of projectID and tenant that is marked
+// for deletion and selected, in zones or all zones if nil, with the zone of
+// the disk. It stops at the first error returned by fn.
+func ListMarked(ctx context.Context, client DisksClient, projectID string, zones []string, tenant Tenant, selector Selector, fn func(disk *computepb.Disk, zone string) error) error {
+	diskIter, err := listDisks(ctx, client, projectID, zones, tenant.filter(markedFilter), nil, false, 0)
+	if err != nil {
+		return err
+	}
+	return listMarked(selectDisks(diskIter, selector), zones, tenant, fn)
+}
+
+func listMarked(diskIter diskIterator, zones []string, tenant Tenant, fn func(disk *computepb.Disk, zone string) error) error {
+	return listMatching(diskIter, zones, tenant, func(disk *computepb.Disk) bool {
+		_, marked := MarkedAt(disk)
+		return marked
+	}, fn)
+}
+
+// ListNamed calls fn for every disk of projectID and tenant named name, in
+// zones or all zones if nil, with the zone of the disk. Names are only unique
+// within a zone, so there may be several. It stops at the first error
+// returned by fn.
+func ListNamed(ctx context.Context, client DisksClient, projectID string, zones []string, tenant Tenant, name string, fn func(disk *computepb.Disk, zone string) error) error {
+	diskIter, err := listDisks(ctx, client, projectID, zones, tenant.filter(fmt.Sprintf(`name = "%s"`, name)), nil, false, 0)
+	if err != nil {
+		return err
+	}
+	return listMatching(diskIter, zones, tenant, func(disk *computepb.Disk) bool {
+		return disk.GetName() == name
+	}, fn)
+}
+
+// listMatching calls fn for every disk returned by diskIter that matches,
+// after checking that it belongs to tenant.
+func listMatching(diskIter diskIterator, zones []string, tenant Tenant, match func(disk *computepb.Disk) bool, fn func(disk *computepb.Disk, zone string) error) error {
+	for {
+		disk, err := diskIter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return diskerr.Wrap(diskerr.CodeIterator, err, "iterating disks")
+		}
+		if !match(disk) {
+			continue
+		}
+		if err := tenant.check("disk "+disk.GetName(), disk.GetLabels()); err != nil {
+			return err
+		}
+		if err := fn(disk, diskZone(disk, zones)); err != nil {
+			return err
+		}
+	}
+}
+
+// diskZone returns the zone to send requests for disk to. It is derived from
+// the disk itself; only disks that do not report their zone fall back to the
+// requested zone, which is unambiguous only when a single zone was listed.
+func diskZone(disk *computepb.Disk, zones []string) string {
+	if zone := zoneOf(disk); zone != "" {
+		return zone
+	}
+	if len(zones) == 1 {
+		return zones[0]
+	}
+	return ""
+}
+
+// checkZone guards against sending a request for disk to zone, unless that is
+// the zone the disk lives in and, if zones were requested, one of them.
+func checkZone(disk *computepb.Disk, zone string, zones []string) error {
+	if zone == "" {
+		return diskerr.New(diskerr.CodeZoneMismatch, "disk %s does not report its zone", disk.GetName())
+	}
+	if actual := zoneOf(disk); actual != "" && actual != zone {
+		return diskerr.New(diskerr.CodeZoneMismatch, "disk %s is in zone %s, not %s", disk.GetName(), actual, zone)
+	}
+	if len(zones) > 0 && indexOf(zones, zone) < 0 {
+		return diskerr.New(diskerr.CodeZoneMismatch, "disk %s is in zone %s, which was not requested: %s", disk.GetName(), zone, strings.Join(zones, ", "))
+	}
+	return nil
+}
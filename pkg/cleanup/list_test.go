@@ -0,0 +1,467 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"google.golang.org/grpc/metadata"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_MultiDiskIterator(t *testing.T) {
+	t.Parallel()
+
+	sliceIter := func(names ...string) diskIterator {
+		return &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				if len(names) == 0 {
+					return nil, iterator.Done
+				}
+				disk := &computepb.Disk{Name: pointer.String(names[0])}
+				names = names[1:]
+				return disk, nil
+			},
+		}
+	}
+
+	it := &multiDiskIterator{its: []diskIterator{sliceIter("a", "b"), sliceIter(), sliceIter("c")}}
+	var names []string
+	for {
+		disk, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, disk.GetName())
+	}
+	require.Equal(t, []string{"a", "b", "c"}, names)
+}
+
+func Test_AggregatedDiskIterator(t *testing.T) {
+	t.Parallel()
+
+	pairs := []computev1.DisksScopedListPair{
+		{Key: "zones/us-east1-a", Value: &computepb.DisksScopedList{Disks: []*computepb.Disk{{Name: pointer.String("a")}}}},
+		{Key: "zones/us-east1-b", Value: &computepb.DisksScopedList{}},
+		{Key: "zones/us-east1-c", Value: &computepb.DisksScopedList{Disks: []*computepb.Disk{{Name: pointer.String("b")}, {Name: pointer.String("c")}}}},
+	}
+	it := &aggregatedDiskIterator{
+		pairs: &disksScopedListPairIteratorMock{
+			NextFunc: func() (computev1.DisksScopedListPair, error) {
+				if len(pairs) == 0 {
+					return computev1.DisksScopedListPair{}, iterator.Done
+				}
+				pair := pairs[0]
+				pairs = pairs[1:]
+				return pair, nil
+			},
+		},
+	}
+	var names []string
+	for {
+		disk, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, disk.GetName())
+	}
+	require.Equal(t, []string{"a", "b", "c"}, names)
+	require.Empty(t, it.Unreachable())
+
+	it.response = func() interface{} {
+		return &computepb.DiskAggregatedList{
+			Unreachables: []string{"zones/us-west1-b"},
+			Items: map[string]*computepb.DisksScopedList{
+				"zones/us-east1-a": {Warning: &computepb.Warning{Code: pointer.String(computepb.Warning_NO_RESULTS_ON_PAGE.String())}},
+				"zones/us-west1-a": {Warning: &computepb.Warning{Code: pointer.String(computepb.Warning_UNREACHABLE.String())}},
+			},
+		}
+	}
+	require.Equal(t, []string{"zones/us-west1-a", "zones/us-west1-b"}, it.Unreachable())
+}
+
+func Test_ListRegionalDisks(t *testing.T) {
+	t.Parallel()
+
+	old := time.Now().Add(-90 * 24 * time.Hour).Format(time.RFC3339)
+	disks := func() diskIterator {
+		pairs := []computev1.DisksScopedListPair{
+			{Key: "zones/us-east1-b", Value: &computepb.DisksScopedList{Disks: []*computepb.Disk{{
+				Name:                pointer.String("zonal"),
+				Zone:                pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b"),
+				LastDetachTimestamp: pointer.String(old),
+				Labels:              map[string]string{LabelMarkedForDeletion: "2022-03-01"},
+			}}}},
+			{Key: "regions/us-east1", Value: &computepb.DisksScopedList{Disks: []*computepb.Disk{{
+				Name:                pointer.String("regional"),
+				Region:              pointer.String("https://www.googleapis.com/compute/v1/projects/testing/regions/us-east1"),
+				ReplicaZones:        []string{"https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b", "https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-c"},
+				LastDetachTimestamp: pointer.String(old),
+				Labels:              map[string]string{LabelMarkedForDeletion: "2022-03-01"},
+			}}}},
+		}
+		return &aggregatedDiskIterator{pairs: &disksScopedListPairIteratorMock{
+			NextFunc: func() (computev1.DisksScopedListPair, error) {
+				if len(pairs) == 0 {
+					return computev1.DisksScopedListPair{}, iterator.Done
+				}
+				pair := pairs[0]
+				pairs = pairs[1:]
+				return pair, nil
+			},
+		}}
+	}
+	bus := events.NewBus()
+	var processed []string
+	bus.Subscribe(func(e events.Event) {
+		processed = append(processed, fmt.Sprintf("%s %s %s %s", e.Disk.GetName(), e.Zone, e.Action, diskerr.CodeOf(e.Err)))
+		if e.Disk.GetName() == "regional" {
+			require.False(t, IsFailure(e.Err))
+		}
+	}, events.DiskProcessed)
+
+	stats, err := NewMarker(&disksClientMock{}, bus).markAll(context.Background(), disks(), MarkOptions{ProjectID: "testing", Cutoff: 30 * 24 * time.Hour, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, Stats{Scanned: 2}, stats)
+	require.Equal(t, []string{"zonal us-east1-b SKIP ALREADY_MARKED", "regional  SKIP REGIONAL"}, processed)
+
+	processed = nil
+	stats, err = NewCleaner(&disksClientMock{}, bus).cleanupAll(context.Background(), disks(), CleanupOptions{ProjectID: "testing", DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, Stats{Scanned: 2}, stats)
+	require.Equal(t, []string{"zonal us-east1-b DELETE DRY_RUN", "regional  SKIP REGIONAL"}, processed)
+
+	counts, err := countMarked(disks(), nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]zoneCount{"us-east1-b": {Disks: 1, Marked: 1}}, counts)
+}
+
+func Test_DiskZone(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "us-east1-a", diskZone(&computepb.Disk{}, []string{"us-east1-a"}))
+	require.Equal(t, "", diskZone(&computepb.Disk{}, []string{"us-east1-a", "us-east1-b"}))
+	require.Equal(t, "us-east1-b", diskZone(&computepb.Disk{
+		Zone: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b"),
+	}, []string{"us-east1-a"}))
+	require.Equal(t, "us-east1-c", diskZone(&computepb.Disk{
+		SelfLink: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-c/disks/test-disk"),
+	}, nil))
+}
+
+func Test_CheckZone(t *testing.T) {
+	t.Parallel()
+
+	disk := &computepb.Disk{
+		Name: pointer.String("test-disk"),
+		Zone: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b"),
+	}
+	require.NoError(t, checkZone(disk, "us-east1-b", nil))
+	require.NoError(t, checkZone(disk, "us-east1-b", []string{"us-east1-a", "us-east1-b"}))
+	require.NoError(t, checkZone(&computepb.Disk{}, "us-east1-b", []string{"us-east1-b"}))
+
+	err := checkZone(disk, "us-east1-a", nil)
+	require.EqualError(t, err, "disk test-disk is in zone us-east1-b, not us-east1-a")
+	require.Equal(t, diskerr.CodeZoneMismatch, diskerr.CodeOf(err))
+	require.EqualError(t, checkZone(disk, "us-east1-b", []string{"us-east1-a"}), "disk test-disk is in zone us-east1-b, which was not requested: us-east1-a")
+	require.EqualError(t, checkZone(disk, "", nil), "disk test-disk does not report its zone")
+}
+
+func Test_RetryingDiskIterator(t *testing.T) {
+	t.Parallel()
+
+	// pages maps a page token to the disks on that page and the next token
+	type page struct {
+		names []string
+		next  string
+	}
+	pages := map[string]page{
+		"":   {names: []string{"a", "b"}, next: "p2"},
+		"p2": {names: []string{"c"}},
+	}
+
+	// listPages returns a list func whose page p2 fails the first failures times
+	listPages := func(failures int) (func(string) pagedDiskIterator, *[]string) {
+		var calls []string
+		return func(token string) pagedDiskIterator {
+			calls = append(calls, token)
+			var buf []string
+			var fetchErr error
+			fetched := false
+			return &pagedDiskIteratorMock{
+				NextFunc: func() (*computepb.Disk, error) {
+					if fetchErr != nil {
+						return nil, fetchErr
+					}
+					for len(buf) == 0 {
+						if fetched && token == "" {
+							return nil, iterator.Done
+						}
+						if token == "p2" && failures > 0 {
+							failures--
+							fetchErr = xerrors.Errorf("backend unavailable")
+							return nil, fetchErr
+						}
+						p := pages[token]
+						buf, fetched = p.names, true
+						token = p.next
+					}
+					disk := &computepb.Disk{Name: pointer.String(buf[0])}
+					buf = buf[1:]
+					return disk, nil
+				},
+				PageTokenFunc: func() string {
+					return token
+				},
+			}
+		}, &calls
+	}
+
+	collect := func(it diskIterator) ([]string, error) {
+		var names []string
+		for {
+			disk, err := it.Next()
+			if err == iterator.Done {
+				return names, nil
+			}
+			if err != nil {
+				return names, err
+			}
+			names = append(names, disk.GetName())
+		}
+	}
+
+	newIter := func(list func(string) pagedDiskIterator, sleeps *int) *retryingDiskIterator {
+		it := newRetryingDiskIterator(context.Background(), "us-east1-b", "", list)
+		it.sleep = func(context.Context, time.Duration) error {
+			*sleeps++
+			return nil
+		}
+		return it
+	}
+
+	t.Run("transient page error", func(t *testing.T) {
+		t.Parallel()
+		list, calls := listPages(2)
+		var sleeps int
+		names, err := collect(newIter(list, &sleeps))
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b", "c"}, names)
+		require.Equal(t, []string{"", "p2", "p2"}, *calls)
+		require.Equal(t, 2, sleeps)
+	})
+
+	t.Run("cursor", func(t *testing.T) {
+		t.Parallel()
+		list, _ := listPages(0)
+		var sleeps int
+		it := newIter(list, &sleeps)
+		var cursors []string
+		for {
+			if _, err := it.Next(); err != nil {
+				require.Equal(t, iterator.Done, err)
+				break
+			}
+			cursors = append(cursors, it.Cursor().String())
+		}
+		require.Equal(t, []string{"us-east1-b:", "us-east1-b:", "us-east1-b:p2"}, cursors)
+	})
+
+	// listPartial returns a list func whose page p2, holding c, lacks a zone
+	// the first partial times
+	listPartial := func(partial int) (func(string) pagedDiskIterator, *[]string) {
+		list, calls := listPages(0)
+		return func(token string) pagedDiskIterator {
+			it := list(token)
+			var last string
+			return &partialPageIteratorMock{
+				NextFunc: func() (*computepb.Disk, error) {
+					disk, err := it.Next()
+					last = disk.GetName()
+					return disk, err
+				},
+				PageTokenFunc: it.PageToken,
+				UnreachableFunc: func() []string {
+					if last == "c" && partial > 0 {
+						partial--
+						return []string{"us-east1-c"}
+					}
+					return nil
+				},
+			}
+		}, calls
+	}
+
+	t.Run("partial page", func(t *testing.T) {
+		t.Parallel()
+		list, calls := listPartial(1)
+		var sleeps int
+		names, err := collect(newIter(list, &sleeps))
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b", "c"}, names)
+		require.Equal(t, []string{"", "p2"}, *calls)
+		require.Equal(t, 1, sleeps)
+	})
+
+	t.Run("persistently partial page", func(t *testing.T) {
+		t.Parallel()
+		list, calls := listPartial(pageRetries + 1)
+		var sleeps int
+		names, err := collect(newIter(list, &sleeps))
+		require.NoError(t, err, "a partial page is used once the retries are exhausted")
+		require.Equal(t, []string{"a", "b", "c"}, names)
+		require.Len(t, *calls, pageRetries+1)
+		require.Equal(t, pageRetries, sleeps)
+	})
+
+	t.Run("persistent page error", func(t *testing.T) {
+		t.Parallel()
+		list, calls := listPages(pageRetries + 1)
+		var sleeps int
+		names, err := collect(newIter(list, &sleeps))
+		require.Equal(t, []string{"a", "b"}, names)
+		var pageErr *PageError
+		require.True(t, errors.As(err, &pageErr))
+		require.Equal(t, Cursor{Zone: "us-east1-b", PageToken: "p2"}, pageErr.Cursor)
+		require.EqualError(t, err, "list disks page us-east1-b:p2: backend unavailable")
+		require.Len(t, *calls, pageRetries+1)
+		require.Equal(t, pageRetries, sleeps)
+	})
+}
+
+func Test_ParseCursor(t *testing.T) {
+	t.Parallel()
+
+	cursor, err := ParseCursor("us-east1-b:abc:def")
+	require.NoError(t, err)
+	require.Equal(t, Cursor{Zone: "us-east1-b", PageToken: "abc:def"}, cursor)
+	require.Equal(t, "us-east1-b:abc:def", cursor.String())
+
+	cursor, err = ParseCursor(":abc")
+	require.NoError(t, err)
+	require.Equal(t, Cursor{PageToken: "abc"}, cursor)
+
+	_, err = ParseCursor("abc")
+	require.EqualError(t, err, `invalid cursor "abc": expected zone:token`)
+}
+
+func Test_ListDisksResume(t *testing.T) {
+	t.Parallel()
+
+	_, err := listDisks(context.Background(), &disksClientMock{}, "testing", []string{"us-east1-a"}, "", &Cursor{Zone: "us-east1-b", PageToken: "p2"}, false, 0)
+	require.EqualError(t, err, `cannot resume listing zone "us-east1-b": not one of us-east1-a`)
+
+	_, err = listDisks(context.Background(), &disksClientMock{}, "testing", nil, "", &Cursor{Zone: "us-east1-b", PageToken: "p2"}, false, 0)
+	require.EqualError(t, err, "cannot resume listing zone us-east1-b across all zones")
+}
+
+func Test_ListMarked(t *testing.T) {
+	t.Parallel()
+
+	disks := []*computepb.Disk{
+		{Name: pointer.String("marked"), Labels: map[string]string{LabelMarkedForDeletion: "2022-03-01"}},
+		{Name: pointer.String("unmarked"), Labels: map[string]string{LabelMarkedForDeletion: "false"}},
+		{Name: pointer.String("undated"), Zone: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-c"), Labels: map[string]string{LabelMarkedForDeletion: "true"}},
+	}
+	di := &diskIteratorMock{
+		NextFunc: func() (*computepb.Disk, error) {
+			if len(disks) == 0 {
+				return nil, iterator.Done
+			}
+			disk := disks[0]
+			disks = disks[1:]
+			return disk, nil
+		},
+	}
+	var listed []string
+	err := listMarked(di, []string{"us-east1-b"}, Tenant{}, func(disk *computepb.Disk, zone string) error {
+		listed = append(listed, zone+"/"+disk.GetName())
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"us-east1-b/marked", "us-east1-c/undated"}, listed)
+
+	di = &diskIteratorMock{
+		NextFunc: func() (*computepb.Disk, error) {
+			return nil, xerrors.New("boom")
+		},
+	}
+	err = listMarked(di, nil, Tenant{}, func(*computepb.Disk, string) error { return nil })
+	require.Equal(t, diskerr.CodeIterator, diskerr.CodeOf(err))
+}
+
+func Test_ListDisksFieldMask(t *testing.T) {
+	t.Parallel()
+
+	fields := strings.Join(diskFields, ",")
+	tests := []struct {
+		name      string
+		zones     []string
+		allFields bool
+		expected  []string
+	}{
+		{name: "zonal", zones: []string{"us-east1-a"}, expected: []string{"nextPageToken,warning,items(" + fields + ")"}},
+		{name: "aggregated", expected: []string{"nextPageToken,unreachables,items/*/warning,items/*/disks(" + fields + ")"}},
+		{name: "all fields", zones: []string{"us-east1-a"}, allFields: true},
+		{name: "aggregated all fields", allFields: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var mask []string
+			dc := &disksClientMock{
+				ListFunc: func(ctx context.Context, _ *computepb.ListDisksRequest, _ ...gax.CallOption) *computev1.DiskIterator {
+					md, _ := metadata.FromOutgoingContext(ctx)
+					mask = md.Get(fieldMaskHeader)
+					return &computev1.DiskIterator{}
+				},
+				AggregatedListFunc: func(ctx context.Context, _ *computepb.AggregatedListDisksRequest, _ ...gax.CallOption) *computev1.DisksScopedListPairIterator {
+					md, _ := metadata.FromOutgoingContext(ctx)
+					mask = md.Get(fieldMaskHeader)
+					return &computev1.DisksScopedListPairIterator{}
+				},
+			}
+			_, err := listDisks(context.Background(), dc, "testing", tt.zones, "", nil, tt.allFields, 0)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, mask)
+		})
+	}
+}
+
+func Test_ListDisksPageSize(t *testing.T) {
+	t.Parallel()
+
+	var sizes []uint32
+	dc := &disksClientMock{
+		ListFunc: func(_ context.Context, req *computepb.ListDisksRequest, _ ...gax.CallOption) *computev1.DiskIterator {
+			sizes = append(sizes, req.GetMaxResults())
+			return &computev1.DiskIterator{}
+		},
+		AggregatedListFunc: func(_ context.Context, req *computepb.AggregatedListDisksRequest, _ ...gax.CallOption) *computev1.DisksScopedListPairIterator {
+			sizes = append(sizes, req.GetMaxResults())
+			return &computev1.DisksScopedListPairIterator{}
+		},
+	}
+	_, err := listDisks(context.Background(), dc, "testing", []string{"us-east1-a"}, "", nil, false, 100)
+	require.NoError(t, err)
+	_, err = listDisks(context.Background(), dc, "testing", nil, "", nil, false, 100)
+	require.NoError(t, err)
+	_, err = listDisks(context.Background(), dc, "testing", []string{"us-east1-a"}, "", nil, false, 0)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{100, 100, 0}, sizes)
+}
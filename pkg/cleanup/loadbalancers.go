@@ -0,0 +1,384 @@
+package cleanup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// ForwardingRulesClient is the subset of the compute forwarding rules API
+// used by this package. *computev1.ForwardingRulesClient implements it.
+type ForwardingRulesClient interface {
+	AggregatedList(context.Context, *computepb.AggregatedListForwardingRulesRequest, ...gax.CallOption) *computev1.ForwardingRulesScopedListPairIterator
+	Delete(context.Context, *computepb.DeleteForwardingRuleRequest, ...gax.CallOption) (*computev1.Operation, error)
+}
+
+// TargetPoolsClient is the subset of the compute target pools API used by
+// this package. *computev1.TargetPoolsClient implements it.
+type TargetPoolsClient interface {
+	AggregatedList(context.Context, *computepb.AggregatedListTargetPoolsRequest, ...gax.CallOption) *computev1.TargetPoolsScopedListPairIterator
+	Delete(context.Context, *computepb.DeleteTargetPoolRequest, ...gax.CallOption) (*computev1.Operation, error)
+}
+
+// FirewallsClient is the subset of the compute firewalls API used by this
+// package. *computev1.FirewallsClient implements it.
+type FirewallsClient interface {
+	List(context.Context, *computepb.ListFirewallsRequest, ...gax.CallOption) *computev1.FirewallIterator
+	Delete(context.Context, *computepb.DeleteFirewallRequest, ...gax.CallOption) (*computev1.Operation, error)
+}
+
+//go:generate moq -fmt goimports -out mock_forwarding_rules_client.go . ForwardingRulesClient:forwardingRulesClientMock
+//go:generate moq -fmt goimports -out mock_target_pools_client.go . TargetPoolsClient:targetPoolsClientMock
+//go:generate moq -fmt goimports -out mock_firewalls_client.go . FirewallsClient:firewallsClientMock
+
+// Kinds of load balancer resources, in the order they are deleted in: a
+// target pool cannot be deleted while a forwarding rule points at it.
+const (
+	kindForwardingRule = "forwardingRule"
+	kindTargetPool     = "targetPool"
+	kindFirewall       = "firewall"
+)
+
+// serviceNameKey is the key of the Service in the JSON description GKE gives
+// to the resources it creates for a Service of type LoadBalancer.
+const serviceNameKey = "kubernetes.io/service-name"
+
+// nodeTag matches the network tag GKE gives to the nodes of a cluster,
+// gke-<cluster>-<cluster hash>-node, which its firewall rules target.
+var nodeTag = regexp.MustCompile(`^gke-(.+)-[0-9a-f]{8}-node$`)
+
+// lbResource is a forwarding rule, target pool or firewall rule that GKE
+// created for a Service of type LoadBalancer.
+type lbResource struct {
+	Kind string
+	Name string
+	// Region is empty for firewall rules, which are global.
+	Region  string
+	Created string
+	// Service is the namespace/name of the Service, if known.
+	Service string
+	// Cluster is the name of the cluster, empty if unknown.
+	Cluster string
+	ID      uint64
+}
+
+// key returns the key of r in ResourceMarks.
+func (r lbResource) key(projectID string) string {
+	if r.Region == "" {
+		return fmt.Sprintf("projects/%s/global/%ss/%s", projectID, r.Kind, r.Name)
+	}
+	return fmt.Sprintf("projects/%s/regions/%s/%ss/%s", projectID, r.Region, r.Kind, r.Name)
+}
+
+func (r lbResource) logger(projectID string) *zerolog.Logger {
+	l := log.With().
+		Str("projectID", projectID).
+		Str("kind", r.Kind).
+		Str("name", r.Name).
+		Str("region", r.Region).
+		Str("service", r.Service).
+		Str("cluster", r.Cluster).
+		Logger()
+	return &l
+}
+
+// serviceName returns the namespace/name of the Service in description, empty
+// if description is not the JSON GKE writes.
+func serviceName(description string) string {
+	var d map[string]string
+	if json.Unmarshal([]byte(description), &d) != nil {
+		return ""
+	}
+	return d[serviceNameKey]
+}
+
+// createdByGKE reports whether the resource name with description was
+// created by GKE for a Service.
+func createdByGKE(name, description string) bool {
+	return strings.HasPrefix(name, "k8s-") || strings.HasPrefix(name, "k8s2-") || serviceName(description) != ""
+}
+
+// tagCluster returns the cluster whose nodes tags target, empty if none.
+func tagCluster(tags []string) string {
+	for _, tag := range tags {
+		if m := nodeTag.FindStringSubmatch(tag); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// resolveClusters sets the cluster of the forwarding rules and target pools
+// in resources to that of the firewall rule GKE created along with them,
+// k8s-fw-<name> or <name>, as they do not tell their cluster themselves.
+func resolveClusters(resources []lbResource) {
+	byFirewall := make(map[string]string)
+	for _, r := range resources {
+		if r.Kind == kindFirewall {
+			byFirewall[r.Name] = r.Cluster
+		}
+	}
+	for i, r := range resources {
+		if r.Kind == kindFirewall {
+			continue
+		}
+		if cluster := byFirewall["k8s-fw-"+r.Name]; cluster != "" {
+			resources[i].Cluster = cluster
+		} else {
+			resources[i].Cluster = byFirewall[r.Name]
+		}
+	}
+}
+
+// LoadBalancerOptions configures a single MarkLoadBalancers or
+// CleanupLoadBalancers call.
+type LoadBalancerOptions struct {
+	ProjectID string
+	// Clusters holds the names of the clusters that exist. Resources of any
+	// other cluster are orphaned.
+	Clusters map[string]bool
+	// Cutoff is how long ago an orphaned resource must have been created to
+	// be marked.
+	Cutoff time.Duration
+	// GracePeriod is how long ago a resource must have been marked to be
+	// deleted.
+	GracePeriod time.Duration
+	// Marks holds the marks of the resources, and is updated in place. It
+	// must not hold marks of other kinds of resources, which are dropped.
+	Marks      ResourceMarks
+	MaxRetries int
+	DryRun     bool
+}
+
+// LoadBalancerCleaner marks the forwarding rules, target pools and firewall
+// rules GKE created for Services of type LoadBalancer whose cluster no longer
+// exists, and deletes them once they were marked long enough ago. These leak
+// when a cluster is deleted without deleting its Services first.
+type LoadBalancerCleaner struct {
+	forwardingRules ForwardingRulesClient
+	targetPools     TargetPoolsClient
+	firewalls       FirewallsClient
+	sleep           func(context.Context, time.Duration) error
+}
+
+// NewLoadBalancerCleaner returns a LoadBalancerCleaner.
+func NewLoadBalancerCleaner(forwardingRules ForwardingRulesClient, targetPools TargetPoolsClient, firewalls FirewallsClient) *LoadBalancerCleaner {
+	return &LoadBalancerCleaner{
+		forwardingRules: forwardingRules,
+		targetPools:     targetPools,
+		firewalls:       firewalls,
+		sleep:           gax.Sleep,
+	}
+}
+
+// list returns the resources GKE created for Services in projectID, in the
+// order they are deleted in.
+func (c *LoadBalancerCleaner) list(ctx context.Context, projectID string) ([]lbResource, error) {
+	var resources []lbResource
+	rules := c.forwardingRules.AggregatedList(ctx, &computepb.AggregatedListForwardingRulesRequest{Project: projectID})
+	for {
+		pair, err := rules.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, diskerr.Wrap(diskerr.CodeIterator, err, "iterating forwarding rules")
+		}
+		for _, fr := range pair.Value.GetForwardingRules() {
+			if createdByGKE(fr.GetName(), fr.GetDescription()) {
+				resources = append(resources, lbResource{Kind: kindForwardingRule, Name: fr.GetName(), Region: path.Base(fr.GetRegion()), Created: fr.GetCreationTimestamp(), Service: serviceName(fr.GetDescription()), ID: fr.GetId()})
+			}
+		}
+	}
+	pools := c.targetPools.AggregatedList(ctx, &computepb.AggregatedListTargetPoolsRequest{Project: projectID})
+	for {
+		pair, err := pools.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, diskerr.Wrap(diskerr.CodeIterator, err, "iterating target pools")
+		}
+		for _, tp := range pair.Value.GetTargetPools() {
+			if createdByGKE(tp.GetName(), tp.GetDescription()) {
+				resources = append(resources, lbResource{Kind: kindTargetPool, Name: tp.GetName(), Region: path.Base(tp.GetRegion()), Created: tp.GetCreationTimestamp(), Service: serviceName(tp.GetDescription()), ID: tp.GetId()})
+			}
+		}
+	}
+	firewalls := c.firewalls.List(ctx, &computepb.ListFirewallsRequest{Project: projectID})
+	for {
+		fw, err := firewalls.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, diskerr.Wrap(diskerr.CodeIterator, err, "iterating firewall rules")
+		}
+		if createdByGKE(fw.GetName(), "") {
+			resources = append(resources, lbResource{Kind: kindFirewall, Name: fw.GetName(), Created: fw.GetCreationTimestamp(), Service: serviceName(fw.GetDescription()), Cluster: tagCluster(fw.GetTargetTags()), ID: fw.GetId()})
+		}
+	}
+	resolveClusters(resources)
+	return resources, nil
+}
+
+// checkOrphaned returns an error unless the cluster of r is known and no
+// longer exists.
+func checkOrphaned(r lbResource, clusters map[string]bool) error {
+	switch {
+	case r.Cluster == "":
+		return diskerr.New(diskerr.CodeClusterUnknown, "%s %s: cluster unknown", r.Kind, r.Name)
+	case clusters[r.Cluster]:
+		return diskerr.New(diskerr.CodeInUse, "%s %s: cluster %s exists", r.Kind, r.Name, r.Cluster)
+	}
+	return nil
+}
+
+// MarkLoadBalancers marks the orphaned load balancer resources of the project
+// created before the cutoff, and unmarks those whose cluster exists again.
+// Marks of resources that no longer exist are dropped. Per-resource failures
+// are logged and counted in the returned stats; an error is only returned if
+// listing resources fails.
+func (c *LoadBalancerCleaner) MarkLoadBalancers(ctx context.Context, opts LoadBalancerOptions) (ResourceStats, error) {
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no load balancer resources will be marked")
+	}
+	resources, err := c.list(ctx, opts.ProjectID)
+	if err != nil {
+		return ResourceStats{}, err
+	}
+	return c.markAll(resources, opts), nil
+}
+
+func (c *LoadBalancerCleaner) markAll(resources []lbResource, opts LoadBalancerOptions) ResourceStats {
+	var stats ResourceStats
+	seen := make(map[string]bool)
+	for _, r := range resources {
+		seen[r.key(opts.ProjectID)] = true
+		action, err := markResource(r, opts)
+		stats.count(r.logger(opts.ProjectID), r.Kind, action, err)
+	}
+	prefix := fmt.Sprintf("projects/%s/", opts.ProjectID)
+	for key := range opts.Marks {
+		if strings.HasPrefix(key, prefix) && !seen[key] && !opts.DryRun {
+			log.Info().Str("projectID", opts.ProjectID).Str("resource", key).Msg("dropping mark of load balancer resource that no longer exists")
+			delete(opts.Marks, key)
+		}
+	}
+	return stats
+}
+
+func markResource(r lbResource, opts LoadBalancerOptions) (Action, error) {
+	key := r.key(opts.ProjectID)
+	logger := r.logger(opts.ProjectID)
+	_, marked := parseMark(opts.Marks[key])
+	if err := checkOrphaned(r, opts.Clusters); err != nil {
+		if !marked {
+			return ActionSkip, err
+		}
+		if opts.DryRun {
+			return ActionUnmark, diskerr.ErrDryRun
+		}
+		delete(opts.Marks, key)
+		logger.Info().Err(err).Msg("unmarked load balancer resource")
+		return ActionUnmark, nil
+	}
+	if marked {
+		return ActionSkip, diskerr.ErrAlreadyMarked
+	}
+	created, err := time.Parse(time.RFC3339, r.Created)
+	if err != nil {
+		return ActionSkip, diskerr.Wrap(diskerr.CodeInvalidTimestamp, err, "%s %s: parse creation timestamp", r.Kind, r.Name)
+	}
+	if time.Since(created) < opts.Cutoff {
+		return ActionSkip, diskerr.ErrWithinCutoff
+	}
+	if opts.DryRun {
+		logger.Info().Msg("dry run -- would mark orphaned load balancer resource")
+		return ActionMark, diskerr.ErrDryRun
+	}
+	opts.Marks[key] = markValue(time.Now())
+	logger.Info().Msg("marked orphaned load balancer resource for deletion")
+	return ActionMark, nil
+}
+
+// CleanupLoadBalancers deletes the marked load balancer resources of the
+// project that are still orphaned, once their mark is older than the grace
+// period. Per-resource failures are logged and counted in the returned stats;
+// an error is only returned if listing resources fails.
+func (c *LoadBalancerCleaner) CleanupLoadBalancers(ctx context.Context, opts LoadBalancerOptions) (ResourceStats, error) {
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no load balancer resources will be deleted")
+	}
+	resources, err := c.list(ctx, opts.ProjectID)
+	if err != nil {
+		return ResourceStats{}, err
+	}
+	return c.deleteAll(ctx, resources, opts), nil
+}
+
+func (c *LoadBalancerCleaner) deleteAll(ctx context.Context, resources []lbResource, opts LoadBalancerOptions) ResourceStats {
+	var stats ResourceStats
+	for _, r := range resources {
+		if _, marked := parseMark(opts.Marks[r.key(opts.ProjectID)]); !marked {
+			stats.count(r.logger(opts.ProjectID), r.Kind, ActionSkip, nil)
+			continue
+		}
+		stats.count(r.logger(opts.ProjectID), r.Kind, ActionDelete, c.deleteResource(ctx, r, opts))
+	}
+	return stats
+}
+
+func (c *LoadBalancerCleaner) deleteResource(ctx context.Context, r lbResource, opts LoadBalancerOptions) error {
+	key := r.key(opts.ProjectID)
+	logger := r.logger(opts.ProjectID)
+	markedAt, _ := parseMark(opts.Marks[key])
+	if err := checkOrphaned(r, opts.Clusters); err != nil {
+		return err
+	}
+	if opts.GracePeriod > 0 && time.Since(markedAt) < opts.GracePeriod {
+		return diskerr.New(diskerr.CodeWithinGracePeriod, "skipping %s %s: marked on %s, within grace period of %s", r.Kind, r.Name, opts.Marks[key], opts.GracePeriod)
+	}
+	if opts.DryRun {
+		logger.Warn().Msg("dry run -- would delete orphaned load balancer resource")
+		return diskerr.ErrDryRun
+	}
+	logger.Warn().Msg("deleting orphaned load balancer resource")
+	requestID := pointer.String(resourceRequestID(r.ID, r.Created, "delete"))
+	rt := retrier{maxRetries: opts.MaxRetries, backoff: callBackoff, sleep: c.sleep}
+	var op *computev1.Operation
+	err := rt.do(ctx, logger, "delete"+strings.ToUpper(r.Kind[:1])+r.Kind[1:], func() (err error) {
+		switch r.Kind {
+		case kindForwardingRule:
+			op, err = c.forwardingRules.Delete(ctx, &computepb.DeleteForwardingRuleRequest{ForwardingRule: r.Name, Project: opts.ProjectID, Region: r.Region, RequestId: requestID})
+		case kindTargetPool:
+			op, err = c.targetPools.Delete(ctx, &computepb.DeleteTargetPoolRequest{TargetPool: r.Name, Project: opts.ProjectID, Region: r.Region, RequestId: requestID})
+		default:
+			op, err = c.firewalls.Delete(ctx, &computepb.DeleteFirewallRequest{Firewall: r.Name, Project: opts.ProjectID, RequestId: requestID})
+		}
+		return err
+	})
+	if err == nil && op != nil && r.Kind == kindForwardingRule {
+		// the target pool of the rule cannot be deleted before it is gone
+		err = WaitOperation(ctx, op)
+	}
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeAPI, err, "failed to delete %s %s", r.Kind, r.Name)
+	}
+	delete(opts.Marks, key)
+	return nil
+}
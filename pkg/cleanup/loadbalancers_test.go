@@ -0,0 +1,130 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func Test_ResolveClusters(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, createdByGKE("a0123456789abcdef0123456789abcde", `{"kubernetes.io/service-name":"default/web"}`))
+	require.True(t, createdByGKE("k8s-fw-a0123456789abcdef0123456789abcde", ""))
+	require.False(t, createdByGKE("allow-ssh", "allow ssh from the office"))
+	require.Equal(t, "default/web", serviceName(`{"kubernetes.io/service-name":"default/web"}`))
+	require.Equal(t, "prod-east", tagCluster([]string{"web", "gke-prod-east-0123abcd-node"}))
+	require.Empty(t, tagCluster([]string{"web"}))
+
+	resources := []lbResource{
+		{Kind: kindForwardingRule, Name: "a1"},
+		{Kind: kindTargetPool, Name: "a1"},
+		{Kind: kindForwardingRule, Name: "k8s2-tcp-web"},
+		{Kind: kindForwardingRule, Name: "a2"},
+		{Kind: kindFirewall, Name: "k8s-fw-a1", Cluster: "prod"},
+		{Kind: kindFirewall, Name: "k8s2-tcp-web", Cluster: "dev"},
+	}
+	resolveClusters(resources)
+	var clusters []string
+	for _, r := range resources {
+		clusters = append(clusters, r.Cluster)
+	}
+	require.Equal(t, []string{"prod", "prod", "dev", "", "prod", "dev"}, clusters)
+}
+
+func Test_LoadBalancers(t *testing.T) {
+	t.Parallel()
+
+	old := time.Now().Add(-90 * 24 * time.Hour).Format(time.RFC3339)
+	recent := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	clusters := map[string]bool{"prod": true}
+
+	t.Run("mark", func(t *testing.T) {
+		t.Parallel()
+
+		resources := []lbResource{
+			{Kind: kindForwardingRule, Name: "orphan", Region: "us-central1", Cluster: "deleted", Created: old},
+			{Kind: kindForwardingRule, Name: "new", Region: "us-central1", Cluster: "deleted", Created: recent},
+			{Kind: kindTargetPool, Name: "live", Region: "us-central1", Cluster: "prod", Created: old},
+			{Kind: kindFirewall, Name: "k8s-fw-unknown", Created: old},
+			{Kind: kindFirewall, Name: "k8s-fw-recreated", Cluster: "prod", Created: old},
+		}
+		marks := ResourceMarks{
+			"projects/testing/global/firewalls/k8s-fw-recreated":        "2020-01-01",
+			"projects/testing/regions/us-central1/targetPools/gone":     "2020-01-01",
+			"projects/other/regions/us-central1/forwardingRules/orphan": "2020-01-01",
+		}
+		c := NewLoadBalancerCleaner(&forwardingRulesClientMock{}, &targetPoolsClientMock{}, &firewallsClientMock{})
+		stats := c.markAll(resources, LoadBalancerOptions{ProjectID: "testing", Clusters: clusters, Cutoff: 30 * 24 * time.Hour, Marks: marks})
+		require.Equal(t, ResourceStats{Stats: Stats{Scanned: 5}, Marked: 1, Unmarked: 1}, stats)
+		require.Equal(t, ResourceMarks{
+			"projects/testing/regions/us-central1/forwardingRules/orphan": markValue(time.Now()),
+			"projects/other/regions/us-central1/forwardingRules/orphan":   "2020-01-01",
+		}, marks)
+	})
+
+	t.Run("cleanup", func(t *testing.T) {
+		t.Parallel()
+
+		resources := []lbResource{
+			{Kind: kindForwardingRule, Name: "orphan", Region: "us-central1", Cluster: "deleted", Created: old},
+			{Kind: kindTargetPool, Name: "orphan", Region: "us-central1", Cluster: "deleted", Created: old},
+			{Kind: kindFirewall, Name: "k8s-fw-orphan", Cluster: "deleted", Created: old},
+			{Kind: kindFirewall, Name: "k8s-fw-live", Cluster: "prod", Created: old},
+			{Kind: kindFirewall, Name: "k8s-fw-unmarked", Cluster: "deleted", Created: old},
+			{Kind: kindFirewall, Name: "k8s-fw-grace", Cluster: "deleted", Created: old},
+		}
+		marks := ResourceMarks{
+			"projects/testing/regions/us-central1/forwardingRules/orphan": "2020-01-01",
+			"projects/testing/regions/us-central1/targetPools/orphan":     "2020-01-01",
+			"projects/testing/global/firewalls/k8s-fw-orphan":             "2020-01-01",
+			"projects/testing/global/firewalls/k8s-fw-live":               "2020-01-01",
+			"projects/testing/global/firewalls/k8s-fw-grace":              markValue(time.Now()),
+		}
+		var deleted []string
+		fr := &forwardingRulesClientMock{
+			DeleteFunc: func(_ context.Context, req *computepb.DeleteForwardingRuleRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+				deleted = append(deleted, "forwardingRule/"+req.GetRegion()+"/"+req.GetForwardingRule())
+				return nil, nil
+			},
+		}
+		tp := &targetPoolsClientMock{
+			DeleteFunc: func(_ context.Context, req *computepb.DeleteTargetPoolRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+				deleted = append(deleted, "targetPool/"+req.GetRegion()+"/"+req.GetTargetPool())
+				return nil, nil
+			},
+		}
+		fw := &firewallsClientMock{
+			DeleteFunc: func(_ context.Context, req *computepb.DeleteFirewallRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+				require.NotEmpty(t, req.GetRequestId())
+				deleted = append(deleted, "firewall/"+req.GetFirewall())
+				return nil, nil
+			},
+		}
+		c := NewLoadBalancerCleaner(fr, tp, fw)
+		stats := c.deleteAll(context.Background(), resources, LoadBalancerOptions{ProjectID: "testing", Clusters: clusters, GracePeriod: 7 * 24 * time.Hour, Marks: marks})
+		require.Equal(t, ResourceStats{Stats: Stats{Scanned: 6}, Deleted: 3}, stats)
+		require.Equal(t, []string{"forwardingRule/us-central1/orphan", "targetPool/us-central1/orphan", "firewall/k8s-fw-orphan"}, deleted)
+		require.Len(t, marks, 2)
+	})
+
+	t.Run("cleanup dry run", func(t *testing.T) {
+		t.Parallel()
+
+		r := lbResource{Kind: kindFirewall, Name: "k8s-fw-orphan", Cluster: "deleted", Created: old}
+		marks := ResourceMarks{r.key("testing"): "2020-01-01"}
+		fw := &firewallsClientMock{}
+		c := NewLoadBalancerCleaner(&forwardingRulesClientMock{}, &targetPoolsClientMock{}, fw)
+		err := c.deleteResource(context.Background(), r, LoadBalancerOptions{ProjectID: "testing", Clusters: clusters, Marks: marks, DryRun: true})
+		require.ErrorIs(t, err, diskerr.ErrDryRun)
+		require.Empty(t, fw.DeleteCalls())
+		require.Len(t, marks, 1)
+	})
+}
@@ -0,0 +1,198 @@
+package cleanup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Candidate is a disk evaluated by a MarkPolicy.
+type Candidate struct {
+	Disk *computepb.Disk
+	// LastUsed is when the disk was last attached, detached or created, see
+	// LastUsed. Zero if the disk was never used.
+	LastUsed time.Time
+	// Cutoff is the cutoff of the disk, i.e. MarkOptions.Cutoff or its
+	// source cutoff.
+	Cutoff time.Duration
+	Now    time.Time
+}
+
+// MarkPolicy decides which disks are abandoned. The checks that protect disks
+// regardless of the policy, e.g. of exempt, boot or attached disks, still
+// apply after it.
+type MarkPolicy interface {
+	// Evaluate returns ActionMark for an abandoned disk, and ActionSkip for
+	// a disk that is kept. A kept disk that is marked is unmarked.
+	Evaluate(c Candidate) Action
+}
+
+// DefaultMarkPolicy marks the disks not used within their cutoff.
+var DefaultMarkPolicy MarkPolicy = LastAttachAge{}
+
+// LastAttachAge marks the disks not used for at least MinAge, or their
+// cutoff if MinAge is 0.
+type LastAttachAge struct {
+	MinAge time.Duration
+}
+
+func (p LastAttachAge) Evaluate(c Candidate) Action {
+	minAge := p.MinAge
+	if minAge == 0 {
+		minAge = c.Cutoff
+	}
+	return markIf(c.Now.Sub(c.LastUsed) >= minAge)
+}
+
+func (p LastAttachAge) String() string {
+	if p.MinAge == 0 {
+		return "unused past the cutoff"
+	}
+	return fmt.Sprintf("unused for %s", days(p.MinAge))
+}
+
+// CreationAge marks the disks created at least MinAge ago. Disks without a
+// valid creation time are kept.
+type CreationAge struct {
+	MinAge time.Duration
+}
+
+func (p CreationAge) Evaluate(c Candidate) Action {
+	created, err := time.Parse(time.RFC3339, c.Disk.GetCreationTimestamp())
+	if err != nil {
+		return ActionSkip
+	}
+	return markIf(c.Now.Sub(created) >= p.MinAge)
+}
+
+func (p CreationAge) String() string {
+	return fmt.Sprintf("created at least %s ago", days(p.MinAge))
+}
+
+// SizeRange marks the disks of at least MinGB and, unless MaxGB is 0, at
+// most MaxGB.
+type SizeRange struct {
+	MinGB int64
+	MaxGB int64
+}
+
+func (p SizeRange) Evaluate(c Candidate) Action {
+	size := c.Disk.GetSizeGb()
+	return markIf(size >= p.MinGB && (p.MaxGB == 0 || size <= p.MaxGB))
+}
+
+func (p SizeRange) String() string {
+	if p.MaxGB == 0 {
+		return fmt.Sprintf("of at least %d GB", p.MinGB)
+	}
+	return fmt.Sprintf("of %d to %d GB", p.MinGB, p.MaxGB)
+}
+
+// LabelMatch marks the disks with the label Key set to Value, or set at all
+// if Value is empty.
+type LabelMatch struct {
+	Key   string
+	Value string
+}
+
+func (p LabelMatch) Evaluate(c Candidate) Action {
+	value, ok := c.Disk.GetLabels()[p.Key]
+	return markIf(ok && (p.Value == "" || value == p.Value))
+}
+
+func (p LabelMatch) String() string {
+	if p.Value == "" {
+		return "labelled " + p.Key
+	}
+	return "labelled " + p.Key + "=" + p.Value
+}
+
+// NoIO marks the disks of ProjectID counted without reads or writes in
+// Bytes, e.g. over the last days. Disks Bytes has no data for are kept, as a
+// disk may be missing from the metrics for other reasons than being idle.
+type NoIO struct {
+	ProjectID string
+	Bytes     *DiskCounts
+}
+
+func (p NoIO) Evaluate(c Candidate) Action {
+	bytes, ok := p.Bytes.Get(p.ProjectID, c.Disk.GetName())
+	return markIf(ok && bytes == 0)
+}
+
+func (p NoIO) String() string {
+	return "without reads or writes"
+}
+
+// AllOf marks the disks every one of its policies marks.
+type AllOf []MarkPolicy
+
+func (p AllOf) Evaluate(c Candidate) Action {
+	for _, policy := range p {
+		if policy.Evaluate(c) != ActionMark {
+			return ActionSkip
+		}
+	}
+	return ActionMark
+}
+
+func (p AllOf) String() string {
+	return "all of (" + joinPolicies(p) + ")"
+}
+
+// AnyOf marks the disks any one of its policies marks.
+type AnyOf []MarkPolicy
+
+func (p AnyOf) Evaluate(c Candidate) Action {
+	for _, policy := range p {
+		if policy.Evaluate(c) == ActionMark {
+			return ActionMark
+		}
+	}
+	return ActionSkip
+}
+
+func (p AnyOf) String() string {
+	return "any of (" + joinPolicies(p) + ")"
+}
+
+// Not marks the disks its policy keeps, e.g. those without a label.
+type Not struct {
+	Policy MarkPolicy
+}
+
+func (p Not) Evaluate(c Candidate) Action {
+	return markIf(p.Policy.Evaluate(c) != ActionMark)
+}
+
+func (p Not) String() string {
+	return fmt.Sprintf("not %v", p.Policy)
+}
+
+func markIf(abandoned bool) Action {
+	if abandoned {
+		return ActionMark
+	}
+	return ActionSkip
+}
+
+// joinPolicies describes policies for the String of AllOf and AnyOf.
+func joinPolicies(policies []MarkPolicy) string {
+	described := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		described = append(described, fmt.Sprint(policy))
+	}
+	return strings.Join(described, ", ")
+}
+
+// days formats d as a whole number of days, as the rules of a policy file
+// set them.
+func days(d time.Duration) string {
+	n := int64(d / (24 * time.Hour))
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
@@ -0,0 +1,81 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_MarkPolicies(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	candidate := Candidate{
+		Disk: &computepb.Disk{
+			CreationTimestamp: pointer.String(now.AddDate(0, 0, -100).Format(time.RFC3339)),
+			SizeGb:            pointer.Int64(200),
+			Labels:            map[string]string{"env": "dev"},
+		},
+		LastUsed: now.AddDate(0, 0, -20),
+		Cutoff:   30 * 24 * time.Hour,
+		Now:      now,
+	}
+	tests := []struct {
+		name     string
+		policy   MarkPolicy
+		expected Action
+	}{
+		{"default within cutoff", DefaultMarkPolicy, ActionSkip},
+		{"last attach age", LastAttachAge{MinAge: 14 * 24 * time.Hour}, ActionMark},
+		{"last attach age too young", LastAttachAge{MinAge: 21 * 24 * time.Hour}, ActionSkip},
+		{"creation age", CreationAge{MinAge: 90 * 24 * time.Hour}, ActionMark},
+		{"creation age too young", CreationAge{MinAge: 180 * 24 * time.Hour}, ActionSkip},
+		{"size at least", SizeRange{MinGB: 100}, ActionMark},
+		{"size within range", SizeRange{MinGB: 100, MaxGB: 200}, ActionMark},
+		{"size above range", SizeRange{MaxGB: 100}, ActionSkip},
+		{"label value", LabelMatch{Key: "env", Value: "dev"}, ActionMark},
+		{"label other value", LabelMatch{Key: "env", Value: "prod"}, ActionSkip},
+		{"label set", LabelMatch{Key: "env"}, ActionMark},
+		{"label missing", LabelMatch{Key: "team"}, ActionSkip},
+		{"all", AllOf{SizeRange{MinGB: 100}, LabelMatch{Key: "env"}}, ActionMark},
+		{"all but one", AllOf{SizeRange{MinGB: 100}, LabelMatch{Key: "team"}}, ActionSkip},
+		{"any", AnyOf{DefaultMarkPolicy, LabelMatch{Key: "env"}}, ActionMark},
+		{"none", AnyOf{DefaultMarkPolicy, LabelMatch{Key: "team"}}, ActionSkip},
+		{"not", Not{Policy: LabelMatch{Key: "team"}}, ActionMark},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expected, tt.policy.Evaluate(candidate))
+		})
+	}
+
+	ioBytes := NewDiskCounts()
+	ioBytes.Add("testing", "idle", 0)
+	ioBytes.Add("testing", "busy", 1)
+	for name, expected := range map[string]Action{"idle": ActionMark, "busy": ActionSkip, "unknown": ActionSkip} {
+		c := Candidate{Disk: &computepb.Disk{Name: pointer.String(name)}, Now: now}
+		require.Equal(t, expected, NoIO{ProjectID: "testing", Bytes: ioBytes}.Evaluate(c), name)
+	}
+	require.Equal(t, ActionSkip, NoIO{ProjectID: "testing"}.Evaluate(Candidate{Disk: &computepb.Disk{Name: pointer.String("idle")}}))
+
+	// a disk without a creation time is kept
+	require.Equal(t, ActionSkip, CreationAge{}.Evaluate(Candidate{Disk: &computepb.Disk{}, Now: now}))
+}
+
+func Test_MarkPolicyString(t *testing.T) {
+	t.Parallel()
+
+	policy := AllOf{
+		LastAttachAge{},
+		AnyOf{SizeRange{MinGB: 100, MaxGB: 500}, SizeRange{MinGB: 1000}, LabelMatch{Key: "env", Value: "dev"}},
+		Not{Policy: CreationAge{MinAge: 24 * time.Hour}},
+		Not{Policy: LabelMatch{Key: "keep"}},
+		LastAttachAge{MinAge: 90 * 24 * time.Hour},
+	}
+	require.Equal(t, "all of (unused past the cutoff, any of (of 100 to 500 GB, of at least 1000 GB, labelled env=dev), not created at least 1 day ago, not labelled keep, unused for 90 days)", policy.String())
+}
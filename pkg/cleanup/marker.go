@@ -0,0 +1,385 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// MarkOptions configures a single MarkDisks call.
+type MarkOptions struct {
+	ProjectID string
+	// Zones to list disks in. Nil means all zones of the project.
+	Zones []string
+	// Filter is passed to the list disks request, e.g. FilterGKEVolumes.
+	Filter string
+	// Selector selects among the listed disks those to process.
+	Selector Selector
+	// AllFields lists disks with all their fields, rather than only those
+	// read when processing them.
+	AllFields bool
+	// PageSize is how many disks are listed per page, 0 for MaxPageSize.
+	// Smaller pages are cheaper to retry when listing very large zones.
+	PageSize int
+	// Tenant restricts listing and changes to the disks of one tenant. A
+	// listed disk of another tenant fails with diskerr.CodeTenantMismatch.
+	Tenant Tenant
+	// Cutoff is how long a disk must not have been attached to be marked.
+	Cutoff time.Duration
+	// SourceCutoffs overrides Cutoff for the disks created from a source,
+	// e.g. a longer one for disks created from an image.
+	SourceCutoffs map[Source]time.Duration
+	// Policy decides which disks are abandoned and marked. Defaults to
+	// DefaultMarkPolicy, which marks the disks past their cutoff.
+	Policy MarkPolicy
+	// ScoreModel, if set, rates the disks past their cutoff, which are only
+	// marked if they score at least its threshold. May be nil.
+	ScoreModel *ScoreModel
+	// LabelBudgetPolicy applies when a disk has no room left for our label.
+	// Defaults to LabelBudgetSkip.
+	LabelBudgetPolicy LabelBudgetPolicy
+	// ExemptLabel is the label that, set to "true", exempts a disk from being
+	// marked, e.g. DefaultExemptLabel. Empty exempts no disk.
+	ExemptLabel string
+	// IncludeBootDisks marks boot disks too, see checkBootDisk. Deleting the
+	// boot disk of a node by accident is catastrophic, so they are left out
+	// by default.
+	IncludeBootDisks bool
+	// IncludeManaged marks disks managed by infrastructure as code too, see
+	// checkManaged.
+	IncludeManaged bool
+	// Volumes holds the disks backing Kubernetes PersistentVolumes, which
+	// are never marked. May be nil.
+	Volumes *VolumeIndex
+	// IdleIO holds the bytes read and written by disks in a recent period,
+	// e.g. from Cloud Monitoring. A disk counted without any is abandoned,
+	// see NoIO, even if it is attached, e.g. to an idle workspace VM. May
+	// be nil.
+	IdleIO *DiskCounts
+	// AttachHistory holds last attach times of disks from another source, for
+	// disks that do not record one themselves. May be nil.
+	AttachHistory *AttachHistory
+	// Resume starts listing at the page that failed in an earlier run, see
+	// PageError or Checkpointer. May be nil.
+	Resume *Cursor
+	// Checkpoint is given a cursor every CheckpointEvery disks, before
+	// returning because ctx was cancelled, and when listing a page fails.
+	// May be nil.
+	Checkpoint      Checkpointer
+	CheckpointEvery int
+	// Throttle, if set, is waited on before each disk is processed, even in
+	// dry run mode, e.g. to pause a run or limit its rate.
+	Throttle Pacer
+	// Concurrency is how many disks are processed at a time. Defaults to 1.
+	Concurrency int
+	// MaxRetries is how often a call that changes a disk is retried after
+	// a transient error, such as being rate limited.
+	MaxRetries int
+	// Fallback, if set, downgrades the rest of the run to a dry run once too
+	// many disks failed.
+	Fallback *Fallback
+	DryRun   bool
+}
+
+// Marker labels disks that have not been attached within a cutoff for later
+// deletion, and removes the label again from disks that were re-attached.
+type Marker struct {
+	client DisksClient
+	bus    *events.Bus
+	sleep  func(context.Context, time.Duration) error
+}
+
+// NewMarker returns a Marker that publishes its events on bus. bus may be nil.
+func NewMarker(client DisksClient, bus *events.Bus) *Marker {
+	return &Marker{client: client, bus: bus, sleep: gax.Sleep}
+}
+
+// MarkDisks marks or unmarks every disk matching opts. Per-disk failures are
+// published as events and counted in the returned Stats; an error is only
+// returned if listing disks fails.
+func (m *Marker) MarkDisks(ctx context.Context, opts MarkOptions) (Stats, error) {
+	var stats Stats
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no write operations will be performed")
+	}
+	diskIter, err := listDisks(ctx, m.client, opts.ProjectID, opts.Zones, opts.Tenant.filter(opts.Filter), opts.Resume, opts.AllFields, opts.PageSize)
+	if err != nil {
+		return stats, err
+	}
+	return m.markAll(ctx, selectDisks(diskIter, opts.Selector), opts)
+}
+
+// markAll processes every disk returned by diskIter.
+func (m *Marker) markAll(ctx context.Context, diskIter diskIterator, opts MarkOptions) (Stats, error) {
+	cp := newCheckpoints(opts.Checkpoint, opts.ProjectID, opts.CheckpointEvery, opts.Resume)
+	return processDisks(ctx, diskIter, opts.Concurrency, opts.Throttle, cp, func(disk *computepb.Disk) error {
+		return m.processDisk(ctx, disk, opts)
+	})
+}
+
+func (m *Marker) markOne(ctx context.Context, di diskIterator, opts MarkOptions) error {
+	disk, err := di.Next()
+	if err == iterator.Done {
+		return err
+	}
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeIterator, err, "iterating disks")
+	}
+	return m.processDisk(ctx, disk, opts)
+}
+
+// processDisk processes disk and publishes the outcome.
+func (m *Marker) processDisk(ctx context.Context, disk *computepb.Disk, opts MarkOptions) error {
+	if opts.Fallback.DryRun() {
+		opts.DryRun = true
+	}
+	zone := diskZone(disk, opts.Zones)
+	action, score, err := m.markDisk(ctx, disk, zone, opts)
+	if !opts.DryRun {
+		opts.Fallback.observe(action, err)
+	}
+	logger := diskLogger(opts.ProjectID, zone, disk)
+	switch {
+	case err == nil:
+	case errors.Is(err, diskerr.ErrAlreadyMarked):
+		logger.Debug().Msg("ignore disk already labelled")
+	case errors.Is(err, diskerr.ErrWithinCutoff):
+		logger.Debug().Msg("ignoring disk last attached within cutoff")
+	case errors.Is(err, diskerr.ErrKeptByPolicy):
+		logger.Debug().Err(err).Msg("ignoring disk kept by the mark policy")
+	case errors.Is(err, diskerr.ErrDryRun):
+		logger.Debug().Msg("not labelling disk as dry run enabled")
+	case errors.Is(err, diskerr.ErrLabelBudgetExhausted):
+		logger.Warn().Err(err).Msg("skipping disk without room for another label")
+	case errors.Is(err, diskerr.ErrAttached):
+		logger.Info().Err(err).Msg("not marking disk attached to an instance")
+	case errors.Is(err, diskerr.ErrInUse):
+		logger.Info().Err(err).Msg("not marking disk backing a persistent volume")
+	case errors.Is(err, diskerr.ErrLowScore):
+		logger.Info().Err(err).Msg("not marking disk scored below the threshold")
+	case IsFailure(err):
+		m.bus.Publish(events.Event{Type: events.Error, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, DryRun: opts.DryRun, Err: err})
+	}
+	m.bus.Publish(events.Event{Type: events.DiskProcessed, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Action: string(action), DryRun: opts.DryRun, Err: err, Score: score})
+	return err
+}
+
+// markDisk decides what to do with disk and does it. score is set if the
+// disk was rated by opts.ScoreModel.
+func (m *Marker) markDisk(ctx context.Context, disk *computepb.Disk, zone string, opts MarkOptions) (action Action, score *float64, err error) {
+	lastActivity := lastActivityTimestamp(disk, opts.ProjectID, zone, opts.AttachHistory)
+	policy := opts.Policy
+	noIO := NoIO{ProjectID: opts.ProjectID, Bytes: opts.IdleIO}
+	idle := noIO.Evaluate(Candidate{Disk: disk}) == ActionMark
+	if idle {
+		// a disk nobody reads or writes is abandoned, whatever its
+		// timestamps
+		policy = noIO
+	}
+	action, err = handleMarkAction(disk, lastActivity, opts.cutoff(disk), policy)
+	if regional := checkRegional(disk); regional != nil {
+		action, err = ActionSkip, regional
+	} else if mismatch := opts.Tenant.check("disk "+disk.GetName(), disk.GetLabels()); mismatch != nil {
+		action, err = ActionSkip, mismatch
+	} else if exempt := checkExempt(disk, opts.ExemptLabel); exempt != nil {
+		action, err = ActionSkip, exempt
+	} else if boot := checkBootDisk(disk, opts.IncludeBootDisks); boot != nil {
+		action, err = ActionSkip, boot
+	} else if managed := checkManaged(disk, opts.IncludeManaged); managed != nil {
+		action, err = ActionSkip, managed
+		diskLogger(opts.ProjectID, zone, disk).Info().Err(managed).Msg("not marking disk managed by infrastructure as code")
+	} else if attached := checkAttached(disk); attached != nil && action != ActionUnmark && !idle {
+		// a disk in use is never marked, and its mark is cancelled, unless
+		// it is not read or written
+		action, err = ActionSkip, attached
+		if _, marked := parseMark(disk.GetLabels()[LabelMarkedForDeletion]); marked {
+			action, err = ActionUnmark, nil
+		}
+	} else if action == ActionMark {
+		if owner, ok := opts.Volumes.Lookup(opts.ProjectID, disk.GetName()); ok {
+			action = ActionSkip
+			err = diskerr.New(diskerr.CodeInUse, "disk %s backs persistent volume %s bound to claim %q", disk.GetName(), owner.PersistentVolume, owner.Claim)
+		}
+	}
+	if _, marked := parseMark(disk.GetLabels()[LabelMarkedForDeletion]); action == ActionMark && !marked && opts.ScoreModel != nil {
+		s := opts.ScoreModel.Score(disk, opts.ProjectID, idleFor(lastActivity), opts.cutoff(disk))
+		score = &s.Value
+		if s.Value < opts.ScoreModel.Threshold {
+			action = ActionSkip
+			err = diskerr.New(diskerr.CodeLowScore, "disk %s scored %.2f, below the threshold of %.2f", disk.GetName(), s.Value, opts.ScoreModel.Threshold)
+		}
+	}
+	if idle && action == ActionMark && len(disk.GetUsers()) > 0 {
+		diskLogger(opts.ProjectID, zone, disk).Info().Msg("marking attached disk without reads or writes")
+	}
+	m.bus.Publish(events.Event{
+		Type:      events.DiskScanned,
+		ProjectID: opts.ProjectID,
+		Zone:      zone,
+		Disk:      disk,
+		Action:    string(action),
+		DryRun:    opts.DryRun,
+		Err:       err,
+		Score:     score,
+	})
+	if err != nil {
+		return action, score, err
+	}
+	switch action {
+	case ActionSkip:
+		return action, score, nil
+	case ActionMark:
+		labels, err := withLabel(disk, LabelMarkedForDeletion, markValue(time.Now()), opts.LabelBudgetPolicy)
+		if err != nil {
+			return action, score, err
+		}
+		if opts.DryRun {
+			return action, score, diskerr.ErrDryRun
+		}
+		operation, err := m.setLabels(ctx, disk, zone, labels, opts)
+		if err != nil {
+			return action, score, err
+		}
+		m.bus.Publish(events.Event{Type: events.DiskMarked, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Operation: operation})
+		return action, score, nil
+	case ActionUnmark:
+		labels, err := withLabel(disk, LabelMarkedForDeletion, "false", opts.LabelBudgetPolicy)
+		if err != nil {
+			return action, score, err
+		}
+		// a snapshot taken before the disk was used again is stale
+		delete(labels, LabelSnapshotComplete)
+		if opts.DryRun {
+			return action, score, diskerr.ErrDryRun
+		}
+		operation, err := m.setLabels(ctx, disk, zone, labels, opts)
+		if err != nil {
+			return action, score, err
+		}
+		m.bus.Publish(events.Event{Type: events.DiskUnmarked, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Operation: operation})
+		return action, score, nil
+	default:
+		return action, score, xerrors.Errorf("unhandled action %s", action)
+	}
+}
+
+// Decide returns the action a Marker would take for disk with opts, and the
+// reason for a skip, without calling the API. Unlike in dry run mode, the
+// error is nil if the disk would be marked or unmarked. It is meant for
+// testing policies against disk fixtures.
+func Decide(disk *computepb.Disk, opts MarkOptions) (Action, error) {
+	opts.DryRun = true
+	action, _, err := NewMarker(nil, nil).markDisk(context.Background(), disk, diskZone(disk, opts.Zones), opts)
+	if errors.Is(err, diskerr.ErrDryRun) {
+		err = nil
+	}
+	return action, err
+}
+
+// Action is the decision taken for a disk, as reported in events.
+type Action string
+
+const (
+	ActionSkip   Action = "SKIP"
+	ActionMark   Action = "MARK"
+	ActionUnmark Action = "UNMARK"
+	ActionDelete Action = "DELETE"
+	// ActionSnapshot is the action of the snapshot phase of a cleanup.
+	ActionSnapshot Action = "SNAPSHOT"
+)
+
+// handleMarkAction decides with policy, or DefaultMarkPolicy if nil, whether
+// disk is marked or unmarked. A disk that DefaultMarkPolicy keeps is within
+// the cutoff, one that another policy keeps is kept by that policy.
+func handleMarkAction(disk *computepb.Disk, lastActivityTimestamp string, cutoff time.Duration, policy MarkPolicy) (Action, error) {
+	var lastActivityTime time.Time
+	var err error
+	// lastActivityTimestamp being empty means the disk was never used. We can use the zero time to represent this.
+	if lastActivityTimestamp != "" {
+		lastActivityTime, err = time.Parse(time.RFC3339, lastActivityTimestamp)
+		if err != nil {
+			return ActionSkip, diskerr.Wrap(diskerr.CodeInvalidTimestamp, err, "parse last activity timestamp")
+		}
+	}
+
+	kept := diskerr.ErrKeptByPolicy
+	if policy == nil || policy == DefaultMarkPolicy {
+		policy = DefaultMarkPolicy
+		kept = diskerr.ErrWithinCutoff
+	} else if s, ok := policy.(fmt.Stringer); ok {
+		kept = diskerr.New(diskerr.CodeKeptByPolicy, "disk kept by the mark policy, which marks disks %s", s)
+	}
+	labelVal, labelFound := disk.GetLabels()[LabelMarkedForDeletion]
+	markedAt, marked := parseMark(labelVal)
+	if policy.Evaluate(Candidate{Disk: disk, LastUsed: lastActivityTime, Cutoff: cutoff, Now: time.Now()}) != ActionMark {
+		// previously labelled but attached again later -> unmark
+		if marked {
+			return ActionUnmark, nil
+		}
+		return ActionSkip, kept
+	}
+	// already labelled and abandoned
+	if labelFound {
+		switch {
+		case marked && markedAt.IsZero():
+			// marked "true" by an earlier version -> date the mark, so
+			// that the grace period starts
+			return ActionMark, nil
+		case marked:
+			return ActionSkip, diskerr.ErrAlreadyMarked
+		default:
+			return ActionSkip, diskerr.ErrUnmarked
+		}
+	}
+	return ActionMark, nil
+
+}
+
+// setLabels replaces the labels of disk with diskLabels.
+func (m *Marker) setLabels(ctx context.Context, disk *computepb.Disk, zone string, diskLabels map[string]string, opts MarkOptions) (operation string, err error) {
+	diskLabelsFingerprint := disk.GetLabelFingerprint()
+	setLabelsReq := &computepb.SetLabelsDiskRequest{
+		Project: opts.ProjectID,
+		// the fingerprint changes with every update of the labels
+		RequestId: pointer.String(requestID(disk, "setLabels/"+diskLabelsFingerprint)),
+		Resource:  fmt.Sprintf("%d", disk.GetId()),
+		Zone:      zone,
+		ZoneSetLabelsRequestResource: &computepb.ZoneSetLabelsRequest{
+			Labels:           diskLabels,
+			LabelFingerprint: &diskLabelsFingerprint,
+		},
+	}
+	if err := checkZone(disk, setLabelsReq.GetZone(), opts.Zones); err != nil {
+		return "", err
+	}
+	r := retrier{maxRetries: opts.MaxRetries, backoff: callBackoff, sleep: m.sleep}
+	var op *computev1.Operation
+	err = r.do(ctx, diskLogger(opts.ProjectID, zone, disk), "setLabels", func() (err error) {
+		op, err = m.client.SetLabels(ctx, setLabelsReq)
+		return err
+	})
+	if err != nil {
+		return "", diskerr.Wrap(diskerr.CodeAPI, err, "error updating disk labels")
+	}
+	return operationName(op), nil
+}
+
+// cutoff returns the cutoff for disk, depending on its creation source.
+func (opts MarkOptions) cutoff(disk *computepb.Disk) time.Duration {
+	if cutoff, ok := opts.SourceCutoffs[DiskSource(disk)]; ok {
+		return cutoff
+	}
+	return opts.Cutoff
+}
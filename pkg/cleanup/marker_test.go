@@ -0,0 +1,839 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_MarkCmd(t *testing.T) {
+	t.Parallel()
+	type params struct {
+		ctx       context.Context
+		dc        DisksClient
+		di        diskIterator
+		bus       *events.Bus
+		projectID string
+		zone      string
+		cutoff    time.Duration
+		cutoffs   map[Source]time.Duration
+		score     *ScoreModel
+		volumes   *VolumeIndex
+		history   *AttachHistory
+		idleIO    *DiskCounts
+		tenant    Tenant
+		policy    MarkPolicy
+		boot      bool
+		dryRun    bool
+	}
+
+	setup := func(t *testing.T) *params {
+		return &params{
+			ctx:       context.Background(),
+			dc:        &disksClientMock{},
+			di:        &diskIteratorMock{},
+			bus:       events.NewBus(),
+			projectID: "testing",
+			zone:      "testzone",
+			cutoff:    30 * 24 * time.Hour,
+			dryRun:    true,
+		}
+	}
+
+	markOne := func(p *params) error {
+		return NewMarker(p.dc, p.bus).markOne(p.ctx, p.di, MarkOptions{
+			ProjectID:        p.projectID,
+			Zones:            []string{p.zone},
+			Cutoff:           p.cutoff,
+			SourceCutoffs:    p.cutoffs,
+			Policy:           p.policy,
+			ScoreModel:       p.score,
+			ExemptLabel:      DefaultExemptLabel,
+			Volumes:          p.volumes,
+			AttachHistory:    p.history,
+			IdleIO:           p.idleIO,
+			Tenant:           p.tenant,
+			IncludeBootDisks: p.boot,
+			DryRun:           p.dryRun,
+		})
+	}
+
+	t.Run("done", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return nil, iterator.Done
+			},
+		}
+
+		err := markOne(p)
+		require.EqualError(t, err, iterator.Done.Error())
+	})
+
+	t.Run("iteration error", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return nil, xerrors.Errorf("test error")
+			},
+		}
+
+		err := markOne(p)
+		require.EqualError(t, err, "iterating disks: test error")
+	})
+
+	t.Run("invalid timestamp", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String("invalid"),
+				}, nil
+			},
+		}
+		err := markOne(p)
+		require.ErrorContains(t, err, "cannot parse \"invalid\"")
+	})
+
+	t.Run("noop", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		err := markOne(p)
+		require.ErrorIs(t, err, diskerr.ErrWithinCutoff)
+	})
+
+	t.Run("noop - label already present", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+					Labels:              map[string]string{LabelMarkedForDeletion: "2022-03-01"},
+				}, nil
+			},
+		}
+		err := markOne(p)
+		require.EqualError(t, err, diskerr.ErrAlreadyMarked.Error())
+	})
+
+	t.Run("noop - unlabelled", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+					Labels:              map[string]string{LabelMarkedForDeletion: "false"},
+				}, nil
+			},
+		}
+		err := markOne(p)
+		require.EqualError(t, err, diskerr.ErrUnmarked.Error())
+	})
+
+	t.Run("dry run - mark", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		disk := &computepb.Disk{
+			Name:                pointer.String("test-disk"),
+			LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+		}
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return disk, nil
+			},
+		}
+		err := markOne(p)
+		require.EqualError(t, err, diskerr.ErrDryRun.Error())
+	})
+
+	t.Run("dry run - unmark", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		disk := &computepb.Disk{
+			Name:                pointer.String("test-disk"),
+			LastAttachTimestamp: pointer.String(time.Now().Format(time.RFC3339)),
+			Labels:              map[string]string{LabelMarkedForDeletion: "true"},
+		}
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return disk, nil
+			},
+		}
+		err := markOne(p)
+		require.EqualError(t, err, diskerr.ErrDryRun.Error())
+	})
+
+	t.Run("error updating label", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			SetLabelsFunc: func(contextMoqParam context.Context, setLabelsDiskRequest *computepb.SetLabelsDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, setLabelsDiskRequest.Project, p.projectID)
+				require.NotEmpty(t, setLabelsDiskRequest.GetRequestId())
+				return nil, xerrors.Errorf("test error")
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := markOne(p)
+		require.EqualError(t, err, "error updating disk labels: test error")
+		require.Equal(t, []events.Type{events.DiskScanned, events.Error, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("zone mismatch", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					Zone:                pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/otherzone"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		// SetLabels must not be called
+		p.dc = &disksClientMock{}
+		seen := recordEvents(p.bus)
+		err := markOne(p)
+		require.EqualError(t, err, "disk test-disk is in zone otherzone, which was not requested: testzone")
+		require.Equal(t, diskerr.CodeZoneMismatch, diskerr.CodeOf(err))
+		require.Equal(t, []events.Type{events.DiskScanned, events.Error, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("attached according to history", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.history = NewAttachHistory()
+		p.history.Add("testing", "test-disk", time.Now().AddDate(0, 0, -2))
+
+		// imported from another project, never attached here
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name: pointer.String("test-disk"),
+				}, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := markOne(p)
+		require.ErrorIs(t, err, diskerr.ErrWithinCutoff)
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("disk backs persistent volume", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.volumes = NewVolumeIndex()
+		p.volumes.Add("projects/testing/zones/testzone/disks/test-disk", VolumeOwner{PersistentVolume: "pvc-123", Claim: "default/data"})
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := markOne(p)
+		require.True(t, errors.Is(err, diskerr.ErrInUse))
+		require.EqualError(t, err, `disk test-disk backs persistent volume pvc-123 bound to claim "default/data"`)
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("exempt", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					Labels:              map[string]string{DefaultExemptLabel: "true"},
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := markOne(p)
+		require.ErrorIs(t, err, diskerr.ErrExempt)
+		require.False(t, IsFailure(err))
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("attached", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		labels := map[string]string{}
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				// attached long ago, and still attached
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					Labels:              labels,
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+					Users:               []string{"https://www.googleapis.com/compute/v1/projects/testing/zones/testzone/instances/vm-1"},
+				}, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			SetLabelsFunc: func(_ context.Context, req *computepb.SetLabelsDiskRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, "false", req.GetZoneSetLabelsRequestResource().GetLabels()[LabelMarkedForDeletion])
+				return nil, nil
+			},
+		}
+		err := markOne(p)
+		require.EqualError(t, err, "disk test-disk is attached to vm-1")
+		require.ErrorIs(t, err, diskerr.ErrAttached)
+		require.False(t, IsFailure(err))
+		require.Empty(t, p.dc.(*disksClientMock).SetLabelsCalls())
+
+		// a marked disk that is attached again is unmarked
+		labels[LabelMarkedForDeletion] = "2022-03-01"
+		require.NoError(t, markOne(p))
+		require.Len(t, p.dc.(*disksClientMock).SetLabelsCalls(), 1)
+	})
+
+	t.Run("attached without I/O", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.idleIO = NewDiskCounts()
+		p.idleIO.Add("testing", "idle-disk", 0)
+		p.idleIO.Add("testing", "busy-disk", 4096)
+
+		name := "idle-disk"
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				// attached recently to a VM nobody uses
+				return &computepb.Disk{
+					Name:                pointer.String(name),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -3).Format(time.RFC3339)),
+					Users:               []string{"https://www.googleapis.com/compute/v1/projects/testing/zones/testzone/instances/workspace"},
+				}, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			SetLabelsFunc: func(_ context.Context, req *computepb.SetLabelsDiskRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, markValue(time.Now()), req.GetZoneSetLabelsRequestResource().GetLabels()[LabelMarkedForDeletion])
+				return nil, nil
+			},
+		}
+		require.NoError(t, markOne(p))
+		require.Len(t, p.dc.(*disksClientMock).SetLabelsCalls(), 1)
+
+		// disks with I/O, or without metrics, are protected while attached
+		for _, name = range []string{"busy-disk", "unknown-disk"} {
+			require.ErrorIs(t, markOne(p), diskerr.ErrAttached, name)
+		}
+		require.Len(t, p.dc.(*disksClientMock).SetLabelsCalls(), 1)
+	})
+
+	t.Run("created within cutoff", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				// never attached, but only created recently
+				return &computepb.Disk{
+					Name:              pointer.String("test-disk"),
+					CreationTimestamp: pointer.String(time.Now().AddDate(0, 0, -3).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		require.ErrorIs(t, markOne(p), diskerr.ErrWithinCutoff)
+		require.Empty(t, p.dc.(*disksClientMock).SetLabelsCalls())
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("kept by policy", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.policy = SizeRange{MinGB: 100}
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				// past the cutoff, but too small for the policy
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					SizeGb:              pointer.Int64(10),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(-1, 0, 0).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		err := markOne(p)
+		require.ErrorIs(t, err, diskerr.ErrKeptByPolicy)
+		require.NotErrorIs(t, err, diskerr.ErrWithinCutoff)
+		require.False(t, IsFailure(err))
+		require.Empty(t, p.dc.(*disksClientMock).SetLabelsCalls())
+	})
+
+	t.Run("cutoff by source", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.cutoffs = map[Source]time.Duration{SourceImage: 90 * 24 * time.Hour}
+		p.boot = true
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				// past the cutoff, but not the one of boot disks
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					SourceImage:         pointer.String("projects/debian-cloud/global/images/debian-11"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		require.ErrorIs(t, markOne(p), diskerr.ErrWithinCutoff)
+		require.Empty(t, p.dc.(*disksClientMock).SetLabelsCalls())
+	})
+
+	t.Run("boot disk", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("gke-pool-1234-abcd"),
+					SourceImage:         pointer.String("projects/gke-node-images/global/images/gke-1217-cos"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		err := markOne(p)
+		require.ErrorIs(t, err, diskerr.ErrBootDisk)
+		require.Empty(t, p.dc.(*disksClientMock).SetLabelsCalls())
+	})
+
+	t.Run("managed", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					Labels:              map[string]string{"managed-by-cnrm": "true"},
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		err := markOne(p)
+		require.ErrorIs(t, err, diskerr.ErrManaged)
+		require.Empty(t, p.dc.(*disksClientMock).SetLabelsCalls())
+	})
+
+	t.Run("score model", func(t *testing.T) {
+		t.Parallel()
+
+		for _, tt := range []struct {
+			name      string
+			namespace string
+			expect    Action
+		}{
+			{name: "scored above threshold", namespace: "ci-1234", expect: ActionMark},
+			{name: "scored below threshold", namespace: "prod", expect: ActionSkip},
+		} {
+			tt := tt
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+				p := setup(t)
+				p.dryRun = false
+				p.score = &ScoreModel{
+					Threshold: 0.5,
+					Idle:      IdleSignal{Weight: 1},
+					Namespace: NamespaceSignal{Weight: 1, Classes: []NamespaceClass{{Pattern: "ci-*", Score: 1}, {Pattern: "prod*", Score: 0}}},
+				}
+				p.dc = &disksClientMock{
+					SetLabelsFunc: func(context.Context, *computepb.SetLabelsDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+						return nil, nil
+					},
+				}
+				p.di = &diskIteratorMock{
+					NextFunc: func() (*computepb.Disk, error) {
+						// 30 days past the cutoff of 30 days
+						return &computepb.Disk{
+							Name:                pointer.String("test-disk"),
+							Description:         pointer.String(`{"kubernetes.io/created-for/pvc/name":"data","kubernetes.io/created-for/pvc/namespace":"` + tt.namespace + `"}`),
+							LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+						}, nil
+					},
+				}
+				var scores []float64
+				p.bus.Subscribe(func(e events.Event) {
+					require.NotNil(t, e.Score)
+					scores = append(scores, *e.Score)
+				}, events.DiskScanned, events.DiskProcessed)
+
+				err := markOne(p)
+				if tt.expect == ActionSkip {
+					require.ErrorIs(t, err, diskerr.ErrLowScore)
+					require.False(t, IsFailure(err))
+					require.Empty(t, p.dc.(*disksClientMock).SetLabelsCalls())
+				} else {
+					require.NoError(t, err)
+					require.Len(t, p.dc.(*disksClientMock).SetLabelsCalls(), 1)
+				}
+				require.Len(t, scores, 2)
+				require.Equal(t, scores[0], scores[1])
+			})
+		}
+	})
+
+	t.Run("tenant mismatch", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+		p.tenant = Tenant{Label: "team", Value: "payments"}
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := markOne(p)
+		require.EqualError(t, err, "disk test-disk does not carry the tenant label team")
+		require.Equal(t, diskerr.CodeTenantMismatch, diskerr.CodeOf(err))
+		require.True(t, IsFailure(err))
+		require.Equal(t, []events.Type{events.DiskScanned, events.Error, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("label budget exhausted", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		labels := make(map[string]string, MaxLabels)
+		for i := 0; i < MaxLabels; i++ {
+			labels[fmt.Sprintf("label-%d", i)] = "value"
+		}
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+					Labels:              labels,
+				}, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := markOne(p)
+		require.True(t, errors.Is(err, diskerr.ErrLabelBudgetExhausted))
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("success - mark", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+				}, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			SetLabelsFunc: func(contextMoqParam context.Context, setLabelsDiskRequest *computepb.SetLabelsDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, setLabelsDiskRequest.Project, p.projectID)
+				require.Equal(t, markValue(time.Now()), setLabelsDiskRequest.ZoneSetLabelsRequestResource.Labels[LabelMarkedForDeletion])
+				require.NotEmpty(t, setLabelsDiskRequest.GetRequestId())
+				return nil, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := markOne(p)
+		require.NoError(t, err)
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskMarked, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("success - unmark", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("important-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().Format(time.RFC3339)),
+					Labels:              map[string]string{LabelMarkedForDeletion: "2022-03-01", LabelSnapshotComplete: "important-disk"},
+				}, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			SetLabelsFunc: func(contextMoqParam context.Context, setLabelsDiskRequest *computepb.SetLabelsDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, setLabelsDiskRequest.Project, p.projectID)
+				require.Equal(t, "false", setLabelsDiskRequest.ZoneSetLabelsRequestResource.Labels[LabelMarkedForDeletion])
+				require.NotContains(t, setLabelsDiskRequest.ZoneSetLabelsRequestResource.Labels, LabelSnapshotComplete)
+				require.NotEmpty(t, setLabelsDiskRequest.GetRequestId())
+				return nil, nil
+			},
+		}
+		seen := recordEvents(p.bus)
+		err := markOne(p)
+		require.NoError(t, err)
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskUnmarked, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("success - date undated mark", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+					Labels:              map[string]string{LabelMarkedForDeletion: "true"},
+				}, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			SetLabelsFunc: func(contextMoqParam context.Context, setLabelsDiskRequest *computepb.SetLabelsDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, markValue(time.Now()), setLabelsDiskRequest.ZoneSetLabelsRequestResource.Labels[LabelMarkedForDeletion])
+				return nil, nil
+			},
+		}
+		err := markOne(p)
+		require.NoError(t, err)
+	})
+
+	t.Run("success - never attached", func(t *testing.T) {
+		t.Parallel()
+		p := setup(t)
+		p.dryRun = false
+
+		p.di = &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{
+					Name:                pointer.String("test-disk"),
+					LastAttachTimestamp: pointer.String(""),
+				}, nil
+			},
+		}
+		p.dc = &disksClientMock{
+			SetLabelsFunc: func(contextMoqParam context.Context, setLabelsDiskRequest *computepb.SetLabelsDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, setLabelsDiskRequest.Project, p.projectID)
+				require.Equal(t, markValue(time.Now()), setLabelsDiskRequest.ZoneSetLabelsRequestResource.Labels[LabelMarkedForDeletion])
+				require.NotEmpty(t, setLabelsDiskRequest.GetRequestId())
+				return nil, nil
+			},
+		}
+		err := markOne(p)
+		require.NoError(t, err)
+	})
+}
+
+func Test_HandleMarkAction(t *testing.T) {
+	testCases := []struct {
+		name                string
+		lastAttachTimestamp string
+		labels              map[string]string
+		cutoff              time.Duration
+		policy              MarkPolicy
+		expectedAction      Action
+		expectedError       string
+	}{
+		{
+			name:                "should mark empty timestamp",
+			lastAttachTimestamp: "",
+			labels:              nil,
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionMark,
+			expectedError:       "",
+		},
+		{
+			name:                "should skip already marked empty timestamp",
+			lastAttachTimestamp: "",
+			labels:              map[string]string{LabelMarkedForDeletion: "2022-03-01"},
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionSkip,
+			expectedError:       diskerr.ErrAlreadyMarked.Error(),
+		},
+		{
+			name:                "should skip invalid timestamp",
+			lastAttachTimestamp: "foobarbaz",
+			labels:              nil,
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionSkip,
+			expectedError:       `parse last activity timestamp: parsing time "foobarbaz" as "2006-01-02T15:04:05Z07:00": cannot parse "foobarbaz" as "2006"`,
+		},
+		{
+			name:                "should skip already marked for deletion if last attached before cutoff",
+			lastAttachTimestamp: time.Now().AddDate(-1, 0, 0).Format(time.RFC3339),
+			labels:              map[string]string{LabelMarkedForDeletion: "2022-03-01"},
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionSkip,
+			expectedError:       diskerr.ErrAlreadyMarked.Error(),
+		},
+		{
+			name:                "should date undated mark if last attached before cutoff",
+			lastAttachTimestamp: time.Now().AddDate(-1, 0, 0).Format(time.RFC3339),
+			labels:              map[string]string{LabelMarkedForDeletion: "true"},
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionMark,
+			expectedError:       "",
+		},
+		{
+			name:                "should skip already unmarked if last attached before cutoff",
+			lastAttachTimestamp: time.Now().AddDate(-1, 0, 0).Format(time.RFC3339),
+			labels:              map[string]string{LabelMarkedForDeletion: `anything not a date or "true" is interpreted as false`},
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionSkip,
+			expectedError:       diskerr.ErrUnmarked.Error(),
+		},
+		{
+			name:                "should mark for deletion if last attached before cutoff",
+			lastAttachTimestamp: time.Now().AddDate(-1, 0, 0).Format(time.RFC3339),
+			labels:              nil,
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionMark,
+			expectedError:       "",
+		},
+		{
+			name:                "should unmark if already marked and last attached within cutoff",
+			lastAttachTimestamp: time.Now().Format(time.RFC3339),
+			labels:              map[string]string{LabelMarkedForDeletion: "2022-03-01"},
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionUnmark,
+			expectedError:       "",
+		},
+		{
+			name:                "should unmark if marked without date and last attached within cutoff",
+			lastAttachTimestamp: time.Now().Format(time.RFC3339),
+			labels:              map[string]string{LabelMarkedForDeletion: "true"},
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionUnmark,
+			expectedError:       "",
+		},
+		{
+			name:                "should skip if not already marked and last attached within cutoff",
+			lastAttachTimestamp: time.Now().Format(time.RFC3339),
+			labels:              nil,
+			cutoff:              24 * time.Hour,
+			expectedAction:      ActionSkip,
+			expectedError:       diskerr.ErrWithinCutoff.Error(),
+		},
+		{
+			name:                "should skip if last attached before cutoff but kept by the policy",
+			lastAttachTimestamp: time.Now().AddDate(-1, 0, 0).Format(time.RFC3339),
+			labels:              nil,
+			cutoff:              24 * time.Hour,
+			policy:              AllOf{LastAttachAge{}, LabelMatch{Key: "env", Value: "dev"}},
+			expectedAction:      ActionSkip,
+			expectedError:       "disk kept by the mark policy, which marks disks all of (unused past the cutoff, labelled env=dev)",
+		},
+		{
+			name:                "should unmark if marked and kept by the policy",
+			lastAttachTimestamp: time.Now().AddDate(-1, 0, 0).Format(time.RFC3339),
+			labels:              map[string]string{LabelMarkedForDeletion: "2022-03-01"},
+			cutoff:              24 * time.Hour,
+			policy:              SizeRange{MinGB: 100},
+			expectedAction:      ActionUnmark,
+			expectedError:       "",
+		},
+		{
+			name:                "should mark if last attached within cutoff but abandoned by the policy",
+			lastAttachTimestamp: time.Now().Format(time.RFC3339),
+			labels:              map[string]string{"env": "dev"},
+			cutoff:              24 * time.Hour,
+			policy:              AnyOf{LastAttachAge{}, LabelMatch{Key: "env", Value: "dev"}},
+			expectedAction:      ActionMark,
+			expectedError:       "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			actualAction, actualError := handleMarkAction(&computepb.Disk{Labels: testCase.labels}, testCase.lastAttachTimestamp, testCase.cutoff, testCase.policy)
+			require.Equal(t, testCase.expectedAction, actualAction)
+			if testCase.expectedError == "" {
+				require.NoError(t, actualError)
+			} else {
+				require.Equal(t, testCase.expectedError, actualError.Error())
+			}
+		})
+	}
+}
+
+// recordEvents returns the types of all events published on bus from now on.
+func recordEvents(bus *events.Bus) *[]events.Type {
+	var seen []events.Type
+	bus.Subscribe(func(e events.Event) {
+		seen = append(seen, e.Type)
+	})
+	return &seen
+}
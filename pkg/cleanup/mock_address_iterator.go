@@ -0,0 +1,69 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"sync"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that addressIteratorMock does implement addressIterator.
+// If this is not the case, regenerate this file with moq.
+var _ addressIterator = &addressIteratorMock{}
+
+// addressIteratorMock is a mock implementation of addressIterator.
+//
+//	func TestSomethingThatUsesaddressIterator(t *testing.T) {
+//
+//		// make and configure a mocked addressIterator
+//		mockedaddressIterator := &addressIteratorMock{
+//			NextFunc: func() (*computepb.Address, error) {
+//				panic("mock out the Next method")
+//			},
+//		}
+//
+//		// use mockedaddressIterator in code that requires addressIterator
+//		// and then make assertions.
+//
+//	}
+type addressIteratorMock struct {
+	// NextFunc mocks the Next method.
+	NextFunc func() (*computepb.Address, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Next holds details about calls to the Next method.
+		Next []struct {
+		}
+	}
+	lockNext sync.RWMutex
+}
+
+// Next calls NextFunc.
+func (mock *addressIteratorMock) Next() (*computepb.Address, error) {
+	if mock.NextFunc == nil {
+		panic("addressIteratorMock.NextFunc: method is nil but addressIterator.Next was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockNext.Lock()
+	mock.calls.Next = append(mock.calls.Next, callInfo)
+	mock.lockNext.Unlock()
+	return mock.NextFunc()
+}
+
+// NextCalls gets all the calls that were made to Next.
+// Check the length with:
+//
+//	len(mockedaddressIterator.NextCalls())
+func (mock *addressIteratorMock) NextCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockNext.RLock()
+	calls = mock.calls.Next
+	mock.lockNext.RUnlock()
+	return calls
+}
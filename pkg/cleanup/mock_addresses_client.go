@@ -0,0 +1,147 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"context"
+	"sync"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that addressesClientMock does implement AddressesClient.
+// If this is not the case, regenerate this file with moq.
+var _ AddressesClient = &addressesClientMock{}
+
+// addressesClientMock is a mock implementation of AddressesClient.
+//
+//	func TestSomethingThatUsesAddressesClient(t *testing.T) {
+//
+//		// make and configure a mocked AddressesClient
+//		mockedAddressesClient := &addressesClientMock{
+//			AggregatedListFunc: func(contextMoqParam context.Context, aggregatedListAddressesRequest *computepb.AggregatedListAddressesRequest, callOptions ...gax.CallOption) *computev1.AddressesScopedListPairIterator {
+//				panic("mock out the AggregatedList method")
+//			},
+//			DeleteFunc: func(contextMoqParam context.Context, deleteAddressRequest *computepb.DeleteAddressRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Delete method")
+//			},
+//		}
+//
+//		// use mockedAddressesClient in code that requires AddressesClient
+//		// and then make assertions.
+//
+//	}
+type addressesClientMock struct {
+	// AggregatedListFunc mocks the AggregatedList method.
+	AggregatedListFunc func(contextMoqParam context.Context, aggregatedListAddressesRequest *computepb.AggregatedListAddressesRequest, callOptions ...gax.CallOption) *computev1.AddressesScopedListPairIterator
+
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(contextMoqParam context.Context, deleteAddressRequest *computepb.DeleteAddressRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// AggregatedList holds details about calls to the AggregatedList method.
+		AggregatedList []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// AggregatedListAddressesRequest is the aggregatedListAddressesRequest argument value.
+			AggregatedListAddressesRequest *computepb.AggregatedListAddressesRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DeleteAddressRequest is the deleteAddressRequest argument value.
+			DeleteAddressRequest *computepb.DeleteAddressRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+	}
+	lockAggregatedList sync.RWMutex
+	lockDelete         sync.RWMutex
+}
+
+// AggregatedList calls AggregatedListFunc.
+func (mock *addressesClientMock) AggregatedList(contextMoqParam context.Context, aggregatedListAddressesRequest *computepb.AggregatedListAddressesRequest, callOptions ...gax.CallOption) *computev1.AddressesScopedListPairIterator {
+	if mock.AggregatedListFunc == nil {
+		panic("addressesClientMock.AggregatedListFunc: method is nil but AddressesClient.AggregatedList was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam                context.Context
+		AggregatedListAddressesRequest *computepb.AggregatedListAddressesRequest
+		CallOptions                    []gax.CallOption
+	}{
+		ContextMoqParam:                contextMoqParam,
+		AggregatedListAddressesRequest: aggregatedListAddressesRequest,
+		CallOptions:                    callOptions,
+	}
+	mock.lockAggregatedList.Lock()
+	mock.calls.AggregatedList = append(mock.calls.AggregatedList, callInfo)
+	mock.lockAggregatedList.Unlock()
+	return mock.AggregatedListFunc(contextMoqParam, aggregatedListAddressesRequest, callOptions...)
+}
+
+// AggregatedListCalls gets all the calls that were made to AggregatedList.
+// Check the length with:
+//
+//	len(mockedAddressesClient.AggregatedListCalls())
+func (mock *addressesClientMock) AggregatedListCalls() []struct {
+	ContextMoqParam                context.Context
+	AggregatedListAddressesRequest *computepb.AggregatedListAddressesRequest
+	CallOptions                    []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam                context.Context
+		AggregatedListAddressesRequest *computepb.AggregatedListAddressesRequest
+		CallOptions                    []gax.CallOption
+	}
+	mock.lockAggregatedList.RLock()
+	calls = mock.calls.AggregatedList
+	mock.lockAggregatedList.RUnlock()
+	return calls
+}
+
+// Delete calls DeleteFunc.
+func (mock *addressesClientMock) Delete(contextMoqParam context.Context, deleteAddressRequest *computepb.DeleteAddressRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+	if mock.DeleteFunc == nil {
+		panic("addressesClientMock.DeleteFunc: method is nil but AddressesClient.Delete was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam      context.Context
+		DeleteAddressRequest *computepb.DeleteAddressRequest
+		CallOptions          []gax.CallOption
+	}{
+		ContextMoqParam:      contextMoqParam,
+		DeleteAddressRequest: deleteAddressRequest,
+		CallOptions:          callOptions,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(contextMoqParam, deleteAddressRequest, callOptions...)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedAddressesClient.DeleteCalls())
+func (mock *addressesClientMock) DeleteCalls() []struct {
+	ContextMoqParam      context.Context
+	DeleteAddressRequest *computepb.DeleteAddressRequest
+	CallOptions          []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam      context.Context
+		DeleteAddressRequest *computepb.DeleteAddressRequest
+		CallOptions          []gax.CallOption
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
@@ -1,7 +1,7 @@
 // Code generated by moq; DO NOT EDIT.
 // github.com/matryer/moq
 
-package main
+package cleanup
 
 import (
 	"sync"
@@ -15,19 +15,19 @@ var _ diskIterator = &diskIteratorMock{}
 
 // diskIteratorMock is a mock implementation of diskIterator.
 //
-// 	func TestSomethingThatUsesdiskIterator(t *testing.T) {
+//	func TestSomethingThatUsesdiskIterator(t *testing.T) {
 //
-// 		// make and configure a mocked diskIterator
-// 		mockeddiskIterator := &diskIteratorMock{
-// 			NextFunc: func() (*computepb.Disk, error) {
-// 				panic("mock out the Next method")
-// 			},
-// 		}
+//		// make and configure a mocked diskIterator
+//		mockeddiskIterator := &diskIteratorMock{
+//			NextFunc: func() (*computepb.Disk, error) {
+//				panic("mock out the Next method")
+//			},
+//		}
 //
-// 		// use mockeddiskIterator in code that requires diskIterator
-// 		// and then make assertions.
+//		// use mockeddiskIterator in code that requires diskIterator
+//		// and then make assertions.
 //
-// 	}
+//	}
 type diskIteratorMock struct {
 	// NextFunc mocks the Next method.
 	NextFunc func() (*computepb.Disk, error)
@@ -56,7 +56,8 @@ func (mock *diskIteratorMock) Next() (*computepb.Disk, error) {
 
 // NextCalls gets all the calls that were made to Next.
 // Check the length with:
-//     len(mockeddiskIterator.NextCalls())
+//
+//	len(mockeddiskIterator.NextCalls())
 func (mock *diskIteratorMock) NextCalls() []struct {
 } {
 	var calls []struct {
@@ -1,7 +1,7 @@
 // Code generated by moq; DO NOT EDIT.
 // github.com/matryer/moq
 
-package main
+package cleanup
 
 import (
 	"context"
@@ -12,41 +12,53 @@ import (
 	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
 )
 
-// Ensure, that disksClientMock does implement disksClient.
+// Ensure, that disksClientMock does implement DisksClient.
 // If this is not the case, regenerate this file with moq.
-var _ disksClient = &disksClientMock{}
+var _ DisksClient = &disksClientMock{}
 
-// disksClientMock is a mock implementation of disksClient.
+// disksClientMock is a mock implementation of DisksClient.
 //
-// 	func TestSomethingThatUsesdisksClient(t *testing.T) {
+//	func TestSomethingThatUsesDisksClient(t *testing.T) {
 //
-// 		// make and configure a mocked disksClient
-// 		mockeddisksClient := &disksClientMock{
-// 			CreateSnapshotFunc: func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
-// 				panic("mock out the CreateSnapshot method")
-// 			},
-// 			DeleteFunc: func(contextMoqParam context.Context, deleteDiskRequest *computepb.DeleteDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
-// 				panic("mock out the Delete method")
-// 			},
-// 			ListFunc: func(contextMoqParam context.Context, listDisksRequest *computepb.ListDisksRequest, callOptions ...gax.CallOption) *computev1.DiskIterator {
-// 				panic("mock out the List method")
-// 			},
-// 			SetLabelsFunc: func(contextMoqParam context.Context, setLabelsDiskRequest *computepb.SetLabelsDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
-// 				panic("mock out the SetLabels method")
-// 			},
-// 		}
+//		// make and configure a mocked DisksClient
+//		mockedDisksClient := &disksClientMock{
+//			AggregatedListFunc: func(contextMoqParam context.Context, aggregatedListDisksRequest *computepb.AggregatedListDisksRequest, callOptions ...gax.CallOption) *computev1.DisksScopedListPairIterator {
+//				panic("mock out the AggregatedList method")
+//			},
+//			CreateSnapshotFunc: func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the CreateSnapshot method")
+//			},
+//			DeleteFunc: func(contextMoqParam context.Context, deleteDiskRequest *computepb.DeleteDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Delete method")
+//			},
+//			InsertFunc: func(contextMoqParam context.Context, insertDiskRequest *computepb.InsertDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Insert method")
+//			},
+//			ListFunc: func(contextMoqParam context.Context, listDisksRequest *computepb.ListDisksRequest, callOptions ...gax.CallOption) *computev1.DiskIterator {
+//				panic("mock out the List method")
+//			},
+//			SetLabelsFunc: func(contextMoqParam context.Context, setLabelsDiskRequest *computepb.SetLabelsDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the SetLabels method")
+//			},
+//		}
 //
-// 		// use mockeddisksClient in code that requires disksClient
-// 		// and then make assertions.
+//		// use mockedDisksClient in code that requires DisksClient
+//		// and then make assertions.
 //
-// 	}
+//	}
 type disksClientMock struct {
+	// AggregatedListFunc mocks the AggregatedList method.
+	AggregatedListFunc func(contextMoqParam context.Context, aggregatedListDisksRequest *computepb.AggregatedListDisksRequest, callOptions ...gax.CallOption) *computev1.DisksScopedListPairIterator
+
 	// CreateSnapshotFunc mocks the CreateSnapshot method.
 	CreateSnapshotFunc func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
 
 	// DeleteFunc mocks the Delete method.
 	DeleteFunc func(contextMoqParam context.Context, deleteDiskRequest *computepb.DeleteDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
 
+	// InsertFunc mocks the Insert method.
+	InsertFunc func(contextMoqParam context.Context, insertDiskRequest *computepb.InsertDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
+
 	// ListFunc mocks the List method.
 	ListFunc func(contextMoqParam context.Context, listDisksRequest *computepb.ListDisksRequest, callOptions ...gax.CallOption) *computev1.DiskIterator
 
@@ -55,6 +67,15 @@ type disksClientMock struct {
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// AggregatedList holds details about calls to the AggregatedList method.
+		AggregatedList []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// AggregatedListDisksRequest is the aggregatedListDisksRequest argument value.
+			AggregatedListDisksRequest *computepb.AggregatedListDisksRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
 		// CreateSnapshot holds details about calls to the CreateSnapshot method.
 		CreateSnapshot []struct {
 			// ContextMoqParam is the contextMoqParam argument value.
@@ -73,6 +94,15 @@ type disksClientMock struct {
 			// CallOptions is the callOptions argument value.
 			CallOptions []gax.CallOption
 		}
+		// Insert holds details about calls to the Insert method.
+		Insert []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// InsertDiskRequest is the insertDiskRequest argument value.
+			InsertDiskRequest *computepb.InsertDiskRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
 		// List holds details about calls to the List method.
 		List []struct {
 			// ContextMoqParam is the contextMoqParam argument value.
@@ -92,16 +122,58 @@ type disksClientMock struct {
 			CallOptions []gax.CallOption
 		}
 	}
+	lockAggregatedList sync.RWMutex
 	lockCreateSnapshot sync.RWMutex
 	lockDelete         sync.RWMutex
+	lockInsert         sync.RWMutex
 	lockList           sync.RWMutex
 	lockSetLabels      sync.RWMutex
 }
 
+// AggregatedList calls AggregatedListFunc.
+func (mock *disksClientMock) AggregatedList(contextMoqParam context.Context, aggregatedListDisksRequest *computepb.AggregatedListDisksRequest, callOptions ...gax.CallOption) *computev1.DisksScopedListPairIterator {
+	if mock.AggregatedListFunc == nil {
+		panic("disksClientMock.AggregatedListFunc: method is nil but DisksClient.AggregatedList was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam            context.Context
+		AggregatedListDisksRequest *computepb.AggregatedListDisksRequest
+		CallOptions                []gax.CallOption
+	}{
+		ContextMoqParam:            contextMoqParam,
+		AggregatedListDisksRequest: aggregatedListDisksRequest,
+		CallOptions:                callOptions,
+	}
+	mock.lockAggregatedList.Lock()
+	mock.calls.AggregatedList = append(mock.calls.AggregatedList, callInfo)
+	mock.lockAggregatedList.Unlock()
+	return mock.AggregatedListFunc(contextMoqParam, aggregatedListDisksRequest, callOptions...)
+}
+
+// AggregatedListCalls gets all the calls that were made to AggregatedList.
+// Check the length with:
+//
+//	len(mockedDisksClient.AggregatedListCalls())
+func (mock *disksClientMock) AggregatedListCalls() []struct {
+	ContextMoqParam            context.Context
+	AggregatedListDisksRequest *computepb.AggregatedListDisksRequest
+	CallOptions                []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam            context.Context
+		AggregatedListDisksRequest *computepb.AggregatedListDisksRequest
+		CallOptions                []gax.CallOption
+	}
+	mock.lockAggregatedList.RLock()
+	calls = mock.calls.AggregatedList
+	mock.lockAggregatedList.RUnlock()
+	return calls
+}
+
 // CreateSnapshot calls CreateSnapshotFunc.
 func (mock *disksClientMock) CreateSnapshot(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
 	if mock.CreateSnapshotFunc == nil {
-		panic("disksClientMock.CreateSnapshotFunc: method is nil but disksClient.CreateSnapshot was just called")
+		panic("disksClientMock.CreateSnapshotFunc: method is nil but DisksClient.CreateSnapshot was just called")
 	}
 	callInfo := struct {
 		ContextMoqParam           context.Context
@@ -120,7 +192,8 @@ func (mock *disksClientMock) CreateSnapshot(contextMoqParam context.Context, cre
 
 // CreateSnapshotCalls gets all the calls that were made to CreateSnapshot.
 // Check the length with:
-//     len(mockeddisksClient.CreateSnapshotCalls())
+//
+//	len(mockedDisksClient.CreateSnapshotCalls())
 func (mock *disksClientMock) CreateSnapshotCalls() []struct {
 	ContextMoqParam           context.Context
 	CreateSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest
@@ -140,7 +213,7 @@ func (mock *disksClientMock) CreateSnapshotCalls() []struct {
 // Delete calls DeleteFunc.
 func (mock *disksClientMock) Delete(contextMoqParam context.Context, deleteDiskRequest *computepb.DeleteDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
 	if mock.DeleteFunc == nil {
-		panic("disksClientMock.DeleteFunc: method is nil but disksClient.Delete was just called")
+		panic("disksClientMock.DeleteFunc: method is nil but DisksClient.Delete was just called")
 	}
 	callInfo := struct {
 		ContextMoqParam   context.Context
@@ -159,7 +232,8 @@ func (mock *disksClientMock) Delete(contextMoqParam context.Context, deleteDiskR
 
 // DeleteCalls gets all the calls that were made to Delete.
 // Check the length with:
-//     len(mockeddisksClient.DeleteCalls())
+//
+//	len(mockedDisksClient.DeleteCalls())
 func (mock *disksClientMock) DeleteCalls() []struct {
 	ContextMoqParam   context.Context
 	DeleteDiskRequest *computepb.DeleteDiskRequest
@@ -176,10 +250,50 @@ func (mock *disksClientMock) DeleteCalls() []struct {
 	return calls
 }
 
+// Insert calls InsertFunc.
+func (mock *disksClientMock) Insert(contextMoqParam context.Context, insertDiskRequest *computepb.InsertDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+	if mock.InsertFunc == nil {
+		panic("disksClientMock.InsertFunc: method is nil but DisksClient.Insert was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam   context.Context
+		InsertDiskRequest *computepb.InsertDiskRequest
+		CallOptions       []gax.CallOption
+	}{
+		ContextMoqParam:   contextMoqParam,
+		InsertDiskRequest: insertDiskRequest,
+		CallOptions:       callOptions,
+	}
+	mock.lockInsert.Lock()
+	mock.calls.Insert = append(mock.calls.Insert, callInfo)
+	mock.lockInsert.Unlock()
+	return mock.InsertFunc(contextMoqParam, insertDiskRequest, callOptions...)
+}
+
+// InsertCalls gets all the calls that were made to Insert.
+// Check the length with:
+//
+//	len(mockedDisksClient.InsertCalls())
+func (mock *disksClientMock) InsertCalls() []struct {
+	ContextMoqParam   context.Context
+	InsertDiskRequest *computepb.InsertDiskRequest
+	CallOptions       []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam   context.Context
+		InsertDiskRequest *computepb.InsertDiskRequest
+		CallOptions       []gax.CallOption
+	}
+	mock.lockInsert.RLock()
+	calls = mock.calls.Insert
+	mock.lockInsert.RUnlock()
+	return calls
+}
+
 // List calls ListFunc.
 func (mock *disksClientMock) List(contextMoqParam context.Context, listDisksRequest *computepb.ListDisksRequest, callOptions ...gax.CallOption) *computev1.DiskIterator {
 	if mock.ListFunc == nil {
-		panic("disksClientMock.ListFunc: method is nil but disksClient.List was just called")
+		panic("disksClientMock.ListFunc: method is nil but DisksClient.List was just called")
 	}
 	callInfo := struct {
 		ContextMoqParam  context.Context
@@ -198,7 +312,8 @@ func (mock *disksClientMock) List(contextMoqParam context.Context, listDisksRequ
 
 // ListCalls gets all the calls that were made to List.
 // Check the length with:
-//     len(mockeddisksClient.ListCalls())
+//
+//	len(mockedDisksClient.ListCalls())
 func (mock *disksClientMock) ListCalls() []struct {
 	ContextMoqParam  context.Context
 	ListDisksRequest *computepb.ListDisksRequest
@@ -218,7 +333,7 @@ func (mock *disksClientMock) ListCalls() []struct {
 // SetLabels calls SetLabelsFunc.
 func (mock *disksClientMock) SetLabels(contextMoqParam context.Context, setLabelsDiskRequest *computepb.SetLabelsDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
 	if mock.SetLabelsFunc == nil {
-		panic("disksClientMock.SetLabelsFunc: method is nil but disksClient.SetLabels was just called")
+		panic("disksClientMock.SetLabelsFunc: method is nil but DisksClient.SetLabels was just called")
 	}
 	callInfo := struct {
 		ContextMoqParam      context.Context
@@ -237,7 +352,8 @@ func (mock *disksClientMock) SetLabels(contextMoqParam context.Context, setLabel
 
 // SetLabelsCalls gets all the calls that were made to SetLabels.
 // Check the length with:
-//     len(mockeddisksClient.SetLabelsCalls())
+//
+//	len(mockedDisksClient.SetLabelsCalls())
 func (mock *disksClientMock) SetLabelsCalls() []struct {
 	ContextMoqParam      context.Context
 	SetLabelsDiskRequest *computepb.SetLabelsDiskRequest
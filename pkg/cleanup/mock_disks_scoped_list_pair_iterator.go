@@ -0,0 +1,107 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"sync"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"google.golang.org/api/iterator"
+)
+
+// Ensure, that disksScopedListPairIteratorMock does implement disksScopedListPairIterator.
+// If this is not the case, regenerate this file with moq.
+var _ disksScopedListPairIterator = &disksScopedListPairIteratorMock{}
+
+// disksScopedListPairIteratorMock is a mock implementation of disksScopedListPairIterator.
+//
+//	func TestSomethingThatUsesdisksScopedListPairIterator(t *testing.T) {
+//
+//		// make and configure a mocked disksScopedListPairIterator
+//		mockeddisksScopedListPairIterator := &disksScopedListPairIteratorMock{
+//			NextFunc: func() (computev1.DisksScopedListPair, error) {
+//				panic("mock out the Next method")
+//			},
+//			PageInfoFunc: func() *iterator.PageInfo {
+//				panic("mock out the PageInfo method")
+//			},
+//		}
+//
+//		// use mockeddisksScopedListPairIterator in code that requires disksScopedListPairIterator
+//		// and then make assertions.
+//
+//	}
+type disksScopedListPairIteratorMock struct {
+	// NextFunc mocks the Next method.
+	NextFunc func() (computev1.DisksScopedListPair, error)
+
+	// PageInfoFunc mocks the PageInfo method.
+	PageInfoFunc func() *iterator.PageInfo
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Next holds details about calls to the Next method.
+		Next []struct {
+		}
+		// PageInfo holds details about calls to the PageInfo method.
+		PageInfo []struct {
+		}
+	}
+	lockNext     sync.RWMutex
+	lockPageInfo sync.RWMutex
+}
+
+// Next calls NextFunc.
+func (mock *disksScopedListPairIteratorMock) Next() (computev1.DisksScopedListPair, error) {
+	if mock.NextFunc == nil {
+		panic("disksScopedListPairIteratorMock.NextFunc: method is nil but disksScopedListPairIterator.Next was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockNext.Lock()
+	mock.calls.Next = append(mock.calls.Next, callInfo)
+	mock.lockNext.Unlock()
+	return mock.NextFunc()
+}
+
+// NextCalls gets all the calls that were made to Next.
+// Check the length with:
+//
+//	len(mockeddisksScopedListPairIterator.NextCalls())
+func (mock *disksScopedListPairIteratorMock) NextCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockNext.RLock()
+	calls = mock.calls.Next
+	mock.lockNext.RUnlock()
+	return calls
+}
+
+// PageInfo calls PageInfoFunc.
+func (mock *disksScopedListPairIteratorMock) PageInfo() *iterator.PageInfo {
+	if mock.PageInfoFunc == nil {
+		panic("disksScopedListPairIteratorMock.PageInfoFunc: method is nil but disksScopedListPairIterator.PageInfo was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockPageInfo.Lock()
+	mock.calls.PageInfo = append(mock.calls.PageInfo, callInfo)
+	mock.lockPageInfo.Unlock()
+	return mock.PageInfoFunc()
+}
+
+// PageInfoCalls gets all the calls that were made to PageInfo.
+// Check the length with:
+//
+//	len(mockeddisksScopedListPairIterator.PageInfoCalls())
+func (mock *disksScopedListPairIteratorMock) PageInfoCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockPageInfo.RLock()
+	calls = mock.calls.PageInfo
+	mock.lockPageInfo.RUnlock()
+	return calls
+}
@@ -0,0 +1,96 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"context"
+	"gke-disk-cleanup/pkg/events"
+	"sync"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that exporterMock does implement Exporter.
+// If this is not the case, regenerate this file with moq.
+var _ Exporter = &exporterMock{}
+
+// exporterMock is a mock implementation of Exporter.
+//
+//	func TestSomethingThatUsesExporter(t *testing.T) {
+//
+//		// make and configure a mocked Exporter
+//		mockedExporter := &exporterMock{
+//			ExportFunc: func(ctx context.Context, projectID string, zone string, disk *computepb.Disk) (*events.Export, error) {
+//				panic("mock out the Export method")
+//			},
+//		}
+//
+//		// use mockedExporter in code that requires Exporter
+//		// and then make assertions.
+//
+//	}
+type exporterMock struct {
+	// ExportFunc mocks the Export method.
+	ExportFunc func(ctx context.Context, projectID string, zone string, disk *computepb.Disk) (*events.Export, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Export holds details about calls to the Export method.
+		Export []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ProjectID is the projectID argument value.
+			ProjectID string
+			// Zone is the zone argument value.
+			Zone string
+			// Disk is the disk argument value.
+			Disk *computepb.Disk
+		}
+	}
+	lockExport sync.RWMutex
+}
+
+// Export calls ExportFunc.
+func (mock *exporterMock) Export(ctx context.Context, projectID string, zone string, disk *computepb.Disk) (*events.Export, error) {
+	if mock.ExportFunc == nil {
+		panic("exporterMock.ExportFunc: method is nil but Exporter.Export was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		ProjectID string
+		Zone      string
+		Disk      *computepb.Disk
+	}{
+		Ctx:       ctx,
+		ProjectID: projectID,
+		Zone:      zone,
+		Disk:      disk,
+	}
+	mock.lockExport.Lock()
+	mock.calls.Export = append(mock.calls.Export, callInfo)
+	mock.lockExport.Unlock()
+	return mock.ExportFunc(ctx, projectID, zone, disk)
+}
+
+// ExportCalls gets all the calls that were made to Export.
+// Check the length with:
+//
+//	len(mockedExporter.ExportCalls())
+func (mock *exporterMock) ExportCalls() []struct {
+	Ctx       context.Context
+	ProjectID string
+	Zone      string
+	Disk      *computepb.Disk
+} {
+	var calls []struct {
+		Ctx       context.Context
+		ProjectID string
+		Zone      string
+		Disk      *computepb.Disk
+	}
+	mock.lockExport.RLock()
+	calls = mock.calls.Export
+	mock.lockExport.RUnlock()
+	return calls
+}
@@ -0,0 +1,147 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"context"
+	"sync"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that firewallsClientMock does implement FirewallsClient.
+// If this is not the case, regenerate this file with moq.
+var _ FirewallsClient = &firewallsClientMock{}
+
+// firewallsClientMock is a mock implementation of FirewallsClient.
+//
+//	func TestSomethingThatUsesFirewallsClient(t *testing.T) {
+//
+//		// make and configure a mocked FirewallsClient
+//		mockedFirewallsClient := &firewallsClientMock{
+//			DeleteFunc: func(contextMoqParam context.Context, deleteFirewallRequest *computepb.DeleteFirewallRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Delete method")
+//			},
+//			ListFunc: func(contextMoqParam context.Context, listFirewallsRequest *computepb.ListFirewallsRequest, callOptions ...gax.CallOption) *computev1.FirewallIterator {
+//				panic("mock out the List method")
+//			},
+//		}
+//
+//		// use mockedFirewallsClient in code that requires FirewallsClient
+//		// and then make assertions.
+//
+//	}
+type firewallsClientMock struct {
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(contextMoqParam context.Context, deleteFirewallRequest *computepb.DeleteFirewallRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
+
+	// ListFunc mocks the List method.
+	ListFunc func(contextMoqParam context.Context, listFirewallsRequest *computepb.ListFirewallsRequest, callOptions ...gax.CallOption) *computev1.FirewallIterator
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DeleteFirewallRequest is the deleteFirewallRequest argument value.
+			DeleteFirewallRequest *computepb.DeleteFirewallRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+		// List holds details about calls to the List method.
+		List []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// ListFirewallsRequest is the listFirewallsRequest argument value.
+			ListFirewallsRequest *computepb.ListFirewallsRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+	}
+	lockDelete sync.RWMutex
+	lockList   sync.RWMutex
+}
+
+// Delete calls DeleteFunc.
+func (mock *firewallsClientMock) Delete(contextMoqParam context.Context, deleteFirewallRequest *computepb.DeleteFirewallRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+	if mock.DeleteFunc == nil {
+		panic("firewallsClientMock.DeleteFunc: method is nil but FirewallsClient.Delete was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam       context.Context
+		DeleteFirewallRequest *computepb.DeleteFirewallRequest
+		CallOptions           []gax.CallOption
+	}{
+		ContextMoqParam:       contextMoqParam,
+		DeleteFirewallRequest: deleteFirewallRequest,
+		CallOptions:           callOptions,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(contextMoqParam, deleteFirewallRequest, callOptions...)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedFirewallsClient.DeleteCalls())
+func (mock *firewallsClientMock) DeleteCalls() []struct {
+	ContextMoqParam       context.Context
+	DeleteFirewallRequest *computepb.DeleteFirewallRequest
+	CallOptions           []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam       context.Context
+		DeleteFirewallRequest *computepb.DeleteFirewallRequest
+		CallOptions           []gax.CallOption
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
+
+// List calls ListFunc.
+func (mock *firewallsClientMock) List(contextMoqParam context.Context, listFirewallsRequest *computepb.ListFirewallsRequest, callOptions ...gax.CallOption) *computev1.FirewallIterator {
+	if mock.ListFunc == nil {
+		panic("firewallsClientMock.ListFunc: method is nil but FirewallsClient.List was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam      context.Context
+		ListFirewallsRequest *computepb.ListFirewallsRequest
+		CallOptions          []gax.CallOption
+	}{
+		ContextMoqParam:      contextMoqParam,
+		ListFirewallsRequest: listFirewallsRequest,
+		CallOptions:          callOptions,
+	}
+	mock.lockList.Lock()
+	mock.calls.List = append(mock.calls.List, callInfo)
+	mock.lockList.Unlock()
+	return mock.ListFunc(contextMoqParam, listFirewallsRequest, callOptions...)
+}
+
+// ListCalls gets all the calls that were made to List.
+// Check the length with:
+//
+//	len(mockedFirewallsClient.ListCalls())
+func (mock *firewallsClientMock) ListCalls() []struct {
+	ContextMoqParam      context.Context
+	ListFirewallsRequest *computepb.ListFirewallsRequest
+	CallOptions          []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam      context.Context
+		ListFirewallsRequest *computepb.ListFirewallsRequest
+		CallOptions          []gax.CallOption
+	}
+	mock.lockList.RLock()
+	calls = mock.calls.List
+	mock.lockList.RUnlock()
+	return calls
+}
@@ -0,0 +1,147 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"context"
+	"sync"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that forwardingRulesClientMock does implement ForwardingRulesClient.
+// If this is not the case, regenerate this file with moq.
+var _ ForwardingRulesClient = &forwardingRulesClientMock{}
+
+// forwardingRulesClientMock is a mock implementation of ForwardingRulesClient.
+//
+//	func TestSomethingThatUsesForwardingRulesClient(t *testing.T) {
+//
+//		// make and configure a mocked ForwardingRulesClient
+//		mockedForwardingRulesClient := &forwardingRulesClientMock{
+//			AggregatedListFunc: func(contextMoqParam context.Context, aggregatedListForwardingRulesRequest *computepb.AggregatedListForwardingRulesRequest, callOptions ...gax.CallOption) *computev1.ForwardingRulesScopedListPairIterator {
+//				panic("mock out the AggregatedList method")
+//			},
+//			DeleteFunc: func(contextMoqParam context.Context, deleteForwardingRuleRequest *computepb.DeleteForwardingRuleRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Delete method")
+//			},
+//		}
+//
+//		// use mockedForwardingRulesClient in code that requires ForwardingRulesClient
+//		// and then make assertions.
+//
+//	}
+type forwardingRulesClientMock struct {
+	// AggregatedListFunc mocks the AggregatedList method.
+	AggregatedListFunc func(contextMoqParam context.Context, aggregatedListForwardingRulesRequest *computepb.AggregatedListForwardingRulesRequest, callOptions ...gax.CallOption) *computev1.ForwardingRulesScopedListPairIterator
+
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(contextMoqParam context.Context, deleteForwardingRuleRequest *computepb.DeleteForwardingRuleRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// AggregatedList holds details about calls to the AggregatedList method.
+		AggregatedList []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// AggregatedListForwardingRulesRequest is the aggregatedListForwardingRulesRequest argument value.
+			AggregatedListForwardingRulesRequest *computepb.AggregatedListForwardingRulesRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DeleteForwardingRuleRequest is the deleteForwardingRuleRequest argument value.
+			DeleteForwardingRuleRequest *computepb.DeleteForwardingRuleRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+	}
+	lockAggregatedList sync.RWMutex
+	lockDelete         sync.RWMutex
+}
+
+// AggregatedList calls AggregatedListFunc.
+func (mock *forwardingRulesClientMock) AggregatedList(contextMoqParam context.Context, aggregatedListForwardingRulesRequest *computepb.AggregatedListForwardingRulesRequest, callOptions ...gax.CallOption) *computev1.ForwardingRulesScopedListPairIterator {
+	if mock.AggregatedListFunc == nil {
+		panic("forwardingRulesClientMock.AggregatedListFunc: method is nil but ForwardingRulesClient.AggregatedList was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam                      context.Context
+		AggregatedListForwardingRulesRequest *computepb.AggregatedListForwardingRulesRequest
+		CallOptions                          []gax.CallOption
+	}{
+		ContextMoqParam:                      contextMoqParam,
+		AggregatedListForwardingRulesRequest: aggregatedListForwardingRulesRequest,
+		CallOptions:                          callOptions,
+	}
+	mock.lockAggregatedList.Lock()
+	mock.calls.AggregatedList = append(mock.calls.AggregatedList, callInfo)
+	mock.lockAggregatedList.Unlock()
+	return mock.AggregatedListFunc(contextMoqParam, aggregatedListForwardingRulesRequest, callOptions...)
+}
+
+// AggregatedListCalls gets all the calls that were made to AggregatedList.
+// Check the length with:
+//
+//	len(mockedForwardingRulesClient.AggregatedListCalls())
+func (mock *forwardingRulesClientMock) AggregatedListCalls() []struct {
+	ContextMoqParam                      context.Context
+	AggregatedListForwardingRulesRequest *computepb.AggregatedListForwardingRulesRequest
+	CallOptions                          []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam                      context.Context
+		AggregatedListForwardingRulesRequest *computepb.AggregatedListForwardingRulesRequest
+		CallOptions                          []gax.CallOption
+	}
+	mock.lockAggregatedList.RLock()
+	calls = mock.calls.AggregatedList
+	mock.lockAggregatedList.RUnlock()
+	return calls
+}
+
+// Delete calls DeleteFunc.
+func (mock *forwardingRulesClientMock) Delete(contextMoqParam context.Context, deleteForwardingRuleRequest *computepb.DeleteForwardingRuleRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+	if mock.DeleteFunc == nil {
+		panic("forwardingRulesClientMock.DeleteFunc: method is nil but ForwardingRulesClient.Delete was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam             context.Context
+		DeleteForwardingRuleRequest *computepb.DeleteForwardingRuleRequest
+		CallOptions                 []gax.CallOption
+	}{
+		ContextMoqParam:             contextMoqParam,
+		DeleteForwardingRuleRequest: deleteForwardingRuleRequest,
+		CallOptions:                 callOptions,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(contextMoqParam, deleteForwardingRuleRequest, callOptions...)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedForwardingRulesClient.DeleteCalls())
+func (mock *forwardingRulesClientMock) DeleteCalls() []struct {
+	ContextMoqParam             context.Context
+	DeleteForwardingRuleRequest *computepb.DeleteForwardingRuleRequest
+	CallOptions                 []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam             context.Context
+		DeleteForwardingRuleRequest *computepb.DeleteForwardingRuleRequest
+		CallOptions                 []gax.CallOption
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
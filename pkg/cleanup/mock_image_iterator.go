@@ -0,0 +1,69 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"sync"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that imageIteratorMock does implement imageIterator.
+// If this is not the case, regenerate this file with moq.
+var _ imageIterator = &imageIteratorMock{}
+
+// imageIteratorMock is a mock implementation of imageIterator.
+//
+//	func TestSomethingThatUsesimageIterator(t *testing.T) {
+//
+//		// make and configure a mocked imageIterator
+//		mockedimageIterator := &imageIteratorMock{
+//			NextFunc: func() (*computepb.Image, error) {
+//				panic("mock out the Next method")
+//			},
+//		}
+//
+//		// use mockedimageIterator in code that requires imageIterator
+//		// and then make assertions.
+//
+//	}
+type imageIteratorMock struct {
+	// NextFunc mocks the Next method.
+	NextFunc func() (*computepb.Image, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Next holds details about calls to the Next method.
+		Next []struct {
+		}
+	}
+	lockNext sync.RWMutex
+}
+
+// Next calls NextFunc.
+func (mock *imageIteratorMock) Next() (*computepb.Image, error) {
+	if mock.NextFunc == nil {
+		panic("imageIteratorMock.NextFunc: method is nil but imageIterator.Next was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockNext.Lock()
+	mock.calls.Next = append(mock.calls.Next, callInfo)
+	mock.lockNext.Unlock()
+	return mock.NextFunc()
+}
+
+// NextCalls gets all the calls that were made to Next.
+// Check the length with:
+//
+//	len(mockedimageIterator.NextCalls())
+func (mock *imageIteratorMock) NextCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockNext.RLock()
+	calls = mock.calls.Next
+	mock.lockNext.RUnlock()
+	return calls
+}
@@ -0,0 +1,147 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"context"
+	"sync"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that imagesClientMock does implement ImagesClient.
+// If this is not the case, regenerate this file with moq.
+var _ ImagesClient = &imagesClientMock{}
+
+// imagesClientMock is a mock implementation of ImagesClient.
+//
+//	func TestSomethingThatUsesImagesClient(t *testing.T) {
+//
+//		// make and configure a mocked ImagesClient
+//		mockedImagesClient := &imagesClientMock{
+//			DeleteFunc: func(contextMoqParam context.Context, deleteImageRequest *computepb.DeleteImageRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Delete method")
+//			},
+//			ListFunc: func(contextMoqParam context.Context, listImagesRequest *computepb.ListImagesRequest, callOptions ...gax.CallOption) *computev1.ImageIterator {
+//				panic("mock out the List method")
+//			},
+//		}
+//
+//		// use mockedImagesClient in code that requires ImagesClient
+//		// and then make assertions.
+//
+//	}
+type imagesClientMock struct {
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(contextMoqParam context.Context, deleteImageRequest *computepb.DeleteImageRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
+
+	// ListFunc mocks the List method.
+	ListFunc func(contextMoqParam context.Context, listImagesRequest *computepb.ListImagesRequest, callOptions ...gax.CallOption) *computev1.ImageIterator
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DeleteImageRequest is the deleteImageRequest argument value.
+			DeleteImageRequest *computepb.DeleteImageRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+		// List holds details about calls to the List method.
+		List []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// ListImagesRequest is the listImagesRequest argument value.
+			ListImagesRequest *computepb.ListImagesRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+	}
+	lockDelete sync.RWMutex
+	lockList   sync.RWMutex
+}
+
+// Delete calls DeleteFunc.
+func (mock *imagesClientMock) Delete(contextMoqParam context.Context, deleteImageRequest *computepb.DeleteImageRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+	if mock.DeleteFunc == nil {
+		panic("imagesClientMock.DeleteFunc: method is nil but ImagesClient.Delete was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam    context.Context
+		DeleteImageRequest *computepb.DeleteImageRequest
+		CallOptions        []gax.CallOption
+	}{
+		ContextMoqParam:    contextMoqParam,
+		DeleteImageRequest: deleteImageRequest,
+		CallOptions:        callOptions,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(contextMoqParam, deleteImageRequest, callOptions...)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedImagesClient.DeleteCalls())
+func (mock *imagesClientMock) DeleteCalls() []struct {
+	ContextMoqParam    context.Context
+	DeleteImageRequest *computepb.DeleteImageRequest
+	CallOptions        []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam    context.Context
+		DeleteImageRequest *computepb.DeleteImageRequest
+		CallOptions        []gax.CallOption
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
+
+// List calls ListFunc.
+func (mock *imagesClientMock) List(contextMoqParam context.Context, listImagesRequest *computepb.ListImagesRequest, callOptions ...gax.CallOption) *computev1.ImageIterator {
+	if mock.ListFunc == nil {
+		panic("imagesClientMock.ListFunc: method is nil but ImagesClient.List was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam   context.Context
+		ListImagesRequest *computepb.ListImagesRequest
+		CallOptions       []gax.CallOption
+	}{
+		ContextMoqParam:   contextMoqParam,
+		ListImagesRequest: listImagesRequest,
+		CallOptions:       callOptions,
+	}
+	mock.lockList.Lock()
+	mock.calls.List = append(mock.calls.List, callInfo)
+	mock.lockList.Unlock()
+	return mock.ListFunc(contextMoqParam, listImagesRequest, callOptions...)
+}
+
+// ListCalls gets all the calls that were made to List.
+// Check the length with:
+//
+//	len(mockedImagesClient.ListCalls())
+func (mock *imagesClientMock) ListCalls() []struct {
+	ContextMoqParam   context.Context
+	ListImagesRequest *computepb.ListImagesRequest
+	CallOptions       []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam   context.Context
+		ListImagesRequest *computepb.ListImagesRequest
+		CallOptions       []gax.CallOption
+	}
+	mock.lockList.RLock()
+	calls = mock.calls.List
+	mock.lockList.RUnlock()
+	return calls
+}
@@ -0,0 +1,69 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"sync"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that instanceIteratorMock does implement instanceIterator.
+// If this is not the case, regenerate this file with moq.
+var _ instanceIterator = &instanceIteratorMock{}
+
+// instanceIteratorMock is a mock implementation of instanceIterator.
+//
+//	func TestSomethingThatUsesinstanceIterator(t *testing.T) {
+//
+//		// make and configure a mocked instanceIterator
+//		mockedinstanceIterator := &instanceIteratorMock{
+//			NextFunc: func() (*computepb.Instance, error) {
+//				panic("mock out the Next method")
+//			},
+//		}
+//
+//		// use mockedinstanceIterator in code that requires instanceIterator
+//		// and then make assertions.
+//
+//	}
+type instanceIteratorMock struct {
+	// NextFunc mocks the Next method.
+	NextFunc func() (*computepb.Instance, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Next holds details about calls to the Next method.
+		Next []struct {
+		}
+	}
+	lockNext sync.RWMutex
+}
+
+// Next calls NextFunc.
+func (mock *instanceIteratorMock) Next() (*computepb.Instance, error) {
+	if mock.NextFunc == nil {
+		panic("instanceIteratorMock.NextFunc: method is nil but instanceIterator.Next was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockNext.Lock()
+	mock.calls.Next = append(mock.calls.Next, callInfo)
+	mock.lockNext.Unlock()
+	return mock.NextFunc()
+}
+
+// NextCalls gets all the calls that were made to Next.
+// Check the length with:
+//
+//	len(mockedinstanceIterator.NextCalls())
+func (mock *instanceIteratorMock) NextCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockNext.RLock()
+	calls = mock.calls.Next
+	mock.lockNext.RUnlock()
+	return calls
+}
@@ -0,0 +1,69 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"sync"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that instanceTemplateIteratorMock does implement instanceTemplateIterator.
+// If this is not the case, regenerate this file with moq.
+var _ instanceTemplateIterator = &instanceTemplateIteratorMock{}
+
+// instanceTemplateIteratorMock is a mock implementation of instanceTemplateIterator.
+//
+//	func TestSomethingThatUsesinstanceTemplateIterator(t *testing.T) {
+//
+//		// make and configure a mocked instanceTemplateIterator
+//		mockedinstanceTemplateIterator := &instanceTemplateIteratorMock{
+//			NextFunc: func() (*computepb.InstanceTemplate, error) {
+//				panic("mock out the Next method")
+//			},
+//		}
+//
+//		// use mockedinstanceTemplateIterator in code that requires instanceTemplateIterator
+//		// and then make assertions.
+//
+//	}
+type instanceTemplateIteratorMock struct {
+	// NextFunc mocks the Next method.
+	NextFunc func() (*computepb.InstanceTemplate, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Next holds details about calls to the Next method.
+		Next []struct {
+		}
+	}
+	lockNext sync.RWMutex
+}
+
+// Next calls NextFunc.
+func (mock *instanceTemplateIteratorMock) Next() (*computepb.InstanceTemplate, error) {
+	if mock.NextFunc == nil {
+		panic("instanceTemplateIteratorMock.NextFunc: method is nil but instanceTemplateIterator.Next was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockNext.Lock()
+	mock.calls.Next = append(mock.calls.Next, callInfo)
+	mock.lockNext.Unlock()
+	return mock.NextFunc()
+}
+
+// NextCalls gets all the calls that were made to Next.
+// Check the length with:
+//
+//	len(mockedinstanceTemplateIterator.NextCalls())
+func (mock *instanceTemplateIteratorMock) NextCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockNext.RLock()
+	calls = mock.calls.Next
+	mock.lockNext.RUnlock()
+	return calls
+}
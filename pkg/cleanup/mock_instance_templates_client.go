@@ -0,0 +1,91 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"context"
+	"sync"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that instanceTemplatesClientMock does implement InstanceTemplatesClient.
+// If this is not the case, regenerate this file with moq.
+var _ InstanceTemplatesClient = &instanceTemplatesClientMock{}
+
+// instanceTemplatesClientMock is a mock implementation of InstanceTemplatesClient.
+//
+//	func TestSomethingThatUsesInstanceTemplatesClient(t *testing.T) {
+//
+//		// make and configure a mocked InstanceTemplatesClient
+//		mockedInstanceTemplatesClient := &instanceTemplatesClientMock{
+//			ListFunc: func(contextMoqParam context.Context, listInstanceTemplatesRequest *computepb.ListInstanceTemplatesRequest, callOptions ...gax.CallOption) *computev1.InstanceTemplateIterator {
+//				panic("mock out the List method")
+//			},
+//		}
+//
+//		// use mockedInstanceTemplatesClient in code that requires InstanceTemplatesClient
+//		// and then make assertions.
+//
+//	}
+type instanceTemplatesClientMock struct {
+	// ListFunc mocks the List method.
+	ListFunc func(contextMoqParam context.Context, listInstanceTemplatesRequest *computepb.ListInstanceTemplatesRequest, callOptions ...gax.CallOption) *computev1.InstanceTemplateIterator
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// List holds details about calls to the List method.
+		List []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// ListInstanceTemplatesRequest is the listInstanceTemplatesRequest argument value.
+			ListInstanceTemplatesRequest *computepb.ListInstanceTemplatesRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+	}
+	lockList sync.RWMutex
+}
+
+// List calls ListFunc.
+func (mock *instanceTemplatesClientMock) List(contextMoqParam context.Context, listInstanceTemplatesRequest *computepb.ListInstanceTemplatesRequest, callOptions ...gax.CallOption) *computev1.InstanceTemplateIterator {
+	if mock.ListFunc == nil {
+		panic("instanceTemplatesClientMock.ListFunc: method is nil but InstanceTemplatesClient.List was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam              context.Context
+		ListInstanceTemplatesRequest *computepb.ListInstanceTemplatesRequest
+		CallOptions                  []gax.CallOption
+	}{
+		ContextMoqParam:              contextMoqParam,
+		ListInstanceTemplatesRequest: listInstanceTemplatesRequest,
+		CallOptions:                  callOptions,
+	}
+	mock.lockList.Lock()
+	mock.calls.List = append(mock.calls.List, callInfo)
+	mock.lockList.Unlock()
+	return mock.ListFunc(contextMoqParam, listInstanceTemplatesRequest, callOptions...)
+}
+
+// ListCalls gets all the calls that were made to List.
+// Check the length with:
+//
+//	len(mockedInstanceTemplatesClient.ListCalls())
+func (mock *instanceTemplatesClientMock) ListCalls() []struct {
+	ContextMoqParam              context.Context
+	ListInstanceTemplatesRequest *computepb.ListInstanceTemplatesRequest
+	CallOptions                  []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam              context.Context
+		ListInstanceTemplatesRequest *computepb.ListInstanceTemplatesRequest
+		CallOptions                  []gax.CallOption
+	}
+	mock.lockList.RLock()
+	calls = mock.calls.List
+	mock.lockList.RUnlock()
+	return calls
+}
@@ -0,0 +1,203 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"context"
+	"sync"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that instancesClientMock does implement InstancesClient.
+// If this is not the case, regenerate this file with moq.
+var _ InstancesClient = &instancesClientMock{}
+
+// instancesClientMock is a mock implementation of InstancesClient.
+//
+//	func TestSomethingThatUsesInstancesClient(t *testing.T) {
+//
+//		// make and configure a mocked InstancesClient
+//		mockedInstancesClient := &instancesClientMock{
+//			AggregatedListFunc: func(contextMoqParam context.Context, aggregatedListInstancesRequest *computepb.AggregatedListInstancesRequest, callOptions ...gax.CallOption) *computev1.InstancesScopedListPairIterator {
+//				panic("mock out the AggregatedList method")
+//			},
+//			DeleteFunc: func(contextMoqParam context.Context, deleteInstanceRequest *computepb.DeleteInstanceRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Delete method")
+//			},
+//			StopFunc: func(contextMoqParam context.Context, stopInstanceRequest *computepb.StopInstanceRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Stop method")
+//			},
+//		}
+//
+//		// use mockedInstancesClient in code that requires InstancesClient
+//		// and then make assertions.
+//
+//	}
+type instancesClientMock struct {
+	// AggregatedListFunc mocks the AggregatedList method.
+	AggregatedListFunc func(contextMoqParam context.Context, aggregatedListInstancesRequest *computepb.AggregatedListInstancesRequest, callOptions ...gax.CallOption) *computev1.InstancesScopedListPairIterator
+
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(contextMoqParam context.Context, deleteInstanceRequest *computepb.DeleteInstanceRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
+
+	// StopFunc mocks the Stop method.
+	StopFunc func(contextMoqParam context.Context, stopInstanceRequest *computepb.StopInstanceRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// AggregatedList holds details about calls to the AggregatedList method.
+		AggregatedList []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// AggregatedListInstancesRequest is the aggregatedListInstancesRequest argument value.
+			AggregatedListInstancesRequest *computepb.AggregatedListInstancesRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DeleteInstanceRequest is the deleteInstanceRequest argument value.
+			DeleteInstanceRequest *computepb.DeleteInstanceRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+		// Stop holds details about calls to the Stop method.
+		Stop []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// StopInstanceRequest is the stopInstanceRequest argument value.
+			StopInstanceRequest *computepb.StopInstanceRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+	}
+	lockAggregatedList sync.RWMutex
+	lockDelete         sync.RWMutex
+	lockStop           sync.RWMutex
+}
+
+// AggregatedList calls AggregatedListFunc.
+func (mock *instancesClientMock) AggregatedList(contextMoqParam context.Context, aggregatedListInstancesRequest *computepb.AggregatedListInstancesRequest, callOptions ...gax.CallOption) *computev1.InstancesScopedListPairIterator {
+	if mock.AggregatedListFunc == nil {
+		panic("instancesClientMock.AggregatedListFunc: method is nil but InstancesClient.AggregatedList was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam                context.Context
+		AggregatedListInstancesRequest *computepb.AggregatedListInstancesRequest
+		CallOptions                    []gax.CallOption
+	}{
+		ContextMoqParam:                contextMoqParam,
+		AggregatedListInstancesRequest: aggregatedListInstancesRequest,
+		CallOptions:                    callOptions,
+	}
+	mock.lockAggregatedList.Lock()
+	mock.calls.AggregatedList = append(mock.calls.AggregatedList, callInfo)
+	mock.lockAggregatedList.Unlock()
+	return mock.AggregatedListFunc(contextMoqParam, aggregatedListInstancesRequest, callOptions...)
+}
+
+// AggregatedListCalls gets all the calls that were made to AggregatedList.
+// Check the length with:
+//
+//	len(mockedInstancesClient.AggregatedListCalls())
+func (mock *instancesClientMock) AggregatedListCalls() []struct {
+	ContextMoqParam                context.Context
+	AggregatedListInstancesRequest *computepb.AggregatedListInstancesRequest
+	CallOptions                    []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam                context.Context
+		AggregatedListInstancesRequest *computepb.AggregatedListInstancesRequest
+		CallOptions                    []gax.CallOption
+	}
+	mock.lockAggregatedList.RLock()
+	calls = mock.calls.AggregatedList
+	mock.lockAggregatedList.RUnlock()
+	return calls
+}
+
+// Delete calls DeleteFunc.
+func (mock *instancesClientMock) Delete(contextMoqParam context.Context, deleteInstanceRequest *computepb.DeleteInstanceRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+	if mock.DeleteFunc == nil {
+		panic("instancesClientMock.DeleteFunc: method is nil but InstancesClient.Delete was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam       context.Context
+		DeleteInstanceRequest *computepb.DeleteInstanceRequest
+		CallOptions           []gax.CallOption
+	}{
+		ContextMoqParam:       contextMoqParam,
+		DeleteInstanceRequest: deleteInstanceRequest,
+		CallOptions:           callOptions,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(contextMoqParam, deleteInstanceRequest, callOptions...)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedInstancesClient.DeleteCalls())
+func (mock *instancesClientMock) DeleteCalls() []struct {
+	ContextMoqParam       context.Context
+	DeleteInstanceRequest *computepb.DeleteInstanceRequest
+	CallOptions           []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam       context.Context
+		DeleteInstanceRequest *computepb.DeleteInstanceRequest
+		CallOptions           []gax.CallOption
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
+
+// Stop calls StopFunc.
+func (mock *instancesClientMock) Stop(contextMoqParam context.Context, stopInstanceRequest *computepb.StopInstanceRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+	if mock.StopFunc == nil {
+		panic("instancesClientMock.StopFunc: method is nil but InstancesClient.Stop was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam     context.Context
+		StopInstanceRequest *computepb.StopInstanceRequest
+		CallOptions         []gax.CallOption
+	}{
+		ContextMoqParam:     contextMoqParam,
+		StopInstanceRequest: stopInstanceRequest,
+		CallOptions:         callOptions,
+	}
+	mock.lockStop.Lock()
+	mock.calls.Stop = append(mock.calls.Stop, callInfo)
+	mock.lockStop.Unlock()
+	return mock.StopFunc(contextMoqParam, stopInstanceRequest, callOptions...)
+}
+
+// StopCalls gets all the calls that were made to Stop.
+// Check the length with:
+//
+//	len(mockedInstancesClient.StopCalls())
+func (mock *instancesClientMock) StopCalls() []struct {
+	ContextMoqParam     context.Context
+	StopInstanceRequest *computepb.StopInstanceRequest
+	CallOptions         []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam     context.Context
+		StopInstanceRequest *computepb.StopInstanceRequest
+		CallOptions         []gax.CallOption
+	}
+	mock.lockStop.RLock()
+	calls = mock.calls.Stop
+	mock.lockStop.RUnlock()
+	return calls
+}
@@ -0,0 +1,106 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"sync"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that pagedDiskIteratorMock does implement pagedDiskIterator.
+// If this is not the case, regenerate this file with moq.
+var _ pagedDiskIterator = &pagedDiskIteratorMock{}
+
+// pagedDiskIteratorMock is a mock implementation of pagedDiskIterator.
+//
+//	func TestSomethingThatUsespagedDiskIterator(t *testing.T) {
+//
+//		// make and configure a mocked pagedDiskIterator
+//		mockedpagedDiskIterator := &pagedDiskIteratorMock{
+//			NextFunc: func() (*computepb.Disk, error) {
+//				panic("mock out the Next method")
+//			},
+//			PageTokenFunc: func() string {
+//				panic("mock out the PageToken method")
+//			},
+//		}
+//
+//		// use mockedpagedDiskIterator in code that requires pagedDiskIterator
+//		// and then make assertions.
+//
+//	}
+type pagedDiskIteratorMock struct {
+	// NextFunc mocks the Next method.
+	NextFunc func() (*computepb.Disk, error)
+
+	// PageTokenFunc mocks the PageToken method.
+	PageTokenFunc func() string
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Next holds details about calls to the Next method.
+		Next []struct {
+		}
+		// PageToken holds details about calls to the PageToken method.
+		PageToken []struct {
+		}
+	}
+	lockNext      sync.RWMutex
+	lockPageToken sync.RWMutex
+}
+
+// Next calls NextFunc.
+func (mock *pagedDiskIteratorMock) Next() (*computepb.Disk, error) {
+	if mock.NextFunc == nil {
+		panic("pagedDiskIteratorMock.NextFunc: method is nil but pagedDiskIterator.Next was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockNext.Lock()
+	mock.calls.Next = append(mock.calls.Next, callInfo)
+	mock.lockNext.Unlock()
+	return mock.NextFunc()
+}
+
+// NextCalls gets all the calls that were made to Next.
+// Check the length with:
+//
+//	len(mockedpagedDiskIterator.NextCalls())
+func (mock *pagedDiskIteratorMock) NextCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockNext.RLock()
+	calls = mock.calls.Next
+	mock.lockNext.RUnlock()
+	return calls
+}
+
+// PageToken calls PageTokenFunc.
+func (mock *pagedDiskIteratorMock) PageToken() string {
+	if mock.PageTokenFunc == nil {
+		panic("pagedDiskIteratorMock.PageTokenFunc: method is nil but pagedDiskIterator.PageToken was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockPageToken.Lock()
+	mock.calls.PageToken = append(mock.calls.PageToken, callInfo)
+	mock.lockPageToken.Unlock()
+	return mock.PageTokenFunc()
+}
+
+// PageTokenCalls gets all the calls that were made to PageToken.
+// Check the length with:
+//
+//	len(mockedpagedDiskIterator.PageTokenCalls())
+func (mock *pagedDiskIteratorMock) PageTokenCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockPageToken.RLock()
+	calls = mock.calls.PageToken
+	mock.lockPageToken.RUnlock()
+	return calls
+}
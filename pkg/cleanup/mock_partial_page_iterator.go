@@ -0,0 +1,143 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"sync"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that partialPageIteratorMock does implement partialPageIterator.
+// If this is not the case, regenerate this file with moq.
+var _ partialPageIterator = &partialPageIteratorMock{}
+
+// partialPageIteratorMock is a mock implementation of partialPageIterator.
+//
+//	func TestSomethingThatUsespartialPageIterator(t *testing.T) {
+//
+//		// make and configure a mocked partialPageIterator
+//		mockedpartialPageIterator := &partialPageIteratorMock{
+//			NextFunc: func() (*computepb.Disk, error) {
+//				panic("mock out the Next method")
+//			},
+//			PageTokenFunc: func() string {
+//				panic("mock out the PageToken method")
+//			},
+//			UnreachableFunc: func() []string {
+//				panic("mock out the Unreachable method")
+//			},
+//		}
+//
+//		// use mockedpartialPageIterator in code that requires partialPageIterator
+//		// and then make assertions.
+//
+//	}
+type partialPageIteratorMock struct {
+	// NextFunc mocks the Next method.
+	NextFunc func() (*computepb.Disk, error)
+
+	// PageTokenFunc mocks the PageToken method.
+	PageTokenFunc func() string
+
+	// UnreachableFunc mocks the Unreachable method.
+	UnreachableFunc func() []string
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Next holds details about calls to the Next method.
+		Next []struct {
+		}
+		// PageToken holds details about calls to the PageToken method.
+		PageToken []struct {
+		}
+		// Unreachable holds details about calls to the Unreachable method.
+		Unreachable []struct {
+		}
+	}
+	lockNext        sync.RWMutex
+	lockPageToken   sync.RWMutex
+	lockUnreachable sync.RWMutex
+}
+
+// Next calls NextFunc.
+func (mock *partialPageIteratorMock) Next() (*computepb.Disk, error) {
+	if mock.NextFunc == nil {
+		panic("partialPageIteratorMock.NextFunc: method is nil but partialPageIterator.Next was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockNext.Lock()
+	mock.calls.Next = append(mock.calls.Next, callInfo)
+	mock.lockNext.Unlock()
+	return mock.NextFunc()
+}
+
+// NextCalls gets all the calls that were made to Next.
+// Check the length with:
+//
+//	len(mockedpartialPageIterator.NextCalls())
+func (mock *partialPageIteratorMock) NextCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockNext.RLock()
+	calls = mock.calls.Next
+	mock.lockNext.RUnlock()
+	return calls
+}
+
+// PageToken calls PageTokenFunc.
+func (mock *partialPageIteratorMock) PageToken() string {
+	if mock.PageTokenFunc == nil {
+		panic("partialPageIteratorMock.PageTokenFunc: method is nil but partialPageIterator.PageToken was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockPageToken.Lock()
+	mock.calls.PageToken = append(mock.calls.PageToken, callInfo)
+	mock.lockPageToken.Unlock()
+	return mock.PageTokenFunc()
+}
+
+// PageTokenCalls gets all the calls that were made to PageToken.
+// Check the length with:
+//
+//	len(mockedpartialPageIterator.PageTokenCalls())
+func (mock *partialPageIteratorMock) PageTokenCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockPageToken.RLock()
+	calls = mock.calls.PageToken
+	mock.lockPageToken.RUnlock()
+	return calls
+}
+
+// Unreachable calls UnreachableFunc.
+func (mock *partialPageIteratorMock) Unreachable() []string {
+	if mock.UnreachableFunc == nil {
+		panic("partialPageIteratorMock.UnreachableFunc: method is nil but partialPageIterator.Unreachable was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockUnreachable.Lock()
+	mock.calls.Unreachable = append(mock.calls.Unreachable, callInfo)
+	mock.lockUnreachable.Unlock()
+	return mock.UnreachableFunc()
+}
+
+// UnreachableCalls gets all the calls that were made to Unreachable.
+// Check the length with:
+//
+//	len(mockedpartialPageIterator.UnreachableCalls())
+func (mock *partialPageIteratorMock) UnreachableCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockUnreachable.RLock()
+	calls = mock.calls.Unreachable
+	mock.lockUnreachable.RUnlock()
+	return calls
+}
@@ -0,0 +1,69 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"sync"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that snapshotIteratorMock does implement snapshotIterator.
+// If this is not the case, regenerate this file with moq.
+var _ snapshotIterator = &snapshotIteratorMock{}
+
+// snapshotIteratorMock is a mock implementation of snapshotIterator.
+//
+//	func TestSomethingThatUsessnapshotIterator(t *testing.T) {
+//
+//		// make and configure a mocked snapshotIterator
+//		mockedsnapshotIterator := &snapshotIteratorMock{
+//			NextFunc: func() (*computepb.Snapshot, error) {
+//				panic("mock out the Next method")
+//			},
+//		}
+//
+//		// use mockedsnapshotIterator in code that requires snapshotIterator
+//		// and then make assertions.
+//
+//	}
+type snapshotIteratorMock struct {
+	// NextFunc mocks the Next method.
+	NextFunc func() (*computepb.Snapshot, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Next holds details about calls to the Next method.
+		Next []struct {
+		}
+	}
+	lockNext sync.RWMutex
+}
+
+// Next calls NextFunc.
+func (mock *snapshotIteratorMock) Next() (*computepb.Snapshot, error) {
+	if mock.NextFunc == nil {
+		panic("snapshotIteratorMock.NextFunc: method is nil but snapshotIterator.Next was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockNext.Lock()
+	mock.calls.Next = append(mock.calls.Next, callInfo)
+	mock.lockNext.Unlock()
+	return mock.NextFunc()
+}
+
+// NextCalls gets all the calls that were made to Next.
+// Check the length with:
+//
+//	len(mockedsnapshotIterator.NextCalls())
+func (mock *snapshotIteratorMock) NextCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockNext.RLock()
+	calls = mock.calls.Next
+	mock.lockNext.RUnlock()
+	return calls
+}
@@ -0,0 +1,203 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"context"
+	"sync"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that snapshotsClientMock does implement SnapshotsClient.
+// If this is not the case, regenerate this file with moq.
+var _ SnapshotsClient = &snapshotsClientMock{}
+
+// snapshotsClientMock is a mock implementation of SnapshotsClient.
+//
+//	func TestSomethingThatUsesSnapshotsClient(t *testing.T) {
+//
+//		// make and configure a mocked SnapshotsClient
+//		mockedSnapshotsClient := &snapshotsClientMock{
+//			DeleteFunc: func(contextMoqParam context.Context, deleteSnapshotRequest *computepb.DeleteSnapshotRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Delete method")
+//			},
+//			GetFunc: func(contextMoqParam context.Context, getSnapshotRequest *computepb.GetSnapshotRequest, callOptions ...gax.CallOption) (*computepb.Snapshot, error) {
+//				panic("mock out the Get method")
+//			},
+//			ListFunc: func(contextMoqParam context.Context, listSnapshotsRequest *computepb.ListSnapshotsRequest, callOptions ...gax.CallOption) *computev1.SnapshotIterator {
+//				panic("mock out the List method")
+//			},
+//		}
+//
+//		// use mockedSnapshotsClient in code that requires SnapshotsClient
+//		// and then make assertions.
+//
+//	}
+type snapshotsClientMock struct {
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(contextMoqParam context.Context, deleteSnapshotRequest *computepb.DeleteSnapshotRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
+
+	// GetFunc mocks the Get method.
+	GetFunc func(contextMoqParam context.Context, getSnapshotRequest *computepb.GetSnapshotRequest, callOptions ...gax.CallOption) (*computepb.Snapshot, error)
+
+	// ListFunc mocks the List method.
+	ListFunc func(contextMoqParam context.Context, listSnapshotsRequest *computepb.ListSnapshotsRequest, callOptions ...gax.CallOption) *computev1.SnapshotIterator
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DeleteSnapshotRequest is the deleteSnapshotRequest argument value.
+			DeleteSnapshotRequest *computepb.DeleteSnapshotRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+		// Get holds details about calls to the Get method.
+		Get []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// GetSnapshotRequest is the getSnapshotRequest argument value.
+			GetSnapshotRequest *computepb.GetSnapshotRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+		// List holds details about calls to the List method.
+		List []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// ListSnapshotsRequest is the listSnapshotsRequest argument value.
+			ListSnapshotsRequest *computepb.ListSnapshotsRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+	}
+	lockDelete sync.RWMutex
+	lockGet    sync.RWMutex
+	lockList   sync.RWMutex
+}
+
+// Delete calls DeleteFunc.
+func (mock *snapshotsClientMock) Delete(contextMoqParam context.Context, deleteSnapshotRequest *computepb.DeleteSnapshotRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+	if mock.DeleteFunc == nil {
+		panic("snapshotsClientMock.DeleteFunc: method is nil but SnapshotsClient.Delete was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam       context.Context
+		DeleteSnapshotRequest *computepb.DeleteSnapshotRequest
+		CallOptions           []gax.CallOption
+	}{
+		ContextMoqParam:       contextMoqParam,
+		DeleteSnapshotRequest: deleteSnapshotRequest,
+		CallOptions:           callOptions,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(contextMoqParam, deleteSnapshotRequest, callOptions...)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedSnapshotsClient.DeleteCalls())
+func (mock *snapshotsClientMock) DeleteCalls() []struct {
+	ContextMoqParam       context.Context
+	DeleteSnapshotRequest *computepb.DeleteSnapshotRequest
+	CallOptions           []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam       context.Context
+		DeleteSnapshotRequest *computepb.DeleteSnapshotRequest
+		CallOptions           []gax.CallOption
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
+
+// Get calls GetFunc.
+func (mock *snapshotsClientMock) Get(contextMoqParam context.Context, getSnapshotRequest *computepb.GetSnapshotRequest, callOptions ...gax.CallOption) (*computepb.Snapshot, error) {
+	if mock.GetFunc == nil {
+		panic("snapshotsClientMock.GetFunc: method is nil but SnapshotsClient.Get was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam    context.Context
+		GetSnapshotRequest *computepb.GetSnapshotRequest
+		CallOptions        []gax.CallOption
+	}{
+		ContextMoqParam:    contextMoqParam,
+		GetSnapshotRequest: getSnapshotRequest,
+		CallOptions:        callOptions,
+	}
+	mock.lockGet.Lock()
+	mock.calls.Get = append(mock.calls.Get, callInfo)
+	mock.lockGet.Unlock()
+	return mock.GetFunc(contextMoqParam, getSnapshotRequest, callOptions...)
+}
+
+// GetCalls gets all the calls that were made to Get.
+// Check the length with:
+//
+//	len(mockedSnapshotsClient.GetCalls())
+func (mock *snapshotsClientMock) GetCalls() []struct {
+	ContextMoqParam    context.Context
+	GetSnapshotRequest *computepb.GetSnapshotRequest
+	CallOptions        []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam    context.Context
+		GetSnapshotRequest *computepb.GetSnapshotRequest
+		CallOptions        []gax.CallOption
+	}
+	mock.lockGet.RLock()
+	calls = mock.calls.Get
+	mock.lockGet.RUnlock()
+	return calls
+}
+
+// List calls ListFunc.
+func (mock *snapshotsClientMock) List(contextMoqParam context.Context, listSnapshotsRequest *computepb.ListSnapshotsRequest, callOptions ...gax.CallOption) *computev1.SnapshotIterator {
+	if mock.ListFunc == nil {
+		panic("snapshotsClientMock.ListFunc: method is nil but SnapshotsClient.List was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam      context.Context
+		ListSnapshotsRequest *computepb.ListSnapshotsRequest
+		CallOptions          []gax.CallOption
+	}{
+		ContextMoqParam:      contextMoqParam,
+		ListSnapshotsRequest: listSnapshotsRequest,
+		CallOptions:          callOptions,
+	}
+	mock.lockList.Lock()
+	mock.calls.List = append(mock.calls.List, callInfo)
+	mock.lockList.Unlock()
+	return mock.ListFunc(contextMoqParam, listSnapshotsRequest, callOptions...)
+}
+
+// ListCalls gets all the calls that were made to List.
+// Check the length with:
+//
+//	len(mockedSnapshotsClient.ListCalls())
+func (mock *snapshotsClientMock) ListCalls() []struct {
+	ContextMoqParam      context.Context
+	ListSnapshotsRequest *computepb.ListSnapshotsRequest
+	CallOptions          []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam      context.Context
+		ListSnapshotsRequest *computepb.ListSnapshotsRequest
+		CallOptions          []gax.CallOption
+	}
+	mock.lockList.RLock()
+	calls = mock.calls.List
+	mock.lockList.RUnlock()
+	return calls
+}
@@ -0,0 +1,147 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cleanup
+
+import (
+	"context"
+	"sync"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Ensure, that targetPoolsClientMock does implement TargetPoolsClient.
+// If this is not the case, regenerate this file with moq.
+var _ TargetPoolsClient = &targetPoolsClientMock{}
+
+// targetPoolsClientMock is a mock implementation of TargetPoolsClient.
+//
+//	func TestSomethingThatUsesTargetPoolsClient(t *testing.T) {
+//
+//		// make and configure a mocked TargetPoolsClient
+//		mockedTargetPoolsClient := &targetPoolsClientMock{
+//			AggregatedListFunc: func(contextMoqParam context.Context, aggregatedListTargetPoolsRequest *computepb.AggregatedListTargetPoolsRequest, callOptions ...gax.CallOption) *computev1.TargetPoolsScopedListPairIterator {
+//				panic("mock out the AggregatedList method")
+//			},
+//			DeleteFunc: func(contextMoqParam context.Context, deleteTargetPoolRequest *computepb.DeleteTargetPoolRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+//				panic("mock out the Delete method")
+//			},
+//		}
+//
+//		// use mockedTargetPoolsClient in code that requires TargetPoolsClient
+//		// and then make assertions.
+//
+//	}
+type targetPoolsClientMock struct {
+	// AggregatedListFunc mocks the AggregatedList method.
+	AggregatedListFunc func(contextMoqParam context.Context, aggregatedListTargetPoolsRequest *computepb.AggregatedListTargetPoolsRequest, callOptions ...gax.CallOption) *computev1.TargetPoolsScopedListPairIterator
+
+	// DeleteFunc mocks the Delete method.
+	DeleteFunc func(contextMoqParam context.Context, deleteTargetPoolRequest *computepb.DeleteTargetPoolRequest, callOptions ...gax.CallOption) (*computev1.Operation, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// AggregatedList holds details about calls to the AggregatedList method.
+		AggregatedList []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// AggregatedListTargetPoolsRequest is the aggregatedListTargetPoolsRequest argument value.
+			AggregatedListTargetPoolsRequest *computepb.AggregatedListTargetPoolsRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+		// Delete holds details about calls to the Delete method.
+		Delete []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// DeleteTargetPoolRequest is the deleteTargetPoolRequest argument value.
+			DeleteTargetPoolRequest *computepb.DeleteTargetPoolRequest
+			// CallOptions is the callOptions argument value.
+			CallOptions []gax.CallOption
+		}
+	}
+	lockAggregatedList sync.RWMutex
+	lockDelete         sync.RWMutex
+}
+
+// AggregatedList calls AggregatedListFunc.
+func (mock *targetPoolsClientMock) AggregatedList(contextMoqParam context.Context, aggregatedListTargetPoolsRequest *computepb.AggregatedListTargetPoolsRequest, callOptions ...gax.CallOption) *computev1.TargetPoolsScopedListPairIterator {
+	if mock.AggregatedListFunc == nil {
+		panic("targetPoolsClientMock.AggregatedListFunc: method is nil but TargetPoolsClient.AggregatedList was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam                  context.Context
+		AggregatedListTargetPoolsRequest *computepb.AggregatedListTargetPoolsRequest
+		CallOptions                      []gax.CallOption
+	}{
+		ContextMoqParam:                  contextMoqParam,
+		AggregatedListTargetPoolsRequest: aggregatedListTargetPoolsRequest,
+		CallOptions:                      callOptions,
+	}
+	mock.lockAggregatedList.Lock()
+	mock.calls.AggregatedList = append(mock.calls.AggregatedList, callInfo)
+	mock.lockAggregatedList.Unlock()
+	return mock.AggregatedListFunc(contextMoqParam, aggregatedListTargetPoolsRequest, callOptions...)
+}
+
+// AggregatedListCalls gets all the calls that were made to AggregatedList.
+// Check the length with:
+//
+//	len(mockedTargetPoolsClient.AggregatedListCalls())
+func (mock *targetPoolsClientMock) AggregatedListCalls() []struct {
+	ContextMoqParam                  context.Context
+	AggregatedListTargetPoolsRequest *computepb.AggregatedListTargetPoolsRequest
+	CallOptions                      []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam                  context.Context
+		AggregatedListTargetPoolsRequest *computepb.AggregatedListTargetPoolsRequest
+		CallOptions                      []gax.CallOption
+	}
+	mock.lockAggregatedList.RLock()
+	calls = mock.calls.AggregatedList
+	mock.lockAggregatedList.RUnlock()
+	return calls
+}
+
+// Delete calls DeleteFunc.
+func (mock *targetPoolsClientMock) Delete(contextMoqParam context.Context, deleteTargetPoolRequest *computepb.DeleteTargetPoolRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+	if mock.DeleteFunc == nil {
+		panic("targetPoolsClientMock.DeleteFunc: method is nil but TargetPoolsClient.Delete was just called")
+	}
+	callInfo := struct {
+		ContextMoqParam         context.Context
+		DeleteTargetPoolRequest *computepb.DeleteTargetPoolRequest
+		CallOptions             []gax.CallOption
+	}{
+		ContextMoqParam:         contextMoqParam,
+		DeleteTargetPoolRequest: deleteTargetPoolRequest,
+		CallOptions:             callOptions,
+	}
+	mock.lockDelete.Lock()
+	mock.calls.Delete = append(mock.calls.Delete, callInfo)
+	mock.lockDelete.Unlock()
+	return mock.DeleteFunc(contextMoqParam, deleteTargetPoolRequest, callOptions...)
+}
+
+// DeleteCalls gets all the calls that were made to Delete.
+// Check the length with:
+//
+//	len(mockedTargetPoolsClient.DeleteCalls())
+func (mock *targetPoolsClientMock) DeleteCalls() []struct {
+	ContextMoqParam         context.Context
+	DeleteTargetPoolRequest *computepb.DeleteTargetPoolRequest
+	CallOptions             []gax.CallOption
+} {
+	var calls []struct {
+		ContextMoqParam         context.Context
+		DeleteTargetPoolRequest *computepb.DeleteTargetPoolRequest
+		CallOptions             []gax.CallOption
+	}
+	mock.lockDelete.RLock()
+	calls = mock.calls.Delete
+	mock.lockDelete.RUnlock()
+	return calls
+}
@@ -0,0 +1,111 @@
+package cleanup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Pacer spaces out deletions, e.g. to spread the API load, snapshot cost and
+// risk of a cleanup over time.
+type Pacer interface {
+	// Wait blocks until the next disk may be deleted, or ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// Rate is a Pacer that allows n deletions per period, evenly spaced. The
+// first deletion is allowed right away. It is safe for concurrent use.
+type Rate struct {
+	interval time.Duration
+	// burst is how many deletions may follow each other without waiting
+	// after a pause.
+	burst int
+	now   func() time.Time
+	sleep func(context.Context, time.Duration) error
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRate returns a Rate allowing n deletions per period, e.g. 10 per hour.
+func NewRate(n int, per time.Duration) *Rate {
+	return &Rate{interval: per / time.Duration(n), burst: 1, now: time.Now, sleep: gax.Sleep}
+}
+
+// NewBurstRate returns a Rate allowing qps calls per second, with bursts of
+// up to burst calls after a pause, e.g. to stay within an API quota.
+func NewBurstRate(qps float64, burst int) *Rate {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Rate{interval: time.Duration(float64(time.Second) / qps), burst: burst, now: time.Now, sleep: gax.Sleep}
+}
+
+// Interval returns the time between two deletions.
+func (r *Rate) Interval() time.Duration {
+	return r.interval
+}
+
+func (r *Rate) Wait(ctx context.Context) error {
+	r.mu.Lock()
+	now := r.now()
+	// the slots missed during a pause can be used up to the burst
+	if earliest := now.Add(-time.Duration(r.burst-1) * r.interval); r.next.Before(earliest) {
+		r.next = earliest
+	}
+	wait := r.next.Sub(now)
+	// reserve the slot, so that concurrent workers wait for the next ones
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	return r.sleep(ctx, wait)
+}
+
+// rateLimitedDisksClient is a DisksClient that waits on limit before every
+// call that changes a disk, including retries.
+type rateLimitedDisksClient struct {
+	DisksClient
+	limit Pacer
+}
+
+// RateLimitDisks returns client with its calls that change disks, i.e.
+// SetLabels, CreateSnapshot, Delete and Insert, paced by limit, e.g. to stay
+// within the mutation quota of Compute Engine rather than being throttled.
+// Listing disks is not limited.
+func RateLimitDisks(client DisksClient, limit Pacer) DisksClient {
+	return &rateLimitedDisksClient{DisksClient: client, limit: limit}
+}
+
+func (c *rateLimitedDisksClient) CreateSnapshot(ctx context.Context, req *computepb.CreateSnapshotDiskRequest, opts ...gax.CallOption) (*computev1.Operation, error) {
+	if err := c.limit.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return c.DisksClient.CreateSnapshot(ctx, req, opts...)
+}
+
+func (c *rateLimitedDisksClient) Delete(ctx context.Context, req *computepb.DeleteDiskRequest, opts ...gax.CallOption) (*computev1.Operation, error) {
+	if err := c.limit.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return c.DisksClient.Delete(ctx, req, opts...)
+}
+
+func (c *rateLimitedDisksClient) Insert(ctx context.Context, req *computepb.InsertDiskRequest, opts ...gax.CallOption) (*computev1.Operation, error) {
+	if err := c.limit.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return c.DisksClient.Insert(ctx, req, opts...)
+}
+
+func (c *rateLimitedDisksClient) SetLabels(ctx context.Context, req *computepb.SetLabelsDiskRequest, opts ...gax.CallOption) (*computev1.Operation, error) {
+	if err := c.limit.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return c.DisksClient.SetLabels(ctx, req, opts...)
+}
@@ -0,0 +1,101 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+func Test_Rate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	r := NewRate(4, time.Hour)
+	r.now = func() time.Time { return now }
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	require.Equal(t, 15*time.Minute, r.Interval())
+
+	ctx := context.Background()
+	// the first deletion is allowed right away, the next ones are spaced
+	for i := 0; i < 3; i++ {
+		require.NoError(t, r.Wait(ctx))
+	}
+	require.Equal(t, []time.Duration{15 * time.Minute, 30 * time.Minute}, waits)
+
+	// time passed without deletions does not allow a burst
+	now = now.Add(3 * time.Hour)
+	waits = nil
+	require.NoError(t, r.Wait(ctx))
+	require.NoError(t, r.Wait(ctx))
+	require.Equal(t, []time.Duration{15 * time.Minute}, waits)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	now = now.Add(time.Hour)
+	require.ErrorIs(t, r.Wait(cancelled), context.Canceled)
+}
+
+func Test_BurstRate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	r := NewBurstRate(10, 3)
+	r.now = func() time.Time { return now }
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	require.Equal(t, 100*time.Millisecond, r.Interval())
+
+	// after a pause, up to burst calls are allowed right away
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, r.Wait(ctx))
+	}
+	require.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, waits)
+}
+
+func Test_RateLimitDisks(t *testing.T) {
+	t.Parallel()
+
+	var waited int
+	var waitErr error
+	limit := pacerFunc(func(context.Context) error {
+		waited++
+		return waitErr
+	})
+	dc := &disksClientMock{
+		SetLabelsFunc: func(context.Context, *computepb.SetLabelsDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+			return nil, nil
+		},
+		DeleteFunc: func(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+			return nil, nil
+		},
+		ListFunc: func(context.Context, *computepb.ListDisksRequest, ...gax.CallOption) *computev1.DiskIterator {
+			return &computev1.DiskIterator{}
+		},
+	}
+	client := RateLimitDisks(dc, limit)
+	ctx := context.Background()
+	_, err := client.SetLabels(ctx, &computepb.SetLabelsDiskRequest{})
+	require.NoError(t, err)
+	_, err = client.Delete(ctx, &computepb.DeleteDiskRequest{})
+	require.NoError(t, err)
+	client.List(ctx, &computepb.ListDisksRequest{})
+	require.Equal(t, 2, waited, "listing is not limited")
+
+	waitErr = context.Canceled
+	_, err = client.SetLabels(ctx, &computepb.SetLabelsDiskRequest{})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, dc.SetLabelsCalls(), 1)
+}
@@ -0,0 +1,99 @@
+package cleanup
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// LabelSnapshotComplete is the label the snapshot phase of a Cleaner sets on
+// a disk to the name of the snapshot it took. The delete phase only deletes
+// disks carrying it.
+const LabelSnapshotComplete = "snapshot-complete"
+
+// Phase splits a cleanup into two passes, so that the snapshots can be
+// verified before any disk is deleted.
+type Phase string
+
+const (
+	// PhaseAll snapshots and deletes every disk in one pass.
+	PhaseAll Phase = "all"
+	// PhaseSnapshot snapshots every disk and labels it with
+	// LabelSnapshotComplete, without deleting it.
+	PhaseSnapshot Phase = "snapshot"
+	// PhaseDelete deletes only the disks labelled with
+	// LabelSnapshotComplete, without taking another snapshot. The deletion
+	// of other disks is deferred with diskerr.ErrDeferred.
+	PhaseDelete Phase = "delete"
+)
+
+// ParsePhase validates s as a Phase. Empty means PhaseAll.
+func ParsePhase(s string) (Phase, error) {
+	switch p := Phase(s); p {
+	case "":
+		return PhaseAll, nil
+	case PhaseAll, PhaseSnapshot, PhaseDelete:
+		return p, nil
+	}
+	return "", xerrors.Errorf("unknown cleanup phase %q", s)
+}
+
+// action returns the action a Cleaner takes in phase p for a disk it does
+// not skip.
+func (p Phase) action() Action {
+	if p == PhaseSnapshot {
+		return ActionSnapshot
+	}
+	return ActionDelete
+}
+
+// checkPhase returns an error if disk has nothing left to do in phase: a
+// snapshot phase if it was done already, and a delete phase if it was not.
+func checkPhase(disk *computepb.Disk, phase Phase) error {
+	snapshot, complete := disk.GetLabels()[LabelSnapshotComplete]
+	switch {
+	case phase == PhaseSnapshot && complete:
+		return diskerr.New(diskerr.CodeSnapshotComplete, "disk %s: snapshot %s already complete", disk.GetName(), snapshot)
+	case phase == PhaseDelete && !complete:
+		return diskerr.New(diskerr.CodeDeferred, "disk %s: deletion deferred until the snapshot phase completes a snapshot of it", disk.GetName())
+	}
+	return nil
+}
+
+// snapshotPhase snapshots disk and labels it with LabelSnapshotComplete, or
+// only logs that it would in dry run mode.
+func (c *Cleaner) snapshotPhase(ctx context.Context, disk *computepb.Disk, zone string, r retrier, opts CleanupOptions) error {
+	var snapshot *computepb.Snapshot
+	var err error
+	if opts.ReuseSnapshot > 0 {
+		snapshot, err = c.reuseSnapshot(ctx, disk, zone, listOwnSnapshotsOf(ctx, opts.Snapshots, opts.ProjectID, disk), r, opts)
+	} else {
+		snapshot, err = c.snapshotDisk(ctx, disk, zone, r, opts)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return diskerr.ErrDryRun
+	}
+	labels, err := withLabel(disk, LabelSnapshotComplete, snapshot.GetName(), LabelBudgetSkip)
+	if err != nil {
+		return err
+	}
+	m := &Marker{client: c.client, bus: c.bus, sleep: c.sleep}
+	if _, err := m.setLabels(ctx, disk, zone, labels, MarkOptions{ProjectID: opts.ProjectID, Zones: opts.Zones, MaxRetries: opts.MaxRetries}); err != nil {
+		return diskerr.Wrap(diskerr.CodeAPI, err, "disk %s: failed to label snapshot %s complete", disk.GetName(), snapshot.GetName())
+	}
+	diskLogger(opts.ProjectID, zone, disk).Info().Str("snapshotName", snapshot.GetName()).Msg("snapshot of disk complete, deletion left to the delete phase")
+	return nil
+}
+
+// completedSnapshot returns the snapshot the snapshot phase took of disk, of
+// which only the name is known.
+func completedSnapshot(disk *computepb.Disk) *computepb.Snapshot {
+	return &computepb.Snapshot{Name: pointer.String(disk.GetLabels()[LabelSnapshotComplete])}
+}
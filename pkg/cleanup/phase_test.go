@@ -0,0 +1,136 @@
+package cleanup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_ParsePhase(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParsePhase("snapshot")
+	require.NoError(t, err)
+	require.Equal(t, PhaseSnapshot, p)
+
+	p, err = ParsePhase("")
+	require.NoError(t, err)
+	require.Equal(t, PhaseAll, p)
+
+	_, err = ParsePhase("verify")
+	require.EqualError(t, err, `unknown cleanup phase "verify"`)
+}
+
+func Test_CleanupPhases(t *testing.T) {
+	t.Parallel()
+
+	disk := func(labels map[string]string) diskIterator {
+		return &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				return &computepb.Disk{Name: pointer.String("test-disk"), Labels: labels}, nil
+			},
+		}
+	}
+	// the snapshots of the disks, which have no ID or size
+	snapshots := existingSnapshots(&computepb.Disk{}, computepb.Snapshot_STANDARD)
+	cleanupOne := func(dc DisksClient, bus *events.Bus, di diskIterator, phase Phase, dryRun bool) error {
+		c := NewCleaner(dc, bus)
+		c.wait = doneOperation
+		return c.cleanupOne(context.Background(), di, CleanupOptions{
+			ProjectID:  "testing",
+			Zones:      []string{"testzone"},
+			DoSnapshot: true,
+			Phase:      phase,
+			Snapshots:  snapshots,
+			DryRun:     dryRun,
+		})
+	}
+
+	t.Run("snapshot", func(t *testing.T) {
+		t.Parallel()
+
+		var labels map[string]string
+		dc := &disksClientMock{
+			CreateSnapshotFunc: func(context.Context, *computepb.CreateSnapshotDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				// taken by an earlier run, to side-step op.Wait(ctx)
+				return nil, &googleapi.Error{Code: http.StatusConflict}
+			},
+			SetLabelsFunc: func(_ context.Context, req *computepb.SetLabelsDiskRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+				labels = req.GetZoneSetLabelsRequestResource().GetLabels()
+				return nil, nil
+			},
+		}
+		bus := events.NewBus()
+		var processed events.Event
+		bus.Subscribe(func(e events.Event) { processed = e }, events.DiskProcessed)
+		seen := recordEvents(bus)
+		require.NoError(t, cleanupOne(dc, bus, disk(map[string]string{LabelMarkedForDeletion: "true"}), PhaseSnapshot, false))
+		require.Equal(t, map[string]string{LabelMarkedForDeletion: "true", LabelSnapshotComplete: "test-disk"}, labels)
+		require.Empty(t, dc.DeleteCalls())
+		require.Equal(t, string(ActionSnapshot), processed.Action)
+		require.Equal(t, []events.Type{events.DiskScanned, events.DiskProcessed}, *seen)
+	})
+
+	t.Run("snapshot dry run", func(t *testing.T) {
+		t.Parallel()
+
+		dc := &disksClientMock{}
+		err := cleanupOne(dc, events.NewBus(), disk(map[string]string{LabelMarkedForDeletion: "true"}), PhaseSnapshot, true)
+		require.ErrorIs(t, err, diskerr.ErrDryRun)
+		require.Empty(t, dc.CreateSnapshotCalls())
+		require.Empty(t, dc.SetLabelsCalls())
+	})
+
+	t.Run("snapshot already complete", func(t *testing.T) {
+		t.Parallel()
+
+		bus := events.NewBus()
+		var processed events.Event
+		bus.Subscribe(func(e events.Event) { processed = e }, events.DiskProcessed)
+		err := cleanupOne(&disksClientMock{}, bus, disk(map[string]string{LabelMarkedForDeletion: "true", LabelSnapshotComplete: "test-disk"}), PhaseSnapshot, false)
+		require.EqualError(t, err, "disk test-disk: snapshot test-disk already complete")
+		require.False(t, IsFailure(err))
+		require.Equal(t, string(ActionSkip), processed.Action)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		dc := &disksClientMock{
+			DeleteFunc: func(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+		}
+		bus := events.NewBus()
+		var snapshot *computepb.Snapshot
+		bus.Subscribe(func(e events.Event) { snapshot = e.Snapshot }, events.DiskDeleted)
+		require.NoError(t, cleanupOne(dc, bus, disk(map[string]string{LabelMarkedForDeletion: "true", LabelSnapshotComplete: "test-disk-1"}), PhaseDelete, false))
+		require.Empty(t, dc.CreateSnapshotCalls())
+		require.Len(t, dc.DeleteCalls(), 1)
+		require.Equal(t, "test-disk-1", snapshot.GetName())
+	})
+
+	t.Run("delete without snapshot", func(t *testing.T) {
+		t.Parallel()
+
+		dc := &disksClientMock{}
+		bus := events.NewBus()
+		var processed events.Event
+		bus.Subscribe(func(e events.Event) { processed = e }, events.DiskProcessed)
+		err := cleanupOne(dc, bus, disk(map[string]string{LabelMarkedForDeletion: "true"}), PhaseDelete, false)
+		require.ErrorIs(t, err, diskerr.ErrDeferred)
+		require.False(t, IsFailure(err))
+		require.Equal(t, string(ActionSkip), processed.Action)
+		require.Empty(t, dc.DeleteCalls())
+	})
+}
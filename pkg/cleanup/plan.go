@@ -0,0 +1,144 @@
+package cleanup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// PlanVersion is the version of the plan format written by mark.
+const PlanVersion = 1
+
+// Plan is the set of actions a mark run takes, written for review with
+// mark --plan-out. Executed with cleanup --plan, it restricts cleanup to the
+// disks it deletes: those it marks or finds marked already. The zero value is
+// an empty plan; Plan is safe for concurrent use.
+type Plan struct {
+	Version int           `json:"version"`
+	Created time.Time     `json:"created"`
+	Disks   []PlannedDisk `json:"disks"`
+
+	mu    sync.Mutex
+	index map[string]int
+}
+
+// PlannedDisk is the action a plan takes on a disk.
+type PlannedDisk struct {
+	ProjectID string `json:"projectID"`
+	Zone      string `json:"zone"`
+	Name      string `json:"name"`
+	Action    Action `json:"action"`
+	// Code is the reason for a skip, e.g. ALREADY_MARKED.
+	Code diskerr.Code `json:"code,omitempty"`
+	// Fingerprint identifies the state of the disk the action was planned
+	// for, see Fingerprint.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Deletes reports whether cleanup deletes the disk when executing the plan.
+func (d PlannedDisk) Deletes() bool {
+	return d.Action == ActionMark || d.Code == diskerr.CodeAlreadyMarked
+}
+
+// NewPlan returns an empty plan made at now.
+func NewPlan(now time.Time) *Plan {
+	return &Plan{Version: PlanVersion, Created: now.UTC()}
+}
+
+func planKey(projectID, zone, name string) string {
+	return projectID + "/" + zone + "/" + name
+}
+
+// Fingerprint returns a hash of the fields of disk that tell whether it was
+// used, or replaced by another disk of the same name. Labels are left out,
+// as mark changes them after planning.
+func Fingerprint(disk *computepb.Disk) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%d\n%s\n%s\n%s", disk.GetId(), disk.GetCreationTimestamp(), disk.GetSizeGb(), disk.GetLastAttachTimestamp(), disk.GetLastDetachTimestamp(), strings.Join(disk.GetUsers(), ","))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Add records that the mark run took action on disk in zone of projectID,
+// or skipped it with err. Skips are only recorded for disks that are marked
+// already; dry run errors do not count as a skip.
+func (p *Plan) Add(projectID, zone string, disk *computepb.Disk, action Action, err error) {
+	code := diskerr.Code("")
+	if err != nil && !errors.Is(err, diskerr.ErrDryRun) {
+		code = diskerr.CodeOf(err)
+		if code != diskerr.CodeAlreadyMarked {
+			return
+		}
+		action = ActionSkip
+	}
+	if action == ActionSkip && code == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Disks = append(p.Disks, PlannedDisk{
+		ProjectID:   projectID,
+		Zone:        zone,
+		Name:        disk.GetName(),
+		Action:      action,
+		Code:        code,
+		Fingerprint: Fingerprint(disk),
+	})
+	p.index = nil
+}
+
+// Sort orders the disks of the plan by project, zone and name, for review.
+func (p *Plan) Sort() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sort.Slice(p.Disks, func(i, j int) bool {
+		return planKey(p.Disks[i].ProjectID, p.Disks[i].Zone, p.Disks[i].Name) < planKey(p.Disks[j].ProjectID, p.Disks[j].Zone, p.Disks[j].Name)
+	})
+	p.index = nil
+}
+
+// Validate returns an error if p is not a plan this version can execute.
+func (p *Plan) Validate() error {
+	if p.Version != PlanVersion {
+		return xerrors.Errorf("unsupported plan version %d, expected %d", p.Version, PlanVersion)
+	}
+	return nil
+}
+
+// check returns a diskerr.CodeNotPlanned error unless p deletes disk, and a
+// diskerr.CodePlanStale error if disk changed since p was made. A nil plan
+// deletes every disk.
+func (p *Plan) check(projectID, zone string, disk *computepb.Disk) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	if p.index == nil {
+		p.index = make(map[string]int, len(p.Disks))
+		for i, d := range p.Disks {
+			p.index[planKey(d.ProjectID, d.Zone, d.Name)] = i
+		}
+	}
+	i, found := p.index[planKey(projectID, zone, disk.GetName())]
+	var planned PlannedDisk
+	if found {
+		planned = p.Disks[i]
+	}
+	p.mu.Unlock()
+	if !planned.Deletes() {
+		return diskerr.New(diskerr.CodeNotPlanned, "skipping disk %s: not deleted by the plan", disk.GetName())
+	}
+	if fingerprint := Fingerprint(disk); fingerprint != planned.Fingerprint {
+		return diskerr.New(diskerr.CodePlanStale, "skipping disk %s: changed since the plan was made, fingerprint %s instead of %s", disk.GetName(), fingerprint, planned.Fingerprint)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func Test_Plan(t *testing.T) {
+	t.Parallel()
+
+	disk := func(name, lastDetach string) *computepb.Disk {
+		id := uint64(1)
+		return &computepb.Disk{
+			Id:                  &id,
+			Name:                pointer.String(name),
+			CreationTimestamp:   pointer.String("2020-01-01T00:00:00Z"),
+			LastDetachTimestamp: pointer.String(lastDetach),
+		}
+	}
+	plan := NewPlan(time.Now())
+	plan.Add("testing", "testzone", disk("marked", "2020-02-01T00:00:00Z"), ActionMark, nil)
+	plan.Add("testing", "testzone", disk("dry-run", "2020-02-01T00:00:00Z"), ActionMark, diskerr.ErrDryRun)
+	plan.Add("testing", "testzone", disk("already-marked", "2020-02-01T00:00:00Z"), ActionSkip, diskerr.ErrAlreadyMarked)
+	plan.Add("testing", "testzone", disk("unmarked", "2020-02-01T00:00:00Z"), ActionUnmark, nil)
+	plan.Add("testing", "testzone", disk("recent", "2020-02-01T00:00:00Z"), ActionSkip, diskerr.ErrWithinCutoff)
+	plan.Add("testing", "testzone", disk("failed", "2020-02-01T00:00:00Z"), ActionMark, diskerr.New(diskerr.CodeAPI, "failed"))
+	plan.Sort()
+	var names []string
+	for _, d := range plan.Disks {
+		names = append(names, d.Name)
+	}
+	require.Equal(t, []string{"already-marked", "dry-run", "marked", "unmarked"}, names)
+
+	require.NoError(t, plan.check("testing", "testzone", disk("marked", "2020-02-01T00:00:00Z")))
+	require.NoError(t, plan.check("testing", "testzone", disk("dry-run", "2020-02-01T00:00:00Z")))
+	require.NoError(t, plan.check("testing", "testzone", disk("already-marked", "2020-02-01T00:00:00Z")))
+	require.Equal(t, diskerr.CodeNotPlanned, diskerr.CodeOf(plan.check("testing", "testzone", disk("unmarked", "2020-02-01T00:00:00Z"))))
+	require.Equal(t, diskerr.CodeNotPlanned, diskerr.CodeOf(plan.check("testing", "otherzone", disk("marked", "2020-02-01T00:00:00Z"))))
+	// attached and detached again since the plan was made
+	err := plan.check("testing", "testzone", disk("marked", "2020-03-01T00:00:00Z"))
+	require.Equal(t, diskerr.CodePlanStale, diskerr.CodeOf(err))
+	require.True(t, IsFailure(err))
+
+	var none *Plan
+	require.NoError(t, none.check("testing", "testzone", disk("anything", "")))
+	require.NoError(t, plan.Validate())
+	require.EqualError(t, (&Plan{Version: 2}).Validate(), "unsupported plan version 2, expected 1")
+}
@@ -0,0 +1,78 @@
+package cleanup
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// processDisks calls process for every disk returned by di, on up to
+// concurrency disks at a time, waiting on throttle, if set, before each.
+// Per-disk errors are counted in the returned Stats; an error is only
+// returned if listing disks fails or ctx is cancelled, after the disks being
+// processed are done.
+func processDisks(ctx context.Context, di diskIterator, concurrency int, throttle Pacer, cp *checkpoints, process func(*computepb.Disk) error) (Stats, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		stats Stats
+		err   error
+	)
+	// the iterator is only used from this goroutine, and only asked for the
+	// next disk once a worker is free
+	workers := make(chan struct{}, concurrency)
+	for {
+		workers <- struct{}{}
+		if err = ctx.Err(); err != nil {
+			// stop between two disks, e.g. on the termination notice of a
+			// spot VM
+			break
+		}
+		if throttle != nil {
+			if err = throttle.Wait(ctx); err != nil {
+				break
+			}
+		}
+		var disk *computepb.Disk
+		disk, err = di.Next()
+		if err == iterator.Done {
+			err = nil
+			break
+		}
+		if err != nil {
+			// the iterator will keep returning the same error
+			err = diskerr.Wrap(diskerr.CodeIterator, err, "iterating disks")
+			break
+		}
+		if cp.skipped(di, disk) {
+			<-workers
+			continue
+		}
+		seq := cp.dispatched(di, disk)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := process(disk)
+			mu.Lock()
+			stats.Scanned++
+			if IsFailure(err) {
+				stats.Failed++
+			}
+			mu.Unlock()
+			cp.completed(seq)
+			<-workers
+		}()
+	}
+	wg.Wait()
+	if err != nil {
+		cp.finish(err)
+	}
+	return stats, err
+}
@@ -0,0 +1,97 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func Test_ProcessDisks(t *testing.T) {
+	t.Parallel()
+
+	// disks returns an iterator over n disks, followed by err
+	disks := func(n int, err error) diskIterator {
+		var i int
+		return &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				if i == n {
+					return nil, err
+				}
+				i++
+				return &computepb.Disk{Name: pointer.String(fmt.Sprintf("disk-%d", i))}, nil
+			},
+		}
+	}
+
+	t.Run("bounded concurrency", func(t *testing.T) {
+		t.Parallel()
+		var mu sync.Mutex
+		var running, maxRunning int
+		stats, err := processDisks(context.Background(), disks(40, iterator.Done), 4, nil, newCheckpoints(nil, "testing", 1, nil), func(disk *computepb.Disk) error {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			switch disk.GetName() {
+			case "disk-1", "disk-2":
+				return diskerr.New(diskerr.CodeAPI, "google says no")
+			case "disk-3":
+				return diskerr.ErrAlreadyMarked
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, Stats{Scanned: 40, Failed: 2}, stats)
+		require.Equal(t, 4, maxRunning)
+	})
+
+	t.Run("iterator error waits for workers", func(t *testing.T) {
+		t.Parallel()
+		var mu sync.Mutex
+		var done int
+		stats, err := processDisks(context.Background(), disks(10, xerrors.New("backend unavailable")), 3, nil, newCheckpoints(nil, "testing", 1, nil), func(*computepb.Disk) error {
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			done++
+			mu.Unlock()
+			return nil
+		})
+		require.EqualError(t, err, "iterating disks: backend unavailable")
+		require.Equal(t, diskerr.CodeIterator, diskerr.CodeOf(err))
+		require.Equal(t, Stats{Scanned: 10}, stats)
+		require.Equal(t, 10, done)
+	})
+
+	t.Run("throttled", func(t *testing.T) {
+		t.Parallel()
+		var waits int
+		throttle := pacerFunc(func(context.Context) error {
+			waits++
+			if waits > 3 {
+				return context.Canceled
+			}
+			return nil
+		})
+		stats, err := processDisks(context.Background(), disks(10, iterator.Done), 1, throttle, newCheckpoints(nil, "testing", 1, nil), func(*computepb.Disk) error {
+			return nil
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, Stats{Scanned: 3}, stats)
+	})
+}
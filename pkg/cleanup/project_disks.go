@@ -0,0 +1,58 @@
+package cleanup
+
+import (
+	"context"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// projectDisksClient is a DisksClient sending the calls for a project to the
+// client of that project, if it has one of its own.
+type projectDisksClient struct {
+	fallback  DisksClient
+	byProject map[string]DisksClient
+}
+
+// ProjectDisks returns a DisksClient sending every call to the client in
+// byProject of the project of its request, and to fallback for projects
+// without one, e.g. to reach service projects as a service account of their
+// own while the runner lives in a host project.
+func ProjectDisks(fallback DisksClient, byProject map[string]DisksClient) DisksClient {
+	if len(byProject) == 0 {
+		return fallback
+	}
+	return &projectDisksClient{fallback: fallback, byProject: byProject}
+}
+
+func (c *projectDisksClient) client(projectID string) DisksClient {
+	if client, ok := c.byProject[projectID]; ok {
+		return client
+	}
+	return c.fallback
+}
+
+func (c *projectDisksClient) AggregatedList(ctx context.Context, req *computepb.AggregatedListDisksRequest, opts ...gax.CallOption) *computev1.DisksScopedListPairIterator {
+	return c.client(req.GetProject()).AggregatedList(ctx, req, opts...)
+}
+
+func (c *projectDisksClient) CreateSnapshot(ctx context.Context, req *computepb.CreateSnapshotDiskRequest, opts ...gax.CallOption) (*computev1.Operation, error) {
+	return c.client(req.GetProject()).CreateSnapshot(ctx, req, opts...)
+}
+
+func (c *projectDisksClient) Delete(ctx context.Context, req *computepb.DeleteDiskRequest, opts ...gax.CallOption) (*computev1.Operation, error) {
+	return c.client(req.GetProject()).Delete(ctx, req, opts...)
+}
+
+func (c *projectDisksClient) Insert(ctx context.Context, req *computepb.InsertDiskRequest, opts ...gax.CallOption) (*computev1.Operation, error) {
+	return c.client(req.GetProject()).Insert(ctx, req, opts...)
+}
+
+func (c *projectDisksClient) List(ctx context.Context, req *computepb.ListDisksRequest, opts ...gax.CallOption) *computev1.DiskIterator {
+	return c.client(req.GetProject()).List(ctx, req, opts...)
+}
+
+func (c *projectDisksClient) SetLabels(ctx context.Context, req *computepb.SetLabelsDiskRequest, opts ...gax.CallOption) (*computev1.Operation, error) {
+	return c.client(req.GetProject()).SetLabels(ctx, req, opts...)
+}
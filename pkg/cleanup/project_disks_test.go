@@ -0,0 +1,39 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+func Test_ProjectDisks(t *testing.T) {
+	t.Parallel()
+
+	client := func() *disksClientMock {
+		return &disksClientMock{
+			DeleteFunc: func(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, nil
+			},
+			ListFunc: func(context.Context, *computepb.ListDisksRequest, ...gax.CallOption) *computev1.DiskIterator {
+				return &computev1.DiskIterator{}
+			},
+		}
+	}
+	host, service := client(), client()
+	require.Same(t, host, ProjectDisks(host, nil), "nothing to route")
+
+	routed := ProjectDisks(host, map[string]DisksClient{"service": service})
+	ctx := context.Background()
+	_, err := routed.Delete(ctx, &computepb.DeleteDiskRequest{Project: "service", Disk: "d"})
+	require.NoError(t, err)
+	routed.List(ctx, &computepb.ListDisksRequest{Project: "service"})
+	routed.List(ctx, &computepb.ListDisksRequest{Project: "host"})
+	require.Len(t, service.DeleteCalls(), 1)
+	require.Len(t, service.ListCalls(), 1)
+	require.Empty(t, host.DeleteCalls())
+	require.Len(t, host.ListCalls(), 1)
+}
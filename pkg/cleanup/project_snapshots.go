@@ -0,0 +1,45 @@
+package cleanup
+
+import (
+	"context"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// projectSnapshotsClient is a SnapshotsClient sending the calls for a
+// project to the client of that project, if it has one of its own.
+type projectSnapshotsClient struct {
+	fallback  SnapshotsClient
+	byProject map[string]SnapshotsClient
+}
+
+// ProjectSnapshots returns a SnapshotsClient sending every call to the
+// client in byProject of the project of its request, and to fallback for
+// projects without one, as ProjectDisks does for disks.
+func ProjectSnapshots(fallback SnapshotsClient, byProject map[string]SnapshotsClient) SnapshotsClient {
+	if len(byProject) == 0 {
+		return fallback
+	}
+	return &projectSnapshotsClient{fallback: fallback, byProject: byProject}
+}
+
+func (c *projectSnapshotsClient) client(projectID string) SnapshotsClient {
+	if client, ok := c.byProject[projectID]; ok {
+		return client
+	}
+	return c.fallback
+}
+
+func (c *projectSnapshotsClient) Delete(ctx context.Context, req *computepb.DeleteSnapshotRequest, opts ...gax.CallOption) (*computev1.Operation, error) {
+	return c.client(req.GetProject()).Delete(ctx, req, opts...)
+}
+
+func (c *projectSnapshotsClient) Get(ctx context.Context, req *computepb.GetSnapshotRequest, opts ...gax.CallOption) (*computepb.Snapshot, error) {
+	return c.client(req.GetProject()).Get(ctx, req, opts...)
+}
+
+func (c *projectSnapshotsClient) List(ctx context.Context, req *computepb.ListSnapshotsRequest, opts ...gax.CallOption) *computev1.SnapshotIterator {
+	return c.client(req.GetProject()).List(ctx, req, opts...)
+}
@@ -0,0 +1,39 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+func Test_ProjectSnapshots(t *testing.T) {
+	t.Parallel()
+
+	client := func() *snapshotsClientMock {
+		return &snapshotsClientMock{
+			GetFunc: func(context.Context, *computepb.GetSnapshotRequest, ...gax.CallOption) (*computepb.Snapshot, error) {
+				return &computepb.Snapshot{}, nil
+			},
+			ListFunc: func(context.Context, *computepb.ListSnapshotsRequest, ...gax.CallOption) *computev1.SnapshotIterator {
+				return &computev1.SnapshotIterator{}
+			},
+		}
+	}
+	host, service := client(), client()
+	require.Same(t, host, ProjectSnapshots(host, nil), "nothing to route")
+
+	routed := ProjectSnapshots(host, map[string]SnapshotsClient{"service": service})
+	ctx := context.Background()
+	_, err := routed.Get(ctx, &computepb.GetSnapshotRequest{Project: "service", Snapshot: "s"})
+	require.NoError(t, err)
+	routed.List(ctx, &computepb.ListSnapshotsRequest{Project: "service"})
+	routed.List(ctx, &computepb.ListSnapshotsRequest{Project: "host"})
+	require.Len(t, service.GetCalls(), 1)
+	require.Len(t, service.ListCalls(), 1)
+	require.Empty(t, host.GetCalls())
+	require.Len(t, host.ListCalls(), 1)
+}
@@ -0,0 +1,43 @@
+package cleanup
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// ResourceMarks holds the marks of resources that cannot be labelled, such
+// as addresses, by the path of the resource, e.g.
+// projects/p/regions/r/addresses/a, as the date they were marked, like
+// LabelMarkedForDeletion. They are kept elsewhere, e.g. in a store.
+type ResourceMarks map[string]string
+
+// ResourceStats counts the resources other than disks handled by a single
+// mark or cleanup call.
+type ResourceStats struct {
+	Stats
+	Marked   int
+	Unmarked int
+	Deleted  int
+}
+
+// count counts a resource of kind that was scanned and to which action was
+// applied, or which failed or was skipped with err.
+func (s *ResourceStats) count(logger *zerolog.Logger, kind string, action Action, err error) {
+	s.Scanned++
+	switch {
+	case IsFailure(err):
+		s.Failed++
+		logger.Error().Err(err).Msgf("failed to process %s", kind)
+	case err != nil && !errors.Is(err, diskerr.ErrDryRun):
+		logger.Debug().Err(err).Msgf("skipping %s", kind)
+	case action == ActionMark:
+		s.Marked++
+	case action == ActionUnmark:
+		s.Unmarked++
+	case action == ActionDelete:
+		s.Deleted++
+	}
+}
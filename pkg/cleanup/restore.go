@@ -0,0 +1,180 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// RestoreOptions configures a single Restore call.
+type RestoreOptions struct {
+	ProjectID string
+	// DiskName is the name of the deleted disk.
+	DiskName string
+	// Zone is used if the snapshot does not record the zone of its source
+	// disk.
+	Zone string
+	// DiskType, e.g. pd-standard, is used if the snapshot does not record the
+	// type of its source disk.
+	DiskType string
+	// Labels restores the labels the disk had when it was deleted.
+	Labels bool
+	// Tenant restricts restoring to the disks of one tenant: the snapshot
+	// must carry the tenant label of its disk.
+	Tenant Tenant
+	// Snapshot, if set, is the name of the snapshot to restore from instead
+	// of the latest snapshot of the disk, e.g. from the archive index.
+	Snapshot string
+	DryRun   bool
+}
+
+// Restorer recreates disks deleted by a Cleaner from their snapshots.
+type Restorer struct {
+	disks     DisksClient
+	snapshots SnapshotsClient
+	bus       *events.Bus
+}
+
+// NewRestorer returns a Restorer that publishes its events on bus. bus may be
+// nil.
+func NewRestorer(disks DisksClient, snapshots SnapshotsClient, bus *events.Bus) *Restorer {
+	return &Restorer{disks: disks, snapshots: snapshots, bus: bus}
+}
+
+// Restore finds the latest snapshot of opts.DiskName, see findSnapshot, or
+// gets opts.Snapshot, and creates a disk of the same name, size and type from it in the zone the
+// disk was deleted from. It returns the disk that was, or in dry run mode
+// would have been, created.
+func (r *Restorer) Restore(ctx context.Context, opts RestoreOptions) (*computepb.Disk, error) {
+	snapshot, err := r.snapshot(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Tenant.check("snapshot "+snapshot.GetName(), snapshot.GetLabels()); err != nil {
+		return nil, err
+	}
+
+	zone := opts.Zone
+	if source := snapshot.GetSourceDisk(); source != "" {
+		// source is a URL, e.g. https://www.googleapis.com/compute/v1/projects/p/zones/us-east1-a/disks/d
+		zone = path.Base(path.Dir(path.Dir(source)))
+	}
+	diskType := opts.DiskType
+	if t := snapshot.GetLabels()[LabelSourceDiskType]; t != "" {
+		diskType = t
+	}
+	disk := &computepb.Disk{
+		Name:           pointer.String(opts.DiskName),
+		Description:    pointer.String(snapshot.GetDescription()),
+		SizeGb:         pointer.Int64(snapshot.GetDiskSizeGb()),
+		SourceSnapshot: pointer.String(snapshot.GetSelfLink()),
+		Type:           pointer.String(fmt.Sprintf("projects/%s/zones/%s/diskTypes/%s", opts.ProjectID, zone, diskType)),
+	}
+	if opts.Labels {
+		disk.Labels = restoredLabels(snapshot.GetLabels())
+	}
+
+	diskLogger(opts.ProjectID, zone, disk).Info().Str("snapshotName", snapshot.GetName()).
+		Int64("sizeGB", disk.GetSizeGb()).
+		Str("diskType", diskType).
+		Str("labels", fmt.Sprintf("%+v", disk.GetLabels())).
+		Bool("dryRun", opts.DryRun).
+		Msg("restoring disk from snapshot")
+	if opts.DryRun {
+		return disk, diskerr.ErrDryRun
+	}
+
+	op, err := r.disks.Insert(ctx, &computepb.InsertDiskRequest{
+		Project: opts.ProjectID,
+		Zone:    zone,
+		// a disk of that name can only be created once, so a retried
+		// request is deduplicated rather than failing as a conflict
+		RequestId:    pointer.String(resourceRequestID(snapshot.GetId(), snapshot.GetCreationTimestamp(), fmt.Sprintf("restore/%s/%s", zone, disk.GetName()))),
+		DiskResource: disk,
+	})
+	if err != nil {
+		return nil, diskerr.Wrap(diskerr.CodeAPI, err, "failed to restore disk %s", opts.DiskName)
+	}
+	if err := WaitOperation(ctx, op); err != nil {
+		return nil, diskerr.Wrap(diskerr.CodeAPI, err, "disk %s: failed to wait for restore", opts.DiskName)
+	}
+	r.bus.Publish(events.Event{Type: events.DiskRestored, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Snapshot: snapshot, Operation: operationName(op)})
+	return disk, nil
+}
+
+// snapshot returns the snapshot to restore opts.DiskName from.
+func (r *Restorer) snapshot(ctx context.Context, opts RestoreOptions) (*computepb.Snapshot, error) {
+	if opts.Snapshot != "" {
+		snapshot, err := r.snapshots.Get(ctx, &computepb.GetSnapshotRequest{Project: opts.ProjectID, Snapshot: opts.Snapshot})
+		if err != nil {
+			return nil, diskerr.Wrap(diskerr.CodeAPI, err, "disk %s: failed to get snapshot %s", opts.DiskName, opts.Snapshot)
+		}
+		return snapshot, nil
+	}
+	// snapshots taken by other tools may not carry our label, so match on
+	// names and the source disk instead of filtering
+	snapshots := r.snapshots.List(ctx, &computepb.ListSnapshotsRequest{Project: opts.ProjectID})
+	return findSnapshot(snapshots, opts.DiskName)
+}
+
+// findSnapshot returns the most recent snapshot of diskName: one named after
+// the disk, as created by a Cleaner, or <disk>-snapshot, or one whose source
+// disk has the name.
+func findSnapshot(si snapshotIterator, diskName string) (*computepb.Snapshot, error) {
+	var found *computepb.Snapshot
+	for {
+		snapshot, err := si.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, diskerr.Wrap(diskerr.CodeIterator, err, "iterating snapshots")
+		}
+		matches := snapshot.GetName() == diskName ||
+			snapshot.GetName() == diskName+"-snapshot" ||
+			strings.HasSuffix(snapshot.GetSourceDisk(), "/disks/"+diskName)
+		if !matches {
+			continue
+		}
+		if found == nil || createdAt(snapshot).After(createdAt(found)) {
+			found = snapshot
+		}
+	}
+	if found == nil {
+		return nil, xerrors.Errorf("no snapshot of disk %s found", diskName)
+	}
+	log.Debug().Str("diskName", diskName).Str("snapshotName", found.GetName()).Msg("found snapshot")
+	return found, nil
+}
+
+// createdAt returns the creation time of snapshot, or the zero time if it
+// cannot be parsed.
+func createdAt(snapshot *computepb.Snapshot) time.Time {
+	t, _ := time.Parse(time.RFC3339, snapshot.GetCreationTimestamp())
+	return t
+}
+
+// restoredLabels returns the labels of the deleted disk, without those added
+// by this tool.
+func restoredLabels(snapshotLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(snapshotLabels))
+	for k, v := range snapshotLabels {
+		switch k {
+		case LabelCreatedBy, LabelSourceDiskType, LabelMarkedForDeletion:
+			continue
+		}
+		labels[k] = v
+	}
+	return labels
+}
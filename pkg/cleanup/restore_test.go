@@ -0,0 +1,73 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_FindSnapshot(t *testing.T) {
+	t.Parallel()
+
+	iter := func(snapshots ...*computepb.Snapshot) snapshotIterator {
+		return &snapshotIteratorMock{
+			NextFunc: func() (*computepb.Snapshot, error) {
+				if len(snapshots) == 0 {
+					return nil, iterator.Done
+				}
+				s := snapshots[0]
+				snapshots = snapshots[1:]
+				return s, nil
+			},
+		}
+	}
+	snapshot := func(name, sourceDisk, created string) *computepb.Snapshot {
+		return &computepb.Snapshot{
+			Name:              pointer.String(name),
+			SourceDisk:        pointer.String(sourceDisk),
+			CreationTimestamp: pointer.String(created),
+		}
+	}
+
+	t.Run("latest match", func(t *testing.T) {
+		t.Parallel()
+		found, err := findSnapshot(iter(
+			snapshot("test-disk", "", "2022-01-01T10:00:00.000-08:00"),
+			snapshot("other-disk", "", "2022-05-01T10:00:00.000-07:00"),
+			snapshot("test-disk-snapshot", "", "2022-03-01T10:00:00.000-08:00"),
+			snapshot("manual", "https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/disks/test-disk", "2022-02-01T10:00:00.000-08:00"),
+		), "test-disk")
+		require.NoError(t, err)
+		require.Equal(t, "test-disk-snapshot", found.GetName())
+	})
+
+	t.Run("by source disk", func(t *testing.T) {
+		t.Parallel()
+		found, err := findSnapshot(iter(
+			snapshot("manual", "https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/disks/test-disk", "2022-02-01T10:00:00.000-08:00"),
+			snapshot("other", "https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/disks/not-test-disk", "2022-03-01T10:00:00.000-08:00"),
+		), "test-disk")
+		require.NoError(t, err)
+		require.Equal(t, "manual", found.GetName())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		t.Parallel()
+		_, err := findSnapshot(iter(snapshot("other-disk", "", "")), "test-disk")
+		require.EqualError(t, err, "no snapshot of disk test-disk found")
+	})
+}
+
+func Test_RestoredLabels(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, map[string]string{"team": "storage"}, restoredLabels(map[string]string{
+		"team":                 "storage",
+		LabelCreatedBy:         CreatedBy,
+		LabelSourceDiskType:    "pd-ssd",
+		LabelMarkedForDeletion: "true",
+	}))
+}
@@ -0,0 +1,69 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/rs/zerolog"
+	"google.golang.org/api/googleapi"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// callBackoff returns the backoff between retries of an API call. Pause picks
+// a random duration up to the current maximum, which spreads out the retries
+// of concurrent workers.
+func callBackoff() gax.Backoff {
+	return gax.Backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2}
+}
+
+// isRetryable reports whether err is a transient error, after which the same
+// request may succeed: rate limiting, server errors and network timeouts.
+// Every other error is permanent.
+func isRetryable(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		case http.StatusForbidden:
+			for _, item := range apiErr.Errors {
+				if diskerr.IsQuotaReason(item.Reason) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retrier retries API calls that fail with a retryable error.
+type retrier struct {
+	maxRetries int
+	backoff    func() gax.Backoff
+	sleep      func(context.Context, time.Duration) error
+}
+
+// do calls call until it succeeds, fails with a permanent error, or was
+// retried maxRetries times. Retrying requests that change disks is safe as
+// they carry the same request ID, see requestID.
+func (r retrier) do(ctx context.Context, logger *zerolog.Logger, what string, call func() error) error {
+	backoff := r.backoff()
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt > r.maxRetries || !isRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		pause := backoff.Pause()
+		logger.Warn().Err(err).Str("call", what).Int("attempt", attempt).Dur("backoff", pause).Msg("retrying api call")
+		if err := r.sleep(ctx, pause); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package cleanup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/googleapi"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func Test_IsRetryable(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name   string
+		err    error
+		expect bool
+	}{
+		{name: "too many requests", err: &googleapi.Error{Code: http.StatusTooManyRequests}, expect: true},
+		{name: "unavailable", err: &googleapi.Error{Code: http.StatusServiceUnavailable}, expect: true},
+		{name: "rate limit exceeded", err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, expect: true},
+		{name: "wrapped", err: xerrors.Errorf("set labels: %w", &googleapi.Error{Code: http.StatusBadGateway}), expect: true},
+		{name: "timeout", err: timeoutError{}, expect: true},
+		{name: "forbidden", err: &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, expect: false},
+		{name: "not found", err: &googleapi.Error{Code: http.StatusNotFound}, expect: false},
+		{name: "fingerprint mismatch", err: &googleapi.Error{Code: http.StatusPreconditionFailed}, expect: false},
+		{name: "other", err: xerrors.New("boom"), expect: false},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, testCase.expect, isRetryable(testCase.err))
+		})
+	}
+}
+
+func Test_Retrier(t *testing.T) {
+	t.Parallel()
+
+	// newRetrier returns a retrier that counts its sleeps instead of sleeping
+	newRetrier := func(maxRetries int, sleeps *int) retrier {
+		return retrier{maxRetries: maxRetries, backoff: callBackoff, sleep: func(context.Context, time.Duration) error {
+			*sleeps++
+			return nil
+		}}
+	}
+	// failing returns a call failing with err the first n times
+	failing := func(n int, err error, calls *int) func() error {
+		return func() error {
+			*calls++
+			if *calls <= n {
+				return err
+			}
+			return nil
+		}
+	}
+	rateLimited := &googleapi.Error{Code: http.StatusTooManyRequests}
+
+	t.Run("transient", func(t *testing.T) {
+		t.Parallel()
+		var calls, sleeps int
+		err := newRetrier(3, &sleeps).do(context.Background(), &log.Logger, "delete", failing(2, rateLimited, &calls))
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+		require.Equal(t, 2, sleeps)
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		t.Parallel()
+		var calls, sleeps int
+		err := newRetrier(3, &sleeps).do(context.Background(), &log.Logger, "delete", failing(10, rateLimited, &calls))
+		require.Equal(t, rateLimited, err)
+		require.Equal(t, 4, calls)
+		require.Equal(t, 3, sleeps)
+	})
+
+	t.Run("permanent", func(t *testing.T) {
+		t.Parallel()
+		var calls, sleeps int
+		err := newRetrier(3, &sleeps).do(context.Background(), &log.Logger, "delete", failing(10, &googleapi.Error{Code: http.StatusNotFound}, &calls))
+		require.Error(t, err)
+		require.Equal(t, 1, calls)
+		require.Equal(t, 0, sleeps)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		var calls, sleeps int
+		err := newRetrier(0, &sleeps).do(context.Background(), &log.Logger, "delete", failing(1, rateLimited, &calls))
+		require.Equal(t, rateLimited, err)
+		require.Equal(t, 1, calls)
+	})
+}
+
+func Test_MarkRetriesRateLimited(t *testing.T) {
+	t.Parallel()
+
+	var calls int
+	dc := &disksClientMock{
+		SetLabelsFunc: func(contextMoqParam context.Context, setLabelsDiskRequest *computepb.SetLabelsDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+			calls++
+			if calls < 3 {
+				return nil, &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}
+			}
+			return nil, nil
+		},
+	}
+	di := &diskIteratorMock{
+		NextFunc: func() (*computepb.Disk, error) {
+			return &computepb.Disk{
+				Name:                pointer.String("test-disk"),
+				LastAttachTimestamp: pointer.String(time.Now().AddDate(0, 0, -60).Format(time.RFC3339)),
+			}, nil
+		},
+	}
+	m := NewMarker(dc, events.NewBus())
+	var sleeps int
+	m.sleep = func(context.Context, time.Duration) error {
+		sleeps++
+		return nil
+	}
+	err := m.markOne(context.Background(), di, MarkOptions{ProjectID: "testing", Zones: []string{"testzone"}, Cutoff: 30 * 24 * time.Hour, MaxRetries: 5})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+	require.Equal(t, 2, sleeps)
+
+	// without retries the error is reported for the disk
+	calls = 0
+	err = m.markOne(context.Background(), di, MarkOptions{ProjectID: "testing", Zones: []string{"testzone"}, Cutoff: 30 * 24 * time.Hour})
+	require.Equal(t, diskerr.CodeAPI, diskerr.CodeOf(err))
+	require.Equal(t, 1, calls)
+}
@@ -0,0 +1,225 @@
+package cleanup
+
+import (
+	"math"
+	"path"
+	"time"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Default saturation points of the signals of a ScoreModel.
+const (
+	defaultIdleSaturationDays = 90
+	defaultSizeSaturationGB   = 1000
+)
+
+// ScoreModel rates how confident we are that a disk past its cutoff is
+// unused, from 0 to 1, as the weighted mean of signals that are each 0 for a
+// disk that looks used and 1 for one that looks abandoned. A signal without
+// data for a disk, e.g. the namespace of a disk not created for a
+// PersistentVolume, is left out of the mean. With a model, a disk past its
+// cutoff is only marked if its score reaches the threshold, which keeps
+// borderline disks.
+type ScoreModel struct {
+	// Threshold is the lowest score of a disk that is marked.
+	Threshold float64         `yaml:"threshold"`
+	Idle      IdleSignal      `yaml:"idle"`
+	Size      SizeSignal      `yaml:"size"`
+	Namespace NamespaceSignal `yaml:"namespace"`
+	Flapping  FlappingSignal  `yaml:"flapping"`
+	IO        IOSignal        `yaml:"io"`
+	// Unmarks counts how often disks were unmarked, and IOBytes the bytes
+	// read and written in the last IO.Days. The flapping and I/O signals
+	// are left out while nil.
+	Unmarks *DiskCounts `yaml:"-"`
+	IOBytes *DiskCounts `yaml:"-"`
+}
+
+// IdleSignal grows with the time a disk has been idle beyond its cutoff, and
+// is 1 once that reaches SaturationDays, by default 90.
+type IdleSignal struct {
+	Weight         float64 `yaml:"weight"`
+	SaturationDays int64   `yaml:"saturationDays"`
+}
+
+// SizeSignal grows with the size of a disk, as large disks cost the most to
+// keep, and is 1 from SaturationGB, by default 1000.
+type SizeSignal struct {
+	Weight       float64 `yaml:"weight"`
+	SaturationGB int64   `yaml:"saturationGB"`
+}
+
+// NamespaceSignal is the score of the first class matching the Kubernetes
+// namespace a disk was created for, e.g. 1 for ci-* and 0 for prod-*.
+type NamespaceSignal struct {
+	Weight  float64          `yaml:"weight"`
+	Classes []NamespaceClass `yaml:"classes"`
+}
+
+// NamespaceClass scores the namespaces matching Pattern, a path.Match
+// pattern.
+type NamespaceClass struct {
+	Pattern string  `yaml:"pattern"`
+	Score   float64 `yaml:"score"`
+}
+
+// FlappingSignal is 1 for a disk that was never unmarked after being marked,
+// and halves with every time it was, from ScoreModel.Unmarks.
+type FlappingSignal struct {
+	Weight float64 `yaml:"weight"`
+}
+
+// IOSignal is 1 for a disk without I/O in the last Days, by default 14, and
+// falls with every GiB read or written, from ScoreModel.IOBytes.
+type IOSignal struct {
+	Weight float64 `yaml:"weight"`
+	Days   int64   `yaml:"days"`
+}
+
+// Names of the signals in Score.Signals.
+const (
+	SignalIdle      = "idle"
+	SignalSize      = "size"
+	SignalNamespace = "namespace"
+	SignalFlapping  = "flapping"
+	SignalIO        = "io"
+)
+
+// Score is the rating of a disk by a ScoreModel.
+type Score struct {
+	Value float64
+	// Signals holds the value of every signal with data, by name.
+	Signals map[string]float64
+}
+
+// Validate checks that the weights, scores and threshold are in range.
+func (m *ScoreModel) Validate() error {
+	if m.Threshold < 0 || m.Threshold > 1 {
+		return xerrors.Errorf("score threshold %v out of range, expected 0 to 1", m.Threshold)
+	}
+	for name, w := range map[string]float64{SignalIdle: m.Idle.Weight, SignalSize: m.Size.Weight, SignalNamespace: m.Namespace.Weight, SignalFlapping: m.Flapping.Weight, SignalIO: m.IO.Weight} {
+		if w < 0 {
+			return xerrors.Errorf("weight of the %s signal is negative", name)
+		}
+	}
+	if m.Idle.Weight+m.Size.Weight+m.Namespace.Weight+m.Flapping.Weight+m.IO.Weight == 0 {
+		return xerrors.New("score model has no signal with a weight")
+	}
+	for _, c := range m.Namespace.Classes {
+		if _, err := path.Match(c.Pattern, ""); err != nil {
+			return xerrors.Errorf("invalid namespace pattern %q: %w", c.Pattern, err)
+		}
+		if c.Score < 0 || c.Score > 1 {
+			return xerrors.Errorf("score %v of namespace pattern %q out of range, expected 0 to 1", c.Score, c.Pattern)
+		}
+	}
+	return nil
+}
+
+// Score rates disk of projectID, which has been idle for idle and whose
+// cutoff is cutoff. A nil model rates every disk 1.
+func (m *ScoreModel) Score(disk *computepb.Disk, projectID string, idle, cutoff time.Duration) Score {
+	s := Score{Value: 1, Signals: map[string]float64{}}
+	if m == nil {
+		return s
+	}
+	var sum, weights float64
+	add := func(name string, weight, value float64) {
+		if weight <= 0 {
+			return
+		}
+		s.Signals[name] = value
+		sum += weight * value
+		weights += weight
+	}
+	saturation := m.Idle.SaturationDays
+	if saturation <= 0 {
+		saturation = defaultIdleSaturationDays
+	}
+	add(SignalIdle, m.Idle.Weight, ratio(float64(idle-cutoff), float64(time.Duration(saturation)*24*time.Hour)))
+	sizeSaturation := m.Size.SaturationGB
+	if sizeSaturation <= 0 {
+		sizeSaturation = defaultSizeSaturationGB
+	}
+	add(SignalSize, m.Size.Weight, ratio(float64(disk.GetSizeGb()), float64(sizeSaturation)))
+	if namespace := ClaimOf(disk).Namespace; namespace != "" {
+		for _, c := range m.Namespace.Classes {
+			if ok, _ := path.Match(c.Pattern, namespace); ok {
+				add(SignalNamespace, m.Namespace.Weight, c.Score)
+				break
+			}
+		}
+	}
+	if m.Unmarks != nil {
+		unmarks, _ := m.Unmarks.Get(projectID, disk.GetName())
+		add(SignalFlapping, m.Flapping.Weight, math.Pow(0.5, float64(unmarks)))
+	}
+	if m.IOBytes != nil {
+		bytes, _ := m.IOBytes.Get(projectID, disk.GetName())
+		add(SignalIO, m.IO.Weight, 1/(1+float64(bytes)/(1<<30)))
+	}
+	if weights > 0 {
+		s.Value = sum / weights
+	}
+	return s
+}
+
+// idleFor returns how long ago lastActivity, a timestamp as returned by
+// lastActivityTimestamp, was. A disk that was never used has been idle
+// forever.
+func idleFor(lastActivity string) time.Duration {
+	t, err := time.Parse(time.RFC3339, lastActivity)
+	if err != nil {
+		return math.MaxInt64
+	}
+	return time.Since(t)
+}
+
+// ratio returns v/max, clamped to 0 to 1.
+func ratio(v, max float64) float64 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= max:
+		return 1
+	default:
+		return v / max
+	}
+}
+
+// DiskCounts counts something per disk, e.g. how often it was unmarked. The
+// zero value is not usable, use NewDiskCounts.
+type DiskCounts struct {
+	// counts is keyed by project/name, like AttachHistory.
+	counts map[string]int64
+}
+
+// NewDiskCounts returns empty DiskCounts.
+func NewDiskCounts() *DiskCounts {
+	return &DiskCounts{counts: make(map[string]int64)}
+}
+
+// Add adds n to the count of the disk diskName in projectID.
+func (c *DiskCounts) Add(projectID, diskName string, n int64) {
+	c.counts[projectID+"/"+diskName] += n
+}
+
+// Len returns the number of disks counted.
+func (c *DiskCounts) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.counts)
+}
+
+// Get returns the count of the disk diskName in projectID, and whether it
+// was counted. It is safe to call on nil counts.
+func (c *DiskCounts) Get(projectID, diskName string) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	n, ok := c.counts[projectID+"/"+diskName]
+	return n, ok
+}
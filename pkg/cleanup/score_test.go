@@ -0,0 +1,127 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_ScoreModel(t *testing.T) {
+	t.Parallel()
+
+	const day = 24 * time.Hour
+	unmarks := NewDiskCounts()
+	unmarks.Add("testing", "flapping", 1)
+	unmarks.Add("testing", "flapping", 1)
+	ioBytes := NewDiskCounts()
+	ioBytes.Add("testing", "busy", 3<<30)
+
+	model := &ScoreModel{
+		Idle:      IdleSignal{Weight: 2, SaturationDays: 60},
+		Size:      SizeSignal{Weight: 1, SaturationGB: 100},
+		Namespace: NamespaceSignal{Weight: 1, Classes: []NamespaceClass{{Pattern: "ci-*", Score: 1}, {Pattern: "*", Score: 0.5}}},
+		Flapping:  FlappingSignal{Weight: 1},
+		IO:        IOSignal{Weight: 1},
+		Unmarks:   unmarks,
+		IOBytes:   ioBytes,
+	}
+	disk := func(name string, sizeGB int64, namespace string) *computepb.Disk {
+		d := &computepb.Disk{Name: pointer.String(name), SizeGb: pointer.Int64(sizeGB)}
+		if namespace != "" {
+			d.Description = pointer.String(`{"kubernetes.io/created-for/pvc/namespace":"` + namespace + `"}`)
+		}
+		return d
+	}
+
+	for _, tt := range []struct {
+		name    string
+		model   *ScoreModel
+		disk    *computepb.Disk
+		idle    time.Duration
+		expect  float64
+		signals map[string]float64
+	}{
+		{
+			name:   "abandoned",
+			model:  model,
+			disk:   disk("abandoned", 200, "ci-1234"),
+			idle:   120 * day,
+			expect: 1,
+			signals: map[string]float64{
+				SignalIdle: 1, SignalSize: 1, SignalNamespace: 1, SignalFlapping: 1, SignalIO: 1,
+			},
+		},
+		{
+			name:   "borderline",
+			model:  model,
+			disk:   disk("flapping", 50, "default"),
+			idle:   45 * day,
+			expect: (2*0.25 + 0.5 + 0.5 + 0.25 + 1) / 6,
+			signals: map[string]float64{
+				SignalIdle: 0.25, SignalSize: 0.5, SignalNamespace: 0.5, SignalFlapping: 0.25, SignalIO: 1,
+			},
+		},
+		{
+			name:   "without namespace",
+			model:  model,
+			disk:   disk("busy", 100, ""),
+			idle:   90 * day,
+			expect: (2*1 + 1 + 1 + 0.25) / 5,
+			signals: map[string]float64{
+				SignalIdle: 1, SignalSize: 1, SignalFlapping: 1, SignalIO: 0.25,
+			},
+		},
+		{
+			name:   "nil model",
+			disk:   disk("abandoned", 200, ""),
+			idle:   120 * day,
+			expect: 1,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := tt.model.Score(tt.disk, "testing", tt.idle, 30*day)
+			require.InDelta(t, tt.expect, s.Value, 1e-9)
+			if tt.signals != nil {
+				require.Len(t, s.Signals, len(tt.signals))
+				for name, v := range tt.signals {
+					require.InDelta(t, v, s.Signals[name], 1e-9, name)
+				}
+			}
+		})
+	}
+}
+
+func Test_ScoreModelValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name  string
+		model ScoreModel
+		err   string
+	}{
+		{name: "valid", model: ScoreModel{Threshold: 0.6, Idle: IdleSignal{Weight: 1}}},
+		{name: "threshold", model: ScoreModel{Threshold: 1.5, Idle: IdleSignal{Weight: 1}}, err: "score threshold 1.5 out of range, expected 0 to 1"},
+		{name: "negative weight", model: ScoreModel{Idle: IdleSignal{Weight: 1}, Size: SizeSignal{Weight: -1}}, err: "weight of the size signal is negative"},
+		{name: "no weights", model: ScoreModel{Threshold: 0.5}, err: "score model has no signal with a weight"},
+		{name: "pattern", model: ScoreModel{Namespace: NamespaceSignal{Weight: 1, Classes: []NamespaceClass{{Pattern: "[", Score: 1}}}}, err: `invalid namespace pattern "["`},
+		{name: "class score", model: ScoreModel{Namespace: NamespaceSignal{Weight: 1, Classes: []NamespaceClass{{Pattern: "ci-*", Score: 2}}}}, err: `score 2 of namespace pattern "ci-*" out of range, expected 0 to 1`},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.model.Validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package cleanup
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Selector selects disks by name, labels, type, size and creation source once
+// they were listed, as an alternative to writing a list filter. The zero Selector
+// selects every disk.
+type Selector struct {
+	// Name, if set, must match the name of a selected disk.
+	Name *regexp.Regexp
+	// Include are labels a selected disk must all have, with these values.
+	Include map[string]string
+	// Exclude are labels a selected disk must have none of with these
+	// values.
+	Exclude map[string]string
+	// Sources, if set, are the creation sources of the selected disks.
+	Sources []Source
+	// Types, if set, are the types of the selected disks, e.g. pd-ssd.
+	Types []string
+	// MinSizeGB and MaxSizeGB, if positive, bound the size of the selected
+	// disks, inclusive.
+	MinSizeGB, MaxSizeGB int64
+	// IncludeNames, if set, must match the name of a selected disk.
+	IncludeNames NameList
+	// ExcludeNames must not match the name of a selected disk. It protects
+	// disks regardless of their labels and timestamps.
+	ExcludeNames NameList
+	// Cluster, if set, is the GKE cluster selected disks were created for,
+	// see InCluster.
+	Cluster string
+}
+
+// NameList is a list of disk names or regular expressions, as kept in an
+// include or exclude file.
+type NameList []*regexp.Regexp
+
+// ParseNameList parses data, a newline-delimited list of disk names or
+// regular expressions, which must match the whole name. Blank lines and
+// lines starting with # are ignored.
+func ParseNameList(data []byte) (NameList, error) {
+	list := NameList{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + line + ")$")
+		if err != nil {
+			return nil, xerrors.Errorf("line %d: %w", n, err)
+		}
+		list = append(list, re)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Matches reports whether any entry of l matches name.
+func (l NameList) Matches(name string) bool {
+	for _, re := range l {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSelector returns the Selector of disks whose name matches nameRegex,
+// if set, and with the include labels but none of the exclude labels, both
+// given as key=value.
+func ParseSelector(nameRegex string, include, exclude []string) (Selector, error) {
+	var (
+		s   Selector
+		err error
+	)
+	if nameRegex != "" {
+		if s.Name, err = regexp.Compile(nameRegex); err != nil {
+			return Selector{}, xerrors.Errorf("parse name regex: %w", err)
+		}
+	}
+	if s.Include, err = parseLabels(include); err != nil {
+		return Selector{}, err
+	}
+	if s.Exclude, err = parseLabels(exclude); err != nil {
+		return Selector{}, err
+	}
+	return s, nil
+}
+
+// diskTypeName matches the name of a disk type.
+var diskTypeName = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+
+// ParseDiskTypes validates types, the names of disk types, e.g. pd-ssd, or
+// their URLs, and returns their names.
+func ParseDiskTypes(types []string) ([]string, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = path.Base(strings.TrimSpace(t))
+		if !diskTypeName.MatchString(names[i]) {
+			return nil, xerrors.Errorf("invalid disk type %q, expected a name such as pd-ssd or pd-standard", t)
+		}
+	}
+	return names, nil
+}
+
+// DiskType returns the name of the type of disk, e.g. pd-ssd.
+func DiskType(disk *computepb.Disk) string {
+	if disk.GetType() == "" {
+		return ""
+	}
+	return path.Base(disk.GetType())
+}
+
+func parseLabels(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, xerrors.Errorf("invalid label %q: expected key=value", pair)
+		}
+		labels[pair[:i]] = pair[i+1:]
+	}
+	return labels, nil
+}
+
+// Matches reports whether s selects disk.
+func (s Selector) Matches(disk *computepb.Disk) bool {
+	if s.Name != nil && !s.Name.MatchString(disk.GetName()) {
+		return false
+	}
+	if s.IncludeNames != nil && !s.IncludeNames.Matches(disk.GetName()) {
+		return false
+	}
+	if s.ExcludeNames.Matches(disk.GetName()) {
+		return false
+	}
+	if s.Cluster != "" && !InCluster(disk, s.Cluster) {
+		return false
+	}
+	if len(s.Types) > 0 && indexOf(s.Types, DiskType(disk)) < 0 {
+		return false
+	}
+	if (s.MinSizeGB > 0 && disk.GetSizeGb() < s.MinSizeGB) || (s.MaxSizeGB > 0 && disk.GetSizeGb() > s.MaxSizeGB) {
+		return false
+	}
+	labels := disk.GetLabels()
+	for k, v := range s.Include {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	for k, v := range s.Exclude {
+		if value, ok := labels[k]; ok && value == v {
+			return false
+		}
+	}
+	if len(s.Sources) == 0 {
+		return true
+	}
+	source := DiskSource(disk)
+	for _, selected := range s.Sources {
+		if selected == source {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Selector) selectsAll() bool {
+	return s.Name == nil && len(s.Include) == 0 && len(s.Exclude) == 0 && len(s.Sources) == 0 && len(s.Types) == 0 && s.MinSizeGB <= 0 && s.MaxSizeGB <= 0 && s.IncludeNames == nil && len(s.ExcludeNames) == 0 && s.Cluster == ""
+}
+
+// selectDisks returns an iterator over the disks of di that s selects.
+func selectDisks(di diskIterator, s Selector) diskIterator {
+	if s.selectsAll() {
+		return di
+	}
+	selected := &selectedDiskIterator{diskIterator: di, selector: s}
+	if it, ok := di.(cursorIterator); ok {
+		// keep checkpoints working
+		return &selectedCursorIterator{selectedDiskIterator: selected, cursor: it}
+	}
+	return selected
+}
+
+type selectedDiskIterator struct {
+	diskIterator
+	selector Selector
+}
+
+func (it *selectedDiskIterator) Next() (*computepb.Disk, error) {
+	for {
+		disk, err := it.diskIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if it.selector.Matches(disk) {
+			return disk, nil
+		}
+	}
+}
+
+type selectedCursorIterator struct {
+	*selectedDiskIterator
+	cursor cursorIterator
+}
+
+func (it *selectedCursorIterator) Cursor() Cursor {
+	return it.cursor.Cursor()
+}
@@ -0,0 +1,189 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_ParseSelector(t *testing.T) {
+	t.Parallel()
+
+	s, err := ParseSelector("", nil, nil)
+	require.NoError(t, err)
+	require.True(t, s.selectsAll())
+
+	s, err = ParseSelector("^pvc-", []string{"team=payments", "env="}, []string{"keep=true"})
+	require.NoError(t, err)
+	require.Equal(t, "^pvc-", s.Name.String())
+	require.Equal(t, map[string]string{"team": "payments", "env": ""}, s.Include)
+	require.Equal(t, map[string]string{"keep": "true"}, s.Exclude)
+
+	_, err = ParseSelector("(", nil, nil)
+	require.Error(t, err)
+
+	_, err = ParseSelector("", []string{"team"}, nil)
+	require.EqualError(t, err, `invalid label "team": expected key=value`)
+}
+
+func Test_SelectorMatches(t *testing.T) {
+	t.Parallel()
+
+	s, err := ParseSelector("^pvc-", []string{"team=payments"}, []string{"keep=true"})
+	require.NoError(t, err)
+	tests := []struct {
+		name     string
+		disk     *computepb.Disk
+		expected bool
+	}{
+		{
+			name:     "selected",
+			disk:     &computepb.Disk{Name: pointer.String("pvc-1"), Labels: map[string]string{"team": "payments", "keep": "false"}},
+			expected: true,
+		},
+		{
+			name: "name mismatch",
+			disk: &computepb.Disk{Name: pointer.String("boot-1"), Labels: map[string]string{"team": "payments"}},
+		},
+		{
+			name: "missing label",
+			disk: &computepb.Disk{Name: pointer.String("pvc-1")},
+		},
+		{
+			name: "other label value",
+			disk: &computepb.Disk{Name: pointer.String("pvc-1"), Labels: map[string]string{"team": "search"}},
+		},
+		{
+			name: "excluded",
+			disk: &computepb.Disk{Name: pointer.String("pvc-1"), Labels: map[string]string{"team": "payments", "keep": "true"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expected, s.Matches(tt.disk))
+		})
+	}
+
+	t.Run("sources", func(t *testing.T) {
+		t.Parallel()
+		s := Selector{Sources: []Source{SourceBlank, SourceSnapshot}}
+		require.True(t, s.Matches(&computepb.Disk{Name: pointer.String("pvc-1")}))
+		require.True(t, s.Matches(&computepb.Disk{Name: pointer.String("restored"), SourceSnapshot: pointer.String("projects/p/global/snapshots/s")}))
+		require.False(t, s.Matches(&computepb.Disk{Name: pointer.String("boot-1"), SourceImage: pointer.String("projects/debian-cloud/global/images/debian-11")}))
+	})
+
+	t.Run("types", func(t *testing.T) {
+		t.Parallel()
+		s := Selector{Types: []string{"pd-ssd", "pd-balanced"}}
+		require.False(t, s.selectsAll())
+		require.True(t, s.Matches(&computepb.Disk{Name: pointer.String("pvc-1"), Type: pointer.String("https://www.googleapis.com/compute/v1/projects/p/zones/us-east1-b/diskTypes/pd-ssd")}))
+		require.True(t, s.Matches(&computepb.Disk{Name: pointer.String("pvc-2"), Type: pointer.String("projects/p/zones/us-east1-b/diskTypes/pd-balanced")}))
+		require.False(t, s.Matches(&computepb.Disk{Name: pointer.String("pvc-3"), Type: pointer.String("projects/p/zones/us-east1-b/diskTypes/pd-standard")}))
+		require.False(t, s.Matches(&computepb.Disk{Name: pointer.String("pvc-4")}))
+	})
+
+	t.Run("size", func(t *testing.T) {
+		t.Parallel()
+		s := Selector{MinSizeGB: 10, MaxSizeGB: 100}
+		require.False(t, s.selectsAll())
+		for size, expected := range map[int64]bool{5: false, 10: true, 100: true, 101: false} {
+			require.Equal(t, expected, s.Matches(&computepb.Disk{Name: pointer.String("pvc-1"), SizeGb: pointer.Int64(size)}), size)
+		}
+		require.True(t, Selector{MinSizeGB: 500}.Matches(&computepb.Disk{Name: pointer.String("pvc-1"), SizeGb: pointer.Int64(1000)}))
+	})
+
+	t.Run("cluster", func(t *testing.T) {
+		t.Parallel()
+		s := Selector{Cluster: "prod"}
+		require.False(t, s.selectsAll())
+		require.True(t, s.Matches(&computepb.Disk{Name: pointer.String("pvc-1"), Labels: map[string]string{LabelClusterName: "prod"}}))
+		require.False(t, s.Matches(&computepb.Disk{Name: pointer.String("pvc-1"), Labels: map[string]string{LabelClusterName: "staging"}}))
+		require.False(t, s.Matches(&computepb.Disk{Name: pointer.String("pvc-1")}))
+	})
+}
+
+func Test_SelectDisks(t *testing.T) {
+	t.Parallel()
+
+	names := []string{"pvc-1", "boot-1", "pvc-2"}
+	di := newRetryingDiskIterator(context.Background(), "us-east1-b", "p1", func(string) pagedDiskIterator {
+		return &pagedDiskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				if len(names) == 0 {
+					return nil, iterator.Done
+				}
+				disk := &computepb.Disk{Name: pointer.String(names[0])}
+				names = names[1:]
+				return disk, nil
+			},
+			PageTokenFunc: func() string { return "p1" },
+		}
+	})
+	s, err := ParseSelector("^pvc-", nil, nil)
+	require.NoError(t, err)
+	it := selectDisks(di, s)
+	var selected []string
+	for {
+		disk, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		require.NoError(t, err)
+		selected = append(selected, disk.GetName())
+		// checkpoints still see the page of the disk
+		require.Equal(t, Cursor{Zone: "us-east1-b", PageToken: "p1"}, it.(cursorIterator).Cursor())
+	}
+	require.Equal(t, []string{"pvc-1", "pvc-2"}, selected)
+
+	require.Equal(t, diskIterator(di), selectDisks(di, Selector{}))
+}
+
+func Test_ParseNameList(t *testing.T) {
+	t.Parallel()
+
+	list, err := ParseNameList([]byte(`
+# databases of the payments team
+payments-db
+  pvc-[0-9a-f-]+-keep
+`))
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.True(t, list.Matches("payments-db"))
+	require.False(t, list.Matches("payments-db-2"))
+	require.True(t, list.Matches("pvc-0123-abcd-keep"))
+	require.False(t, list.Matches("other"))
+
+	s := Selector{ExcludeNames: list}
+	require.False(t, s.selectsAll())
+	require.False(t, s.Matches(&computepb.Disk{Name: pointer.String("payments-db")}))
+	require.True(t, s.Matches(&computepb.Disk{Name: pointer.String("other")}))
+
+	// an empty include file selects nothing
+	empty, err := ParseNameList([]byte("# no disks yet\n"))
+	require.NoError(t, err)
+	require.False(t, Selector{IncludeNames: empty}.Matches(&computepb.Disk{Name: pointer.String("other")}))
+
+	_, err = ParseNameList([]byte("ok\n(\n"))
+	require.ErrorContains(t, err, "line 2")
+}
+
+func Test_ParseDiskTypes(t *testing.T) {
+	t.Parallel()
+
+	types, err := ParseDiskTypes([]string{"pd-ssd", " projects/p/zones/us-east1-b/diskTypes/hyperdisk-balanced"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"pd-ssd", "hyperdisk-balanced"}, types)
+
+	types, err = ParseDiskTypes(nil)
+	require.NoError(t, err)
+	require.Nil(t, types)
+
+	_, err = ParseDiskTypes([]string{"PD_SSD"})
+	require.EqualError(t, err, `invalid disk type "PD_SSD", expected a name such as pd-ssd or pd-standard`)
+}
@@ -0,0 +1,122 @@
+package cleanup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// DefaultSnapshotNameTemplate names a snapshot after its disk.
+const DefaultSnapshotNameTemplate = "{{.Disk}}"
+
+// maxSnapshotName is the maximum length of a Compute Engine resource name.
+const maxSnapshotName = 63
+
+// SnapshotNameData is what a snapshot name template is executed with.
+type SnapshotNameData struct {
+	// Disk, Zone and ProjectID locate the disk.
+	Disk      string
+	Zone      string
+	ProjectID string
+	// Date is the UTC date of the snapshot, e.g. 20220301.
+	Date string
+	// Hash is a short hash of the disk, which tells apart disks of the same
+	// name in different zones or projects, or created at different times.
+	Hash string
+}
+
+// SnapshotNamer names the snapshots a Cleaner takes from a template. A nil
+// *SnapshotNamer names them after their disk.
+type SnapshotNamer struct {
+	tmpl *template.Template
+}
+
+// ParseSnapshotNameTemplate parses text, a text/template executed with
+// SnapshotNameData, e.g. {{.Disk}}-{{.Date}}.
+func ParseSnapshotNameTemplate(text string) (*SnapshotNamer, error) {
+	tmpl, err := template.New("snapshot-name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, xerrors.Errorf("parse snapshot name template: %w", err)
+	}
+	n := &SnapshotNamer{tmpl: tmpl}
+	// fail early on fields that do not exist
+	if _, err := n.execute(SnapshotNameData{Disk: "disk", Zone: "zone", ProjectID: "project", Date: "20060102", Hash: "00000000"}); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Name returns the name of the snapshot of disk in zone of projectID taken
+// at now. The name is made a valid resource name: lower case, at most 63
+// characters, truncated names ending in the hash of the full one.
+func (n *SnapshotNamer) Name(disk *computepb.Disk, zone, projectID string, now time.Time) (string, error) {
+	if n == nil {
+		return disk.GetName(), nil
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s/%d/%s", projectID, zone, disk.GetName(), disk.GetId(), disk.GetCreationTimestamp())))
+	name, err := n.execute(SnapshotNameData{
+		Disk:      disk.GetName(),
+		Zone:      zone,
+		ProjectID: projectID,
+		Date:      now.UTC().Format("20060102"),
+		Hash:      hex.EncodeToString(sum[:4]),
+	})
+	if err != nil {
+		return "", err
+	}
+	return validSnapshotName(name), nil
+}
+
+func (n *SnapshotNamer) execute(data SnapshotNameData) (string, error) {
+	var b strings.Builder
+	if err := n.tmpl.Execute(&b, data); err != nil {
+		return "", xerrors.Errorf("execute snapshot name template: %w", err)
+	}
+	if b.Len() == 0 {
+		return "", xerrors.New("snapshot name template gives an empty name")
+	}
+	return b.String(), nil
+}
+
+// validSnapshotName turns name into a valid resource name, matching
+// [a-z]([-a-z0-9]*[a-z0-9])? and at most 63 characters long.
+func validSnapshotName(name string) string {
+	b := []byte(strings.ToLower(name))
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			b[i] = '-'
+		}
+	}
+	valid := string(b)
+	if valid[0] < 'a' || valid[0] > 'z' {
+		valid = "s-" + valid
+	}
+	if len(valid) > maxSnapshotName {
+		// keep truncated names apart by the hash of the full one
+		sum := sha256.Sum256([]byte(name))
+		valid = strings.TrimRight(valid[:maxSnapshotName-9], "-") + "-" + hex.EncodeToString(sum[:4])
+	}
+	return strings.TrimRight(valid, "-")
+}
+
+// ParseSnapshotLabels parses comma-separated key=value pairs as labels to
+// set on the snapshots a Cleaner takes. The labels a Cleaner sets itself
+// cannot be overridden.
+func ParseSnapshotLabels(pairs []string) (map[string]string, error) {
+	labels, err := parseLabels(pairs)
+	if err != nil {
+		return nil, err
+	}
+	for _, reserved := range []string{LabelCreatedBy, LabelSourceDiskType} {
+		if _, found := labels[reserved]; found {
+			return nil, xerrors.Errorf("snapshot label %s is reserved", reserved)
+		}
+	}
+	return labels, nil
+}
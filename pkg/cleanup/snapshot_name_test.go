@@ -0,0 +1,141 @@
+package cleanup
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_SnapshotNamer(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 23, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+	disk := &computepb.Disk{Name: pointer.String("pvc-1234")}
+	long := &computepb.Disk{Name: pointer.String("gke-cluster-a1b2c3d4-dynamic-pvc-01234567-89ab-cdef-0123-456789abcdef")}
+
+	for _, tt := range []struct {
+		name   string
+		tmpl   string
+		disk   *computepb.Disk
+		expect string
+	}{
+		{name: "default", tmpl: DefaultSnapshotNameTemplate, disk: disk, expect: "pvc-1234"},
+		{name: "date in UTC", tmpl: "{{.Disk}}-{{.Date}}", disk: disk, expect: "pvc-1234-20220302"},
+		{name: "sanitized", tmpl: "{{.ProjectID}}_{{.Zone}}/{{.Disk}}", disk: disk, expect: "my-project-us-east1-b-pvc-1234"},
+		{name: "starts with a letter", tmpl: "{{.Date}}-{{.Disk}}", disk: disk, expect: "s-20220302-pvc-1234"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := ParseSnapshotNameTemplate(tt.tmpl)
+			require.NoError(t, err)
+			name, err := n.Name(tt.disk, "us-east1-b", "My_Project", now)
+			require.NoError(t, err)
+			require.Equal(t, tt.expect, name)
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		t.Parallel()
+
+		n, err := ParseSnapshotNameTemplate("{{.Disk}}-{{.Date}}-{{.Hash}}")
+		require.NoError(t, err)
+		name, err := n.Name(long, "us-east1-b", "testing", now)
+		require.NoError(t, err)
+		require.Len(t, name, maxSnapshotName)
+		require.True(t, strings.HasPrefix(name, "gke-cluster-a1b2c3d4-dynamic-pvc-01234567-89ab-cdef-01-"), name)
+		// a disk of the same name in another zone gets another name
+		other, err := n.Name(long, "us-east1-c", "testing", now)
+		require.NoError(t, err)
+		require.NotEqual(t, name, other)
+		// and the same disk the same name on a restart
+		again, err := n.Name(long, "us-east1-b", "testing", now)
+		require.NoError(t, err)
+		require.Equal(t, name, again)
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+
+		var n *SnapshotNamer
+		name, err := n.Name(long, "us-east1-b", "testing", now)
+		require.NoError(t, err)
+		require.Equal(t, long.GetName(), name)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ParseSnapshotNameTemplate("{{.Disk")
+		require.ErrorContains(t, err, "parse snapshot name template")
+		_, err = ParseSnapshotNameTemplate("{{.Cluster}}")
+		require.ErrorContains(t, err, "execute snapshot name template")
+		_, err = ParseSnapshotNameTemplate("")
+		require.EqualError(t, err, "snapshot name template gives an empty name")
+	})
+}
+
+func Test_ParseSnapshotLabels(t *testing.T) {
+	t.Parallel()
+
+	labels, err := ParseSnapshotLabels([]string{"team=storage", "retention=90d"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"team": "storage", "retention": "90d"}, labels)
+
+	_, err = ParseSnapshotLabels([]string{"created-by=me"})
+	require.EqualError(t, err, "snapshot label created-by is reserved")
+}
+
+func Test_SnapshotNameAndLabels(t *testing.T) {
+	t.Parallel()
+
+	n, err := ParseSnapshotNameTemplate("{{.Disk}}-{{.Date}}")
+	require.NoError(t, err)
+	var req *computepb.CreateSnapshotDiskRequest
+	dc := &disksClientMock{
+		CreateSnapshotFunc: func(_ context.Context, r *computepb.CreateSnapshotDiskRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+			req = r
+			// taken by an earlier run, to side-step op.Wait(ctx)
+			return nil, &googleapi.Error{Code: http.StatusConflict}
+		},
+		DeleteFunc: func(context.Context, *computepb.DeleteDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+			return nil, nil
+		},
+	}
+	disk := &computepb.Disk{Name: pointer.String("test-disk"), Labels: map[string]string{LabelMarkedForDeletion: "true"}}
+	di := &diskIteratorMock{
+		NextFunc: func() (*computepb.Disk, error) {
+			return disk, nil
+		},
+	}
+	bus := events.NewBus()
+	var snapshot *computepb.Snapshot
+	bus.Subscribe(func(e events.Event) { snapshot = e.Snapshot }, events.DiskDeleted)
+	c := NewCleaner(dc, bus)
+	c.wait = doneOperation
+	err = c.cleanupOne(context.Background(), di, CleanupOptions{
+		ProjectID:      "testing",
+		Zones:          []string{"testzone"},
+		DoSnapshot:     true,
+		SnapshotName:   n,
+		SnapshotLabels: map[string]string{"team": "storage"},
+		Snapshots:      existingSnapshots(disk, computepb.Snapshot_STANDARD),
+	})
+	require.NoError(t, err)
+	name := "test-disk-" + time.Now().UTC().Format("20060102")
+	require.Equal(t, name, req.GetSnapshotResource().GetName())
+	require.Equal(t, map[string]string{LabelMarkedForDeletion: "true", "team": "storage", LabelCreatedBy: CreatedBy}, req.GetSnapshotResource().GetLabels())
+	require.Equal(t, name, snapshot.GetName())
+}
@@ -0,0 +1,121 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// SnapshotPolicy decides how a Cleaner makes sure a disk can be restored
+// before deleting it.
+type SnapshotPolicy string
+
+const (
+	// SnapshotAlways snapshots every disk right before deleting it.
+	SnapshotAlways SnapshotPolicy = "always"
+	// SnapshotRequireRecent only deletes a disk if a snapshot of it was taken
+	// within CleanupOptions.RecentSnapshot, by any tool. Otherwise the disk is
+	// snapshotted and its deletion deferred with diskerr.ErrDeferred, so that
+	// a later run deletes it.
+	SnapshotRequireRecent SnapshotPolicy = "require-recent"
+)
+
+// ParseSnapshotPolicy validates s as a SnapshotPolicy.
+func ParseSnapshotPolicy(s string) (SnapshotPolicy, error) {
+	switch p := SnapshotPolicy(s); p {
+	case SnapshotAlways, SnapshotRequireRecent:
+		return p, nil
+	}
+	return "", xerrors.Errorf("unknown snapshot policy %q", s)
+}
+
+// listSnapshotsOf returns the snapshots taken of disk, whichever tool took
+// them, e.g. snapshot schedules, Backup for GKE or a Cleaner.
+func listSnapshotsOf(ctx context.Context, client SnapshotsClient, projectID string, disk *computepb.Disk) snapshotIterator {
+	return client.List(ctx, &computepb.ListSnapshotsRequest{
+		Project: projectID,
+		// the ID tells a disk apart from an earlier one of the same name
+		Filter: pointer.String(fmt.Sprintf("sourceDiskId = \"%d\"", disk.GetId())),
+	})
+}
+
+// listOwnSnapshotsOf returns the snapshots of disk taken by a Cleaner.
+func listOwnSnapshotsOf(ctx context.Context, client SnapshotsClient, projectID string, disk *computepb.Disk) snapshotIterator {
+	return client.List(ctx, &computepb.ListSnapshotsRequest{
+		Project: projectID,
+		Filter:  pointer.String(fmt.Sprintf("(sourceDiskId = \"%d\") AND (labels.%s = \"%s\")", disk.GetId(), LabelCreatedBy, CreatedBy)),
+	})
+}
+
+// recentSnapshot returns the most recent snapshot returned by si that is
+// ready and was created after since, or nil if there is none.
+func recentSnapshot(si snapshotIterator, since time.Time) (*computepb.Snapshot, error) {
+	var recent *computepb.Snapshot
+	var recentCreated time.Time
+	for {
+		snapshot, err := si.Next()
+		if err == iterator.Done {
+			return recent, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if snapshot.GetStatus() != computepb.Snapshot_READY.String() {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, snapshot.GetCreationTimestamp())
+		if err != nil || created.Before(since) {
+			continue
+		}
+		if recent == nil || created.After(recentCreated) {
+			recent, recentCreated = snapshot, created
+		}
+	}
+}
+
+// requireRecentSnapshot implements SnapshotRequireRecent: it returns the most
+// recent snapshot of disk in snapshots if there is one, and otherwise
+// snapshots the disk and returns diskerr.ErrDeferred.
+func (c *Cleaner) requireRecentSnapshot(ctx context.Context, disk *computepb.Disk, zone string, snapshots snapshotIterator, r retrier, opts CleanupOptions) (*computepb.Snapshot, error) {
+	logger := diskLogger(opts.ProjectID, zone, disk)
+	snapshot, err := recentSnapshot(snapshots, time.Now().Add(-opts.RecentSnapshot))
+	if err != nil {
+		return nil, diskerr.Wrap(diskerr.CodeAPI, err, "disk %s: failed to list snapshots", disk.GetName())
+	}
+	if snapshot != nil {
+		logger.Info().Str("snapshotName", snapshot.GetName()).Str("snapshotCreated", snapshot.GetCreationTimestamp()).Msg("found recent snapshot of disk")
+		return snapshot, nil
+	}
+	if opts.DryRun {
+		logger.Info().Int64("sizeGB", disk.GetSizeGb()).Msg("dry run - would snapshot disk and defer deletion to the next run")
+		return nil, diskerr.ErrDeferred
+	}
+	if _, err := c.snapshotDisk(ctx, disk, zone, r, opts); err != nil {
+		return nil, err
+	}
+	logger.Info().Msg("deferring deletion of disk to the next run")
+	return nil, diskerr.ErrDeferred
+}
+
+// reuseSnapshot returns the most recent snapshot of disk in snapshots taken
+// within opts.ReuseSnapshot, e.g. by an earlier run that failed to delete the
+// disk, and otherwise snapshots the disk.
+func (c *Cleaner) reuseSnapshot(ctx context.Context, disk *computepb.Disk, zone string, snapshots snapshotIterator, r retrier, opts CleanupOptions) (*computepb.Snapshot, error) {
+	snapshot, err := recentSnapshot(snapshots, time.Now().Add(-opts.ReuseSnapshot))
+	if err != nil {
+		return nil, diskerr.Wrap(diskerr.CodeAPI, err, "disk %s: failed to list snapshots", disk.GetName())
+	}
+	// a standard snapshot does not stand in for an archive one
+	if snapshot != nil && (opts.snapshotType() == "" || IsArchive(snapshot)) {
+		diskLogger(opts.ProjectID, zone, disk).Info().Str("snapshotName", snapshot.GetName()).Str("snapshotCreated", snapshot.GetCreationTimestamp()).Msg("reusing recent snapshot of disk taken by an earlier run")
+		return snapshot, nil
+	}
+	return c.snapshotDisk(ctx, disk, zone, r, opts)
+}
@@ -0,0 +1,208 @@
+package cleanup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_ParseSnapshotPolicy(t *testing.T) {
+	t.Parallel()
+
+	p, err := ParseSnapshotPolicy("require-recent")
+	require.NoError(t, err)
+	require.Equal(t, SnapshotRequireRecent, p)
+
+	_, err = ParseSnapshotPolicy("never")
+	require.EqualError(t, err, `unknown snapshot policy "never"`)
+}
+
+func Test_RequireRecentSnapshot(t *testing.T) {
+	t.Parallel()
+
+	iter := func(snapshots ...*computepb.Snapshot) snapshotIterator {
+		return &snapshotIteratorMock{
+			NextFunc: func() (*computepb.Snapshot, error) {
+				if len(snapshots) == 0 {
+					return nil, iterator.Done
+				}
+				s := snapshots[0]
+				snapshots = snapshots[1:]
+				return s, nil
+			},
+		}
+	}
+	snapshot := func(name string, age time.Duration, status computepb.Snapshot_Status) *computepb.Snapshot {
+		return &computepb.Snapshot{
+			Name:              pointer.String(name),
+			CreationTimestamp: pointer.String(time.Now().Add(-age).Format(time.RFC3339)),
+			Status:            pointer.String(status.String()),
+		}
+	}
+	disk := &computepb.Disk{
+		Name:   pointer.String("test-disk"),
+		Labels: map[string]string{LabelMarkedForDeletion: "true"},
+	}
+	opts := CleanupOptions{
+		ProjectID:      "testing",
+		Zones:          []string{"testzone"},
+		DoSnapshot:     true,
+		SnapshotPolicy: SnapshotRequireRecent,
+		RecentSnapshot: 7 * 24 * time.Hour,
+		Snapshots:      existingSnapshots(disk, computepb.Snapshot_STANDARD),
+	}
+	requireRecent := func(dc DisksClient, bus *events.Bus, si snapshotIterator, opts CleanupOptions) error {
+		c := NewCleaner(dc, bus)
+		_, err := c.requireRecentSnapshot(context.Background(), disk, "testzone", si, retrier{backoff: callBackoff, sleep: c.sleep}, opts)
+		return err
+	}
+
+	t.Run("most recent", func(t *testing.T) {
+		t.Parallel()
+		found, err := recentSnapshot(iter(
+			snapshot("scheduled", 48*time.Hour, computepb.Snapshot_READY),
+			snapshot("test-disk", 24*time.Hour, computepb.Snapshot_READY),
+			snapshot("pending", time.Hour, computepb.Snapshot_CREATING),
+			snapshot("stale", 30*24*time.Hour, computepb.Snapshot_READY),
+		), time.Now().Add(-opts.RecentSnapshot))
+		require.NoError(t, err)
+		require.Equal(t, "test-disk", found.GetName())
+	})
+
+	t.Run("list error", func(t *testing.T) {
+		t.Parallel()
+		si := &snapshotIteratorMock{
+			NextFunc: func() (*computepb.Snapshot, error) {
+				return nil, xerrors.New("google says no")
+			},
+		}
+		err := requireRecent(&disksClientMock{}, nil, si, opts)
+		require.EqualError(t, err, "disk test-disk: failed to list snapshots: google says no")
+		require.True(t, IsFailure(err))
+	})
+
+	t.Run("recent snapshot", func(t *testing.T) {
+		t.Parallel()
+		err := requireRecent(&disksClientMock{}, nil, iter(snapshot("scheduled", 24*time.Hour, computepb.Snapshot_READY)), opts)
+		require.NoError(t, err)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Parallel()
+		opts := opts
+		opts.DryRun = true
+		err := requireRecent(&disksClientMock{}, nil, iter(snapshot("stale", 30*24*time.Hour, computepb.Snapshot_READY)), opts)
+		require.ErrorIs(t, err, diskerr.ErrDeferred)
+	})
+
+	t.Run("snapshot and defer", func(t *testing.T) {
+		t.Parallel()
+		dc := &disksClientMock{
+			CreateSnapshotFunc: func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, "test-disk", createSnapshotDiskRequest.GetSnapshotResource().GetName())
+				// still being created by an earlier run
+				return nil, &googleapi.Error{Code: http.StatusConflict, Message: "already exists"}
+			},
+		}
+		err := requireRecent(dc, nil, iter(snapshot("test-disk", time.Hour, computepb.Snapshot_CREATING)), opts)
+		require.ErrorIs(t, err, diskerr.ErrDeferred)
+		require.False(t, IsFailure(err))
+		require.Len(t, dc.CreateSnapshotCalls(), 1)
+	})
+
+	t.Run("create snapshot error", func(t *testing.T) {
+		t.Parallel()
+		dc := &disksClientMock{
+			CreateSnapshotFunc: func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, xerrors.New("google says no")
+			},
+		}
+		err := requireRecent(dc, nil, iter(), opts)
+		require.Equal(t, diskerr.CodeAPI, diskerr.CodeOf(err))
+	})
+}
+
+func Test_ReuseSnapshot(t *testing.T) {
+	t.Parallel()
+
+	id := uint64(42)
+	disk := &computepb.Disk{
+		Id:     &id,
+		Name:   pointer.String("test-disk"),
+		Labels: map[string]string{LabelMarkedForDeletion: "true"},
+	}
+	opts := CleanupOptions{
+		ProjectID:     "testing",
+		Zones:         []string{"testzone"},
+		DoSnapshot:    true,
+		ReuseSnapshot: 24 * time.Hour,
+		Snapshots:     existingSnapshots(disk, computepb.Snapshot_STANDARD),
+	}
+	reuse := func(dc DisksClient, snapshots ...*computepb.Snapshot) (*computepb.Snapshot, error) {
+		si := &snapshotIteratorMock{
+			NextFunc: func() (*computepb.Snapshot, error) {
+				if len(snapshots) == 0 {
+					return nil, iterator.Done
+				}
+				s := snapshots[0]
+				snapshots = snapshots[1:]
+				return s, nil
+			},
+		}
+		c := NewCleaner(dc, nil)
+		return c.reuseSnapshot(context.Background(), disk, "testzone", si, retrier{backoff: callBackoff, sleep: c.sleep}, opts)
+	}
+	snapshot := func(age time.Duration) *computepb.Snapshot {
+		return &computepb.Snapshot{
+			Name:              pointer.String("test-disk"),
+			CreationTimestamp: pointer.String(time.Now().Add(-age).Format(time.RFC3339)),
+			Status:            pointer.String(computepb.Snapshot_READY.String()),
+		}
+	}
+
+	t.Run("own snapshots", func(t *testing.T) {
+		t.Parallel()
+		sc := &snapshotsClientMock{
+			ListFunc: func(contextMoqParam context.Context, listSnapshotsRequest *computepb.ListSnapshotsRequest, callOptions ...gax.CallOption) *computev1.SnapshotIterator {
+				return nil
+			},
+		}
+		listOwnSnapshotsOf(context.Background(), sc, opts.ProjectID, disk)
+		require.Len(t, sc.ListCalls(), 1)
+		require.Equal(t, `(sourceDiskId = "42") AND (labels.created-by = "gke-disk-cleanup")`, sc.ListCalls()[0].ListSnapshotsRequest.GetFilter())
+	})
+
+	t.Run("recent snapshot", func(t *testing.T) {
+		t.Parallel()
+		dc := &disksClientMock{}
+		found, err := reuse(dc, snapshot(time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, "test-disk", found.GetName())
+		require.Empty(t, dc.CreateSnapshotCalls())
+	})
+
+	t.Run("stale snapshot", func(t *testing.T) {
+		t.Parallel()
+		dc := &disksClientMock{
+			CreateSnapshotFunc: func(contextMoqParam context.Context, createSnapshotDiskRequest *computepb.CreateSnapshotDiskRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, &googleapi.Error{Code: http.StatusConflict, Message: "already exists"}
+			},
+		}
+		_, err := reuse(dc, snapshot(48*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, dc.CreateSnapshotCalls(), 1)
+	})
+}
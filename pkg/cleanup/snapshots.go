@@ -0,0 +1,152 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// SnapshotsClient is the subset of the compute snapshots API used by this
+// package. *computev1.SnapshotsClient implements it.
+type SnapshotsClient interface {
+	Delete(context.Context, *computepb.DeleteSnapshotRequest, ...gax.CallOption) (*computev1.Operation, error)
+	Get(context.Context, *computepb.GetSnapshotRequest, ...gax.CallOption) (*computepb.Snapshot, error)
+	List(context.Context, *computepb.ListSnapshotsRequest, ...gax.CallOption) *computev1.SnapshotIterator
+}
+
+type snapshotIterator interface {
+	Next() (*computepb.Snapshot, error)
+}
+
+//go:generate moq -fmt goimports -out mock_snapshots_client.go . SnapshotsClient:snapshotsClientMock
+//go:generate moq -fmt goimports -out mock_snapshot_iterator.go . snapshotIterator
+
+// PruneOptions configures a single PruneSnapshots call.
+type PruneOptions struct {
+	ProjectID string
+	// Tenant restricts pruning to the snapshots of one tenant's disks, which
+	// carry the labels of their disk.
+	Tenant Tenant
+	// Retention is how long snapshots are kept after they were created.
+	Retention time.Duration
+	DryRun    bool
+}
+
+// PruneStats counts the snapshots handled by a single PruneSnapshots call.
+type PruneStats struct {
+	Stats
+	Deleted int
+	// ReclaimedBytes is the storage used by the deleted snapshots, or that
+	// would have been deleted in dry run mode.
+	ReclaimedBytes int64
+}
+
+// Pruner deletes the snapshots a Cleaner created before deleting a disk once
+// they are older than a retention period.
+type Pruner struct {
+	client SnapshotsClient
+	bus    *events.Bus
+}
+
+// NewPruner returns a Pruner that publishes its events on bus. bus may be nil.
+func NewPruner(client SnapshotsClient, bus *events.Bus) *Pruner {
+	return &Pruner{client: client, bus: bus}
+}
+
+// PruneSnapshots deletes every snapshot created by this tool that is older
+// than opts.Retention. Per-snapshot failures are published as events and
+// counted in the returned stats; an error is only returned if listing
+// snapshots fails.
+func (p *Pruner) PruneSnapshots(ctx context.Context, opts PruneOptions) (PruneStats, error) {
+	var stats PruneStats
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no delete operations will be performed")
+	}
+	snapshotIter := p.client.List(ctx, &computepb.ListSnapshotsRequest{
+		Project: opts.ProjectID,
+		Filter:  pointer.String(opts.Tenant.filter(fmt.Sprintf("labels.%s:%s", LabelCreatedBy, CreatedBy))),
+	})
+	for {
+		snapshot, err := p.pruneOne(ctx, snapshotIter, opts)
+		if err == iterator.Done {
+			return stats, nil
+		}
+		if diskerr.CodeOf(err) == diskerr.CodeIterator {
+			return stats, err
+		}
+		stats.Scanned++
+		switch {
+		case err == nil:
+			stats.Deleted++
+			stats.ReclaimedBytes += snapshot.GetStorageBytes()
+		case errors.Is(err, diskerr.ErrDryRun):
+			stats.ReclaimedBytes += snapshot.GetStorageBytes()
+		case IsFailure(err):
+			stats.Failed++
+		}
+	}
+}
+
+func (p *Pruner) pruneOne(ctx context.Context, si snapshotIterator, opts PruneOptions) (*computepb.Snapshot, error) {
+	snapshot, err := si.Next()
+	if err == iterator.Done {
+		return nil, err
+	}
+	if err != nil {
+		return nil, diskerr.Wrap(diskerr.CodeIterator, err, "iterating snapshots")
+	}
+	err = p.pruneSnapshot(ctx, snapshot, opts)
+	if IsFailure(err) {
+		p.bus.Publish(events.Event{Type: events.Error, ProjectID: opts.ProjectID, Snapshot: snapshot, DryRun: opts.DryRun, Err: err})
+	}
+	return snapshot, err
+}
+
+func (p *Pruner) pruneSnapshot(ctx context.Context, snapshot *computepb.Snapshot, opts PruneOptions) error {
+	if err := opts.Tenant.check("snapshot "+snapshot.GetName(), snapshot.GetLabels()); err != nil {
+		return err
+	}
+	if IsArchive(snapshot) {
+		log.Debug().Str("projectID", opts.ProjectID).Str("snapshotName", snapshot.GetName()).Msg("keeping archive snapshot")
+		return diskerr.ErrArchived
+	}
+	created, err := time.Parse(time.RFC3339, snapshot.GetCreationTimestamp())
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeInvalidTimestamp, err, "snapshot %s: parse creation timestamp", snapshot.GetName())
+	}
+	if time.Since(created) < opts.Retention {
+		log.Debug().Str("projectID", opts.ProjectID).Str("snapshotName", snapshot.GetName()).Msg("keeping snapshot within retention")
+		return diskerr.ErrWithinRetention
+	}
+	if opts.DryRun {
+		log.Info().Str("projectID", opts.ProjectID).
+			Str("snapshotName", snapshot.GetName()).
+			Str("selfLink", snapshot.GetSelfLink()).
+			Int64("storageBytes", snapshot.GetStorageBytes()).
+			Str("created", snapshot.GetCreationTimestamp()).
+			Msg("dry run -- would delete snapshot")
+		return diskerr.ErrDryRun
+	}
+	req := &computepb.DeleteSnapshotRequest{
+		Project:   opts.ProjectID,
+		RequestId: pointer.String(resourceRequestID(snapshot.GetId(), snapshot.GetCreationTimestamp(), "delete")),
+		Snapshot:  snapshot.GetName(),
+	}
+	op, err := p.client.Delete(ctx, req)
+	if err != nil {
+		return diskerr.Wrap(diskerr.CodeAPI, err, "failed to delete snapshot %s", snapshot.GetName())
+	}
+	p.bus.Publish(events.Event{Type: events.SnapshotDeleted, ProjectID: opts.ProjectID, Snapshot: snapshot, Operation: operationName(op)})
+	return nil
+}
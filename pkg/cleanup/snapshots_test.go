@@ -0,0 +1,121 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_PruneSnapshots(t *testing.T) {
+	t.Parallel()
+
+	snapshot := func(age time.Duration) *computepb.Snapshot {
+		return &computepb.Snapshot{
+			Name:              pointer.String("test-disk"),
+			CreationTimestamp: pointer.String(time.Now().Add(-age).Format(time.RFC3339)),
+			StorageBytes:      pointer.Int64(1024),
+		}
+	}
+	iter := func(snapshots ...*computepb.Snapshot) snapshotIterator {
+		return &snapshotIteratorMock{
+			NextFunc: func() (*computepb.Snapshot, error) {
+				if len(snapshots) == 0 {
+					return nil, iterator.Done
+				}
+				s := snapshots[0]
+				snapshots = snapshots[1:]
+				return s, nil
+			},
+		}
+	}
+	pruneOne := func(sc SnapshotsClient, bus *events.Bus, si snapshotIterator, dryRun bool) error {
+		_, err := NewPruner(sc, bus).pruneOne(context.Background(), si, PruneOptions{
+			ProjectID: "testing",
+			Retention: 90 * 24 * time.Hour,
+			DryRun:    dryRun,
+		})
+		return err
+	}
+
+	t.Run("done", func(t *testing.T) {
+		t.Parallel()
+		err := pruneOne(&snapshotsClientMock{}, nil, iter(), false)
+		require.Equal(t, iterator.Done, err)
+	})
+
+	t.Run("within retention", func(t *testing.T) {
+		t.Parallel()
+		err := pruneOne(&snapshotsClientMock{}, nil, iter(snapshot(24*time.Hour)), false)
+		require.True(t, errors.Is(err, diskerr.ErrWithinRetention))
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		t.Parallel()
+		archived := snapshot(100 * 24 * time.Hour)
+		archived.SnapshotType = pointer.String(computepb.Snapshot_ARCHIVE.String())
+		err := pruneOne(&snapshotsClientMock{}, nil, iter(archived), false)
+		require.True(t, errors.Is(err, diskerr.ErrArchived))
+		require.False(t, IsFailure(err))
+	})
+
+	t.Run("invalid timestamp", func(t *testing.T) {
+		t.Parallel()
+		bus := events.NewBus()
+		seen := recordEvents(bus)
+		err := pruneOne(&snapshotsClientMock{}, bus, iter(&computepb.Snapshot{Name: pointer.String("test-disk")}), false)
+		require.Equal(t, diskerr.CodeInvalidTimestamp, diskerr.CodeOf(err))
+		require.Equal(t, []events.Type{events.Error}, *seen)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Parallel()
+		err := pruneOne(&snapshotsClientMock{}, nil, iter(snapshot(100*24*time.Hour)), true)
+		require.True(t, errors.Is(err, diskerr.ErrDryRun))
+	})
+
+	t.Run("delete error", func(t *testing.T) {
+		t.Parallel()
+		sc := &snapshotsClientMock{
+			DeleteFunc: func(ctx context.Context, req *computepb.DeleteSnapshotRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, xerrors.Errorf("test error")
+			},
+		}
+		err := pruneOne(sc, nil, iter(snapshot(100*24*time.Hour)), false)
+		require.EqualError(t, err, "failed to delete snapshot test-disk: test error")
+	})
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		sc := &snapshotsClientMock{
+			DeleteFunc: func(ctx context.Context, req *computepb.DeleteSnapshotRequest, callOptions ...gax.CallOption) (*computev1.Operation, error) {
+				require.Equal(t, "testing", req.Project)
+				require.Equal(t, "test-disk", req.Snapshot)
+				require.NotEmpty(t, req.GetRequestId())
+				return nil, nil
+			},
+		}
+		bus := events.NewBus()
+		seen := recordEvents(bus)
+		old := snapshot(100 * 24 * time.Hour)
+		err := pruneOne(sc, bus, iter(old), false)
+		require.NoError(t, err)
+		require.Len(t, sc.DeleteCalls(), 1)
+		require.Equal(t, []events.Type{events.SnapshotDeleted}, *seen)
+		// a snapshot deleted again, e.g. by a restarted run, is deleted with
+		// the same request ID, which the API deduplicates
+		require.NoError(t, pruneOne(sc, bus, iter(old), false))
+		require.Equal(t, sc.DeleteCalls()[0].DeleteSnapshotRequest.GetRequestId(), sc.DeleteCalls()[1].DeleteSnapshotRequest.GetRequestId())
+	})
+}
@@ -0,0 +1,67 @@
+package cleanup
+
+import (
+	"strings"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Source is what a disk was created from. Disks created from an image are
+// likely boot disks, while the disks of PersistentVolumes are blank.
+type Source string
+
+const (
+	SourceBlank    Source = "blank"
+	SourceImage    Source = "image"
+	SourceSnapshot Source = "snapshot"
+	// SourceDisk is a clone of another disk.
+	SourceDisk Source = "disk"
+)
+
+// Sources are all Source values.
+var Sources = []Source{SourceBlank, SourceImage, SourceSnapshot, SourceDisk}
+
+// DiskSource returns what disk was created from.
+func DiskSource(disk *computepb.Disk) Source {
+	switch {
+	case disk.GetSourceImage() != "":
+		return SourceImage
+	case disk.GetSourceSnapshot() != "":
+		return SourceSnapshot
+	case disk.GetSourceDisk() != "":
+		return SourceDisk
+	default:
+		return SourceBlank
+	}
+}
+
+// ParseSource validates s as a Source.
+func ParseSource(s string) (Source, error) {
+	for _, source := range Sources {
+		if Source(s) == source {
+			return source, nil
+		}
+	}
+	names := make([]string, len(Sources))
+	for i, source := range Sources {
+		names[i] = string(source)
+	}
+	return "", xerrors.Errorf("unknown creation source %q, expected one of %s", s, strings.Join(names, ", "))
+}
+
+// ParseSources validates every element of s as a Source.
+func ParseSources(s []string) ([]Source, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	sources := make([]Source, len(s))
+	for i, name := range s {
+		source, err := ParseSource(name)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = source
+	}
+	return sources, nil
+}
@@ -0,0 +1,33 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+)
+
+func Test_DiskSource(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, SourceBlank, DiskSource(&computepb.Disk{}))
+	require.Equal(t, SourceImage, DiskSource(&computepb.Disk{SourceImage: pointer.String("projects/debian-cloud/global/images/debian-11")}))
+	require.Equal(t, SourceSnapshot, DiskSource(&computepb.Disk{SourceSnapshot: pointer.String("projects/p/global/snapshots/s")}))
+	require.Equal(t, SourceDisk, DiskSource(&computepb.Disk{SourceDisk: pointer.String("projects/p/zones/z/disks/d")}))
+}
+
+func Test_ParseSources(t *testing.T) {
+	t.Parallel()
+
+	sources, err := ParseSources([]string{"image", "snapshot"})
+	require.NoError(t, err)
+	require.Equal(t, []Source{SourceImage, SourceSnapshot}, sources)
+
+	sources, err = ParseSources(nil)
+	require.NoError(t, err)
+	require.Nil(t, sources)
+
+	_, err = ParseSources([]string{"iso"})
+	require.EqualError(t, err, `unknown creation source "iso", expected one of blank, image, snapshot, disk`)
+}
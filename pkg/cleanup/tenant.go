@@ -0,0 +1,50 @@
+package cleanup
+
+import (
+	"fmt"
+	"strings"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// Tenant scopes listing and changing disks to one tenant of a shared project:
+// the disks carrying the label Label set to Value. The zero Tenant does not
+// scope anything.
+type Tenant struct {
+	Label string
+	Value string
+}
+
+// filter returns the list filter that restricts filter to the tenant's
+// resources.
+func (t Tenant) filter(filter string) string {
+	if t.Label == "" {
+		return filter
+	}
+	tenant := fmt.Sprintf(`(labels.%s = "%s")`, t.Label, t.Value)
+	switch {
+	case filter == "":
+		return tenant
+	case strings.HasPrefix(filter, "("):
+		return filter + " AND " + tenant
+	default:
+		return "(" + filter + ") AND " + tenant
+	}
+}
+
+// check returns a diskerr.CodeTenantMismatch error unless labels, those of
+// the disk or snapshot name, carry the tenant. It guards against changing
+// another tenant's resources if the list filter was not applied.
+func (t Tenant) check(name string, labels map[string]string) error {
+	if t.Label == "" {
+		return nil
+	}
+	value, found := labels[t.Label]
+	if !found {
+		return diskerr.New(diskerr.CodeTenantMismatch, "%s does not carry the tenant label %s", name, t.Label)
+	}
+	if value != t.Value {
+		return diskerr.New(diskerr.CodeTenantMismatch, "%s belongs to tenant %s=%s, not %s", name, t.Label, value, t.Value)
+	}
+	return nil
+}
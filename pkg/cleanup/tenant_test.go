@@ -0,0 +1,49 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func Test_TenantFilter(t *testing.T) {
+	t.Parallel()
+
+	tenant := Tenant{Label: "team", Value: "payments"}
+	tests := []struct {
+		name     string
+		tenant   Tenant
+		filter   string
+		expected string
+	}{
+		{name: "unscoped", filter: "labels.a:*", expected: "labels.a:*"},
+		{name: "empty", tenant: tenant, expected: `(labels.team = "payments")`},
+		{name: "single", tenant: tenant, filter: "labels.a:*", expected: `(labels.a:*) AND (labels.team = "payments")`},
+		{name: "parenthesized", tenant: tenant, filter: markedFilter, expected: markedFilter + ` AND (labels.team = "payments")`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expected, tt.tenant.filter(tt.filter))
+		})
+	}
+}
+
+func Test_TenantCheck(t *testing.T) {
+	t.Parallel()
+
+	tenant := Tenant{Label: "team", Value: "payments"}
+	require.NoError(t, Tenant{}.check("disk a", nil))
+	require.NoError(t, tenant.check("disk a", map[string]string{"team": "payments"}))
+
+	err := tenant.check("disk a", map[string]string{"team": "search"})
+	require.EqualError(t, err, "disk a belongs to tenant team=search, not payments")
+	require.Equal(t, diskerr.CodeTenantMismatch, diskerr.CodeOf(err))
+
+	err = tenant.check("snapshot a", nil)
+	require.EqualError(t, err, "snapshot a does not carry the tenant label team")
+	require.True(t, IsFailure(err))
+}
@@ -0,0 +1,180 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// UnmarkOptions configures a single UnmarkDisks call.
+type UnmarkOptions struct {
+	ProjectID string
+	// Zones to list disks in. Nil means all zones of the project.
+	Zones []string
+	// Filter is passed to the list disks request. Empty lists the disks that
+	// may be marked for deletion.
+	Filter string
+	// Selector selects among the listed disks those to process.
+	Selector Selector
+	// AllFields lists disks with all their fields, rather than only those
+	// read when processing them.
+	AllFields bool
+	// PageSize is how many disks are listed per page, 0 for MaxPageSize.
+	// Smaller pages are cheaper to retry when listing very large zones.
+	PageSize int
+	// Tenant restricts listing and changes to the disks of one tenant. A
+	// listed disk of another tenant fails with diskerr.CodeTenantMismatch.
+	Tenant Tenant
+	// Names restricts unmarking to the disks with these names. Nil unmarks
+	// every marked disk matching Filter.
+	Names []string
+	// Remove removes the deletion mark instead of setting it to "false". The
+	// next MarkDisks call may mark a disk without the label again, while one
+	// set to "false" is never marked again.
+	Remove bool
+	// Concurrency is how many disks are processed at a time. Defaults to 1.
+	Concurrency int
+	// MaxRetries is how often a call that changes a disk is retried after
+	// a transient error, such as being rate limited.
+	MaxRetries int
+	DryRun     bool
+}
+
+// UnmarkDisks cancels the pending deletion of every marked disk matching
+// opts. Disks that are not marked are skipped. Per-disk failures are
+// published as events and counted in the returned Stats; an error is only
+// returned if listing disks fails.
+func (m *Marker) UnmarkDisks(ctx context.Context, opts UnmarkOptions) (Stats, error) {
+	if opts.DryRun {
+		log.Info().Msg("dry run mode is enabled -- no write operations will be performed")
+	}
+	filter := opts.Filter
+	if filter == "" {
+		filter = markedFilter
+	}
+	diskIter, err := listDisks(ctx, m.client, opts.ProjectID, opts.Zones, opts.Tenant.filter(filter), nil, opts.AllFields, opts.PageSize)
+	if err != nil {
+		return Stats{}, err
+	}
+	return m.unmarkAll(ctx, selectDisks(diskIter, opts.Selector), opts)
+}
+
+// unmarkAll processes every disk returned by diskIter, or only the named
+// ones if opts.Names is set.
+func (m *Marker) unmarkAll(ctx context.Context, diskIter diskIterator, opts UnmarkOptions) (Stats, error) {
+	var named *namedDiskIterator
+	if opts.Names != nil {
+		named = newNamedDiskIterator(diskIter, opts.Names)
+		diskIter = named
+	}
+	stats, err := processDisks(ctx, diskIter, opts.Concurrency, nil, newCheckpoints(nil, opts.ProjectID, 0, nil), func(disk *computepb.Disk) error {
+		return m.processUnmark(ctx, disk, opts)
+	})
+	if named != nil && err == nil {
+		if missing := named.missing(); len(missing) > 0 {
+			log.Warn().Str("projectID", opts.ProjectID).Strs("diskNames", missing).Msg("disks to unmark not found")
+		}
+	}
+	return stats, err
+}
+
+// processUnmark unmarks disk and publishes the outcome.
+func (m *Marker) processUnmark(ctx context.Context, disk *computepb.Disk, opts UnmarkOptions) error {
+	zone := diskZone(disk, opts.Zones)
+	action, err := m.unmarkDisk(ctx, disk, zone, opts)
+	logger := diskLogger(opts.ProjectID, zone, disk)
+	switch {
+	case err == nil && action == ActionSkip:
+		logger.Debug().Msg("ignoring disk not marked for deletion")
+	case err == nil:
+	case errors.Is(err, diskerr.ErrDryRun):
+		logger.Info().Msg("dry run -- would unmark disk")
+	case IsFailure(err):
+		m.bus.Publish(events.Event{Type: events.Error, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, DryRun: opts.DryRun, Err: err})
+	}
+	m.bus.Publish(events.Event{Type: events.DiskProcessed, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Action: string(action), DryRun: opts.DryRun, Err: err})
+	return err
+}
+
+func (m *Marker) unmarkDisk(ctx context.Context, disk *computepb.Disk, zone string, opts UnmarkOptions) (Action, error) {
+	action := ActionUnmark
+	if _, marked := parseMark(disk.GetLabels()[LabelMarkedForDeletion]); !marked {
+		action = ActionSkip
+	}
+	err := checkRegional(disk)
+	if err == nil {
+		err = opts.Tenant.check("disk "+disk.GetName(), disk.GetLabels())
+	}
+	if err != nil {
+		action = ActionSkip
+	}
+	m.bus.Publish(events.Event{Type: events.DiskScanned, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Action: string(action), DryRun: opts.DryRun, Err: err})
+	if action == ActionSkip {
+		return action, err
+	}
+	labels := make(map[string]string, len(disk.GetLabels()))
+	for k, v := range disk.GetLabels() {
+		labels[k] = v
+	}
+	delete(labels, LabelSnapshotComplete)
+	if opts.Remove {
+		delete(labels, LabelMarkedForDeletion)
+	} else {
+		labels[LabelMarkedForDeletion] = "false"
+	}
+	if opts.DryRun {
+		return action, diskerr.ErrDryRun
+	}
+	operation, err := m.setLabels(ctx, disk, zone, labels, MarkOptions{ProjectID: opts.ProjectID, Zones: opts.Zones, MaxRetries: opts.MaxRetries})
+	if err != nil {
+		return action, err
+	}
+	m.bus.Publish(events.Event{Type: events.DiskUnmarked, ProjectID: opts.ProjectID, Zone: zone, Disk: disk, Operation: operation})
+	return action, nil
+}
+
+// namedDiskIterator returns only the disks with the given names, and
+// remembers which of them it found.
+type namedDiskIterator struct {
+	diskIterator
+	found map[string]bool
+}
+
+func newNamedDiskIterator(di diskIterator, names []string) *namedDiskIterator {
+	found := make(map[string]bool, len(names))
+	for _, name := range names {
+		found[name] = false
+	}
+	return &namedDiskIterator{diskIterator: di, found: found}
+}
+
+func (it *namedDiskIterator) Next() (*computepb.Disk, error) {
+	for {
+		disk, err := it.diskIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := it.found[disk.GetName()]; ok {
+			it.found[disk.GetName()] = true
+			return disk, nil
+		}
+	}
+}
+
+// missing returns the names of the disks that were not found, sorted.
+func (it *namedDiskIterator) missing() []string {
+	var names []string
+	for name, found := range it.found {
+		if !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,113 @@
+package cleanup
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_UnmarkDisks(t *testing.T) {
+	t.Parallel()
+
+	disks := func() diskIterator {
+		ids := []uint64{1, 2, 3}
+		all := []*computepb.Disk{
+			{Name: pointer.String("marked"), Id: &ids[0], Labels: map[string]string{LabelMarkedForDeletion: "2022-03-01", "team": "a"}},
+			{Name: pointer.String("marked-undated"), Id: &ids[1], Labels: map[string]string{LabelMarkedForDeletion: "true"}},
+			{Name: pointer.String("unmarked"), Id: &ids[2], Labels: map[string]string{LabelMarkedForDeletion: "false"}},
+		}
+		return &diskIteratorMock{
+			NextFunc: func() (*computepb.Disk, error) {
+				if len(all) == 0 {
+					return nil, iterator.Done
+				}
+				disk := all[0]
+				all = all[1:]
+				return disk, nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts UnmarkOptions
+		// expected are the labels set, by disk ID
+		expected map[string]map[string]string
+		unmarked int
+	}{
+		{
+			name: "flip all",
+			expected: map[string]map[string]string{
+				"1": {LabelMarkedForDeletion: "false", "team": "a"},
+				"2": {LabelMarkedForDeletion: "false"},
+			},
+			unmarked: 2,
+		},
+		{
+			name: "remove named",
+			opts: UnmarkOptions{Names: []string{"marked", "unmarked", "missing"}, Remove: true},
+			expected: map[string]map[string]string{
+				"1": {"team": "a"},
+			},
+			unmarked: 1,
+		},
+		{
+			name:     "dry run",
+			opts:     UnmarkOptions{DryRun: true},
+			expected: map[string]map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var mu sync.Mutex
+			labels := make(map[string]map[string]string)
+			dc := &disksClientMock{
+				SetLabelsFunc: func(_ context.Context, req *computepb.SetLabelsDiskRequest, _ ...gax.CallOption) (*computev1.Operation, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					labels[req.GetResource()] = req.GetZoneSetLabelsRequestResource().GetLabels()
+					return nil, nil
+				},
+			}
+			bus := events.NewBus()
+			var unmarked int
+			bus.Subscribe(func(events.Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				unmarked++
+			}, events.DiskUnmarked)
+			opts := tt.opts
+			opts.ProjectID = "testing"
+			opts.Zones = []string{"testzone"}
+
+			stats, err := NewMarker(dc, bus).unmarkAll(context.Background(), disks(), opts)
+			require.NoError(t, err)
+			require.Zero(t, stats.Failed)
+			require.Equal(t, tt.unmarked, unmarked)
+			require.Equal(t, tt.expected, labels)
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		dc := &disksClientMock{
+			SetLabelsFunc: func(context.Context, *computepb.SetLabelsDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, context.DeadlineExceeded
+			},
+		}
+		stats, err := NewMarker(dc, events.NewBus()).unmarkAll(context.Background(), disks(), UnmarkOptions{ProjectID: "testing", Zones: []string{"testzone"}, Names: []string{"marked"}})
+		require.NoError(t, err)
+		require.Equal(t, Stats{Scanned: 1, Failed: 1}, stats)
+	})
+}
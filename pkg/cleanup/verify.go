@@ -0,0 +1,95 @@
+package cleanup
+
+import (
+	"context"
+	"strconv"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// verifySnapshot returns the snapshot name, or an error with
+// diskerr.CodeSnapshotUnverified unless it is ready and was taken of disk, as
+// told by its size and source disk ID. A successful snapshot operation does
+// not guarantee either.
+func (c *Cleaner) verifySnapshot(ctx context.Context, disk *computepb.Disk, zone, name string, r retrier, opts CleanupOptions) (*computepb.Snapshot, error) {
+	logger := diskLogger(opts.ProjectID, zone, disk)
+	var snapshot *computepb.Snapshot
+	err := r.do(ctx, logger, "getSnapshot", func() (err error) {
+		snapshot, err = opts.Snapshots.Get(ctx, &computepb.GetSnapshotRequest{Project: opts.ProjectID, Snapshot: name})
+		return err
+	})
+	if err != nil {
+		return nil, diskerr.Wrap(diskerr.CodeSnapshotUnverified, err, "disk %s: failed to get snapshot %s to verify it", disk.GetName(), name)
+	}
+	if err := checkSnapshotOf(disk, snapshot); err != nil {
+		return nil, err
+	}
+	logger.Debug().Str("snapshotName", name).Msg("verified snapshot of disk")
+	return snapshot, nil
+}
+
+// describeSnapshot returns snapshot, of which only the name is known, as
+// got from the API. Without verification, failing to get it does not keep
+// the disk, so snapshot is returned as is then.
+func (c *Cleaner) describeSnapshot(ctx context.Context, disk *computepb.Disk, zone string, snapshot *computepb.Snapshot, r retrier, opts CleanupOptions) *computepb.Snapshot {
+	logger := diskLogger(opts.ProjectID, zone, disk)
+	var got *computepb.Snapshot
+	err := r.do(ctx, logger, "getSnapshot", func() (err error) {
+		got, err = opts.Snapshots.Get(ctx, &computepb.GetSnapshotRequest{Project: opts.ProjectID, Snapshot: snapshot.GetName()})
+		return err
+	})
+	if err != nil {
+		logger.Warn().Err(err).Str("snapshotName", snapshot.GetName()).Msg("unable to get snapshot of disk, only its name is recorded")
+		return snapshot
+	}
+	return got
+}
+
+// existingSnapshot returns the snapshot name, which already exists, if it is
+// a snapshot of disk, e.g. taken by an earlier run that was killed before
+// the disk was deleted. Otherwise it is of another disk of the same name,
+// e.g. in another zone, as snapshot names need not tell them apart, and an
+// error with diskerr.CodeSnapshotUnverified is returned.
+func (c *Cleaner) existingSnapshot(ctx context.Context, disk *computepb.Disk, zone, name string, r retrier, opts CleanupOptions) (*computepb.Snapshot, error) {
+	if opts.Snapshots == nil {
+		return nil, diskerr.New(diskerr.CodeSnapshotUnverified, "disk %s: snapshot %s already exists and no snapshots client was given to check it", disk.GetName(), name)
+	}
+	logger := diskLogger(opts.ProjectID, zone, disk)
+	var snapshot *computepb.Snapshot
+	err := r.do(ctx, logger, "getSnapshot", func() (err error) {
+		snapshot, err = opts.Snapshots.Get(ctx, &computepb.GetSnapshotRequest{Project: opts.ProjectID, Snapshot: name})
+		return err
+	})
+	if err != nil {
+		return nil, diskerr.Wrap(diskerr.CodeSnapshotUnverified, err, "disk %s: failed to get existing snapshot %s", disk.GetName(), name)
+	}
+	if err := checkSnapshotSource(disk, snapshot); err != nil {
+		return nil, err
+	}
+	if opts.snapshotType() != "" && !IsArchive(snapshot) {
+		return nil, diskerr.New(diskerr.CodeSnapshotUnverified, "disk %s: existing snapshot %s is not an archive snapshot", disk.GetName(), name)
+	}
+	return snapshot, nil
+}
+
+// checkSnapshotOf returns an error unless snapshot is ready and of disk.
+func checkSnapshotOf(disk *computepb.Disk, snapshot *computepb.Snapshot) error {
+	if status := snapshot.GetStatus(); status != computepb.Snapshot_READY.String() {
+		return diskerr.New(diskerr.CodeSnapshotUnverified, "disk %s: snapshot %s is %s, not %s", disk.GetName(), snapshot.GetName(), status, computepb.Snapshot_READY)
+	}
+	return checkSnapshotSource(disk, snapshot)
+}
+
+// checkSnapshotSource returns an error unless snapshot was taken of disk, as
+// told by its source disk ID and size.
+func checkSnapshotSource(disk *computepb.Disk, snapshot *computepb.Snapshot) error {
+	if diskID := strconv.FormatUint(disk.GetId(), 10); snapshot.GetSourceDiskId() != diskID {
+		return diskerr.New(diskerr.CodeSnapshotUnverified, "disk %s: snapshot %s is of disk ID %s, not %s", disk.GetName(), snapshot.GetName(), snapshot.GetSourceDiskId(), diskID)
+	}
+	if snapshot.GetDiskSizeGb() != disk.GetSizeGb() {
+		return diskerr.New(diskerr.CodeSnapshotUnverified, "disk %s: snapshot %s is of a %d GB disk, not %d GB", disk.GetName(), snapshot.GetName(), snapshot.GetDiskSizeGb(), disk.GetSizeGb())
+	}
+	return nil
+}
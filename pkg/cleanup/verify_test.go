@@ -0,0 +1,168 @@
+package cleanup
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/googleapis/gax-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_CheckSnapshotOf(t *testing.T) {
+	t.Parallel()
+
+	id := uint64(1234)
+	disk := &computepb.Disk{Name: pointer.String("test-disk"), Id: &id, SizeGb: pointer.Int64(100)}
+	snapshot := func(status computepb.Snapshot_Status, sourceDiskID string, sizeGB int64) *computepb.Snapshot {
+		return &computepb.Snapshot{
+			Name:         pointer.String("test-disk"),
+			Status:       pointer.String(status.String()),
+			SourceDiskId: pointer.String(sourceDiskID),
+			DiskSizeGb:   pointer.Int64(sizeGB),
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		snapshot *computepb.Snapshot
+		err      string
+	}{
+		{name: "verified", snapshot: snapshot(computepb.Snapshot_READY, "1234", 100)},
+		{name: "not ready", snapshot: snapshot(computepb.Snapshot_FAILED, "1234", 100), err: "disk test-disk: snapshot test-disk is FAILED, not READY"},
+		{name: "other disk", snapshot: snapshot(computepb.Snapshot_READY, "5678", 100), err: "disk test-disk: snapshot test-disk is of disk ID 5678, not 1234"},
+		{name: "other size", snapshot: snapshot(computepb.Snapshot_READY, "1234", 10), err: "disk test-disk: snapshot test-disk is of a 10 GB disk, not 100 GB"},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := checkSnapshotOf(disk, tt.snapshot)
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.err)
+			require.ErrorIs(t, err, diskerr.ErrSnapshotUnverified)
+			require.True(t, IsFailure(err))
+		})
+	}
+}
+
+func Test_CleanupVerifiesSnapshot(t *testing.T) {
+	t.Parallel()
+
+	id := uint64(1234)
+	di := &diskIteratorMock{
+		NextFunc: func() (*computepb.Disk, error) {
+			return &computepb.Disk{
+				Name:   pointer.String("test-disk"),
+				Id:     &id,
+				SizeGb: pointer.Int64(100),
+				Labels: map[string]string{LabelMarkedForDeletion: "true"},
+			}, nil
+		},
+	}
+	dc := &disksClientMock{
+		CreateSnapshotFunc: func(context.Context, *computepb.CreateSnapshotDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+			// taken by an earlier run, to side-step op.Wait(ctx)
+			return nil, &googleapi.Error{Code: http.StatusConflict}
+		},
+	}
+	sc := &snapshotsClientMock{
+		GetFunc: func(_ context.Context, req *computepb.GetSnapshotRequest, _ ...gax.CallOption) (*computepb.Snapshot, error) {
+			require.Equal(t, "testing", req.GetProject())
+			require.Equal(t, "test-disk", req.GetSnapshot())
+			return &computepb.Snapshot{
+				Name:         pointer.String("test-disk"),
+				Status:       pointer.String(computepb.Snapshot_CREATING.String()),
+				SourceDiskId: pointer.String("1234"),
+				DiskSizeGb:   pointer.Int64(100),
+			}, nil
+		},
+	}
+	bus := events.NewBus()
+	seen := recordEvents(bus)
+	err := NewCleaner(dc, bus).cleanupOne(context.Background(), di, CleanupOptions{
+		ProjectID:      "testing",
+		Zones:          []string{"testzone"},
+		DoSnapshot:     true,
+		VerifySnapshot: true,
+		Snapshots:      sc,
+	})
+	require.ErrorIs(t, err, diskerr.ErrSnapshotUnverified)
+	require.Empty(t, dc.DeleteCalls())
+	require.Equal(t, []events.Type{events.DiskScanned, events.Error, events.DiskProcessed}, *seen)
+}
+
+// existingSnapshots returns a snapshots client that gets a ready snapshot of
+// disk of snapshotType by any name, as taken by an earlier run.
+func existingSnapshots(disk *computepb.Disk, snapshotType computepb.Snapshot_SnapshotType) *snapshotsClientMock {
+	return &snapshotsClientMock{
+		GetFunc: func(_ context.Context, req *computepb.GetSnapshotRequest, _ ...gax.CallOption) (*computepb.Snapshot, error) {
+			return &computepb.Snapshot{
+				Name:         pointer.String(req.GetSnapshot()),
+				Status:       pointer.String(computepb.Snapshot_READY.String()),
+				SnapshotType: pointer.String(snapshotType.String()),
+				SourceDiskId: pointer.String(strconv.FormatUint(disk.GetId(), 10)),
+				DiskSizeGb:   pointer.Int64(disk.GetSizeGb()),
+			}, nil
+		},
+	}
+}
+
+func Test_ExistingSnapshot(t *testing.T) {
+	t.Parallel()
+
+	id := uint64(1234)
+	disk := &computepb.Disk{Name: pointer.String("test-disk"), Id: &id, SizeGb: pointer.Int64(100), Labels: map[string]string{LabelMarkedForDeletion: "true"}}
+	otherID := uint64(5678)
+	other := &computepb.Disk{Name: pointer.String("test-disk"), Id: &otherID, SizeGb: pointer.Int64(100)}
+	opts := CleanupOptions{ProjectID: "testing", Zones: []string{"testzone"}, DoSnapshot: true}
+	snapshotOne := func(t *testing.T, sc SnapshotsClient, opts CleanupOptions) (*computepb.Snapshot, error) {
+		dc := &disksClientMock{
+			CreateSnapshotFunc: func(context.Context, *computepb.CreateSnapshotDiskRequest, ...gax.CallOption) (*computev1.Operation, error) {
+				return nil, &googleapi.Error{Code: http.StatusConflict}
+			},
+		}
+		opts.Snapshots = sc
+		c := NewCleaner(dc, nil)
+		return c.snapshotDisk(context.Background(), disk, "testzone", retrier{backoff: callBackoff, sleep: c.sleep}, opts)
+	}
+
+	t.Run("of the disk", func(t *testing.T) {
+		t.Parallel()
+		snapshot, err := snapshotOne(t, existingSnapshots(disk, computepb.Snapshot_STANDARD), opts)
+		require.NoError(t, err)
+		require.Equal(t, "1234", snapshot.GetSourceDiskId())
+	})
+
+	t.Run("of another disk of the same name", func(t *testing.T) {
+		t.Parallel()
+		_, err := snapshotOne(t, existingSnapshots(other, computepb.Snapshot_STANDARD), opts)
+		require.EqualError(t, err, "disk test-disk: snapshot test-disk is of disk ID 5678, not 1234")
+		require.ErrorIs(t, err, diskerr.ErrSnapshotUnverified)
+	})
+
+	t.Run("standard for an archive", func(t *testing.T) {
+		t.Parallel()
+		opts := opts
+		opts.SnapshotType = SnapshotArchive
+		_, err := snapshotOne(t, existingSnapshots(disk, computepb.Snapshot_STANDARD), opts)
+		require.EqualError(t, err, "disk test-disk: existing snapshot test-disk is not an archive snapshot")
+	})
+
+	t.Run("without snapshots client", func(t *testing.T) {
+		t.Parallel()
+		_, err := snapshotOne(t, nil, opts)
+		require.ErrorIs(t, err, diskerr.ErrSnapshotUnverified)
+	})
+}
@@ -0,0 +1,61 @@
+package cleanup
+
+import "strings"
+
+// VolumeOwner identifies the Kubernetes PersistentVolume backed by a disk.
+type VolumeOwner struct {
+	PersistentVolume string
+	// Claim is the namespace/name of the bound claim, empty if unbound.
+	Claim string
+}
+
+// VolumeIndex records the disks that back a PersistentVolume. A Marker never
+// marks a disk found in the index. The zero value is not usable, use
+// NewVolumeIndex.
+type VolumeIndex struct {
+	// byName holds in-tree volumes, which only reference the disk name.
+	byName map[string]VolumeOwner
+	// byProject holds CSI volumes, keyed by project/name.
+	byProject map[string]VolumeOwner
+}
+
+// NewVolumeIndex returns an empty VolumeIndex.
+func NewVolumeIndex() *VolumeIndex {
+	return &VolumeIndex{
+		byName:    make(map[string]VolumeOwner),
+		byProject: make(map[string]VolumeOwner),
+	}
+}
+
+// Add records that the disk identified by diskID backs owner. diskID is
+// either the pdName of an in-tree gcePersistentDisk volume or the volume
+// handle of a PD CSI volume, e.g. projects/p/zones/z/disks/d.
+func (v *VolumeIndex) Add(diskID string, owner VolumeOwner) {
+	parts := strings.Split(diskID, "/")
+	if len(parts) == 6 && parts[0] == "projects" && parts[4] == "disks" {
+		v.byProject[parts[1]+"/"+parts[5]] = owner
+		return
+	}
+	v.byName[diskID] = owner
+}
+
+// Len returns the number of disks in the index.
+func (v *VolumeIndex) Len() int {
+	if v == nil {
+		return 0
+	}
+	return len(v.byName) + len(v.byProject)
+}
+
+// Lookup returns the owner of the disk diskName in projectID. It is safe to
+// call on a nil index.
+func (v *VolumeIndex) Lookup(projectID, diskName string) (VolumeOwner, bool) {
+	if v == nil {
+		return VolumeOwner{}, false
+	}
+	if owner, ok := v.byProject[projectID+"/"+diskName]; ok {
+		return owner, true
+	}
+	owner, ok := v.byName[diskName]
+	return owner, ok
+}
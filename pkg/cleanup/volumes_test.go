@@ -0,0 +1,46 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_VolumeIndex(t *testing.T) {
+	t.Parallel()
+
+	volumes := NewVolumeIndex()
+	volumes.Add("gke-pvc-in-tree", VolumeOwner{PersistentVolume: "pv-a", Claim: "default/a"})
+	volumes.Add("projects/project-a/zones/us-east1-b/disks/pvc-csi", VolumeOwner{PersistentVolume: "pv-b", Claim: "default/b"})
+	require.Equal(t, 2, volumes.Len())
+
+	tests := []struct {
+		name      string
+		projectID string
+		diskName  string
+		owner     VolumeOwner
+		found     bool
+	}{
+		{name: "in-tree in any project", projectID: "project-b", diskName: "gke-pvc-in-tree", owner: VolumeOwner{PersistentVolume: "pv-a", Claim: "default/a"}, found: true},
+		{name: "csi in same project", projectID: "project-a", diskName: "pvc-csi", owner: VolumeOwner{PersistentVolume: "pv-b", Claim: "default/b"}, found: true},
+		{name: "csi in other project", projectID: "project-b", diskName: "pvc-csi"},
+		{name: "unknown disk", projectID: "project-a", diskName: "other"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			owner, found := volumes.Lookup(tt.projectID, tt.diskName)
+			require.Equal(t, tt.found, found)
+			require.Equal(t, tt.owner, owner)
+		})
+	}
+
+	t.Run("nil index", func(t *testing.T) {
+		t.Parallel()
+		var nilIndex *VolumeIndex
+		_, found := nilIndex.Lookup("project-a", "pvc-csi")
+		require.False(t, found)
+		require.Zero(t, nilIndex.Len())
+	})
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// addressesConfig holds the flags of addresses and its subcommands.
+type addressesConfig struct {
+	marksFile   string
+	cutoffDays  int64
+	gracePeriod time.Duration
+}
+
+func newAddressesCommand(a *app) *cobra.Command {
+	var c addressesConfig
+	addressesCmd := &cobra.Command{
+		Use:   "addresses",
+		Short: "mark and release reserved static IP addresses that are not in use",
+	}
+	addressesMarkCmd := &cobra.Command{
+		Use:   "mark",
+		Short: "mark reserved addresses created more than --cutoff days ago that are not in use",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.forEachAddressProject(cmd, &c, func(cleaner *cleanup.AddressCleaner, opts cleanup.AddressOptions) (cleanup.ResourceStats, error) {
+				return cleaner.MarkAddresses(cmd.Context(), opts)
+			})
+		},
+	}
+	addressesMarkCmd.PersistentFlags().Int64Var(&c.cutoffDays, "cutoff", 30, "how many days ago the address must have been reserved")
+	addressesCleanupCmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "release marked addresses that are still not in use",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.forEachAddressProject(cmd, &c, func(cleaner *cleanup.AddressCleaner, opts cleanup.AddressOptions) (cleanup.ResourceStats, error) {
+				return cleaner.ReleaseAddresses(cmd.Context(), opts)
+			})
+		},
+	}
+	addressesCleanupCmd.PersistentFlags().DurationVar(&c.gracePeriod, "grace-period", 7*24*time.Hour, "only release addresses marked at least this long ago, counted from the end of the day of the mark; 0 to disable")
+	addressesCmd.PersistentFlags().StringVar(&c.marksFile, "address-marks-file", "address-marks.json", "file in the --store holding the marks of addresses, which cannot be labelled")
+	addressesCmd.AddCommand(addressesMarkCmd, addressesCleanupCmd)
+	return addressesCmd
+}
+
+// forEachAddressProject runs fn in every project with the marks of
+// --address-marks-file.
+func (a *app) forEachAddressProject(cmd *cobra.Command, c *addressesConfig, fn func(*cleanup.AddressCleaner, cleanup.AddressOptions) (cleanup.ResourceStats, error)) error {
+	if a.tenant.Label != "" {
+		return xerrors.Errorf("--tenant is not supported for addresses, which carry no labels")
+	}
+	projects, err := a.projects(cmd.Context())
+	if err != nil {
+		return err
+	}
+	return forEachResourceProject(cmd.Context(), a.stateStore, c.marksFile, "address", projects, a.cfg.dryRun, func(projectID string, marks cleanup.ResourceMarks) (cleanup.ResourceStats, error) {
+		client, err := computev1.NewAddressesRESTClient(cmd.Context(), a.projectOpts.of(projectID, a.opts.ClientOptions)...)
+		if err != nil {
+			return cleanup.ResourceStats{}, xerrors.Errorf("init addresses client: %w", err)
+		}
+		defer client.Close()
+		return fn(cleanup.NewAddressCleaner(client), cleanup.AddressOptions{
+			ProjectID:   projectID,
+			Cutoff:      24 * time.Hour * time.Duration(c.cutoffDays),
+			GracePeriod: c.gracePeriod,
+			Marks:       marks,
+			MaxRetries:  a.cfg.maxRetries,
+			DryRun:      a.cfg.dryRun,
+		})
+	})
+}
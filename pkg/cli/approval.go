@@ -0,0 +1,416 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// Decisions of an approval once --approval-timeout passed.
+const (
+	approvalDeny    = "deny"
+	approvalApprove = "approve"
+)
+
+const (
+	// slackAPI is the base URL of the Slack Web API.
+	slackAPI = "https://slack.com/api/"
+	// approvalPollInterval is how often the reactions to an approval
+	// request are checked.
+	approvalPollInterval = 15 * time.Second
+	// slackMaxSkew is how old a signed Slack request may be, to reject
+	// replays.
+	slackMaxSkew = 5 * time.Minute
+	// maxApprovalDisks is how many disks an approval request lists.
+	maxApprovalDisks = 50
+)
+
+// approvalReactions are the reactions approving or denying a request,
+// without skin tones.
+var approvalReactions = map[string]bool{
+	"+1":               true,
+	"thumbsup":         true,
+	"-1":               false,
+	"thumbsdown":       false,
+	"white_check_mark": true,
+}
+
+// approvalOptions configures newSlackApprover.
+type approvalOptions struct {
+	// Channel is the ID of the Slack channel the request is posted to.
+	Channel string
+	// TokenFile holds a Slack bot token allowed to post to Channel
+	// (chat:write) and read the reactions to its messages (reactions:read).
+	TokenFile string
+	// Listen is the address to receive the clicks on the approve and deny
+	// buttons on, as the request URL of the interactivity of the Slack app.
+	// Without it, the request is approved or denied with reactions only.
+	Listen string
+	// SigningSecretFile holds the signing secret of the Slack app, to
+	// verify the requests received on Listen.
+	SigningSecretFile string
+	// Users are the IDs of the Slack users allowed to decide; anyone in
+	// Channel if empty.
+	Users []string
+	// Timeout is how long to wait for a decision.
+	Timeout time.Duration
+	// OnTimeout is the decision once Timeout passed, approve or deny.
+	OnTimeout string
+}
+
+// slackApprover asks for approval of the deletions of a plan in a Slack
+// channel.
+type slackApprover struct {
+	opts          approvalOptions
+	token         string
+	signingSecret string
+	api           string
+	poll          time.Duration
+	client        *http.Client
+}
+
+// newSlackApprover returns a slackApprover configured by opts.
+func newSlackApprover(opts approvalOptions) (*slackApprover, error) {
+	if opts.OnTimeout != approvalDeny && opts.OnTimeout != approvalApprove {
+		return nil, xerrors.Errorf("unknown --approval-on-timeout %q, expected deny or approve", opts.OnTimeout)
+	}
+	if opts.Timeout <= 0 {
+		return nil, xerrors.Errorf("--approval-timeout must be positive")
+	}
+	token, err := readSecret(opts.TokenFile, "slack token")
+	if err != nil {
+		return nil, err
+	}
+	a := &slackApprover{
+		opts:   opts,
+		token:  token,
+		api:    slackAPI,
+		poll:   approvalPollInterval,
+		client: &http.Client{Timeout: runStatusTimeout},
+	}
+	if opts.Listen != "" {
+		if a.signingSecret, err = readSecret(opts.SigningSecretFile, "slack signing secret"); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// approvalDecision is the outcome of an approval request.
+type approvalDecision struct {
+	approved bool
+	// by is the ID of the Slack user who decided, or empty if the request
+	// timed out.
+	by string
+}
+
+func (d approvalDecision) verb() string {
+	if d.approved {
+		return "approved"
+	}
+	return "denied"
+}
+
+func (d approvalDecision) String() string {
+	if d.by == "" {
+		return d.verb() + " as no one decided in time"
+	}
+	return fmt.Sprintf("%s by <@%s>", d.verb(), d.by)
+}
+
+// approve posts the deletions of plan, read from planFile, to the channel
+// and waits for them to be approved. It returns an error unless they are,
+// or plan deletes no disk. It is a no-op if a is nil.
+func (a *slackApprover) approve(ctx context.Context, plan *cleanup.Plan, planFile string) error {
+	if a == nil {
+		return nil
+	}
+	var deletes []cleanup.PlannedDisk
+	for _, d := range plan.Disks {
+		if d.Deletes() {
+			deletes = append(deletes, d)
+		}
+	}
+	if len(deletes) == 0 {
+		log.Info().Str("plan", planFile).Msg("plan deletes no disks, not asking for approval")
+		return nil
+	}
+	var posted struct {
+		TS string `json:"ts"`
+	}
+	if err := a.call(ctx, "chat.postMessage", a.request(deletes, planFile, plan.Created), &posted); err != nil {
+		return xerrors.Errorf("post approval request: %w", err)
+	}
+	logger := log.With().Str("channel", a.opts.Channel).Str("ts", posted.TS).Logger()
+	logger.Info().Int("disks", len(deletes)).Dur("timeout", a.opts.Timeout).Msg("waiting for approval in slack")
+
+	clicked := make(chan approvalDecision, 1)
+	if a.opts.Listen != "" {
+		shutdown, err := listen(a.opts.Listen, a.callback(posted.TS, clicked))
+		if err != nil {
+			return err
+		}
+		defer shutdown()
+	}
+	decision, err := a.wait(ctx, posted.TS, clicked)
+	if err != nil {
+		return err
+	}
+	reply := map[string]string{"channel": a.opts.Channel, "thread_ts": posted.TS, "text": "Deletions " + decision.String() + "."}
+	if err := a.call(ctx, "chat.postMessage", reply, nil); err != nil {
+		logger.Warn().Err(err).Msg("unable to reply to approval request")
+	}
+	logger.Info().Bool("approved", decision.approved).Str("by", decision.by).Msg("approval request decided")
+	if !decision.approved {
+		return xerrors.Errorf("deletions of plan %s %s", planFile, decision)
+	}
+	return nil
+}
+
+// wait returns the decision on the request posted at ts, by reaction, a
+// click received on clicked or the timeout.
+func (a *slackApprover) wait(ctx context.Context, ts string, clicked <-chan approvalDecision) (approvalDecision, error) {
+	timeout := time.NewTimer(a.opts.Timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(a.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return approvalDecision{}, ctx.Err()
+		case <-timeout.C:
+			return approvalDecision{approved: a.opts.OnTimeout == approvalApprove}, nil
+		case decision := <-clicked:
+			return decision, nil
+		case <-ticker.C:
+			decision, ok, err := a.reactions(ctx, ts)
+			if err != nil {
+				// checked again at the next tick
+				log.Warn().Err(err).Msg("unable to get reactions to approval request")
+				continue
+			}
+			if ok {
+				return decision, nil
+			}
+		}
+	}
+}
+
+// request returns the message asking to approve the deletion of disks.
+func (a *slackApprover) request(disks []cleanup.PlannedDisk, planFile string, created time.Time) map[string]interface{} {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cleanup is about to delete %d disks of plan `%s`, made at %s:", len(disks), planFile, created.Format(time.RFC3339))
+	for i, d := range disks {
+		if i == maxApprovalDisks {
+			fmt.Fprintf(&b, "\n- and %d more", len(disks)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n- `%s` in %s/%s", d.Name, d.ProjectID, d.Zone)
+	}
+	how := "React with :+1: to approve or :-1: to deny"
+	if a.opts.Listen != "" {
+		how = "Approve or deny below, or react with :+1: or :-1:"
+	}
+	onTimeout := approvalDecision{approved: a.opts.OnTimeout == approvalApprove}
+	fmt.Fprintf(&b, "\n\n%s within %s. Without a decision, the deletions are %s.", how, a.opts.Timeout, onTimeout.verb())
+	text := b.String()
+	blocks := []interface{}{
+		map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}},
+	}
+	if a.opts.Listen != "" {
+		button := func(action, label, style string) map[string]interface{} {
+			return map[string]interface{}{
+				"type":      "button",
+				"action_id": action,
+				"value":     action,
+				"style":     style,
+				"text":      map[string]string{"type": "plain_text", "text": label},
+			}
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type":     "actions",
+			"elements": []interface{}{button(approvalApprove, "Approve", "primary"), button(approvalDeny, "Deny", "danger")},
+		})
+	}
+	return map[string]interface{}{"channel": a.opts.Channel, "text": text, "blocks": blocks}
+}
+
+// allowed reports whether user may decide.
+func (a *slackApprover) allowed(user string) bool {
+	if len(a.opts.Users) == 0 {
+		return true
+	}
+	for _, u := range a.opts.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
+
+// reactions returns the decision made with reactions to the message posted
+// at ts, if any. A denial wins over an approval.
+func (a *slackApprover) reactions(ctx context.Context, ts string) (approvalDecision, bool, error) {
+	var got struct {
+		Message struct {
+			Reactions []struct {
+				Name  string   `json:"name"`
+				Users []string `json:"users"`
+			} `json:"reactions"`
+		} `json:"message"`
+	}
+	params := url.Values{"channel": {a.opts.Channel}, "timestamp": {ts}, "full": {"true"}}
+	if err := a.call(ctx, "reactions.get", params, &got); err != nil {
+		return approvalDecision{}, false, err
+	}
+	var decision approvalDecision
+	found := false
+	for _, r := range got.Message.Reactions {
+		approved, ok := approvalReactions[strings.SplitN(r.Name, "::", 2)[0]]
+		if !ok || (found && !decision.approved) {
+			continue
+		}
+		for _, user := range r.Users {
+			if a.allowed(user) {
+				decision, found = approvalDecision{approved: approved, by: user}, true
+				break
+			}
+		}
+	}
+	return decision, found, nil
+}
+
+// callback returns the handler of the clicks on the buttons of the request
+// posted at ts, sending the decision to decided.
+func (a *slackApprover) callback(ts string, decided chan<- approvalDecision) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "read body", http.StatusBadRequest)
+			return
+		}
+		if err := verifySlackSignature(a.signingSecret, r.Header, body, time.Now()); err != nil {
+			log.Warn().Err(err).Str("remote", r.RemoteAddr).Msg("rejected slack request")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		var payload struct {
+			Type string `json:"type"`
+			User struct {
+				ID string `json:"id"`
+			} `json:"user"`
+			Container struct {
+				MessageTS string `json:"message_ts"`
+			} `json:"container"`
+			Actions []struct {
+				ActionID string `json:"action_id"`
+			} `json:"actions"`
+		}
+		if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		// clicks on other messages, e.g. of an earlier run, and by users
+		// not allowed to decide are ignored
+		if payload.Type != "block_actions" || payload.Container.MessageTS != ts || len(payload.Actions) == 0 || !a.allowed(payload.User.ID) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		decision := approvalDecision{approved: payload.Actions[0].ActionID == approvalApprove, by: payload.User.ID}
+		select {
+		case decided <- decision:
+		default:
+			// decided already
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// verifySlackSignature returns an error unless header signs body with
+// secret, as Slack signs its requests, within slackMaxSkew of now.
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	ts := header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return xerrors.Errorf("invalid slack request timestamp %q", ts)
+	}
+	if skew := now.Sub(time.Unix(sec, 0)); skew > slackMaxSkew || skew < -slackMaxSkew {
+		return xerrors.Errorf("slack request timestamp is %s off", skew.Round(time.Second))
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", ts)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return xerrors.Errorf("invalid slack request signature")
+	}
+	return nil
+}
+
+// call calls method of the Slack Web API with params, as a form if they are
+// url.Values and as JSON otherwise, and decodes the response into out, if
+// not nil.
+func (a *slackApprover) call(ctx context.Context, method string, params interface{}, out interface{}) error {
+	var body []byte
+	contentType := "application/json; charset=utf-8"
+	if form, ok := params.(url.Values); ok {
+		body, contentType = []byte(form.Encode()), "application/x-www-form-urlencoded"
+	} else {
+		var err error
+		if body, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.api+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("call slack %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("call slack %s: unexpected status %s", method, resp.Status)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return xerrors.Errorf("call slack %s: %w", method, err)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return xerrors.Errorf("call slack %s: %w", method, err)
+	}
+	if !status.OK {
+		return xerrors.Errorf("call slack %s: %s", method, status.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
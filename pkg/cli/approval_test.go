@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func Test_SlackApprover(t *testing.T) {
+	t.Parallel()
+
+	plan := cleanup.NewPlan(time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC))
+	plan.Disks = []cleanup.PlannedDisk{
+		{ProjectID: "p", Zone: "us-east1-b", Name: "pvc-a", Action: cleanup.ActionMark},
+		{ProjectID: "p", Zone: "us-east1-b", Name: "pvc-b", Action: cleanup.ActionSkip, Code: diskerr.CodeAlreadyMarked},
+	}
+
+	// slack fakes the Slack API, replying to reactions.get with reactions.
+	type slack struct {
+		mu       sync.Mutex
+		messages []map[string]interface{}
+	}
+	fake := func(t *testing.T, reactions string) (*slack, *slackApprover) {
+		s := &slack{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "Bearer xoxb-test", r.Header.Get("Authorization"))
+			switch r.URL.Path {
+			case "/chat.postMessage":
+				var msg map[string]interface{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+				s.mu.Lock()
+				s.messages = append(s.messages, msg)
+				s.mu.Unlock()
+				_, _ = w.Write([]byte(`{"ok": true, "ts": "1646136000.000100"}`))
+			case "/reactions.get":
+				require.NoError(t, r.ParseForm())
+				require.Equal(t, "1646136000.000100", r.PostForm.Get("timestamp"))
+				_, _ = w.Write([]byte(`{"ok": true, "message": {"reactions": ` + reactions + `}}`))
+			default:
+				_, _ = w.Write([]byte(`{"ok": false, "error": "unknown_method"}`))
+			}
+		}))
+		t.Cleanup(srv.Close)
+		return s, &slackApprover{
+			opts:   approvalOptions{Channel: "C1", Timeout: 200 * time.Millisecond, OnTimeout: approvalDeny},
+			token:  "xoxb-test",
+			api:    srv.URL + "/",
+			poll:   10 * time.Millisecond,
+			client: srv.Client(),
+		}
+	}
+
+	t.Run("approved", func(t *testing.T) {
+		t.Parallel()
+		s, a := fake(t, `[{"name": "+1::skin-tone-2", "users": ["U1"]}]`)
+		require.NoError(t, a.approve(context.Background(), plan, "plan.json"))
+		require.Len(t, s.messages, 2)
+		require.Equal(t, "C1", s.messages[0]["channel"])
+		require.Equal(t, "cleanup is about to delete 2 disks of plan `plan.json`, made at 2022-03-01T12:00:00Z:\n"+
+			"- `pvc-a` in p/us-east1-b\n"+
+			"- `pvc-b` in p/us-east1-b\n\n"+
+			"React with :+1: to approve or :-1: to deny within 200ms. Without a decision, the deletions are denied.", s.messages[0]["text"])
+		require.Len(t, s.messages[0]["blocks"], 1, "no buttons without a listener")
+		require.Equal(t, "1646136000.000100", s.messages[1]["thread_ts"])
+		require.Equal(t, "Deletions approved by <@U1>.", s.messages[1]["text"])
+	})
+
+	t.Run("denial wins", func(t *testing.T) {
+		t.Parallel()
+		_, a := fake(t, `[{"name": "+1", "users": ["U1"]}, {"name": "-1", "users": ["U2"]}]`)
+		require.EqualError(t, a.approve(context.Background(), plan, "plan.json"), "deletions of plan plan.json denied by <@U2>")
+	})
+
+	t.Run("users", func(t *testing.T) {
+		t.Parallel()
+		_, a := fake(t, `[{"name": "-1", "users": ["U2"]}, {"name": "thumbsup", "users": ["U2", "U3"]}]`)
+		a.opts.Users = []string{"U3"}
+		require.NoError(t, a.approve(context.Background(), plan, "plan.json"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+		s, a := fake(t, `[{"name": "eyes", "users": ["U1"]}]`)
+		require.EqualError(t, a.approve(context.Background(), plan, "plan.json"), "deletions of plan plan.json denied as no one decided in time")
+		require.Equal(t, "Deletions denied as no one decided in time.", s.messages[1]["text"])
+
+		_, a = fake(t, `[]`)
+		a.opts.OnTimeout = approvalApprove
+		require.NoError(t, a.approve(context.Background(), plan, "plan.json"))
+	})
+
+	t.Run("no deletions", func(t *testing.T) {
+		t.Parallel()
+		s, a := fake(t, `[]`)
+		empty := cleanup.NewPlan(time.Now())
+		empty.Disks = []cleanup.PlannedDisk{{Name: "kept", Action: cleanup.ActionSkip, Code: diskerr.CodeInUse}}
+		require.NoError(t, a.approve(context.Background(), empty, "plan.json"))
+		require.Empty(t, s.messages)
+	})
+
+	t.Run("post fails", func(t *testing.T) {
+		t.Parallel()
+		_, a := fake(t, `[]`)
+		a.api += "missing/"
+		require.EqualError(t, a.approve(context.Background(), plan, "plan.json"), "post approval request: call slack chat.postMessage: unknown_method")
+	})
+}
+
+func Test_SlackApproverCallback(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+	sign := func(body string, at time.Time) http.Header {
+		ts := strconv.FormatInt(at.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		_, _ = io.WriteString(mac, "v0:"+ts+":"+body)
+		return http.Header{
+			"X-Slack-Request-Timestamp": {ts},
+			"X-Slack-Signature":         {"v0=" + hex.EncodeToString(mac.Sum(nil))},
+		}
+	}
+	click := func(user, messageTS, action string) string {
+		payload := `{"type": "block_actions", "user": {"id": "` + user + `"}, "container": {"message_ts": "` + messageTS + `"}, "actions": [{"action_id": "` + action + `"}]}`
+		return url.Values{"payload": {payload}}.Encode()
+	}
+
+	t.Run("signature", func(t *testing.T) {
+		t.Parallel()
+		body := click("U1", "1.2", approvalApprove)
+		require.NoError(t, verifySlackSignature("secret", sign(body, now), []byte(body), now))
+		require.EqualError(t, verifySlackSignature("other", sign(body, now), []byte(body), now), "invalid slack request signature")
+		require.EqualError(t, verifySlackSignature("secret", sign(body, now), []byte(body+"&x=1"), now), "invalid slack request signature")
+		require.EqualError(t, verifySlackSignature("secret", sign(body, now.Add(-time.Hour)), []byte(body), now), "slack request timestamp is 1h0m0s off")
+		require.EqualError(t, verifySlackSignature("secret", http.Header{}, []byte(body), now), `invalid slack request timestamp ""`)
+	})
+
+	t.Run("clicks", func(t *testing.T) {
+		t.Parallel()
+		a := &slackApprover{opts: approvalOptions{Users: []string{"U1", "U2"}}, signingSecret: "secret"}
+		decided := make(chan approvalDecision, 1)
+		h := a.callback("1.2", decided)
+		post := func(body string, header http.Header) int {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header = header
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		body := click("U1", "1.2", approvalDeny)
+		require.Equal(t, http.StatusUnauthorized, post(body, sign(body+"x", now)))
+		for _, ignored := range []string{click("U3", "1.2", approvalApprove), click("U1", "0.1", approvalApprove)} {
+			require.Equal(t, http.StatusOK, post(ignored, sign(ignored, now)))
+		}
+		require.Empty(t, decided)
+		require.Equal(t, http.StatusOK, post(body, sign(body, now)))
+		require.Equal(t, approvalDecision{approved: false, by: "U1"}, <-decided)
+	})
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	logging "google.golang.org/api/logging/v2"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// auditAttachment is a disk attached to or detached from an instance, as
+// found in Cloud Audit Logs.
+type auditAttachment struct {
+	Time     time.Time
+	DiskName string
+}
+
+func (l *loggingAuditLog) ListDiskAttachments(ctx context.Context, projectID string, since, until time.Time) ([]auditAttachment, error) {
+	// disks are attached and detached by calls on the instance
+	filter := fmt.Sprintf(`logName="projects/%s/logs/cloudaudit.googleapis.com%%2Factivity" AND resource.type="gce_instance" AND protoPayload.methodName=~"compute\.instances\.(attachDisk|detachDisk)$" AND operation.first=true AND timestamp>="%s" AND timestamp<"%s"`,
+		projectID, since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	req := &logging.ListLogEntriesRequest{
+		ResourceNames: []string{"projects/" + projectID},
+		Filter:        filter,
+		PageSize:      1000,
+	}
+	var attachments []auditAttachment
+	err := l.svc.Entries.List(req).Pages(ctx, func(resp *logging.ListLogEntriesResponse) error {
+		for _, entry := range resp.Entries {
+			var payload struct {
+				Request struct {
+					// Source is the disk URL of an attachDisk call.
+					Source string `json:"source"`
+					// DeviceName is the device of a detachDisk call, which is
+					// the disk name unless chosen otherwise on attach.
+					DeviceName string `json:"deviceName"`
+				} `json:"request"`
+			}
+			if err := json.Unmarshal(entry.ProtoPayload, &payload); err != nil {
+				return xerrors.Errorf("parse audit log entry %s: %w", entry.InsertId, err)
+			}
+			diskName := payload.Request.DeviceName
+			if payload.Request.Source != "" {
+				diskName = path.Base(payload.Request.Source)
+			}
+			if diskName == "" {
+				continue
+			}
+			ts, _ := time.Parse(time.RFC3339Nano, entry.Timestamp)
+			attachments = append(attachments, auditAttachment{Time: ts, DiskName: diskName})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("list audit logs of %s: %w", projectID, err)
+	}
+	return attachments, nil
+}
+
+// loadAttachHistory returns when the disks of projectID were last attached or
+// detached within period before now according to the audit log.
+func loadAttachHistory(ctx context.Context, al auditLog, projectID string, period time.Duration) (*cleanup.AttachHistory, error) {
+	until := time.Now()
+	attachments, err := al.ListDiskAttachments(ctx, projectID, until.Add(-period), until)
+	if err != nil {
+		return nil, err
+	}
+	history := cleanup.NewAttachHistory()
+	for _, a := range attachments {
+		history.Add(projectID, a.DiskName, a.Time)
+	}
+	log.Info().Str("projectID", projectID).Int("events", len(attachments)).Int("disks", history.Len()).Msg("loaded attach history")
+	return history, nil
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadAttachHistory(t *testing.T) {
+	t.Parallel()
+
+	attached := time.Now().Add(-time.Hour).Truncate(time.Second)
+	al := &auditLogMock{
+		ListDiskAttachmentsFunc: func(ctx context.Context, projectID string, since, until time.Time) ([]auditAttachment, error) {
+			require.Equal(t, "testing", projectID)
+			require.Equal(t, 30*24*time.Hour, until.Sub(since))
+			return []auditAttachment{
+				{Time: attached.Add(-time.Hour), DiskName: "test-disk"},
+				{Time: attached, DiskName: "test-disk"},
+				{Time: attached, DiskName: "other-disk"},
+			}, nil
+		},
+	}
+	h, err := loadAttachHistory(context.Background(), al, "testing", 30*24*time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 2, h.Len())
+	last, ok := h.LastAttached("testing", "test-disk")
+	require.True(t, ok)
+	require.Equal(t, attached, last)
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+
+	"cloud.google.com/go/compute/metadata"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/audit"
+)
+
+// newAuditLogger returns the audit logger writing to the bucket and table
+// given, either of which may be empty, or nil if both are.
+func newAuditLogger(ctx context.Context, bucket, table string, base audit.Record, opts []option.ClientOption) (*audit.Logger, error) {
+	var sinks []audit.Sink
+	if bucket != "" {
+		sink, err := audit.NewGCS(ctx, bucket, opts...)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if table != "" {
+		sink, err := audit.NewBigQuery(ctx, table, opts...)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	if len(opts) == 0 {
+		base.Identity = googleIdentity(ctx)
+	}
+	return audit.NewLogger(ctx, base, sinks...), nil
+}
+
+// googleIdentity returns the email of the account the application default
+// credentials belong to: the service account of a key file, or that of the
+// instance or GKE workload this runs on. It is empty if unknown, e.g. for
+// user credentials.
+func googleIdentity(ctx context.Context) string {
+	creds, err := google.FindDefaultCredentials(ctx)
+	if err != nil {
+		return ""
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+	}
+	if len(creds.JSON) > 0 {
+		if json.Unmarshal(creds.JSON, &key) == nil {
+			return key.ClientEmail
+		}
+		return ""
+	}
+	if metadata.OnGCE() {
+		if email, err := metadata.Email(""); err == nil {
+			return email
+		}
+	}
+	return ""
+}
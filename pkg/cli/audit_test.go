@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/audit"
+)
+
+func Test_NewAuditLogger(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	opts := []option.ClientOption{option.WithoutAuthentication()}
+
+	l, err := newAuditLogger(ctx, "", "", audit.Record{Command: "mark"}, opts)
+	require.NoError(t, err)
+	require.Nil(t, l)
+
+	l, err = newAuditLogger(ctx, "audit-bucket/prefix", "audit-project.audit.disks", audit.Record{Command: "mark"}, opts)
+	require.NoError(t, err)
+	require.NotNil(t, l)
+
+	_, err = newAuditLogger(ctx, "audit-bucket", "audit.disks", audit.Record{Command: "mark"}, opts)
+	require.ErrorContains(t, err, `invalid audit table "audit.disks"`)
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/user"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/signing"
+)
+
+// newSigningKey returns the key to sign and verify kind records with, e.g.
+// certificate: HMAC with the key in hmacKeyFile, set by
+// --<kind>-hmac-key-file, or the Cloud KMS key version kmsKey, set by
+// --<kind>-kms-key. use is the flag that requires the key.
+func newSigningKey(ctx context.Context, kind, use, hmacKeyFile, kmsKey string, opts []option.ClientOption) (signing.Key, error) {
+	hmacFlag, kmsFlag := "--"+kind+"-hmac-key-file", "--"+kind+"-kms-key"
+	switch {
+	case hmacKeyFile != "" && kmsKey != "":
+		return nil, xerrors.Errorf("%s and %s are mutually exclusive", hmacFlag, kmsFlag)
+	case hmacKeyFile != "":
+		key, err := os.ReadFile(hmacKeyFile)
+		if err != nil {
+			return nil, xerrors.Errorf("read hmac key: %w", err)
+		}
+		return signing.NewHMAC(bytes.TrimSpace(key))
+	case kmsKey != "":
+		return signing.NewKMS(ctx, kmsKey, opts...)
+	default:
+		return nil, xerrors.Errorf("%s requires %s or %s", use, hmacFlag, kmsFlag)
+	}
+}
+
+// resolveOperator returns operator, or if empty the current user at this
+// host.
+func resolveOperator(operator string) string {
+	if operator != "" {
+		return operator
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	hostname, _ := os.Hostname()
+	return name + "@" + hostname
+}
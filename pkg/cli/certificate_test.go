@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/signing"
+)
+
+func Test_NewSigningKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("secret\n"), 0o600))
+
+	signer, err := newSigningKey(ctx, "certificate", "--deletion-certificates", keyFile, "", nil)
+	require.NoError(t, err)
+	want, err := signing.NewHMAC([]byte("secret"))
+	require.NoError(t, err)
+	require.Equal(t, want, signer)
+
+	_, err = newSigningKey(ctx, "certificate", "--deletion-certificates", keyFile, "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", nil)
+	require.EqualError(t, err, "--certificate-hmac-key-file and --certificate-kms-key are mutually exclusive")
+	_, err = newSigningKey(ctx, "certificate", "--deletion-certificates", "", "", nil)
+	require.EqualError(t, err, "--deletion-certificates requires --certificate-hmac-key-file or --certificate-kms-key")
+	_, err = newSigningKey(ctx, "plan", "--plan", "", "", nil)
+	require.EqualError(t, err, "--plan requires --plan-hmac-key-file or --plan-kms-key")
+}
+
+func Test_ResolveOperator(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "cleanup@testing.iam.gserviceaccount.com", resolveOperator("cleanup@testing.iam.gserviceaccount.com"))
+	require.Contains(t, resolveOperator(""), "@")
+}
@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newCheckCommand(a *app) *cobra.Command {
+	var doSnapshot bool
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "check that the permissions needed by mark and cleanup are granted in every project",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			projects, err := a.projects(cmd.Context())
+			if err != nil {
+				return err
+			}
+			rm, err := newProjectResourceManager(cmd.Context(), a.opts.ClientOptions, a.projectOpts)
+			if err != nil {
+				return err
+			}
+			return writePermissionCheck(cmd.Context(), cmd.OutOrStdout(), rm, projects, doSnapshot)
+		},
+	}
+	checkCmd.PersistentFlags().BoolVar(&doSnapshot, "do-snapshot", true, "check the permissions to snapshot disks before deleting them")
+	return checkCmd
+}
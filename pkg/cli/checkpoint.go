@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/checkpoint"
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// checkpointing resumes a run from a checkpoint file and records its progress
+// in it. The zero value does neither.
+type checkpointing struct {
+	file *checkpoint.File
+}
+
+// isCheckpointFile reports whether --resume-from names a checkpoint file
+// rather than a cursor of the form zone:token.
+func isCheckpointFile(resumeFrom string) bool {
+	return resumeFrom != "" && !strings.Contains(resumeFrom, ":")
+}
+
+// openCheckpoint opens the checkpoint file at path in s for command, if path
+// is set, and returns the projects that are still to be processed. The
+// checkpoint file may also be given as resumeFrom, which must then exist.
+func openCheckpoint(ctx context.Context, s store.Store, path, command, resumeFrom string, projects []string) (checkpointing, []string, error) {
+	if isCheckpointFile(resumeFrom) {
+		if path != "" && path != resumeFrom {
+			return checkpointing{}, nil, xerrors.Errorf("--resume-from names another checkpoint file than --checkpoint-file")
+		}
+		if _, err := s.Get(ctx, resumeFrom); err != nil {
+			return checkpointing{}, nil, xerrors.Errorf("--resume-from: read checkpoint file: %w", err)
+		}
+		path, resumeFrom = resumeFrom, ""
+	}
+	if path == "" {
+		return checkpointing{}, projects, nil
+	}
+	if resumeFrom != "" {
+		return checkpointing{}, nil, xerrors.Errorf("--resume-from and --checkpoint-file are mutually exclusive")
+	}
+	file, err := checkpoint.Open(ctx, s, path, command)
+	if err != nil {
+		return checkpointing{}, nil, err
+	}
+	pending := file.Pending(projects)
+	if len(pending) < len(projects) {
+		log.Info().Str("checkpointFile", path).Int("done", len(projects)-len(pending)).Int("pending", len(pending)).Msg("resuming from checkpoint")
+	}
+	return checkpointing{file: file}, pending, nil
+}
+
+// project returns where to start listing the disks of projectID, either
+// resume or the checkpoint, and the checkpointer to pass to the engine.
+func (c checkpointing) project(projectID string, resume *cleanup.Cursor) (*cleanup.Cursor, cleanup.Checkpointer, error) {
+	if c.file == nil {
+		return resume, nil, nil
+	}
+	resume, err := c.file.Resume(projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resume != nil {
+		log.Info().Str("projectID", projectID).Str("cursor", resume.String()).Int("processed", len(resume.Done)).Msg("resuming project from checkpoint")
+	}
+	return resume, c.file, nil
+}
+
+// complete records that projectID is done, unless processing it failed with
+// err.
+func (c checkpointing) complete(projectID string, err error) error {
+	if c.file == nil || err != nil {
+		return err
+	}
+	return c.file.Complete(projectID)
+}
+
+// finish removes the checkpoint file once every project is done, i.e. if err
+// is nil.
+func (c checkpointing) finish(err error) error {
+	if c.file == nil || err != nil {
+		return err
+	}
+	return c.file.Remove()
+}
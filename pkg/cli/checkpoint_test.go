@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_Checkpointing(t *testing.T) {
+	t.Parallel()
+
+	projects := []string{"project-a", "project-b"}
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		c, pending, err := openCheckpoint(context.Background(), store.Local{}, "", "mark", "", projects)
+		require.NoError(t, err)
+		require.Equal(t, projects, pending)
+		flagResume := &cleanup.Cursor{Zone: "us-east1-b", PageToken: "p2"}
+		resume, cp, err := c.project("project-a", flagResume)
+		require.NoError(t, err)
+		require.Equal(t, flagResume, resume)
+		require.Nil(t, cp)
+		require.NoError(t, c.complete("project-a", nil))
+		require.NoError(t, c.finish(nil))
+	})
+
+	t.Run("resume-from", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := openCheckpoint(context.Background(), store.Local{}, filepath.Join(t.TempDir(), "checkpoint.json"), "mark", "us-east1-b:p2", projects)
+		require.EqualError(t, err, "--resume-from and --checkpoint-file are mutually exclusive")
+	})
+
+	t.Run("resume-from checkpoint file", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		_, _, err := openCheckpoint(context.Background(), store.Local{}, "", "mark", path, projects)
+		require.ErrorIs(t, err, store.ErrNotExist)
+
+		c, _, err := openCheckpoint(context.Background(), store.Local{}, path, "mark", "", projects)
+		require.NoError(t, err)
+		require.NoError(t, c.complete("project-a", nil))
+
+		_, _, err = openCheckpoint(context.Background(), store.Local{}, filepath.Join(t.TempDir(), "other.json"), "mark", path, projects)
+		require.EqualError(t, err, "--resume-from names another checkpoint file than --checkpoint-file")
+		for _, checkpointFile := range []string{"", path} {
+			_, pending, err := openCheckpoint(context.Background(), store.Local{}, checkpointFile, "mark", path, projects)
+			require.NoError(t, err)
+			require.Equal(t, []string{"project-b"}, pending)
+		}
+		resume, err := resolveResume(path, projects)
+		require.NoError(t, err)
+		require.Nil(t, resume)
+	})
+
+	t.Run("killed and restarted", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "checkpoint.json")
+		c, pending, err := openCheckpoint(context.Background(), store.Local{}, path, "cleanup", "", projects)
+		require.NoError(t, err)
+		require.Equal(t, projects, pending)
+		require.NoError(t, c.complete("project-a", nil))
+		_, cp, err := c.project("project-b", nil)
+		require.NoError(t, err)
+		require.NoError(t, cp.Checkpoint("project-b", cleanup.Cursor{PageToken: "p3"}))
+
+		c, pending, err = openCheckpoint(context.Background(), store.Local{}, path, "cleanup", "", projects)
+		require.NoError(t, err)
+		require.Equal(t, []string{"project-b"}, pending)
+		resume, _, err := c.project("project-b", nil)
+		require.NoError(t, err)
+		require.Equal(t, &cleanup.Cursor{PageToken: "p3"}, resume)
+
+		// a failed project is not done
+		require.Error(t, c.complete("project-b", xerrors.New("boom")))
+		require.Error(t, c.finish(xerrors.New("boom")))
+		_, pending, err = openCheckpoint(context.Background(), store.Local{}, path, "cleanup", "", projects)
+		require.NoError(t, err)
+		require.Equal(t, []string{"project-b"}, pending)
+
+		require.NoError(t, c.complete("project-b", nil))
+		require.NoError(t, c.finish(nil))
+		_, pending, err = openCheckpoint(context.Background(), store.Local{}, path, "cleanup", "", projects)
+		require.NoError(t, err)
+		require.Equal(t, projects, pending)
+	})
+}
@@ -0,0 +1,300 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/archive"
+	"gke-disk-cleanup/pkg/certificate"
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// cleanupConfig holds the flags of the cleanup phase, shared by cleanup,
+// serve and soak.
+type cleanupConfig struct {
+	gracePeriod          time.Duration
+	doSnapshot           bool
+	exportTo             string
+	exportTimeout        time.Duration
+	mode                 string
+	snapshotPolicy       string
+	recentSnapshotDays   int64
+	snapshotNameTemplate string
+	snapshotLabels       []string
+	snapshotLocation     string
+	snapshotType         string
+	verifySnapshot       bool
+	reuseSnapshotWithin  time.Duration
+	maxDeletions         int
+	maxDeleteGB          int64
+	maxDeleteFraction    float64
+	deletionCertificates string
+	certificateHMACKey   string
+	certificateKMSKey    string
+	// plan, approval and phase are flags of cleanup only
+	plan     planConfig
+	approval approvalOptions
+	phase    string
+	// pacer spaces the deletions of soak
+	pacer cleanup.Pacer
+}
+
+// addFlags adds the flags of the cleanup phase to cmd.
+func (c *cleanupConfig) addFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().DurationVar(&c.gracePeriod, "grace-period", 7*24*time.Hour, "only delete disks marked at least this long ago, counted from the end of the day of the mark; 0 to disable")
+	cmd.PersistentFlags().BoolVar(&c.doSnapshot, "do-snapshot", true, "create a snapshot of the volume prior to deletion")
+	cmd.PersistentFlags().StringVar(&c.exportTo, "export-to", "", "before deleting each disk, export it as a gzipped tarball to this Cloud Storage location, e.g. gs://my-bucket/disks, with Cloud Build as gcloud compute images export does, and record the checksums of the object in the audit log; a disk whose export failed is not deleted")
+	cmd.PersistentFlags().DurationVar(&c.exportTimeout, "export-timeout", 2*time.Hour, "how long exporting a disk with --export-to may take")
+	cmd.PersistentFlags().StringVar(&c.mode, "mode", string(cleanup.ModeDelete), "delete (snapshot and delete each disk) or archive (take an archive snapshot of each disk, cheaper to keep but billed for at least 90 days, record it in the --archive-index and delete the disk, to thaw it later)")
+	cmd.PersistentFlags().StringVar(&c.snapshotPolicy, "snapshot-policy", string(cleanup.SnapshotAlways), "always (snapshot each disk before deleting it) or require-recent (only delete disks with a recent snapshot taken by any tool; snapshot the others and delete them in the next run)")
+	cmd.PersistentFlags().Int64Var(&c.recentSnapshotDays, "recent-snapshot-days", 7, "how many days old a snapshot may be to count as recent for --snapshot-policy=require-recent")
+	cmd.PersistentFlags().StringVar(&c.snapshotNameTemplate, "snapshot-name-template", cleanup.DefaultSnapshotNameTemplate, "Go template naming the snapshots taken, with the fields .Disk, .Zone, .ProjectID, .Date (YYYYMMDD) and .Hash (short hash of the disk), e.g. {{.Disk}}-{{.Date}}; names are lower-cased and truncated to 63 characters")
+	cmd.PersistentFlags().StringSliceVar(&c.snapshotLabels, "snapshot-labels", nil, "labels to set on the snapshots taken, in addition to those of the disk, as comma-separated key=value pairs")
+	cmd.PersistentFlags().StringVar(&c.snapshotLocation, "snapshot-storage-location", "", "region or multi-region to store the snapshots taken in, e.g. us or europe-west4 (default the region of the disk)")
+	cmd.PersistentFlags().StringVar(&c.snapshotType, "snapshot-type", "", "standard or archive (cheaper to keep, but billed for at least 90 days and slower to restore) snapshots (default standard, archive with --mode archive)")
+	cmd.PersistentFlags().BoolVar(&c.verifySnapshot, "verify-snapshot", true, "before deleting a disk, check that its snapshot is ready and of the same size and disk ID; otherwise the disk fails with SNAPSHOT_UNVERIFIED and is kept")
+	cmd.PersistentFlags().DurationVar(&c.reuseSnapshotWithin, "reuse-snapshot-within", 24*time.Hour, "with --snapshot-policy=always, delete a disk without snapshotting it again if this tool took a snapshot of it this recently, e.g. in a run that failed to delete it; 0 to always snapshot")
+	cmd.PersistentFlags().IntVar(&c.maxDeletions, "max-deletions", 0, "delete at most this many disks per cleanup run, across all projects; the run then stops deleting and exits with code 4; 0 for no limit")
+	cmd.PersistentFlags().Int64Var(&c.maxDeleteGB, "max-delete-gb", 0, "delete disks of at most this many GB in total per cleanup run, across all projects; the run then stops deleting and exits with code 4; 0 for no limit")
+	cmd.PersistentFlags().Float64Var(&c.maxDeleteFraction, "max-delete-fraction", 0, "fail the cleanup of a project before deleting any disk if more than this fraction of the disks listed by the --filter of mark in a zone are marked, e.g. 0.2, which more likely comes from a wrong filter or clock; 0 to disable")
+	cmd.PersistentFlags().StringVar(&c.deletionCertificates, "deletion-certificates", "", "write a signed deletion certificate for every deleted disk below this key prefix in the store, e.g. certificates")
+	cmd.PersistentFlags().StringVar(&c.certificateHMACKey, "certificate-hmac-key-file", "", "file holding the secret key to sign deletion certificates with HMAC-SHA256")
+	cmd.PersistentFlags().StringVar(&c.certificateKMSKey, "certificate-kms-key", "", "Cloud KMS asymmetric signing key version to sign deletion certificates with, e.g. projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1")
+}
+
+func newCleanupCommand(a *app) *cobra.Command {
+	var c cleanupConfig
+	cleanupCmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "cleanup disks in gcloud",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := a.openDeletionWriters(cmd.Context(), &c); err != nil {
+				return err
+			}
+			return a.runCleanup(cmd.Context(), &c, "", a.cfg.checkpointFile)
+		},
+	}
+	c.addFlags(cleanupCmd)
+	cleanupCmd.PersistentFlags().StringVar(&c.plan.file, "plan", "", "only delete the disks the reviewed plan written by mark --plan-out deletes, and only if they did not change since")
+	cleanupCmd.PersistentFlags().StringVar(&c.plan.hmacKeyFile, "plan-hmac-key-file", "", "file holding the secret key the --plan must be signed with by mark --plan-hmac-key-file")
+	cleanupCmd.PersistentFlags().StringVar(&c.plan.kmsKey, "plan-kms-key", "", "Cloud KMS key version the --plan must be signed with by mark --plan-kms-key; its public key is fetched to verify the signature")
+	cleanupCmd.PersistentFlags().StringVar(&c.approval.Channel, "approval-channel", "", "ID of a Slack channel to post the deletions of the --plan to, only deleting them once approved there")
+	cleanupCmd.PersistentFlags().StringVar(&c.approval.TokenFile, "approval-slack-token-file", "", "file holding the Slack bot token to post the approval request with, allowed chat:write and reactions:read")
+	cleanupCmd.PersistentFlags().StringVar(&c.approval.Listen, "approval-listen", "", "receive the clicks on the approve and deny buttons of the approval request on this address, the interactivity request URL of the Slack app; without it, only reactions decide")
+	cleanupCmd.PersistentFlags().StringVar(&c.approval.SigningSecretFile, "approval-signing-secret-file", "", "file holding the signing secret of the Slack app, to verify the clicks received on --approval-listen")
+	cleanupCmd.PersistentFlags().StringSliceVar(&c.approval.Users, "approval-users", nil, "IDs of the Slack users allowed to approve or deny; anyone in --approval-channel by default")
+	cleanupCmd.PersistentFlags().DurationVar(&c.approval.Timeout, "approval-timeout", time.Hour, "how long to wait for a decision on the approval request")
+	cleanupCmd.PersistentFlags().StringVar(&c.approval.OnTimeout, "approval-on-timeout", approvalDeny, "deny or approve the deletions once --approval-timeout passed without a decision")
+	cleanupCmd.PersistentFlags().StringVar(&c.phase, "phase", string(cleanup.PhaseAll), "all (snapshot and delete each disk), snapshot (only snapshot the disks and label them snapshot-complete) or delete (only delete the disks labelled snapshot-complete), to verify snapshots before deleting any disk")
+	return cleanupCmd
+}
+
+// openDeletionWriters subscribes the writers of the disks deleted by the
+// cleanup phase configured by c: the archive index of --mode archive and the
+// --deletion-certificates.
+func (a *app) openDeletionWriters(ctx context.Context, c *cleanupConfig) error {
+	if c.mode == string(cleanup.ModeArchive) {
+		a.archiveWriter = archive.Open(ctx, a.stateStore, a.cfg.archiveIndex)
+		a.bus.Subscribe(a.archiveWriter.Handle, events.DiskDeleted)
+	}
+	if c.deletionCertificates != "" {
+		signer, err := newSigningKey(ctx, "certificate", "--deletion-certificates", c.certificateHMACKey, c.certificateKMSKey, a.opts.ClientOptions)
+		if err != nil {
+			return err
+		}
+		a.certificateWriter = certificate.NewWriter(ctx, a.stateStore, c.deletionCertificates, signer, resolveOperator(a.cfg.operator))
+		a.bus.Subscribe(a.certificateWriter.Handle, events.DiskDeleted)
+	}
+	return nil
+}
+
+// runCleanup runs the cleanup phase across all projects, recording its
+// progress in checkpointPath if set. filter is the --filter of mark, which
+// --max-delete-fraction is a fraction of.
+func (a *app) runCleanup(ctx context.Context, c *cleanupConfig, filter, checkpointPath string) (err error) {
+	cfg := &a.cfg
+	var summarized *runSummary
+	defer func(start time.Time) {
+		if flushErr := a.flushRun("cleanup"); err == nil {
+			err = flushErr
+		}
+		a.observeRun("cleanup", start, err)
+		a.reportRun("cleanup", start, summarized, err)
+	}(time.Now())
+	release, err := a.acquireLock(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	targetZones, err := a.zones()
+	if err != nil {
+		return err
+	}
+	projects, err := a.projects(ctx)
+	if err != nil {
+		return err
+	}
+	if err := a.preflight(ctx, projects, "cleanup", c.doSnapshot, c.exportTo); err != nil {
+		return err
+	}
+	resume, err := resolveResume(cfg.resumeFrom, projects)
+	if err != nil {
+		return err
+	}
+	checkpoints, projects, err := openCheckpoint(ctx, a.stateStore, checkpointPath, "cleanup", cfg.resumeFrom, projects)
+	if err != nil {
+		return err
+	}
+	policy, err := cleanup.ParseSnapshotPolicy(c.snapshotPolicy)
+	if err != nil {
+		return err
+	}
+	phase, err := cleanup.ParsePhase(c.phase)
+	if err != nil {
+		return err
+	}
+	mode, err := cleanup.ParseMode(c.mode)
+	if err != nil {
+		return err
+	}
+	var plan *cleanup.Plan
+	if c.plan.file != "" {
+		verifier, err := newSigningKey(ctx, "plan", "--plan", c.plan.hmacKeyFile, c.plan.kmsKey, a.opts.ClientOptions)
+		if err != nil {
+			return err
+		}
+		if plan, err = readPlan(ctx, a.stateStore, c.plan.file, verifier); err != nil {
+			return err
+		}
+	}
+	snapshotNamer, err := cleanup.ParseSnapshotNameTemplate(c.snapshotNameTemplate)
+	if err != nil {
+		return err
+	}
+	labels, err := cleanup.ParseSnapshotLabels(c.snapshotLabels)
+	if err != nil {
+		return err
+	}
+	if phase != cleanup.PhaseAll && !c.doSnapshot {
+		return xerrors.Errorf("--phase %s requires --do-snapshot", phase)
+	}
+	if phase == cleanup.PhaseSnapshot && policy == cleanup.SnapshotRequireRecent {
+		return xerrors.Errorf("--phase %s does not support --snapshot-policy=%s", phase, policy)
+	}
+	if mode == cleanup.ModeArchive && (!c.doSnapshot || policy != cleanup.SnapshotAlways || phase != cleanup.PhaseAll) {
+		return xerrors.Errorf("--mode %s requires --do-snapshot, --snapshot-policy=%s and --phase %s", mode, cleanup.SnapshotAlways, cleanup.PhaseAll)
+	}
+	snapType, err := cleanup.ParseSnapshotType(c.snapshotType)
+	if err != nil {
+		return err
+	}
+	if mode == cleanup.ModeArchive && snapType == cleanup.SnapshotStandard {
+		return xerrors.Errorf("--mode %s takes %s snapshots, not --snapshot-type=%s", mode, cleanup.SnapshotArchive, snapType)
+	}
+	var exporter cleanup.Exporter
+	if c.exportTo != "" {
+		api, err := newProjectImageExport(ctx, a.opts.ClientOptions, a.projectOpts)
+		if err != nil {
+			return err
+		}
+		defer api.Close()
+		if exporter, err = newDiskExporter(api, c.exportTo, c.exportTimeout); err != nil {
+			return err
+		}
+	}
+	// a dry run or the snapshot phase deletes nothing to approve
+	if c.approval.Channel != "" && !cfg.dryRun && phase != cleanup.PhaseSnapshot {
+		if plan == nil {
+			return xerrors.Errorf("--approval-channel requires --plan, the deletions to approve")
+		}
+		approver, err := newSlackApprover(c.approval)
+		if err != nil {
+			return err
+		}
+		if err := approver.approve(ctx, plan, c.plan.file); err != nil {
+			return err
+		}
+	}
+	var snapshotsClient cleanup.SnapshotsClient
+	if c.doSnapshot {
+		client, closeClient, err := newProjectSnapshots(ctx, a.opts.ClientOptions, a.projectOpts)
+		if err != nil {
+			return err
+		}
+		defer closeClient()
+		snapshotsClient = client
+	}
+	if c.maxDeleteFraction < 0 || c.maxDeleteFraction > 1 {
+		return xerrors.Errorf("--max-delete-fraction must be between 0 and 1")
+	}
+	var budget *cleanup.DeletionBudget
+	if c.maxDeletions > 0 || c.maxDeleteGB > 0 {
+		budget = cleanup.NewDeletionBudget(c.maxDeletions, c.maxDeleteGB)
+	}
+	fallback := a.newFallback()
+	endProgress := a.beginProgress(ctx, "cleanup", projects, targetZones)
+	summary := a.startSummary(ctx, "cleanup")
+	cleaner := cleanup.NewCleaner(a.disksClient, a.bus)
+	err = forEachProject(projects, func(projectID string) (cleanup.Stats, error) {
+		resume, checkpointer, err := checkpoints.project(projectID, resume)
+		if err != nil {
+			return cleanup.Stats{}, err
+		}
+		stats, err := cleaner.CleanupDisks(ctx, cleanup.CleanupOptions{
+			ProjectID:               projectID,
+			Zones:                   targetZones,
+			ExemptLabel:             cfg.exemptLabel,
+			IncludeBootDisks:        cfg.includeBootDisks,
+			IncludeManaged:          !cfg.skipManaged,
+			Tenant:                  a.tenant,
+			Plan:                    plan,
+			Selector:                a.selector,
+			AllFields:               cfg.allDiskFields,
+			PageSize:                cfg.pageSize,
+			GracePeriod:             c.gracePeriod,
+			DoSnapshot:              c.doSnapshot,
+			Mode:                    mode,
+			Exporter:                exporter,
+			SnapshotPolicy:          policy,
+			RecentSnapshot:          24 * time.Hour * time.Duration(c.recentSnapshotDays),
+			ReuseSnapshot:           c.reuseSnapshotWithin,
+			SnapshotName:            snapshotNamer,
+			SnapshotLabels:          labels,
+			SnapshotStorageLocation: c.snapshotLocation,
+			SnapshotType:            snapType,
+			VerifySnapshot:          c.doSnapshot && c.verifySnapshot,
+			Snapshots:               snapshotsClient,
+			Phase:                   phase,
+			Resume:                  resume,
+			Checkpoint:              checkpointer,
+			CheckpointEvery:         cfg.checkpointEvery,
+			Pacer:                   c.pacer,
+			Budget:                  budget,
+			MaxMarkedFraction:       c.maxDeleteFraction,
+			Filter:                  filter,
+			Concurrency:             cfg.concurrency,
+			MaxRetries:              cfg.maxRetries,
+			Throttle:                a.control,
+			Fallback:                fallback,
+			DryRun:                  cfg.dryRun,
+		})
+		return stats, checkpoints.complete(projectID, err)
+	})
+	endProgress(err)
+	summary.log(cfg.dryRun, fallback)
+	summarized = summary
+	if err := checkpoints.finish(err); err != nil {
+		return err
+	}
+	if err := fallbackError(fallback); err != nil {
+		return err
+	}
+	if err := summary.failuresError(cfg.maxFailures); err != nil {
+		return err
+	}
+	return budgetError(budget)
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	container "google.golang.org/api/container/v1"
+	"google.golang.org/api/option"
+)
+
+// clusterLister is an interface for the GKE API queries we use here.
+type clusterLister interface {
+	// ClusterNames returns the names of the clusters of projectID in all
+	// locations.
+	ClusterNames(ctx context.Context, projectID string) ([]string, error)
+}
+
+//go:generate moq -fmt goimports -out mock_cluster_lister.go . clusterLister
+
+// containerClusters implements clusterLister using the GKE v1 API.
+type containerClusters struct {
+	svc *container.Service
+}
+
+func newClusterLister(ctx context.Context, opts ...option.ClientOption) (*containerClusters, error) {
+	svc, err := container.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init container client: %w", err)
+	}
+	return &containerClusters{svc: svc}, nil
+}
+
+func (c *containerClusters) ClusterNames(ctx context.Context, projectID string) ([]string, error) {
+	resp, err := c.svc.Projects.Locations.Clusters.List("projects/" + projectID + "/locations/-").Context(ctx).Do()
+	if err != nil {
+		return nil, xerrors.Errorf("list clusters of %s: %w", projectID, err)
+	}
+	// a cluster in a missing zone would look deleted
+	if len(resp.MissingZones) > 0 {
+		return nil, xerrors.Errorf("list clusters of %s: zones %s unavailable", projectID, strings.Join(resp.MissingZones, ", "))
+	}
+	names := make([]string, 0, len(resp.Clusters))
+	for _, cluster := range resp.Clusters {
+		names = append(names, cluster.Name)
+	}
+	return names, nil
+}
+
+// existingClusters returns the names of the clusters in any of projects. All
+// of them are needed to tell the resources of a deleted cluster, as those of
+// a cluster in a Shared VPC service project live in the host project.
+func existingClusters(ctx context.Context, l clusterLister, projects []string) (map[string]bool, error) {
+	clusters := make(map[string]bool)
+	for _, projectID := range projects {
+		names, err := l.ClusterNames(ctx, projectID)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			clusters[name] = true
+		}
+	}
+	log.Info().Int("projects", len(projects)).Int("clusters", len(clusters)).Msg("found clusters")
+	return clusters, nil
+}
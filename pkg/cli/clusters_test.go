@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func Test_existingClusters(t *testing.T) {
+	t.Parallel()
+
+	l := &clusterListerMock{
+		ClusterNamesFunc: func(_ context.Context, projectID string) ([]string, error) {
+			switch projectID {
+			case "host":
+				return nil, nil
+			case "service":
+				return []string{"prod", "dev"}, nil
+			}
+			return nil, xerrors.Errorf("list clusters of %s: permission denied", projectID)
+		},
+	}
+	clusters, err := existingClusters(context.Background(), l, []string{"host", "service"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"prod": true, "dev": true}, clusters)
+
+	// a project that cannot be listed may hold clusters
+	_, err = existingClusters(context.Background(), l, []string{"host", "other"})
+	require.EqualError(t, err, "list clusters of other: permission denied")
+}
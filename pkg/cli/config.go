@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of the environment variables that set flags, e.g.
+// GKE_DISK_CLEANUP_PROJECT_ID for --project-id.
+const envPrefix = "GKE_DISK_CLEANUP_"
+
+// applyEnv sets every flag of cmd that was not given on the command line to
+// the value of its environment variable in environ, if set. Variables that
+// are not a flag of cmd are ignored, as they may be meant for other commands.
+func applyEnv(cmd *cobra.Command, environ []string) error {
+	for _, kv := range environ {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 || !strings.HasPrefix(kv, envPrefix) {
+			continue
+		}
+		name, value := kv[:i], kv[i+1:]
+		key := strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(name, envPrefix)), "_", "-")
+		flag := cmd.Flags().Lookup(key)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(key, value); err != nil {
+			return xerrors.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// applyConfig sets every flag of cmd that was not given on the command line
+// to its value in the YAML or JSON config file at path. The file maps flag
+// names to values, e.g. "project-id: my-project" or "zones: [a, b]". Keys
+// that are not a flag of any command are rejected to catch typos.
+func applyConfig(cmd *cobra.Command, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return xerrors.Errorf("read config: %w", err)
+	}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return xerrors.Errorf("parse config %s: %w", path, err)
+	}
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == projectsKey {
+			// not a flag, see loadProjectTargets
+			continue
+		}
+		if !isFlag(cmd.Root(), key) {
+			return xerrors.Errorf("config %s: unknown flag %q", path, key)
+		}
+		flag := cmd.Flags().Lookup(key)
+		if flag == nil || flag.Changed {
+			// a flag of another command, or set on the command line
+			continue
+		}
+		value, err := configValue(config[key])
+		if err != nil {
+			return xerrors.Errorf("config %s: %s: %w", path, key, err)
+		}
+		if err := cmd.Flags().Set(key, value); err != nil {
+			return xerrors.Errorf("config %s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// projectsKey is the key of the config file listing the target projects,
+// with the credentials of each, see loadProjectTargets.
+const projectsKey = "projects"
+
+// projectTarget is a project listed in the config file, with the credentials
+// to reach it if they differ from --credentials-file and
+// --impersonate-service-account, e.g. for a service project of a Shared VPC.
+type projectTarget struct {
+	ID string
+	// CredentialsFile replaces --credentials-file for the project.
+	CredentialsFile string
+	// ImpersonateServiceAccount is impersonated for the project, with
+	// CredentialsFile or else --credentials-file.
+	ImpersonateServiceAccount string
+}
+
+// UnmarshalYAML decodes a project ID, or a map of id, credentials-file and
+// impersonate-service-account.
+func (t *projectTarget) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&t.ID)
+	}
+	var fields map[string]string
+	if err := node.Decode(&fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		switch key {
+		case "id":
+			t.ID = value
+		case "credentials-file":
+			t.CredentialsFile = value
+		case "impersonate-service-account":
+			t.ImpersonateServiceAccount = value
+		default:
+			return xerrors.Errorf("unknown key %q, expected id, credentials-file or impersonate-service-account", key)
+		}
+	}
+	return nil
+}
+
+// hasCredentials reports whether t overrides the default credentials.
+func (t projectTarget) hasCredentials() bool {
+	return t.CredentialsFile != "" || t.ImpersonateServiceAccount != ""
+}
+
+// loadProjectTargets returns the projects listed under projectsKey in the
+// YAML or JSON config file at path, e.g.
+//
+//	projects:
+//	- service-a
+//	- id: service-b
+//	  impersonate-service-account: cleanup@service-b.iam.gserviceaccount.com
+func loadProjectTargets(path string) ([]projectTarget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read config: %w", err)
+	}
+	var config struct {
+		Projects []projectTarget `yaml:"projects"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, xerrors.Errorf("parse config %s: %s: %w", path, projectsKey, err)
+	}
+	seen := make(map[string]bool, len(config.Projects))
+	for i, t := range config.Projects {
+		if t.ID == "" {
+			return nil, xerrors.Errorf("config %s: %s[%d]: id is required", path, projectsKey, i)
+		}
+		if seen[t.ID] {
+			return nil, xerrors.Errorf("config %s: %s: project %s is listed twice", path, projectsKey, t.ID)
+		}
+		seen[t.ID] = true
+	}
+	return config.Projects, nil
+}
+
+// configValue returns v, as parsed from YAML, in the form a flag accepts.
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		return "", xerrors.Errorf("expected a value or a list")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// isFlag reports whether name is a flag of cmd or any of its subcommands.
+func isFlag(cmd *cobra.Command, name string) bool {
+	if cmd.Flags().Lookup(name) != nil || cmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+	for _, sub := range cmd.Commands() {
+		if isFlag(sub, name) {
+			return true
+		}
+	}
+	return false
+}
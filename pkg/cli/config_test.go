@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ApplyConfig(t *testing.T) {
+	t.Parallel()
+
+	var (
+		projectID string
+		zones     []string
+		dryRun    bool
+		cutoff    int64
+		retention int64
+	)
+	newCommand := func() (*cobra.Command, *cobra.Command) {
+		root := &cobra.Command{Use: "root"}
+		root.PersistentFlags().StringVar(&projectID, "project-id", "default", "")
+		root.PersistentFlags().StringSliceVar(&zones, "zones", nil, "")
+		root.PersistentFlags().BoolVar(&dryRun, "dry-run", true, "")
+		mark := &cobra.Command{Use: "mark", Run: func(*cobra.Command, []string) {}}
+		mark.PersistentFlags().Int64Var(&cutoff, "cutoff", 30, "")
+		prune := &cobra.Command{Use: "prune", Run: func(*cobra.Command, []string) {}}
+		prune.PersistentFlags().Int64Var(&retention, "snapshot-retention-days", 90, "")
+		root.AddCommand(mark, prune)
+		return root, mark
+	}
+	writeConfig := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "cleanup.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("flags over file", func(t *testing.T) {
+		root, mark := newCommand()
+		path := writeConfig(t, `
+project-id: from-file
+zones: [us-east1-b, us-east1-c]
+dry-run: false
+cutoff: 45
+snapshot-retention-days: 10
+`)
+		require.NoError(t, root.ParseFlags(nil))
+		require.NoError(t, mark.ParseFlags([]string{"--project-id", "from-flag"}))
+		require.NoError(t, applyConfig(mark, path))
+		require.Equal(t, "from-flag", projectID)
+		require.Equal(t, []string{"us-east1-b", "us-east1-c"}, zones)
+		require.False(t, dryRun)
+		require.Equal(t, int64(45), cutoff)
+		// a flag of another command is accepted but not applied
+		require.Equal(t, int64(90), retention)
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		_, mark := newCommand()
+		path := writeConfig(t, "cutof: 45\n")
+		require.NoError(t, mark.ParseFlags(nil))
+		err := applyConfig(mark, path)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `unknown flag "cutof"`)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		_, mark := newCommand()
+		path := writeConfig(t, "cutoff: soon\n")
+		require.NoError(t, mark.ParseFlags(nil))
+		err := applyConfig(mark, path)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "cutoff")
+	})
+
+	t.Run("projects", func(t *testing.T) {
+		_, mark := newCommand()
+		path := writeConfig(t, `
+cutoff: 45
+projects:
+- host
+- id: service-a
+  impersonate-service-account: cleanup@service-a.iam.gserviceaccount.com
+- id: service-b
+  credentials-file: /secrets/service-b.json
+`)
+		require.NoError(t, mark.ParseFlags(nil))
+		require.NoError(t, applyConfig(mark, path), "projects is not a flag")
+		targets, err := loadProjectTargets(path)
+		require.NoError(t, err)
+		require.Equal(t, []projectTarget{
+			{ID: "host"},
+			{ID: "service-a", ImpersonateServiceAccount: "cleanup@service-a.iam.gserviceaccount.com"},
+			{ID: "service-b", CredentialsFile: "/secrets/service-b.json"},
+		}, targets)
+		require.False(t, targets[0].hasCredentials())
+		require.True(t, targets[1].hasCredentials())
+
+		for content, expected := range map[string]string{
+			"projects:\n- id: a\n  impersonate: sa\n": `unknown key "impersonate", expected id, credentials-file or impersonate-service-account`,
+			"projects:\n- credentials-file: a.json\n": "projects[0]: id is required",
+			"projects: [a, b, a]\n":                   "projects: project a is listed twice",
+		} {
+			_, err := loadProjectTargets(writeConfig(t, content))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), expected)
+		}
+		targets, err = loadProjectTargets(writeConfig(t, "cutoff: 45\n"))
+		require.NoError(t, err)
+		require.Empty(t, targets)
+	})
+}
+
+func Test_ApplyEnv(t *testing.T) {
+	t.Parallel()
+
+	var (
+		projectID string
+		zones     []string
+		dryRun    bool
+	)
+	cmd := &cobra.Command{Use: "mark", Run: func(*cobra.Command, []string) {}}
+	cmd.Flags().StringVar(&projectID, "project-id", "default", "")
+	cmd.Flags().StringSliceVar(&zones, "zones", nil, "")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", true, "")
+	require.NoError(t, cmd.ParseFlags([]string{"--project-id", "from-flag"}))
+
+	path := filepath.Join(t.TempDir(), "cleanup.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("dry-run: true\nzones: [us-east1-d]\n"), 0o600))
+	require.NoError(t, applyEnv(cmd, []string{
+		"GKE_DISK_CLEANUP_PROJECT_ID=from-env",
+		"GKE_DISK_CLEANUP_ZONES=us-east1-b,us-east1-c",
+		"GKE_DISK_CLEANUP_DRY_RUN=false",
+		"GKE_DISK_CLEANUP_SNAPSHOT_RETENTION_DAYS=10",
+		"HOME=/root",
+	}))
+	require.NoError(t, applyConfig(cmd, path))
+	require.Equal(t, "from-flag", projectID)
+	require.Equal(t, []string{"us-east1-b", "us-east1-c"}, zones)
+	require.False(t, dryRun)
+
+	cmd = &cobra.Command{Use: "mark", Run: func(*cobra.Command, []string) {}}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", true, "")
+	err := applyEnv(cmd, []string{"GKE_DISK_CLEANUP_DRY_RUN=maybe"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "GKE_DISK_CLEANUP_DRY_RUN")
+}
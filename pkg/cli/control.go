@@ -0,0 +1,299 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// controlCommands are the commands accepted on the control socket.
+var controlCommands = []string{"pause", "resume", "abort", "status", "set-qps"}
+
+// errAborted is the cause of a run aborted through the control socket.
+var errAborted = xerrors.New("run aborted through the control socket")
+
+// controlStatus is the reply to every command on the control socket.
+type controlStatus struct {
+	// Running reports whether a run is in progress, and RunStarted when it
+	// started.
+	Running    bool       `json:"running"`
+	RunStarted *time.Time `json:"runStarted,omitempty"`
+	Paused     bool       `json:"paused"`
+	// QPS is how many disks are processed per second at most, 0 if
+	// unlimited.
+	QPS   float64 `json:"qps"`
+	Error string  `json:"error,omitempty"`
+}
+
+// controller lets operators pause, resume, abort and throttle runs without
+// losing their progress: through commands on the Unix socket of serve and
+// soak, signals, or a key in the store. It is the cleanup.Pacer waited on
+// before each disk is processed, so a paused run completes the disks in
+// progress and holds the others.
+type controller struct {
+	mu         sync.Mutex
+	paused     bool
+	resumed    chan struct{}
+	qps        float64
+	rate       *cleanup.Rate
+	cancel     context.CancelFunc
+	runStarted time.Time
+}
+
+func newController() *controller {
+	return &controller{}
+}
+
+// Wait blocks while the run is paused, and then for the next slot if the
+// rate is limited.
+func (c *controller) Wait(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		paused, resumed, rate := c.paused, c.resumed, c.rate
+		c.mu.Unlock()
+		if !paused {
+			if rate == nil {
+				return ctx.Err()
+			}
+			return rate.Wait(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resumed:
+		}
+	}
+}
+
+// wrap returns run, made abortable through the controller.
+func (c *controller) wrap(run func(context.Context) error) func(context.Context) error {
+	return func(parent context.Context) error {
+		ctx, cancel := context.WithCancel(parent)
+		defer cancel()
+		c.mu.Lock()
+		c.cancel, c.runStarted = cancel, time.Now()
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			c.cancel = nil
+			c.mu.Unlock()
+		}()
+		err := run(ctx)
+		// unless shutting down, a cancelled run was aborted
+		if err != nil && ctx.Err() != nil && parent.Err() == nil {
+			return xerrors.Errorf("%w: %v", errAborted, err)
+		}
+		return err
+	}
+}
+
+// execute runs the control command line and returns the resulting status.
+func (c *controller) execute(line string) controlStatus {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return c.status(xerrors.Errorf("expected one of %s", strings.Join(controlCommands, ", ")))
+	}
+	command, args := fields[0], fields[1:]
+	if command != "set-qps" && len(args) > 0 {
+		return c.status(xerrors.Errorf("%s takes no arguments", command))
+	}
+	var err error
+	switch command {
+	case "pause":
+		c.pause("control socket")
+		return c.status(nil)
+	case "resume":
+		c.resume("control socket")
+		return c.status(nil)
+	}
+	c.mu.Lock()
+	switch command {
+	case "abort":
+		if c.cancel == nil {
+			err = xerrors.New("no run in progress")
+		} else {
+			c.cancel()
+		}
+	case "status":
+	case "set-qps":
+		err = c.setQPS(args)
+	default:
+		err = xerrors.Errorf("unknown command %q, expected one of %s", command, strings.Join(controlCommands, ", "))
+	}
+	c.mu.Unlock()
+	if err == nil && command != "status" {
+		log.Info().Str("command", line).Msg("control command")
+	}
+	return c.status(err)
+}
+
+// pause holds the disks not in progress yet until resume is called. source
+// tells who asked, for the log.
+func (c *controller) pause(source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return
+	}
+	c.paused, c.resumed = true, make(chan struct{})
+	log.Warn().Str("source", source).Msg("pausing -- disks in progress are completed, no new ones are started until resumed")
+}
+
+// resume continues after pause.
+func (c *controller) resume(source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return
+	}
+	c.paused = false
+	close(c.resumed)
+	log.Info().Str("source", source).Msg("resuming")
+}
+
+// watchPauseKey pauses while key exists in s, checking every interval until
+// ctx is done. Only changes of the key pause or resume, so that it does not
+// override the other ways to pause.
+func (c *controller) watchPauseKey(ctx context.Context, s store.Store, key string, interval time.Duration) {
+	source := "store key " + key
+	var paused bool
+	for {
+		_, err := s.Get(ctx, key)
+		switch {
+		case err == nil && !paused:
+			paused = true
+			c.pause(source)
+		case errors.Is(err, store.ErrNotExist) && paused:
+			paused = false
+			c.resume(source)
+		case err != nil && !errors.Is(err, store.ErrNotExist) && ctx.Err() == nil:
+			log.Warn().Err(err).Str("key", key).Msg("unable to check pause key")
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// setQPS limits the rate to the qps in args, 0 for unlimited. c.mu must be
+// held.
+func (c *controller) setQPS(args []string) error {
+	if len(args) != 1 {
+		return xerrors.New("set-qps takes the disks per second, 0 for unlimited")
+	}
+	qps, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || qps < 0 {
+		return xerrors.Errorf("invalid qps %q: expected a number of disks per second, 0 for unlimited", args[0])
+	}
+	c.qps, c.rate = qps, nil
+	if qps > 0 {
+		c.rate = cleanup.NewRate(1, time.Duration(float64(time.Second)/qps))
+	}
+	return nil
+}
+
+func (c *controller) status(err error) controlStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := controlStatus{Running: c.cancel != nil, Paused: c.paused, QPS: c.qps}
+	if s.Running {
+		started := c.runStarted
+		s.RunStarted = &started
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	return s
+}
+
+// serveConn answers every command line read from conn with a JSON status
+// line.
+func (c *controller) serveConn(conn io.ReadWriter) {
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if err := enc.Encode(c.execute(scanner.Text())); err != nil {
+			return
+		}
+	}
+}
+
+// listenControl serves c on the Unix socket at path until shutdown is
+// called. Only the owner of the process may connect.
+func listenControl(path string, c *controller) (shutdown func(), err error) {
+	// remove the socket of an earlier process that was killed
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, xerrors.Errorf("listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = listener.Close()
+		return nil, xerrors.Errorf("restrict access to %s: %w", path, err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Error().Err(err).Str("socket", path).Msg("accepting control connection failed")
+				}
+				return
+			}
+			go func() {
+				defer conn.Close()
+				c.serveConn(conn)
+			}()
+		}
+	}()
+	log.Info().Str("socket", path).Msg("serving control socket")
+	return func() { _ = listener.Close() }, nil
+}
+
+// sendControl sends command to the control socket at path and writes the
+// reply to w. It fails if the command failed.
+func sendControl(path, command string, w io.Writer) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return xerrors.Errorf("connect to %s: %w", path, err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, command+"\n"); err != nil {
+		return xerrors.Errorf("send command: %w", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return xerrors.Errorf("read reply: %w", err)
+	}
+	if _, err := w.Write(reply); err != nil {
+		return xerrors.Errorf("write reply: %w", err)
+	}
+	var status controlStatus
+	if err := json.Unmarshal(reply, &status); err != nil {
+		return xerrors.Errorf("parse reply: %w", err)
+	}
+	if status.Error != "" {
+		return xerrors.New(status.Error)
+	}
+	return nil
+}
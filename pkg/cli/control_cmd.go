@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func newControlCommand() *cobra.Command {
+	var controlSocket string
+	controlCmd := &cobra.Command{
+		Use:   "control <pause|resume|abort|status|set-qps> [qps]",
+		Short: "control the run of serve or soak in progress through its --control-socket",
+		Long: `control sends a command to the --control-socket of serve or soak and prints
+the resulting state as JSON:
+
+  pause        stop processing disks after those in progress
+  resume       continue processing disks
+  abort        stop the current run, which the next run resumes from its
+               checkpoint if --checkpoint-file is set
+  status       print the state only
+  set-qps N    process at most N disks per second, 0 for unlimited`,
+		Args:        cobra.RangeArgs(1, 2),
+		Annotations: map[string]string{annotationOffline: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if controlSocket == "" {
+				return xerrors.Errorf("--control-socket is required")
+			}
+			return sendControl(controlSocket, strings.Join(args, " "), cmd.OutOrStdout())
+		},
+	}
+	controlCmd.PersistentFlags().StringVar(&controlSocket, "control-socket", "", "the Unix socket serve or soak serves control commands on")
+	return controlCmd
+}
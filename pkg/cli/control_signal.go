@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package cli
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchSignals pauses on SIGUSR1 and resumes on SIGUSR2 until ctx is done.
+func (c *controller) watchSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			if sig == syscall.SIGUSR1 {
+				c.pause("SIGUSR1")
+			} else {
+				c.resume("SIGUSR2")
+			}
+		}
+	}
+}
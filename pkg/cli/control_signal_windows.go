@@ -0,0 +1,8 @@
+package cli
+
+import "context"
+
+// watchSignals does nothing, as Windows has no signals to pause and resume.
+func (c *controller) watchSignals(ctx context.Context) {
+	<-ctx.Done()
+}
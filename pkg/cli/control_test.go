@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_Controller(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pause and resume", func(t *testing.T) {
+		t.Parallel()
+		c := newController()
+		require.NoError(t, c.Wait(context.Background()))
+
+		require.Equal(t, controlStatus{Paused: true}, c.execute("pause"))
+		waited := make(chan error)
+		go func() { waited <- c.Wait(context.Background()) }()
+		select {
+		case <-waited:
+			t.Fatal("Wait returned while paused")
+		case <-time.After(10 * time.Millisecond):
+		}
+		require.Equal(t, controlStatus{}, c.execute("resume"))
+		require.NoError(t, <-waited)
+
+		// a paused run still stops on shutdown
+		c.execute("pause")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.ErrorIs(t, c.Wait(ctx), context.Canceled)
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		t.Parallel()
+		c := newController()
+		require.Equal(t, "no run in progress", c.execute("abort").Error)
+
+		started := make(chan struct{})
+		done := make(chan error)
+		run := c.wrap(func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		go func() { done <- run(context.Background()) }()
+		<-started
+		status := c.execute("status")
+		require.True(t, status.Running)
+		require.NotNil(t, status.RunStarted)
+		require.Empty(t, c.execute("abort").Error)
+		err := <-done
+		require.ErrorIs(t, err, errAborted)
+		require.False(t, c.execute("status").Running)
+
+		// shutting down is not an abort
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = c.wrap(func(ctx context.Context) error { return ctx.Err() })(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+		require.False(t, xerrors.Is(err, errAborted))
+	})
+
+	t.Run("set-qps", func(t *testing.T) {
+		t.Parallel()
+		c := newController()
+		require.Equal(t, controlStatus{QPS: 2.5}, c.execute("set-qps 2.5"))
+		require.Equal(t, 400*time.Millisecond, c.rate.Interval())
+		require.Equal(t, controlStatus{}, c.execute("set-qps 0"))
+		require.Nil(t, c.rate)
+		require.Equal(t, `invalid qps "-1": expected a number of disks per second, 0 for unlimited`, c.execute("set-qps -1").Error)
+		require.Equal(t, "set-qps takes the disks per second, 0 for unlimited", c.execute("set-qps").Error)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		c := newController()
+		require.Equal(t, "expected one of pause, resume, abort, status, set-qps", c.execute("").Error)
+		require.Equal(t, `unknown command "stop", expected one of pause, resume, abort, status, set-qps`, c.execute("stop").Error)
+		require.Equal(t, "pause takes no arguments", c.execute("pause now").Error)
+	})
+}
+
+func Test_ControlSocket(t *testing.T) {
+	t.Parallel()
+
+	dir, err := os.MkdirTemp("", "control")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "control.sock")
+	c := newController()
+	shutdown, err := listenControl(path, c)
+	require.NoError(t, err)
+	defer shutdown()
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	var b bytes.Buffer
+	require.NoError(t, sendControl(path, "pause", &b))
+	require.JSONEq(t, `{"running": false, "paused": true, "qps": 0}`, b.String())
+	require.True(t, c.execute("status").Paused)
+
+	b.Reset()
+	require.EqualError(t, sendControl(path, "abort", &b), "no run in progress")
+	require.Contains(t, b.String(), `"error":"no run in progress"`)
+}
+
+func Test_ControllerPauseKey(t *testing.T) {
+	t.Parallel()
+
+	s := store.Local{Dir: t.TempDir()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newController()
+	go c.watchPauseKey(ctx, s, "gke-disk-cleanup.pause", time.Millisecond)
+
+	paused := func() bool { return c.execute("status").Paused }
+	require.NoError(t, s.Put(ctx, "gke-disk-cleanup.pause", nil))
+	require.Eventually(t, paused, time.Second, time.Millisecond)
+
+	// resuming through the socket is not overridden while the key exists
+	c.execute("resume")
+	time.Sleep(10 * time.Millisecond)
+	require.False(t, paused())
+
+	c.execute("pause")
+	require.NoError(t, s.Delete(ctx, "gke-disk-cleanup.pause"))
+	require.Eventually(t, func() bool { return !paused() }, time.Second, time.Millisecond)
+}
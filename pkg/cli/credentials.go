@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+)
+
+// cloudPlatformScope is the scope of the credentials of all API clients.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// credentials are the client options of --credentials-file and
+// --impersonate-service-account.
+type credentials struct {
+	// Options are added to the client options of every API client.
+	Options []option.ClientOption
+	// Identity is the email of the account API calls are made as, if known.
+	Identity string
+	// tokens issues the tokens of Options.
+	tokens oauth2.TokenSource
+}
+
+// loadCredentials returns the credentials read from file, or application
+// default credentials if empty, and used to impersonate serviceAccount if
+// set. It returns nil if both are empty.
+func loadCredentials(ctx context.Context, file, serviceAccount string) (*credentials, error) {
+	if file == "" && serviceAccount == "" {
+		return nil, nil
+	}
+	c := &credentials{}
+	var base []option.ClientOption
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, xerrors.Errorf("read credentials: %w", err)
+		}
+		creds, err := google.CredentialsFromJSON(ctx, data, cloudPlatformScope)
+		if err != nil {
+			return nil, xerrors.Errorf("parse credentials %s: %w", file, err)
+		}
+		var key struct {
+			ClientEmail string `json:"client_email"`
+		}
+		if json.Unmarshal(data, &key) == nil {
+			c.Identity = key.ClientEmail
+		}
+		c.tokens = creds.TokenSource
+		base = []option.ClientOption{option.WithCredentials(creds)}
+	}
+	if serviceAccount != "" {
+		tokens, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+			TargetPrincipal: serviceAccount,
+			Scopes:          []string{cloudPlatformScope},
+		}, base...)
+		if err != nil {
+			return nil, xerrors.Errorf("impersonate %s: %w", serviceAccount, err)
+		}
+		c.Identity, c.tokens = serviceAccount, tokens
+		base = []option.ClientOption{option.WithTokenSource(tokens)}
+	}
+	c.Options = base
+	return c, nil
+}
+
+// projectOptions are the client options of the API clients of the projects
+// with credentials of their own, by project ID.
+type projectOptions map[string][]option.ClientOption
+
+// loadProjectOptions returns the client options of every project of targets
+// with credentials of its own: clientOptions and those of its credentials. A
+// target impersonating a service account without a credentials file of its
+// own does so with defaultFile, i.e. --credentials-file, or application
+// default credentials if empty.
+func loadProjectOptions(ctx context.Context, targets []projectTarget, defaultFile string, clientOptions []option.ClientOption) (projectOptions, error) {
+	options := make(projectOptions)
+	for _, t := range targets {
+		if !t.hasCredentials() {
+			continue
+		}
+		file := t.CredentialsFile
+		if file == "" {
+			file = defaultFile
+		}
+		creds, err := loadCredentials(ctx, file, t.ImpersonateServiceAccount)
+		if err != nil {
+			return nil, xerrors.Errorf("project %s: %w", t.ID, err)
+		}
+		if err := creds.check(); err != nil {
+			return nil, xerrors.Errorf("project %s: %w", t.ID, err)
+		}
+		options[t.ID] = append(append([]option.ClientOption(nil), clientOptions...), creds.Options...)
+		log.Info().Str("projectID", t.ID).Str("identity", creds.Identity).Msg("using credentials of project")
+	}
+	return options, nil
+}
+
+// of returns the client options of projectID, or fallback if it has no
+// credentials of its own.
+func (p projectOptions) of(projectID string, fallback []option.ClientOption) []option.ClientOption {
+	if options, ok := p[projectID]; ok {
+		return options
+	}
+	return fallback
+}
+
+// check fetches a token, so that credentials that cannot be used, e.g. a
+// service account the caller may not impersonate, fail at startup rather
+// than on the first API call.
+func (c *credentials) check() error {
+	if _, err := c.tokens.Token(); err != nil {
+		if c.Identity != "" {
+			return xerrors.Errorf("get token for %s: %w", c.Identity, err)
+		}
+		return xerrors.Errorf("get token: %w", err)
+	}
+	return nil
+}
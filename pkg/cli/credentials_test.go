@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadCredentials(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.json")
+	require.NoError(t, os.WriteFile(keyFile, []byte(`{
+  "type": "service_account",
+  "project_id": "testing",
+  "private_key_id": "1",
+  "private_key": "not a key",
+  "client_email": "runner@testing.iam.gserviceaccount.com",
+  "token_uri": "https://oauth2.googleapis.com/token"
+}`), 0o600))
+	invalidFile := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalidFile, []byte(`{"type": "unknown"}`), 0o600))
+
+	ctx := context.Background()
+	creds, err := loadCredentials(ctx, "", "")
+	require.NoError(t, err)
+	require.Nil(t, creds, "application default credentials")
+
+	_, err = loadCredentials(ctx, filepath.Join(dir, "missing.json"), "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "read credentials")
+
+	_, err = loadCredentials(ctx, invalidFile, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "parse credentials")
+
+	creds, err = loadCredentials(ctx, keyFile, "")
+	require.NoError(t, err)
+	require.Equal(t, "runner@testing.iam.gserviceaccount.com", creds.Identity)
+	require.Len(t, creds.Options, 1)
+	err = creds.check()
+	require.Error(t, err, "the key is invalid")
+	require.Contains(t, err.Error(), "get token for runner@testing.iam.gserviceaccount.com")
+
+	creds, err = loadCredentials(ctx, keyFile, "cleanup@testing.iam.gserviceaccount.com")
+	require.NoError(t, err)
+	require.Equal(t, "cleanup@testing.iam.gserviceaccount.com", creds.Identity)
+	require.Len(t, creds.Options, 1)
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"html/template"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/pricing"
+	"gke-disk-cleanup/pkg/store"
+)
+
+const (
+	reportFormatCSV  = "csv"
+	reportFormatHTML = "html"
+)
+
+// reportRow is the line of a disk in the report of a run.
+type reportRow struct {
+	diskResult
+	// Owner is the value of the owner label of the disk.
+	Owner string
+	// AgeDays is how many days ago the disk was last in use, -1 if unknown.
+	AgeDays int
+	// MonthlyCost is what the disk costs per month.
+	MonthlyCost float64
+}
+
+// Decision is the action taken on the disk, or the code it was skipped or
+// failed with.
+func (r reportRow) Decision() string {
+	if r.Code != "" {
+		return string(r.Code)
+	}
+	return r.Action
+}
+
+// diskReport writes a CSV or HTML report of every disk evaluated by a mark or
+// cleanup run to --report-out, e.g. for a spreadsheet per run.
+type diskReport struct {
+	path       string
+	format     string
+	ownerLabel string
+	// perCommand names the report of each command after it, as serve runs
+	// both: report.mark.csv and report.cleanup.csv for report.csv.
+	perCommand bool
+	now        func() time.Time
+
+	mu sync.Mutex
+	// prices may be nil for the built-in prices.
+	prices *pricing.Table
+	rows   []reportRow
+}
+
+// newDiskReport returns the report written to the key path, in the format of
+// its extension: .csv, or .html or .htm.
+func newDiskReport(path, ownerLabel string) (*diskReport, error) {
+	format, err := reportFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &diskReport{path: path, format: format, ownerLabel: ownerLabel, now: time.Now}, nil
+}
+
+func reportFormat(key string) (string, error) {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".csv":
+		return reportFormatCSV, nil
+	case ".html", ".htm":
+		return reportFormatHTML, nil
+	}
+	return "", xerrors.Errorf("invalid --report-out %q: expected a .csv or .html file", key)
+}
+
+// reset clears the report to start a new run, using prices for the costs.
+// It is safe to call on a nil report.
+func (r *diskReport) reset(prices *pricing.Table) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prices = prices
+	r.rows = nil
+}
+
+// handle adds the disk of a DiskProcessed event to the report.
+func (r *diskReport) handle(e events.Event) {
+	if e.Type != events.DiskProcessed {
+		return
+	}
+	row := reportRow{diskResult: newDiskResult(e), Owner: e.Disk.GetLabels()[r.ownerLabel], AgeDays: -1}
+	if lastUsed, err := time.Parse(time.RFC3339, cleanup.LastUsed(e.Disk)); err == nil {
+		row.AgeDays = int(r.now().Sub(lastUsed) / (24 * time.Hour))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	row.MonthlyCost = r.prices.DiskMonthlyCost(row.Type, row.SizeGB)
+	r.rows = append(r.rows, row)
+}
+
+// key returns the key the report of a run of command is written to.
+func (r *diskReport) key(command string) string {
+	if !r.perCommand {
+		return r.path
+	}
+	ext := path.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "." + command + ext
+}
+
+// write writes the report of the run of command to s, replacing the report
+// of the previous run, and clears it. It is safe to call on a nil report.
+func (r *diskReport) write(ctx context.Context, s store.Store, command string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	rows := r.rows
+	r.rows = nil
+	region := pricing.Default.Region
+	if r.prices != nil {
+		region = r.prices.Region
+	}
+	r.mu.Unlock()
+
+	var buf bytes.Buffer
+	var err error
+	if r.format == reportFormatHTML {
+		err = writeHTMLReport(&buf, command, region, r.now(), rows)
+	} else {
+		err = writeCSVReport(&buf, rows)
+	}
+	if err != nil {
+		return xerrors.Errorf("render report: %w", err)
+	}
+	key := r.key(command)
+	if err := s.Put(ctx, key, buf.Bytes()); err != nil {
+		return xerrors.Errorf("write report %s: %w", key, err)
+	}
+	return nil
+}
+
+var reportColumns = []string{"project", "zone", "disk", "cluster", "namespace", "pvc", "decision", "dry_run", "type", "size_gb", "age_days", "owner", "monthly_cost_usd", "error"}
+
+func writeCSVReport(buf *bytes.Buffer, rows []reportRow) error {
+	w := csv.NewWriter(buf)
+	if err := w.Write(reportColumns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		age := ""
+		if row.AgeDays >= 0 {
+			age = strconv.Itoa(row.AgeDays)
+		}
+		if err := w.Write([]string{
+			row.ProjectID,
+			row.Zone,
+			row.Name,
+			row.Cluster,
+			row.Namespace,
+			row.PVC,
+			row.Decision(),
+			strconv.FormatBool(row.DryRun),
+			row.Type,
+			strconv.FormatInt(row.SizeGB, 10),
+			age,
+			row.Owner,
+			strconv.FormatFloat(row.MonthlyCost, 'f', 2, 64),
+			row.Error,
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gke-disk-cleanup {{.Command}} report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+td.number { text-align: right; }
+</style>
+</head>
+<body>
+<h1>gke-disk-cleanup {{.Command}} report</h1>
+<p>{{len .Rows}} disks evaluated on {{.Generated.Format "2006-01-02 15:04 MST"}}, {{.SizeGB}} GB at an estimated ${{printf "%.2f" .MonthlyCost}}/month. Costs are estimated at {{.Region}} list prices.</p>
+<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr><td>{{.ProjectID}}</td><td>{{.Zone}}</td><td>{{.Name}}</td><td>{{.Cluster}}</td><td>{{.Namespace}}</td><td>{{.PVC}}</td><td>{{.Decision}}</td><td>{{.DryRun}}</td><td>{{.Type}}</td><td class="number">{{.SizeGB}}</td><td class="number">{{if ge .AgeDays 0}}{{.AgeDays}}{{end}}</td><td>{{.Owner}}</td><td class="number">{{printf "%.2f" .MonthlyCost}}</td><td>{{.Error}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+func writeHTMLReport(buf *bytes.Buffer, command, region string, generated time.Time, rows []reportRow) error {
+	data := struct {
+		Command     string
+		Region      string
+		Generated   time.Time
+		Columns     []string
+		Rows        []reportRow
+		SizeGB      int64
+		MonthlyCost float64
+	}{Command: command, Region: region, Generated: generated, Columns: reportColumns, Rows: rows}
+	for _, row := range rows {
+		data.SizeGB += row.SizeGB
+		data.MonthlyCost += row.MonthlyCost
+	}
+	return htmlReport.Execute(buf, data)
+}
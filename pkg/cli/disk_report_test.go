@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_DiskReport(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 31, 12, 0, 0, 0, time.UTC)
+	old := &computepb.Disk{
+		Name:                pointer.String("old-disk"),
+		Type:                pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/diskTypes/pd-ssd"),
+		SizeGb:              pointer.Int64(100),
+		Labels:              map[string]string{"owner": "jdoe"},
+		Description:         pointer.String(`{"kubernetes.io/created-for/pvc/name":"data-postgres-0","kubernetes.io/created-for/pvc/namespace":"payments"}`),
+		CreationTimestamp:   pointer.String("2021-12-01T12:00:00Z"),
+		LastAttachTimestamp: pointer.String("2022-01-30T12:00:00Z"),
+	}
+	recent := &computepb.Disk{
+		Name:              pointer.String("<recent>"),
+		SizeGb:            pointer.Int64(10),
+		CreationTimestamp: pointer.String("2022-03-29T12:00:00Z"),
+	}
+	disks := []events.Event{
+		{Type: events.DiskScanned, ProjectID: "testing", Zone: "us-east1-b", Disk: old},
+		{Type: events.DiskProcessed, ProjectID: "testing", Zone: "us-east1-b", Disk: old, Action: "MARK"},
+		{Type: events.DiskProcessed, ProjectID: "testing", Zone: "us-east1-b", Disk: recent, Action: "SKIP", DryRun: true, Err: diskerr.ErrWithinCutoff},
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		r, err := newDiskReport("report.csv", "owner")
+		require.NoError(t, err)
+		r.now = func() time.Time { return now }
+		r.reset(nil)
+		for _, e := range disks {
+			r.handle(e)
+		}
+		require.NoError(t, r.write(context.Background(), store.Local{Dir: dir}, "mark"))
+		data, err := os.ReadFile(filepath.Join(dir, "report.csv"))
+		require.NoError(t, err)
+		require.Equal(t, `project,zone,disk,cluster,namespace,pvc,decision,dry_run,type,size_gb,age_days,owner,monthly_cost_usd,error
+testing,us-east1-b,old-disk,,payments,data-postgres-0,MARK,false,pd-ssd,100,60,jdoe,17.00,
+testing,us-east1-b,<recent>,,,,WITHIN_CUTOFF,true,,10,2,,0.40,disk last attached within cutoff
+`, string(data))
+
+		// the next run replaces the report
+		r.reset(nil)
+		require.NoError(t, r.write(context.Background(), store.Local{Dir: dir}, "mark"))
+		data, err = os.ReadFile(filepath.Join(dir, "report.csv"))
+		require.NoError(t, err)
+		require.Equal(t, "project,zone,disk,cluster,namespace,pvc,decision,dry_run,type,size_gb,age_days,owner,monthly_cost_usd,error\n", string(data))
+	})
+
+	t.Run("html", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		r, err := newDiskReport("report.html", "owner")
+		require.NoError(t, err)
+		r.now = func() time.Time { return now }
+		r.perCommand = true
+		r.reset(nil)
+		for _, e := range disks {
+			r.handle(e)
+		}
+		require.NoError(t, r.write(context.Background(), store.Local{Dir: dir}, "cleanup"))
+		data, err := os.ReadFile(filepath.Join(dir, "report.cleanup.html"))
+		require.NoError(t, err)
+		require.Contains(t, string(data), "<h1>gke-disk-cleanup cleanup report</h1>")
+		require.Contains(t, string(data), "2 disks evaluated on 2022-03-31 12:00 UTC, 110 GB at an estimated $17.40/month")
+		require.Contains(t, string(data), "<td>&lt;recent&gt;</td>")
+		require.Contains(t, string(data), `<td>jdoe</td><td class="number">17.00</td>`)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		t.Parallel()
+		_, err := newDiskReport("report.xlsx", "owner")
+		require.EqualError(t, err, `invalid --report-out "report.xlsx": expected a .csv or .html file`)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		var r *diskReport
+		r.reset(nil)
+		require.NoError(t, r.write(context.Background(), store.Local{}, "mark"))
+	})
+}
@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/kube"
+)
+
+// diskStatus tells the owner of a disk whether it is scheduled for deletion,
+// as shown by status --disk or --pvc.
+type diskStatus struct {
+	ProjectID string `json:"projectID"`
+	Zone      string `json:"zone"`
+	Name      string `json:"name"`
+	// Claim is the namespace/name of the PersistentVolumeClaim the disk
+	// was looked up by, if any.
+	Claim  string         `json:"claim,omitempty"`
+	Source cleanup.Source `json:"source"`
+	// LastUsed is the latest of the creation, last attach and last detach
+	// timestamps of the disk.
+	LastUsed string `json:"lastUsed,omitempty"`
+	// CutoffDays is how many days the disk must not be used to be marked,
+	// which depends on its source.
+	CutoffDays int64 `json:"cutoffDays"`
+	// MarkPolicy describes the --mark-policy of mark, which decides instead
+	// of the cutoff alone whether the disk is abandoned. Empty by default.
+	MarkPolicy string `json:"markPolicy,omitempty"`
+	// Marked is the value of the mark, empty if there is none.
+	Marked string `json:"marked,omitempty"`
+	Exempt bool   `json:"exempt"`
+	// Deletable and DeletableAfter tell when cleanup may delete the disk,
+	// as for markedDisk. Both are unset unless the disk is marked.
+	Deletable      bool       `json:"deletable"`
+	DeletableAfter *time.Time `json:"deletableAfter,omitempty"`
+	// NextMark is what the next mark run does with the disk, and
+	// NextMarkCode the reason for a skip.
+	NextMark     cleanup.Action `json:"nextMark"`
+	NextMarkCode diskerr.Code   `json:"nextMarkCode,omitempty"`
+	// Keep lists the commands that keep the disk from being deleted.
+	Keep []string `json:"keep,omitempty"`
+	// marked reports whether Marked is a mark rather than e.g. false, and
+	// attached whether the disk is attached, which cleanup never deletes.
+	marked   bool
+	attached bool
+}
+
+// diskCheck configures newDiskStatus.
+type diskCheck struct {
+	// Use is the name of the command, for the unmark hint.
+	Use string
+	// Mark holds the cutoffs and exempt label of mark.
+	Mark        cleanup.MarkOptions
+	GracePeriod time.Duration
+}
+
+// newDiskStatus describes what mark and cleanup do with disk at now.
+func newDiskStatus(projectID, zone string, disk *computepb.Disk, check diskCheck, now time.Time) diskStatus {
+	opts := check.Mark
+	opts.ProjectID = projectID
+	opts.Zones = []string{zone}
+	action, err := cleanup.Decide(disk, opts)
+	_, marked := cleanup.MarkedAt(disk)
+	s := diskStatus{
+		ProjectID: projectID,
+		Zone:      zone,
+		Name:      disk.GetName(),
+		Source:    cleanup.DiskSource(disk),
+		LastUsed:  cleanup.LastUsed(disk),
+		Marked:    disk.GetLabels()[cleanup.LabelMarkedForDeletion],
+		NextMark:  action,
+		marked:    marked,
+		attached:  len(disk.GetUsers()) > 0,
+	}
+	cutoff := opts.Cutoff
+	if c, ok := opts.SourceCutoffs[s.Source]; ok {
+		cutoff = c
+	}
+	s.CutoffDays = int64(cutoff / (24 * time.Hour))
+	if opts.Policy != nil {
+		s.MarkPolicy = fmt.Sprint(opts.Policy)
+	}
+	if err != nil {
+		s.NextMarkCode = diskerr.CodeOf(err)
+		s.Exempt = s.NextMarkCode == diskerr.CodeExempt
+	}
+	if marked && !s.Exempt && !s.attached {
+		d := newMarkedDisk(projectID, zone, disk, check.GracePeriod, nil, now)
+		s.Deletable, s.DeletableAfter = d.Deletable, d.DeletableAfter
+	}
+	if marked && !s.Exempt {
+		s.Keep = append(s.Keep, fmt.Sprintf("%s unmark %s --project-id %s --zone %s --dry-run=false", check.Use, s.Name, projectID, zone))
+	}
+	if exemptLabel := opts.ExemptLabel; exemptLabel != "" && !s.Exempt {
+		s.Keep = append(s.Keep, fmt.Sprintf("gcloud compute disks add-labels %s --project %s --zone %s --labels %s=true", s.Name, projectID, zone, exemptLabel))
+	}
+	return s
+}
+
+// deletion tells when cleanup deletes the disk, for the status text.
+func (s diskStatus) deletion() string {
+	switch {
+	case s.Exempt:
+		return "never, the disk is exempt"
+	case s.marked && s.NextMark == cleanup.ActionUnmark:
+		return "not scheduled, the next mark run unmarks the disk as it was used within the cutoff"
+	case s.marked && s.attached:
+		return "not while the disk is attached"
+	case s.marked:
+		return markedDisk{Deletable: s.Deletable, DeletableAfter: s.DeletableAfter}.deadline()
+	case s.NextMark == cleanup.ActionMark:
+		return "not scheduled, but the next mark run marks the disk, which starts its grace period"
+	default:
+		return "not scheduled"
+	}
+}
+
+// findDiskStatus returns the status of the disks named name in projects, in
+// zones or all zones if nil. It fails if there is none.
+func findDiskStatus(ctx context.Context, client cleanup.DisksClient, projects, zones []string, tenant cleanup.Tenant, name string, check diskCheck) ([]diskStatus, error) {
+	now := time.Now()
+	var found []diskStatus
+	for _, projectID := range projects {
+		err := cleanup.ListNamed(ctx, client, projectID, zones, tenant, name, func(disk *computepb.Disk, zone string) error {
+			found = append(found, newDiskStatus(projectID, zone, disk, check, now))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(found) == 0 {
+		return nil, xerrors.Errorf("disk %s not found in project %s", name, strings.Join(projects, ", "))
+	}
+	return found, nil
+}
+
+// claimDisk returns the disk backing the PersistentVolumeClaim name in
+// namespace, as the pdName or volume handle of its volume.
+func claimDisk(ctx context.Context, client *kube.Client, namespace, name string) (string, error) {
+	pvc, err := client.GetPersistentVolumeClaim(ctx, namespace, name)
+	if err != nil {
+		return "", err
+	}
+	if pvc.Spec.VolumeName == "" {
+		return "", xerrors.Errorf("claim %s/%s is not bound to a volume yet", namespace, name)
+	}
+	pv, err := client.GetPersistentVolume(ctx, pvc.Spec.VolumeName)
+	if err != nil {
+		return "", err
+	}
+	diskID := pv.DiskID()
+	if diskID == "" {
+		return "", xerrors.Errorf("volume %s of claim %s/%s is not backed by a compute engine disk", pvc.Spec.VolumeName, namespace, name)
+	}
+	return diskID, nil
+}
+
+// parseDiskID splits the volume handle of a PD CSI volume, e.g.
+// projects/p/zones/z/disks/d, into its parts. The pdName of an in-tree
+// volume is only a name.
+func parseDiskID(diskID string) (projectID, zone, name string) {
+	parts := strings.Split(diskID, "/")
+	if len(parts) == 6 && parts[0] == "projects" && parts[2] == "zones" && parts[4] == "disks" {
+		return parts[1], parts[3], parts[5]
+	}
+	return "", "", diskID
+}
+
+// writeDiskStatus writes disks to w as text, or as JSON lines if output is
+// json.
+func writeDiskStatus(w io.Writer, output string, disks []diskStatus) error {
+	if output == outputJSON {
+		enc := json.NewEncoder(w)
+		for _, s := range disks {
+			if err := enc.Encode(s); err != nil {
+				return xerrors.Errorf("write status: %w", err)
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, s := range disks {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "Disk:\tprojects/%s/zones/%s/disks/%s\n", s.ProjectID, s.Zone, s.Name)
+		if s.Claim != "" {
+			fmt.Fprintf(tw, "Claim:\t%s\n", s.Claim)
+		}
+		lastUsed := s.LastUsed
+		if lastUsed == "" {
+			lastUsed = "never"
+		}
+		fmt.Fprintf(tw, "Last used:\t%s\n", lastUsed)
+		if s.MarkPolicy != "" {
+			fmt.Fprintf(tw, "Policy:\tmarked if %s, with a cutoff of %d days for %s disks\n", s.MarkPolicy, s.CutoffDays, s.Source)
+		} else {
+			fmt.Fprintf(tw, "Policy:\tmarked after %d days unused, the cutoff for %s disks\n", s.CutoffDays, s.Source)
+		}
+		marked := s.Marked
+		if marked == "" {
+			marked = "no"
+		}
+		fmt.Fprintf(tw, "Marked:\t%s\n", marked)
+		fmt.Fprintf(tw, "Deleted:\t%s\n", s.deletion())
+		nextMark := string(s.NextMark)
+		if s.NextMarkCode != "" {
+			nextMark += " (" + string(s.NextMarkCode) + ")"
+		}
+		fmt.Fprintf(tw, "Next mark:\t%s\n", nextMark)
+		for j, keep := range s.Keep {
+			label := "To keep it:"
+			if j > 0 {
+				label = "or:"
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", label, keep)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return xerrors.Errorf("write status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/kube"
+)
+
+func Test_DiskStatus(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+	day := 24 * time.Hour
+	check := diskCheck{
+		Use: "gke-disk-cleanup",
+		Mark: cleanup.MarkOptions{
+			Cutoff:        30 * day,
+			SourceCutoffs: map[cleanup.Source]time.Duration{cleanup.SourceImage: 90 * day},
+			ExemptLabel:   cleanup.DefaultExemptLabel,
+		},
+		GracePeriod: 7 * day,
+	}
+	disk := func(name string, lastAttached time.Duration, labels map[string]string) *computepb.Disk {
+		return &computepb.Disk{
+			Name:                pointer.String(name),
+			Zone:                pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b"),
+			LastAttachTimestamp: pointer.String(now.Add(-lastAttached).Format(time.RFC3339)),
+			Labels:              labels,
+		}
+	}
+	mark := now.AddDate(0, 0, -2).Format("2006-01-02")
+
+	marked := newDiskStatus("testing", "us-east1-b", disk("marked", 60*day, map[string]string{cleanup.LabelMarkedForDeletion: mark}), check, now)
+	require.Equal(t, int64(30), marked.CutoffDays)
+	require.Equal(t, cleanup.ActionSkip, marked.NextMark)
+	require.Equal(t, diskerr.CodeAlreadyMarked, marked.NextMarkCode)
+	require.False(t, marked.Deletable)
+	require.NotNil(t, marked.DeletableAfter)
+	require.Equal(t, []string{
+		"gke-disk-cleanup unmark marked --project-id testing --zone us-east1-b --dry-run=false",
+		"gcloud compute disks add-labels marked --project testing --zone us-east1-b --labels gke-disk-cleanup-exempt=true",
+	}, marked.Keep)
+	require.Contains(t, marked.deletion(), "after ")
+
+	stale := newDiskStatus("testing", "us-east1-b", disk("stale", 60*day, nil), check, now)
+	require.Equal(t, cleanup.ActionMark, stale.NextMark)
+	require.Empty(t, stale.NextMarkCode)
+	require.Nil(t, stale.DeletableAfter)
+	require.Len(t, stale.Keep, 1, "only exempting keeps a disk that is not marked")
+	require.Equal(t, "not scheduled, but the next mark run marks the disk, which starts its grace period", stale.deletion())
+
+	boot := disk("boot", 60*day, nil)
+	boot.SourceImage = pointer.String("projects/debian-cloud/global/images/debian-11")
+	image := newDiskStatus("testing", "us-east1-b", boot, check, now)
+	require.Equal(t, int64(90), image.CutoffDays)
+	require.Equal(t, cleanup.ActionSkip, image.NextMark)
+	require.Equal(t, diskerr.CodeBootDisk, image.NextMarkCode)
+	require.Equal(t, "not scheduled", image.deletion())
+
+	exempt := newDiskStatus("testing", "us-east1-b", disk("exempt", 60*day, map[string]string{
+		cleanup.LabelMarkedForDeletion: mark,
+		cleanup.DefaultExemptLabel:     "true",
+	}), check, now)
+	require.True(t, exempt.Exempt)
+	require.Nil(t, exempt.DeletableAfter)
+	require.Empty(t, exempt.Keep)
+	require.Equal(t, "never, the disk is exempt", exempt.deletion())
+
+	reattached := newDiskStatus("testing", "us-east1-b", disk("reattached", day, map[string]string{cleanup.LabelMarkedForDeletion: mark}), check, now)
+	require.Equal(t, cleanup.ActionUnmark, reattached.NextMark)
+	require.Contains(t, reattached.deletion(), "the next mark run unmarks the disk")
+
+	var b bytes.Buffer
+	stale.Claim = "team-a/data"
+	require.NoError(t, writeDiskStatus(&b, outputConsole, []diskStatus{stale}))
+	require.Equal(t, fmt.Sprintf(`Disk:        projects/testing/zones/us-east1-b/disks/stale
+Claim:       team-a/data
+Last used:   %s
+Policy:      marked after 30 days unused, the cutoff for blank disks
+Marked:      no
+Deleted:     not scheduled, but the next mark run marks the disk, which starts its grace period
+Next mark:   MARK
+To keep it:  gcloud compute disks add-labels stale --project testing --zone us-east1-b --labels gke-disk-cleanup-exempt=true
+`, stale.LastUsed), b.String())
+
+	b.Reset()
+	require.NoError(t, writeDiskStatus(&b, outputJSON, []diskStatus{image}))
+	require.JSONEq(t, fmt.Sprintf(`{
+		"projectID": "testing",
+		"zone": "us-east1-b",
+		"name": "boot",
+		"source": "image",
+		"lastUsed": %q,
+		"cutoffDays": 90,
+		"exempt": false,
+		"deletable": false,
+		"nextMark": "SKIP",
+		"nextMarkCode": "BOOT_DISK",
+		"keep": ["gcloud compute disks add-labels boot --project testing --zone us-east1-b --labels gke-disk-cleanup-exempt=true"]
+	}`, image.LastUsed), b.String())
+
+	// a mark policy decides instead of the cutoff alone
+	check.Mark.Policy = cleanup.AllOf{cleanup.LastAttachAge{}, cleanup.LabelMatch{Key: "env", Value: "dev"}}
+	kept := newDiskStatus("testing", "us-east1-b", disk("kept", 60*day, nil), check, now)
+	require.Equal(t, cleanup.ActionSkip, kept.NextMark)
+	require.Equal(t, "all of (unused past the cutoff, labelled env=dev)", kept.MarkPolicy)
+	b.Reset()
+	require.NoError(t, writeDiskStatus(&b, outputConsole, []diskStatus{kept}))
+	require.Contains(t, b.String(), "Policy:      marked if all of (unused past the cutoff, labelled env=dev), with a cutoff of 30 days for blank disks\n")
+}
+
+func Test_ClaimDisk(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/team-a/persistentvolumeclaims/data":
+			fmt.Fprint(w, `{"spec":{"volumeName":"pvc-0b5e"},"status":{"phase":"Bound"}}`)
+		case "/api/v1/namespaces/team-a/persistentvolumeclaims/pending":
+			fmt.Fprint(w, `{"spec":{},"status":{"phase":"Pending"}}`)
+		case "/api/v1/persistentvolumes/pvc-0b5e":
+			fmt.Fprint(w, `{"metadata":{"name":"pvc-0b5e"},"spec":{"csi":{"driver":"pd.csi.storage.gke.io","volumeHandle":"projects/testing/zones/us-east1-b/disks/pvc-0b5e"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client, err := kube.NewClient(&kube.Config{Server: srv.URL})
+	require.NoError(t, err)
+
+	diskID, err := claimDisk(context.Background(), client, "team-a", "data")
+	require.NoError(t, err)
+	projectID, zone, name := parseDiskID(diskID)
+	require.Equal(t, []string{"testing", "us-east1-b", "pvc-0b5e"}, []string{projectID, zone, name})
+
+	_, err = claimDisk(context.Background(), client, "team-a", "pending")
+	require.EqualError(t, err, "claim team-a/pending is not bound to a volume yet")
+
+	projectID, zone, name = parseDiskID("gke-disk-a")
+	require.Equal(t, []string{"", "", "gke-disk-a"}, []string{projectID, zone, name})
+}
@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/certificate"
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// Test_EndToEnd runs the commands against a fake of the Compute API. It is
+// not parallel as the commands set up the global logger.
+func Test_EndToEnd(t *testing.T) {
+	const zone = "us-east1-b"
+	today := time.Now().UTC().Format("2006-01-02")
+	// gkeVolume returns a disk backing a GKE volume, last detached
+	// idle ago, with labels.
+	gkeVolume := func(name string, idle time.Duration, labels map[string]string) *computepb.Disk {
+		diskLabels := map[string]string{"goog-gke-volume": ""}
+		for k, v := range labels {
+			diskLabels[k] = v
+		}
+		return &computepb.Disk{
+			Name:                pointer.String(name),
+			SizeGb:              pointer.Int64(10),
+			Type:                pointer.String(fakeComputeBase + "projects/p/zones/" + zone + "/diskTypes/pd-balanced"),
+			LastAttachTimestamp: pointer.String(time.Now().Add(-idle - time.Hour).Format(time.RFC3339)),
+			LastDetachTimestamp: pointer.String(time.Now().Add(-idle).Format(time.RFC3339)),
+			Labels:              diskLabels,
+		}
+	}
+	abandoned := 60 * 24 * time.Hour
+	marked := map[string]string{cleanup.LabelMarkedForDeletion: "2022-01-01"}
+	// runIn runs a command with the store in the directory store, and run
+	// with a store of its own.
+	runIn := func(f *fakeCompute, store string, args ...string) error {
+		cmd := NewRootCommand(Options{ClientOptions: f.clientOptions()})
+		cmd.SetArgs(append(args, "--project-id=p", "--zone="+zone, "--preflight=false", "--store="+store))
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		return cmd.ExecuteContext(context.Background())
+	}
+	run := func(t *testing.T, f *fakeCompute, args ...string) error {
+		return runIn(f, t.TempDir(), args...)
+	}
+
+	t.Run("mark pages through disks", func(t *testing.T) {
+		f := newFakeCompute(t)
+		for _, name := range []string{"pvc-a", "pvc-b", "pvc-c", "pvc-d"} {
+			f.addDisk("p", zone, gkeVolume(name, abandoned, nil))
+		}
+		f.addDisk("p", zone, gkeVolume("pvc-used", time.Hour, nil))
+		f.addDisk("p", zone, &computepb.Disk{Name: pointer.String("vm-data"), LastDetachTimestamp: pointer.String("2022-01-01T00:00:00Z")})
+		f.addDisk("p", "us-east1-c", gkeVolume("pvc-other-zone", abandoned, nil))
+		fingerprint := f.disk("p", zone, "pvc-a").GetLabelFingerprint()
+
+		require.NoError(t, run(t, f, "mark", "--dry-run=false", "--page-size=2"))
+		for _, name := range []string{"pvc-a", "pvc-b", "pvc-c", "pvc-d"} {
+			require.Equal(t, today, f.disk("p", zone, name).GetLabels()[cleanup.LabelMarkedForDeletion], name)
+		}
+		require.NotEqual(t, fingerprint, f.disk("p", zone, "pvc-a").GetLabelFingerprint())
+		require.NotContains(t, f.disk("p", zone, "pvc-used").GetLabels(), cleanup.LabelMarkedForDeletion)
+		require.Empty(t, f.disk("p", zone, "vm-data").GetLabels(), "not listed by the filter")
+		require.Empty(t, f.disk("p", "us-east1-c", "pvc-other-zone").GetLabels()[cleanup.LabelMarkedForDeletion])
+
+		lists := f.served(http.MethodGet, "/zones/"+zone+"/disks")
+		require.Len(t, lists, 3)
+		for i, token := range []string{"", "2", "4"} {
+			require.Equal(t, token, lists[i].Query.Get("pageToken"))
+			require.Equal(t, "2", lists[i].Query.Get("maxResults"))
+			require.Equal(t, cleanup.FilterGKEVolumes, lists[i].Query.Get("filter"))
+			require.Contains(t, lists[i].FieldMask, "items(id,name,")
+		}
+		sets := f.served(http.MethodPost, "/setLabels")
+		require.Len(t, sets, 4)
+		for _, set := range sets {
+			require.NotEmpty(t, set.Query.Get("requestId"))
+		}
+	})
+
+	t.Run("mark dry run", func(t *testing.T) {
+		f := newFakeCompute(t)
+		f.addDisk("p", zone, gkeVolume("pvc-a", abandoned, nil))
+
+		require.NoError(t, run(t, f, "mark"))
+		require.NotContains(t, f.disk("p", zone, "pvc-a").GetLabels(), cleanup.LabelMarkedForDeletion)
+		require.Empty(t, f.served(http.MethodPost, ""))
+	})
+
+	t.Run("mark retries and fails on a changed fingerprint", func(t *testing.T) {
+		f := newFakeCompute(t)
+		f.addDisk("p", zone, gkeVolume("pvc-a", abandoned, nil))
+		f.addDisk("p", zone, gkeVolume("pvc-b", abandoned, nil))
+		f.fail(http.MethodPost, "/setLabels", 1, http.StatusServiceUnavailable, "backendError")
+		f.relabelAfterList("p", zone, "pvc-b", map[string]string{"goog-gke-volume": "", "team": "data"})
+
+		err := run(t, f, "mark", "--dry-run=false", "--max-retries=1")
+		require.EqualError(t, err, "1 of 2 disks failed")
+		require.Equal(t, ExitPartialFailure, ExitCode(err))
+		require.Contains(t, errors.Unwrap(err).Error(), "Error 412: Labels fingerprint either invalid or resource labels have changed")
+		require.Equal(t, today, f.disk("p", zone, "pvc-a").GetLabels()[cleanup.LabelMarkedForDeletion])
+		require.Equal(t, map[string]string{"goog-gke-volume": "", "team": "data"}, f.disk("p", zone, "pvc-b").GetLabels())
+
+		// the retry of the call that failed carries the same request ID
+		requestIDs := make(map[string]int)
+		for _, set := range f.served(http.MethodPost, "/setLabels") {
+			requestIDs[set.Query.Get("requestId")]++
+		}
+		counts := make([]int, 0, len(requestIDs))
+		for _, n := range requestIDs {
+			counts = append(counts, n)
+		}
+		require.ElementsMatch(t, []int{1, 2}, counts)
+	})
+
+	t.Run("cleanup snapshots and deletes", func(t *testing.T) {
+		f := newFakeCompute(t)
+		f.addDisk("p", zone, gkeVolume("pvc-a", abandoned, marked))
+		f.addDisk("p", zone, gkeVolume("pvc-recent", abandoned, map[string]string{cleanup.LabelMarkedForDeletion: today}))
+		attached := gkeVolume("pvc-attached", abandoned, marked)
+		attached.Users = []string{fakeComputeBase + "projects/p/zones/" + zone + "/instances/vm"}
+		f.addDisk("p", zone, attached)
+		f.addDisk("p", zone, gkeVolume("pvc-unmarked", abandoned, nil))
+		diskID := f.disk("p", zone, "pvc-a").GetId()
+
+		require.NoError(t, run(t, f, "cleanup", "--dry-run=false"))
+		require.Nil(t, f.disk("p", zone, "pvc-a"))
+		for _, name := range []string{"pvc-recent", "pvc-attached", "pvc-unmarked"} {
+			require.NotNil(t, f.disk("p", zone, name), name)
+		}
+		snapshots := f.snapshotsOf("p", zone, "pvc-a")
+		require.Len(t, snapshots, 1)
+		require.Equal(t, computepb.Snapshot_READY.String(), snapshots[0].GetStatus())
+		require.Equal(t, []string{"us-east1"}, snapshots[0].GetStorageLocations())
+		require.Equal(t, cleanup.CreatedBy, snapshots[0].GetLabels()[cleanup.LabelCreatedBy])
+		require.Equal(t, "2022-01-01", snapshots[0].GetLabels()[cleanup.LabelMarkedForDeletion])
+
+		lists := f.served(http.MethodGet, "/zones/"+zone+"/disks")
+		require.Len(t, lists, 1)
+		require.Equal(t, `(labels.marked-for-deletion:*) AND (labels.marked-for-deletion != "false")`, lists[0].Query.Get("filter"))
+		reused := f.served(http.MethodGet, "/global/snapshots")
+		require.Len(t, reused, 2, "listed to reuse a snapshot, then got to verify it")
+		require.Equal(t, `(sourceDiskId = "`+strconv.FormatUint(diskID, 10)+`") AND (labels.created-by = "gke-disk-cleanup")`, reused[0].Query.Get("filter"))
+		require.Len(t, f.served(http.MethodGet, "/zones/"+zone+"/operations/"), 2, "the snapshot and delete operations are polled")
+		deletes := f.served(http.MethodDelete, "/disks/pvc-a")
+		require.Len(t, deletes, 1)
+		require.NotEmpty(t, deletes[0].Query.Get("requestId"))
+	})
+
+	t.Run("cleanup certifies completed deletions only", func(t *testing.T) {
+		f := newFakeCompute(t)
+		f.addDisk("p", zone, gkeVolume("pvc-a", abandoned, marked))
+		diskID := f.disk("p", zone, "pvc-a").GetId()
+		f.failOperations("delete", "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE", "The disk resource is already being used")
+		store := t.TempDir()
+		keyFile := filepath.Join(t.TempDir(), "key")
+		require.NoError(t, os.WriteFile(keyFile, []byte("secret"), 0o600))
+		args := []string{"cleanup", "--dry-run=false", "--deletion-certificates=certificates", "--certificate-hmac-key-file=" + keyFile}
+
+		err := runIn(f, store, args...)
+		require.EqualError(t, err, "1 of 1 disks failed")
+		require.Contains(t, errors.Unwrap(err).Error(), "RESOURCE_IN_USE_BY_ANOTHER_RESOURCE")
+		require.NotNil(t, f.disk("p", zone, "pvc-a"))
+		require.NoDirExists(t, filepath.Join(store, "certificates"))
+
+		// a later run, after the request IDs of the failed one expired
+		f.mu.Lock()
+		delete(f.opErrors, "delete")
+		f.byRequestID = make(map[string]*fakeOperation)
+		f.mu.Unlock()
+		require.NoError(t, runIn(f, store, args...))
+		require.Nil(t, f.disk("p", zone, "pvc-a"))
+		data, err := os.ReadFile(filepath.Join(store, "certificates", "p", zone, "pvc-a-"+strconv.FormatUint(diskID, 10)+".json"))
+		require.NoError(t, err)
+		var signed certificate.Signed
+		require.NoError(t, json.Unmarshal(data, &signed))
+		var c certificate.Certificate
+		require.NoError(t, json.Unmarshal(signed.Certificate, &c))
+		snapshot := f.snapshotsOf("p", zone, "pvc-a")[0]
+		require.Equal(t, &certificate.Snapshot{
+			Name:     snapshot.GetName(),
+			ID:       strconv.FormatUint(snapshot.GetId(), 10),
+			SelfLink: snapshot.GetSelfLink(),
+			Created:  snapshot.GetCreationTimestamp(),
+		}, c.Snapshot)
+	})
+
+	t.Run("cleanup executes signed plans only", func(t *testing.T) {
+		f := newFakeCompute(t)
+		f.addDisk("p", zone, gkeVolume("pvc-a", abandoned, marked))
+		store := t.TempDir()
+		keys := t.TempDir()
+		keyFile, otherKeyFile := filepath.Join(keys, "key"), filepath.Join(keys, "other")
+		require.NoError(t, os.WriteFile(keyFile, []byte("secret"), 0o600))
+		require.NoError(t, os.WriteFile(otherKeyFile, []byte("other"), 0o600))
+
+		require.EqualError(t, runIn(f, store, "mark", "--plan-out=plan.json"), "--plan-out requires --plan-hmac-key-file or --plan-kms-key")
+		require.NoError(t, runIn(f, store, "mark", "--plan-out=plan.json", "--plan-hmac-key-file="+keyFile))
+
+		require.EqualError(t, runIn(f, store, "cleanup", "--dry-run=false", "--plan=plan.json"), "--plan requires --plan-hmac-key-file or --plan-kms-key")
+		err := runIn(f, store, "cleanup", "--dry-run=false", "--plan=plan.json", "--plan-hmac-key-file="+otherKeyFile)
+		require.ErrorContains(t, err, "verify signature of plan plan.json: signed by")
+		require.NotNil(t, f.disk("p", zone, "pvc-a"))
+		require.Empty(t, f.served(http.MethodDelete, ""))
+
+		require.NoError(t, runIn(f, store, "cleanup", "--dry-run=false", "--plan=plan.json", "--plan-hmac-key-file="+keyFile))
+		require.Nil(t, f.disk("p", zone, "pvc-a"))
+	})
+
+	t.Run("cleanup keeps disks whose snapshot failed", func(t *testing.T) {
+		f := newFakeCompute(t)
+		f.addDisk("p", zone, gkeVolume("pvc-a", abandoned, marked))
+		f.failOperations("createSnapshot", "QUOTA_EXCEEDED", "Quota 'SNAPSHOTS' exceeded.")
+
+		err := run(t, f, "cleanup", "--dry-run=false", "--verify-snapshot=false", "--reuse-snapshot-within=0")
+		require.EqualError(t, err, "1 of 1 disks failed")
+		require.Equal(t, ExitFailure, ExitCode(err))
+		require.Contains(t, errors.Unwrap(err).Error(), "QUOTA_EXCEEDED: Quota 'SNAPSHOTS' exceeded.")
+		require.NotNil(t, f.disk("p", zone, "pvc-a"))
+		require.Empty(t, f.served(http.MethodDelete, ""))
+	})
+
+	t.Run("cleanup archives and thaw recreates", func(t *testing.T) {
+		f := newFakeCompute(t)
+		f.addDisk("p", zone, gkeVolume("pvc-a", abandoned, map[string]string{cleanup.LabelMarkedForDeletion: "2022-01-01", "team": "data"}))
+		store := t.TempDir()
+
+		require.NoError(t, runIn(f, store, "cleanup", "--mode=archive", "--dry-run=false"))
+		require.Nil(t, f.disk("p", zone, "pvc-a"))
+		snapshots := f.snapshotsOf("p", zone, "pvc-a")
+		require.Len(t, snapshots, 1)
+		require.True(t, cleanup.IsArchive(snapshots[0]))
+
+		require.EqualError(t, runIn(f, store, "thaw", "pvc-b", "--dry-run=false"), "disk pvc-b of project p is not in the archive index archive-index.jsonl")
+		require.NoError(t, runIn(f, store, "thaw", "pvc-a", "--dry-run=false"))
+		thawed := f.disk("p", zone, "pvc-a")
+		require.NotNil(t, thawed)
+		require.Equal(t, snapshots[0].GetSelfLink(), thawed.GetSourceSnapshot())
+		require.Equal(t, int64(10), thawed.GetSizeGb())
+		require.Equal(t, "projects/p/zones/"+zone+"/diskTypes/pd-balanced", thawed.GetType())
+		require.Equal(t, map[string]string{"goog-gke-volume": "", "team": "data"}, thawed.GetLabels())
+		require.Len(t, f.served(http.MethodGet, "/global/snapshots/"+snapshots[0].GetName()), 2, "got to verify it, then to thaw it")
+	})
+
+	t.Run("unmark across all zones", func(t *testing.T) {
+		f := newFakeCompute(t)
+		f.addDisk("p", zone, gkeVolume("pvc-a", abandoned, marked))
+		f.addDisk("p", "us-east1-c", gkeVolume("pvc-b", abandoned, marked))
+		f.addDisk("p", "us-east1-c", gkeVolume("pvc-c", abandoned, marked))
+
+		require.NoError(t, run(t, f, "unmark", "pvc-b", "--all-zones", "--page-size=1", "--dry-run=false"))
+		require.Equal(t, "false", f.disk("p", "us-east1-c", "pvc-b").GetLabels()[cleanup.LabelMarkedForDeletion])
+		require.Equal(t, "2022-01-01", f.disk("p", zone, "pvc-a").GetLabels()[cleanup.LabelMarkedForDeletion])
+		require.Equal(t, "2022-01-01", f.disk("p", "us-east1-c", "pvc-c").GetLabels()[cleanup.LabelMarkedForDeletion])
+
+		lists := f.served(http.MethodGet, "/aggregated/disks")
+		require.Len(t, lists, 3)
+		require.Equal(t, "2", lists[2].Query.Get("pageToken"))
+		require.Contains(t, lists[0].FieldMask, "items/*/disks(id,name,")
+		sets := f.served(http.MethodPost, "/setLabels")
+		require.Len(t, sets, 1)
+		require.Contains(t, sets[0].Path, "/zones/us-east1-c/disks/")
+	})
+}
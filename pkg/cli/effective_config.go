@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/store"
+)
+
+// Where the value of a flag came from, in order of precedence.
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceConfig  = "config"
+	sourceDefault = "default"
+)
+
+// redacted replaces the value of secret flags.
+const redacted = "REDACTED"
+
+// secretFlags are the flags whose value is a credential. Flags naming a file
+// that holds a secret are kept, as the path is not secret.
+var secretFlags = map[string]bool{
+	// Slack and Teams webhook URLs authorize posting
+	"notify-webhook": true,
+}
+
+// effectiveConfig is the fully resolved configuration of a command, as
+// recorded at the start of every run so that it can be audited and
+// reproduced.
+type effectiveConfig struct {
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+	// Version is the module version of the binary, if known.
+	Version string `json:"version,omitempty"`
+	// Flags holds every flag of the command, by name.
+	Flags map[string]flagValue `json:"flags"`
+	// Files holds the SHA-256 of the files the flags refer to, such as the
+	// config file and the score model, by path.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// flagValue is the value of a flag and where it came from.
+type flagValue struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// changedFlags returns the names of the flags of cmd that are set.
+func changedFlags(cmd *cobra.Command) map[string]bool {
+	changed := make(map[string]bool)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		changed[f.Name] = true
+	})
+	return changed
+}
+
+// newEffectiveConfig returns the configuration of cmd, whose flags have been
+// set from the command line, the environment and the config file. fromFlags
+// and fromEnv are the flags set by the first two, as returned by
+// changedFlags. files are the paths of the files to record the hash of;
+// empty ones are left out.
+func newEffectiveConfig(cmd *cobra.Command, fromFlags, fromEnv map[string]bool, files ...string) effectiveConfig {
+	c := effectiveConfig{
+		Command: cmd.CommandPath(),
+		Time:    time.Now().UTC(),
+		Flags:   make(map[string]flagValue),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		c.Version = info.Main.Version
+	}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		v := flagValue{Value: redact(f.Name, f.Value.String()), Source: sourceDefault}
+		switch {
+		case fromFlags[f.Name]:
+			v.Source = sourceFlag
+		case fromEnv[f.Name]:
+			v.Source = sourceEnv
+		case f.Changed:
+			v.Source = sourceConfig
+		}
+		c.Flags[f.Name] = v
+	})
+	for _, path := range files {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("unable to hash file of the effective configuration")
+			continue
+		}
+		if c.Files == nil {
+			c.Files = make(map[string]string)
+		}
+		sum := sha256.Sum256(data)
+		c.Files[path] = hex.EncodeToString(sum[:])
+	}
+	return c
+}
+
+// redact returns value, the value of the flag name, without secrets: that
+// of a secret flag entirely, and the password of a URL.
+func redact(name, value string) string {
+	if secretFlags[name] && value != "" {
+		return redacted
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// log writes the flags that are not at their default to the log.
+func (c effectiveConfig) log() {
+	names := make([]string, 0, len(c.Flags))
+	for name, v := range c.Flags {
+		if v.Source != sourceDefault {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	set := zerolog.Dict()
+	for _, name := range names {
+		set = set.Str(name, c.Flags[name].Value)
+	}
+	log.Info().
+		Str("command", c.Command).
+		Str("version", c.Version).
+		Dict("flags", set).
+		Interface("files", c.Files).
+		Msg("effective configuration")
+}
+
+// record writes c as JSON to the store below prefix, named after the command
+// and the time.
+func (c effectiveConfig) record(ctx context.Context, s store.Store, prefix string) (string, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSuffix(prefix, "/") + "/" + strings.ReplaceAll(c.Command, " ", "-") + "-" + c.Time.Format("20060102T150405.000Z") + ".json"
+	if err := s.Put(ctx, key, data); err != nil {
+		return "", xerrors.Errorf("record effective configuration: %w", err)
+	}
+	return key, nil
+}
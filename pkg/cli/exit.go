@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// Exit codes of the command, as returned by ExitCode.
+const (
+	ExitOK = 0
+	// ExitFailure means the command failed as a whole, e.g. every project or
+	// every disk it tried to change failed, or its flags are invalid.
+	ExitFailure = 1
+	// ExitPartialFailure means some projects or more than --max-failures
+	// disks failed, while others succeeded.
+	ExitPartialFailure = 2
+	// ExitAuth means the command failed as a whole as credentials are
+	// missing or invalid, or permission was denied.
+	ExitAuth = 3
+	// ExitBudgetExhausted means a cleanup run stopped deleting disks once
+	// --max-deletions or --max-delete-gb was reached, leaving some behind.
+	ExitBudgetExhausted = 4
+)
+
+// exitError is an error with the exit code it should cause.
+type exitError struct {
+	code int
+	msg  string
+	// err is the cause, if any, e.g. the error of the first failed project.
+	err error
+}
+
+func (e *exitError) Error() string {
+	return e.msg
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// ExitCode returns the code the command should exit with after returning
+// err.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	code := ExitFailure
+	var e *exitError
+	if errors.As(err, &e) {
+		code = e.code
+	}
+	if code == ExitFailure && isAuthError(err) {
+		return ExitAuth
+	}
+	return code
+}
+
+// isAuthError reports whether err is caused by missing or invalid
+// credentials, or a lack of permission. A 403 for exceeding a quota or rate
+// limit is not.
+func isAuthError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return diskerr.Classify(err).Category == diskerr.CategoryPermission
+	}
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		code := grpcErr.GRPCStatus().Code()
+		return code == codes.Unauthenticated || code == codes.PermissionDenied
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return true
+	}
+	// google.FindDefaultCredentials returns an untyped error
+	return strings.Contains(err.Error(), "could not find default credentials")
+}
+
+// failuresError returns an error if more than maxFailures disks failed in the
+// run summarized by s, wrapping the first failure. It causes ExitFailure, or
+// ExitAuth for lack of permission, if no disk was changed or snapshotted, and
+// ExitPartialFailure otherwise. A negative maxFailures tolerates any number.
+func (s *runSummary) failuresError(maxFailures int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maxFailures < 0 || s.Failed <= maxFailures {
+		return nil
+	}
+	e := &exitError{
+		code: ExitPartialFailure,
+		msg:  fmt.Sprintf("%d of %d disks failed", s.Failed, s.Scanned),
+		err:  s.firstFailure,
+	}
+	if s.Marked+s.Unmarked+s.Snapshotted+s.Deleted == 0 {
+		e.code = ExitFailure
+	}
+	return e
+}
+
+// budgetError returns an error causing ExitBudgetExhausted if budget was
+// exhausted, and logs the disks that remain to be deleted.
+func budgetError(budget *cleanup.DeletionBudget) error {
+	if budget == nil || !budget.Exhausted() {
+		return nil
+	}
+	deleted, deletedGB := budget.Used()
+	remaining, remainingGB := budget.Remaining()
+	log.Warn().
+		Int("deleted", deleted).
+		Int64("deletedGB", deletedGB).
+		Int("remaining", remaining).
+		Int64("remainingGB", remainingGB).
+		Msg("deletion budget exhausted, stopped deleting disks")
+	return &exitError{
+		code: ExitBudgetExhausted,
+		msg:  fmt.Sprintf("deletion budget exhausted after %d disks and %d GB, %d disks and %d GB remain", deleted, deletedGB, remaining, remainingGB),
+	}
+}
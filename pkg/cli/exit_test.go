@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/googleapi"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_ExitCode(t *testing.T) {
+	t.Parallel()
+
+	forbidden := &googleapi.Error{Code: 403, Message: "Required 'compute.disks.list' permission"}
+	for _, tt := range []struct {
+		name   string
+		err    error
+		expect int
+	}{
+		{name: "success", expect: ExitOK},
+		{name: "error", err: xerrors.New("--zone is required"), expect: ExitFailure},
+		{name: "forbidden", err: xerrors.Errorf("list disks: %w", forbidden), expect: ExitAuth},
+		{name: "unauthenticated", err: xerrors.Errorf("list disks: %w", status.Error(codes.Unauthenticated, "invalid token")), expect: ExitAuth},
+		{name: "no credentials", err: xerrors.New("init disks client: google: could not find default credentials"), expect: ExitAuth},
+		{name: "permission denied", err: xerrors.Errorf("list disks: %w", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}), expect: ExitAuth},
+		{name: "quota exceeded", err: xerrors.Errorf("list disks: %w", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}), expect: ExitFailure},
+		{name: "rate limit exceeded", err: xerrors.Errorf("list disks: %w", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}), expect: ExitFailure},
+		{name: "not found", err: xerrors.Errorf("list disks: %w", &googleapi.Error{Code: 404}), expect: ExitFailure},
+		{name: "partial", err: &exitError{code: ExitPartialFailure, msg: "1 of 2 projects failed: b", err: forbidden}, expect: ExitPartialFailure},
+		{name: "total", err: &exitError{code: ExitFailure, msg: "2 of 2 projects failed: a, b", err: forbidden}, expect: ExitAuth},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.expect, ExitCode(tt.err))
+		})
+	}
+}
+
+func Test_FailuresError(t *testing.T) {
+	t.Parallel()
+
+	disk := &computepb.Disk{Name: pointer.String("test-disk")}
+	forbidden := diskerr.Wrap(diskerr.CodeAPI, &googleapi.Error{Code: 403}, "error updating disk labels")
+	marked := events.Event{Type: events.DiskProcessed, Disk: disk, Action: string(cleanup.ActionMark)}
+	failed := events.Event{Type: events.DiskProcessed, Disk: disk, Action: string(cleanup.ActionMark), Err: forbidden}
+
+	s := &runSummary{}
+	s.handle(marked)
+	require.NoError(t, s.failuresError(0))
+	s.handle(failed)
+	s.handle(failed)
+	require.NoError(t, s.failuresError(2))
+	require.NoError(t, s.failuresError(-1))
+	err := s.failuresError(1)
+	require.EqualError(t, err, "2 of 3 disks failed")
+	require.Equal(t, ExitPartialFailure, ExitCode(err))
+
+	s.reset(nil)
+	s.handle(failed)
+	err = s.failuresError(0)
+	require.EqualError(t, err, "1 of 1 disks failed")
+	require.Equal(t, ExitAuth, ExitCode(err), "no disk was changed for lack of permission")
+}
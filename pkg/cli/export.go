@@ -0,0 +1,236 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	cloudbuild "google.golang.org/api/cloudbuild/v1"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// imageExportBuilder is the Cloud Build step exporting an image to Cloud
+// Storage, as run by gcloud compute images export.
+const imageExportBuilder = "gcr.io/compute-image-tools/gce_vm_image_export:release"
+
+// exportPollInterval is how often the build exporting a disk is polled.
+const exportPollInterval = 15 * time.Second
+
+// exportPermissions are the IAM permissions exporting disks needs in every
+// project, besides those of cleanup. The Cloud Build service account of the
+// project also needs roles/compute.admin, roles/iam.serviceAccountUser and
+// write access to the bucket.
+var exportPermissions = []string{"compute.images.create", "compute.images.delete", "compute.images.get", "compute.disks.useReadOnly", "cloudbuild.builds.create", "cloudbuild.builds.get"}
+
+// imageExportAPI is an interface for the Compute Engine, Cloud Build and
+// Cloud Storage calls we use to export disks.
+type imageExportAPI interface {
+	// CreateImage creates image in projectID from the disk sourceDisk, a
+	// URL, and waits for it to be ready. An image that exists already, e.g.
+	// from an interrupted run, is kept.
+	CreateImage(ctx context.Context, projectID, image, sourceDisk string) error
+	// ExportImage exports image in projectID to the Cloud Storage object
+	// uri, running the export workflow in zone, and waits for it to
+	// complete within timeout.
+	ExportImage(ctx context.Context, projectID, image, zone, uri string, timeout time.Duration) error
+	// DeleteImage deletes image in projectID.
+	DeleteImage(ctx context.Context, projectID, image string) error
+	// Object returns the size and checksums of the object uri.
+	Object(ctx context.Context, uri string) (*events.Export, error)
+}
+
+//go:generate moq -fmt goimports -out mock_image_export_api.go . imageExportAPI
+
+// diskExporter implements cleanup.Exporter by creating an image of a disk
+// and exporting it as a gzipped tarball with the image export workflow, as
+// gcloud compute images export does, then deleting the image.
+type diskExporter struct {
+	api imageExportAPI
+	// bucket and prefix are where disks are exported to.
+	bucket, prefix string
+	timeout        time.Duration
+}
+
+// newDiskExporter returns a diskExporter exporting to location, a gs:// URL
+// of a bucket optionally followed by a prefix, e.g. gs://my-bucket/disks.
+func newDiskExporter(api imageExportAPI, location string, timeout time.Duration) (*diskExporter, error) {
+	if !strings.HasPrefix(location, "gs://") {
+		return nil, xerrors.Errorf("invalid export location %q: expected gs://bucket or gs://bucket/prefix", location)
+	}
+	location = strings.TrimPrefix(location, "gs://")
+	bucket, prefix := location, ""
+	if i := strings.Index(location, "/"); i >= 0 {
+		bucket, prefix = location[:i], strings.Trim(location[i+1:], "/")
+	}
+	if bucket == "" {
+		return nil, xerrors.Errorf("invalid export location %q: expected gs://bucket or gs://bucket/prefix", location)
+	}
+	return &diskExporter{api: api, bucket: bucket, prefix: prefix, timeout: timeout}, nil
+}
+
+// exportImageName returns the name of the image disk is exported through,
+// which is the same for the same disk.
+func exportImageName(disk *computepb.Disk) string {
+	return fmt.Sprintf("gke-disk-cleanup-export-%d", disk.GetId())
+}
+
+// objectURI returns the object disk is exported to, e.g.
+// gs://bucket/prefix/project/zone/disk-123.tar.gz. The ID tells apart disks
+// of the same name created and deleted at different times.
+func (e *diskExporter) objectURI(projectID, zone string, disk *computepb.Disk) string {
+	name := fmt.Sprintf("%s-%d.tar.gz", disk.GetName(), disk.GetId())
+	return "gs://" + e.bucket + "/" + path.Join(e.prefix, projectID, zone, name)
+}
+
+func (e *diskExporter) Export(ctx context.Context, projectID, zone string, disk *computepb.Disk) (*events.Export, error) {
+	image := exportImageName(disk)
+	uri := e.objectURI(projectID, zone, disk)
+	if err := e.api.CreateImage(ctx, projectID, image, disk.GetSelfLink()); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := e.api.DeleteImage(ctx, projectID, image); err != nil {
+			log.Warn().Err(err).Str("projectID", projectID).Str("image", image).Msg("unable to delete the image a disk was exported through, delete it by hand")
+		}
+	}()
+	if err := e.api.ExportImage(ctx, projectID, image, zone, uri, e.timeout); err != nil {
+		return nil, err
+	}
+	export, err := e.api.Object(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if export.SizeBytes == 0 {
+		return nil, xerrors.Errorf("export %s is empty", uri)
+	}
+	return export, nil
+}
+
+// gcpImageExport implements imageExportAPI with the Compute Engine, Cloud
+// Build and Cloud Storage APIs.
+type gcpImageExport struct {
+	images *computev1.ImagesClient
+	builds *cloudbuild.Service
+	gcs    *storage.Service
+}
+
+func newImageExportAPI(ctx context.Context, opts ...option.ClientOption) (*gcpImageExport, error) {
+	images, err := computev1.NewImagesRESTClient(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init images client: %w", err)
+	}
+	builds, err := cloudbuild.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init cloud build client: %w", err)
+	}
+	gcs, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init storage client: %w", err)
+	}
+	return &gcpImageExport{images: images, builds: builds, gcs: gcs}, nil
+}
+
+// Close closes the images client.
+func (g *gcpImageExport) Close() error {
+	return g.images.Close()
+}
+
+func (g *gcpImageExport) CreateImage(ctx context.Context, projectID, image, sourceDisk string) error {
+	if _, err := g.images.Get(ctx, &computepb.GetImageRequest{Project: projectID, Image: image}); err == nil {
+		return nil
+	}
+	op, err := g.images.Insert(ctx, &computepb.InsertImageRequest{
+		Project: projectID,
+		ImageResource: &computepb.Image{
+			Name:       pointer.String(image),
+			SourceDisk: pointer.String(sourceDisk),
+			Labels:     map[string]string{cleanup.LabelCreatedBy: cleanup.CreatedBy},
+		},
+	})
+	if err != nil {
+		return xerrors.Errorf("create image %s: %w", image, err)
+	}
+	if err := cleanup.WaitOperation(ctx, op); err != nil {
+		return xerrors.Errorf("create image %s: %w", image, err)
+	}
+	return nil
+}
+
+func (g *gcpImageExport) ExportImage(ctx context.Context, projectID, image, zone, uri string, timeout time.Duration) error {
+	op, err := g.builds.Projects.Builds.Create(projectID, &cloudbuild.Build{
+		Steps: []*cloudbuild.BuildStep{{
+			Name: imageExportBuilder,
+			Args: []string{
+				"-client_id=gke-disk-cleanup",
+				"-source_image=projects/" + projectID + "/global/images/" + image,
+				"-destination_uri=" + uri,
+				"-zone=" + zone,
+				// leave the build time to clean up
+				fmt.Sprintf("-timeout=%ds", int64(timeout.Seconds()*0.9)),
+			},
+		}},
+		Tags:    []string{"gce-daisy", "gce-daisy-image-export"},
+		Timeout: fmt.Sprintf("%ds", int64(timeout.Seconds())),
+	}).Context(ctx).Do()
+	if err != nil {
+		return xerrors.Errorf("start export of image %s: %w", image, err)
+	}
+	var metadata cloudbuild.BuildOperationMetadata
+	if err := json.Unmarshal(op.Metadata, &metadata); err != nil || metadata.Build == nil {
+		return xerrors.Errorf("start export of image %s: no build in operation %s", image, op.Name)
+	}
+	id := metadata.Build.Id
+	log.Debug().Str("projectID", projectID).Str("image", image).Str("build", id).Str("logURL", metadata.Build.LogUrl).Msg("exporting image")
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		build, err := g.builds.Projects.Builds.Get(projectID, id).Context(ctx).Do()
+		if err != nil {
+			return xerrors.Errorf("get build %s exporting image %s: %w", id, image, err)
+		}
+		switch build.Status {
+		case "SUCCESS":
+			return nil
+		case "FAILURE", "INTERNAL_ERROR", "TIMEOUT", "CANCELLED", "EXPIRED":
+			return xerrors.Errorf("build %s exporting image %s: %s %s, see %s", id, image, build.Status, build.StatusDetail, build.LogUrl)
+		}
+	}
+}
+
+func (g *gcpImageExport) DeleteImage(ctx context.Context, projectID, image string) error {
+	op, err := g.images.Delete(ctx, &computepb.DeleteImageRequest{Project: projectID, Image: image})
+	if err != nil {
+		return xerrors.Errorf("delete image %s: %w", image, err)
+	}
+	return cleanup.WaitOperation(ctx, op)
+}
+
+func (g *gcpImageExport) Object(ctx context.Context, uri string) (*events.Export, error) {
+	name := strings.TrimPrefix(uri, "gs://")
+	i := strings.Index(name, "/")
+	if i < 0 {
+		return nil, xerrors.Errorf("invalid export object %q", uri)
+	}
+	obj, err := g.gcs.Objects.Get(name[:i], name[i+1:]).Context(ctx).Do()
+	if err != nil {
+		return nil, xerrors.Errorf("get export %s: %w", uri, err)
+	}
+	return &events.Export{URI: uri, SizeBytes: int64(obj.Size), MD5: obj.Md5Hash, CRC32C: obj.Crc32c}, nil
+}
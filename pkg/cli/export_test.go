@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_newDiskExporter(t *testing.T) {
+	t.Parallel()
+
+	disk := &computepb.Disk{Name: pointer.String("pvc-a"), Id: proto.Uint64(42)}
+	for location, want := range map[string]string{
+		"gs://bucket":             "gs://bucket/testing/us-east1-b/pvc-a-42.tar.gz",
+		"gs://bucket/":            "gs://bucket/testing/us-east1-b/pvc-a-42.tar.gz",
+		"gs://bucket/disks/2022/": "gs://bucket/disks/2022/testing/us-east1-b/pvc-a-42.tar.gz",
+	} {
+		e, err := newDiskExporter(nil, location, time.Hour)
+		require.NoError(t, err, location)
+		require.Equal(t, want, e.objectURI("testing", "us-east1-b", disk), location)
+	}
+	for _, location := range []string{"bucket", "gs://", "gs:///disks"} {
+		_, err := newDiskExporter(nil, location, time.Hour)
+		require.Error(t, err, location)
+	}
+}
+
+func Test_diskExporter(t *testing.T) {
+	t.Parallel()
+
+	disk := &computepb.Disk{
+		Name:     pointer.String("pvc-a"),
+		Id:       proto.Uint64(42),
+		SelfLink: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/disks/pvc-a"),
+	}
+	const uri = "gs://bucket/disks/testing/us-east1-b/pvc-a-42.tar.gz"
+	newAPI := func() *imageExportAPIMock {
+		return &imageExportAPIMock{
+			CreateImageFunc: func(ctx context.Context, projectID, image, sourceDisk string) error {
+				require.Equal(t, "testing", projectID)
+				require.Equal(t, "gke-disk-cleanup-export-42", image)
+				require.Equal(t, disk.GetSelfLink(), sourceDisk)
+				return nil
+			},
+			ExportImageFunc: func(ctx context.Context, projectID, image, zone, gotURI string, timeout time.Duration) error {
+				require.Equal(t, "gke-disk-cleanup-export-42", image)
+				require.Equal(t, "us-east1-b", zone)
+				require.Equal(t, uri, gotURI)
+				require.Equal(t, time.Hour, timeout)
+				return nil
+			},
+			DeleteImageFunc: func(ctx context.Context, projectID, image string) error {
+				return nil
+			},
+			ObjectFunc: func(ctx context.Context, gotURI string) (*events.Export, error) {
+				return &events.Export{URI: gotURI, SizeBytes: 1 << 20, MD5: "md5", CRC32C: "crc32c"}, nil
+			},
+		}
+	}
+	export := func(api imageExportAPI) (*events.Export, error) {
+		e, err := newDiskExporter(api, "gs://bucket/disks", time.Hour)
+		require.NoError(t, err)
+		return e.Export(context.Background(), "testing", "us-east1-b", disk)
+	}
+
+	t.Run("exports and deletes the image", func(t *testing.T) {
+		t.Parallel()
+		api := newAPI()
+		exported, err := export(api)
+		require.NoError(t, err)
+		require.Equal(t, &events.Export{URI: uri, SizeBytes: 1 << 20, MD5: "md5", CRC32C: "crc32c"}, exported)
+		require.Len(t, api.DeleteImageCalls(), 1)
+		require.Equal(t, "gke-disk-cleanup-export-42", api.DeleteImageCalls()[0].Image)
+	})
+
+	t.Run("deletes the image of a failed export", func(t *testing.T) {
+		t.Parallel()
+		api := newAPI()
+		api.ExportImageFunc = func(ctx context.Context, projectID, image, zone, uri string, timeout time.Duration) error {
+			return xerrors.New("build failed")
+		}
+		_, err := export(api)
+		require.EqualError(t, err, "build failed")
+		require.Len(t, api.DeleteImageCalls(), 1)
+		require.Empty(t, api.ObjectCalls())
+	})
+
+	t.Run("image not created", func(t *testing.T) {
+		t.Parallel()
+		api := newAPI()
+		api.CreateImageFunc = func(ctx context.Context, projectID, image, sourceDisk string) error {
+			return xerrors.New("quota exceeded")
+		}
+		_, err := export(api)
+		require.EqualError(t, err, "quota exceeded")
+		require.Empty(t, api.ExportImageCalls())
+		require.Empty(t, api.DeleteImageCalls())
+	})
+
+	t.Run("empty object", func(t *testing.T) {
+		t.Parallel()
+		api := newAPI()
+		api.ObjectFunc = func(ctx context.Context, uri string) (*events.Export, error) {
+			return &events.Export{URI: uri}, nil
+		}
+		_, err := export(api)
+		require.EqualError(t, err, "export "+uri+" is empty")
+	})
+}
@@ -0,0 +1,571 @@
+package cli
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/utils/pointer"
+)
+
+// fakeComputeBase is the base URL of the resources of the fake, as in the
+// self links of the real API.
+const fakeComputeBase = "https://www.googleapis.com/compute/v1/"
+
+// fakeCompute is a fake of the Compute REST API serving the disk, snapshot
+// and zone operation calls of mark, cleanup and unmark from memory. Unlike
+// the mocks of the DisksClient, it decodes the requests as the API does, so
+// that tests of the commands catch mistakes in how they are encoded.
+type fakeCompute struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu         sync.Mutex
+	disks      map[string]*computepb.Disk
+	snapshots  map[string]*computepb.Snapshot
+	operations map[string]*fakeOperation
+	// byRequestID holds the operation started by each request ID, to
+	// deduplicate retried requests as the API does.
+	byRequestID map[string]*fakeOperation
+	// failures are the errors the next matching requests fail with.
+	failures []fakeFailure
+	// opErrors are the errors operations of a type complete with.
+	opErrors map[string]*computepb.Error
+	// afterList is called after serving a page of disks, with mu held.
+	afterList func()
+	requests  []fakeRequest
+	nextID    uint64
+}
+
+// fakeRequest is a request served by a fakeCompute.
+type fakeRequest struct {
+	Method    string
+	Path      string
+	Query     url.Values
+	FieldMask string
+}
+
+// fakeOperation is an operation of a fakeCompute, which is done once polled.
+type fakeOperation struct {
+	op *computepb.Operation
+	// done applies what remains of the operation once it completes.
+	done func(failed bool)
+}
+
+// fakeFailure fails the next count requests of method to a path ending in
+// suffix with an API error.
+type fakeFailure struct {
+	method, suffix string
+	count          int
+	code           int
+	reason         string
+}
+
+func newFakeCompute(t *testing.T) *fakeCompute {
+	f := &fakeCompute{
+		t:           t,
+		disks:       make(map[string]*computepb.Disk),
+		snapshots:   make(map[string]*computepb.Snapshot),
+		operations:  make(map[string]*fakeOperation),
+		byRequestID: make(map[string]*fakeOperation),
+		opErrors:    make(map[string]*computepb.Error),
+		nextID:      1000,
+	}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// clientOptions point the API clients at f.
+func (f *fakeCompute) clientOptions() []option.ClientOption {
+	return []option.ClientOption{option.WithEndpoint(f.srv.URL), option.WithoutAuthentication()}
+}
+
+// addDisk adds disk to zone of project, filling in its ID, zone, self link
+// and label fingerprint.
+func (f *fakeCompute) addDisk(project, zone string, disk *computepb.Disk) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	disk.Id = proto.Uint64(f.nextID)
+	disk.Zone = pointer.String(fakeComputeBase + "projects/" + project + "/zones/" + zone)
+	disk.SelfLink = pointer.String(disk.GetZone() + "/disks/" + disk.GetName())
+	if disk.Status == nil {
+		disk.Status = pointer.String(computepb.Disk_READY.String())
+	}
+	if disk.CreationTimestamp == nil {
+		disk.CreationTimestamp = pointer.String(time.Now().AddDate(0, -6, 0).Format(time.RFC3339))
+	}
+	f.setLabels(disk, disk.GetLabels())
+	f.disks[diskKey(project, zone, disk.GetName())] = disk
+}
+
+// disk returns a copy of the disk of project in zone, nil if there is none.
+func (f *fakeCompute) disk(project, zone, name string) *computepb.Disk {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if disk, ok := f.disks[diskKey(project, zone, name)]; ok {
+		return proto.Clone(disk).(*computepb.Disk)
+	}
+	return nil
+}
+
+// relabelAfterList changes the labels of a disk once it was listed, as
+// another tool would between the list and the change of a command.
+func (f *fakeCompute) relabelAfterList(project, zone, name string, labels map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.afterList = func() {
+		f.setLabels(f.disks[diskKey(project, zone, name)], labels)
+		f.afterList = nil
+	}
+}
+
+// snapshotsOf returns copies of the snapshots of the disk of project in zone.
+func (f *fakeCompute) snapshotsOf(project, zone, disk string) []*computepb.Snapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var snapshots []*computepb.Snapshot
+	for _, snapshot := range f.snapshots {
+		if snapshot.GetSourceDisk() == fakeComputeBase+"projects/"+project+"/zones/"+zone+"/disks/"+disk {
+			snapshots = append(snapshots, proto.Clone(snapshot).(*computepb.Snapshot))
+		}
+	}
+	return snapshots
+}
+
+// fail makes the next count requests of method to a path ending in suffix
+// fail with code and reason.
+func (f *fakeCompute) fail(method, suffix string, count, code int, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, fakeFailure{method: method, suffix: suffix, count: count, code: code, reason: reason})
+}
+
+// failOperations makes the operations of opType complete with an error of
+// code.
+func (f *fakeCompute) failOperations(opType, code, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opErrors[opType] = &computepb.Error{Errors: []*computepb.Errors{{Code: pointer.String(code), Message: pointer.String(message)}}}
+}
+
+// served returns the requests served of method to a path containing part.
+func (f *fakeCompute) served(method, part string) []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var served []fakeRequest
+	for _, r := range f.requests {
+		if r.Method == method && strings.Contains(r.Path, part) {
+			served = append(served, r)
+		}
+	}
+	return served
+}
+
+func diskKey(project, zone, name string) string {
+	return project + "/" + zone + "/" + name
+}
+
+// setLabels sets the labels of disk and a new fingerprint, as every change
+// of the labels does.
+func (f *fakeCompute) setLabels(disk *computepb.Disk, labels map[string]string) {
+	f.nextID++
+	disk.Labels = labels
+	disk.LabelFingerprint = pointer.String(base64.StdEncoding.EncodeToString([]byte(strconv.FormatUint(f.nextID, 10))))
+}
+
+var (
+	fakeProjectPath  = regexp.MustCompile(`^/compute/v1/projects/([^/]+)/(.+)$`)
+	fakeFilterClause = regexp.MustCompile(`^(labels\.)?([\w.-]+)\s*(:|=|!=)\s*(\*|"[^"]*")$`)
+)
+
+func (f *fakeCompute) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, fakeRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), FieldMask: r.Header.Get("X-Goog-Fieldmask")})
+	for i := range f.failures {
+		failure := &f.failures[i]
+		if failure.count > 0 && failure.method == r.Method && strings.HasSuffix(r.URL.Path, failure.suffix) {
+			failure.count--
+			f.error(w, failure.code, failure.reason, "injected failure")
+			return
+		}
+	}
+	m := fakeProjectPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		f.error(w, http.StatusNotFound, "notFound", "unknown path "+r.URL.Path)
+		return
+	}
+	project, parts := m[1], strings.Split(m[2], "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "zones" && parts[2] == "disks":
+		f.listDisks(w, r, project, parts[1])
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "aggregated" && parts[1] == "disks":
+		f.listDisks(w, r, project, "")
+	case r.Method == http.MethodPost && len(parts) == 5 && parts[0] == "zones" && parts[2] == "disks" && parts[4] == "setLabels":
+		f.setDiskLabels(w, r, project, parts[1], parts[3])
+	case r.Method == http.MethodPost && len(parts) == 5 && parts[0] == "zones" && parts[2] == "disks" && parts[4] == "createSnapshot":
+		f.createSnapshot(w, r, project, parts[1], parts[3])
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "zones" && parts[2] == "disks":
+		f.insertDisk(w, r, project, parts[1])
+	case r.Method == http.MethodDelete && len(parts) == 4 && parts[0] == "zones" && parts[2] == "disks":
+		f.deleteDisk(w, r, project, parts[1], parts[3])
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[0] == "zones" && parts[2] == "operations":
+		f.getOperation(w, project, parts[1], parts[3])
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "global" && parts[1] == "snapshots":
+		f.listSnapshots(w, r, project)
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "global" && parts[1] == "snapshots":
+		snapshot, ok := f.snapshots[project+"/"+parts[2]]
+		if !ok {
+			f.error(w, http.StatusNotFound, "notFound", "snapshot "+parts[2]+" not found")
+			return
+		}
+		f.reply(w, snapshot)
+	default:
+		f.error(w, http.StatusNotFound, "notFound", fmt.Sprintf("unknown call %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// listDisks serves a page of the disks of zone, or of every zone if empty,
+// matching the filter of r, as a DiskList or DiskAggregatedList.
+func (f *fakeCompute) listDisks(w http.ResponseWriter, r *http.Request, project, zone string) {
+	var disks []*computepb.Disk
+	for key, disk := range f.disks {
+		if !strings.HasPrefix(key, project+"/") || (zone != "" && !strings.HasPrefix(key, project+"/"+zone+"/")) {
+			continue
+		}
+		ok, err := matchFilter(r.URL.Query().Get("filter"), disk.GetLabels(), nil)
+		if err != nil {
+			f.error(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		if ok {
+			disks = append(disks, disk)
+		}
+	}
+	sort.Slice(disks, func(i, j int) bool { return disks[i].GetSelfLink() < disks[j].GetSelfLink() })
+	page, next, err := fakePage(r.URL.Query(), len(disks))
+	if err != nil {
+		f.error(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	disks = disks[page[0]:page[1]]
+	if f.afterList != nil {
+		defer f.afterList()
+	}
+	if zone != "" {
+		f.reply(w, &computepb.DiskList{Items: disks, NextPageToken: next})
+		return
+	}
+	items := make(map[string]*computepb.DisksScopedList)
+	for _, disk := range disks {
+		scope := "zones/" + disk.GetZone()[strings.LastIndex(disk.GetZone(), "/")+1:]
+		if items[scope] == nil {
+			items[scope] = &computepb.DisksScopedList{}
+		}
+		items[scope].Disks = append(items[scope].Disks, disk)
+	}
+	f.reply(w, &computepb.DiskAggregatedList{Items: items, NextPageToken: next})
+}
+
+// fakePage returns the bounds of the page of n items requested by query,
+// and the token of the next page, if any. Pages hold up to maxResults items,
+// or 500 as by default.
+func fakePage(query url.Values, n int) ([2]int, *string, error) {
+	size, start := 500, 0
+	if s := query.Get("maxResults"); s != "" {
+		var err error
+		if size, err = strconv.Atoi(s); err != nil || size < 1 || size > 500 {
+			return [2]int{}, nil, fmt.Errorf("invalid maxResults %q", s)
+		}
+	}
+	if token := query.Get("pageToken"); token != "" {
+		var err error
+		if start, err = strconv.Atoi(token); err != nil || start > n {
+			return [2]int{}, nil, fmt.Errorf("invalid pageToken %q", token)
+		}
+	}
+	end := start + size
+	if end >= n {
+		return [2]int{start, n}, nil, nil
+	}
+	return [2]int{start, end}, pointer.String(strconv.Itoa(end)), nil
+}
+
+// matchFilter reports whether a resource with labels and fields matches
+// filter, of which it knows the clauses used by the commands: has, equals
+// and not equals, joined with AND.
+func matchFilter(filter string, labels, fields map[string]string) (bool, error) {
+	if filter == "" {
+		return true, nil
+	}
+	for _, clause := range strings.Split(filter, " AND ") {
+		clause = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(clause), "("), ")")
+		m := fakeFilterClause.FindStringSubmatch(clause)
+		if m == nil {
+			return false, fmt.Errorf("invalid filter clause %q", clause)
+		}
+		values := fields
+		if m[1] != "" {
+			values = labels
+		}
+		value, ok := values[m[2]]
+		var match bool
+		switch m[3] {
+		case ":":
+			if m[4] != "*" {
+				return false, fmt.Errorf("invalid filter clause %q", clause)
+			}
+			match = ok
+		case "=":
+			match = ok && `"`+value+`"` == m[4]
+		case "!=":
+			match = !ok || `"`+value+`"` != m[4]
+		}
+		if !match {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// setDiskLabels sets the labels of a disk, given by ID as mark does or by
+// name, if the request carries its current fingerprint.
+func (f *fakeCompute) setDiskLabels(w http.ResponseWriter, r *http.Request, project, zone, resource string) {
+	req := &computepb.ZoneSetLabelsRequest{}
+	if !f.decode(w, r, req) {
+		return
+	}
+	disk := f.findDisk(project, zone, resource)
+	if disk == nil {
+		f.error(w, http.StatusNotFound, "notFound", "disk "+resource+" not found")
+		return
+	}
+	f.start(w, r, project, zone, "setLabels", disk.GetSelfLink(), func() bool {
+		if req.GetLabelFingerprint() != disk.GetLabelFingerprint() {
+			f.error(w, http.StatusPreconditionFailed, "conditionNotMet", "Labels fingerprint either invalid or resource labels have changed")
+			return false
+		}
+		f.setLabels(disk, req.GetLabels())
+		return true
+	}, nil)
+}
+
+// createSnapshot starts snapshotting a disk. The snapshot is ready once the
+// operation is polled.
+func (f *fakeCompute) createSnapshot(w http.ResponseWriter, r *http.Request, project, zone, name string) {
+	snapshot := &computepb.Snapshot{}
+	if !f.decode(w, r, snapshot) {
+		return
+	}
+	disk := f.findDisk(project, zone, name)
+	if disk == nil {
+		f.error(w, http.StatusNotFound, "notFound", "disk "+name+" not found")
+		return
+	}
+	key := project + "/" + snapshot.GetName()
+	f.start(w, r, project, zone, "createSnapshot", disk.GetSelfLink(), func() bool {
+		if _, ok := f.snapshots[key]; ok {
+			f.error(w, http.StatusConflict, "alreadyExists", "snapshot "+snapshot.GetName()+" already exists")
+			return false
+		}
+		f.nextID++
+		snapshot.Id = proto.Uint64(f.nextID)
+		snapshot.SelfLink = pointer.String(fakeComputeBase + "projects/" + project + "/global/snapshots/" + snapshot.GetName())
+		snapshot.SourceDisk = disk.SelfLink
+		snapshot.SourceDiskId = pointer.String(strconv.FormatUint(disk.GetId(), 10))
+		snapshot.DiskSizeGb = disk.SizeGb
+		snapshot.CreationTimestamp = pointer.String(time.Now().Format(time.RFC3339))
+		snapshot.Status = pointer.String(computepb.Snapshot_CREATING.String())
+		f.snapshots[key] = snapshot
+		return true
+	}, func(failed bool) {
+		if failed {
+			snapshot.Status = pointer.String(computepb.Snapshot_FAILED.String())
+			return
+		}
+		snapshot.Status = pointer.String(computepb.Snapshot_READY.String())
+	})
+}
+
+// insertDisk creates a disk, e.g. restored from a snapshot, unless one of its
+// name exists.
+func (f *fakeCompute) insertDisk(w http.ResponseWriter, r *http.Request, project, zone string) {
+	disk := &computepb.Disk{}
+	if !f.decode(w, r, disk) {
+		return
+	}
+	key := diskKey(project, zone, disk.GetName())
+	f.start(w, r, project, zone, "insert", fakeComputeBase+"projects/"+project+"/zones/"+zone+"/disks/"+disk.GetName(), func() bool {
+		if _, ok := f.disks[key]; ok {
+			f.error(w, http.StatusConflict, "alreadyExists", "disk "+disk.GetName()+" already exists")
+			return false
+		}
+		f.nextID++
+		disk.Id = proto.Uint64(f.nextID)
+		disk.Zone = pointer.String(fakeComputeBase + "projects/" + project + "/zones/" + zone)
+		disk.SelfLink = pointer.String(disk.GetZone() + "/disks/" + disk.GetName())
+		disk.Status = pointer.String(computepb.Disk_READY.String())
+		disk.CreationTimestamp = pointer.String(time.Now().Format(time.RFC3339))
+		f.setLabels(disk, disk.GetLabels())
+		f.disks[key] = disk
+		return true
+	}, nil)
+}
+
+// deleteDisk deletes a disk unless it is attached, once the operation
+// completes without an error.
+func (f *fakeCompute) deleteDisk(w http.ResponseWriter, r *http.Request, project, zone, name string) {
+	disk := f.findDisk(project, zone, name)
+	if disk == nil {
+		f.error(w, http.StatusNotFound, "notFound", "disk "+name+" not found")
+		return
+	}
+	f.start(w, r, project, zone, "delete", disk.GetSelfLink(), func() bool {
+		if len(disk.GetUsers()) > 0 {
+			f.error(w, http.StatusBadRequest, "resourceInUseByAnotherResource", "disk "+name+" is in use by "+disk.GetUsers()[0])
+			return false
+		}
+		return true
+	}, func(failed bool) {
+		if !failed {
+			delete(f.disks, diskKey(project, zone, name))
+		}
+	})
+}
+
+// start starts an operation of opType on target, unless the request ID of r
+// started one already, in which case that operation is returned again. apply
+// applies the change, or writes an error and returns false. done completes
+// it once the operation is polled.
+func (f *fakeCompute) start(w http.ResponseWriter, r *http.Request, project, zone, opType, target string, apply func() bool, done func(failed bool)) {
+	requestID := r.URL.Query().Get("requestId")
+	if op, ok := f.byRequestID[requestID]; ok && requestID != "" {
+		f.reply(w, op.op)
+		return
+	}
+	if !apply() {
+		return
+	}
+	f.nextID++
+	name := fmt.Sprintf("operation-%d", f.nextID)
+	op := &fakeOperation{
+		op: &computepb.Operation{
+			Name:          pointer.String(name),
+			OperationType: pointer.String(opType),
+			TargetLink:    pointer.String(target),
+			Zone:          pointer.String(fakeComputeBase + "projects/" + project + "/zones/" + zone),
+			SelfLink:      pointer.String(fakeComputeBase + "projects/" + project + "/zones/" + zone + "/operations/" + name),
+			Status:        computepb.Operation_RUNNING.Enum(),
+		},
+		done: done,
+	}
+	f.operations[project+"/"+zone+"/"+name] = op
+	if requestID != "" {
+		f.byRequestID[requestID] = op
+	}
+	f.reply(w, op.op)
+}
+
+// getOperation serves an operation, which is done from then on.
+func (f *fakeCompute) getOperation(w http.ResponseWriter, project, zone, name string) {
+	op, ok := f.operations[project+"/"+zone+"/"+name]
+	if !ok {
+		f.error(w, http.StatusNotFound, "notFound", "operation "+name+" not found")
+		return
+	}
+	if op.op.GetStatus() != computepb.Operation_DONE {
+		op.op.Status = computepb.Operation_DONE.Enum()
+		op.op.Error = f.opErrors[op.op.GetOperationType()]
+		if op.done != nil {
+			op.done(op.op.Error != nil)
+		}
+	}
+	f.reply(w, op.op)
+}
+
+// listSnapshots serves the snapshots of project matching the filter of r,
+// all in one page.
+func (f *fakeCompute) listSnapshots(w http.ResponseWriter, r *http.Request, project string) {
+	list := &computepb.SnapshotList{}
+	for key, snapshot := range f.snapshots {
+		if !strings.HasPrefix(key, project+"/") {
+			continue
+		}
+		ok, err := matchFilter(r.URL.Query().Get("filter"), snapshot.GetLabels(), map[string]string{"sourceDiskId": snapshot.GetSourceDiskId()})
+		if err != nil {
+			f.error(w, http.StatusBadRequest, "invalid", err.Error())
+			return
+		}
+		if ok {
+			list.Items = append(list.Items, snapshot)
+		}
+	}
+	f.reply(w, list)
+}
+
+// findDisk returns the disk of project in zone with the ID or name resource.
+func (f *fakeCompute) findDisk(project, zone, resource string) *computepb.Disk {
+	if disk, ok := f.disks[diskKey(project, zone, resource)]; ok {
+		return disk
+	}
+	for key, disk := range f.disks {
+		if strings.HasPrefix(key, project+"/"+zone+"/") && strconv.FormatUint(disk.GetId(), 10) == resource {
+			return disk
+		}
+	}
+	return nil
+}
+
+// decode decodes the body of r into m, or writes an error and returns false.
+func (f *fakeCompute) decode(w http.ResponseWriter, r *http.Request, m proto.Message) bool {
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = protojson.Unmarshal(body, m)
+	}
+	if err != nil {
+		f.error(w, http.StatusBadRequest, "parseError", err.Error())
+		return false
+	}
+	return true
+}
+
+func (f *fakeCompute) reply(w http.ResponseWriter, m proto.Message) {
+	body, err := protojson.Marshal(m)
+	if err != nil {
+		f.t.Errorf("marshal response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// error writes an API error as the Compute API does.
+func (f *fakeCompute) error(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"errors":  []map[string]string{{"reason": reason, "message": message}},
+		},
+	})
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const logFormatGCP = "gcp"
+
+// gcpSeverities maps zerolog levels to Cloud Logging severities.
+var gcpSeverities = map[zerolog.Level]string{
+	zerolog.TraceLevel: "DEBUG",
+	zerolog.DebugLevel: "DEBUG",
+	zerolog.InfoLevel:  "INFO",
+	zerolog.WarnLevel:  "WARNING",
+	zerolog.ErrorLevel: "ERROR",
+	zerolog.FatalLevel: "CRITICAL",
+	zerolog.PanicLevel: "ALERT",
+}
+
+// severityHook adds the Cloud Logging severity of the level to every entry.
+type severityHook struct{}
+
+func (severityHook) Run(e *zerolog.Event, level zerolog.Level, _ string) {
+	severity, ok := gcpSeverities[level]
+	if !ok {
+		severity = "DEFAULT"
+	}
+	e.Str("severity", severity)
+}
+
+// newGCPLogger returns a logger writing JSON lines to w in the structured
+// logging format understood by Cloud Logging: every entry has a severity,
+// carries the command as a label, and, if the project is known, belongs to
+// a trace shared by all entries of the run.
+func newGCPLogger(w io.Writer, command, projectID, traceID string) zerolog.Logger {
+	ctx := zerolog.New(w).Hook(severityHook{}).With().
+		Timestamp().
+		Dict("logging.googleapis.com/labels", zerolog.Dict().Str("command", command))
+	if projectID != "" {
+		ctx = ctx.Str("logging.googleapis.com/trace", fmt.Sprintf("projects/%s/traces/%s", projectID, traceID))
+	}
+	return ctx.Logger()
+}
+
+// newTraceID returns a random trace ID of 32 hex characters.
+func newTraceID() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
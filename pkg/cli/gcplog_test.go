@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func Test_GCPLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := newGCPLogger(&buf, "cleanup", "testing", "0123456789abcdef0123456789abcdef")
+	logger.Info().Str("diskName", "test-disk").Msg("deleting disk")
+	logger.Warn().Msg("dry run -- would delete disk")
+	logger.Error().Err(xerrors.New("permission denied")).Msg("failed to delete disk")
+
+	var severities []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		require.Equal(t, map[string]interface{}{"command": "cleanup"}, entry["logging.googleapis.com/labels"])
+		require.Equal(t, "projects/testing/traces/0123456789abcdef0123456789abcdef", entry["logging.googleapis.com/trace"])
+		require.Contains(t, entry, "time")
+		require.Contains(t, entry, "message")
+		severities = append(severities, entry["severity"].(string))
+	}
+	require.Equal(t, []string{"INFO", "WARNING", "ERROR"}, severities)
+
+	buf.Reset()
+	logger = newGCPLogger(&buf, "mark", "", newTraceID())
+	logger.Debug().Msg("listing disks")
+	require.NotContains(t, buf.String(), "logging.googleapis.com/trace", "no trace without a project")
+	require.Contains(t, buf.String(), `"severity":"DEBUG"`)
+	require.Len(t, newTraceID(), 32)
+}
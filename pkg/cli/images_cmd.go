@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// imagesConfig holds the flags of images and its subcommands.
+type imagesConfig struct {
+	marksFile   string
+	cutoffDays  int64
+	gracePeriod time.Duration
+}
+
+func newImagesCommand(a *app) *cobra.Command {
+	var c imagesConfig
+	imagesCmd := &cobra.Command{
+		Use:   "images",
+		Short: "mark and delete custom images that no disk or instance template uses, e.g. stale workspace images",
+	}
+	imagesMarkCmd := &cobra.Command{
+		Use:   "mark",
+		Short: "mark the custom images created more than --cutoff days ago that no disk or instance template uses",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.forEachImageProject(cmd, &c, func(cleaner *cleanup.ImageCleaner, opts cleanup.ImageOptions) (cleanup.ResourceStats, error) {
+				return cleaner.MarkImages(cmd.Context(), opts)
+			})
+		},
+	}
+	imagesMarkCmd.PersistentFlags().Int64Var(&c.cutoffDays, "cutoff", 90, "how many days ago the image must have been created")
+	imagesCleanupCmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "delete marked images that are still unused",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.forEachImageProject(cmd, &c, func(cleaner *cleanup.ImageCleaner, opts cleanup.ImageOptions) (cleanup.ResourceStats, error) {
+				return cleaner.DeleteImages(cmd.Context(), opts)
+			})
+		},
+	}
+	imagesCleanupCmd.PersistentFlags().DurationVar(&c.gracePeriod, "grace-period", 7*24*time.Hour, "only delete images marked at least this long ago, counted from the end of the day of the mark; 0 to disable")
+	imagesCmd.PersistentFlags().StringVar(&c.marksFile, "image-marks-file", "image-marks.json", "file in the --store holding the marks of images")
+	imagesCmd.AddCommand(imagesMarkCmd, imagesCleanupCmd)
+	return imagesCmd
+}
+
+// forEachImageProject loads the images used in all the projects, as images
+// can be used across projects, then runs fn in every project with the marks
+// of --image-marks-file.
+func (a *app) forEachImageProject(cmd *cobra.Command, c *imagesConfig, fn func(*cleanup.ImageCleaner, cleanup.ImageOptions) (cleanup.ResourceStats, error)) error {
+	if a.tenant.Label != "" {
+		return xerrors.Errorf("--tenant is not supported for images")
+	}
+	projects, err := a.projects(cmd.Context())
+	if err != nil {
+		return err
+	}
+	cleaners := make(map[string]*cleanup.ImageCleaner, len(projects))
+	usage := cleanup.NewImageUsage()
+	for _, projectID := range projects {
+		clientOpts := a.projectOpts.of(projectID, a.opts.ClientOptions)
+		images, err := computev1.NewImagesRESTClient(cmd.Context(), clientOpts...)
+		if err != nil {
+			return xerrors.Errorf("init images client: %w", err)
+		}
+		defer images.Close()
+		templates, err := computev1.NewInstanceTemplatesRESTClient(cmd.Context(), clientOpts...)
+		if err != nil {
+			return xerrors.Errorf("init instance templates client: %w", err)
+		}
+		defer templates.Close()
+		cleaners[projectID] = cleanup.NewImageCleaner(images, templates, a.disksClient)
+		if err := cleaners[projectID].LoadUsage(cmd.Context(), projectID, usage); err != nil {
+			return xerrors.Errorf("load images used in project %s: %w", projectID, err)
+		}
+	}
+	log.Info().Int("images", usage.Len()).Msg("loaded images in use")
+	return forEachResourceProject(cmd.Context(), a.stateStore, c.marksFile, "image", projects, a.cfg.dryRun, func(projectID string, marks cleanup.ResourceMarks) (cleanup.ResourceStats, error) {
+		return fn(cleaners[projectID], cleanup.ImageOptions{
+			ProjectID:   projectID,
+			Cutoff:      24 * time.Hour * time.Duration(c.cutoffDays),
+			GracePeriod: c.gracePeriod,
+			Usage:       usage,
+			ExemptLabel: a.cfg.exemptLabel,
+			Marks:       marks,
+			MaxRetries:  a.cfg.maxRetries,
+			DryRun:      a.cfg.dryRun,
+		})
+	})
+}
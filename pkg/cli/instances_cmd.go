@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// instancesConfig holds the flags of instances and its subcommands.
+type instancesConfig struct {
+	filter      string
+	marksFile   string
+	cutoffDays  int64
+	gracePeriod time.Duration
+	action      string
+	doSnapshot  bool
+}
+
+func newInstancesCommand(a *app) *cobra.Command {
+	var c instancesConfig
+	instancesCmd := &cobra.Command{
+		Use:   "instances",
+		Short: "mark and delete or stop VMs that have been stopped or suspended for long, e.g. those of abandoned workspaces",
+	}
+	instancesMarkCmd := &cobra.Command{
+		Use:   "mark",
+		Short: "mark the instances matching --instance-filter that have been stopped or suspended for more than --cutoff days",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.forEachInstanceProject(cmd, &c, func(cleaner *cleanup.InstanceCleaner, opts cleanup.InstanceOptions) (cleanup.ResourceStats, error) {
+				return cleaner.MarkInstances(cmd.Context(), opts)
+			})
+		},
+	}
+	instancesMarkCmd.PersistentFlags().Int64Var(&c.cutoffDays, "cutoff", 30, "how many days the instance must have been stopped or suspended")
+	instancesCleanupCmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "delete or stop marked instances that are still stopped or suspended",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.forEachInstanceProject(cmd, &c, func(cleaner *cleanup.InstanceCleaner, opts cleanup.InstanceOptions) (cleanup.ResourceStats, error) {
+				return cleaner.CleanupInstances(cmd.Context(), opts)
+			})
+		},
+	}
+	instancesCleanupCmd.PersistentFlags().DurationVar(&c.gracePeriod, "grace-period", 7*24*time.Hour, "only clean up instances marked at least this long ago, counted from the end of the day of the mark; 0 to disable")
+	instancesCleanupCmd.PersistentFlags().StringVar(&c.action, "instance-action", string(cleanup.InstanceDelete), "delete (delete the instance and the disks set to auto-delete with it) or stop (only stop suspended instances, which are billed for their memory)")
+	instancesCleanupCmd.PersistentFlags().BoolVar(&c.doSnapshot, "do-snapshot", true, "snapshot the boot disk of an instance before deleting it")
+	instancesCmd.PersistentFlags().StringVar(&c.filter, "instance-filter", "", "filter of the list instances request selecting the instances to process, e.g. labels.workspace:*; required")
+	instancesCmd.PersistentFlags().StringVar(&c.marksFile, "instance-marks-file", "instance-marks.json", "file in the --store holding the marks of instances")
+	instancesCmd.AddCommand(instancesMarkCmd, instancesCleanupCmd)
+	return instancesCmd
+}
+
+// forEachInstanceProject runs fn in every project with the marks of
+// --instance-marks-file.
+func (a *app) forEachInstanceProject(cmd *cobra.Command, c *instancesConfig, fn func(*cleanup.InstanceCleaner, cleanup.InstanceOptions) (cleanup.ResourceStats, error)) error {
+	if c.filter == "" {
+		return xerrors.Errorf("--instance-filter is required, e.g. labels.workspace:*, so that only the VMs meant to be cleaned up are")
+	}
+	if a.tenant.Label != "" {
+		return xerrors.Errorf("--tenant is not supported for instances")
+	}
+	action := cleanup.InstanceDelete
+	if c.action != "" {
+		var err error
+		if action, err = cleanup.ParseInstanceAction(c.action); err != nil {
+			return err
+		}
+	}
+	projects, err := a.projects(cmd.Context())
+	if err != nil {
+		return err
+	}
+	return forEachResourceProject(cmd.Context(), a.stateStore, c.marksFile, "instance", projects, a.cfg.dryRun, func(projectID string, marks cleanup.ResourceMarks) (cleanup.ResourceStats, error) {
+		client, err := computev1.NewInstancesRESTClient(cmd.Context(), a.projectOpts.of(projectID, a.opts.ClientOptions)...)
+		if err != nil {
+			return cleanup.ResourceStats{}, xerrors.Errorf("init instances client: %w", err)
+		}
+		defer client.Close()
+		return fn(cleanup.NewInstanceCleaner(client, a.disksClient), cleanup.InstanceOptions{
+			ProjectID:        projectID,
+			Filter:           c.filter,
+			Cutoff:           24 * time.Hour * time.Duration(c.cutoffDays),
+			GracePeriod:      c.gracePeriod,
+			Action:           action,
+			SnapshotBootDisk: c.doSnapshot,
+			ExemptLabel:      a.cfg.exemptLabel,
+			Marks:            marks,
+			MaxRetries:       a.cfg.maxRetries,
+			DryRun:           a.cfg.dryRun,
+		})
+	})
+}
@@ -0,0 +1,269 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// Issue trackers.
+const (
+	trackerGitHub = "github"
+	trackerGitLab = "gitlab"
+)
+
+const (
+	githubAPI = "https://api.github.com"
+	gitlabAPI = "https://gitlab.com/api/v4"
+	// maxIssueDisks is how many disks an issue lists, to stay well within
+	// the size limit of issue bodies.
+	maxIssueDisks = 300
+)
+
+// issueOptions configures newIssueTracker.
+type issueOptions struct {
+	// Tracker is github or gitlab.
+	Tracker string
+	// Repo is the repository as owner/name on GitHub, or the path or ID of
+	// the project on GitLab.
+	Repo string
+	// TokenFile holds a token allowed to create issues and comments.
+	TokenFile string
+	// APIURL is the base URL of the API of a GitHub Enterprise or
+	// self-managed GitLab server, empty for github.com or gitlab.com.
+	APIURL string
+	// Number is the tracking issue to comment on; 0 opens an issue per run.
+	Number int
+	// Labels are added to the issues opened.
+	Labels []string
+	// OwnerLabel names the owner of a disk.
+	OwnerLabel string
+	// GracePeriod is the grace period of cleanup, to tell when a disk is
+	// deleted.
+	GracePeriod time.Duration
+}
+
+// issueDisk is a disk marked in a run, as listed in an issue.
+type issueDisk struct {
+	ProjectID string
+	Zone      string
+	Name      string
+	SizeGB    int64
+	// Owner is the value of the owner label of the disk, if any.
+	Owner string
+	// DeleteAfter is when the grace period of the disk ends.
+	DeleteAfter time.Time
+}
+
+// issueTracker opens an issue, or comments on a tracking issue, listing the
+// disks marked by a mark run, so that they are reviewed where engineers
+// already look.
+type issueTracker struct {
+	opts   issueOptions
+	token  string
+	api    string
+	now    func() time.Time
+	client *http.Client
+
+	mu    sync.Mutex
+	disks []issueDisk
+	// more counts the disks marked beyond maxIssueDisks.
+	more int
+}
+
+// newIssueTracker returns the issueTracker configured by opts.
+func newIssueTracker(opts issueOptions) (*issueTracker, error) {
+	api := opts.APIURL
+	switch opts.Tracker {
+	case trackerGitHub:
+		if strings.Count(opts.Repo, "/") != 1 {
+			return nil, xerrors.Errorf("invalid --issue-repo %q: expected owner/name", opts.Repo)
+		}
+		if api == "" {
+			api = githubAPI
+		}
+	case trackerGitLab:
+		if opts.Repo == "" {
+			return nil, xerrors.Errorf("--issue-repo is required: the path or ID of the project")
+		}
+		if api == "" {
+			api = gitlabAPI
+		}
+	default:
+		return nil, xerrors.Errorf("unknown --issue-tracker %q, expected github or gitlab", opts.Tracker)
+	}
+	if opts.Number < 0 {
+		return nil, xerrors.Errorf("--issue-number must not be negative")
+	}
+	token, err := readSecret(opts.TokenFile, opts.Tracker+" token")
+	if err != nil {
+		return nil, err
+	}
+	return &issueTracker{opts: opts, token: token, api: strings.TrimSuffix(api, "/"), now: time.Now, client: &http.Client{Timeout: runStatusTimeout}}, nil
+}
+
+// reset clears the disks to start a new run. It is safe to call on a nil
+// issueTracker.
+func (t *issueTracker) reset() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.disks, t.more = nil, 0
+}
+
+// handle records the disk of a DiskProcessed event if it was marked, or
+// would be in a dry run.
+func (t *issueTracker) handle(e events.Event) {
+	if e.Type != events.DiskProcessed || e.Action != string(cleanup.ActionMark) || (e.Err != nil && !errors.Is(e.Err, diskerr.ErrDryRun)) {
+		return
+	}
+	markedAt, _ := cleanup.MarkedAt(e.Disk)
+	if markedAt.IsZero() {
+		// the disk as listed, before the mark: marked today, and the
+		// grace period counts from the end of the day
+		markedAt = t.now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.disks) == maxIssueDisks {
+		t.more++
+		return
+	}
+	t.disks = append(t.disks, issueDisk{
+		ProjectID:   e.ProjectID,
+		Zone:        e.Zone,
+		Name:        e.Disk.GetName(),
+		SizeGB:      e.Disk.GetSizeGb(),
+		Owner:       e.Disk.GetLabels()[t.opts.OwnerLabel],
+		DeleteAfter: markedAt.Add(t.opts.GracePeriod).UTC(),
+	})
+}
+
+// issue returns the title and Markdown body of the issue listing disks, of
+// which more are left out.
+func (t *issueTracker) issue(use string, disks []issueDisk, more int) (title, body string) {
+	total := len(disks) + more
+	title = fmt.Sprintf("%s marked %d %s for deletion on %s", use, total, plural(total, "disk", "disks"), t.now().UTC().Format("2006-01-02"))
+	var b strings.Builder
+	fmt.Fprintf(&b, "The following %s marked for deletion. Each is snapshotted and deleted by the first cleanup run after its planned deletion, unless it is unmarked or used before.\n\n",
+		plural(total, "disk was", "disks were"))
+	fmt.Fprintf(&b, "| Disk | Project | Zone | Size | Owner (`%s` label) | Planned deletion |\n|---|---|---|---|---|---|\n", t.opts.OwnerLabel)
+	for _, d := range disks {
+		owner := d.Owner
+		if owner == "" {
+			owner = "-"
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %d GB | %s | after %s |\n", d.Name, d.ProjectID, d.Zone, d.SizeGB, owner, d.DeleteAfter.Format("2006-01-02 15:04 MST"))
+	}
+	if more > 0 {
+		fmt.Fprintf(&b, "\nand %d more %s, see the logs of the run.\n", more, plural(more, "disk", "disks"))
+	}
+	fmt.Fprintf(&b, "\nTo keep a disk, unmark it before its planned deletion:\n\n```\n%s unmark <disk-name> --project-id <project> --zone <zone> --dry-run=false\n```\n", use)
+	return title, b.String()
+}
+
+// file opens an issue, or comments on the tracking issue, listing the disks
+// marked by the run, and clears them. A run that marked no disk files
+// nothing. It is a no-op on a nil issueTracker.
+func (t *issueTracker) file(ctx context.Context, use string, dryRun bool) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	disks, more := t.disks, t.more
+	t.disks, t.more = nil, 0
+	t.mu.Unlock()
+	if len(disks) == 0 {
+		return nil
+	}
+	title, body := t.issue(use, disks, more)
+	logger := log.With().Str("tracker", t.opts.Tracker).Str("repo", t.opts.Repo).Int("disks", len(disks)+more).Logger()
+	if dryRun {
+		logger.Info().Str("title", title).Msg("dry run -- would file issue")
+		return nil
+	}
+	link, err := t.post(ctx, title, body)
+	if err != nil {
+		return err
+	}
+	logger.Info().Str("url", link).Msg("filed issue")
+	return nil
+}
+
+// post opens an issue with title and body, or comments on the tracking
+// issue, and returns its URL.
+func (t *issueTracker) post(ctx context.Context, title, body string) (string, error) {
+	var endpoint string
+	var payload map[string]interface{}
+	switch {
+	case t.opts.Tracker == trackerGitHub && t.opts.Number > 0:
+		endpoint = fmt.Sprintf("%s/repos/%s/issues/%d/comments", t.api, t.opts.Repo, t.opts.Number)
+		payload = map[string]interface{}{"body": "### " + title + "\n\n" + body}
+	case t.opts.Tracker == trackerGitHub:
+		endpoint = fmt.Sprintf("%s/repos/%s/issues", t.api, t.opts.Repo)
+		payload = map[string]interface{}{"title": title, "body": body}
+		if len(t.opts.Labels) > 0 {
+			payload["labels"] = t.opts.Labels
+		}
+	case t.opts.Number > 0:
+		endpoint = fmt.Sprintf("%s/projects/%s/issues/%d/notes", t.api, url.PathEscape(t.opts.Repo), t.opts.Number)
+		payload = map[string]interface{}{"body": "### " + title + "\n\n" + body}
+	default:
+		endpoint = fmt.Sprintf("%s/projects/%s/issues", t.api, url.PathEscape(t.opts.Repo))
+		payload = map[string]interface{}{"title": title, "description": body}
+		if len(t.opts.Labels) > 0 {
+			payload["labels"] = strings.Join(t.opts.Labels, ",")
+		}
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.opts.Tracker == trackerGitHub {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	} else {
+		req.Header.Set("PRIVATE-TOKEN", t.token)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", xerrors.Errorf("file issue: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", xerrors.Errorf("file issue: unexpected status %s", resp.Status)
+	}
+	// GitHub returns the URL as html_url, GitLab as web_url
+	var created struct {
+		HTMLURL string `json:"html_url"`
+		WebURL  string `json:"web_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", xerrors.Errorf("file issue: decode response: %w", err)
+	}
+	if created.HTMLURL != "" {
+		return created.HTMLURL, nil
+	}
+	return created.WebURL, nil
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_NewIssueTracker(t *testing.T) {
+	t.Parallel()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0o600))
+	for _, testCase := range []struct {
+		name string
+		opts issueOptions
+		api  string
+		err  string
+	}{
+		{name: "github", opts: issueOptions{Tracker: trackerGitHub, Repo: "acme/infra", TokenFile: tokenFile}, api: githubAPI},
+		{name: "gitlab", opts: issueOptions{Tracker: trackerGitLab, Repo: "acme/infra", TokenFile: tokenFile, APIURL: "https://gitlab.example.com/api/v4/"}, api: "https://gitlab.example.com/api/v4"},
+		{name: "github repo", opts: issueOptions{Tracker: trackerGitHub, Repo: "infra", TokenFile: tokenFile}, err: `invalid --issue-repo "infra": expected owner/name`},
+		{name: "gitlab repo", opts: issueOptions{Tracker: trackerGitLab, TokenFile: tokenFile}, err: "--issue-repo is required: the path or ID of the project"},
+		{name: "unknown tracker", opts: issueOptions{Tracker: "jira", Repo: "acme/infra", TokenFile: tokenFile}, err: `unknown --issue-tracker "jira", expected github or gitlab`},
+		{name: "no token", opts: issueOptions{Tracker: trackerGitHub, Repo: "acme/infra"}, err: "no file holding the github token given"},
+	} {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			tracker, err := newIssueTracker(testCase.opts)
+			if testCase.err != "" {
+				require.EqualError(t, err, testCase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "secret", tracker.token)
+			require.Equal(t, testCase.api, tracker.api)
+		})
+	}
+}
+
+func Test_IssueTracker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	marked := func(name string, labels map[string]string) events.Event {
+		return events.Event{
+			Type:      events.DiskProcessed,
+			ProjectID: "p",
+			Zone:      "us-east1-b",
+			Action:    string(cleanup.ActionMark),
+			Disk:      &computepb.Disk{Name: pointer.String(name), SizeGb: pointer.Int64(100), Labels: labels},
+		}
+	}
+	record := func(tracker *issueTracker) {
+		tracker.handle(marked("pvc-a", map[string]string{"owner": "jdoe"}))
+		// marked by an earlier day of the run
+		tracker.handle(marked("pvc-b", map[string]string{cleanup.LabelMarkedForDeletion: "2022-02-28"}))
+		skipped := marked("pvc-c", nil)
+		skipped.Err = diskerr.ErrAlreadyMarked
+		tracker.handle(skipped)
+		unmarked := marked("pvc-d", nil)
+		unmarked.Action = string(cleanup.ActionUnmark)
+		tracker.handle(unmarked)
+	}
+	const body = "The following disks were marked for deletion. Each is snapshotted and deleted by the first cleanup run after its planned deletion, unless it is unmarked or used before.\n\n" +
+		"| Disk | Project | Zone | Size | Owner (`owner` label) | Planned deletion |\n|---|---|---|---|---|---|\n" +
+		"| `pvc-a` | p | us-east1-b | 100 GB | jdoe | after 2022-03-09 00:00 UTC |\n" +
+		"| `pvc-b` | p | us-east1-b | 100 GB | - | after 2022-03-08 00:00 UTC |\n" +
+		"\nTo keep a disk, unmark it before its planned deletion:\n\n```\ngke-disk-cleanup unmark <disk-name> --project-id <project> --zone <zone> --dry-run=false\n```\n"
+
+	// serve returns a tracker filing to a fake API, and the request it got.
+	serve := func(t *testing.T, opts issueOptions) (*issueTracker, *http.Request, map[string]interface{}) {
+		var got *http.Request
+		payload := make(map[string]interface{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"html_url": "https://github.com/acme/infra/issues/7"}`))
+		}))
+		t.Cleanup(srv.Close)
+		opts.OwnerLabel, opts.GracePeriod = "owner", 7*24*time.Hour
+		tracker := &issueTracker{opts: opts, token: "secret", api: srv.URL, now: func() time.Time { return now }, client: srv.Client()}
+		record(tracker)
+		require.NoError(t, tracker.file(context.Background(), "gke-disk-cleanup", false))
+		return tracker, got, payload
+	}
+
+	t.Run("github issue", func(t *testing.T) {
+		t.Parallel()
+		tracker, req, payload := serve(t, issueOptions{Tracker: trackerGitHub, Repo: "acme/infra", Labels: []string{"disks"}})
+		require.Equal(t, "/repos/acme/infra/issues", req.URL.Path)
+		require.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+		require.Equal(t, map[string]interface{}{
+			"title":  "gke-disk-cleanup marked 2 disks for deletion on 2022-03-01",
+			"body":   body,
+			"labels": []interface{}{"disks"},
+		}, payload)
+		require.Empty(t, tracker.disks, "cleared once filed")
+	})
+
+	t.Run("github comment", func(t *testing.T) {
+		t.Parallel()
+		_, req, payload := serve(t, issueOptions{Tracker: trackerGitHub, Repo: "acme/infra", Number: 7})
+		require.Equal(t, "/repos/acme/infra/issues/7/comments", req.URL.Path)
+		require.Equal(t, map[string]interface{}{"body": "### gke-disk-cleanup marked 2 disks for deletion on 2022-03-01\n\n" + body}, payload)
+	})
+
+	t.Run("gitlab issue", func(t *testing.T) {
+		t.Parallel()
+		_, req, payload := serve(t, issueOptions{Tracker: trackerGitLab, Repo: "acme/infra", Labels: []string{"disks", "cleanup"}})
+		require.Equal(t, "/projects/acme%2Finfra/issues", req.URL.RawPath)
+		require.Equal(t, "secret", req.Header.Get("PRIVATE-TOKEN"))
+		require.Equal(t, "disks,cleanup", payload["labels"])
+		require.Equal(t, body, payload["description"])
+	})
+
+	t.Run("gitlab note", func(t *testing.T) {
+		t.Parallel()
+		_, req, _ := serve(t, issueOptions{Tracker: trackerGitLab, Repo: "42", Number: 3})
+		require.Equal(t, "/projects/42/issues/3/notes", req.URL.Path)
+	})
+
+	t.Run("nothing marked", func(t *testing.T) {
+		t.Parallel()
+		tracker := &issueTracker{opts: issueOptions{Tracker: trackerGitHub, Repo: "acme/infra"}, api: "http://unreachable.invalid", now: time.Now, client: http.DefaultClient}
+		require.NoError(t, tracker.file(context.Background(), "gke-disk-cleanup", false))
+		record(tracker)
+		// a dry run files nothing
+		require.NoError(t, tracker.file(context.Background(), "gke-disk-cleanup", true))
+		var nilTracker *issueTracker
+		nilTracker.reset()
+		require.NoError(t, nilTracker.file(context.Background(), "gke-disk-cleanup", false))
+	})
+}
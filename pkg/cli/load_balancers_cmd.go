@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// loadBalancersConfig holds the flags of load-balancers and its
+// subcommands.
+type loadBalancersConfig struct {
+	marksFile   string
+	cutoffDays  int64
+	gracePeriod time.Duration
+}
+
+func newLoadBalancersCommand(a *app) *cobra.Command {
+	var c loadBalancersConfig
+	loadBalancersCmd := &cobra.Command{
+		Use:   "load-balancers",
+		Short: "mark and delete the load balancer resources of Services in GKE clusters that no longer exist",
+	}
+	loadBalancersMarkCmd := &cobra.Command{
+		Use:   "mark",
+		Short: "mark the load balancer resources of deleted clusters created more than --cutoff days ago",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.forEachLoadBalancerProject(cmd, &c, func(cleaner *cleanup.LoadBalancerCleaner, opts cleanup.LoadBalancerOptions) (cleanup.ResourceStats, error) {
+				return cleaner.MarkLoadBalancers(cmd.Context(), opts)
+			})
+		},
+	}
+	loadBalancersMarkCmd.PersistentFlags().Int64Var(&c.cutoffDays, "cutoff", 7, "how many days ago the resource must have been created")
+	loadBalancersCleanupCmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "delete marked load balancer resources whose cluster still does not exist",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return a.forEachLoadBalancerProject(cmd, &c, func(cleaner *cleanup.LoadBalancerCleaner, opts cleanup.LoadBalancerOptions) (cleanup.ResourceStats, error) {
+				return cleaner.CleanupLoadBalancers(cmd.Context(), opts)
+			})
+		},
+	}
+	loadBalancersCleanupCmd.PersistentFlags().DurationVar(&c.gracePeriod, "grace-period", 7*24*time.Hour, "only delete resources marked at least this long ago, counted from the end of the day of the mark; 0 to disable")
+	loadBalancersCmd.PersistentFlags().StringVar(&c.marksFile, "load-balancer-marks-file", "load-balancer-marks.json", "file in the --store holding the marks of load balancer resources, which cannot be labelled")
+	loadBalancersCmd.AddCommand(loadBalancersMarkCmd, loadBalancersCleanupCmd)
+	return loadBalancersCmd
+}
+
+// forEachLoadBalancerProject runs fn in every project with the marks of
+// --load-balancer-marks-file.
+func (a *app) forEachLoadBalancerProject(cmd *cobra.Command, c *loadBalancersConfig, fn func(*cleanup.LoadBalancerCleaner, cleanup.LoadBalancerOptions) (cleanup.ResourceStats, error)) error {
+	if a.tenant.Label != "" {
+		return xerrors.Errorf("--tenant is not supported for load balancers, which carry no labels")
+	}
+	projects, err := a.projects(cmd.Context())
+	if err != nil {
+		return err
+	}
+	lister, err := newProjectClusters(cmd.Context(), a.opts.ClientOptions, a.projectOpts)
+	if err != nil {
+		return err
+	}
+	clusters, err := existingClusters(cmd.Context(), lister, projects)
+	if err != nil {
+		return err
+	}
+	return forEachResourceProject(cmd.Context(), a.stateStore, c.marksFile, "load balancer", projects, a.cfg.dryRun, func(projectID string, marks cleanup.ResourceMarks) (cleanup.ResourceStats, error) {
+		clientOpts := a.projectOpts.of(projectID, a.opts.ClientOptions)
+		forwardingRules, err := computev1.NewForwardingRulesRESTClient(cmd.Context(), clientOpts...)
+		if err != nil {
+			return cleanup.ResourceStats{}, xerrors.Errorf("init forwarding rules client: %w", err)
+		}
+		defer forwardingRules.Close()
+		targetPools, err := computev1.NewTargetPoolsRESTClient(cmd.Context(), clientOpts...)
+		if err != nil {
+			return cleanup.ResourceStats{}, xerrors.Errorf("init target pools client: %w", err)
+		}
+		defer targetPools.Close()
+		firewalls, err := computev1.NewFirewallsRESTClient(cmd.Context(), clientOpts...)
+		if err != nil {
+			return cleanup.ResourceStats{}, xerrors.Errorf("init firewalls client: %w", err)
+		}
+		defer firewalls.Close()
+		return fn(cleanup.NewLoadBalancerCleaner(forwardingRules, targetPools, firewalls), cleanup.LoadBalancerOptions{
+			ProjectID:   projectID,
+			Clusters:    clusters,
+			Cutoff:      24 * time.Hour * time.Duration(c.cutoffDays),
+			GracePeriod: c.gracePeriod,
+			Marks:       marks,
+			MaxRetries:  a.cfg.maxRetries,
+			DryRun:      a.cfg.dryRun,
+		})
+	})
+}
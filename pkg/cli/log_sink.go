@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// logEvent writes engine events to the global logger.
+func logEvent(e events.Event) {
+	disk := e.Disk
+	switch e.Type {
+	case events.DiskScanned:
+		// skipped disks are covered by the progress heartbeat unless verbose
+		evt := log.Debug()
+		if e.Action != string(cleanup.ActionSkip) {
+			evt = log.Info()
+		}
+		if e.Score != nil {
+			evt = evt.Float64("score", *e.Score)
+		}
+		withDisk(evt, e).
+			Int64("sizeGB", disk.GetSizeGb()).
+			Str("lastAttachTime", disk.GetLastAttachTimestamp()).
+			Str("labels", fmt.Sprintf("%+v", disk.GetLabels())).
+			Str("action", e.Action).
+			Bool("dryRun", e.DryRun).
+			Err(e.Err).
+			Send()
+	case events.DiskMarked:
+		withDisk(log.Info(), e).Msg("disk marked for deletion")
+	case events.DiskUnmarked:
+		withDisk(log.Info(), e).Msg("disk unmarked for deletion")
+	case events.SnapshotCreated:
+		withDisk(log.Info(), e).Msg("snapshot created")
+	case events.DiskExported:
+		withDisk(log.Info(), e).Str("uri", e.Export.URI).Int64("sizeBytes", e.Export.SizeBytes).Str("md5", e.Export.MD5).Str("crc32c", e.Export.CRC32C).Msg("disk exported")
+	case events.DiskDeleted:
+		withDisk(log.Info(), e).Int64("sizeGB", disk.GetSizeGb()).Msg("disk deleted")
+	case events.DiskRestored:
+		withDisk(log.Info(), e).Str("snapshotName", e.Snapshot.GetName()).Msg("disk restored")
+	case events.SnapshotDeleted:
+		withSnapshot(log.Info(), e).Int64("storageBytes", e.Snapshot.GetStorageBytes()).Msg("snapshot deleted")
+	case events.Error:
+		if e.Snapshot != nil {
+			withSnapshot(log.Error(), e).Err(e.Err).Msg("unable to process snapshot")
+			return
+		}
+		withDisk(log.Error(), e).Err(e.Err).Msg("unable to process disk")
+	}
+}
+
+// withDisk adds the project, zone and identity of the event's disk to evt,
+// and its GKE cluster and PersistentVolumeClaim if known.
+func withDisk(evt *zerolog.Event, e events.Event) *zerolog.Event {
+	evt = evt.Str("projectID", e.ProjectID).
+		Str("zone", e.Zone).
+		Str("diskName", e.Disk.GetName()).
+		Str("selfLink", e.Disk.GetSelfLink())
+	if cluster := cleanup.Cluster(e.Disk); cluster != "" {
+		evt = evt.Str("cluster", cluster)
+	}
+	claim := cleanup.ClaimOf(e.Disk)
+	if claim.Namespace != "" {
+		evt = evt.Str("namespace", claim.Namespace)
+	}
+	if claim.Name != "" {
+		evt = evt.Str("pvc", claim.Name)
+	}
+	if claim.Volume != "" {
+		evt = evt.Str("pv", claim.Volume)
+	}
+	return evt
+}
+
+// withSnapshot adds the project and identity of the event's snapshot to evt.
+func withSnapshot(evt *zerolog.Event, e events.Event) *zerolog.Event {
+	return evt.Str("projectID", e.ProjectID).
+		Str("snapshotName", e.Snapshot.GetName()).
+		Str("selfLink", e.Snapshot.GetSelfLink())
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_WithDisk(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	withDisk(logger.Info(), events.Event{
+		ProjectID: "testing",
+		Zone:      "us-east1-b",
+		Disk: &computepb.Disk{
+			Name:     pointer.String("test-disk"),
+			SelfLink: pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/disks/test-disk"),
+		},
+	}).Send()
+
+	var record map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, map[string]string{
+		"level":     "info",
+		"projectID": "testing",
+		"zone":      "us-east1-b",
+		"diskName":  "test-disk",
+		"selfLink":  "https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/disks/test-disk",
+	}, record)
+}
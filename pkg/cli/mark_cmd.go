@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/policy"
+)
+
+// markConfig holds the flags of the mark phase, shared by mark and serve.
+type markConfig struct {
+	filter            string
+	cutoffDays        int64
+	sourceCutoffDays  []string
+	markPolicyFile    string
+	idleIODays        int64
+	scoreModelFile    string
+	labelBudgetPolicy string
+	kubeconfig        string
+	inCluster         bool
+	issue             issueOptions
+	attachHistoryDays int64
+}
+
+// addFlags adds the flags of the mark phase to cmd.
+func (c *markConfig) addFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&c.filter, "filter", cleanup.FilterGKEVolumes, "filters for list disk request")
+	cmd.PersistentFlags().Int64Var(&c.cutoffDays, "cutoff", 30, "how many days since the disk was last attached or detached")
+	cmd.PersistentFlags().StringSliceVar(&c.sourceCutoffDays, "cutoff-by-source", nil, "--cutoff for the disks created from a source, as comma-separated source=days pairs, e.g. image=90")
+	cmd.PersistentFlags().StringVar(&c.markPolicyFile, "mark-policy", "", "YAML or JSON file with the rules that decide which disks are abandoned and marked, e.g. by last attach or creation age, size or label, combined with all, any and not; by default the disks past the cutoff are")
+	cmd.PersistentFlags().Int64Var(&c.idleIODays, "idle-io-days", 0, "also mark disks without reads or writes in this many days according to Cloud Monitoring, even if they are attached, e.g. to an idle workspace VM; 0 to disable")
+	cmd.PersistentFlags().StringVar(&c.scoreModelFile, "score-model", "", "YAML or JSON file with a score model rating the disks past the cutoff; only those scoring at least its threshold are marked")
+	cmd.PersistentFlags().StringVar(&c.labelBudgetPolicy, "label-budget-policy", string(cleanup.LabelBudgetSkip), "what to do with disks that already have the maximum number of labels: skip or evict (remove stale labels owned by this tool)")
+	cmd.PersistentFlags().StringVar(&c.kubeconfig, "kubeconfig", "", "path to a kubeconfig; disks backing a persistent volume in its current cluster are never marked")
+	cmd.PersistentFlags().BoolVar(&c.inCluster, "in-cluster", false, "never mark disks backing a persistent volume in the cluster this runs in")
+	cmd.PersistentFlags().StringVar(&c.issue.Tracker, "issue-tracker", "", "github or gitlab, to open an issue listing the disks marked by every run with their owner and planned deletion, for review")
+	cmd.PersistentFlags().StringVar(&c.issue.Repo, "issue-repo", "", "repository of --issue-tracker issues: owner/name on GitHub, the path or ID of the project on GitLab")
+	cmd.PersistentFlags().StringVar(&c.issue.TokenFile, "issue-token-file", "", "file holding a token allowed to create issues and comments in --issue-repo")
+	cmd.PersistentFlags().StringVar(&c.issue.APIURL, "issue-api-url", "", "API URL of a GitHub Enterprise or self-managed GitLab server, e.g. https://gitlab.example.com/api/v4; github.com or gitlab.com by default")
+	cmd.PersistentFlags().IntVar(&c.issue.Number, "issue-number", 0, "comment on this tracking issue instead of opening an issue per run")
+	cmd.PersistentFlags().StringSliceVar(&c.issue.Labels, "issue-labels", nil, "labels of the issues opened")
+	cmd.PersistentFlags().Int64Var(&c.attachHistoryDays, "attach-history-days", 0, "also take the last attach time of disks from this many days of Cloud Audit Logs, e.g. for disks imported from another project; 0 to disable")
+
+}
+
+// planConfig holds the flags naming a plan and the key it is signed with.
+type planConfig struct {
+	file        string
+	hmacKeyFile string
+	kmsKey      string
+}
+
+func newMarkCommand(a *app) *cobra.Command {
+	var (
+		c           markConfig
+		plan        planConfig
+		gracePeriod time.Duration
+	)
+	markCmd := &cobra.Command{
+		Use:   "mark",
+		Short: "mark disks for later deletion",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := a.openIssueTracker(c.issue, gracePeriod); err != nil {
+				return err
+			}
+			if plan.file == "" {
+				return a.runMark(cmd.Context(), &c, a.cfg.checkpointFile)
+			}
+			signer, err := newSigningKey(cmd.Context(), "plan", "--plan-out", plan.hmacKeyFile, plan.kmsKey, a.opts.ClientOptions)
+			if err != nil {
+				return err
+			}
+			p := cleanup.NewPlan(time.Now())
+			a.bus.Subscribe(planRecorder{plan: p}.handle, events.DiskProcessed)
+			err = a.runMark(cmd.Context(), &c, a.cfg.checkpointFile)
+			// the plan of a partially failed run still holds the disks that
+			// were processed
+			if planErr := writePlan(cmd.Context(), a.stateStore, plan.file, p, signer); err == nil {
+				err = planErr
+			}
+			return err
+		},
+	}
+	c.addFlags(markCmd)
+	markCmd.PersistentFlags().DurationVar(&gracePeriod, "grace-period", 7*24*time.Hour, "grace period of cleanup, to tell the planned deletion of the disks in --issue-tracker issues")
+	markCmd.PersistentFlags().StringVar(&plan.file, "plan-out", "", "write the actions of the run to this file in the --store, for review before cleanup --plan executes it")
+	markCmd.PersistentFlags().StringVar(&plan.hmacKeyFile, "plan-hmac-key-file", "", "file holding the secret key to sign the --plan-out with HMAC-SHA256")
+	markCmd.PersistentFlags().StringVar(&plan.kmsKey, "plan-kms-key", "", "Cloud KMS asymmetric signing key version to sign the --plan-out with, e.g. projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1")
+	return markCmd
+}
+
+// openIssueTracker subscribes the tracker of --issue-tracker, if set, to the
+// disks marked. gracePeriod tells their planned deletion.
+func (a *app) openIssueTracker(opts issueOptions, gracePeriod time.Duration) error {
+	if opts.Tracker == "" {
+		return nil
+	}
+	opts.OwnerLabel, opts.GracePeriod = a.cfg.ownerLabel, gracePeriod
+	var err error
+	if a.issues, err = newIssueTracker(opts); err != nil {
+		return err
+	}
+	a.bus.Subscribe(a.issues.handle, events.DiskProcessed)
+	return nil
+}
+
+// runMark runs the mark phase across all projects, recording its progress in
+// checkpointPath if set.
+func (a *app) runMark(ctx context.Context, c *markConfig, checkpointPath string) (err error) {
+	cfg := &a.cfg
+	var summarized *runSummary
+	defer func(start time.Time) {
+		if flushErr := a.flushRun("mark"); err == nil {
+			err = flushErr
+		}
+		a.observeRun("mark", start, err)
+		a.reportRun("mark", start, summarized, err)
+		// file the disks marked even if the run failed later
+		ctx, cancel := context.WithTimeout(context.Background(), runStatusTimeout)
+		defer cancel()
+		if err := a.issues.file(ctx, a.opts.Use, cfg.dryRun); err != nil {
+			log.Warn().Err(err).Msg("unable to file issue")
+		}
+	}(time.Now())
+	release, err := a.acquireLock(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	targetZones, err := a.zones()
+	if err != nil {
+		return err
+	}
+	projects, err := a.projects(ctx)
+	if err != nil {
+		return err
+	}
+	if err := a.preflight(ctx, projects, "mark", false, ""); err != nil {
+		return err
+	}
+	resume, err := resolveResume(cfg.resumeFrom, projects)
+	if err != nil {
+		return err
+	}
+	checkpoints, projects, err := openCheckpoint(ctx, a.stateStore, checkpointPath, "mark", cfg.resumeFrom, projects)
+	if err != nil {
+		return err
+	}
+	budgetPolicy, err := cleanup.ParseLabelBudgetPolicy(c.labelBudgetPolicy)
+	if err != nil {
+		return err
+	}
+	volumes, err := loadVolumes(ctx, c.kubeconfig, c.inCluster)
+	if err != nil {
+		return err
+	}
+	var al auditLog
+	if c.attachHistoryDays > 0 {
+		if al, err = newProjectAuditLog(ctx, a.opts.ClientOptions, a.projectOpts); err != nil {
+			return err
+		}
+	}
+	cutoff := 24 * time.Hour * time.Duration(c.cutoffDays)
+	sourceCutoffs, err := parseSourceCutoffs(c.sourceCutoffDays)
+	if err != nil {
+		return err
+	}
+	var markPolicy cleanup.MarkPolicy
+	if c.markPolicyFile != "" {
+		if markPolicy, err = policy.LoadRules(c.markPolicyFile); err != nil {
+			return err
+		}
+	}
+	var scoreModel *cleanup.ScoreModel
+	var ioMetrics diskIOMetrics
+	if c.scoreModelFile != "" {
+		if scoreModel, err = loadScoreModel(c.scoreModelFile); err != nil {
+			return err
+		}
+		if scoreModel.Flapping.Weight > 0 {
+			if cfg.historyFile == "" {
+				log.Warn().Msg("the flapping signal of the score model is left out without --history-file")
+			} else if scoreModel.Unmarks, err = loadUnmarks(ctx, a.stateStore, cfg.historyFile); err != nil {
+				return err
+			}
+		}
+		if scoreModel.IO.Weight > 0 {
+			if ioMetrics, err = newProjectDiskIO(ctx, a.opts.ClientOptions, a.projectOpts); err != nil {
+				return err
+			}
+		}
+	}
+	if c.idleIODays > 0 && ioMetrics == nil {
+		if ioMetrics, err = newProjectDiskIO(ctx, a.opts.ClientOptions, a.projectOpts); err != nil {
+			return err
+		}
+	}
+	fallback := a.newFallback()
+	endProgress := a.beginProgress(ctx, "mark", projects, targetZones)
+	summary := a.startSummary(ctx, "mark")
+	marker := cleanup.NewMarker(a.disksClient, a.bus)
+	err = forEachProject(projects, func(projectID string) (cleanup.Stats, error) {
+		resume, checkpointer, err := checkpoints.project(projectID, resume)
+		if err != nil {
+			return cleanup.Stats{}, err
+		}
+		var attachHistory *cleanup.AttachHistory
+		if al != nil {
+			attachHistory, err = loadAttachHistory(ctx, al, projectID, 24*time.Hour*time.Duration(c.attachHistoryDays))
+			if err != nil {
+				return cleanup.Stats{}, err
+			}
+		}
+		var idleIO *cleanup.DiskCounts
+		if c.idleIODays > 0 {
+			if idleIO, err = loadIOBytes(ctx, ioMetrics, projectID, 24*time.Hour*time.Duration(c.idleIODays)); err != nil {
+				return cleanup.Stats{}, err
+			}
+		}
+		projectScoreModel := scoreModel
+		if scoreModel != nil && scoreModel.IO.Weight > 0 {
+			model := *scoreModel
+			if model.IOBytes, err = loadIOBytes(ctx, ioMetrics, projectID, ioPeriod(scoreModel)); err != nil {
+				return cleanup.Stats{}, err
+			}
+			projectScoreModel = &model
+		}
+		stats, err := marker.MarkDisks(ctx, cleanup.MarkOptions{
+			ProjectID:         projectID,
+			Zones:             targetZones,
+			Filter:            c.filter,
+			Cutoff:            cutoff,
+			SourceCutoffs:     sourceCutoffs,
+			Policy:            markPolicy,
+			IdleIO:            idleIO,
+			ScoreModel:        projectScoreModel,
+			LabelBudgetPolicy: budgetPolicy,
+			ExemptLabel:       cfg.exemptLabel,
+			IncludeBootDisks:  cfg.includeBootDisks,
+			IncludeManaged:    !cfg.skipManaged,
+			Tenant:            a.tenant,
+			Selector:          a.selector,
+			AllFields:         cfg.allDiskFields,
+			PageSize:          cfg.pageSize,
+			Volumes:           volumes,
+			AttachHistory:     attachHistory,
+			Resume:            resume,
+			Checkpoint:        checkpointer,
+			CheckpointEvery:   cfg.checkpointEvery,
+			Concurrency:       cfg.concurrency,
+			MaxRetries:        cfg.maxRetries,
+			Throttle:          a.control,
+			Fallback:          fallback,
+			DryRun:            cfg.dryRun,
+		})
+		return stats, checkpoints.complete(projectID, err)
+	})
+	endProgress(err)
+	summary.log(cfg.dryRun, fallback)
+	summarized = summary
+	if err := checkpoints.finish(err); err != nil {
+		return err
+	}
+	if err := fallbackError(fallback); err != nil {
+		return err
+	}
+	return summary.failuresError(cfg.maxFailures)
+}
@@ -0,0 +1,156 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cli
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Ensure, that auditLogMock does implement auditLog.
+// If this is not the case, regenerate this file with moq.
+var _ auditLog = &auditLogMock{}
+
+// auditLogMock is a mock implementation of auditLog.
+//
+//	func TestSomethingThatUsesauditLog(t *testing.T) {
+//
+//		// make and configure a mocked auditLog
+//		mockedauditLog := &auditLogMock{
+//			ListDiskAttachmentsFunc: func(ctx context.Context, projectID string, since time.Time, until time.Time) ([]auditAttachment, error) {
+//				panic("mock out the ListDiskAttachments method")
+//			},
+//			ListDiskDeletionsFunc: func(ctx context.Context, projectID string, since time.Time, until time.Time) ([]auditDeletion, error) {
+//				panic("mock out the ListDiskDeletions method")
+//			},
+//		}
+//
+//		// use mockedauditLog in code that requires auditLog
+//		// and then make assertions.
+//
+//	}
+type auditLogMock struct {
+	// ListDiskAttachmentsFunc mocks the ListDiskAttachments method.
+	ListDiskAttachmentsFunc func(ctx context.Context, projectID string, since time.Time, until time.Time) ([]auditAttachment, error)
+
+	// ListDiskDeletionsFunc mocks the ListDiskDeletions method.
+	ListDiskDeletionsFunc func(ctx context.Context, projectID string, since time.Time, until time.Time) ([]auditDeletion, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// ListDiskAttachments holds details about calls to the ListDiskAttachments method.
+		ListDiskAttachments []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ProjectID is the projectID argument value.
+			ProjectID string
+			// Since is the since argument value.
+			Since time.Time
+			// Until is the until argument value.
+			Until time.Time
+		}
+		// ListDiskDeletions holds details about calls to the ListDiskDeletions method.
+		ListDiskDeletions []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ProjectID is the projectID argument value.
+			ProjectID string
+			// Since is the since argument value.
+			Since time.Time
+			// Until is the until argument value.
+			Until time.Time
+		}
+	}
+	lockListDiskAttachments sync.RWMutex
+	lockListDiskDeletions   sync.RWMutex
+}
+
+// ListDiskAttachments calls ListDiskAttachmentsFunc.
+func (mock *auditLogMock) ListDiskAttachments(ctx context.Context, projectID string, since time.Time, until time.Time) ([]auditAttachment, error) {
+	if mock.ListDiskAttachmentsFunc == nil {
+		panic("auditLogMock.ListDiskAttachmentsFunc: method is nil but auditLog.ListDiskAttachments was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		ProjectID string
+		Since     time.Time
+		Until     time.Time
+	}{
+		Ctx:       ctx,
+		ProjectID: projectID,
+		Since:     since,
+		Until:     until,
+	}
+	mock.lockListDiskAttachments.Lock()
+	mock.calls.ListDiskAttachments = append(mock.calls.ListDiskAttachments, callInfo)
+	mock.lockListDiskAttachments.Unlock()
+	return mock.ListDiskAttachmentsFunc(ctx, projectID, since, until)
+}
+
+// ListDiskAttachmentsCalls gets all the calls that were made to ListDiskAttachments.
+// Check the length with:
+//
+//	len(mockedauditLog.ListDiskAttachmentsCalls())
+func (mock *auditLogMock) ListDiskAttachmentsCalls() []struct {
+	Ctx       context.Context
+	ProjectID string
+	Since     time.Time
+	Until     time.Time
+} {
+	var calls []struct {
+		Ctx       context.Context
+		ProjectID string
+		Since     time.Time
+		Until     time.Time
+	}
+	mock.lockListDiskAttachments.RLock()
+	calls = mock.calls.ListDiskAttachments
+	mock.lockListDiskAttachments.RUnlock()
+	return calls
+}
+
+// ListDiskDeletions calls ListDiskDeletionsFunc.
+func (mock *auditLogMock) ListDiskDeletions(ctx context.Context, projectID string, since time.Time, until time.Time) ([]auditDeletion, error) {
+	if mock.ListDiskDeletionsFunc == nil {
+		panic("auditLogMock.ListDiskDeletionsFunc: method is nil but auditLog.ListDiskDeletions was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		ProjectID string
+		Since     time.Time
+		Until     time.Time
+	}{
+		Ctx:       ctx,
+		ProjectID: projectID,
+		Since:     since,
+		Until:     until,
+	}
+	mock.lockListDiskDeletions.Lock()
+	mock.calls.ListDiskDeletions = append(mock.calls.ListDiskDeletions, callInfo)
+	mock.lockListDiskDeletions.Unlock()
+	return mock.ListDiskDeletionsFunc(ctx, projectID, since, until)
+}
+
+// ListDiskDeletionsCalls gets all the calls that were made to ListDiskDeletions.
+// Check the length with:
+//
+//	len(mockedauditLog.ListDiskDeletionsCalls())
+func (mock *auditLogMock) ListDiskDeletionsCalls() []struct {
+	Ctx       context.Context
+	ProjectID string
+	Since     time.Time
+	Until     time.Time
+} {
+	var calls []struct {
+		Ctx       context.Context
+		ProjectID string
+		Since     time.Time
+		Until     time.Time
+	}
+	mock.lockListDiskDeletions.RLock()
+	calls = mock.calls.ListDiskDeletions
+	mock.lockListDiskDeletions.RUnlock()
+	return calls
+}
@@ -0,0 +1,81 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cli
+
+import (
+	"context"
+	"sync"
+)
+
+// Ensure, that clusterListerMock does implement clusterLister.
+// If this is not the case, regenerate this file with moq.
+var _ clusterLister = &clusterListerMock{}
+
+// clusterListerMock is a mock implementation of clusterLister.
+//
+//	func TestSomethingThatUsesclusterLister(t *testing.T) {
+//
+//		// make and configure a mocked clusterLister
+//		mockedclusterLister := &clusterListerMock{
+//			ClusterNamesFunc: func(ctx context.Context, projectID string) ([]string, error) {
+//				panic("mock out the ClusterNames method")
+//			},
+//		}
+//
+//		// use mockedclusterLister in code that requires clusterLister
+//		// and then make assertions.
+//
+//	}
+type clusterListerMock struct {
+	// ClusterNamesFunc mocks the ClusterNames method.
+	ClusterNamesFunc func(ctx context.Context, projectID string) ([]string, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// ClusterNames holds details about calls to the ClusterNames method.
+		ClusterNames []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ProjectID is the projectID argument value.
+			ProjectID string
+		}
+	}
+	lockClusterNames sync.RWMutex
+}
+
+// ClusterNames calls ClusterNamesFunc.
+func (mock *clusterListerMock) ClusterNames(ctx context.Context, projectID string) ([]string, error) {
+	if mock.ClusterNamesFunc == nil {
+		panic("clusterListerMock.ClusterNamesFunc: method is nil but clusterLister.ClusterNames was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		ProjectID string
+	}{
+		Ctx:       ctx,
+		ProjectID: projectID,
+	}
+	mock.lockClusterNames.Lock()
+	mock.calls.ClusterNames = append(mock.calls.ClusterNames, callInfo)
+	mock.lockClusterNames.Unlock()
+	return mock.ClusterNamesFunc(ctx, projectID)
+}
+
+// ClusterNamesCalls gets all the calls that were made to ClusterNames.
+// Check the length with:
+//
+//	len(mockedclusterLister.ClusterNamesCalls())
+func (mock *clusterListerMock) ClusterNamesCalls() []struct {
+	Ctx       context.Context
+	ProjectID string
+} {
+	var calls []struct {
+		Ctx       context.Context
+		ProjectID string
+	}
+	mock.lockClusterNames.RLock()
+	calls = mock.calls.ClusterNames
+	mock.lockClusterNames.RUnlock()
+	return calls
+}
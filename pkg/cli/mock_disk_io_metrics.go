@@ -0,0 +1,94 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cli
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Ensure, that diskIOMetricsMock does implement diskIOMetrics.
+// If this is not the case, regenerate this file with moq.
+var _ diskIOMetrics = &diskIOMetricsMock{}
+
+// diskIOMetricsMock is a mock implementation of diskIOMetrics.
+//
+//	func TestSomethingThatUsesdiskIOMetrics(t *testing.T) {
+//
+//		// make and configure a mocked diskIOMetrics
+//		mockeddiskIOMetrics := &diskIOMetricsMock{
+//			DiskIOBytesFunc: func(ctx context.Context, projectID string, since time.Time, until time.Time) (map[string]int64, error) {
+//				panic("mock out the DiskIOBytes method")
+//			},
+//		}
+//
+//		// use mockeddiskIOMetrics in code that requires diskIOMetrics
+//		// and then make assertions.
+//
+//	}
+type diskIOMetricsMock struct {
+	// DiskIOBytesFunc mocks the DiskIOBytes method.
+	DiskIOBytesFunc func(ctx context.Context, projectID string, since time.Time, until time.Time) (map[string]int64, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// DiskIOBytes holds details about calls to the DiskIOBytes method.
+		DiskIOBytes []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ProjectID is the projectID argument value.
+			ProjectID string
+			// Since is the since argument value.
+			Since time.Time
+			// Until is the until argument value.
+			Until time.Time
+		}
+	}
+	lockDiskIOBytes sync.RWMutex
+}
+
+// DiskIOBytes calls DiskIOBytesFunc.
+func (mock *diskIOMetricsMock) DiskIOBytes(ctx context.Context, projectID string, since time.Time, until time.Time) (map[string]int64, error) {
+	if mock.DiskIOBytesFunc == nil {
+		panic("diskIOMetricsMock.DiskIOBytesFunc: method is nil but diskIOMetrics.DiskIOBytes was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		ProjectID string
+		Since     time.Time
+		Until     time.Time
+	}{
+		Ctx:       ctx,
+		ProjectID: projectID,
+		Since:     since,
+		Until:     until,
+	}
+	mock.lockDiskIOBytes.Lock()
+	mock.calls.DiskIOBytes = append(mock.calls.DiskIOBytes, callInfo)
+	mock.lockDiskIOBytes.Unlock()
+	return mock.DiskIOBytesFunc(ctx, projectID, since, until)
+}
+
+// DiskIOBytesCalls gets all the calls that were made to DiskIOBytes.
+// Check the length with:
+//
+//	len(mockeddiskIOMetrics.DiskIOBytesCalls())
+func (mock *diskIOMetricsMock) DiskIOBytesCalls() []struct {
+	Ctx       context.Context
+	ProjectID string
+	Since     time.Time
+	Until     time.Time
+} {
+	var calls []struct {
+		Ctx       context.Context
+		ProjectID string
+		Since     time.Time
+		Until     time.Time
+	}
+	mock.lockDiskIOBytes.RLock()
+	calls = mock.calls.DiskIOBytes
+	mock.lockDiskIOBytes.RUnlock()
+	return calls
+}
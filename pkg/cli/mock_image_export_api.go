@@ -0,0 +1,275 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cli
+
+import (
+	"context"
+	"gke-disk-cleanup/pkg/events"
+	"sync"
+	"time"
+)
+
+// Ensure, that imageExportAPIMock does implement imageExportAPI.
+// If this is not the case, regenerate this file with moq.
+var _ imageExportAPI = &imageExportAPIMock{}
+
+// imageExportAPIMock is a mock implementation of imageExportAPI.
+//
+//	func TestSomethingThatUsesimageExportAPI(t *testing.T) {
+//
+//		// make and configure a mocked imageExportAPI
+//		mockedimageExportAPI := &imageExportAPIMock{
+//			CreateImageFunc: func(ctx context.Context, projectID string, image string, sourceDisk string) error {
+//				panic("mock out the CreateImage method")
+//			},
+//			DeleteImageFunc: func(ctx context.Context, projectID string, image string) error {
+//				panic("mock out the DeleteImage method")
+//			},
+//			ExportImageFunc: func(ctx context.Context, projectID string, image string, zone string, uri string, timeout time.Duration) error {
+//				panic("mock out the ExportImage method")
+//			},
+//			ObjectFunc: func(ctx context.Context, uri string) (*events.Export, error) {
+//				panic("mock out the Object method")
+//			},
+//		}
+//
+//		// use mockedimageExportAPI in code that requires imageExportAPI
+//		// and then make assertions.
+//
+//	}
+type imageExportAPIMock struct {
+	// CreateImageFunc mocks the CreateImage method.
+	CreateImageFunc func(ctx context.Context, projectID string, image string, sourceDisk string) error
+
+	// DeleteImageFunc mocks the DeleteImage method.
+	DeleteImageFunc func(ctx context.Context, projectID string, image string) error
+
+	// ExportImageFunc mocks the ExportImage method.
+	ExportImageFunc func(ctx context.Context, projectID string, image string, zone string, uri string, timeout time.Duration) error
+
+	// ObjectFunc mocks the Object method.
+	ObjectFunc func(ctx context.Context, uri string) (*events.Export, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// CreateImage holds details about calls to the CreateImage method.
+		CreateImage []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ProjectID is the projectID argument value.
+			ProjectID string
+			// Image is the image argument value.
+			Image string
+			// SourceDisk is the sourceDisk argument value.
+			SourceDisk string
+		}
+		// DeleteImage holds details about calls to the DeleteImage method.
+		DeleteImage []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ProjectID is the projectID argument value.
+			ProjectID string
+			// Image is the image argument value.
+			Image string
+		}
+		// ExportImage holds details about calls to the ExportImage method.
+		ExportImage []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ProjectID is the projectID argument value.
+			ProjectID string
+			// Image is the image argument value.
+			Image string
+			// Zone is the zone argument value.
+			Zone string
+			// URI is the uri argument value.
+			URI string
+			// Timeout is the timeout argument value.
+			Timeout time.Duration
+		}
+		// Object holds details about calls to the Object method.
+		Object []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// URI is the uri argument value.
+			URI string
+		}
+	}
+	lockCreateImage sync.RWMutex
+	lockDeleteImage sync.RWMutex
+	lockExportImage sync.RWMutex
+	lockObject      sync.RWMutex
+}
+
+// CreateImage calls CreateImageFunc.
+func (mock *imageExportAPIMock) CreateImage(ctx context.Context, projectID string, image string, sourceDisk string) error {
+	if mock.CreateImageFunc == nil {
+		panic("imageExportAPIMock.CreateImageFunc: method is nil but imageExportAPI.CreateImage was just called")
+	}
+	callInfo := struct {
+		Ctx        context.Context
+		ProjectID  string
+		Image      string
+		SourceDisk string
+	}{
+		Ctx:        ctx,
+		ProjectID:  projectID,
+		Image:      image,
+		SourceDisk: sourceDisk,
+	}
+	mock.lockCreateImage.Lock()
+	mock.calls.CreateImage = append(mock.calls.CreateImage, callInfo)
+	mock.lockCreateImage.Unlock()
+	return mock.CreateImageFunc(ctx, projectID, image, sourceDisk)
+}
+
+// CreateImageCalls gets all the calls that were made to CreateImage.
+// Check the length with:
+//
+//	len(mockedimageExportAPI.CreateImageCalls())
+func (mock *imageExportAPIMock) CreateImageCalls() []struct {
+	Ctx        context.Context
+	ProjectID  string
+	Image      string
+	SourceDisk string
+} {
+	var calls []struct {
+		Ctx        context.Context
+		ProjectID  string
+		Image      string
+		SourceDisk string
+	}
+	mock.lockCreateImage.RLock()
+	calls = mock.calls.CreateImage
+	mock.lockCreateImage.RUnlock()
+	return calls
+}
+
+// DeleteImage calls DeleteImageFunc.
+func (mock *imageExportAPIMock) DeleteImage(ctx context.Context, projectID string, image string) error {
+	if mock.DeleteImageFunc == nil {
+		panic("imageExportAPIMock.DeleteImageFunc: method is nil but imageExportAPI.DeleteImage was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		ProjectID string
+		Image     string
+	}{
+		Ctx:       ctx,
+		ProjectID: projectID,
+		Image:     image,
+	}
+	mock.lockDeleteImage.Lock()
+	mock.calls.DeleteImage = append(mock.calls.DeleteImage, callInfo)
+	mock.lockDeleteImage.Unlock()
+	return mock.DeleteImageFunc(ctx, projectID, image)
+}
+
+// DeleteImageCalls gets all the calls that were made to DeleteImage.
+// Check the length with:
+//
+//	len(mockedimageExportAPI.DeleteImageCalls())
+func (mock *imageExportAPIMock) DeleteImageCalls() []struct {
+	Ctx       context.Context
+	ProjectID string
+	Image     string
+} {
+	var calls []struct {
+		Ctx       context.Context
+		ProjectID string
+		Image     string
+	}
+	mock.lockDeleteImage.RLock()
+	calls = mock.calls.DeleteImage
+	mock.lockDeleteImage.RUnlock()
+	return calls
+}
+
+// ExportImage calls ExportImageFunc.
+func (mock *imageExportAPIMock) ExportImage(ctx context.Context, projectID string, image string, zone string, uri string, timeout time.Duration) error {
+	if mock.ExportImageFunc == nil {
+		panic("imageExportAPIMock.ExportImageFunc: method is nil but imageExportAPI.ExportImage was just called")
+	}
+	callInfo := struct {
+		Ctx       context.Context
+		ProjectID string
+		Image     string
+		Zone      string
+		URI       string
+		Timeout   time.Duration
+	}{
+		Ctx:       ctx,
+		ProjectID: projectID,
+		Image:     image,
+		Zone:      zone,
+		URI:       uri,
+		Timeout:   timeout,
+	}
+	mock.lockExportImage.Lock()
+	mock.calls.ExportImage = append(mock.calls.ExportImage, callInfo)
+	mock.lockExportImage.Unlock()
+	return mock.ExportImageFunc(ctx, projectID, image, zone, uri, timeout)
+}
+
+// ExportImageCalls gets all the calls that were made to ExportImage.
+// Check the length with:
+//
+//	len(mockedimageExportAPI.ExportImageCalls())
+func (mock *imageExportAPIMock) ExportImageCalls() []struct {
+	Ctx       context.Context
+	ProjectID string
+	Image     string
+	Zone      string
+	URI       string
+	Timeout   time.Duration
+} {
+	var calls []struct {
+		Ctx       context.Context
+		ProjectID string
+		Image     string
+		Zone      string
+		URI       string
+		Timeout   time.Duration
+	}
+	mock.lockExportImage.RLock()
+	calls = mock.calls.ExportImage
+	mock.lockExportImage.RUnlock()
+	return calls
+}
+
+// Object calls ObjectFunc.
+func (mock *imageExportAPIMock) Object(ctx context.Context, uri string) (*events.Export, error) {
+	if mock.ObjectFunc == nil {
+		panic("imageExportAPIMock.ObjectFunc: method is nil but imageExportAPI.Object was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		URI string
+	}{
+		Ctx: ctx,
+		URI: uri,
+	}
+	mock.lockObject.Lock()
+	mock.calls.Object = append(mock.calls.Object, callInfo)
+	mock.lockObject.Unlock()
+	return mock.ObjectFunc(ctx, uri)
+}
+
+// ObjectCalls gets all the calls that were made to Object.
+// Check the length with:
+//
+//	len(mockedimageExportAPI.ObjectCalls())
+func (mock *imageExportAPIMock) ObjectCalls() []struct {
+	Ctx context.Context
+	URI string
+} {
+	var calls []struct {
+		Ctx context.Context
+		URI string
+	}
+	mock.lockObject.RLock()
+	calls = mock.calls.Object
+	mock.lockObject.RUnlock()
+	return calls
+}
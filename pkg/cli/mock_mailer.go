@@ -0,0 +1,93 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cli
+
+import (
+	"context"
+	"sync"
+)
+
+// Ensure, that mailerMock does implement mailer.
+// If this is not the case, regenerate this file with moq.
+var _ mailer = &mailerMock{}
+
+// mailerMock is a mock implementation of mailer.
+//
+//	func TestSomethingThatUsesmailer(t *testing.T) {
+//
+//		// make and configure a mocked mailer
+//		mockedmailer := &mailerMock{
+//			SendFunc: func(ctx context.Context, to string, subject string, body string) error {
+//				panic("mock out the Send method")
+//			},
+//		}
+//
+//		// use mockedmailer in code that requires mailer
+//		// and then make assertions.
+//
+//	}
+type mailerMock struct {
+	// SendFunc mocks the Send method.
+	SendFunc func(ctx context.Context, to string, subject string, body string) error
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Send holds details about calls to the Send method.
+		Send []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// To is the to argument value.
+			To string
+			// Subject is the subject argument value.
+			Subject string
+			// Body is the body argument value.
+			Body string
+		}
+	}
+	lockSend sync.RWMutex
+}
+
+// Send calls SendFunc.
+func (mock *mailerMock) Send(ctx context.Context, to string, subject string, body string) error {
+	if mock.SendFunc == nil {
+		panic("mailerMock.SendFunc: method is nil but mailer.Send was just called")
+	}
+	callInfo := struct {
+		Ctx     context.Context
+		To      string
+		Subject string
+		Body    string
+	}{
+		Ctx:     ctx,
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	}
+	mock.lockSend.Lock()
+	mock.calls.Send = append(mock.calls.Send, callInfo)
+	mock.lockSend.Unlock()
+	return mock.SendFunc(ctx, to, subject, body)
+}
+
+// SendCalls gets all the calls that were made to Send.
+// Check the length with:
+//
+//	len(mockedmailer.SendCalls())
+func (mock *mailerMock) SendCalls() []struct {
+	Ctx     context.Context
+	To      string
+	Subject string
+	Body    string
+} {
+	var calls []struct {
+		Ctx     context.Context
+		To      string
+		Subject string
+		Body    string
+	}
+	mock.lockSend.RLock()
+	calls = mock.calls.Send
+	mock.lockSend.RUnlock()
+	return calls
+}
@@ -0,0 +1,201 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cli
+
+import (
+	"context"
+	"sync"
+
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+// Ensure, that pubsubClientMock does implement pubsubClient.
+// If this is not the case, regenerate this file with moq.
+var _ pubsubClient = &pubsubClientMock{}
+
+// pubsubClientMock is a mock implementation of pubsubClient.
+//
+//	func TestSomethingThatUsespubsubClient(t *testing.T) {
+//
+//		// make and configure a mocked pubsubClient
+//		mockedpubsubClient := &pubsubClientMock{
+//			AcknowledgeFunc: func(ctx context.Context, subscription string, ackIDs []string) error {
+//				panic("mock out the Acknowledge method")
+//			},
+//			PublishFunc: func(ctx context.Context, topic string, messages []*pubsub.PubsubMessage) error {
+//				panic("mock out the Publish method")
+//			},
+//			PullFunc: func(ctx context.Context, subscription string, maxMessages int64) ([]*pubsub.ReceivedMessage, error) {
+//				panic("mock out the Pull method")
+//			},
+//		}
+//
+//		// use mockedpubsubClient in code that requires pubsubClient
+//		// and then make assertions.
+//
+//	}
+type pubsubClientMock struct {
+	// AcknowledgeFunc mocks the Acknowledge method.
+	AcknowledgeFunc func(ctx context.Context, subscription string, ackIDs []string) error
+
+	// PublishFunc mocks the Publish method.
+	PublishFunc func(ctx context.Context, topic string, messages []*pubsub.PubsubMessage) error
+
+	// PullFunc mocks the Pull method.
+	PullFunc func(ctx context.Context, subscription string, maxMessages int64) ([]*pubsub.ReceivedMessage, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Acknowledge holds details about calls to the Acknowledge method.
+		Acknowledge []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Subscription is the subscription argument value.
+			Subscription string
+			// AckIDs is the ackIDs argument value.
+			AckIDs []string
+		}
+		// Publish holds details about calls to the Publish method.
+		Publish []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Topic is the topic argument value.
+			Topic string
+			// Messages is the messages argument value.
+			Messages []*pubsub.PubsubMessage
+		}
+		// Pull holds details about calls to the Pull method.
+		Pull []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Subscription is the subscription argument value.
+			Subscription string
+			// MaxMessages is the maxMessages argument value.
+			MaxMessages int64
+		}
+	}
+	lockAcknowledge sync.RWMutex
+	lockPublish     sync.RWMutex
+	lockPull        sync.RWMutex
+}
+
+// Acknowledge calls AcknowledgeFunc.
+func (mock *pubsubClientMock) Acknowledge(ctx context.Context, subscription string, ackIDs []string) error {
+	if mock.AcknowledgeFunc == nil {
+		panic("pubsubClientMock.AcknowledgeFunc: method is nil but pubsubClient.Acknowledge was just called")
+	}
+	callInfo := struct {
+		Ctx          context.Context
+		Subscription string
+		AckIDs       []string
+	}{
+		Ctx:          ctx,
+		Subscription: subscription,
+		AckIDs:       ackIDs,
+	}
+	mock.lockAcknowledge.Lock()
+	mock.calls.Acknowledge = append(mock.calls.Acknowledge, callInfo)
+	mock.lockAcknowledge.Unlock()
+	return mock.AcknowledgeFunc(ctx, subscription, ackIDs)
+}
+
+// AcknowledgeCalls gets all the calls that were made to Acknowledge.
+// Check the length with:
+//
+//	len(mockedpubsubClient.AcknowledgeCalls())
+func (mock *pubsubClientMock) AcknowledgeCalls() []struct {
+	Ctx          context.Context
+	Subscription string
+	AckIDs       []string
+} {
+	var calls []struct {
+		Ctx          context.Context
+		Subscription string
+		AckIDs       []string
+	}
+	mock.lockAcknowledge.RLock()
+	calls = mock.calls.Acknowledge
+	mock.lockAcknowledge.RUnlock()
+	return calls
+}
+
+// Publish calls PublishFunc.
+func (mock *pubsubClientMock) Publish(ctx context.Context, topic string, messages []*pubsub.PubsubMessage) error {
+	if mock.PublishFunc == nil {
+		panic("pubsubClientMock.PublishFunc: method is nil but pubsubClient.Publish was just called")
+	}
+	callInfo := struct {
+		Ctx      context.Context
+		Topic    string
+		Messages []*pubsub.PubsubMessage
+	}{
+		Ctx:      ctx,
+		Topic:    topic,
+		Messages: messages,
+	}
+	mock.lockPublish.Lock()
+	mock.calls.Publish = append(mock.calls.Publish, callInfo)
+	mock.lockPublish.Unlock()
+	return mock.PublishFunc(ctx, topic, messages)
+}
+
+// PublishCalls gets all the calls that were made to Publish.
+// Check the length with:
+//
+//	len(mockedpubsubClient.PublishCalls())
+func (mock *pubsubClientMock) PublishCalls() []struct {
+	Ctx      context.Context
+	Topic    string
+	Messages []*pubsub.PubsubMessage
+} {
+	var calls []struct {
+		Ctx      context.Context
+		Topic    string
+		Messages []*pubsub.PubsubMessage
+	}
+	mock.lockPublish.RLock()
+	calls = mock.calls.Publish
+	mock.lockPublish.RUnlock()
+	return calls
+}
+
+// Pull calls PullFunc.
+func (mock *pubsubClientMock) Pull(ctx context.Context, subscription string, maxMessages int64) ([]*pubsub.ReceivedMessage, error) {
+	if mock.PullFunc == nil {
+		panic("pubsubClientMock.PullFunc: method is nil but pubsubClient.Pull was just called")
+	}
+	callInfo := struct {
+		Ctx          context.Context
+		Subscription string
+		MaxMessages  int64
+	}{
+		Ctx:          ctx,
+		Subscription: subscription,
+		MaxMessages:  maxMessages,
+	}
+	mock.lockPull.Lock()
+	mock.calls.Pull = append(mock.calls.Pull, callInfo)
+	mock.lockPull.Unlock()
+	return mock.PullFunc(ctx, subscription, maxMessages)
+}
+
+// PullCalls gets all the calls that were made to Pull.
+// Check the length with:
+//
+//	len(mockedpubsubClient.PullCalls())
+func (mock *pubsubClientMock) PullCalls() []struct {
+	Ctx          context.Context
+	Subscription string
+	MaxMessages  int64
+} {
+	var calls []struct {
+		Ctx          context.Context
+		Subscription string
+		MaxMessages  int64
+	}
+	mock.lockPull.RLock()
+	calls = mock.calls.Pull
+	mock.lockPull.RUnlock()
+	return calls
+}
@@ -0,0 +1,189 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cli
+
+import (
+	"context"
+	"sync"
+
+	crm "google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// Ensure, that resourceManagerMock does implement resourceManager.
+// If this is not the case, regenerate this file with moq.
+var _ resourceManager = &resourceManagerMock{}
+
+// resourceManagerMock is a mock implementation of resourceManager.
+//
+//	func TestSomethingThatUsesresourceManager(t *testing.T) {
+//
+//		// make and configure a mocked resourceManager
+//		mockedresourceManager := &resourceManagerMock{
+//			ListFoldersFunc: func(ctx context.Context, parent string) ([]*crm.Folder, error) {
+//				panic("mock out the ListFolders method")
+//			},
+//			ListProjectsFunc: func(ctx context.Context, parent string) ([]*crm.Project, error) {
+//				panic("mock out the ListProjects method")
+//			},
+//			TestPermissionsFunc: func(ctx context.Context, projectID string, permissions []string) ([]string, error) {
+//				panic("mock out the TestPermissions method")
+//			},
+//		}
+//
+//		// use mockedresourceManager in code that requires resourceManager
+//		// and then make assertions.
+//
+//	}
+type resourceManagerMock struct {
+	// ListFoldersFunc mocks the ListFolders method.
+	ListFoldersFunc func(ctx context.Context, parent string) ([]*crm.Folder, error)
+
+	// ListProjectsFunc mocks the ListProjects method.
+	ListProjectsFunc func(ctx context.Context, parent string) ([]*crm.Project, error)
+
+	// TestPermissionsFunc mocks the TestPermissions method.
+	TestPermissionsFunc func(ctx context.Context, projectID string, permissions []string) ([]string, error)
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// ListFolders holds details about calls to the ListFolders method.
+		ListFolders []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Parent is the parent argument value.
+			Parent string
+		}
+		// ListProjects holds details about calls to the ListProjects method.
+		ListProjects []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Parent is the parent argument value.
+			Parent string
+		}
+		// TestPermissions holds details about calls to the TestPermissions method.
+		TestPermissions []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// ProjectID is the projectID argument value.
+			ProjectID string
+			// Permissions is the permissions argument value.
+			Permissions []string
+		}
+	}
+	lockListFolders     sync.RWMutex
+	lockListProjects    sync.RWMutex
+	lockTestPermissions sync.RWMutex
+}
+
+// ListFolders calls ListFoldersFunc.
+func (mock *resourceManagerMock) ListFolders(ctx context.Context, parent string) ([]*crm.Folder, error) {
+	if mock.ListFoldersFunc == nil {
+		panic("resourceManagerMock.ListFoldersFunc: method is nil but resourceManager.ListFolders was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Parent string
+	}{
+		Ctx:    ctx,
+		Parent: parent,
+	}
+	mock.lockListFolders.Lock()
+	mock.calls.ListFolders = append(mock.calls.ListFolders, callInfo)
+	mock.lockListFolders.Unlock()
+	return mock.ListFoldersFunc(ctx, parent)
+}
+
+// ListFoldersCalls gets all the calls that were made to ListFolders.
+// Check the length with:
+//
+//	len(mockedresourceManager.ListFoldersCalls())
+func (mock *resourceManagerMock) ListFoldersCalls() []struct {
+	Ctx    context.Context
+	Parent string
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Parent string
+	}
+	mock.lockListFolders.RLock()
+	calls = mock.calls.ListFolders
+	mock.lockListFolders.RUnlock()
+	return calls
+}
+
+// ListProjects calls ListProjectsFunc.
+func (mock *resourceManagerMock) ListProjects(ctx context.Context, parent string) ([]*crm.Project, error) {
+	if mock.ListProjectsFunc == nil {
+		panic("resourceManagerMock.ListProjectsFunc: method is nil but resourceManager.ListProjects was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Parent string
+	}{
+		Ctx:    ctx,
+		Parent: parent,
+	}
+	mock.lockListProjects.Lock()
+	mock.calls.ListProjects = append(mock.calls.ListProjects, callInfo)
+	mock.lockListProjects.Unlock()
+	return mock.ListProjectsFunc(ctx, parent)
+}
+
+// ListProjectsCalls gets all the calls that were made to ListProjects.
+// Check the length with:
+//
+//	len(mockedresourceManager.ListProjectsCalls())
+func (mock *resourceManagerMock) ListProjectsCalls() []struct {
+	Ctx    context.Context
+	Parent string
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Parent string
+	}
+	mock.lockListProjects.RLock()
+	calls = mock.calls.ListProjects
+	mock.lockListProjects.RUnlock()
+	return calls
+}
+
+// TestPermissions calls TestPermissionsFunc.
+func (mock *resourceManagerMock) TestPermissions(ctx context.Context, projectID string, permissions []string) ([]string, error) {
+	if mock.TestPermissionsFunc == nil {
+		panic("resourceManagerMock.TestPermissionsFunc: method is nil but resourceManager.TestPermissions was just called")
+	}
+	callInfo := struct {
+		Ctx         context.Context
+		ProjectID   string
+		Permissions []string
+	}{
+		Ctx:         ctx,
+		ProjectID:   projectID,
+		Permissions: permissions,
+	}
+	mock.lockTestPermissions.Lock()
+	mock.calls.TestPermissions = append(mock.calls.TestPermissions, callInfo)
+	mock.lockTestPermissions.Unlock()
+	return mock.TestPermissionsFunc(ctx, projectID, permissions)
+}
+
+// TestPermissionsCalls gets all the calls that were made to TestPermissions.
+// Check the length with:
+//
+//	len(mockedresourceManager.TestPermissionsCalls())
+func (mock *resourceManagerMock) TestPermissionsCalls() []struct {
+	Ctx         context.Context
+	ProjectID   string
+	Permissions []string
+} {
+	var calls []struct {
+		Ctx         context.Context
+		ProjectID   string
+		Permissions []string
+	}
+	mock.lockTestPermissions.RLock()
+	calls = mock.calls.TestPermissions
+	mock.lockTestPermissions.RUnlock()
+	return calls
+}
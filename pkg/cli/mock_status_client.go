@@ -0,0 +1,138 @@
+// Code generated by moq; DO NOT EDIT.
+// github.com/matryer/moq
+
+package cli
+
+import (
+	"context"
+	"gke-disk-cleanup/pkg/kube"
+	"sync"
+)
+
+// Ensure, that statusClientMock does implement statusClient.
+// If this is not the case, regenerate this file with moq.
+var _ statusClient = &statusClientMock{}
+
+// statusClientMock is a mock implementation of statusClient.
+//
+//	func TestSomethingThatUsesstatusClient(t *testing.T) {
+//
+//		// make and configure a mocked statusClient
+//		mockedstatusClient := &statusClientMock{
+//			AnnotateFunc: func(ctx context.Context, ref kube.ObjectReference, annotations map[string]string) error {
+//				panic("mock out the Annotate method")
+//			},
+//			CreateEventFunc: func(ctx context.Context, e kube.Event) error {
+//				panic("mock out the CreateEvent method")
+//			},
+//		}
+//
+//		// use mockedstatusClient in code that requires statusClient
+//		// and then make assertions.
+//
+//	}
+type statusClientMock struct {
+	// AnnotateFunc mocks the Annotate method.
+	AnnotateFunc func(ctx context.Context, ref kube.ObjectReference, annotations map[string]string) error
+
+	// CreateEventFunc mocks the CreateEvent method.
+	CreateEventFunc func(ctx context.Context, e kube.Event) error
+
+	// calls tracks calls to the methods.
+	calls struct {
+		// Annotate holds details about calls to the Annotate method.
+		Annotate []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Ref is the ref argument value.
+			Ref kube.ObjectReference
+			// Annotations is the annotations argument value.
+			Annotations map[string]string
+		}
+		// CreateEvent holds details about calls to the CreateEvent method.
+		CreateEvent []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// E is the e argument value.
+			E kube.Event
+		}
+	}
+	lockAnnotate    sync.RWMutex
+	lockCreateEvent sync.RWMutex
+}
+
+// Annotate calls AnnotateFunc.
+func (mock *statusClientMock) Annotate(ctx context.Context, ref kube.ObjectReference, annotations map[string]string) error {
+	if mock.AnnotateFunc == nil {
+		panic("statusClientMock.AnnotateFunc: method is nil but statusClient.Annotate was just called")
+	}
+	callInfo := struct {
+		Ctx         context.Context
+		Ref         kube.ObjectReference
+		Annotations map[string]string
+	}{
+		Ctx:         ctx,
+		Ref:         ref,
+		Annotations: annotations,
+	}
+	mock.lockAnnotate.Lock()
+	mock.calls.Annotate = append(mock.calls.Annotate, callInfo)
+	mock.lockAnnotate.Unlock()
+	return mock.AnnotateFunc(ctx, ref, annotations)
+}
+
+// AnnotateCalls gets all the calls that were made to Annotate.
+// Check the length with:
+//
+//	len(mockedstatusClient.AnnotateCalls())
+func (mock *statusClientMock) AnnotateCalls() []struct {
+	Ctx         context.Context
+	Ref         kube.ObjectReference
+	Annotations map[string]string
+} {
+	var calls []struct {
+		Ctx         context.Context
+		Ref         kube.ObjectReference
+		Annotations map[string]string
+	}
+	mock.lockAnnotate.RLock()
+	calls = mock.calls.Annotate
+	mock.lockAnnotate.RUnlock()
+	return calls
+}
+
+// CreateEvent calls CreateEventFunc.
+func (mock *statusClientMock) CreateEvent(ctx context.Context, e kube.Event) error {
+	if mock.CreateEventFunc == nil {
+		panic("statusClientMock.CreateEventFunc: method is nil but statusClient.CreateEvent was just called")
+	}
+	callInfo := struct {
+		Ctx context.Context
+		E   kube.Event
+	}{
+		Ctx: ctx,
+		E:   e,
+	}
+	mock.lockCreateEvent.Lock()
+	mock.calls.CreateEvent = append(mock.calls.CreateEvent, callInfo)
+	mock.lockCreateEvent.Unlock()
+	return mock.CreateEventFunc(ctx, e)
+}
+
+// CreateEventCalls gets all the calls that were made to CreateEvent.
+// Check the length with:
+//
+//	len(mockedstatusClient.CreateEventCalls())
+func (mock *statusClientMock) CreateEventCalls() []struct {
+	Ctx context.Context
+	E   kube.Event
+} {
+	var calls []struct {
+		Ctx context.Context
+		E   kube.Event
+	}
+	mock.lockCreateEvent.RLock()
+	calls = mock.calls.CreateEvent
+	mock.lockCreateEvent.RUnlock()
+	return calls
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// loadNameList reads an include or exclude file of disk names.
+func loadNameList(path string) (cleanup.NameList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read name list: %w", err)
+	}
+	list, err := cleanup.ParseNameList(data)
+	if err != nil {
+		return nil, xerrors.Errorf("parse name list %s: %w", path, err)
+	}
+	log.Debug().Str("path", path).Int("entries", len(list)).Msg("loaded name list")
+	return list, nil
+}
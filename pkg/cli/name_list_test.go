@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadNameList(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "protected-disks.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# protected\npayments-db\n"), 0o600))
+	list, err := loadNameList(path)
+	require.NoError(t, err)
+	require.True(t, list.Matches("payments-db"))
+
+	_, err = loadNameList(filepath.Join(t.TempDir(), "missing.txt"))
+	require.Error(t, err)
+}
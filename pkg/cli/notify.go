@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Notification formats.
+const (
+	notifyAuto  = "auto"
+	notifySlack = "slack"
+	notifyTeams = "teams"
+	notifyJSON  = "json"
+)
+
+// notification is the summary of a run posted to the webhook in the json
+// format.
+type notification struct {
+	runStatus
+	// MarkedDisks lists up to maxMarkedDisks of the disks marked, so that
+	// their owners can unmark them before they are deleted.
+	MarkedDisks []newlyMarkedDisk `json:"markedDisks,omitempty"`
+}
+
+// text returns n as a Markdown message, for chat webhooks.
+func (n notification) text(use string) string {
+	var b strings.Builder
+	b.WriteString(n.event().Message)
+	if n.MonthlyCost > 0 {
+		verb := "deleted"
+		if n.Command == "mark" {
+			verb = "marked"
+		}
+		fmt.Fprintf(&b, "\nThe %s disks (%d GB) cost an estimated $%.2f per month.", verb, n.AffectedGB, n.MonthlyCost)
+	}
+	if len(n.MarkedDisks) > 0 {
+		b.WriteString("\n\nMarked for deletion:")
+		for _, d := range n.MarkedDisks {
+			fmt.Fprintf(&b, "\n- `%s` in %s/%s, %d GB", d.Name, d.ProjectID, d.Zone, d.SizeGB)
+			if d.Cluster != "" {
+				fmt.Fprintf(&b, ", cluster %s", d.Cluster)
+			}
+		}
+		if more := n.Marked - len(n.MarkedDisks); more > 0 {
+			fmt.Fprintf(&b, "\n- and %d more", more)
+		}
+		fmt.Fprintf(&b, "\n\nTo keep a disk, run `%s unmark <disk-name> --project-id <project> --zone <zone>` before the next cleanup.", use)
+	}
+	return b.String()
+}
+
+// notifier posts the summary of every run to a webhook.
+type notifier struct {
+	url    string
+	format string
+	// use is the name of the command, for the unmark hint.
+	use    string
+	client *http.Client
+}
+
+// newNotifier returns a notifier posting to webhookURL in format. The auto
+// format is slack or teams for their webhook hosts, and json otherwise.
+func newNotifier(webhookURL, format, use string) (*notifier, error) {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, xerrors.Errorf("invalid --notify-webhook %q: expected an http or https URL", webhookURL)
+	}
+	switch format {
+	case notifySlack, notifyTeams, notifyJSON:
+	case notifyAuto:
+		switch host := u.Hostname(); {
+		case host == "hooks.slack.com":
+			format = notifySlack
+		case strings.HasSuffix(host, ".webhook.office.com"), strings.HasSuffix(host, ".logic.azure.com"):
+			format = notifyTeams
+		default:
+			format = notifyJSON
+		}
+	default:
+		return nil, xerrors.Errorf("unknown --notify-format %q, expected auto, slack, teams or json", format)
+	}
+	return &notifier{url: webhookURL, format: format, use: use, client: &http.Client{Timeout: runStatusTimeout}}, nil
+}
+
+// notify posts n. It is a no-op if no is nil.
+func (no *notifier) notify(ctx context.Context, n notification) error {
+	if no == nil {
+		return nil
+	}
+	var payload interface{}
+	switch no.format {
+	case notifySlack:
+		payload = map[string]string{"text": n.text(no.use)}
+	case notifyTeams:
+		payload = map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  n.event().Message,
+			"text":     n.text(no.use),
+		}
+	default:
+		payload = n
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, no.url, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := no.client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("post notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return xerrors.Errorf("post notification: unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// notifyOwnersConfig holds the flags of notify-owners.
+type notifyOwnersConfig struct {
+	gracePeriod time.Duration
+	emailDomain string
+	mail        mailOptions
+}
+
+func newNotifyOwnersCommand(a *app) *cobra.Command {
+	var c notifyOwnersConfig
+	notifyOwnersCmd := &cobra.Command{
+		Use:   "notify-owners",
+		Short: "email the owners of marked disks when cleanup deletes them and how to keep them",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if c.emailDomain == "" {
+				return xerrors.Errorf("--owner-email-domain is required")
+			}
+			m, err := newMailer(c.mail)
+			if err != nil {
+				return err
+			}
+			targetZones, err := a.zones()
+			if err != nil {
+				return err
+			}
+			projects, err := a.projects(cmd.Context())
+			if err != nil {
+				return err
+			}
+			disks, err := listMarkedDisks(cmd.Context(), a.disksClient, projects, targetZones, a.tenant, a.selector, c.gracePeriod, a.loadPrices(cmd.Context()))
+			if err != nil {
+				return err
+			}
+			return notifyOwners(cmd.Context(), m, disks, ownerNotice{
+				Use:         a.opts.Use,
+				OwnerLabel:  a.cfg.ownerLabel,
+				EmailDomain: c.emailDomain,
+				ExemptLabel: a.cfg.exemptLabel,
+				DryRun:      a.cfg.dryRun,
+			})
+		},
+	}
+	notifyOwnersCmd.PersistentFlags().DurationVar(&c.gracePeriod, "grace-period", 7*24*time.Hour, "grace period of cleanup, to tell owners when their disks are deleted")
+	notifyOwnersCmd.PersistentFlags().StringVar(&c.emailDomain, "owner-email-domain", "", "domain of the owners' email addresses, e.g. example.com to email jdoe@example.com for owner=jdoe")
+	notifyOwnersCmd.PersistentFlags().StringVar(&c.mail.From, "email-from", "", "sender address of the emails")
+	notifyOwnersCmd.PersistentFlags().StringVar(&c.mail.SMTPAddr, "smtp-addr", "", "send emails through this SMTP server, as host:port")
+	notifyOwnersCmd.PersistentFlags().StringVar(&c.mail.SMTPUsername, "smtp-username", "", "username to authenticate to --smtp-addr with, if any")
+	notifyOwnersCmd.PersistentFlags().StringVar(&c.mail.SMTPPasswordFile, "smtp-password-file", "", "file holding the password of --smtp-username")
+	notifyOwnersCmd.PersistentFlags().StringVar(&c.mail.SendGridKeyFile, "sendgrid-api-key-file", "", "send emails through SendGrid with the API key in this file instead of SMTP")
+	return notifyOwnersCmd
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewNotifier(t *testing.T) {
+	t.Parallel()
+
+	for _, testCase := range []struct {
+		name   string
+		url    string
+		format string
+		expect string
+		err    string
+	}{
+		{name: "slack", url: "https://hooks.slack.com/services/T/B/x", format: notifyAuto, expect: notifySlack},
+		{name: "teams", url: "https://example.webhook.office.com/webhookb2/x", format: notifyAuto, expect: notifyTeams},
+		{name: "generic", url: "https://alerts.example.com/disks", format: notifyAuto, expect: notifyJSON},
+		{name: "explicit", url: "https://chat.example.com/hook", format: notifySlack, expect: notifySlack},
+		{name: "invalid url", url: "hooks.slack.com/services", format: notifyAuto, err: `invalid --notify-webhook "hooks.slack.com/services": expected an http or https URL`},
+		{name: "unknown format", url: "https://hooks.slack.com/services/T/B/x", format: "email", err: `unknown --notify-format "email", expected auto, slack, teams or json`},
+	} {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			n, err := newNotifier(testCase.url, testCase.format, "gke-disk-cleanup")
+			if testCase.err != "" {
+				require.EqualError(t, err, testCase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, testCase.expect, n.format)
+		})
+	}
+}
+
+func Test_Notify(t *testing.T) {
+	t.Parallel()
+
+	started := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	n := notification{
+		runStatus: newRunStatus("mark", started, started.Add(time.Minute), false, &summaryCounts{Scanned: 4, Marked: 3, AffectedGB: 300, MonthlyCost: 12}, nil),
+		MarkedDisks: []newlyMarkedDisk{
+			{ProjectID: "p", Zone: "us-east1-b", Name: "pvc-a", Cluster: "prod", SizeGB: 100},
+			{ProjectID: "p", Zone: "us-east1-b", Name: "pvc-b", SizeGB: 100},
+		},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, "mark finished in 1m0s: 4 scanned, 3 marked, 0 unmarked, 0 skipped, 0 snapshotted, 0 deleted, 0 failed\n"+
+			"The marked disks (300 GB) cost an estimated $12.00 per month.\n\n"+
+			"Marked for deletion:\n"+
+			"- `pvc-a` in p/us-east1-b, 100 GB, cluster prod\n"+
+			"- `pvc-b` in p/us-east1-b, 100 GB\n"+
+			"- and 1 more\n\n"+
+			"To keep a disk, run `gke-disk-cleanup unmark <disk-name> --project-id <project> --zone <zone>` before the next cleanup.", n.text("gke-disk-cleanup"))
+	})
+
+	post := func(t *testing.T, format string, status int) (map[string]interface{}, error) {
+		var got map[string]interface{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			w.WriteHeader(status)
+		}))
+		t.Cleanup(srv.Close)
+		no, err := newNotifier(srv.URL, format, "gke-disk-cleanup")
+		require.NoError(t, err)
+		return got, no.notify(context.Background(), n)
+	}
+
+	t.Run("slack", func(t *testing.T) {
+		t.Parallel()
+		got, err := post(t, notifySlack, http.StatusOK)
+		require.NoError(t, err)
+		require.Equal(t, n.text("gke-disk-cleanup"), got["text"])
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		got, err := post(t, notifyAuto, http.StatusNoContent)
+		require.NoError(t, err)
+		require.Equal(t, "mark", got["command"])
+		require.Equal(t, float64(3), got["marked"])
+		require.Equal(t, float64(12), got["estimatedMonthlyCostUSD"])
+		require.Len(t, got["markedDisks"], 2)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		t.Parallel()
+		_, err := post(t, notifySlack, http.StatusNotFound)
+		require.EqualError(t, err, "post notification: unexpected status 404 Not Found")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		var no *notifier
+		require.NoError(t, no.notify(context.Background(), n))
+	})
+}
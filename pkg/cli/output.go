@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+const (
+	outputConsole = "console"
+	outputJSON    = "json"
+)
+
+// diskResult is the machine-readable record of the outcome for one disk.
+type diskResult struct {
+	ProjectID string `json:"projectID"`
+	Zone      string `json:"zone"`
+	Name      string `json:"name"`
+	SelfLink  string `json:"selfLink"`
+	// Cluster is the GKE cluster the disk was created for, if known.
+	Cluster string `json:"cluster,omitempty"`
+	// Namespace and PVC are the PersistentVolumeClaim and PV the
+	// PersistentVolume the disk was provisioned for, if known.
+	Namespace string `json:"namespace,omitempty"`
+	PVC       string `json:"pvc,omitempty"`
+	PV        string `json:"pv,omitempty"`
+	Action    string `json:"action"`
+	// Type is the disk type, e.g. pd-balanced.
+	Type string `json:"type,omitempty"`
+	// Source is what the disk was created from, e.g. image.
+	Source cleanup.Source `json:"source"`
+	SizeGB int64          `json:"sizeGB"`
+	DryRun bool           `json:"dryRun"`
+	Error  string         `json:"error,omitempty"`
+	// Code classifies Error, e.g. WITHIN_CUTOFF for a deliberate skip.
+	Code diskerr.Code `json:"code,omitempty"`
+	// Score is the rating of the disk by the score model, if it was scored.
+	Score *float64 `json:"score,omitempty"`
+}
+
+// resultWriter writes a diskResult as a JSON line for every processed disk.
+type resultWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newResultWriter(w io.Writer) *resultWriter {
+	return &resultWriter{enc: json.NewEncoder(w)}
+}
+
+func (r *resultWriter) handle(e events.Event) {
+	if e.Type != events.DiskProcessed {
+		return
+	}
+	result := newDiskResult(e)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(result); err != nil {
+		log.Error().Err(err).Msg("unable to write result")
+	}
+}
+
+// newDiskResult returns the result recorded by the DiskProcessed event e.
+func newDiskResult(e events.Event) diskResult {
+	result := diskResult{
+		ProjectID: e.ProjectID,
+		Zone:      e.Zone,
+		Name:      e.Disk.GetName(),
+		SelfLink:  e.Disk.GetSelfLink(),
+		Cluster:   cleanup.Cluster(e.Disk),
+		Action:    e.Action,
+		Source:    cleanup.DiskSource(e.Disk),
+		SizeGB:    e.Disk.GetSizeGb(),
+		DryRun:    e.DryRun,
+		Score:     e.Score,
+	}
+	if diskType := e.Disk.GetType(); diskType != "" {
+		result.Type = path.Base(diskType)
+	}
+	claim := cleanup.ClaimOf(e.Disk)
+	result.Namespace, result.PVC, result.PV = claim.Namespace, claim.Name, claim.Volume
+	if e.Err != nil {
+		result.Error = e.Err.Error()
+		result.Code = diskerr.CodeOf(e.Err)
+	}
+	return result
+}
+
+// setupLogging configures the global logger to write to stderr, either for
+// humans, as JSON lines, or as JSON lines for Cloud Logging. The log format
+// follows --output unless --log-format is set.
+func setupLogging(verbose bool, output, logFormat, command, projectID string) error {
+	level := zerolog.InfoLevel
+	if verbose {
+		level = zerolog.DebugLevel
+	}
+	if output != outputConsole && output != outputJSON {
+		return xerrors.Errorf("invalid --output %q: expected %s or %s", output, outputConsole, outputJSON)
+	}
+	if logFormat == "" {
+		logFormat = output
+	}
+	switch logFormat {
+	case outputConsole:
+		// pretty logging
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr}).Level(level)
+	case outputJSON:
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger().Level(level)
+	case logFormatGCP:
+		log.Logger = newGCPLogger(os.Stderr, command, projectID, newTraceID()).Level(level)
+	default:
+		return xerrors.Errorf("invalid --log-format %q: expected %s, %s or %s", logFormat, outputConsole, outputJSON, logFormatGCP)
+	}
+	return nil
+}
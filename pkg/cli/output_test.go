@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_ResultWriter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := newResultWriter(&buf)
+	disk := &computepb.Disk{Name: pointer.String("test-disk"), SizeGb: pointer.Int64(10)}
+	w.handle(events.Event{Type: events.DiskScanned, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Action: "MARK"})
+	w.handle(events.Event{Type: events.DiskProcessed, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Action: "MARK"})
+	w.handle(events.Event{Type: events.DiskProcessed, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Action: "SKIP", DryRun: true, Err: diskerr.ErrWithinCutoff})
+	score := 0.25
+	w.handle(events.Event{Type: events.DiskProcessed, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Action: "SKIP", Score: &score, Err: diskerr.ErrLowScore})
+	w.handle(events.Event{Type: events.DiskProcessed, ProjectID: "testing", Zone: "us-east1-b", Action: "MARK", Disk: &computepb.Disk{
+		Name:           pointer.String("gke-prod-6d8b1ed2-dynamic-pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c"),
+		Type:           pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/diskTypes/pd-balanced"),
+		SizeGb:         pointer.Int64(10),
+		SourceSnapshot: pointer.String("projects/testing/global/snapshots/backup"),
+		Description:    pointer.String(`{"kubernetes.io/created-for/pv/name":"pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c","kubernetes.io/created-for/pvc/name":"data-postgres-0","kubernetes.io/created-for/pvc/namespace":"payments"}`),
+	}})
+
+	require.Equal(t, `{"projectID":"testing","zone":"us-east1-b","name":"test-disk","selfLink":"","action":"MARK","source":"blank","sizeGB":10,"dryRun":false}
+{"projectID":"testing","zone":"us-east1-b","name":"test-disk","selfLink":"","action":"SKIP","source":"blank","sizeGB":10,"dryRun":true,"error":"disk last attached within cutoff","code":"WITHIN_CUTOFF"}
+{"projectID":"testing","zone":"us-east1-b","name":"test-disk","selfLink":"","action":"SKIP","source":"blank","sizeGB":10,"dryRun":false,"error":"disk scored below the threshold","code":"LOW_SCORE","score":0.25}
+{"projectID":"testing","zone":"us-east1-b","name":"gke-prod-6d8b1ed2-dynamic-pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c","selfLink":"","cluster":"prod","namespace":"payments","pvc":"data-postgres-0","pv":"pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c","action":"MARK","type":"pd-balanced","source":"snapshot","sizeGB":10,"dryRun":false}
+`, buf.String())
+}
+
+func Test_SetupLogging(t *testing.T) {
+	require.NoError(t, setupLogging(false, outputJSON, "", "mark", ""))
+	require.NoError(t, setupLogging(true, outputConsole, "", "mark", ""))
+	require.NoError(t, setupLogging(false, outputJSON, logFormatGCP, "mark", "testing"))
+	require.EqualError(t, setupLogging(false, "yaml", "", "mark", ""), `invalid --output "yaml": expected console or json`)
+	require.EqualError(t, setupLogging(false, outputConsole, "yaml", "mark", ""), `invalid --log-format "yaml": expected console, json or gcp`)
+}
@@ -0,0 +1,253 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+)
+
+// defaultOwnerLabel is the label naming the owner of a disk.
+const defaultOwnerLabel = "owner"
+
+// sendGridURL is the SendGrid v3 API endpoint sending mail.
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// mailer sends plain text emails.
+type mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+//go:generate moq -fmt goimports -out mock_mailer.go . mailer
+
+// mailOptions configures newMailer. Exactly one of SMTPAddr and
+// SendGridKeyFile must be set.
+type mailOptions struct {
+	From string
+	// SMTPAddr is the host:port of an SMTP server, which is used with
+	// STARTTLS if it supports it.
+	SMTPAddr string
+	// SMTPUsername and SMTPPasswordFile authenticate with PLAIN, if set.
+	SMTPUsername     string
+	SMTPPasswordFile string
+	// SendGridKeyFile holds a SendGrid API key allowed to send mail.
+	SendGridKeyFile string
+}
+
+// newMailer returns the mailer configured by opts.
+func newMailer(opts mailOptions) (mailer, error) {
+	if opts.From == "" {
+		return nil, xerrors.Errorf("--email-from is required")
+	}
+	switch {
+	case opts.SMTPAddr != "" && opts.SendGridKeyFile != "":
+		return nil, xerrors.Errorf("--smtp-addr and --sendgrid-api-key-file are mutually exclusive")
+	case opts.SMTPAddr != "":
+		m := &smtpMailer{addr: opts.SMTPAddr, from: opts.From}
+		if opts.SMTPUsername != "" {
+			password, err := readSecret(opts.SMTPPasswordFile, "smtp password")
+			if err != nil {
+				return nil, err
+			}
+			host := opts.SMTPAddr
+			if i := strings.LastIndex(host, ":"); i >= 0 {
+				host = host[:i]
+			}
+			m.auth = smtp.PlainAuth("", opts.SMTPUsername, password, host)
+		}
+		return m, nil
+	case opts.SendGridKeyFile != "":
+		key, err := readSecret(opts.SendGridKeyFile, "sendgrid api key")
+		if err != nil {
+			return nil, err
+		}
+		return &sendGridMailer{url: sendGridURL, key: key, from: opts.From, client: &http.Client{Timeout: time.Minute}}, nil
+	default:
+		return nil, xerrors.Errorf("--smtp-addr or --sendgrid-api-key-file is required")
+	}
+}
+
+// readSecret returns the trimmed content of file, which holds what.
+func readSecret(file, what string) (string, error) {
+	if file == "" {
+		return "", xerrors.Errorf("no file holding the %s given", what)
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return "", xerrors.Errorf("read %s: %w", what, err)
+	}
+	return string(bytes.TrimSpace(raw)), nil
+}
+
+// smtpMailer sends mail through an SMTP server.
+type smtpMailer struct {
+	addr string
+	from string
+	// auth may be nil for servers accepting mail without authentication.
+	auth smtp.Auth
+}
+
+func (m *smtpMailer) Send(_ context.Context, to, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", m.from, to, subject, time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, msg.Bytes()); err != nil {
+		return xerrors.Errorf("send mail to %s: %w", to, err)
+	}
+	return nil
+}
+
+// sendGridMailer sends mail through the SendGrid v3 API.
+type sendGridMailer struct {
+	url    string
+	key    string
+	from   string
+	client *http.Client
+}
+
+func (m *sendGridMailer) Send(ctx context.Context, to, subject, body string) error {
+	type address struct {
+		Email string `json:"email"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	raw, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string][]address{{"to": {{Email: to}}}},
+		"from":             address{Email: m.from},
+		"subject":          subject,
+		"content":          []content{{Type: "text/plain", Value: body}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.url, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.key)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return xerrors.Errorf("send mail to %s: %w", to, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return xerrors.Errorf("send mail to %s: unexpected status %s", to, resp.Status)
+	}
+	return nil
+}
+
+// ownerNotice configures notifyOwners.
+type ownerNotice struct {
+	// Use is the name of the command, for the unmark hint.
+	Use string
+	// OwnerLabel names the owner of a disk, a username.
+	OwnerLabel string
+	// EmailDomain is appended to the username to email an owner.
+	EmailDomain string
+	// ExemptLabel keeps a disk from being deleted, empty if disabled.
+	ExemptLabel string
+	DryRun      bool
+}
+
+// disksByOwner groups disks by the value of ownerLabel, and returns the
+// owners in order. Disks without an owner are left out.
+func disksByOwner(disks []markedDisk, ownerLabel string) (owners []string, byOwner map[string][]markedDisk) {
+	byOwner = make(map[string][]markedDisk)
+	for _, d := range disks {
+		owner := d.labels[ownerLabel]
+		if owner == "" {
+			continue
+		}
+		if _, ok := byOwner[owner]; !ok {
+			owners = append(owners, owner)
+		}
+		byOwner[owner] = append(byOwner[owner], d)
+	}
+	sort.Strings(owners)
+	return owners, byOwner
+}
+
+// deadline tells the owner of d when it is deleted.
+func (d markedDisk) deadline() string {
+	switch {
+	case d.Deletable:
+		return "by the next cleanup run"
+	case d.DeletableAfter != nil:
+		return "after " + d.DeletableAfter.Format("Mon, 02 Jan 2006 15:04 MST")
+	default:
+		return "once its grace period ends, which starts with the next mark run"
+	}
+}
+
+// ownerEmail returns the subject and body of the email to owner about disks.
+func ownerEmail(notice ownerNotice, owner string, disks []markedDisk) (subject, body string) {
+	subject = fmt.Sprintf("%d %s of yours will be deleted", len(disks), plural(len(disks), "disk", "disks"))
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hello %s,\n\nthe following %s labelled %s=%s %s unused and marked for deletion. Each is snapshotted before it is deleted.\n\n",
+		owner, plural(len(disks), "disk", "disks"), notice.OwnerLabel, owner, plural(len(disks), "is", "are"))
+	for _, d := range disks {
+		fmt.Fprintf(&b, "- %s (project %s, zone %s, %d GB", d.Name, d.ProjectID, d.Zone, d.SizeGB)
+		if d.Type != "" {
+			fmt.Fprintf(&b, " %s", d.Type)
+		}
+		fmt.Fprintf(&b, ", $%.2f per month): deleted %s\n", d.MonthlyCost, d.deadline())
+	}
+	b.WriteString("\nTo keep a disk, unmark it before its deadline:\n\n")
+	fmt.Fprintf(&b, "  %s unmark <disk-name> --project-id <project> --zone <zone> --dry-run=false\n", notice.Use)
+	if notice.ExemptLabel != "" {
+		fmt.Fprintf(&b, "\nTo keep a disk for good, label it %s=true, which neither mark nor cleanup touch:\n\n", notice.ExemptLabel)
+		fmt.Fprintf(&b, "  gcloud compute disks add-labels <disk-name> --project <project> --zone <zone> --labels %s=true\n", notice.ExemptLabel)
+	}
+	return subject, b.String()
+}
+
+// notifyOwners emails the owner of every disk in disks the list of their
+// disks. It returns an error if an email could not be sent, after trying
+// the others.
+func notifyOwners(ctx context.Context, m mailer, disks []markedDisk, notice ownerNotice) error {
+	owners, byOwner := disksByOwner(disks, notice.OwnerLabel)
+	var failed int
+	for _, owner := range owners {
+		to := owner + "@" + notice.EmailDomain
+		subject, body := ownerEmail(notice, owner, byOwner[owner])
+		logger := log.With().Str("owner", owner).Str("to", to).Int("disks", len(byOwner[owner])).Logger()
+		if notice.DryRun {
+			logger.Info().Msg("dry run -- would email owner")
+			continue
+		}
+		if err := m.Send(ctx, to, subject, body); err != nil {
+			logger.Error().Err(err).Msg("unable to email owner")
+			failed++
+			continue
+		}
+		logger.Info().Msg("emailed owner")
+	}
+	if unowned := len(disks) - countDisks(byOwner); unowned > 0 {
+		log.Warn().Str("ownerLabel", notice.OwnerLabel).Int("disks", unowned).Msg("marked disks without an owner label")
+	}
+	if failed > 0 {
+		return xerrors.Errorf("%d of %d owners could not be emailed", failed, len(owners))
+	}
+	return nil
+}
+
+func countDisks(byOwner map[string][]markedDisk) int {
+	var n int
+	for _, disks := range byOwner {
+		n += len(disks)
+	}
+	return n
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func Test_NotifyOwners(t *testing.T) {
+	t.Parallel()
+
+	after := time.Date(2022, 3, 8, 0, 0, 0, 0, time.UTC)
+	disks := []markedDisk{
+		{ProjectID: "p", Zone: "us-east1-b", Name: "pvc-a", Type: "pd-ssd", SizeGB: 100, MonthlyCost: 17, DeletableAfter: &after, labels: map[string]string{"owner": "jdoe"}},
+		{ProjectID: "p", Zone: "us-east1-b", Name: "pvc-b", SizeGB: 10, MonthlyCost: 0.4, Deletable: true, labels: map[string]string{"owner": "asmith"}},
+		{ProjectID: "p", Zone: "us-east1-c", Name: "pvc-c", SizeGB: 20, MonthlyCost: 0.8, labels: map[string]string{"owner": "jdoe"}},
+		{ProjectID: "p", Zone: "us-east1-c", Name: "orphan", SizeGB: 20},
+	}
+	notice := ownerNotice{Use: "gke-disk-cleanup", OwnerLabel: "owner", EmailDomain: "example.com", ExemptLabel: "exempt"}
+
+	t.Run("email", func(t *testing.T) {
+		t.Parallel()
+		subject, body := ownerEmail(notice, "jdoe", []markedDisk{disks[0], disks[2]})
+		require.Equal(t, "2 disks of yours will be deleted", subject)
+		require.Equal(t, `Hello jdoe,
+
+the following disks labelled owner=jdoe are unused and marked for deletion. Each is snapshotted before it is deleted.
+
+- pvc-a (project p, zone us-east1-b, 100 GB pd-ssd, $17.00 per month): deleted after Tue, 08 Mar 2022 00:00 UTC
+- pvc-c (project p, zone us-east1-c, 20 GB, $0.80 per month): deleted once its grace period ends, which starts with the next mark run
+
+To keep a disk, unmark it before its deadline:
+
+  gke-disk-cleanup unmark <disk-name> --project-id <project> --zone <zone> --dry-run=false
+
+To keep a disk for good, label it exempt=true, which neither mark nor cleanup touch:
+
+  gcloud compute disks add-labels <disk-name> --project <project> --zone <zone> --labels exempt=true
+`, body)
+	})
+
+	t.Run("grouped by owner", func(t *testing.T) {
+		t.Parallel()
+		m := &mailerMock{
+			SendFunc: func(ctx context.Context, to string, subject string, body string) error {
+				return nil
+			},
+		}
+		require.NoError(t, notifyOwners(context.Background(), m, disks, notice))
+		calls := m.SendCalls()
+		require.Len(t, calls, 2)
+		require.Equal(t, "asmith@example.com", calls[0].To)
+		require.Equal(t, "1 disk of yours will be deleted", calls[0].Subject)
+		require.Contains(t, calls[0].Body, "pvc-b (project p, zone us-east1-b, 10 GB, $0.40 per month): deleted by the next cleanup run")
+		require.Equal(t, "jdoe@example.com", calls[1].To)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Parallel()
+		m := &mailerMock{}
+		notice := notice
+		notice.DryRun = true
+		require.NoError(t, notifyOwners(context.Background(), m, disks, notice))
+		require.Empty(t, m.SendCalls())
+	})
+
+	t.Run("send error", func(t *testing.T) {
+		t.Parallel()
+		m := &mailerMock{
+			SendFunc: func(ctx context.Context, to string, subject string, body string) error {
+				if to == "asmith@example.com" {
+					return xerrors.New("mailbox unavailable")
+				}
+				return nil
+			},
+		}
+		err := notifyOwners(context.Background(), m, disks, notice)
+		require.EqualError(t, err, "1 of 2 owners could not be emailed")
+		// the other owners are still emailed
+		require.Len(t, m.SendCalls(), 2)
+	})
+}
+
+func Test_NewMailer(t *testing.T) {
+	t.Parallel()
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("SG.secret\n"), 0o600))
+
+	for _, testCase := range []struct {
+		name string
+		opts mailOptions
+		err  string
+	}{
+		{name: "smtp", opts: mailOptions{From: "cleanup@example.com", SMTPAddr: "smtp.example.com:587"}},
+		{name: "sendgrid", opts: mailOptions{From: "cleanup@example.com", SendGridKeyFile: keyFile}},
+		{name: "no sender", opts: mailOptions{SMTPAddr: "smtp.example.com:587"}, err: "--email-from is required"},
+		{name: "no transport", opts: mailOptions{From: "cleanup@example.com"}, err: "--smtp-addr or --sendgrid-api-key-file is required"},
+		{name: "both transports", opts: mailOptions{From: "cleanup@example.com", SMTPAddr: "smtp.example.com:587", SendGridKeyFile: keyFile}, err: "--smtp-addr and --sendgrid-api-key-file are mutually exclusive"},
+		{name: "no password", opts: mailOptions{From: "cleanup@example.com", SMTPAddr: "smtp.example.com:587", SMTPUsername: "cleanup"}, err: "no file holding the smtp password given"},
+	} {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := newMailer(testCase.opts)
+			if testCase.err != "" {
+				require.EqualError(t, err, testCase.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_SendGridMailer(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer SG.secret", r.Header.Get("Authorization"))
+		var req struct {
+			Personalizations []struct {
+				To []struct {
+					Email string `json:"email"`
+				} `json:"to"`
+			} `json:"personalizations"`
+			From struct {
+				Email string `json:"email"`
+			} `json:"from"`
+			Subject string `json:"subject"`
+			Content []struct {
+				Type  string `json:"type"`
+				Value string `json:"value"`
+			} `json:"content"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "jdoe@example.com", req.Personalizations[0].To[0].Email)
+		require.Equal(t, "cleanup@example.com", req.From.Email)
+		require.Equal(t, "1 disk of yours will be deleted", req.Subject)
+		require.Equal(t, "text/plain", req.Content[0].Type)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+
+	m := &sendGridMailer{url: srv.URL, key: "SG.secret", from: "cleanup@example.com", client: srv.Client()}
+	require.NoError(t, m.Send(context.Background(), "jdoe@example.com", "1 disk of yours will be deleted", "body"))
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/xerrors"
+)
+
+// requiredPermissions returns the IAM permissions a mark or cleanup run
+// needs in every project, with snapshots taken before deleting disks if
+// snapshot is set.
+func requiredPermissions(command string, snapshot bool) []string {
+	permissions := []string{"compute.disks.list", "compute.disks.setLabels"}
+	if command != "cleanup" {
+		return permissions
+	}
+	permissions = append(permissions, "compute.disks.delete")
+	if snapshot {
+		permissions = append(permissions, "compute.disks.createSnapshot", "compute.snapshots.create", "compute.snapshots.get")
+	}
+	return permissions
+}
+
+// missingPermissions returns the permissions the caller lacks in each of
+// projects, keyed by project. Projects lacking none are left out.
+func missingPermissions(ctx context.Context, rm resourceManager, projects, permissions []string) (map[string][]string, error) {
+	missing := make(map[string][]string)
+	for _, projectID := range projects {
+		granted, err := rm.TestPermissions(ctx, projectID, permissions)
+		if err != nil {
+			return nil, xerrors.Errorf("test permissions in project %s: %w", projectID, err)
+		}
+		has := make(map[string]bool, len(granted))
+		for _, permission := range granted {
+			has[permission] = true
+		}
+		for _, permission := range permissions {
+			if !has[permission] {
+				missing[projectID] = append(missing[projectID], permission)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// permissionsError returns the error listing the missing permissions, nil if
+// there are none.
+func permissionsError(missing map[string][]string) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	projects := make([]string, 0, len(missing))
+	for projectID := range missing {
+		projects = append(projects, projectID)
+	}
+	sort.Strings(projects)
+	parts := make([]string, 0, len(projects))
+	for _, projectID := range projects {
+		parts = append(parts, fmt.Sprintf("project %s: %s", projectID, strings.Join(missing[projectID], ", ")))
+	}
+	return &exitError{code: ExitAuth, msg: "missing permissions in " + strings.Join(parts, "; ")}
+}
+
+// checkPermissions fails with the permissions a run of command lacks in any
+// of projects.
+func checkPermissions(ctx context.Context, rm resourceManager, projects []string, command string, snapshot bool) error {
+	missing, err := missingPermissions(ctx, rm, projects, requiredPermissions(command, snapshot))
+	if err != nil {
+		return err
+	}
+	return permissionsError(missing)
+}
+
+// writePermissionCheck checks the permissions of mark and cleanup runs in
+// every project, and writes a table of those missing to w. It fails if any
+// are missing.
+func writePermissionCheck(ctx context.Context, w io.Writer, rm resourceManager, projects []string, snapshot bool) error {
+	commands := []string{"mark", "cleanup"}
+	missing := make(map[string]map[string][]string)
+	lacking := make(map[string][]string)
+	for _, command := range commands {
+		m, err := missingPermissions(ctx, rm, projects, requiredPermissions(command, snapshot))
+		if err != nil {
+			return err
+		}
+		missing[command] = m
+		for projectID, permissions := range m {
+			lacking[projectID] = mergePermissions(lacking[projectID], permissions)
+		}
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROJECT\tCOMMAND\tMISSING")
+	for _, projectID := range projects {
+		for _, command := range commands {
+			state := "-"
+			if permissions := missing[command][projectID]; len(permissions) > 0 {
+				state = strings.Join(permissions, ", ")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", projectID, command, state)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return permissionsError(lacking)
+}
+
+// mergePermissions returns the permissions in a or b, in order of first
+// appearance.
+func mergePermissions(a, b []string) []string {
+	seen := make(map[string]bool, len(a))
+	for _, permission := range a {
+		seen[permission] = true
+	}
+	for _, permission := range b {
+		if !seen[permission] {
+			seen[permission] = true
+			a = append(a, permission)
+		}
+	}
+	return a
+}
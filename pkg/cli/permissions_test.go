@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func Test_RequiredPermissions(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, []string{"compute.disks.list", "compute.disks.setLabels"}, requiredPermissions("mark", true))
+	require.Equal(t, []string{"compute.disks.list", "compute.disks.setLabels", "compute.disks.delete"}, requiredPermissions("cleanup", false))
+	require.Equal(t, []string{"compute.disks.list", "compute.disks.setLabels", "compute.disks.delete", "compute.disks.createSnapshot", "compute.snapshots.create", "compute.snapshots.get"}, requiredPermissions("cleanup", true))
+}
+
+func Test_CheckPermissions(t *testing.T) {
+	t.Parallel()
+
+	granted := map[string][]string{
+		"full":     {"compute.disks.list", "compute.disks.setLabels", "compute.disks.delete", "compute.disks.createSnapshot", "compute.snapshots.create", "compute.snapshots.get"},
+		"labeler":  {"compute.disks.list", "compute.disks.setLabels"},
+		"readonly": {"compute.disks.list"},
+	}
+	rm := &resourceManagerMock{
+		TestPermissionsFunc: func(_ context.Context, projectID string, permissions []string) ([]string, error) {
+			if projectID == "broken" {
+				return nil, xerrors.New("boom")
+			}
+			var has []string
+			for _, permission := range permissions {
+				for _, g := range granted[projectID] {
+					if g == permission {
+						has = append(has, permission)
+					}
+				}
+			}
+			return has, nil
+		},
+	}
+	ctx := context.Background()
+
+	require.NoError(t, checkPermissions(ctx, rm, []string{"full", "labeler"}, "mark", true))
+	require.NoError(t, checkPermissions(ctx, rm, []string{"full"}, "cleanup", true))
+	err := checkPermissions(ctx, rm, []string{"full", "readonly", "labeler"}, "cleanup", false)
+	require.EqualError(t, err, "missing permissions in project labeler: compute.disks.delete; project readonly: compute.disks.setLabels, compute.disks.delete")
+	require.Equal(t, ExitAuth, ExitCode(err))
+	require.EqualError(t, checkPermissions(ctx, rm, []string{"broken"}, "mark", true), "test permissions in project broken: boom")
+
+	var buf bytes.Buffer
+	err = writePermissionCheck(ctx, &buf, rm, []string{"full", "labeler"}, true)
+	require.EqualError(t, err, "missing permissions in project labeler: compute.disks.delete, compute.disks.createSnapshot, compute.snapshots.create, compute.snapshots.get")
+	require.Equal(t, `PROJECT  COMMAND  MISSING
+full     mark     -
+full     cleanup  -
+labeler  mark     -
+labeler  cleanup  compute.disks.delete, compute.disks.createSnapshot, compute.snapshots.create, compute.snapshots.get
+`, buf.String())
+}
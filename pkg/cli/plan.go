@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/signing"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// signedPlan is a plan with its signature, as written to the store.
+// Signature signs the compact JSON encoding of Plan, which is indented in
+// the store for review.
+type signedPlan struct {
+	Plan      json.RawMessage    `json:"plan"`
+	Signature *signing.Signature `json:"signature,omitempty"`
+}
+
+// planRecorder adds the disks processed by a mark run to a plan.
+type planRecorder struct {
+	plan *cleanup.Plan
+}
+
+func (r planRecorder) handle(e events.Event) {
+	if e.Type != events.DiskProcessed {
+		return
+	}
+	r.plan.Add(e.ProjectID, e.Zone, e.Disk, cleanup.Action(e.Action), e.Err)
+}
+
+// writePlan writes plan as JSON to the file at path in s, signed by
+// signer.
+func writePlan(ctx context.Context, s store.Store, path string, plan *cleanup.Plan, signer signing.Signer) error {
+	plan.Sort()
+	payload, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	sig, err := signer.Sign(ctx, payload)
+	if err != nil {
+		return xerrors.Errorf("sign plan: %w", err)
+	}
+	data, err := json.MarshalIndent(signedPlan{Plan: payload, Signature: &sig}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, path, data); err != nil {
+		return xerrors.Errorf("write plan: %w", err)
+	}
+	deletes := 0
+	for _, d := range plan.Disks {
+		if d.Deletes() {
+			deletes++
+		}
+	}
+	log.Info().Str("path", path).Int("disks", len(plan.Disks)).Int("deletes", deletes).Msg("wrote plan")
+	return nil
+}
+
+// readPlan reads the plan written by writePlan from the file at path in s.
+// Only plans signed by the key of verifier are read, so that cleanup only
+// deletes the disks of a plan made by an authorized mark run.
+func readPlan(ctx context.Context, s store.Store, path string, verifier signing.Verifier) (*cleanup.Plan, error) {
+	data, err := s.Get(ctx, path)
+	if err != nil {
+		return nil, xerrors.Errorf("read plan: %w", err)
+	}
+	var signed signedPlan
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, xerrors.Errorf("parse plan %s: %w", path, err)
+	}
+	if len(signed.Plan) == 0 || signed.Signature == nil {
+		return nil, xerrors.Errorf("plan %s is not signed, make it again with mark --plan-out", path)
+	}
+	var payload bytes.Buffer
+	if err := json.Compact(&payload, signed.Plan); err != nil {
+		return nil, xerrors.Errorf("parse plan %s: %w", path, err)
+	}
+	if err := verifier.Verify(ctx, payload.Bytes(), *signed.Signature); err != nil {
+		return nil, xerrors.Errorf("verify signature of plan %s: %w", path, err)
+	}
+	var plan cleanup.Plan
+	if err := json.Unmarshal(signed.Plan, &plan); err != nil {
+		return nil, xerrors.Errorf("parse plan %s: %w", path, err)
+	}
+	if err := plan.Validate(); err != nil {
+		return nil, xerrors.Errorf("plan %s: %w", path, err)
+	}
+	return &plan, nil
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/signing"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_plan(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := store.Local{Dir: t.TempDir()}
+	key, err := signing.NewHMAC([]byte("secret"))
+	require.NoError(t, err)
+	plan := cleanup.NewPlan(time.Now())
+	r := planRecorder{plan: plan}
+	r.handle(events.Event{Type: events.DiskScanned, ProjectID: "p", Zone: "z", Disk: &computepb.Disk{Name: pointer.String("scanned")}, Action: string(cleanup.ActionMark)})
+	r.handle(events.Event{Type: events.DiskProcessed, ProjectID: "p", Zone: "z", Disk: &computepb.Disk{Name: pointer.String("d")}, Action: string(cleanup.ActionMark)})
+	require.NoError(t, writePlan(ctx, s, "plan.json", plan, key))
+
+	read, err := readPlan(ctx, s, "plan.json", key)
+	require.NoError(t, err)
+	require.Len(t, read.Disks, 1)
+	require.Equal(t, "d", read.Disks[0].Name)
+	require.True(t, read.Disks[0].Deletes())
+
+	_, err = readPlan(ctx, s, "missing.json", key)
+	require.Error(t, err)
+
+	other, err := signing.NewHMAC([]byte("other"))
+	require.NoError(t, err)
+	_, err = readPlan(ctx, s, "plan.json", other)
+	require.ErrorContains(t, err, "verify signature of plan plan.json: signed by")
+
+	data, err := s.Get(ctx, "plan.json")
+	require.NoError(t, err)
+	require.NoError(t, s.Put(ctx, "tampered.json", []byte(strings.Replace(string(data), `"name": "d"`, `"name": "other"`, 1))))
+	_, err = readPlan(ctx, s, "tampered.json", key)
+	require.EqualError(t, err, "verify signature of plan tampered.json: signature does not match")
+
+	require.NoError(t, s.Put(ctx, "unsigned.json", []byte(`{"version": 1, "disks": [{"projectID": "p", "zone": "z", "name": "d", "action": "mark"}]}`)))
+	_, err = readPlan(ctx, s, "unsigned.json", key)
+	require.EqualError(t, err, "plan unsigned.json is not signed, make it again with mark --plan-out")
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/policy"
+)
+
+// annotationOffline marks commands that do not call any API, so no clients
+// are created for them.
+const annotationOffline = "gke-disk-cleanup/offline"
+
+// testPolicy evaluates the policy against the fixtures in fixturesDir, logs
+// the outcome of each, and fails if any fixture failed. The policy is read
+// from settingsFile, and its rules from markPolicyFile, the file of mark
+// --mark-policy, if set.
+func testPolicy(settingsFile, markPolicyFile, fixturesDir string) error {
+	if fixturesDir == "" {
+		return xerrors.Errorf("--fixtures is required")
+	}
+	var p policy.Policy
+	if settingsFile != "" {
+		var err error
+		if p, err = policy.Load(settingsFile); err != nil {
+			return err
+		}
+	}
+	if markPolicyFile != "" {
+		rule, err := policy.LoadRule(markPolicyFile)
+		if err != nil {
+			return err
+		}
+		p.Rules = &rule
+	}
+	fixtures, err := policy.LoadFixtures(fixturesDir)
+	if err != nil {
+		return err
+	}
+	results, err := policy.Run(p, fixtures)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, r := range results {
+		if r.Passed() {
+			log.Info().Str("fixture", r.Fixture.Name).Str("action", string(r.Action)).Str("code", string(r.Code)).Msg("PASS")
+			continue
+		}
+		failed++
+		log.Error().Str("fixture", r.Fixture.Name).
+			Str("expected", string(r.Fixture.Expect)).
+			Str("expectedCode", string(r.Fixture.ExpectCode)).
+			Str("action", string(r.Action)).
+			Str("code", string(r.Code)).
+			AnErr("reason", r.Err).
+			Msg("FAIL")
+	}
+	log.Info().Int("fixtures", len(results)).Int("passed", len(results)-failed).Int("failed", failed).Msg("policy test summary")
+	if failed > 0 {
+		return xerrors.Errorf("%d of %d fixtures failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// policyTestConfig holds the flags of policy test.
+type policyTestConfig struct {
+	settingsFile   string
+	markPolicyFile string
+	fixturesDir    string
+}
+
+func newPolicyCommand() *cobra.Command {
+	policyCmd := &cobra.Command{
+		Use:   "policy",
+		Short: "test the mark policy",
+	}
+	policyCmd.AddCommand(newPolicyTestCommand())
+	return policyCmd
+}
+
+func newPolicyTestCommand() *cobra.Command {
+	var c policyTestConfig
+	policyTestCmd := &cobra.Command{
+		Use:         "test",
+		Short:       "check that the policy takes the expected action for every disk fixture",
+		Annotations: map[string]string{annotationOffline: "true"},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return testPolicy(c.settingsFile, c.markPolicyFile, c.fixturesDir)
+		},
+	}
+	policyTestCmd.PersistentFlags().StringVar(&c.settingsFile, "settings", "", "YAML or JSON file with the mark settings to test, e.g. cutoffDays; the defaults of mark apply if not set")
+	policyTestCmd.PersistentFlags().StringVar(&c.markPolicyFile, "mark-policy", "", "--mark-policy of mark, overriding the rules of --settings")
+	policyTestCmd.PersistentFlags().StringVar(&c.fixturesDir, "fixtures", "", "directory of YAML or JSON disk fixtures")
+	return policyTestCmd
+}
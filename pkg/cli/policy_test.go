@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TestPolicy(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stale.yaml"), []byte("disk:\n  name: stale\n  lastAttachedDaysAgo: 45\nexpect: MARK\n"), 0o644))
+	require.NoError(t, testPolicy("", "", dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "recent.yaml"), []byte("disk:\n  name: recent\n  lastAttachedDaysAgo: 1\nexpect: MARK\n"), 0o644))
+	require.EqualError(t, testPolicy("", "", dir), "1 of 2 fixtures failed")
+
+	require.EqualError(t, testPolicy("", "", ""), "--fixtures is required")
+
+	// the rules of the mark policy decide recent disks are abandoned too
+	fixtures := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(fixtures, "dev.yaml"), []byte("disk:\n  name: dev\n  lastAttachedDaysAgo: 1\n  labels: {env: dev}\nexpect: MARK\n"), 0o644))
+	require.EqualError(t, testPolicy("", "", fixtures), "1 of 1 fixtures failed")
+	rules := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(rules, []byte("any: [{lastAttachedDays: 0}, {label: {key: env, value: dev}}]\n"), 0o644))
+	require.NoError(t, testPolicy("", rules, fixtures))
+	settings := filepath.Join(t.TempDir(), "settings.yaml")
+	require.NoError(t, os.WriteFile(settings, []byte("rules: {lastAttachedDays: 0}\n"), 0o644))
+	require.EqualError(t, testPolicy(settings, "", fixtures), "1 of 1 fixtures failed")
+	require.NoError(t, testPolicy(settings, rules, fixtures))
+}
@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// progressCounts tallies the events seen during a run.
+type progressCounts struct {
+	Processed int
+	Marked    int
+	Unmarked  int
+	Deleted   int
+	Errors    int
+}
+
+// progressLogger emits a heartbeat line summarising the run so far, at most
+// every interval or every n disks, whichever comes first. This keeps long
+// runs observable without logging every disk that is skipped.
+type progressLogger struct {
+	interval time.Duration
+	every    int
+	now      func() time.Time
+	emit     func(progressCounts)
+
+	mu     sync.Mutex
+	last   time.Time
+	counts progressCounts
+}
+
+// newProgressLogger returns a progressLogger. A zero interval or n disables
+// the respective trigger.
+func newProgressLogger(interval time.Duration, every int) *progressLogger {
+	return &progressLogger{
+		interval: interval,
+		every:    every,
+		now:      time.Now,
+		emit:     logProgress,
+		last:     time.Now(),
+	}
+}
+
+// add counts e, and reports whether it is the DiskScanned event of a disk.
+func (c *progressCounts) add(e events.Event) bool {
+	switch e.Type {
+	case events.DiskScanned:
+		c.Processed++
+	case events.DiskMarked:
+		c.Marked++
+	case events.DiskUnmarked:
+		c.Unmarked++
+	case events.DiskDeleted:
+		c.Deleted++
+	case events.Error:
+		c.Errors++
+	}
+	return e.Type == events.DiskScanned
+}
+
+func (p *progressLogger) handle(e events.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.counts.add(e) {
+		return
+	}
+
+	now := p.now()
+	dueCount := p.every > 0 && p.counts.Processed%p.every == 0
+	dueTime := p.interval > 0 && now.Sub(p.last) >= p.interval
+	if !dueCount && !dueTime {
+		return
+	}
+	p.last = now
+	p.emit(p.counts)
+}
+
+func logProgress(c progressCounts) {
+	log.Info().
+		Int("processed", c.Processed).
+		Int("marked", c.Marked).
+		Int("unmarked", c.Unmarked).
+		Int("deleted", c.Deleted).
+		Int("errors", c.Errors).
+		Msgf("processed %d disks, %d marked, %d unmarked, %d deleted, %d errors", c.Processed, c.Marked, c.Unmarked, c.Deleted, c.Errors)
+}
+
+// progressRedraw is how often the progress bar is redrawn at most.
+const progressRedraw = 250 * time.Millisecond
+
+// progressBar keeps a single line on a terminal up to date with the disks
+// processed so far, the actions taken and, if the number of disks is
+// expected, the time left. A nil *progressBar draws nothing.
+type progressBar struct {
+	w   io.Writer
+	now func() time.Time
+
+	mu     sync.Mutex
+	start  time.Time
+	drawn  time.Time
+	total  int
+	counts progressCounts
+}
+
+func newProgressBar(w io.Writer) *progressBar {
+	return &progressBar{w: w, now: time.Now}
+}
+
+// begin starts drawing the progress of a run expected to process total
+// disks, or an unknown number if 0.
+func (b *progressBar) begin(total int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.start, b.drawn, b.total, b.counts = b.now(), time.Time{}, total, progressCounts{}
+}
+
+func (b *progressBar) handle(e events.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.start.IsZero() || !b.counts.add(e) {
+		return
+	}
+	if now := b.now(); now.Sub(b.drawn) >= progressRedraw {
+		b.drawn = now
+		fmt.Fprintf(b.w, "\r\033[K%s", b.line(now))
+	}
+}
+
+// end draws the final line of the run, moves past it and returns the
+// number of disks processed.
+func (b *progressBar) end() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.start.IsZero() {
+		return 0
+	}
+	fmt.Fprintf(b.w, "\r\033[K%s\n", b.line(b.now()))
+	b.start = time.Time{}
+	return b.counts.Processed
+}
+
+// line returns the progress line, e.g. 1200/4000 disks (30%), 12 marked, 0
+// unmarked, 0 deleted, 1 errors, 40.0 disks/s, ETA 1m10s.
+func (b *progressBar) line(now time.Time) string {
+	c := b.counts
+	var sb strings.Builder
+	if b.total > 0 && c.Processed <= b.total {
+		fmt.Fprintf(&sb, "%d/%d disks (%d%%)", c.Processed, b.total, 100*c.Processed/b.total)
+	} else {
+		fmt.Fprintf(&sb, "%d disks", c.Processed)
+	}
+	fmt.Fprintf(&sb, ", %d marked, %d unmarked, %d deleted, %d errors", c.Marked, c.Unmarked, c.Deleted, c.Errors)
+	elapsed := now.Sub(b.start)
+	if elapsed <= 0 || c.Processed == 0 {
+		return sb.String()
+	}
+	rate := float64(c.Processed) / elapsed.Seconds()
+	fmt.Fprintf(&sb, ", %.1f disks/s", rate)
+	if b.total > c.Processed {
+		eta := time.Duration(float64(b.total-c.Processed) / rate * float64(time.Second))
+		fmt.Fprintf(&sb, ", ETA %s", eta.Round(time.Second))
+	}
+	return sb.String()
+}
+
+// isTerminal reports whether f is a terminal rather than e.g. a file, a pipe
+// or the log collector of a container.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// progressKey is the key in the store of the number of disks processed by
+// the last run of every command, from which the progress bar estimates the
+// time left. The compute API does not tell how many disks a listing holds.
+const progressKey = "gke-disk-cleanup.progress"
+
+// progressScope identifies the projects and zones of a run, so that the
+// disk count of a run is only expected of a run over the same ones.
+func progressScope(command string, projects, zones []string) string {
+	projects = append([]string(nil), projects...)
+	zones = append([]string(nil), zones...)
+	sort.Strings(projects)
+	sort.Strings(zones)
+	return command + " " + strings.Join(projects, ",") + " " + strings.Join(zones, ",")
+}
+
+// expectedDisks returns the number of disks processed by the last run over
+// scope, 0 if unknown.
+func expectedDisks(ctx context.Context, s store.Store, scope string) int {
+	counts, err := readProgressCounts(ctx, s)
+	if err != nil {
+		log.Debug().Err(err).Msg("unable to read disk counts of the last runs")
+	}
+	return counts[scope]
+}
+
+// recordDisks records the number of disks processed by a run over scope.
+func recordDisks(ctx context.Context, s store.Store, scope string, disks int) error {
+	counts, err := readProgressCounts(ctx, s)
+	if err != nil {
+		counts = make(map[string]int)
+	}
+	counts[scope] = disks
+	data, err := json.Marshal(counts)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, progressKey, data)
+}
+
+func readProgressCounts(ctx context.Context, s store.Store) (map[string]int, error) {
+	counts := make(map[string]int)
+	data, err := s.Get(ctx, progressKey)
+	if errors.Is(err, store.ErrNotExist) {
+		return counts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
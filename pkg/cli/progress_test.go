@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_ProgressLogger(t *testing.T) {
+	t.Parallel()
+
+	setup := func(interval time.Duration, every int) (*progressLogger, *time.Time, *[]progressCounts) {
+		now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		var emitted []progressCounts
+		p := newProgressLogger(interval, every)
+		p.now = func() time.Time { return now }
+		p.last = now
+		p.emit = func(c progressCounts) { emitted = append(emitted, c) }
+		return p, &now, &emitted
+	}
+
+	t.Run("every n disks", func(t *testing.T) {
+		t.Parallel()
+		p, _, emitted := setup(0, 2)
+		p.handle(events.Event{Type: events.DiskScanned})
+		p.handle(events.Event{Type: events.DiskMarked})
+		require.Empty(t, *emitted)
+		p.handle(events.Event{Type: events.DiskScanned})
+		require.Equal(t, []progressCounts{{Processed: 2, Marked: 1}}, *emitted)
+	})
+
+	t.Run("every interval", func(t *testing.T) {
+		t.Parallel()
+		p, now, emitted := setup(time.Minute, 0)
+		p.handle(events.Event{Type: events.DiskScanned})
+		require.Empty(t, *emitted)
+		*now = now.Add(time.Minute)
+		p.handle(events.Event{Type: events.Error})
+		require.Empty(t, *emitted, "only scanned disks trigger a heartbeat")
+		p.handle(events.Event{Type: events.DiskScanned})
+		require.Equal(t, []progressCounts{{Processed: 2, Errors: 1}}, *emitted)
+		p.handle(events.Event{Type: events.DiskScanned})
+		require.Len(t, *emitted, 1)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		p, now, emitted := setup(0, 0)
+		for i := 0; i < 10; i++ {
+			*now = now.Add(time.Hour)
+			p.handle(events.Event{Type: events.DiskScanned})
+		}
+		require.Empty(t, *emitted)
+	})
+}
+
+func Test_ProgressBar(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newProgressBar(&buf)
+	b.now = func() time.Time { return now }
+
+	b.handle(events.Event{Type: events.DiskScanned})
+	require.Empty(t, buf.String(), "nothing is drawn outside a run")
+
+	b.begin(400)
+	for i := 0; i < 100; i++ {
+		now = now.Add(100 * time.Millisecond)
+		b.handle(events.Event{Type: events.DiskScanned})
+		if i%10 == 0 {
+			b.handle(events.Event{Type: events.DiskMarked})
+		}
+	}
+	require.Contains(t, buf.String(), "\r\033[K1/400 disks (0%)")
+	require.NotContains(t, buf.String(), "\033[K2/400 disks", "redrawn at most every 250ms")
+	require.Contains(t, buf.String(), "\r\033[K100/400 disks (25%), 10 marked, 0 unmarked, 0 deleted, 0 errors, 10.0 disks/s, ETA 30s")
+
+	buf.Reset()
+	require.Equal(t, 100, b.end())
+	require.Equal(t, "\r\033[K100/400 disks (25%), 10 marked, 0 unmarked, 0 deleted, 0 errors, 10.0 disks/s, ETA 30s\n", buf.String())
+	require.Equal(t, 0, b.end())
+
+	buf.Reset()
+	b.begin(0)
+	now = now.Add(time.Second)
+	b.handle(events.Event{Type: events.DiskScanned})
+	require.Equal(t, "\r\033[K1 disks, 0 marked, 0 unmarked, 0 deleted, 0 errors, 1.0 disks/s", buf.String(), "no ETA without an expected total")
+
+	var none *progressBar
+	none.begin(1)
+	require.Equal(t, 0, none.end())
+}
+
+func Test_ExpectedDisks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := store.Local{Dir: t.TempDir()}
+	scope := progressScope("mark", []string{"b", "a"}, []string{"us-east1-b"})
+	require.Equal(t, scope, progressScope("mark", []string{"a", "b"}, []string{"us-east1-b"}))
+	require.Equal(t, 0, expectedDisks(ctx, s, scope))
+
+	require.NoError(t, recordDisks(ctx, s, scope, 1200))
+	require.NoError(t, recordDisks(ctx, s, progressScope("cleanup", []string{"a", "b"}, []string{"us-east1-b"}), 30))
+	require.Equal(t, 1200, expectedDisks(ctx, s, scope))
+	require.Equal(t, 0, expectedDisks(ctx, s, progressScope("mark", []string{"a"}, []string{"us-east1-b"})))
+}
@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// The clients below call the APIs for a project with the credentials of that
+// project, if it has credentials of its own, and with the default ones
+// otherwise, as cleanup.ProjectDisks does for disks.
+
+// newProjectDisks returns a disks client calling every project of byProject
+// with its client options, and the other projects with fallback.
+func newProjectDisks(ctx context.Context, fallback []option.ClientOption, byProject projectOptions) (cleanup.DisksClient, error) {
+	client, err := computev1.NewDisksRESTClient(ctx, fallback...)
+	if err != nil {
+		return nil, xerrors.Errorf("init disks client: %w", err)
+	}
+	clients := make(map[string]cleanup.DisksClient, len(byProject))
+	for projectID, options := range byProject {
+		if clients[projectID], err = computev1.NewDisksRESTClient(ctx, options...); err != nil {
+			return nil, xerrors.Errorf("init disks client of project %s: %w", projectID, err)
+		}
+	}
+	return cleanup.ProjectDisks(client, clients), nil
+}
+
+// newProjectSnapshots returns a snapshots client calling every project of
+// byProject with its client options, and the other projects with fallback,
+// and a func closing it.
+func newProjectSnapshots(ctx context.Context, fallback []option.ClientOption, byProject projectOptions) (cleanup.SnapshotsClient, func(), error) {
+	var opened []*computev1.SnapshotsClient
+	closeAll := func() {
+		for _, client := range opened {
+			client.Close()
+		}
+	}
+	client, err := computev1.NewSnapshotsRESTClient(ctx, fallback...)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("init snapshots client: %w", err)
+	}
+	opened = append(opened, client)
+	clients := make(map[string]cleanup.SnapshotsClient, len(byProject))
+	for projectID, options := range byProject {
+		c, err := computev1.NewSnapshotsRESTClient(ctx, options...)
+		if err != nil {
+			closeAll()
+			return nil, nil, xerrors.Errorf("init snapshots client of project %s: %w", projectID, err)
+		}
+		opened = append(opened, c)
+		clients[projectID] = c
+	}
+	return cleanup.ProjectSnapshots(client, clients), closeAll, nil
+}
+
+// projectResourceManager is a resourceManager testing the permissions in a
+// project with the client of that project, if it has one of its own.
+// Projects and folders are listed with the default client.
+type projectResourceManager struct {
+	resourceManager
+	byProject map[string]resourceManager
+}
+
+// newProjectResourceManager returns a resourceManager calling every project
+// of byProject with its client options, and the other projects with
+// fallback.
+func newProjectResourceManager(ctx context.Context, fallback []option.ClientOption, byProject projectOptions) (resourceManager, error) {
+	rm, err := newResourceManager(ctx, fallback...)
+	if err != nil {
+		return nil, err
+	}
+	if len(byProject) == 0 {
+		return rm, nil
+	}
+	r := &projectResourceManager{resourceManager: rm, byProject: make(map[string]resourceManager, len(byProject))}
+	for projectID, options := range byProject {
+		if r.byProject[projectID], err = newResourceManager(ctx, options...); err != nil {
+			return nil, xerrors.Errorf("project %s: %w", projectID, err)
+		}
+	}
+	return r, nil
+}
+
+func (r *projectResourceManager) TestPermissions(ctx context.Context, projectID string, permissions []string) ([]string, error) {
+	if rm, ok := r.byProject[projectID]; ok {
+		return rm.TestPermissions(ctx, projectID, permissions)
+	}
+	return r.resourceManager.TestPermissions(ctx, projectID, permissions)
+}
+
+// projectAuditLog is an auditLog reading the audit logs of a project with the
+// client of that project, if it has one of its own.
+type projectAuditLog struct {
+	fallback  auditLog
+	byProject map[string]auditLog
+}
+
+// newProjectAuditLog returns an auditLog calling every project of byProject
+// with its client options, and the other projects with fallback.
+func newProjectAuditLog(ctx context.Context, fallback []option.ClientOption, byProject projectOptions) (auditLog, error) {
+	al, err := newAuditLog(ctx, fallback...)
+	if err != nil {
+		return nil, err
+	}
+	if len(byProject) == 0 {
+		return al, nil
+	}
+	p := &projectAuditLog{fallback: al, byProject: make(map[string]auditLog, len(byProject))}
+	for projectID, options := range byProject {
+		if p.byProject[projectID], err = newAuditLog(ctx, options...); err != nil {
+			return nil, xerrors.Errorf("project %s: %w", projectID, err)
+		}
+	}
+	return p, nil
+}
+
+func (p *projectAuditLog) client(projectID string) auditLog {
+	if al, ok := p.byProject[projectID]; ok {
+		return al
+	}
+	return p.fallback
+}
+
+func (p *projectAuditLog) ListDiskDeletions(ctx context.Context, projectID string, since, until time.Time) ([]auditDeletion, error) {
+	return p.client(projectID).ListDiskDeletions(ctx, projectID, since, until)
+}
+
+func (p *projectAuditLog) ListDiskAttachments(ctx context.Context, projectID string, since, until time.Time) ([]auditAttachment, error) {
+	return p.client(projectID).ListDiskAttachments(ctx, projectID, since, until)
+}
+
+// projectDiskIO is a diskIOMetrics reading the metrics of a project with the
+// client of that project, if it has one of its own.
+type projectDiskIO struct {
+	fallback  diskIOMetrics
+	byProject map[string]diskIOMetrics
+}
+
+// newProjectDiskIO returns a diskIOMetrics calling every project of byProject
+// with its client options, and the other projects with fallback.
+func newProjectDiskIO(ctx context.Context, fallback []option.ClientOption, byProject projectOptions) (diskIOMetrics, error) {
+	metrics, err := newDiskIOMetrics(ctx, fallback...)
+	if err != nil {
+		return nil, err
+	}
+	if len(byProject) == 0 {
+		return metrics, nil
+	}
+	p := &projectDiskIO{fallback: metrics, byProject: make(map[string]diskIOMetrics, len(byProject))}
+	for projectID, options := range byProject {
+		if p.byProject[projectID], err = newDiskIOMetrics(ctx, options...); err != nil {
+			return nil, xerrors.Errorf("project %s: %w", projectID, err)
+		}
+	}
+	return p, nil
+}
+
+func (p *projectDiskIO) DiskIOBytes(ctx context.Context, projectID string, since, until time.Time) (map[string]int64, error) {
+	if metrics, ok := p.byProject[projectID]; ok {
+		return metrics.DiskIOBytes(ctx, projectID, since, until)
+	}
+	return p.fallback.DiskIOBytes(ctx, projectID, since, until)
+}
+
+// projectClusters is a clusterLister listing the clusters of a project with
+// the client of that project, if it has one of its own.
+type projectClusters struct {
+	fallback  clusterLister
+	byProject map[string]clusterLister
+}
+
+// newProjectClusters returns a clusterLister calling every project of
+// byProject with its client options, and the other projects with fallback.
+func newProjectClusters(ctx context.Context, fallback []option.ClientOption, byProject projectOptions) (clusterLister, error) {
+	lister, err := newClusterLister(ctx, fallback...)
+	if err != nil {
+		return nil, err
+	}
+	if len(byProject) == 0 {
+		return lister, nil
+	}
+	p := &projectClusters{fallback: lister, byProject: make(map[string]clusterLister, len(byProject))}
+	for projectID, options := range byProject {
+		if p.byProject[projectID], err = newClusterLister(ctx, options...); err != nil {
+			return nil, xerrors.Errorf("project %s: %w", projectID, err)
+		}
+	}
+	return p, nil
+}
+
+func (p *projectClusters) ClusterNames(ctx context.Context, projectID string) ([]string, error) {
+	if lister, ok := p.byProject[projectID]; ok {
+		return lister.ClusterNames(ctx, projectID)
+	}
+	return p.fallback.ClusterNames(ctx, projectID)
+}
+
+// projectImageExport is an imageExportAPI creating, exporting and deleting
+// the images of a project with the clients of that project, if it has ones
+// of its own. Objects are read with the default clients.
+type projectImageExport struct {
+	fallback  *gcpImageExport
+	byProject map[string]*gcpImageExport
+}
+
+// newProjectImageExport returns an imageExportAPI calling every project of
+// byProject with its client options, and the other projects with fallback.
+func newProjectImageExport(ctx context.Context, fallback []option.ClientOption, byProject projectOptions) (*projectImageExport, error) {
+	api, err := newImageExportAPI(ctx, fallback...)
+	if err != nil {
+		return nil, err
+	}
+	p := &projectImageExport{fallback: api, byProject: make(map[string]*gcpImageExport, len(byProject))}
+	for projectID, options := range byProject {
+		if p.byProject[projectID], err = newImageExportAPI(ctx, options...); err != nil {
+			p.Close()
+			return nil, xerrors.Errorf("project %s: %w", projectID, err)
+		}
+	}
+	return p, nil
+}
+
+// Close closes the images clients.
+func (p *projectImageExport) Close() error {
+	err := p.fallback.Close()
+	for _, api := range p.byProject {
+		if api == nil {
+			continue
+		}
+		if closeErr := api.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (p *projectImageExport) client(projectID string) *gcpImageExport {
+	if api, ok := p.byProject[projectID]; ok {
+		return api
+	}
+	return p.fallback
+}
+
+func (p *projectImageExport) CreateImage(ctx context.Context, projectID, image, sourceDisk string) error {
+	return p.client(projectID).CreateImage(ctx, projectID, image, sourceDisk)
+}
+
+func (p *projectImageExport) ExportImage(ctx context.Context, projectID, image, zone, uri string, timeout time.Duration) error {
+	return p.client(projectID).ExportImage(ctx, projectID, image, zone, uri, timeout)
+}
+
+func (p *projectImageExport) DeleteImage(ctx context.Context, projectID, image string) error {
+	return p.client(projectID).DeleteImage(ctx, projectID, image)
+}
+
+func (p *projectImageExport) Object(ctx context.Context, uri string) (*events.Export, error) {
+	return p.fallback.Object(ctx, uri)
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	crm "google.golang.org/api/cloudresourcemanager/v3"
+)
+
+func Test_ProjectClients(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("resource manager", func(t *testing.T) {
+		t.Parallel()
+
+		rm := func() *resourceManagerMock {
+			return &resourceManagerMock{
+				ListProjectsFunc: func(context.Context, string) ([]*crm.Project, error) {
+					return nil, nil
+				},
+				TestPermissionsFunc: func(_ context.Context, _ string, permissions []string) ([]string, error) {
+					return permissions, nil
+				},
+			}
+		}
+		host, service := rm(), rm()
+		routed := &projectResourceManager{resourceManager: host, byProject: map[string]resourceManager{"service": service}}
+		_, err := routed.TestPermissions(ctx, "service", []string{"compute.disks.list"})
+		require.NoError(t, err)
+		_, err = routed.TestPermissions(ctx, "host", []string{"compute.disks.list"})
+		require.NoError(t, err)
+		_, err = routed.ListProjects(ctx, "folders/123")
+		require.NoError(t, err)
+		require.Len(t, service.TestPermissionsCalls(), 1)
+		require.Equal(t, "service", service.TestPermissionsCalls()[0].ProjectID)
+		require.Len(t, host.TestPermissionsCalls(), 1)
+		require.Len(t, host.ListProjectsCalls(), 1, "projects are listed with the default credentials")
+	})
+
+	t.Run("audit log", func(t *testing.T) {
+		t.Parallel()
+
+		al := func() *auditLogMock {
+			return &auditLogMock{
+				ListDiskAttachmentsFunc: func(context.Context, string, time.Time, time.Time) ([]auditAttachment, error) {
+					return nil, nil
+				},
+			}
+		}
+		host, service := al(), al()
+		routed := &projectAuditLog{fallback: host, byProject: map[string]auditLog{"service": service}}
+		_, err := routed.ListDiskAttachments(ctx, "service", time.Time{}, time.Now())
+		require.NoError(t, err)
+		require.Len(t, service.ListDiskAttachmentsCalls(), 1)
+		require.Empty(t, host.ListDiskAttachmentsCalls())
+	})
+
+	t.Run("disk IO", func(t *testing.T) {
+		t.Parallel()
+
+		metrics := func() *diskIOMetricsMock {
+			return &diskIOMetricsMock{
+				DiskIOBytesFunc: func(context.Context, string, time.Time, time.Time) (map[string]int64, error) {
+					return nil, nil
+				},
+			}
+		}
+		host, service := metrics(), metrics()
+		routed := &projectDiskIO{fallback: host, byProject: map[string]diskIOMetrics{"service": service}}
+		_, err := routed.DiskIOBytes(ctx, "host", time.Time{}, time.Now())
+		require.NoError(t, err)
+		require.Len(t, host.DiskIOBytesCalls(), 1)
+		require.Empty(t, service.DiskIOBytesCalls())
+	})
+
+	t.Run("clusters", func(t *testing.T) {
+		t.Parallel()
+
+		lister := func() *clusterListerMock {
+			return &clusterListerMock{
+				ClusterNamesFunc: func(context.Context, string) ([]string, error) {
+					return nil, nil
+				},
+			}
+		}
+		host, service := lister(), lister()
+		routed := &projectClusters{fallback: host, byProject: map[string]clusterLister{"service": service}}
+		_, err := existingClusters(ctx, routed, []string{"host", "service"})
+		require.NoError(t, err)
+		require.Len(t, host.ClusterNamesCalls(), 1)
+		require.Len(t, service.ClusterNamesCalls(), 1)
+		require.Equal(t, "service", service.ClusterNamesCalls()[0].ProjectID)
+	})
+}
@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	crm "google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+const projectStateActive = "ACTIVE"
+
+// resourceManager is an interface for the resource manager API methods we use here
+type resourceManager interface {
+	ListProjects(ctx context.Context, parent string) ([]*crm.Project, error)
+	ListFolders(ctx context.Context, parent string) ([]*crm.Folder, error)
+	// TestPermissions returns those of permissions the caller has in the
+	// project.
+	TestPermissions(ctx context.Context, projectID string, permissions []string) ([]string, error)
+}
+
+//go:generate moq -fmt goimports -out mock_resource_manager.go . resourceManager
+
+// crmResourceManager implements resourceManager using the Cloud Resource
+// Manager v3 API.
+type crmResourceManager struct {
+	svc *crm.Service
+}
+
+func newResourceManager(ctx context.Context, opts ...option.ClientOption) (*crmResourceManager, error) {
+	svc, err := crm.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init resource manager client: %w", err)
+	}
+	return &crmResourceManager{svc: svc}, nil
+}
+
+func (r *crmResourceManager) ListProjects(ctx context.Context, parent string) ([]*crm.Project, error) {
+	var projects []*crm.Project
+	err := r.svc.Projects.List().Parent(parent).Pages(ctx, func(resp *crm.ListProjectsResponse) error {
+		projects = append(projects, resp.Projects...)
+		return nil
+	})
+	return projects, err
+}
+
+func (r *crmResourceManager) ListFolders(ctx context.Context, parent string) ([]*crm.Folder, error) {
+	var folders []*crm.Folder
+	err := r.svc.Folders.List().Parent(parent).Pages(ctx, func(resp *crm.ListFoldersResponse) error {
+		folders = append(folders, resp.Folders...)
+		return nil
+	})
+	return folders, err
+}
+
+func (r *crmResourceManager) TestPermissions(ctx context.Context, projectID string, permissions []string) ([]string, error) {
+	resp, err := r.svc.Projects.TestIamPermissions("projects/"+projectID, &crm.TestIamPermissionsRequest{Permissions: permissions}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Permissions, nil
+}
+
+// findProjects returns the IDs of all active projects under parent
+// (e.g. folders/123 or organizations/456), descending into sub-folders.
+func findProjects(ctx context.Context, rm resourceManager, parent string) ([]string, error) {
+	projects, err := rm.ListProjects(ctx, parent)
+	if err != nil {
+		return nil, xerrors.Errorf("list projects in %s: %w", parent, err)
+	}
+	var ids []string
+	for _, project := range projects {
+		if project.State != projectStateActive {
+			log.Debug().Str("projectID", project.ProjectId).Str("state", project.State).Msg("ignoring inactive project")
+			continue
+		}
+		ids = append(ids, project.ProjectId)
+	}
+
+	folders, err := rm.ListFolders(ctx, parent)
+	if err != nil {
+		return nil, xerrors.Errorf("list folders in %s: %w", parent, err)
+	}
+	for _, folder := range folders {
+		if folder.State != projectStateActive {
+			continue
+		}
+		// folder.Name is already of the form folders/123
+		sub, err := findProjects(ctx, rm, folder.Name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, sub...)
+	}
+	return ids, nil
+}
+
+// resolveProjects returns the projects to operate on: either the projects
+// given by projectID, a comma-separated list, or every active project under
+// the given folder or organization.
+func resolveProjects(ctx context.Context, clientOpts []option.ClientOption, projectID, folderID, organizationID string) ([]string, error) {
+	var parent string
+	switch {
+	case folderID != "" && organizationID != "":
+		return nil, xerrors.Errorf("--folder-id and --organization-id are mutually exclusive")
+	case folderID != "":
+		parent = "folders/" + folderID
+	case organizationID != "":
+		parent = "organizations/" + organizationID
+	default:
+		var projects []string
+		for _, id := range strings.Split(projectID, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				projects = append(projects, id)
+			}
+		}
+		if len(projects) == 0 {
+			return nil, xerrors.Errorf("--project-id is required")
+		}
+		return projects, nil
+	}
+
+	rm, err := newResourceManager(ctx, clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := findProjects(ctx, rm, parent)
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, xerrors.Errorf("no active projects found in %s", parent)
+	}
+	log.Info().Str("parent", parent).Int("projects", len(projects)).Msg("found projects")
+	return projects, nil
+}
+
+// forEachProject calls fn for every project and logs a summary per project.
+// A failure in one project does not stop the others; an error naming the
+// failed projects is returned at the end. An interrupted run stops right away.
+func forEachProject(projects []string, fn func(projectID string) (cleanup.Stats, error)) error {
+	var failed []string
+	var firstErr error
+	for _, projectID := range projects {
+		start := time.Now()
+		stats, err := fn(projectID)
+		evt := log.Info()
+		if err != nil {
+			evt = log.Error().Err(err)
+			failed = append(failed, projectID)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		var pageErr *cleanup.PageError
+		if errors.As(err, &pageErr) {
+			evt = evt.Str("resumeFrom", pageErr.Cursor.String())
+		}
+		evt.Str("projectID", projectID).
+			Int("scanned", stats.Scanned).
+			Int("failed", stats.Failed).
+			Dur("duration", time.Since(start)).
+			Msg("project summary")
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			// the remaining projects would fail the same way
+			return xerrors.Errorf("interrupted in project %s: %w", projectID, err)
+		}
+	}
+	if len(failed) > 0 {
+		code := ExitPartialFailure
+		if len(failed) == len(projects) {
+			code = ExitFailure
+		}
+		return &exitError{
+			code: code,
+			msg:  fmt.Sprintf("%d of %d projects failed: %s", len(failed), len(projects), strings.Join(failed, ", ")),
+			err:  firstErr,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	crm "google.golang.org/api/cloudresourcemanager/v3"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+func Test_FindProjects(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nested folders", func(t *testing.T) {
+		t.Parallel()
+		rm := &resourceManagerMock{
+			ListProjectsFunc: func(ctx context.Context, parent string) ([]*crm.Project, error) {
+				switch parent {
+				case "folders/1":
+					return []*crm.Project{
+						{ProjectId: "project-a", State: "ACTIVE"},
+						{ProjectId: "project-deleted", State: "DELETE_REQUESTED"},
+					}, nil
+				case "folders/2":
+					return []*crm.Project{{ProjectId: "project-b", State: "ACTIVE"}}, nil
+				}
+				return nil, nil
+			},
+			ListFoldersFunc: func(ctx context.Context, parent string) ([]*crm.Folder, error) {
+				if parent == "folders/1" {
+					return []*crm.Folder{{Name: "folders/2", State: "ACTIVE"}}, nil
+				}
+				return nil, nil
+			},
+		}
+		projects, err := findProjects(context.Background(), rm, "folders/1")
+		require.NoError(t, err)
+		require.Equal(t, []string{"project-a", "project-b"}, projects)
+		require.Len(t, rm.ListFoldersCalls(), 2)
+	})
+
+	t.Run("list error", func(t *testing.T) {
+		t.Parallel()
+		rm := &resourceManagerMock{
+			ListProjectsFunc: func(ctx context.Context, parent string) ([]*crm.Project, error) {
+				return nil, xerrors.Errorf("permission denied")
+			},
+		}
+		_, err := findProjects(context.Background(), rm, "organizations/1")
+		require.EqualError(t, err, "list projects in organizations/1: permission denied")
+	})
+}
+
+func Test_ResolveProjects(t *testing.T) {
+	t.Parallel()
+
+	projects, err := resolveProjects(context.Background(), nil, "testing", "", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"testing"}, projects)
+
+	projects, err = resolveProjects(context.Background(), nil, "host, service-a,,service-b", "", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"host", "service-a", "service-b"}, projects)
+	_, err = resolveProjects(context.Background(), nil, " , ", "", "")
+	require.EqualError(t, err, "--project-id is required")
+
+	_, err = resolveProjects(context.Background(), nil, "testing", "1", "2")
+	require.EqualError(t, err, "--folder-id and --organization-id are mutually exclusive")
+}
+
+func Test_ForEachProject(t *testing.T) {
+	t.Parallel()
+
+	var called []string
+	err := forEachProject([]string{"project-a", "project-b", "project-c"}, func(projectID string) (cleanup.Stats, error) {
+		called = append(called, projectID)
+		if projectID == "project-b" {
+			return cleanup.Stats{Scanned: 1}, xerrors.Errorf("compute api not enabled")
+		}
+		return cleanup.Stats{Scanned: 2}, nil
+	})
+	require.Equal(t, []string{"project-a", "project-b", "project-c"}, called)
+	require.EqualError(t, err, "1 of 3 projects failed: project-b")
+	require.Equal(t, ExitPartialFailure, ExitCode(err))
+
+	err = forEachProject([]string{"project-a", "project-b"}, func(projectID string) (cleanup.Stats, error) {
+		return cleanup.Stats{}, xerrors.Errorf("compute api not enabled")
+	})
+	require.EqualError(t, err, "2 of 2 projects failed: project-a, project-b")
+	require.Equal(t, ExitFailure, ExitCode(err))
+}
+
+func Test_ForEachProjectInterrupted(t *testing.T) {
+	t.Parallel()
+
+	var called []string
+	err := forEachProject([]string{"project-a", "project-b", "project-c"}, func(projectID string) (cleanup.Stats, error) {
+		called = append(called, projectID)
+		if projectID == "project-b" {
+			return cleanup.Stats{Scanned: 1}, context.Canceled
+		}
+		return cleanup.Stats{Scanned: 2}, nil
+	})
+	require.Equal(t, []string{"project-a", "project-b"}, called)
+	require.ErrorIs(t, err, context.Canceled)
+	require.EqualError(t, err, "interrupted in project project-b: context canceled")
+}
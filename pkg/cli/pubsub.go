@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/option"
+	pubsub "google.golang.org/api/pubsub/v1"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+)
+
+const (
+	// maxPublishBatch is the most messages published in one request.
+	maxPublishBatch = 1000
+	// publishTimeout is how long publishing a batch of results may take.
+	publishTimeout = 30 * time.Second
+	// pullRetryDelay is how long to wait after pulling run requests failed.
+	pullRetryDelay = 10 * time.Second
+)
+
+// pubsubClient is the part of the Pub/Sub API used to receive run requests
+// and publish results.
+type pubsubClient interface {
+	Publish(ctx context.Context, topic string, messages []*pubsub.PubsubMessage) error
+	Pull(ctx context.Context, subscription string, maxMessages int64) ([]*pubsub.ReceivedMessage, error)
+	Acknowledge(ctx context.Context, subscription string, ackIDs []string) error
+}
+
+//go:generate moq -fmt goimports -out mock_pubsub_client.go . pubsubClient
+
+// restPubSub implements pubsubClient with the Pub/Sub REST API.
+type restPubSub struct {
+	svc *pubsub.Service
+}
+
+func newPubSubClient(ctx context.Context, opts []option.ClientOption) (*restPubSub, error) {
+	svc, err := pubsub.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init pubsub client: %w", err)
+	}
+	return &restPubSub{svc: svc}, nil
+}
+
+func (p *restPubSub) Publish(ctx context.Context, topic string, messages []*pubsub.PubsubMessage) error {
+	_, err := p.svc.Projects.Topics.Publish(topic, &pubsub.PublishRequest{Messages: messages}).Context(ctx).Do()
+	return err
+}
+
+func (p *restPubSub) Pull(ctx context.Context, subscription string, maxMessages int64) ([]*pubsub.ReceivedMessage, error) {
+	resp, err := p.svc.Projects.Subscriptions.Pull(subscription, &pubsub.PullRequest{MaxMessages: maxMessages}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return resp.ReceivedMessages, nil
+}
+
+func (p *restPubSub) Acknowledge(ctx context.Context, subscription string, ackIDs []string) error {
+	_, err := p.svc.Projects.Subscriptions.Acknowledge(subscription, &pubsub.AcknowledgeRequest{AckIds: ackIDs}).Context(ctx).Do()
+	return err
+}
+
+// resultPublisher publishes the result of every disk that was changed or
+// failed to a topic, with the same fields as the --output json records.
+// Disks skipped deliberately are not published.
+type resultPublisher struct {
+	client pubsubClient
+	topic  string
+
+	mu      sync.Mutex
+	pending []*pubsub.PubsubMessage
+}
+
+func newResultPublisher(client pubsubClient, topic string) *resultPublisher {
+	return &resultPublisher{client: client, topic: topic}
+}
+
+// handle queues the result of a DiskProcessed event, and publishes the
+// queue once a batch is full.
+func (p *resultPublisher) handle(e events.Event) {
+	if e.Type != events.DiskProcessed || e.Action == string(cleanup.ActionSkip) && !cleanup.IsFailure(e.Err) {
+		return
+	}
+	result := newDiskResult(e)
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to encode result")
+		return
+	}
+	// attributes let subscriptions filter, e.g. on attributes.action = "DELETE"
+	attributes := map[string]string{
+		"projectID": result.ProjectID,
+		"zone":      result.Zone,
+		"action":    result.Action,
+		"dryRun":    strconv.FormatBool(result.DryRun),
+	}
+	if result.Code != "" {
+		attributes["code"] = string(result.Code)
+	}
+	p.mu.Lock()
+	p.pending = append(p.pending, &pubsub.PubsubMessage{Data: base64.StdEncoding.EncodeToString(data), Attributes: attributes})
+	full := len(p.pending) >= maxPublishBatch
+	p.mu.Unlock()
+	if full {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		defer cancel()
+		if err := p.Flush(ctx); err != nil {
+			log.Warn().Err(err).Msg("unable to publish results, retrying at the end of the run")
+		}
+	}
+}
+
+// Flush publishes the queued results. Results that could not be published
+// stay queued.
+func (p *resultPublisher) Flush(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.pending) > 0 {
+		n := len(p.pending)
+		if n > maxPublishBatch {
+			n = maxPublishBatch
+		}
+		if err := p.client.Publish(ctx, p.topic, p.pending[:n]); err != nil {
+			return xerrors.Errorf("publish %d results to %s: %w", len(p.pending), p.topic, err)
+		}
+		p.pending = p.pending[n:]
+	}
+	return nil
+}
+
+// receiveRuns pulls run requests from subscription, as the JSON body of a
+// POST to /run, and starts them with t one after another until ctx is done.
+// Requests are acknowledged before their run starts, so a run that fails
+// or is interrupted is not retried.
+func receiveRuns(ctx context.Context, client pubsubClient, subscription string, t *trigger) {
+	log.Info().Str("subscription", subscription).Msg("receiving run requests")
+	for ctx.Err() == nil {
+		messages, err := client.Pull(ctx, subscription, 1)
+		if err == nil && len(messages) > 0 {
+			err = client.Acknowledge(ctx, subscription, []string{messages[0].AckId})
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Str("subscription", subscription).Msg("unable to receive run requests")
+			select {
+			case <-ctx.Done():
+			case <-time.After(pullRetryDelay):
+			}
+			continue
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		startRun(ctx, messages[0].Message, t)
+	}
+}
+
+// startRun starts the run requested by message.
+func startRun(ctx context.Context, message *pubsub.PubsubMessage, t *trigger) {
+	logger := log.With().Str("messageID", message.MessageId).Logger()
+	var req triggerRequest
+	data, err := base64.StdEncoding.DecodeString(message.Data)
+	if err == nil {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&req)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("dropping invalid run request")
+		return
+	}
+	status, _, err := t.start(ctx, req, "pubsub:"+message.MessageId)
+	if err != nil {
+		logger.Error().Err(err).Msg("dropping run request")
+		return
+	}
+	if status.Error != "" {
+		logger.Error().Str("command", status.Command).Str("error", status.Error).Msg("triggered run failed")
+		return
+	}
+	logger.Info().Str("command", status.Command).Int("failed", status.Failed).Msg("triggered run completed")
+}
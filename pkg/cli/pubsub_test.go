@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	pubsub "google.golang.org/api/pubsub/v1"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_ResultPublisher(t *testing.T) {
+	t.Parallel()
+
+	var published [][]*pubsub.PubsubMessage
+	fail := true
+	client := &pubsubClientMock{
+		PublishFunc: func(_ context.Context, topic string, messages []*pubsub.PubsubMessage) error {
+			require.Equal(t, "projects/testing/topics/results", topic)
+			if fail {
+				return xerrors.New("unavailable")
+			}
+			published = append(published, messages)
+			return nil
+		},
+	}
+	p := newResultPublisher(client, "projects/testing/topics/results")
+	disk := &computepb.Disk{Name: pointer.String("test-disk"), SizeGb: pointer.Int64(10)}
+	processed := func(action cleanup.Action, err error) events.Event {
+		return events.Event{Type: events.DiskProcessed, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Action: string(action), Err: err}
+	}
+	p.handle(processed(cleanup.ActionDelete, nil))
+	p.handle(processed(cleanup.ActionSkip, diskerr.ErrWithinCutoff))
+	p.handle(processed(cleanup.ActionSkip, diskerr.New(diskerr.CodeAPI, "failed to delete disk")))
+	p.handle(events.Event{Type: events.DiskDeleted, Disk: disk})
+
+	require.Error(t, p.Flush(context.Background()))
+	fail = false
+	require.NoError(t, p.Flush(context.Background()), "failed results stay queued")
+	require.NoError(t, p.Flush(context.Background()))
+	require.Len(t, published, 1)
+	require.Len(t, published[0], 2, "deliberate skips are not published")
+
+	deleted := published[0][0]
+	require.Equal(t, map[string]string{"projectID": "testing", "zone": "us-east1-b", "action": "DELETE", "dryRun": "false"}, deleted.Attributes)
+	data, err := base64.StdEncoding.DecodeString(deleted.Data)
+	require.NoError(t, err)
+	var result diskResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	require.Equal(t, "test-disk", result.Name)
+	require.Equal(t, int64(10), result.SizeGB)
+	require.Equal(t, "API", published[0][1].Attributes["code"])
+
+	for i := 0; i < maxPublishBatch+1; i++ {
+		p.handle(processed(cleanup.ActionMark, nil))
+	}
+	require.Len(t, published, 2, "a full batch is published right away")
+	require.Len(t, published[1], maxPublishBatch)
+	require.NoError(t, p.Flush(context.Background()))
+	require.Len(t, published[2], 1)
+
+	var none *resultPublisher
+	require.NoError(t, none.Flush(context.Background()))
+}
+
+func Test_ReceiveRuns(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	message := func(id, body string) *pubsub.ReceivedMessage {
+		return &pubsub.ReceivedMessage{AckId: "ack-" + id, Message: &pubsub.PubsubMessage{MessageId: id, Data: base64.StdEncoding.EncodeToString([]byte(body))}}
+	}
+	pulls := [][]*pubsub.ReceivedMessage{
+		{message("1", `{"command": "cleanup", "flags": {"dry-run": false}}`)},
+		nil,
+		{message("2", `{"command": "status"}`)},
+		{message("3", `not json`)},
+		{message("4", `{"command": "mark"}`)},
+	}
+	client := &pubsubClientMock{
+		PullFunc: func(ctx context.Context, subscription string, maxMessages int64) ([]*pubsub.ReceivedMessage, error) {
+			require.Equal(t, "projects/testing/subscriptions/runs", subscription)
+			require.Equal(t, int64(1), maxMessages)
+			if len(pulls) == 0 {
+				cancel()
+				return nil, ctx.Err()
+			}
+			messages := pulls[0]
+			pulls = pulls[1:]
+			return messages, nil
+		},
+		AcknowledgeFunc: func(context.Context, string, []string) error {
+			return nil
+		},
+	}
+
+	fs := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", true, "")
+	var runs []string
+	tr := &trigger{
+		Flags: fs,
+		Run: func(_ context.Context, command string) runStatus {
+			if command == "cleanup" {
+				require.False(t, *dryRun)
+			}
+			runs = append(runs, command)
+			return newRunStatus(command, time.Now(), time.Now(), *dryRun, nil, nil)
+		},
+	}
+	receiveRuns(ctx, client, "projects/testing/subscriptions/runs", tr)
+
+	require.Equal(t, []string{"cleanup", "mark"}, runs)
+	require.True(t, *dryRun)
+	var acked []string
+	for _, call := range client.AcknowledgeCalls() {
+		acked = append(acked, call.AckIDs...)
+	}
+	require.Equal(t, []string{"ack-1", "ack-2", "ack-3", "ack-4"}, acked, "invalid requests are dropped")
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	logging "google.golang.org/api/logging/v2"
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/history"
+)
+
+// auditDeletion is a disk deletion found in Cloud Audit Logs.
+type auditDeletion struct {
+	Time time.Time
+	// ResourceName is e.g. projects/p/zones/us-east1-a/disks/d.
+	ResourceName string
+	Principal    string
+}
+
+// auditLog is an interface for the Cloud Audit Logs queries we use here
+type auditLog interface {
+	ListDiskDeletions(ctx context.Context, projectID string, since, until time.Time) ([]auditDeletion, error)
+	ListDiskAttachments(ctx context.Context, projectID string, since, until time.Time) ([]auditAttachment, error)
+}
+
+//go:generate moq -fmt goimports -out mock_audit_log.go . auditLog
+
+// loggingAuditLog implements auditLog using the Cloud Logging v2 API.
+type loggingAuditLog struct {
+	svc *logging.Service
+}
+
+func newAuditLog(ctx context.Context, opts ...option.ClientOption) (*loggingAuditLog, error) {
+	svc, err := logging.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init logging client: %w", err)
+	}
+	return &loggingAuditLog{svc: svc}, nil
+}
+
+func (l *loggingAuditLog) ListDiskDeletions(ctx context.Context, projectID string, since, until time.Time) ([]auditDeletion, error) {
+	// long-running operations are logged twice, only count the first entry
+	filter := fmt.Sprintf(`logName="projects/%s/logs/cloudaudit.googleapis.com%%2Factivity" AND resource.type="gce_disk" AND protoPayload.methodName=~"compute\.disks\.delete$" AND operation.first=true AND timestamp>="%s" AND timestamp<"%s"`,
+		projectID, since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	req := &logging.ListLogEntriesRequest{
+		ResourceNames: []string{"projects/" + projectID},
+		Filter:        filter,
+		PageSize:      1000,
+	}
+	var deletions []auditDeletion
+	err := l.svc.Entries.List(req).Pages(ctx, func(resp *logging.ListLogEntriesResponse) error {
+		for _, entry := range resp.Entries {
+			var payload struct {
+				ResourceName       string `json:"resourceName"`
+				AuthenticationInfo struct {
+					PrincipalEmail string `json:"principalEmail"`
+				} `json:"authenticationInfo"`
+			}
+			if err := json.Unmarshal(entry.ProtoPayload, &payload); err != nil {
+				return xerrors.Errorf("parse audit log entry %s: %w", entry.InsertId, err)
+			}
+			ts, _ := time.Parse(time.RFC3339Nano, entry.Timestamp)
+			deletions = append(deletions, auditDeletion{
+				Time:         ts,
+				ResourceName: payload.ResourceName,
+				Principal:    payload.AuthenticationInfo.PrincipalEmail,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("list audit logs of %s: %w", projectID, err)
+	}
+	return deletions, nil
+}
+
+// reconcileDeletions compares the disk deletions in Cloud Audit Logs with
+// those in the history. It returns the deletions the tool did not perform
+// and the deletions the tool recorded that do not appear in the audit log.
+func reconcileDeletions(audit []auditDeletion, records []history.Record) (untracked []auditDeletion, unconfirmed []history.Record) {
+	recorded := make(map[string]bool, len(records))
+	for _, r := range records {
+		recorded[r.ResourceName()] = true
+	}
+	audited := make(map[string]bool, len(audit))
+	for _, d := range audit {
+		audited[d.ResourceName] = true
+		if !recorded[d.ResourceName] {
+			untracked = append(untracked, d)
+		}
+	}
+	for _, r := range records {
+		if !audited[r.ResourceName()] {
+			unconfirmed = append(unconfirmed, r)
+		}
+	}
+	sort.Slice(untracked, func(i, j int) bool { return untracked[i].Time.Before(untracked[j].Time) })
+	return untracked, unconfirmed
+}
+
+// deletionsIn returns the deletions recorded for projectID between since and
+// until.
+func deletionsIn(records []history.Record, projectID string, since, until time.Time) []history.Record {
+	var deleted []history.Record
+	for _, r := range records {
+		if r.Type == events.DiskDeleted && r.ProjectID == projectID && !r.Time.Before(since) && r.Time.Before(until) {
+			deleted = append(deleted, r)
+		}
+	}
+	return deleted
+}
+
+// reconcileProject logs every discrepancy between the audit log and the
+// history of projectID and returns an error if there are any.
+func reconcileProject(ctx context.Context, al auditLog, records []history.Record, projectID string, since, until time.Time) (cleanup.Stats, error) {
+	var stats cleanup.Stats
+	audit, err := al.ListDiskDeletions(ctx, projectID, since, until)
+	if err != nil {
+		return stats, err
+	}
+	untracked, unconfirmed := reconcileDeletions(audit, deletionsIn(records, projectID, since, until))
+	for _, d := range untracked {
+		log.Warn().Str("projectID", projectID).
+			Str("resourceName", d.ResourceName).
+			Str("principal", d.Principal).
+			Time("deletedAt", d.Time).
+			Msg("disk deletion in audit log was not performed by gke-disk-cleanup")
+	}
+	for _, r := range unconfirmed {
+		log.Warn().Str("projectID", projectID).
+			Str("resourceName", r.ResourceName()).
+			Str("runID", r.RunID).
+			Time("deletedAt", r.Time).
+			Msg("disk deletion recorded by gke-disk-cleanup is missing from the audit log")
+	}
+	stats.Scanned = len(audit)
+	stats.Failed = len(untracked) + len(unconfirmed)
+	if stats.Failed > 0 {
+		return stats, xerrors.Errorf("%d deletions not performed by gke-disk-cleanup, %d recorded deletions missing from the audit log", len(untracked), len(unconfirmed))
+	}
+	return stats, nil
+}
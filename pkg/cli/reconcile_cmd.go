@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/history"
+)
+
+func newReconcileCommand(a *app) *cobra.Command {
+	var period time.Duration
+	reconcileCmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "compare disk deletions in Cloud Audit Logs with the --history-file",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if a.cfg.historyFile == "" {
+				return xerrors.Errorf("--history-file is required")
+			}
+			records, err := history.Read(cmd.Context(), a.stateStore, a.cfg.historyFile)
+			if err != nil {
+				return err
+			}
+			projects, err := a.projects(cmd.Context())
+			if err != nil {
+				return err
+			}
+			al, err := newProjectAuditLog(cmd.Context(), a.opts.ClientOptions, a.projectOpts)
+			if err != nil {
+				return err
+			}
+			until := time.Now()
+			since := until.Add(-period)
+			return forEachProject(projects, func(projectID string) (cleanup.Stats, error) {
+				return reconcileProject(cmd.Context(), al, records, projectID, since, until)
+			})
+		},
+	}
+	reconcileCmd.PersistentFlags().DurationVar(&period, "period", 30*24*time.Hour, "how far back to compare deletions")
+	return reconcileCmd
+}
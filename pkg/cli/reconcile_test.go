@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/history"
+)
+
+func Test_ReconcileProject(t *testing.T) {
+	t.Parallel()
+
+	until := time.Date(2022, 3, 31, 0, 0, 0, 0, time.UTC)
+	since := until.Add(-30 * 24 * time.Hour)
+	records := []history.Record{
+		// performed by the tool and audited
+		{Time: until.Add(-time.Hour), Type: events.DiskDeleted, ProjectID: "testing", Zone: "us-east1-b", DiskName: "tracked"},
+		// recorded but missing from the audit log
+		{Time: until.Add(-2 * time.Hour), Type: events.DiskDeleted, ProjectID: "testing", Zone: "us-east1-b", DiskName: "unconfirmed"},
+		// outside of the period, other projects and other changes are ignored
+		{Time: since.Add(-time.Hour), Type: events.DiskDeleted, ProjectID: "testing", Zone: "us-east1-b", DiskName: "old"},
+		{Time: until.Add(-time.Hour), Type: events.DiskDeleted, ProjectID: "other", Zone: "us-east1-b", DiskName: "other"},
+		{Time: until.Add(-time.Hour), Type: events.DiskMarked, ProjectID: "testing", Zone: "us-east1-b", DiskName: "marked"},
+	}
+	al := &auditLogMock{
+		ListDiskDeletionsFunc: func(ctx context.Context, projectID string, gotSince, gotUntil time.Time) ([]auditDeletion, error) {
+			require.Equal(t, "testing", projectID)
+			require.Equal(t, since, gotSince)
+			require.Equal(t, until, gotUntil)
+			return []auditDeletion{
+				{Time: until.Add(-time.Hour), ResourceName: "projects/testing/zones/us-east1-b/disks/tracked"},
+				{Time: until.Add(-3 * time.Hour), ResourceName: "projects/testing/zones/us-east1-b/disks/manual", Principal: "someone@example.com"},
+			}, nil
+		},
+	}
+
+	stats, err := reconcileProject(context.Background(), al, records, "testing", since, until)
+	require.EqualError(t, err, "1 deletions not performed by gke-disk-cleanup, 1 recorded deletions missing from the audit log")
+	require.Equal(t, 2, stats.Scanned)
+	require.Equal(t, 2, stats.Failed)
+}
+
+func Test_ReconcileDeletions(t *testing.T) {
+	t.Parallel()
+
+	records := []history.Record{{ProjectID: "testing", Zone: "us-east1-b", DiskName: "a"}}
+	audit := []auditDeletion{{ResourceName: "projects/testing/zones/us-east1-b/disks/a"}}
+	untracked, unconfirmed := reconcileDeletions(audit, records)
+	require.Empty(t, untracked)
+	require.Empty(t, unconfirmed)
+
+	untracked, unconfirmed = reconcileDeletions(nil, records)
+	require.Empty(t, untracked)
+	require.Equal(t, records, unconfirmed)
+
+	untracked, unconfirmed = reconcileDeletions(audit, nil)
+	require.Equal(t, audit, untracked)
+	require.Empty(t, unconfirmed)
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/pricing"
+)
+
+// readResults returns the disk results in the file at path, as written to
+// stdout by a run with --output json.
+func readResults(path string) ([]diskResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("open results: %w", err)
+	}
+	defer f.Close()
+	var results []diskResult
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r diskResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, xerrors.Errorf("results %s line %d: %w", path, line, err)
+		}
+		results = append(results, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.Errorf("read results: %w", err)
+	}
+	return results, nil
+}
+
+// key identifies the disk of a result across runs.
+func (r diskResult) key() string {
+	if r.SelfLink != "" {
+		return r.SelfLink
+	}
+	return path.Join("projects", r.ProjectID, "zones", r.Zone, "disks", r.Name)
+}
+
+// failed reports whether the action for the disk failed.
+func (r diskResult) failed() bool {
+	return r.Error != "" && cleanup.IsFailure(diskerr.New(r.Code, "%s", r.Error))
+}
+
+// diskTotal is the number, size and monthly cost of a set of disks.
+type diskTotal struct {
+	Disks  int
+	SizeGB int64
+	Cost   float64
+}
+
+func (t *diskTotal) add(r diskResult, prices *pricing.Table) {
+	t.Disks++
+	t.SizeGB += r.SizeGB
+	t.Cost += prices.DiskMonthlyCost(r.Type, r.SizeGB)
+}
+
+func (t diskTotal) String() string {
+	return fmt.Sprintf("%d %s (%d GB, an estimated $%.2f/month)", t.Disks, plural(t.Disks, "disk", "disks"), t.SizeGB, t.Cost)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// runOutcome is what a run did, as far as the comparison is concerned.
+type runOutcome struct {
+	// candidates are the disks marked for deletion by key.
+	candidates map[string]diskResult
+	deleted    diskTotal
+	// dryRunDeleted are the deletions a dry run would have made.
+	dryRunDeleted diskTotal
+	failures      map[diskerr.Code]int
+	failed        int
+}
+
+func outcomeOf(results []diskResult, prices *pricing.Table) runOutcome {
+	o := runOutcome{candidates: make(map[string]diskResult), failures: make(map[diskerr.Code]int)}
+	for _, r := range results {
+		if r.failed() {
+			o.failed++
+			o.failures[r.Code]++
+			continue
+		}
+		switch {
+		case cleanup.Action(r.Action) == cleanup.ActionDelete && r.DryRun:
+			o.dryRunDeleted.add(r, prices)
+		case cleanup.Action(r.Action) == cleanup.ActionDelete:
+			o.deleted.add(r, prices)
+		case cleanup.Action(r.Action) == cleanup.ActionMark, r.Code == diskerr.CodeAlreadyMarked:
+			o.candidates[r.key()] = r
+		}
+	}
+	return o
+}
+
+// compareRuns writes a narrative of what changed from the run with the
+// results before to the run with the results after, e.g. for a monthly FinOps
+// update. Deleted disks are no longer candidates, so disks deleted by after
+// count as reclaimed rather than as new candidates.
+func compareRuns(w io.Writer, beforeName string, before []diskResult, afterName string, after []diskResult, prices *pricing.Table) {
+	b, a := outcomeOf(before, prices), outcomeOf(after, prices)
+
+	var newCandidates diskTotal
+	for key, r := range a.candidates {
+		if _, ok := b.candidates[key]; !ok {
+			newCandidates.add(r, prices)
+		}
+	}
+	var allCandidates diskTotal
+	for _, r := range a.candidates {
+		allCandidates.add(r, prices)
+	}
+	cumulative := b.deleted
+	cumulative.Disks += a.deleted.Disks
+	cumulative.SizeGB += a.deleted.SizeGB
+	cumulative.Cost += a.deleted.Cost
+
+	fmt.Fprintf(w, "Disk cleanup: %s compared to %s\n\n", afterName, beforeName)
+	fmt.Fprintf(w, "- New candidates: %s newly marked for deletion, out of %d candidates in total.\n", newCandidates, allCandidates.Disks)
+	fmt.Fprintf(w, "- Reclaimed this period: %s deleted.\n", a.deleted)
+	if a.dryRunDeleted.Disks > 0 {
+		fmt.Fprintf(w, "- Not reclaimed yet: %s would have been deleted, but the run was a dry run.\n", a.dryRunDeleted)
+	}
+	fmt.Fprintf(w, "- Cumulative savings: %s deleted across both runs.\n", cumulative)
+	fmt.Fprintf(w, "- Errors: %s\n", errorTrend(b, a))
+	fmt.Fprintf(w, "\nCosts are estimated at %s list prices.\n", prices.Region)
+}
+
+// errorTrend describes how the failures changed from b to a.
+func errorTrend(b, a runOutcome) string {
+	var trend string
+	switch {
+	case a.failed == 0 && b.failed == 0:
+		return "none in either run."
+	case a.failed > b.failed:
+		trend = fmt.Sprintf("%d %s failed, up from %d.", a.failed, plural(a.failed, "disk", "disks"), b.failed)
+	case a.failed < b.failed:
+		trend = fmt.Sprintf("%d %s failed, down from %d.", a.failed, plural(a.failed, "disk", "disks"), b.failed)
+	default:
+		trend = fmt.Sprintf("%d %s failed, as before.", a.failed, plural(a.failed, "disk", "disks"))
+	}
+	codes := make([]string, 0, len(a.failures)+len(b.failures))
+	for code := range a.failures {
+		codes = append(codes, string(code))
+	}
+	for code := range b.failures {
+		if _, ok := a.failures[code]; !ok {
+			codes = append(codes, string(code))
+		}
+	}
+	sort.Strings(codes)
+	parts := make([]string, 0, len(codes))
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("%s %d (was %d)", code, a.failures[diskerr.Code(code)], b.failures[diskerr.Code(code)]))
+	}
+	return trend + " By code: " + strings.Join(parts, ", ") + "."
+}
+
+// compareResults reads the results of two runs and writes their comparison
+// to w.
+func compareResults(w io.Writer, beforePath, afterPath string) error {
+	before, err := readResults(beforePath)
+	if err != nil {
+		return err
+	}
+	after, err := readResults(afterPath)
+	if err != nil {
+		return err
+	}
+	compareRuns(w, filepath.Base(beforePath), before, filepath.Base(afterPath), after, pricing.Default)
+	return nil
+}
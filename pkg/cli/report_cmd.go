@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func newReportCommand() *cobra.Command {
+	reportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "report on past runs",
+	}
+	reportCompareCmd := &cobra.Command{
+		Use:         "compare run-a.jsonl run-b.jsonl",
+		Short:       "describe what changed between two runs, given the results they wrote with --output json",
+		Args:        cobra.ExactArgs(2),
+		Annotations: map[string]string{annotationOffline: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return compareResults(cmd.OutOrStdout(), args[0], args[1])
+		},
+	}
+	reportCmd.AddCommand(reportCompareCmd)
+	return reportCmd
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/pricing"
+)
+
+func Test_CompareRuns(t *testing.T) {
+	t.Parallel()
+
+	disk := func(name, action string, sizeGB int64) diskResult {
+		return diskResult{ProjectID: "testing", Zone: "us-east1-b", Name: name, Action: action, Type: "pd-standard", SizeGB: sizeGB}
+	}
+	failed := func(name string, code diskerr.Code) diskResult {
+		r := disk(name, "SKIP", 10)
+		r.Error, r.Code = "failed", code
+		return r
+	}
+	alreadyMarked := disk("old", "SKIP", 100)
+	alreadyMarked.Error, alreadyMarked.Code = "already marked", diskerr.CodeAlreadyMarked
+	dryRun := disk("dry", "DELETE", 50)
+	dryRun.DryRun, dryRun.Error, dryRun.Code = true, "dry run", diskerr.CodeDryRun
+
+	before := []diskResult{
+		disk("old", "MARK", 100),
+		disk("reclaimed-earlier", "DELETE", 200),
+		failed("broken-1", diskerr.CodeAPI),
+		failed("broken-2", diskerr.CodeAPI),
+	}
+	after := []diskResult{
+		alreadyMarked,
+		disk("new", "MARK", 10),
+		disk("reclaimed", "DELETE", 25),
+		dryRun,
+		disk("kept", "SKIP", 10),
+		failed("broken-1", diskerr.CodeIterator),
+	}
+
+	var buf bytes.Buffer
+	compareRuns(&buf, "march.jsonl", before, "april.jsonl", after, pricing.Default)
+	require.Equal(t, `Disk cleanup: april.jsonl compared to march.jsonl
+
+- New candidates: 1 disk (10 GB, an estimated $0.40/month) newly marked for deletion, out of 2 candidates in total.
+- Reclaimed this period: 1 disk (25 GB, an estimated $1.00/month) deleted.
+- Not reclaimed yet: 1 disk (50 GB, an estimated $2.00/month) would have been deleted, but the run was a dry run.
+- Cumulative savings: 2 disks (225 GB, an estimated $9.00/month) deleted across both runs.
+- Errors: 1 disk failed, down from 2. By code: API 0 (was 2), ITERATOR 1 (was 0).
+
+Costs are estimated at us-central1 list prices.
+`, buf.String())
+
+	buf.Reset()
+	compareRuns(&buf, "a", nil, "b", nil, pricing.Default)
+	require.Contains(t, buf.String(), "- Errors: none in either run.\n")
+}
+
+func Test_ReadResults(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"projectID":"testing","zone":"us-east1-b","name":"test-disk","action":"MARK","sizeGB":10}
+
+{"projectID":"testing","zone":"us-east1-b","name":"test-disk","action":"DELETE","type":"pd-ssd","sizeGB":10}
+`), 0o600))
+	results, err := readResults(path)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "projects/testing/zones/us-east1-b/disks/test-disk", results[0].key())
+	require.Equal(t, "pd-ssd", results[1].Type)
+
+	require.NoError(t, os.WriteFile(path, []byte("not json\n"), 0o600))
+	_, err = readResults(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 1")
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// loadResourceMarks reads the marks of resources such as addresses from the
+// file at path in s. A missing file holds no marks.
+func loadResourceMarks(ctx context.Context, s store.Store, path string) (cleanup.ResourceMarks, error) {
+	marks := make(cleanup.ResourceMarks)
+	data, err := s.Get(ctx, path)
+	if errors.Is(err, store.ErrNotExist) {
+		return marks, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("read resource marks: %w", err)
+	}
+	if err := json.Unmarshal(data, &marks); err != nil {
+		return nil, xerrors.Errorf("parse resource marks %s: %w", path, err)
+	}
+	return marks, nil
+}
+
+// saveResourceMarks writes marks to the file at path in s.
+func saveResourceMarks(ctx context.Context, s store.Store, path string, marks cleanup.ResourceMarks) error {
+	data, err := json.MarshalIndent(marks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, path, data); err != nil {
+		return xerrors.Errorf("write resource marks: %w", err)
+	}
+	return nil
+}
+
+// forEachResourceProject calls fn for every project with the marks of kind,
+// e.g. address, loaded from the file at path in s, and saves the marks
+// changed by the projects that succeeded unless dryRun is set.
+func forEachResourceProject(ctx context.Context, s store.Store, path, kind string, projects []string, dryRun bool, fn func(projectID string, marks cleanup.ResourceMarks) (cleanup.ResourceStats, error)) error {
+	marks, err := loadResourceMarks(ctx, s, path)
+	if err != nil {
+		return err
+	}
+	err = forEachProject(projects, func(projectID string) (cleanup.Stats, error) {
+		stats, err := fn(projectID, marks)
+		log.Info().Str("projectID", projectID).
+			Int("marked", stats.Marked).
+			Int("unmarked", stats.Unmarked).
+			Int("deleted", stats.Deleted).
+			Bool("dryRun", dryRun).
+			Msg(kind + " summary")
+		return stats.Stats, err
+	})
+	if dryRun {
+		return err
+	}
+	if saveErr := saveResourceMarks(ctx, s, path, marks); err == nil {
+		err = saveErr
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_resourceMarks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := store.Local{Dir: t.TempDir()}
+	marks, err := loadResourceMarks(ctx, s, "address-marks.json")
+	require.NoError(t, err)
+	require.Empty(t, marks)
+
+	marks["projects/p/regions/r/addresses/a"] = "2024-01-02"
+	require.NoError(t, saveResourceMarks(ctx, s, "address-marks.json", marks))
+	loaded, err := loadResourceMarks(ctx, s, "address-marks.json")
+	require.NoError(t, err)
+	require.Equal(t, cleanup.ResourceMarks{"projects/p/regions/r/addresses/a": "2024-01-02"}, loaded)
+}
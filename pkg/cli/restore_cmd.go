@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+
+	computev1 "cloud.google.com/go/compute/apiv1"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/archive"
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// restoreConfig holds the flags of restore.
+type restoreConfig struct {
+	diskType string
+	labels   bool
+}
+
+func newRestoreCommand(a *app) *cobra.Command {
+	var c restoreConfig
+	restoreCmd := &cobra.Command{
+		Use:   "restore <disk-name>",
+		Short: "recreate a deleted disk from its snapshot",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snapshotsClient, err := computev1.NewSnapshotsRESTClient(cmd.Context(), a.projectOpts.of(a.cfg.projectID, a.opts.ClientOptions)...)
+			if err != nil {
+				return xerrors.Errorf("init snapshots client: %w", err)
+			}
+			defer snapshotsClient.Close()
+			restorer := cleanup.NewRestorer(a.disksClient, snapshotsClient, a.bus)
+			_, err = restorer.Restore(cmd.Context(), cleanup.RestoreOptions{
+				ProjectID: a.cfg.projectID,
+				DiskName:  args[0],
+				Zone:      a.cfg.zone,
+				DiskType:  c.diskType,
+				Labels:    c.labels,
+				Tenant:    a.tenant,
+				DryRun:    a.cfg.dryRun,
+			})
+			if errors.Is(err, diskerr.ErrDryRun) {
+				return nil
+			}
+			return err
+		},
+	}
+	restoreCmd.PersistentFlags().StringVar(&c.diskType, "disk-type", "pd-standard", "disk type to use if the snapshot does not record the original one")
+	restoreCmd.PersistentFlags().BoolVar(&c.labels, "restore-labels", true, "restore the labels the disk had when it was deleted")
+	return restoreCmd
+}
+
+func newThawCommand(a *app) *cobra.Command {
+	var restoreLabels bool
+	thawCmd := &cobra.Command{
+		Use:   "thaw <disk-name>",
+		Short: "recreate a disk archived by cleanup --mode archive from its archive snapshot",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			records, err := archive.Read(cmd.Context(), a.stateStore, a.cfg.archiveIndex)
+			if err != nil {
+				return err
+			}
+			record, ok := archive.Find(records, a.cfg.projectID, args[0])
+			if !ok {
+				return xerrors.Errorf("disk %s of project %s is not in the archive index %s", args[0], a.cfg.projectID, a.cfg.archiveIndex)
+			}
+			snapshotsClient, err := computev1.NewSnapshotsRESTClient(cmd.Context(), a.projectOpts.of(a.cfg.projectID, a.opts.ClientOptions)...)
+			if err != nil {
+				return xerrors.Errorf("init snapshots client: %w", err)
+			}
+			defer snapshotsClient.Close()
+			restorer := cleanup.NewRestorer(a.disksClient, snapshotsClient, a.bus)
+			_, err = restorer.Restore(cmd.Context(), cleanup.RestoreOptions{
+				ProjectID: a.cfg.projectID,
+				DiskName:  record.DiskName,
+				Zone:      record.Zone,
+				DiskType:  record.DiskType,
+				Labels:    restoreLabels,
+				Tenant:    a.tenant,
+				Snapshot:  record.Snapshot,
+				DryRun:    a.cfg.dryRun,
+			})
+			if errors.Is(err, diskerr.ErrDryRun) {
+				return nil
+			}
+			return err
+		},
+	}
+	thawCmd.PersistentFlags().BoolVar(&restoreLabels, "restore-labels", true, "restore the labels the disk had when it was archived")
+	return thawCmd
+}
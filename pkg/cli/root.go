@@ -0,0 +1,595 @@
+// Package cli provides the gke-disk-cleanup cobra commands so that other
+// tools can mount them as a subcommand of their own CLI.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/archive"
+	"gke-disk-cleanup/pkg/audit"
+	"gke-disk-cleanup/pkg/certificate"
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/history"
+	"gke-disk-cleanup/pkg/inventory"
+	"gke-disk-cleanup/pkg/metrics"
+	"gke-disk-cleanup/pkg/pricing"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// Options configures the command tree returned by NewRootCommand.
+type Options struct {
+	// Use is the name of the root command. Defaults to "gke-disk-cleanup";
+	// set it to e.g. "disk-cleanup" when mounting under another CLI.
+	Use string
+	// ClientOptions are passed to the compute API client. Application
+	// default credentials are used when empty.
+	ClientOptions []option.ClientOption
+	// Handlers are subscribed to all engine events, in addition to the
+	// built-in log output.
+	Handlers []events.Handler
+}
+
+// NewRootCommand returns the gke-disk-cleanup command tree. The compute
+// client is only created once a subcommand is executed, so the returned
+// command can safely be added to another cobra command.
+func NewRootCommand(opts Options) *cobra.Command {
+	if opts.Use == "" {
+		opts.Use = "gke-disk-cleanup"
+	}
+	a := newApp(opts)
+	rootCmd := &cobra.Command{
+		Use:   opts.Use,
+		Short: "mark and clean up persistent disks in gcloud",
+		CompletionOptions: cobra.CompletionOptions{
+			DisableDefaultCmd: true,
+		},
+		PersistentPreRunE:  a.preRun,
+		PersistentPostRunE: a.postRun,
+	}
+	a.cfg.addFlags(rootCmd)
+	rootCmd.AddCommand(
+		newMarkCommand(a),
+		newCleanupCommand(a),
+		newUnmarkCommand(a),
+		newCheckCommand(a),
+		newStatusCommand(a),
+		newNotifyOwnersCommand(a),
+		newServeCommand(a),
+		newSoakCommand(a),
+		newControlCommand(),
+		newSnapshotsCommand(a),
+		newAddressesCommand(a),
+		newInstancesCommand(a),
+		newImagesCommand(a),
+		newLoadBalancersCommand(a),
+		newRestoreCommand(a),
+		newThawCommand(a),
+		newReconcileCommand(a),
+		newPolicyCommand(),
+		newReportCommand(),
+	)
+	return rootCmd
+}
+
+// app is the state shared by the commands of a tree returned by
+// NewRootCommand: the flags of the root command, and the clients and sinks
+// set up by preRun for the subcommand executed.
+type app struct {
+	opts Options
+	// clientOptions are those passed in, to which the credential flags are
+	// added on every execution
+	clientOptions []option.ClientOption
+	cfg           rootConfig
+
+	bus      *events.Bus
+	registry *metrics.Registry
+	// control pauses, throttles and aborts runs on request, see controller.
+	control *controller
+	// summary tallies the current mark or cleanup run. It is subscribed once
+	// and reset for every run, as serve starts one run after another.
+	summary *runSummary
+
+	// disksClient is projectDisks, limited to --qps, see limitCalls.
+	disksClient  cleanup.DisksClient
+	projectDisks cleanup.DisksClient
+	projectOpts  projectOptions
+	stateStore   store.Store
+	tenant       cleanup.Tenant
+	selector     cleanup.Selector
+
+	historyWriter     *history.Writer
+	archiveWriter     *archive.Writer
+	certificateWriter *certificate.Writer
+	auditLogger       *audit.Logger
+	exporter          *inventory.Exporter
+	results           *resultPublisher
+	runReport         *diskReport
+	issues            *issueTracker
+	reporter          *runReporter
+	runNotifier       *notifier
+	bar               *progressBar
+}
+
+func newApp(opts Options) *app {
+	a := &app{
+		opts:          opts,
+		clientOptions: opts.ClientOptions,
+		bus:           events.NewBus(),
+		registry:      metrics.NewRegistry(),
+		control:       newController(),
+		summary:       &runSummary{},
+	}
+	a.bus.Subscribe(logEvent)
+	a.bus.Subscribe(a.registry.Handle)
+	for _, h := range opts.Handlers {
+		a.bus.Subscribe(h)
+	}
+	a.bus.Subscribe(a.summary.handle, events.DiskProcessed, events.SnapshotCreated)
+	return a
+}
+
+// rootConfig holds the flags of the root command, which every subcommand
+// inherits.
+type rootConfig struct {
+	configFile          string
+	dryRun              bool
+	projectID           string
+	folderID            string
+	organizationID      string
+	zone                string
+	zones               []string
+	exemptLabel         string
+	skipManaged         bool
+	includeBootDisks    bool
+	tenantLabel         string
+	tenantValue         string
+	nameRegex           string
+	includeLabels       []string
+	includeFile         string
+	excludeFile         string
+	excludeLabels       []string
+	creationSources     []string
+	diskTypes           []string
+	minSizeGB           int64
+	maxSizeGB           int64
+	clusterName         string
+	allDiskFields       bool
+	pageSize            int
+	allZones            bool
+	verbose             bool
+	output              string
+	logFormat           string
+	resumeFrom          string
+	storeLocation       string
+	pauseKey            string
+	lock                bool
+	reportStatus        bool
+	notifyWebhook       string
+	resultsTopic        string
+	reportOut           string
+	ownerLabel          string
+	notifyFormat        string
+	recordConfig        string
+	historyFile         string
+	archiveIndex        string
+	auditBucket         string
+	auditTable          string
+	inventoryTable      string
+	credentialsFile     string
+	impersonateAccount  string
+	preflightCheck      bool
+	operator            string
+	progressInterval    time.Duration
+	progressDisplay     bool
+	progressEvery       int
+	checkpointFile      string
+	checkpointEvery     int
+	concurrency         int
+	mutateQPS           float64
+	mutateBurst         int
+	maxRetries          int
+	fallbackFailureRate float64
+	fallbackMinDisks    int
+	maxFailures         int
+	refreshPricing      bool
+	pricingRegion       string
+	metricsPushURL      string
+	pricingCache        string
+}
+
+// addFlags adds the flags of the root command to cmd.
+func (c *rootConfig) addFlags(cmd *cobra.Command) {
+	fs := cmd.PersistentFlags()
+	fs.StringVar(&c.configFile, "config", "", "read flags not given on the command line from this YAML or JSON file, e.g. project-id: my-project")
+	fs.BoolVar(&c.dryRun, "dry-run", true, "only log the actions that would be taken")
+	fs.StringVar(&c.projectID, "project-id", "default", "google project id, or a comma-separated list of them")
+	fs.StringVar(&c.folderID, "folder-id", "", "operate on all projects in this folder and its sub-folders, overrides --project-id")
+	fs.StringVar(&c.organizationID, "organization-id", "", "operate on all projects in this organization, overrides --project-id")
+	fs.StringVar(&c.zone, "zone", "us-east1-a", "google compute zone")
+	fs.StringSliceVar(&c.zones, "zones", nil, "comma-separated list of google compute zones, overrides --zone")
+	fs.StringVar(&c.exemptLabel, "exempt-label", cleanup.DefaultExemptLabel, "disks with this label set to true are never marked or deleted; empty to disable")
+	fs.BoolVar(&c.skipManaged, "skip-managed", true, "never mark or delete disks managed by Terraform or Config Connector according to their labels, e.g. goog-terraform-provisioned or managed-by-cnrm, which are skipped with MANAGED")
+	fs.BoolVar(&c.includeBootDisks, "include-boot-disks", false, "also mark and delete boot disks, i.e. disks created from an image or with guest OS features, which are skipped with BOOT_DISK otherwise")
+	fs.StringVar(&c.tenantLabel, "tenant-label", "", "label distinguishing the tenants of a shared project; with --tenant, only disks of that tenant are listed or changed")
+	fs.StringVar(&c.tenantValue, "tenant", "", "only list and change disks with --tenant-label set to this value; any other disk is a failure")
+	fs.StringVar(&c.nameRegex, "name-regex", "", "only process listed disks whose name matches this regular expression")
+	fs.StringSliceVar(&c.includeLabels, "include-labels", nil, "only process listed disks with all of these labels, as comma-separated key=value pairs")
+	fs.StringVar(&c.includeFile, "include-file", "", "only process listed disks named in this file, one name or regular expression matching the whole name per line")
+	fs.StringVar(&c.excludeFile, "exclude-file", "", "never process listed disks named in this file, one name or regular expression matching the whole name per line, regardless of their labels and timestamps")
+	fs.StringSliceVar(&c.excludeLabels, "exclude-labels", nil, "never process listed disks with any of these labels, as comma-separated key=value pairs")
+	fs.StringSliceVar(&c.creationSources, "creation-sources", nil, "only process listed disks created from one of these comma-separated sources: blank, image, snapshot or disk")
+	fs.StringSliceVar(&c.diskTypes, "disk-types", nil, "only process listed disks of one of these comma-separated types, e.g. pd-ssd,pd-balanced, to run a policy per type")
+	fs.Int64Var(&c.minSizeGB, "min-size-gb", 0, "only process listed disks of at least this many GB, e.g. to start with huge disks, which save the most; 0 for no minimum")
+	fs.Int64Var(&c.maxSizeGB, "max-size-gb", 0, "only process listed disks of at most this many GB, e.g. to start with small disks, which are the least risky; 0 for no maximum")
+	fs.StringVar(&c.clusterName, "cluster-name", "", "only process listed disks created for this GKE cluster, by their goog-k8s-cluster-name label or in-tree disk name, to run with a policy per cluster")
+	fs.BoolVar(&c.allDiskFields, "all-disk-fields", false, "list disks with all their fields instead of only those that are read, which makes list responses much larger")
+	fs.IntVar(&c.pageSize, "page-size", 0, "how many disks to list per page, at most 500; smaller pages are cheaper to retry in very large zones. 0 for the default of 500")
+	fs.BoolVar(&c.allZones, "all-zones", false, "operate on disks in all zones of the project")
+	fs.BoolVar(&c.verbose, "verbose", false, "verbose output")
+	fs.StringVar(&c.output, "output", outputConsole, "console for human-readable logs, or json to write JSON logs to stderr and a JSON result per disk to stdout")
+	fs.StringVar(&c.logFormat, "log-format", "", "format of the logs on stderr: console, json, or gcp for JSON with the severity, labels and trace fields parsed by Cloud Logging (default follows --output)")
+	fs.StringVar(&c.resumeFrom, "resume-from", "", "resume listing disks at the page that failed in an earlier run, as logged in resumeFrom (zone:token), or resume the run recorded in this --checkpoint-file")
+	fs.StringVar(&c.storeLocation, "store", "", "where checkpoints, the history, the lock and the pricing cache are kept: a directory, gs://bucket/prefix or firestore://project/collection; the file flags then name keys in it (default the local filesystem)")
+	fs.StringVar(&c.pauseKey, "pause-key", "", "pause mark and cleanup runs while this key exists in the store, e.g. gke-disk-cleanup.pause; runs can also be paused with SIGUSR1 and resumed with SIGUSR2")
+	fs.BoolVar(&c.lock, "lock", false, "hold a lock in the store during mark and cleanup runs, so that an overlapping run, e.g. of a CronJob, fails instead")
+	fs.BoolVar(&c.reportStatus, "report-status", false, "when running in a cluster, record the outcome of every mark and cleanup run as an Event and a gke-disk-cleanup/last-<command> annotation on the CronJob or Deployment owning the pod")
+	fs.StringVar(&c.notifyWebhook, "notify-webhook", "", "post a summary of every mark and cleanup run, listing the disks marked, to this Slack, Teams or other webhook URL")
+	fs.StringVar(&c.resultsTopic, "results-topic", "", "publish the result of every disk changed or failed by mark and cleanup runs to this Pub/Sub topic, e.g. projects/p/topics/t, as the JSON record of --output json")
+	fs.StringVar(&c.reportOut, "report-out", "", "write every disk evaluated by a mark or cleanup run, with its decision, size, age, owner and monthly cost, to this .csv or .html file, replaced by every run")
+	fs.StringVar(&c.ownerLabel, "owner-label", defaultOwnerLabel, "label holding the username of the owner of a disk, for --report-out and notify-owners")
+	fs.StringVar(&c.notifyFormat, "notify-format", notifyAuto, "format of --notify-webhook posts: slack, teams, json, or auto to tell Slack and Teams apart by the URL")
+	fs.StringVar(&c.recordConfig, "record-config", "", "write the effective configuration of every run, with the source of each flag and secrets redacted, below this key prefix in the store, e.g. runs")
+	fs.StringVar(&c.historyFile, "history-file", "", "append every change made to disks to this JSON lines file")
+	fs.StringVar(&c.archiveIndex, "archive-index", "archive-index.jsonl", "JSON lines file in the --store recording the archive snapshot of every disk deleted by cleanup --mode archive, read by thaw")
+	fs.StringVar(&c.auditBucket, "audit-gcs-bucket", "", "write an audit record of every change made to disks and snapshots to this Cloud Storage bucket, optionally followed by a prefix, e.g. my-bucket/audit")
+	fs.StringVar(&c.auditTable, "audit-bigquery-table", "", "insert an audit record of every change made to disks and snapshots into this BigQuery table, e.g. my-project.audit.gke_disk_cleanup")
+	fs.StringVar(&c.inventoryTable, "inventory-bigquery-table", "", "insert every disk evaluated by mark, cleanup and unmark runs, with its decision, into this BigQuery table, e.g. my-project.inventory.disks, which is created or extended as needed")
+	fs.StringVar(&c.credentialsFile, "credentials-file", "", "call Google APIs with the credentials in this JSON file, e.g. a service account key, instead of application default credentials")
+	fs.StringVar(&c.impersonateAccount, "impersonate-service-account", "", "call Google APIs as this service account, impersonated with the credentials of --credentials-file or application default credentials, which need roles/iam.serviceAccountTokenCreator on it")
+	fs.BoolVar(&c.preflightCheck, "preflight", true, "before a mark or cleanup run that is not a dry run, check that the permissions it needs are granted in every project, and fail listing those missing otherwise")
+	fs.StringVar(&c.operator, "operator", "", "who runs the command, as recorded in deletion certificates and audit records (default user@hostname)")
+	fs.DurationVar(&c.progressInterval, "progress-interval", 30*time.Second, "log a progress line at least this often, 0 to disable")
+	fs.BoolVar(&c.progressDisplay, "progress", false, "draw a progress bar with the disks processed, the actions taken and the time left on stderr if it is a terminal, instead of logging progress lines")
+	fs.IntVar(&c.progressEvery, "progress-every", 1000, "log a progress line every this many disks, 0 to disable")
+	fs.StringVar(&c.checkpointFile, "checkpoint-file", "", "record the progress of mark and cleanup in this file, and resume from it when restarted, e.g. on spot VMs")
+	fs.IntVar(&c.checkpointEvery, "checkpoint-every", 50, "save a checkpoint every this many disks")
+	fs.IntVar(&c.concurrency, "concurrency", 1, "how many disks mark and cleanup process at a time")
+	fs.Float64Var(&c.mutateQPS, "qps", 0, "how many calls that change disks (set labels, snapshot, delete) to send per second at most, across all projects, to stay within the Compute Engine mutation quota; 0 for unlimited")
+	fs.IntVar(&c.mutateBurst, "burst", 1, "how many calls that change disks may be sent at once after a pause, with --qps")
+	fs.IntVar(&c.maxRetries, "max-retries", 5, "how often a rate-limited or transiently failing call to change a disk is retried, 0 to disable")
+	fs.Float64Var(&c.fallbackFailureRate, "fallback-failure-rate", 0.5, "downgrade the rest of a mark or cleanup run to a dry run once more than this share of the disks it tried to change failed; 1 to disable")
+	fs.IntVar(&c.fallbackMinDisks, "fallback-min-disks", 10, "how many disks a run must have tried to change before --fallback-failure-rate applies")
+	fs.IntVar(&c.maxFailures, "max-failures", 0, "how many disks may fail in a mark or cleanup run before the command exits with a non-zero code; -1 to tolerate any number")
+	fs.BoolVar(&c.refreshPricing, "refresh-pricing", false, "fetch current disk and snapshot prices for the run summary from the Cloud Billing Catalog API instead of using built-in prices")
+	fs.StringVar(&c.pricingRegion, "pricing-region", pricing.Default.Region, "region whose prices --refresh-pricing fetches")
+	fs.StringVar(&c.metricsPushURL, "metrics-push-url", "", "push metrics to this Prometheus Pushgateway after every mark and cleanup run, e.g. http://pushgateway:9091")
+	fs.StringVar(&c.pricingCache, "pricing-cache", "", "file to cache fetched prices in for a day (default in the user cache directory)")
+}
+
+// preRun reads the flags of the root command and of cmd, the subcommand
+// executed, and sets up the clients and sinks of its run.
+func (a *app) preRun(cmd *cobra.Command, _ []string) error {
+	c := &a.cfg
+	// flags take precedence over the environment, which takes precedence
+	// over the config file
+	fromFlags := changedFlags(cmd)
+	if err := applyEnv(cmd, os.Environ()); err != nil {
+		return err
+	}
+	fromEnv := changedFlags(cmd)
+	for name := range fromFlags {
+		delete(fromEnv, name)
+	}
+	var targets []projectTarget
+	if c.configFile != "" {
+		if err := applyConfig(cmd, c.configFile); err != nil {
+			return err
+		}
+		var err error
+		if targets, err = loadProjectTargets(c.configFile); err != nil {
+			return err
+		}
+		// the projects listed are the targets, unless others are given by
+		// flag or environment
+		if len(targets) > 0 && !cmd.Flags().Changed("project-id") && c.folderID == "" && c.organizationID == "" {
+			ids := make([]string, 0, len(targets))
+			for _, t := range targets {
+				ids = append(ids, t.ID)
+			}
+			c.projectID = strings.Join(ids, ",")
+		}
+	}
+	if err := setupLogging(c.verbose, c.output, c.logFormat, cmd.Name(), c.projectID); err != nil {
+		return err
+	}
+	if err := a.resolveScope(); err != nil {
+		return err
+	}
+	if cmd.Annotations[annotationOffline] != "" {
+		return nil
+	}
+	if c.output == outputJSON {
+		a.bus.Subscribe(newResultWriter(cmd.OutOrStdout()).handle, events.DiskProcessed)
+	}
+	if c.progressDisplay && isTerminal(os.Stderr) {
+		a.bar = newProgressBar(os.Stderr)
+		a.bus.Subscribe(a.bar.handle)
+	} else {
+		a.bar = nil
+		a.bus.Subscribe(newProgressLogger(c.progressInterval, c.progressEvery).handle)
+	}
+	creds, err := loadCredentials(cmd.Context(), c.credentialsFile, c.impersonateAccount)
+	if err != nil {
+		return err
+	}
+	a.opts.ClientOptions = a.clientOptions
+	auditBase := audit.Record{Command: cmd.Name(), Operator: resolveOperator(c.operator)}
+	if creds != nil {
+		if err := creds.check(); err != nil {
+			return err
+		}
+		a.opts.ClientOptions = append(append([]option.ClientOption(nil), a.clientOptions...), creds.Options...)
+		auditBase.Identity = creds.Identity
+		log.Info().Str("identity", creds.Identity).Msg("using credentials")
+	}
+	a.stateStore, err = store.Open(cmd.Context(), c.storeLocation, a.opts.ClientOptions...)
+	if err != nil {
+		return err
+	}
+	effective := newEffectiveConfig(cmd, fromFlags, fromEnv, flagFiles(cmd, "config", "score-model", "mark-policy", "include-file", "exclude-file")...)
+	effective.log()
+	if c.recordConfig != "" {
+		key, err := effective.record(cmd.Context(), a.stateStore, c.recordConfig)
+		if err != nil {
+			return err
+		}
+		log.Info().Str("key", key).Msg("recorded effective configuration")
+	}
+	go a.control.watchSignals(cmd.Context())
+	if c.pauseKey != "" {
+		go a.control.watchPauseKey(cmd.Context(), a.stateStore, c.pauseKey, pauseKeyInterval)
+	}
+	if c.historyFile != "" && cmd.Name() != "reconcile" {
+		a.historyWriter = history.Open(cmd.Context(), a.stateStore, c.historyFile)
+		a.bus.Subscribe(a.historyWriter.Handle)
+	}
+	a.auditLogger, err = newAuditLogger(cmd.Context(), c.auditBucket, c.auditTable, auditBase, a.opts.ClientOptions)
+	if err != nil {
+		return err
+	}
+	if a.auditLogger != nil {
+		a.bus.Subscribe(a.auditLogger.Handle)
+	}
+	if c.inventoryTable != "" {
+		sink, err := inventory.NewBigQuery(cmd.Context(), c.inventoryTable, a.opts.ClientOptions...)
+		if err != nil {
+			return err
+		}
+		a.exporter = inventory.NewExporter(cmd.Context(), sink)
+		a.bus.Subscribe(a.exporter.Handle, events.DiskProcessed)
+	}
+	if c.resultsTopic != "" {
+		client, err := newPubSubClient(cmd.Context(), a.opts.ClientOptions)
+		if err != nil {
+			return err
+		}
+		a.results = newResultPublisher(client, c.resultsTopic)
+		a.bus.Subscribe(a.results.handle, events.DiskProcessed)
+	}
+	if c.reportOut != "" {
+		if a.runReport, err = newDiskReport(c.reportOut, c.ownerLabel); err != nil {
+			return err
+		}
+		a.bus.Subscribe(a.runReport.handle, events.DiskProcessed)
+	}
+	if c.notifyWebhook != "" {
+		if a.runNotifier, err = newNotifier(c.notifyWebhook, c.notifyFormat, a.opts.Use); err != nil {
+			return err
+		}
+	}
+	if c.reportStatus {
+		if a.reporter, err = newRunReporter(cmd.Context(), a.opts.Use); err != nil {
+			return err
+		}
+	}
+	if a.projectOpts, err = loadProjectOptions(cmd.Context(), targets, c.credentialsFile, a.clientOptions); err != nil {
+		return err
+	}
+	if a.projectDisks, err = newProjectDisks(cmd.Context(), a.opts.ClientOptions, a.projectOpts); err != nil {
+		return err
+	}
+	return a.limitCalls()
+}
+
+// postRun closes the writers opened for the run of the subcommand.
+func (a *app) postRun(*cobra.Command, []string) error {
+	var err error
+	if a.historyWriter != nil {
+		err = a.historyWriter.Close()
+	}
+	if a.archiveWriter != nil {
+		if closeErr := a.archiveWriter.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if a.certificateWriter != nil {
+		if closeErr := a.certificateWriter.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if a.auditLogger != nil {
+		if closeErr := a.auditLogger.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if a.exporter != nil {
+		if closeErr := a.exporter.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// flagFiles returns the files named by the flags of cmd among names; flags
+// cmd does not have are left out.
+func flagFiles(cmd *cobra.Command, names ...string) []string {
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		if f := cmd.Flags().Lookup(name); f != nil {
+			values = append(values, f.Value.String())
+		}
+	}
+	return values
+}
+
+// resolveScope derives the tenant and the selector of the disks to process
+// from their flags.
+func (a *app) resolveScope() error {
+	c := &a.cfg
+	var err error
+	if a.tenant, err = resolveTenant(c.tenantLabel, c.tenantValue); err != nil {
+		return err
+	}
+	if a.selector, err = cleanup.ParseSelector(c.nameRegex, c.includeLabels, c.excludeLabels); err != nil {
+		return err
+	}
+	if c.includeFile != "" {
+		if a.selector.IncludeNames, err = loadNameList(c.includeFile); err != nil {
+			return err
+		}
+	}
+	if c.excludeFile != "" {
+		if a.selector.ExcludeNames, err = loadNameList(c.excludeFile); err != nil {
+			return err
+		}
+	}
+	if a.selector.Sources, err = cleanup.ParseSources(c.creationSources); err != nil {
+		return err
+	}
+	if a.selector.Types, err = cleanup.ParseDiskTypes(c.diskTypes); err != nil {
+		return err
+	}
+	if c.minSizeGB < 0 || c.maxSizeGB < 0 || (c.maxSizeGB > 0 && c.minSizeGB > c.maxSizeGB) {
+		return xerrors.Errorf("--min-size-gb and --max-size-gb must not be negative, and --min-size-gb not above --max-size-gb")
+	}
+	a.selector.MinSizeGB, a.selector.MaxSizeGB = c.minSizeGB, c.maxSizeGB
+	a.selector.Cluster = c.clusterName
+	return nil
+}
+
+// limitCalls validates the paging and rate flags, and limits the calls of
+// projectDisks that change disks to --qps.
+func (a *app) limitCalls() error {
+	c := &a.cfg
+	if c.pageSize < 0 || c.pageSize > cleanup.MaxPageSize {
+		return xerrors.Errorf("--page-size must be between 1 and %d, or 0 for the default", cleanup.MaxPageSize)
+	}
+	if c.mutateQPS < 0 || c.mutateBurst < 1 {
+		return xerrors.Errorf("--qps must not be negative and --burst must be positive")
+	}
+	a.disksClient = a.projectDisks
+	if c.mutateQPS > 0 {
+		a.disksClient = cleanup.RateLimitDisks(a.projectDisks, cleanup.NewBurstRate(c.mutateQPS, c.mutateBurst))
+	}
+	return nil
+}
+
+// projects returns the projects of --project-id, --folder-id or
+// --organization-id.
+func (a *app) projects(ctx context.Context) ([]string, error) {
+	return resolveProjects(ctx, a.opts.ClientOptions, a.cfg.projectID, a.cfg.folderID, a.cfg.organizationID)
+}
+
+// zones returns the zones of --zone, --zones or --all-zones, nil for all.
+func (a *app) zones() ([]string, error) {
+	return resolveZones(a.cfg.zone, a.cfg.zones, a.cfg.allZones)
+}
+
+// resolveZones returns the zones to operate on. A nil result means all zones.
+func resolveZones(zone string, zones []string, allZones bool) ([]string, error) {
+	if allZones {
+		if len(zones) > 0 {
+			return nil, xerrors.Errorf("--zones and --all-zones are mutually exclusive")
+		}
+		return nil, nil
+	}
+	if len(zones) > 0 {
+		return zones, nil
+	}
+	return []string{zone}, nil
+}
+
+// resolveTenant returns the tenant to scope the run to, which is given by
+// both --tenant-label and --tenant or neither.
+func resolveTenant(label, value string) (cleanup.Tenant, error) {
+	if (label == "") != (value == "") {
+		return cleanup.Tenant{}, xerrors.Errorf("--tenant-label and --tenant must be given together")
+	}
+	return cleanup.Tenant{Label: label, Value: value}, nil
+}
+
+// parseSourceCutoffs parses the source=days pairs of --cutoff-by-source.
+func parseSourceCutoffs(pairs []string) (map[cleanup.Source]time.Duration, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	cutoffs := make(map[cleanup.Source]time.Duration, len(pairs))
+	for _, pair := range pairs {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, xerrors.Errorf("invalid --cutoff-by-source %q: expected source=days", pair)
+		}
+		source, err := cleanup.ParseSource(pair[:i])
+		if err != nil {
+			return nil, err
+		}
+		days, err := strconv.ParseInt(pair[i+1:], 10, 64)
+		if err != nil || days < 0 {
+			return nil, xerrors.Errorf("invalid --cutoff-by-source %q: expected a number of days", pair)
+		}
+		cutoffs[source] = 24 * time.Hour * time.Duration(days)
+	}
+	return cutoffs, nil
+}
+
+// fallbackError returns an error if fallback downgraded the run to a dry run,
+// so that the run fails instead of appearing to have succeeded.
+func fallbackError(fallback *cleanup.Fallback) error {
+	if !fallback.DryRun() {
+		return nil
+	}
+	attempted, failed := fallback.Counts()
+	code := ExitPartialFailure
+	if failed == attempted {
+		code = ExitFailure
+	}
+	return &exitError{code: code, msg: fmt.Sprintf("%d of %d disks failed, the rest of the run was downgraded to a dry run", failed, attempted)}
+}
+
+// resolveResume parses the --resume-from cursor. A cursor belongs to the
+// listing of a single project, so it cannot be combined with several. It is
+// nil if --resume-from names a checkpoint file instead, see openCheckpoint.
+func resolveResume(resumeFrom string, projects []string) (*cleanup.Cursor, error) {
+	if resumeFrom == "" || isCheckpointFile(resumeFrom) {
+		return nil, nil
+	}
+	if len(projects) != 1 {
+		return nil, xerrors.Errorf("--resume-from requires a single project, use --project-id")
+	}
+	cursor, err := cleanup.ParseCursor(resumeFrom)
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+func Test_NewRootCommand(t *testing.T) {
+	t.Parallel()
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Parallel()
+		cmd := NewRootCommand(Options{})
+		require.Equal(t, "gke-disk-cleanup", cmd.Name())
+	})
+
+	t.Run("embedded", func(t *testing.T) {
+		t.Parallel()
+		cmd := NewRootCommand(Options{Use: "disk-cleanup"})
+		require.Equal(t, "disk-cleanup", cmd.Name())
+		for _, name := range []string{"mark", "cleanup", "unmark", "status", "serve", "soak", "control"} {
+			sub, _, err := cmd.Find([]string{name})
+			require.NoError(t, err)
+			require.Equal(t, name, sub.Name())
+		}
+	})
+}
+
+func Test_ResolveZones(t *testing.T) {
+	t.Parallel()
+
+	zones, err := resolveZones("us-east1-a", nil, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"us-east1-a"}, zones)
+
+	zones, err = resolveZones("us-east1-a", []string{"us-east1-b", "us-east1-c"}, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"us-east1-b", "us-east1-c"}, zones)
+
+	zones, err = resolveZones("us-east1-a", nil, true)
+	require.NoError(t, err)
+	require.Nil(t, zones)
+
+	_, err = resolveZones("us-east1-a", []string{"us-east1-b"}, true)
+	require.EqualError(t, err, "--zones and --all-zones are mutually exclusive")
+}
+
+func Test_ResolveTenant(t *testing.T) {
+	t.Parallel()
+
+	tenant, err := resolveTenant("", "")
+	require.NoError(t, err)
+	require.Equal(t, cleanup.Tenant{}, tenant)
+
+	tenant, err = resolveTenant("team", "payments")
+	require.NoError(t, err)
+	require.Equal(t, cleanup.Tenant{Label: "team", Value: "payments"}, tenant)
+
+	_, err = resolveTenant("team", "")
+	require.EqualError(t, err, "--tenant-label and --tenant must be given together")
+}
+
+func Test_ParseSourceCutoffs(t *testing.T) {
+	t.Parallel()
+
+	cutoffs, err := parseSourceCutoffs([]string{"image=90", "snapshot=0"})
+	require.NoError(t, err)
+	require.Equal(t, map[cleanup.Source]time.Duration{cleanup.SourceImage: 90 * 24 * time.Hour, cleanup.SourceSnapshot: 0}, cutoffs)
+
+	_, err = parseSourceCutoffs([]string{"image"})
+	require.EqualError(t, err, `invalid --cutoff-by-source "image": expected source=days`)
+
+	_, err = parseSourceCutoffs([]string{"image=3m"})
+	require.EqualError(t, err, `invalid --cutoff-by-source "image=3m": expected a number of days`)
+
+	_, err = parseSourceCutoffs([]string{"iso=90"})
+	require.EqualError(t, err, `unknown creation source "iso", expected one of blank, image, snapshot, disk`)
+}
+
+func Test_ResolveResume(t *testing.T) {
+	t.Parallel()
+
+	resume, err := resolveResume("", []string{"project-a", "project-b"})
+	require.NoError(t, err)
+	require.Nil(t, resume)
+
+	resume, err = resolveResume("us-east1-b:token", []string{"project-a"})
+	require.NoError(t, err)
+	require.Equal(t, &cleanup.Cursor{Zone: "us-east1-b", PageToken: "token"}, resume)
+
+	_, err = resolveResume("us-east1-b:token", []string{"project-a", "project-b"})
+	require.EqualError(t, err, "--resume-from requires a single project, use --project-id")
+}
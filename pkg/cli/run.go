@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/pricing"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// metricsPushTimeout is how long pushing metrics may take.
+const metricsPushTimeout = 10 * time.Second
+
+const (
+	// lockKey is the key of the run lock in the store.
+	lockKey = "gke-disk-cleanup.lock"
+	// pauseKeyInterval is how often --pause-key is checked.
+	pauseKeyInterval = 30 * time.Second
+	// lockTTL is how long a run lock is held at most, after which it is
+	// taken over, e.g. if its owner was killed.
+	lockTTL = 24 * time.Hour
+)
+
+// loadPrices returns the current prices with --refresh-pricing, or nil for
+// the built-in ones.
+func (a *app) loadPrices(ctx context.Context) *pricing.Table {
+	c := &a.cfg
+	if !c.refreshPricing {
+		return nil
+	}
+	return pricing.Load(ctx, pricing.LoadOptions{
+		Region:        c.pricingRegion,
+		CacheFile:     pricingCacheFile(c.pricingCache, c.pricingRegion, c.storeLocation != ""),
+		Store:         a.stateStore,
+		MaxAge:        pricingMaxAge,
+		ClientOptions: a.opts.ClientOptions,
+	})
+}
+
+// startSummary resets the summary and the sinks of the runs for a run of
+// command, and returns the summary.
+func (a *app) startSummary(ctx context.Context, command string) *runSummary {
+	prices := a.loadPrices(ctx)
+	a.summary.reset(prices)
+	a.runReport.reset(prices)
+	a.issues.reset()
+	a.exporter.Begin(command, prices)
+	return a.summary
+}
+
+// observeRun records the outcome of a run of command that started at start
+// in the metrics, and pushes them if requested.
+func (a *app) observeRun(command string, start time.Time, err error) {
+	a.registry.ObserveRun(command, time.Since(start), err)
+	if a.cfg.metricsPushURL == "" {
+		return
+	}
+	// push even if the run was interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), metricsPushTimeout)
+	defer cancel()
+	if err := a.registry.Push(ctx, a.cfg.metricsPushURL, a.opts.Use); err != nil {
+		log.Warn().Err(err).Msg("unable to push metrics")
+	}
+}
+
+// reportRun records the outcome of a run of command that started at start on
+// the owner of the pod with --report-status, and posts it to
+// --notify-webhook. summary is nil if the run failed before processing
+// disks.
+func (a *app) reportRun(command string, start time.Time, summary *runSummary, err error) {
+	if a.reporter == nil && a.runNotifier == nil {
+		return
+	}
+	var counts *summaryCounts
+	var marked []newlyMarkedDisk
+	if summary != nil {
+		counts, marked = summary.totals(), summary.markedDisks()
+	}
+	status := newRunStatus(command, start, time.Now(), a.cfg.dryRun, counts, err)
+	// report even if the run was interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), runStatusTimeout)
+	defer cancel()
+	if err := a.reporter.report(ctx, status); err != nil {
+		log.Warn().Err(err).Msg("unable to report run status")
+	}
+	if err := a.runNotifier.notify(ctx, notification{runStatus: status, MarkedDisks: marked}); err != nil {
+		log.Warn().Err(err).Msg("unable to send notification")
+	}
+}
+
+// flushRun writes the audit records, publishes the results, exports the disks
+// and writes the report of a run of command, even if it was interrupted.
+func (a *app) flushRun(command string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), runStatusTimeout)
+	defer cancel()
+	if err := a.auditLogger.Flush(ctx); err != nil {
+		return xerrors.Errorf("write audit records: %w", err)
+	}
+	if err := a.results.Flush(ctx); err != nil {
+		return err
+	}
+	if err := a.exporter.Flush(ctx); err != nil {
+		return xerrors.Errorf("export disks: %w", err)
+	}
+	return a.runReport.write(ctx, a.stateStore, command)
+}
+
+// preflight fails a run of command that is not a dry run if the permissions
+// it needs are missing in any of projects, unless disabled with
+// --preflight=false. snapshot and exportTo are the --do-snapshot and
+// --export-to of a cleanup run.
+func (a *app) preflight(ctx context.Context, projects []string, command string, snapshot bool, exportTo string) error {
+	if a.cfg.dryRun || !a.cfg.preflightCheck {
+		return nil
+	}
+	rm, err := newProjectResourceManager(ctx, a.opts.ClientOptions, a.projectOpts)
+	if err != nil {
+		return err
+	}
+	if err := checkPermissions(ctx, rm, projects, command, snapshot); err != nil {
+		return err
+	}
+	if command == "cleanup" && exportTo != "" {
+		missing, err := missingPermissions(ctx, rm, projects, exportPermissions)
+		if err != nil {
+			return err
+		}
+		if err := permissionsError(missing); err != nil {
+			return err
+		}
+	}
+	log.Debug().Str("command", command).Int("projects", len(projects)).Msg("permissions checked")
+	return nil
+}
+
+// beginProgress starts drawing the progress bar of a run of command over
+// projects and zones, with the number of disks of the last such run as the
+// expected total. The returned func ends it and, if the run succeeded,
+// records the number of disks for the next run.
+func (a *app) beginProgress(ctx context.Context, command string, projects, zones []string) func(err error) {
+	if a.bar == nil {
+		return func(error) {}
+	}
+	scope := progressScope(command, projects, zones)
+	a.bar.begin(expectedDisks(ctx, a.stateStore, scope))
+	return func(err error) {
+		processed := a.bar.end()
+		if err != nil || processed == 0 {
+			return
+		}
+		if err := recordDisks(ctx, a.stateStore, scope, processed); err != nil {
+			log.Debug().Err(err).Msg("unable to record the disk count of the run")
+		}
+	}
+}
+
+// acquireLock takes the run lock in the store if --lock is set, so that
+// overlapping runs fail instead of processing the same disks.
+func (a *app) acquireLock(ctx context.Context) (release func(), err error) {
+	if !a.cfg.lock {
+		return func() {}, nil
+	}
+	l, err := store.Acquire(ctx, a.stateStore, lockKey, lockTTL)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := l.Release(context.Background()); err != nil {
+			log.Warn().Err(err).Msg("unable to release lock")
+		}
+	}, nil
+}
+
+// newFallback returns the fallback shared by the projects of a run, nil if
+// disabled.
+func (a *app) newFallback() *cleanup.Fallback {
+	if a.cfg.fallbackFailureRate >= 1 {
+		return nil
+	}
+	return cleanup.NewFallback(a.cfg.fallbackFailureRate, a.cfg.fallbackMinDisks)
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/kube"
+)
+
+// lastRunAnnotation is the prefix of the annotations holding the status of
+// the last run of a command, e.g. gke-disk-cleanup/last-cleanup.
+const lastRunAnnotation = "gke-disk-cleanup/last-"
+
+// runStatusTimeout is how long reporting the status of a run may take.
+const runStatusTimeout = 10 * time.Second
+
+// runStatus is the outcome of a mark or cleanup run, as recorded in the
+// annotation.
+type runStatus struct {
+	Command     string    `json:"command"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	DryRun      bool      `json:"dryRun"`
+	Scanned     int       `json:"scanned"`
+	Marked      int       `json:"marked"`
+	Unmarked    int       `json:"unmarked"`
+	Skipped     int       `json:"skipped"`
+	Snapshotted int       `json:"snapshotted"`
+	Deleted     int       `json:"deleted"`
+	Failed      int       `json:"failed"`
+	AffectedGB  int64     `json:"affectedGB"`
+	// MonthlyCost is what the marked or deleted disks cost per month.
+	MonthlyCost float64 `json:"estimatedMonthlyCostUSD"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// newRunStatus returns the status of a run of command. counts is nil if the
+// run failed before processing disks.
+func newRunStatus(command string, started, finished time.Time, dryRun bool, counts *summaryCounts, err error) runStatus {
+	s := runStatus{Command: command, Started: started.UTC(), Finished: finished.UTC(), DryRun: dryRun}
+	if counts != nil {
+		s.Scanned, s.Marked, s.Unmarked, s.Skipped = counts.Scanned, counts.Marked, counts.Unmarked, counts.Skipped
+		s.Snapshotted, s.Deleted, s.Failed, s.AffectedGB = counts.Snapshotted, counts.Deleted, counts.Failed, counts.AffectedGB
+		s.MonthlyCost = counts.MonthlyCost
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	return s
+}
+
+// event returns the Kubernetes Event about s: a warning if the run or a disk
+// failed.
+func (s runStatus) event() kube.Event {
+	e := kube.Event{Type: kube.EventNormal, Reason: "RunSucceeded", Time: s.Finished}
+	outcome := "finished"
+	switch {
+	case s.Error != "":
+		e.Type, e.Reason, outcome = kube.EventWarning, "RunFailed", "failed"
+	case s.Failed > 0:
+		e.Type, e.Reason = kube.EventWarning, "DisksFailed"
+	}
+	if s.DryRun {
+		outcome = "dry run " + outcome
+	}
+	e.Message = fmt.Sprintf("%s %s in %s: %d scanned, %d marked, %d unmarked, %d skipped, %d snapshotted, %d deleted, %d failed",
+		s.Command, outcome, s.Finished.Sub(s.Started).Round(time.Second), s.Scanned, s.Marked, s.Unmarked, s.Skipped, s.Snapshotted, s.Deleted, s.Failed)
+	if s.Error != "" {
+		e.Message += ": " + s.Error
+	}
+	return e
+}
+
+// statusClient is the part of the Kubernetes API used to report runs.
+type statusClient interface {
+	Annotate(ctx context.Context, ref kube.ObjectReference, annotations map[string]string) error
+	CreateEvent(ctx context.Context, e kube.Event) error
+}
+
+//go:generate moq -fmt goimports -out mock_status_client.go . statusClient
+
+// runReporter records the status of every run as an Event and an annotation
+// on the object owning the pod, e.g. a CronJob, so that kubectl describe
+// shows what the last run did.
+type runReporter struct {
+	client    statusClient
+	owner     kube.ObjectReference
+	component string
+}
+
+// newRunReporter returns a runReporter for the pod the process runs in.
+func newRunReporter(ctx context.Context, component string) (*runReporter, error) {
+	cfg, err := kube.InClusterConfig()
+	if err != nil {
+		return nil, xerrors.Errorf("--report-status: %w", err)
+	}
+	client, err := kube.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	namespace, pod, err := kube.InClusterPod()
+	if err != nil {
+		return nil, err
+	}
+	owner, err := client.Owner(ctx, namespace, pod)
+	if err != nil {
+		return nil, xerrors.Errorf("find owner of pod: %w", err)
+	}
+	log.Info().Str("owner", owner.String()).Msg("reporting run status")
+	return &runReporter{client: client, owner: owner, component: component}, nil
+}
+
+// report records s. It is a no-op if r is nil.
+func (r *runReporter) report(ctx context.Context, s runStatus) error {
+	if r == nil {
+		return nil
+	}
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	annotateErr := r.client.Annotate(ctx, r.owner, map[string]string{lastRunAnnotation + s.Command: string(raw)})
+	e := s.event()
+	e.Object, e.Component = r.owner, r.component
+	if err := r.client.CreateEvent(ctx, e); err != nil {
+		return err
+	}
+	return annotateErr
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/kube"
+)
+
+func Test_RunStatus(t *testing.T) {
+	t.Parallel()
+
+	started := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	finished := started.Add(90 * time.Second)
+	counts := &summaryCounts{Scanned: 10, Skipped: 2, Snapshotted: 7, Deleted: 7, Failed: 1, AffectedGB: 700}
+
+	t.Run("disks failed", func(t *testing.T) {
+		t.Parallel()
+		e := newRunStatus("cleanup", started, finished, false, counts, nil).event()
+		require.Equal(t, kube.EventWarning, e.Type)
+		require.Equal(t, "DisksFailed", e.Reason)
+		require.Equal(t, "cleanup finished in 1m30s: 10 scanned, 0 marked, 0 unmarked, 2 skipped, 7 snapshotted, 7 deleted, 1 failed", e.Message)
+		require.Equal(t, finished, e.Time)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Parallel()
+		e := newRunStatus("mark", started, finished, true, &summaryCounts{Scanned: 3, Marked: 3}, nil).event()
+		require.Equal(t, kube.EventNormal, e.Type)
+		require.Equal(t, "RunSucceeded", e.Reason)
+		require.Equal(t, "mark dry run finished in 1m30s: 3 scanned, 3 marked, 0 unmarked, 0 skipped, 0 snapshotted, 0 deleted, 0 failed", e.Message)
+	})
+
+	t.Run("run failed", func(t *testing.T) {
+		t.Parallel()
+		e := newRunStatus("cleanup", started, finished, false, nil, xerrors.New("lock held by another run")).event()
+		require.Equal(t, kube.EventWarning, e.Type)
+		require.Equal(t, "RunFailed", e.Reason)
+		require.Equal(t, "cleanup failed in 1m30s: 0 scanned, 0 marked, 0 unmarked, 0 skipped, 0 snapshotted, 0 deleted, 0 failed: lock held by another run", e.Message)
+	})
+}
+
+func Test_RunReporter(t *testing.T) {
+	t.Parallel()
+
+	owner := kube.ObjectReference{APIVersion: "batch/v1", Kind: "CronJob", Namespace: "ops", Name: "cleanup"}
+	status := newRunStatus("cleanup", time.Now().Add(-time.Minute), time.Now(), false, &summaryCounts{Scanned: 1, Deleted: 1}, nil)
+
+	t.Run("annotation and event", func(t *testing.T) {
+		t.Parallel()
+		client := &statusClientMock{
+			AnnotateFunc: func(ctx context.Context, ref kube.ObjectReference, annotations map[string]string) error {
+				require.Equal(t, owner, ref)
+				var got runStatus
+				require.NoError(t, json.Unmarshal([]byte(annotations["gke-disk-cleanup/last-cleanup"]), &got))
+				require.Equal(t, 1, got.Deleted)
+				return nil
+			},
+			CreateEventFunc: func(ctx context.Context, e kube.Event) error {
+				require.Equal(t, owner, e.Object)
+				require.Equal(t, "gke-disk-cleanup", e.Component)
+				return nil
+			},
+		}
+		r := &runReporter{client: client, owner: owner, component: "gke-disk-cleanup"}
+		require.NoError(t, r.report(context.Background(), status))
+		require.Len(t, client.AnnotateCalls(), 1)
+		require.Len(t, client.CreateEventCalls(), 1)
+	})
+
+	t.Run("annotate error", func(t *testing.T) {
+		t.Parallel()
+		client := &statusClientMock{
+			AnnotateFunc: func(ctx context.Context, ref kube.ObjectReference, annotations map[string]string) error {
+				return xerrors.New("cronjobs is forbidden")
+			},
+			CreateEventFunc: func(ctx context.Context, e kube.Event) error {
+				return nil
+			},
+		}
+		r := &runReporter{client: client, owner: owner, component: "gke-disk-cleanup"}
+		require.EqualError(t, r.report(context.Background(), status), "cronjobs is forbidden")
+		// the event is still created
+		require.Len(t, client.CreateEventCalls(), 1)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		var r *runReporter
+		require.NoError(t, r.report(context.Background(), status))
+	})
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	monitoring "google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+	"gopkg.in/yaml.v3"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/history"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// defaultIODays is how many days of I/O the I/O signal of a score model
+// looks at by default.
+const defaultIODays = 14
+
+// diskIOMetrics is an interface for the Cloud Monitoring queries we use here.
+type diskIOMetrics interface {
+	// DiskIOBytes returns the bytes read from and written to the disks of
+	// projectID between since and until, by device name, which is the disk
+	// name unless chosen otherwise on attach.
+	DiskIOBytes(ctx context.Context, projectID string, since, until time.Time) (map[string]int64, error)
+}
+
+//go:generate moq -fmt goimports -out mock_disk_io_metrics.go . diskIOMetrics
+
+// monitoringDiskIO implements diskIOMetrics using the Cloud Monitoring v3
+// API.
+type monitoringDiskIO struct {
+	svc *monitoring.Service
+}
+
+func newDiskIOMetrics(ctx context.Context, opts ...option.ClientOption) (*monitoringDiskIO, error) {
+	svc, err := monitoring.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init monitoring client: %w", err)
+	}
+	return &monitoringDiskIO{svc: svc}, nil
+}
+
+func (m *monitoringDiskIO) DiskIOBytes(ctx context.Context, projectID string, since, until time.Time) (map[string]int64, error) {
+	bytes := make(map[string]int64)
+	for _, metric := range []string{"compute.googleapis.com/instance/disk/read_bytes_count", "compute.googleapis.com/instance/disk/write_bytes_count"} {
+		// one sum per device over the whole period
+		err := m.svc.Projects.TimeSeries.List("projects/"+projectID).
+			Filter(fmt.Sprintf(`metric.type = %q`, metric)).
+			IntervalStartTime(since.UTC().Format(time.RFC3339)).
+			IntervalEndTime(until.UTC().Format(time.RFC3339)).
+			AggregationAlignmentPeriod(fmt.Sprintf("%ds", int64(until.Sub(since).Seconds()))).
+			AggregationPerSeriesAligner("ALIGN_SUM").
+			AggregationCrossSeriesReducer("REDUCE_SUM").
+			AggregationGroupByFields("metric.label.device_name").
+			Pages(ctx, func(resp *monitoring.ListTimeSeriesResponse) error {
+				for _, ts := range resp.TimeSeries {
+					device := ts.Metric.Labels["device_name"]
+					for _, p := range ts.Points {
+						if p.Value != nil && p.Value.Int64Value != nil {
+							bytes[device] += *p.Value.Int64Value
+						}
+					}
+				}
+				return nil
+			})
+		if err != nil {
+			return nil, xerrors.Errorf("list %s of %s: %w", metric, projectID, err)
+		}
+	}
+	return bytes, nil
+}
+
+// loadScoreModel reads a score model from a YAML or JSON file.
+func loadScoreModel(path string) (*cleanup.ScoreModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read score model: %w", err)
+	}
+	var model cleanup.ScoreModel
+	if err := yaml.Unmarshal(data, &model); err != nil {
+		return nil, xerrors.Errorf("parse score model %s: %w", path, err)
+	}
+	if err := model.Validate(); err != nil {
+		return nil, xerrors.Errorf("score model %s: %w", path, err)
+	}
+	return &model, nil
+}
+
+// loadUnmarks counts how often every disk was unmarked according to the
+// history file at path in s. A missing history counts nothing.
+func loadUnmarks(ctx context.Context, s store.Store, path string) (*cleanup.DiskCounts, error) {
+	unmarks := cleanup.NewDiskCounts()
+	records, err := history.Read(ctx, s, path)
+	if errors.Is(err, store.ErrNotExist) {
+		return unmarks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if r.Type == events.DiskUnmarked {
+			unmarks.Add(r.ProjectID, r.DiskName, 1)
+		}
+	}
+	return unmarks, nil
+}
+
+// loadIOBytes returns the bytes read from and written to the disks of
+// projectID within period before now.
+func loadIOBytes(ctx context.Context, m diskIOMetrics, projectID string, period time.Duration) (*cleanup.DiskCounts, error) {
+	until := time.Now()
+	byDevice, err := m.DiskIOBytes(ctx, projectID, until.Add(-period), until)
+	if err != nil {
+		return nil, err
+	}
+	ioBytes := cleanup.NewDiskCounts()
+	for device, n := range byDevice {
+		ioBytes.Add(projectID, device, n)
+	}
+	log.Info().Str("projectID", projectID).Int("disks", ioBytes.Len()).Msg("loaded disk I/O")
+	return ioBytes, nil
+}
+
+// ioPeriod returns the period the I/O signal of model looks at.
+func ioPeriod(model *cleanup.ScoreModel) time.Duration {
+	days := model.IO.Days
+	if days <= 0 {
+		days = defaultIODays
+	}
+	return 24 * time.Hour * time.Duration(days)
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/history"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_loadScoreModel(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "model.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+threshold: 0.6
+idle:
+  weight: 2
+io:
+  weight: 1
+  days: 7
+`), 0o600))
+	model, err := loadScoreModel(path)
+	require.NoError(t, err)
+	require.Equal(t, 0.6, model.Threshold)
+	require.Equal(t, 2.0, model.Idle.Weight)
+	require.Equal(t, 7*24*time.Hour, ioPeriod(model))
+
+	model.IO.Days = 0
+	require.Equal(t, defaultIODays*24*time.Hour, ioPeriod(model))
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalid, []byte("threshold: 2\n"), 0o600))
+	_, err = loadScoreModel(invalid)
+	require.ErrorContains(t, err, "score threshold 2 out of range")
+
+	_, err = loadScoreModel(filepath.Join(dir, "missing.yaml"))
+	require.ErrorContains(t, err, "read score model")
+}
+
+func Test_loadUnmarks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	unmarks, err := loadUnmarks(ctx, store.Local{}, path)
+	require.NoError(t, err, "a missing history counts nothing")
+	require.Zero(t, unmarks.Len())
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	flapping := &computepb.Disk{Name: pointer.String("flapping")}
+	w := history.Open(ctx, store.Local{}, path)
+	w.Handle(events.Event{Type: events.DiskMarked, Time: now, ProjectID: "testing", Disk: flapping})
+	w.Handle(events.Event{Type: events.DiskUnmarked, Time: now, ProjectID: "testing", Disk: flapping})
+	w.Handle(events.Event{Type: events.DiskMarked, Time: now, ProjectID: "testing", Disk: flapping})
+	w.Handle(events.Event{Type: events.DiskUnmarked, Time: now, ProjectID: "testing", Disk: flapping})
+	w.Handle(events.Event{Type: events.DiskMarked, Time: now, ProjectID: "testing", Disk: &computepb.Disk{Name: pointer.String("stable")}})
+	require.NoError(t, w.Close())
+
+	unmarks, err = loadUnmarks(ctx, store.Local{}, path)
+	require.NoError(t, err)
+	require.Equal(t, 1, unmarks.Len())
+	n, ok := unmarks.Get("testing", "flapping")
+	require.True(t, ok)
+	require.Equal(t, int64(2), n)
+}
+
+func Test_loadIOBytes(t *testing.T) {
+	t.Parallel()
+
+	m := &diskIOMetricsMock{
+		DiskIOBytesFunc: func(ctx context.Context, projectID string, since, until time.Time) (map[string]int64, error) {
+			require.Equal(t, "testing", projectID)
+			require.Equal(t, 14*24*time.Hour, until.Sub(since))
+			return map[string]int64{"busy": 3 << 30}, nil
+		},
+	}
+	ioBytes, err := loadIOBytes(context.Background(), m, "testing", 14*24*time.Hour)
+	require.NoError(t, err)
+	n, ok := ioBytes.Get("testing", "busy")
+	require.True(t, ok)
+	require.Equal(t, int64(3<<30), n)
+
+	m.DiskIOBytesFunc = func(ctx context.Context, projectID string, since, until time.Time) (map[string]int64, error) {
+		return nil, xerrors.New("permission denied")
+	}
+	_, err = loadIOBytes(context.Background(), m, "testing", time.Hour)
+	require.ErrorContains(t, err, "permission denied")
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+)
+
+// shutdownTimeout is how long in-flight requests, e.g. health checks, may
+// take on shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// serveOptions configures serve.
+type serveOptions struct {
+	// Interval is how long to wait after a run before starting the next.
+	Interval time.Duration
+	// Jitter is the maximum random delay added before every run, so that
+	// several instances do not hit the API at the same time.
+	Jitter time.Duration
+	// HealthAddr is where the health endpoints are served. Empty disables
+	// them.
+	HealthAddr string
+	// Metrics is served at /metrics on MetricsAddr, which may be the same as
+	// HealthAddr. An empty MetricsAddr disables it.
+	Metrics     http.Handler
+	MetricsAddr string
+	// Control makes runs abortable if set. It is served on the Unix socket
+	// ControlSocket, unless empty.
+	Control       *controller
+	ControlSocket string
+	// Trigger starts runs on request instead of every Interval: at /run on
+	// TriggerAddr, and for the requests passed to it by Receive until its
+	// context is done, if either is set.
+	Trigger     *trigger
+	TriggerAddr string
+	Receive     func(context.Context)
+}
+
+// nextDelay returns how long to wait before the next run: wait plus a random
+// delay of up to jitter.
+func nextDelay(wait, jitter time.Duration, rnd *rand.Rand) time.Duration {
+	if jitter <= 0 {
+		return wait
+	}
+	return wait + time.Duration(rnd.Int63n(int64(jitter)))
+}
+
+// health serves the liveness and readiness endpoints of serve.
+type health struct {
+	stopping int32
+}
+
+func (h *health) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.LoadInt32(&h.stopping) != 0 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	return mux
+}
+
+// listen serves handler on addr until shutdown is called.
+func listen(addr string, handler http.Handler) (shutdown func(), err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, xerrors.Errorf("listen on %s: %w", addr, err)
+	}
+	srv := &http.Server{Handler: handler}
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Str("addr", addr).Msg("serving http failed")
+		}
+	}()
+	log.Info().Str("addr", listener.Addr().String()).Msg("serving http")
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}, nil
+}
+
+// serve calls run every opts.Interval, starting after a random delay of up
+// to opts.Jitter, until ctx is done, e.g. on SIGTERM. A failed run is logged
+// and retried at the next interval. An interrupted run is resumed on restart
+// if it records checkpoints. With opts.Trigger, runs are only started on
+// request.
+func serve(ctx context.Context, opts serveOptions, run func(context.Context) error) error {
+	triggered := opts.Trigger != nil && (opts.TriggerAddr != "" || opts.Receive != nil)
+	if opts.Interval <= 0 && !triggered {
+		return xerrors.Errorf("--interval must be positive")
+	}
+	h := &health{}
+	muxes := make(map[string]*http.ServeMux)
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if opts.HealthAddr != "" {
+		mux(opts.HealthAddr).Handle("/", h.handler())
+	}
+	if opts.MetricsAddr != "" && opts.Metrics != nil {
+		mux(opts.MetricsAddr).Handle("/metrics", opts.Metrics)
+	}
+	if triggered && opts.TriggerAddr != "" {
+		mux(opts.TriggerAddr).Handle("/run", opts.Trigger.handler(ctx))
+	}
+	for addr, handler := range muxes {
+		shutdown, err := listen(addr, handler)
+		if err != nil {
+			return err
+		}
+		defer shutdown()
+	}
+	if opts.ControlSocket != "" && opts.Control != nil {
+		shutdown, err := listenControl(opts.ControlSocket, opts.Control)
+		if err != nil {
+			return err
+		}
+		defer shutdown()
+	}
+	if opts.Control != nil {
+		run = opts.Control.wrap(run)
+	}
+	if triggered {
+		if opts.Receive != nil {
+			opts.Receive(ctx)
+		}
+		<-ctx.Done()
+		atomic.StoreInt32(&h.stopping, 1)
+		log.Info().Msg("shutting down")
+		return nil
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	delay := nextDelay(0, opts.Jitter, rnd)
+	for {
+		log.Info().Dur("delay", delay).Time("next", time.Now().Add(delay)).Msg("next run scheduled")
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			atomic.StoreInt32(&h.stopping, 1)
+			log.Info().Msg("shutting down")
+			return nil
+		case <-timer.C:
+		}
+		start := time.Now()
+		if err := run(ctx); err != nil {
+			log.Error().Err(err).Dur("duration", time.Since(start)).Msg("run failed")
+		} else {
+			log.Info().Dur("duration", time.Since(start)).Msg("run completed")
+		}
+		delay = nextDelay(opts.Interval, opts.Jitter, rnd)
+	}
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/idtoken"
+)
+
+// serveConfig holds the flags of serve, besides those of the mark and
+// cleanup phases.
+type serveConfig struct {
+	interval            time.Duration
+	jitter              time.Duration
+	healthAddr          string
+	metricsAddr         string
+	triggerAddr         string
+	triggerAudience     string
+	triggerCallers      []string
+	triggerNoAuth       bool
+	triggerSubscription string
+	controlSocket       string
+}
+
+func newServeCommand(a *app) *cobra.Command {
+	var (
+		c     serveConfig
+		mark  markConfig
+		clean cleanupConfig
+	)
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "run cleanup and mark periodically, e.g. as a Deployment",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if a.cfg.resumeFrom != "" {
+				return xerrors.Errorf("--resume-from cannot be used with serve")
+			}
+			if err := a.openIssueTracker(mark.issue, clean.gracePeriod); err != nil {
+				return err
+			}
+			if err := a.openDeletionWriters(cmd.Context(), &clean); err != nil {
+				return err
+			}
+			// each phase needs a checkpoint file of its own
+			checkpointFile := a.cfg.checkpointFile
+			markCheckpoint, cleanupCheckpoint := checkpointFile, checkpointFile
+			if checkpointFile != "" {
+				markCheckpoint, cleanupCheckpoint = checkpointFile+".mark", checkpointFile+".cleanup"
+			}
+			// and a report of its own
+			if a.runReport != nil {
+				a.runReport.perCommand = true
+			}
+			runMark := func(ctx context.Context) error {
+				return a.runMark(ctx, &mark, markCheckpoint)
+			}
+			runCleanup := func(ctx context.Context) error {
+				return a.runCleanup(ctx, &clean, mark.filter, cleanupCheckpoint)
+			}
+			var t *trigger
+			var receive func(context.Context)
+			if c.triggerAddr != "" || c.triggerSubscription != "" {
+				if c.triggerAddr != "" && c.triggerAudience == "" && !c.triggerNoAuth {
+					return xerrors.Errorf("--http requires --http-audience, or --http-no-auth if the caller is authenticated otherwise, e.g. by Cloud Run")
+				}
+				t = &trigger{
+					Flags:       cmd.Flags(),
+					Audience:    c.triggerAudience,
+					Callers:     c.triggerCallers,
+					Validate:    idtoken.Validate,
+					StartupOnly: startupFlags,
+					Configure: func() error {
+						if err := a.resolveScope(); err != nil {
+							return err
+						}
+						return a.limitCalls()
+					},
+					Run: func(ctx context.Context, command string) runStatus {
+						start := time.Now()
+						// a run failing early reports no counts of the last
+						a.summary.reset(nil)
+						err := a.control.wrap(func(ctx context.Context) error {
+							if command == "mark" {
+								return runMark(ctx)
+							}
+							return runCleanup(ctx)
+						})(ctx)
+						return newRunStatus(command, start, time.Now(), a.cfg.dryRun, a.summary.totals(), err)
+					},
+				}
+			}
+			if c.triggerSubscription != "" {
+				client, err := newPubSubClient(cmd.Context(), a.opts.ClientOptions)
+				if err != nil {
+					return err
+				}
+				receive = func(ctx context.Context) {
+					receiveRuns(ctx, client, c.triggerSubscription, t)
+				}
+			}
+			return serve(cmd.Context(), serveOptions{
+				Interval:      c.interval,
+				Jitter:        c.jitter,
+				HealthAddr:    c.healthAddr,
+				Metrics:       a.registry,
+				MetricsAddr:   c.metricsAddr,
+				Control:       a.control,
+				ControlSocket: c.controlSocket,
+				Trigger:       t,
+				TriggerAddr:   c.triggerAddr,
+				Receive:       receive,
+			}, func(ctx context.Context) error {
+				// cleanup first, so that disks are only deleted an interval
+				// after they were marked, and can be unmarked in between
+				cleanupErr := runCleanup(ctx)
+				if cleanupErr != nil && ctx.Err() != nil {
+					return cleanupErr
+				}
+				markErr := runMark(ctx)
+				if cleanupErr != nil {
+					return xerrors.Errorf("cleanup: %w", cleanupErr)
+				}
+				if markErr != nil {
+					return xerrors.Errorf("mark: %w", markErr)
+				}
+				return nil
+			})
+		},
+	}
+	mark.addFlags(serveCmd)
+	clean.addFlags(serveCmd)
+	serveCmd.PersistentFlags().DurationVar(&c.interval, "interval", 24*time.Hour, "how long to wait between two runs")
+	serveCmd.PersistentFlags().DurationVar(&c.jitter, "jitter", 5*time.Minute, "add a random delay of up to this much before every run, including the first")
+	serveCmd.PersistentFlags().StringVar(&c.healthAddr, "health-addr", ":8080", "address to serve the /healthz and /readyz endpoints on, empty to disable")
+	serveCmd.PersistentFlags().StringVar(&c.metricsAddr, "metrics-addr", ":8080", "address to serve Prometheus metrics on at /metrics, empty to disable")
+	serveCmd.PersistentFlags().StringVar(&c.triggerAddr, "http", "", "instead of running every --interval, start a run for every POST to /run on this address, e.g. :8080 on Cloud Run, with a JSON body such as {\"command\": \"cleanup\", \"flags\": {\"dry-run\": true}}")
+	serveCmd.PersistentFlags().StringVar(&c.triggerAudience, "http-audience", "", "with --http, require a Google-signed OIDC ID token for this audience, usually the URL of the service, as sent by Cloud Scheduler")
+	serveCmd.PersistentFlags().StringSliceVar(&c.triggerCallers, "http-allowed-callers", nil, "with --http-audience, only accept ID tokens of these comma-separated service account emails")
+	serveCmd.PersistentFlags().BoolVar(&c.triggerNoAuth, "http-no-auth", false, "with --http, accept requests without an ID token, if they are authenticated otherwise, e.g. by Cloud Run IAM")
+	serveCmd.PersistentFlags().StringVar(&c.triggerSubscription, "subscription", "", "instead of running every --interval, start a run for every message pulled from this Pub/Sub subscription, e.g. projects/p/subscriptions/s, with the JSON body of a POST to /run of --http")
+	serveCmd.PersistentFlags().StringVar(&c.controlSocket, "control-socket", "", "serve the control commands pause, resume, abort, status and set-qps on this Unix socket, see the control command; empty to disable")
+	return serveCmd
+}
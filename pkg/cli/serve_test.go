@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func Test_NextDelay(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(1))
+	require.Equal(t, time.Hour, nextDelay(time.Hour, 0, rnd))
+	for i := 0; i < 100; i++ {
+		delay := nextDelay(time.Hour, time.Minute, rnd)
+		require.GreaterOrEqual(t, delay, time.Hour)
+		require.Less(t, delay, time.Hour+time.Minute)
+	}
+}
+
+func Test_Health(t *testing.T) {
+	t.Parallel()
+
+	h := &health{}
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		h.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	require.Equal(t, http.StatusOK, get("/healthz"))
+	require.Equal(t, http.StatusOK, get("/readyz"))
+
+	h.stopping = 1
+	require.Equal(t, http.StatusOK, get("/healthz"))
+	require.Equal(t, http.StatusServiceUnavailable, get("/readyz"))
+}
+
+func Test_Serve(t *testing.T) {
+	t.Parallel()
+
+	t.Run("until cancelled", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var runs int
+		err := serve(ctx, serveOptions{Interval: time.Millisecond, HealthAddr: "127.0.0.1:0"}, func(context.Context) error {
+			runs++
+			if runs == 3 {
+				cancel()
+			}
+			// a failed run does not stop serving
+			return xerrors.New("boom")
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, runs)
+	})
+
+	t.Run("invalid interval", func(t *testing.T) {
+		t.Parallel()
+		err := serve(context.Background(), serveOptions{}, func(context.Context) error { return nil })
+		require.EqualError(t, err, "--interval must be positive")
+	})
+}
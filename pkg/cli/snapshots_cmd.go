@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+func newSnapshotsCommand(a *app) *cobra.Command {
+	snapshotsCmd := &cobra.Command{
+		Use:   "snapshots",
+		Short: "manage the snapshots created by cleanup",
+	}
+	snapshotsCmd.AddCommand(newPruneCommand(a))
+	return snapshotsCmd
+}
+
+func newPruneCommand(a *app) *cobra.Command {
+	var retentionDays int64
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "delete snapshots created by cleanup that are older than the retention period",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			projects, err := a.projects(cmd.Context())
+			if err != nil {
+				return err
+			}
+			snapshotsClient, closeClient, err := newProjectSnapshots(cmd.Context(), a.opts.ClientOptions, a.projectOpts)
+			if err != nil {
+				return err
+			}
+			defer closeClient()
+			retention := 24 * time.Hour * time.Duration(retentionDays)
+			pruner := cleanup.NewPruner(snapshotsClient, a.bus)
+			return forEachProject(projects, func(projectID string) (cleanup.Stats, error) {
+				stats, err := pruner.PruneSnapshots(cmd.Context(), cleanup.PruneOptions{
+					ProjectID: projectID,
+					Tenant:    a.tenant,
+					Retention: retention,
+					DryRun:    a.cfg.dryRun,
+				})
+				log.Info().Str("projectID", projectID).
+					Int("deleted", stats.Deleted).
+					Int64("reclaimedBytes", stats.ReclaimedBytes).
+					Bool("dryRun", a.cfg.dryRun).
+					Msg("snapshot prune summary")
+				return stats.Stats, err
+			})
+		},
+	}
+	pruneCmd.PersistentFlags().Int64Var(&retentionDays, "snapshot-retention-days", 90, "delete snapshots created more than this many days ago")
+	return pruneCmd
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// soakConfig holds the flags of soak, besides those of the cleanup phase.
+type soakConfig struct {
+	maxDeletionsPerHour int
+	rescanInterval      time.Duration
+	healthAddr          string
+	metricsAddr         string
+	controlSocket       string
+}
+
+func newSoakCommand(a *app) *cobra.Command {
+	var (
+		c     soakConfig
+		clean cleanupConfig
+	)
+	soakCmd := &cobra.Command{
+		Use:   "soak",
+		Short: "delete marked disks continuously at a low rate, e.g. as a Deployment",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if a.cfg.resumeFrom != "" {
+				return xerrors.Errorf("--resume-from cannot be used with soak")
+			}
+			if c.maxDeletionsPerHour <= 0 {
+				return xerrors.Errorf("--max-deletions-per-hour must be positive")
+			}
+			if err := a.openDeletionWriters(cmd.Context(), &clean); err != nil {
+				return err
+			}
+			rate := cleanup.NewRate(c.maxDeletionsPerHour, time.Hour)
+			a.registry.SetDeletionRate(c.maxDeletionsPerHour)
+			clean.pacer = a.registry.Pace(rate)
+			log.Info().Int("maxDeletionsPerHour", c.maxDeletionsPerHour).Dur("deletionInterval", rate.Interval()).Msg("soaking")
+			return serve(cmd.Context(), serveOptions{
+				Interval:      c.rescanInterval,
+				HealthAddr:    c.healthAddr,
+				Metrics:       a.registry,
+				MetricsAddr:   c.metricsAddr,
+				Control:       a.control,
+				ControlSocket: c.controlSocket,
+			}, func(ctx context.Context) error {
+				return a.runCleanup(ctx, &clean, "", a.cfg.checkpointFile)
+			})
+		},
+	}
+	clean.addFlags(soakCmd)
+	soakCmd.PersistentFlags().IntVar(&c.maxDeletionsPerHour, "max-deletions-per-hour", 10, "delete at most this many disks per hour, evenly spaced")
+	soakCmd.PersistentFlags().DurationVar(&c.rescanInterval, "rescan-interval", time.Hour, "how long to wait after all marked disks were processed before listing them again")
+	soakCmd.PersistentFlags().StringVar(&c.healthAddr, "health-addr", ":8080", "address to serve the /healthz and /readyz endpoints on, empty to disable")
+	soakCmd.PersistentFlags().StringVar(&c.metricsAddr, "metrics-addr", ":8080", "address to serve Prometheus metrics on at /metrics, empty to disable")
+	soakCmd.PersistentFlags().StringVar(&c.controlSocket, "control-socket", "", "serve the control commands pause, resume, abort, status and set-qps on this Unix socket, see the control command; empty to disable")
+	return soakCmd
+}
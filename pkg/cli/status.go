@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/pricing"
+)
+
+// markedDisk is a disk marked for deletion, as listed by status.
+type markedDisk struct {
+	ProjectID string `json:"projectID"`
+	Zone      string `json:"zone"`
+	Name      string `json:"name"`
+	// Cluster is the GKE cluster the disk was created for, if known.
+	Cluster string `json:"cluster,omitempty"`
+	Type    string `json:"type,omitempty"`
+	// Source is what the disk was created from, e.g. image.
+	Source              cleanup.Source `json:"source"`
+	SizeGB              int64          `json:"sizeGB"`
+	LastAttachTimestamp string         `json:"lastAttachTimestamp,omitempty"`
+	// Marked is the value of the mark: the date the disk was marked, or
+	// true if the mark has no date yet.
+	Marked string `json:"marked"`
+	// Deletable reports whether cleanup would delete the disk now, as its
+	// grace period is over.
+	Deletable bool `json:"deletable"`
+	// DeletableAfter is when the grace period ends, nil if there is none or
+	// the mark has no date yet.
+	DeletableAfter *time.Time `json:"deletableAfter,omitempty"`
+	// MonthlyCost is what deleting the disk saves per month, in USD.
+	MonthlyCost float64 `json:"estimatedMonthlySavingsUSD"`
+	// labels are the labels of the disk, e.g. to tell its owner.
+	labels map[string]string
+}
+
+// newMarkedDisk describes disk, which is marked for deletion, at now.
+func newMarkedDisk(projectID, zone string, disk *computepb.Disk, gracePeriod time.Duration, prices *pricing.Table, now time.Time) markedDisk {
+	d := markedDisk{
+		ProjectID:           projectID,
+		Zone:                zone,
+		Name:                disk.GetName(),
+		Cluster:             cleanup.Cluster(disk),
+		Source:              cleanup.DiskSource(disk),
+		SizeGB:              disk.GetSizeGb(),
+		LastAttachTimestamp: disk.GetLastAttachTimestamp(),
+		Marked:              disk.GetLabels()[cleanup.LabelMarkedForDeletion],
+		MonthlyCost:         prices.DiskMonthlyCost(disk.GetType(), disk.GetSizeGb()),
+		labels:              disk.GetLabels(),
+	}
+	if diskType := disk.GetType(); diskType != "" {
+		d.Type = path.Base(diskType)
+	}
+	markedAt, _ := cleanup.MarkedAt(disk)
+	switch {
+	case gracePeriod <= 0:
+		d.Deletable = true
+	case !markedAt.IsZero():
+		after := markedAt.Add(gracePeriod).UTC()
+		d.DeletableAfter = &after
+		d.Deletable = !now.Before(after)
+	}
+	return d
+}
+
+// deletable describes when the disk can be deleted, for the status table.
+func (d markedDisk) deletable() string {
+	switch {
+	case d.Deletable:
+		return "now"
+	case d.DeletableAfter != nil:
+		return d.DeletableAfter.Format(time.RFC3339)
+	default:
+		return "after next mark"
+	}
+}
+
+// listMarkedDisks returns the disks of tenant marked for deletion in
+// projects that selector selects, sorted by project, zone and name.
+func listMarkedDisks(ctx context.Context, client cleanup.DisksClient, projects, zones []string, tenant cleanup.Tenant, selector cleanup.Selector, gracePeriod time.Duration, prices *pricing.Table) ([]markedDisk, error) {
+	now := time.Now()
+	var disks []markedDisk
+	err := forEachProject(projects, func(projectID string) (cleanup.Stats, error) {
+		var stats cleanup.Stats
+		err := cleanup.ListMarked(ctx, client, projectID, zones, tenant, selector, func(disk *computepb.Disk, zone string) error {
+			stats.Scanned++
+			disks = append(disks, newMarkedDisk(projectID, zone, disk, gracePeriod, prices, now))
+			return nil
+		})
+		return stats, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(disks, func(i, j int) bool {
+		a, b := disks[i], disks[j]
+		if a.ProjectID != b.ProjectID {
+			return a.ProjectID < b.ProjectID
+		}
+		if a.Zone != b.Zone {
+			return a.Zone < b.Zone
+		}
+		return a.Name < b.Name
+	})
+	return disks, nil
+}
+
+// writeStatus writes disks to w as a table, or as JSON lines if output is
+// json.
+func writeStatus(w io.Writer, output string, disks []markedDisk) error {
+	if output == outputJSON {
+		enc := json.NewEncoder(w)
+		for _, d := range disks {
+			if err := enc.Encode(d); err != nil {
+				return xerrors.Errorf("write status: %w", err)
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROJECT\tZONE\tNAME\tTYPE\tSOURCE\tSIZE (GB)\tLAST ATTACHED\tMARKED\tDELETABLE\tMONTHLY SAVINGS (USD)")
+	var sizeGB int64
+	var cost float64
+	for _, d := range disks {
+		lastAttached := d.LastAttachTimestamp
+		if lastAttached == "" {
+			lastAttached = "never"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%.2f\n", d.ProjectID, d.Zone, d.Name, d.Type, d.Source, d.SizeGB, lastAttached, d.Marked, d.deletable(), d.MonthlyCost)
+		sizeGB += d.SizeGB
+		cost += d.MonthlyCost
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%d %s\t\t\t%d\t\t\t\t%.2f\n", len(disks), plural(len(disks), "disk", "disks"), sizeGB, cost)
+	if err := tw.Flush(); err != nil {
+		return xerrors.Errorf("write status: %w", err)
+	}
+	return nil
+}
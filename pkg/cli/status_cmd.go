@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/policy"
+)
+
+// statusConfig holds the flags of status.
+type statusConfig struct {
+	gracePeriod      time.Duration
+	disk             string
+	claim            string
+	namespace        string
+	kubeconfig       string
+	inCluster        bool
+	cutoffDays       int64
+	sourceCutoffDays []string
+	markPolicyFile   string
+}
+
+func newStatusCommand(a *app) *cobra.Command {
+	var c statusConfig
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "list the disks marked for deletion, when cleanup deletes them and what that saves, or tell whether one disk is scheduled for deletion",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			targetZones, err := a.zones()
+			if err != nil {
+				return err
+			}
+			projects, err := a.projects(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if c.disk == "" && c.claim == "" {
+				disks, err := listMarkedDisks(cmd.Context(), a.disksClient, projects, targetZones, a.tenant, a.selector, c.gracePeriod, a.loadPrices(cmd.Context()))
+				if err != nil {
+					return err
+				}
+				return writeStatus(cmd.OutOrStdout(), a.cfg.output, disks)
+			}
+			if c.disk != "" && c.claim != "" {
+				return xerrors.Errorf("--disk and --pvc are mutually exclusive")
+			}
+			name, claim := c.disk, ""
+			if c.claim != "" {
+				client, _, err := newKubeClient(cmd.Context(), c.kubeconfig, c.inCluster)
+				if err != nil {
+					return err
+				}
+				diskID, err := claimDisk(cmd.Context(), client, c.namespace, c.claim)
+				if err != nil {
+					return err
+				}
+				var diskProject, diskZone string
+				diskProject, diskZone, name = parseDiskID(diskID)
+				if diskProject != "" {
+					projects = []string{diskProject}
+				}
+				if diskZone != "" {
+					targetZones = []string{diskZone}
+				}
+				claim = c.namespace + "/" + c.claim
+			}
+			sourceCutoffs, err := parseSourceCutoffs(c.sourceCutoffDays)
+			if err != nil {
+				return err
+			}
+			var markPolicy cleanup.MarkPolicy
+			if c.markPolicyFile != "" {
+				if markPolicy, err = policy.LoadRules(c.markPolicyFile); err != nil {
+					return err
+				}
+			}
+			found, err := findDiskStatus(cmd.Context(), a.disksClient, projects, targetZones, a.tenant, name, diskCheck{
+				Use: a.opts.Use,
+				Mark: cleanup.MarkOptions{
+					Cutoff:           24 * time.Hour * time.Duration(c.cutoffDays),
+					SourceCutoffs:    sourceCutoffs,
+					Policy:           markPolicy,
+					ExemptLabel:      a.cfg.exemptLabel,
+					IncludeBootDisks: a.cfg.includeBootDisks,
+					IncludeManaged:   !a.cfg.skipManaged,
+				},
+				GracePeriod: c.gracePeriod,
+			})
+			if err != nil {
+				return err
+			}
+			for i := range found {
+				found[i].Claim = claim
+			}
+			return writeDiskStatus(cmd.OutOrStdout(), a.cfg.output, found)
+		},
+	}
+	statusCmd.PersistentFlags().DurationVar(&c.gracePeriod, "grace-period", 7*24*time.Hour, "grace period of cleanup, to tell when disks can be deleted")
+	statusCmd.PersistentFlags().StringVar(&c.disk, "disk", "", "tell whether the disk with this name is scheduled for deletion, which policy applies to it and how to keep it")
+	statusCmd.PersistentFlags().StringVar(&c.claim, "pvc", "", "like --disk, for the disk backing this PersistentVolumeClaim")
+	statusCmd.PersistentFlags().StringVarP(&c.namespace, "namespace", "n", "default", "namespace of --pvc")
+	statusCmd.PersistentFlags().StringVar(&c.kubeconfig, "kubeconfig", "", "kubeconfig of the cluster of --pvc (default $KUBECONFIG or ~/.kube/config)")
+	statusCmd.PersistentFlags().BoolVar(&c.inCluster, "in-cluster", false, "look up --pvc in the cluster this runs in")
+	statusCmd.PersistentFlags().Int64Var(&c.cutoffDays, "cutoff", 30, "--cutoff of mark, to tell when --disk is marked")
+	statusCmd.PersistentFlags().StringSliceVar(&c.sourceCutoffDays, "cutoff-by-source", nil, "--cutoff-by-source of mark, to tell when --disk is marked")
+	statusCmd.PersistentFlags().StringVar(&c.markPolicyFile, "mark-policy", "", "--mark-policy of mark, to tell whether --disk is marked")
+	return statusCmd
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+func Test_Status(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+	disk := func(name, mark string) *computepb.Disk {
+		return &computepb.Disk{
+			Name:                pointer.String(name),
+			Type:                pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/diskTypes/pd-ssd"),
+			SizeGb:              pointer.Int64(100),
+			LastAttachTimestamp: pointer.String("2022-01-01T00:00:00Z"),
+			Labels:              map[string]string{cleanup.LabelMarkedForDeletion: mark},
+		}
+	}
+
+	due := newMarkedDisk("testing", "us-east1-b", disk("due", "2022-03-01"), week, nil, now)
+	require.True(t, due.Deletable)
+	require.Equal(t, time.Date(2022, 3, 9, 0, 0, 0, 0, time.UTC), *due.DeletableAfter)
+	require.Equal(t, "pd-ssd", due.Type)
+	require.InDelta(t, 17, due.MonthlyCost, 0.001)
+
+	pending := newMarkedDisk("testing", "us-east1-b", disk("pending", "2022-03-08"), week, nil, now)
+	require.False(t, pending.Deletable)
+	require.Equal(t, time.Date(2022, 3, 16, 0, 0, 0, 0, time.UTC), *pending.DeletableAfter)
+
+	boot := disk("undated", "true")
+	boot.SourceImage = pointer.String("projects/debian-cloud/global/images/debian-11")
+	undated := newMarkedDisk("testing", "us-east1-c", boot, week, nil, now)
+	require.Equal(t, cleanup.SourceImage, undated.Source)
+	require.False(t, undated.Deletable)
+	require.Nil(t, undated.DeletableAfter)
+
+	noGrace := newMarkedDisk("testing", "us-east1-c", disk("undated", "true"), 0, nil, now)
+	require.True(t, noGrace.Deletable)
+
+	var b bytes.Buffer
+	require.NoError(t, writeStatus(&b, outputConsole, []markedDisk{due, pending, undated}))
+	require.Equal(t, `PROJECT  ZONE        NAME     TYPE    SOURCE  SIZE (GB)  LAST ATTACHED         MARKED      DELETABLE             MONTHLY SAVINGS (USD)
+testing  us-east1-b  due      pd-ssd  blank   100        2022-01-01T00:00:00Z  2022-03-01  now                   17.00
+testing  us-east1-b  pending  pd-ssd  blank   100        2022-01-01T00:00:00Z  2022-03-08  2022-03-16T00:00:00Z  17.00
+testing  us-east1-c  undated  pd-ssd  image   100        2022-01-01T00:00:00Z  true        after next mark       17.00
+TOTAL                3 disks                  300                                                                51.00
+`, b.String())
+
+	b.Reset()
+	require.NoError(t, writeStatus(&b, outputJSON, []markedDisk{pending}))
+	require.JSONEq(t, `{
+		"projectID": "testing",
+		"zone": "us-east1-b",
+		"name": "pending",
+		"type": "pd-ssd",
+		"source": "blank",
+		"sizeGB": 100,
+		"lastAttachTimestamp": "2022-01-01T00:00:00Z",
+		"marked": "2022-03-08",
+		"deletable": false,
+		"deletableAfter": "2022-03-16T00:00:00Z",
+		"estimatedMonthlySavingsUSD": 17
+	}`, b.String())
+}
@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/pricing"
+)
+
+// pricingMaxAge is how long fetched prices are cached.
+const pricingMaxAge = 24 * time.Hour
+
+// pricingCacheFile returns path, or if empty the default cache file of the
+// prices of region: a key in the store if inStore, or else a file in the user
+// cache directory. It returns "" if there is no cache directory, which
+// disables caching.
+func pricingCacheFile(path, region string, inStore bool) string {
+	if path != "" {
+		return path
+	}
+	if inStore {
+		return "pricing-" + region + ".json"
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gke-disk-cleanup", "pricing-"+region+".json")
+}
+
+// unknownCluster stands for disks whose cluster is unknown in cluster
+// summaries. It cannot clash with a cluster name.
+const unknownCluster = "(unknown)"
+
+// summaryCounts tallies the outcome for a set of disks.
+type summaryCounts struct {
+	Scanned     int
+	Marked      int
+	Unmarked    int
+	Skipped     int
+	Snapshotted int
+	Deleted     int
+	Failed      int
+	// AffectedGB and MonthlyCost cover the disks that were marked or deleted.
+	AffectedGB  int64
+	MonthlyCost float64
+	// SnapshotMonthlyCost is an upper bound for the snapshots taken.
+	SnapshotMonthlyCost float64
+}
+
+func (c *summaryCounts) add(e events.Event, prices *pricing.Table) {
+	if e.Type == events.SnapshotCreated {
+		c.Snapshotted++
+		c.SnapshotMonthlyCost += prices.SnapshotMonthlyCost(e.Disk.GetSizeGb())
+		return
+	}
+	c.Scanned++
+	switch {
+	case cleanup.IsFailure(e.Err):
+		c.Failed++
+	// in dry run mode, count what would have been done
+	case e.Err != nil && !errors.Is(e.Err, diskerr.ErrDryRun), e.Action == string(cleanup.ActionSkip):
+		c.Skipped++
+	case e.Action == string(cleanup.ActionUnmark):
+		c.Unmarked++
+	case e.Action == string(cleanup.ActionMark):
+		c.Marked++
+		c.addAffected(e.Disk, prices)
+	case e.Action == string(cleanup.ActionDelete):
+		c.Deleted++
+		c.addAffected(e.Disk, prices)
+	}
+}
+
+func (c *summaryCounts) addAffected(disk *computepb.Disk, prices *pricing.Table) {
+	c.AffectedGB += disk.GetSizeGb()
+	c.MonthlyCost += prices.DiskMonthlyCost(disk.GetType(), disk.GetSizeGb())
+}
+
+func (c *summaryCounts) fields(evt *zerolog.Event) *zerolog.Event {
+	return evt.Int("scanned", c.Scanned).
+		Int("marked", c.Marked).
+		Int("unmarked", c.Unmarked).
+		Int("skipped", c.Skipped).
+		Int("snapshotted", c.Snapshotted).
+		Int("deleted", c.Deleted).
+		Int("failed", c.Failed).
+		Int64("affectedGB", c.AffectedGB).
+		Float64("estimatedMonthlyCostUSD", c.MonthlyCost).
+		Float64("estimatedSnapshotMonthlyCostUSD", c.SnapshotMonthlyCost)
+}
+
+// maxMarkedDisks is how many of the disks marked in a run are listed in
+// notifications.
+const maxMarkedDisks = 50
+
+// newlyMarkedDisk is a disk marked in a run, as listed in notifications.
+type newlyMarkedDisk struct {
+	ProjectID string `json:"projectID"`
+	Zone      string `json:"zone"`
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster,omitempty"`
+	SizeGB    int64  `json:"sizeGB"`
+}
+
+// errorKey groups the disks of a run that were not changed for the same
+// reason.
+type errorKey struct {
+	// failed tells failures from disks skipped by decision, see
+	// cleanup.IsFailure.
+	failed bool
+	class  diskerr.Class
+}
+
+// errorCount is the number of disks of an errorKey.
+type errorCount struct {
+	errorKey
+	disks int
+}
+
+// runSummary tallies the outcome of a whole run, across all projects, in
+// total and per GKE cluster.
+type runSummary struct {
+	// prices may be nil for the built-in prices.
+	prices *pricing.Table
+
+	mu sync.Mutex
+	summaryCounts
+	// Clusters holds the counts per cluster, see cleanup.Cluster.
+	Clusters map[string]*summaryCounts
+	// marked holds the first maxMarkedDisks disks marked.
+	marked []newlyMarkedDisk
+	// firstFailure is the error of the first disk that failed.
+	firstFailure error
+	// errors counts the disks that were not changed by the class of their
+	// error, so that a cause shared by many disks is reported once.
+	errors map[errorKey]int
+}
+
+func (s *runSummary) handle(e events.Event) {
+	if e.Type != events.DiskProcessed && e.Type != events.SnapshotCreated {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	marked := s.Marked
+	s.summaryCounts.add(e, s.prices)
+	if s.firstFailure == nil && cleanup.IsFailure(e.Err) {
+		s.firstFailure = e.Err
+	}
+	if e.Type == events.DiskProcessed && e.Err != nil && !errors.Is(e.Err, diskerr.ErrDryRun) {
+		if s.errors == nil {
+			s.errors = make(map[errorKey]int)
+		}
+		s.errors[errorKey{failed: cleanup.IsFailure(e.Err), class: diskerr.Classify(e.Err)}]++
+	}
+	cluster := cleanup.Cluster(e.Disk)
+	if s.Marked > marked && len(s.marked) < maxMarkedDisks {
+		s.marked = append(s.marked, newlyMarkedDisk{ProjectID: e.ProjectID, Zone: e.Zone, Name: e.Disk.GetName(), Cluster: cluster, SizeGB: e.Disk.GetSizeGb()})
+	}
+	if cluster == "" {
+		cluster = unknownCluster
+	}
+	if s.Clusters == nil {
+		s.Clusters = make(map[string]*summaryCounts)
+	}
+	counts, ok := s.Clusters[cluster]
+	if !ok {
+		counts = &summaryCounts{}
+		s.Clusters[cluster] = counts
+	}
+	counts.add(e, s.prices)
+}
+
+// totals returns a copy of the counts across all clusters.
+func (s *runSummary) totals() *summaryCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := s.summaryCounts
+	return &counts
+}
+
+// markedDisks returns the first maxMarkedDisks disks marked.
+func (s *runSummary) markedDisks() []newlyMarkedDisk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]newlyMarkedDisk(nil), s.marked...)
+}
+
+// reset clears the counts to start a new run, using prices for the estimates.
+func (s *runSummary) reset(prices *pricing.Table) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices = prices
+	s.summaryCounts = summaryCounts{}
+	s.Clusters = nil
+	s.marked = nil
+	s.firstFailure = nil
+	s.errors = nil
+}
+
+// errorCounts returns the disks not changed per reason, most frequent first.
+// s.mu must be held.
+func (s *runSummary) errorCounts() []errorCount {
+	counts := make([]errorCount, 0, len(s.errors))
+	for key, disks := range s.errors {
+		counts = append(counts, errorCount{errorKey: key, disks: disks})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].disks != counts[j].disks {
+			return counts[i].disks > counts[j].disks
+		}
+		return counts[i].class.String() < counts[j].class.String()
+	})
+	return counts
+}
+
+// log writes a summary line per cluster, for chargeback, followed by the run
+// summary and a line per reason disks were skipped or failed for, e.g. "37
+// disks skipped: resourceInUseByAnotherResource", rather than only a line per
+// disk. fallback is the one of the run, if any.
+func (s *runSummary) log(dryRun bool, fallback *cleanup.Fallback) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clusters := make([]string, 0, len(s.Clusters))
+	for cluster := range s.Clusters {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		s.Clusters[cluster].fields(log.Info()).
+			Str("cluster", cluster).
+			Bool("dryRun", dryRun).
+			Msg("cluster summary")
+	}
+	s.fields(log.Info()).
+		Int("clusters", len(clusters)).
+		Str("pricingRegion", s.pricingRegion()).
+		Bool("dryRun", dryRun).
+		Bool("downgradedToDryRun", fallback.DryRun()).
+		Msg("run summary")
+	for _, c := range s.errorCounts() {
+		evt, outcome := log.Info(), "skipped"
+		if c.failed {
+			evt, outcome = log.Warn(), "failed"
+		}
+		evt.Int("disks", c.disks).
+			Str("category", string(c.class.Category)).
+			Str("reason", c.class.Reason).
+			Bool("dryRun", dryRun).
+			Msgf("%d disks %s: %s", c.disks, outcome, c.class.Reason)
+	}
+}
+
+func (s *runSummary) pricingRegion() string {
+	if s.prices == nil {
+		return pricing.Default.Region
+	}
+	return s.prices.Region
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/pricing"
+)
+
+func Test_RunSummary(t *testing.T) {
+	t.Parallel()
+
+	ssd := &computepb.Disk{Name: pointer.String("ssd"), SizeGb: pointer.Int64(100), Type: pointer.String("projects/p/zones/z/diskTypes/pd-ssd")}
+	standard := &computepb.Disk{Name: pointer.String("standard"), SizeGb: pointer.Int64(50)}
+
+	s := &runSummary{}
+	s.handle(events.Event{Type: events.DiskScanned, Disk: ssd})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: ssd, Action: "DELETE"})
+	s.handle(events.Event{Type: events.SnapshotCreated, Disk: ssd})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: standard, Action: "MARK", DryRun: true, Err: diskerr.ErrDryRun})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: standard, Action: "UNMARK"})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: standard, Action: "SKIP", Err: diskerr.ErrWithinCutoff})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: standard, Action: "MARK", Err: diskerr.ErrInUse})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: standard, Action: "DELETE", Err: diskerr.New(diskerr.CodeAPI, "boom")})
+
+	require.Equal(t, 6, s.Scanned)
+	require.Equal(t, 1, s.Deleted)
+	require.Equal(t, 1, s.Snapshotted)
+	require.Equal(t, 1, s.Marked)
+	require.Equal(t, 1, s.Unmarked)
+	require.Equal(t, 2, s.Skipped)
+	require.Equal(t, 1, s.Failed)
+	require.Equal(t, int64(150), s.AffectedGB)
+	require.InDelta(t, 100*0.17+50*0.04, s.MonthlyCost, 1e-9)
+	require.InDelta(t, 100*0.026, s.SnapshotMonthlyCost, 1e-9)
+	require.Equal(t, "us-central1", s.pricingRegion())
+	require.Equal(t, []newlyMarkedDisk{{Name: "standard", SizeGB: 50}}, s.markedDisks())
+	// the dry run is not counted
+	require.Equal(t, []errorCount{
+		{errorKey: errorKey{failed: true, class: diskerr.Class{Category: diskerr.CategoryAPI, Reason: "API"}}, disks: 1},
+		{errorKey: errorKey{class: diskerr.Class{Category: diskerr.CategoryCheck, Reason: "WITHIN_CUTOFF"}}, disks: 1},
+		{errorKey: errorKey{class: diskerr.Class{Category: diskerr.CategoryInUse, Reason: "IN_USE"}}, disks: 1},
+	}, s.errorCounts())
+
+	// neither disk names its cluster
+	require.Len(t, s.Clusters, 1)
+	require.Equal(t, s.summaryCounts, *s.Clusters[unknownCluster])
+
+	// fetched prices
+	s = &runSummary{prices: &pricing.Table{Region: "europe-west3", DiskPerGBMonth: map[string]float64{"pd-standard": 0.05, "pd-ssd": 0.2}, SnapshotPerGBMonth: 0.03}}
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: ssd, Action: "DELETE"})
+	s.handle(events.Event{Type: events.SnapshotCreated, Disk: ssd})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: standard, Action: "MARK"})
+	require.InDelta(t, 100*0.2+50*0.05, s.MonthlyCost, 1e-9)
+	require.InDelta(t, 100*0.03, s.SnapshotMonthlyCost, 1e-9)
+	require.Equal(t, "europe-west3", s.pricingRegion())
+
+	// serve starts one run after another
+	s.reset(nil)
+	require.Equal(t, summaryCounts{}, s.summaryCounts)
+	require.Empty(t, s.errorCounts())
+	require.Empty(t, s.Clusters)
+	require.Equal(t, "us-central1", s.pricingRegion())
+}
+
+func Test_PricingCacheFile(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "prices.json", pricingCacheFile("prices.json", "us-east1", false))
+	require.Equal(t, "pricing-us-east1.json", pricingCacheFile("", "us-east1", true))
+	if _, err := os.UserCacheDir(); err != nil {
+		require.Empty(t, pricingCacheFile("", "us-east1", false))
+		return
+	}
+	require.Equal(t, "pricing-us-east1.json", filepath.Base(pricingCacheFile("", "us-east1", false)))
+}
+
+func Test_RunSummaryClusters(t *testing.T) {
+	t.Parallel()
+
+	prod := &computepb.Disk{
+		Name:   pointer.String("pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c"),
+		SizeGb: pointer.Int64(100),
+		Labels: map[string]string{cleanup.LabelClusterName: "prod"},
+	}
+	staging := &computepb.Disk{Name: pointer.String("gke-staging-6d8b1ed2-dynamic-pvc-0b5f7a4e-5d7c-4a43-9c5e-3b1a8f1e2d3c"), SizeGb: pointer.Int64(10)}
+	unknown := &computepb.Disk{Name: pointer.String("data"), SizeGb: pointer.Int64(1)}
+
+	s := &runSummary{}
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: prod, Action: "MARK"})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: prod, Action: "MARK", Err: diskerr.New(diskerr.CodeAPI, "boom")})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: staging, Action: "MARK"})
+	s.handle(events.Event{Type: events.DiskProcessed, Disk: unknown, Action: "SKIP", Err: diskerr.ErrWithinCutoff})
+
+	require.Equal(t, 4, s.Scanned)
+	require.Len(t, s.Clusters, 3)
+	require.Equal(t, summaryCounts{Scanned: 2, Marked: 1, Failed: 1, AffectedGB: 100, MonthlyCost: 4}, *s.Clusters["prod"])
+	require.Equal(t, 1, s.Clusters["staging"].Marked)
+	require.Equal(t, int64(10), s.Clusters["staging"].AffectedGB)
+	require.Equal(t, 1, s.Clusters[unknownCluster].Skipped)
+}
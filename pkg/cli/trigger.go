@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/idtoken"
+)
+
+// maxTriggerBody is the largest request body accepted by the trigger.
+const maxTriggerBody = 1 << 20
+
+// triggerRequest is the JSON body of a POST to /run.
+type triggerRequest struct {
+	// Command is the run to start: mark or cleanup.
+	Command string `json:"command"`
+	// Flags overrides flags for this run only, e.g. {"dry-run": true} or
+	// {"zones": ["us-east1-b", "us-east1-c"]}, as in a --config file.
+	Flags map[string]interface{} `json:"flags,omitempty"`
+}
+
+// startupFlags are the flags of serve that only take effect when it starts,
+// e.g. the sinks subscribed to the runs and serve's own, so requests
+// overriding them are refused instead of silently ignored.
+var startupFlags = []string{
+	"config", "verbose", "output", "log-format", "progress", "progress-interval", "progress-every",
+	"credentials-file", "impersonate-service-account", "operator", "store", "record-config", "pause-key",
+	"checkpoint-file", "resume-from", "mode", "archive-index", "history-file",
+	"audit-gcs-bucket", "audit-bigquery-table", "inventory-bigquery-table", "results-topic",
+	"report-out", "report-status", "notify-webhook", "notify-format", "owner-label",
+	"deletion-certificates", "certificate-hmac-key-file", "certificate-kms-key",
+	"issue-tracker", "issue-repo", "issue-token-file", "issue-api-url", "issue-number", "issue-labels",
+	"interval", "jitter", "health-addr", "metrics-addr", "control-socket",
+	"http", "http-audience", "http-allowed-callers", "http-no-auth", "subscription",
+}
+
+// tokenValidator validates an OIDC ID token issued by Google for audience.
+// idtoken.Validate implements it.
+type tokenValidator func(ctx context.Context, token, audience string) (*idtoken.Payload, error)
+
+// trigger starts a mark or cleanup run for every authorized POST to /run, so
+// that serve can run on Cloud Run and be triggered by Cloud Scheduler, or
+// for every request received from Pub/Sub. Runs do not overlap: a request
+// while a run is in progress is refused.
+type trigger struct {
+	// Flags are the flags of the command, overridden by requests.
+	Flags *pflag.FlagSet
+	// Audience is the audience callers must have requested their ID token
+	// for, usually the URL of the service. Empty disables authentication.
+	Audience string
+	// Callers are the emails of the service accounts allowed to trigger
+	// runs. Any caller with a valid ID token and a verified email may if
+	// empty.
+	Callers  []string
+	Validate tokenValidator
+	// StartupOnly are the flags requests may not override, see
+	// startupFlags.
+	StartupOnly []string
+	// Configure derives the configuration of a run from the flags, e.g. the
+	// selector of the disks, once a request overrode them and again once
+	// they are restored. A request it fails for is refused.
+	Configure func() error
+	// Run runs command and returns its status.
+	Run func(ctx context.Context, command string) runStatus
+
+	running int32
+}
+
+// handler returns the handler of /run. Runs are started with ctx rather
+// than the context of the request, so that a caller giving up does not
+// interrupt a run halfway.
+func (t *trigger) handler(ctx context.Context) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		caller, code, err := t.authenticate(r)
+		if err != nil {
+			log.Warn().Err(err).Str("remoteAddr", r.RemoteAddr).Msg("refused run trigger")
+			http.Error(w, err.Error(), code)
+			return
+		}
+		var req triggerRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTriggerBody))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		status, code, err := t.start(ctx, req, caller)
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+		code = http.StatusOK
+		if status.Error != "" {
+			// a failed run is an error, so that Cloud Scheduler retries it
+			code = http.StatusInternalServerError
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Warn().Err(err).Msg("unable to write run status")
+		}
+	})
+}
+
+// start runs the command of req with its flags, unless another run is in
+// progress, and returns its status. A request that is not run is refused
+// with an error and the HTTP status code for it.
+func (t *trigger) start(ctx context.Context, req triggerRequest, caller string) (status runStatus, code int, err error) {
+	if req.Command != "mark" && req.Command != "cleanup" {
+		return runStatus{}, http.StatusBadRequest, xerrors.New("invalid request: command must be mark or cleanup")
+	}
+	values, err := flagValues(req.Flags)
+	if err != nil {
+		return runStatus{}, http.StatusBadRequest, xerrors.Errorf("invalid request: %w", err)
+	}
+	for _, name := range t.StartupOnly {
+		if _, ok := values[name]; ok {
+			return runStatus{}, http.StatusBadRequest, xerrors.Errorf("invalid request: flag %s only takes effect when serve starts", name)
+		}
+	}
+	if !atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+		return runStatus{}, http.StatusConflict, xerrors.New("a run is already in progress")
+	}
+	defer atomic.StoreInt32(&t.running, 0)
+	restore, err := setFlags(t.Flags, values)
+	if err != nil {
+		return runStatus{}, http.StatusBadRequest, xerrors.Errorf("invalid request: %w", err)
+	}
+	defer func() {
+		restore()
+		if t.Configure == nil {
+			return
+		}
+		if err := t.Configure(); err != nil {
+			log.Error().Err(err).Msg("unable to restore the configuration of serve")
+		}
+	}()
+	if t.Configure != nil {
+		if err := t.Configure(); err != nil {
+			return runStatus{}, http.StatusBadRequest, xerrors.Errorf("invalid request: %w", err)
+		}
+	}
+
+	log.Info().Str("command", req.Command).Str("caller", caller).Interface("flags", req.Flags).Msg("run triggered")
+	return t.Run(ctx, req.Command), 0, nil
+}
+
+// authenticate verifies the bearer ID token of r and returns the email of
+// the caller, or the HTTP status code to refuse the request with.
+func (t *trigger) authenticate(r *http.Request) (caller string, code int, err error) {
+	if t.Audience == "" {
+		return "", 0, nil
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		return "", http.StatusUnauthorized, xerrors.New("missing bearer token")
+	}
+	payload, err := t.Validate(r.Context(), token, t.Audience)
+	if err != nil {
+		return "", http.StatusUnauthorized, xerrors.Errorf("invalid ID token: %w", err)
+	}
+	caller, _ = payload.Claims["email"].(string)
+	if verified, _ := payload.Claims["email_verified"].(bool); !verified || caller == "" {
+		return "", http.StatusForbidden, xerrors.Errorf("caller %q has no verified email", caller)
+	}
+	if len(t.Callers) == 0 {
+		return caller, 0, nil
+	}
+	for _, allowed := range t.Callers {
+		if caller == allowed {
+			return caller, 0, nil
+		}
+	}
+	return "", http.StatusForbidden, xerrors.Errorf("caller %q is not allowed to trigger runs", caller)
+}
+
+// flagValues returns the flags of a request in the form flags accept.
+func flagValues(flags map[string]interface{}) (map[string]string, error) {
+	values := make(map[string]string, len(flags))
+	for name, v := range flags {
+		value, err := configValue(v)
+		if err != nil {
+			return nil, xerrors.Errorf("flag %s: %w", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// setFlags sets the flags in fs to values and returns a func that restores
+// their previous values. Lists replace the previous value instead of adding
+// to it.
+func setFlags(fs *pflag.FlagSet, values map[string]string) (restore func(), err error) {
+	var restores []func()
+	restore = func() {
+		for i := len(restores) - 1; i >= 0; i-- {
+			restores[i]()
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := fs.Lookup(name)
+		if flag == nil {
+			restore()
+			return nil, xerrors.Errorf("unknown flag %q", name)
+		}
+		changed := flag.Changed
+		if list, ok := flag.Value.(pflag.SliceValue); ok {
+			old := list.GetSlice()
+			restores = append(restores, func() {
+				_ = list.Replace(old)
+				flag.Changed = changed
+			})
+			var items []string
+			if values[name] != "" {
+				items = strings.Split(values[name], ",")
+			}
+			err = list.Replace(items)
+			flag.Changed = true
+		} else {
+			old := flag.Value.String()
+			restores = append(restores, func() {
+				_ = flag.Value.Set(old)
+				flag.Changed = changed
+			})
+			err = fs.Set(name, values[name])
+		}
+		if err != nil {
+			restore()
+			return nil, xerrors.Errorf("flag %s: %w", name, err)
+		}
+	}
+	return restore, nil
+}
@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/idtoken"
+)
+
+func Test_Trigger(t *testing.T) {
+	t.Parallel()
+
+	validate := func(_ context.Context, token, audience string) (*idtoken.Payload, error) {
+		if audience != "https://cleanup.example.run.app" {
+			return nil, xerrors.Errorf("audience %s", audience)
+		}
+		switch token {
+		case "scheduler":
+			return &idtoken.Payload{Claims: map[string]interface{}{"email": "scheduler@testing.iam.gserviceaccount.com", "email_verified": true}}, nil
+		case "other":
+			return &idtoken.Payload{Claims: map[string]interface{}{"email": "other@testing.iam.gserviceaccount.com", "email_verified": true}}, nil
+		case "unverified":
+			return &idtoken.Payload{Claims: map[string]interface{}{"email": "scheduler@testing.iam.gserviceaccount.com"}}, nil
+		}
+		return nil, xerrors.New("idtoken: invalid token")
+	}
+
+	for _, tt := range []struct {
+		name    string
+		method  string
+		token   string
+		body    string
+		running bool
+		// anyCaller leaves the allowed callers empty.
+		anyCaller bool
+		runErr    string
+		expect    int
+		response  string
+		runs      []string
+	}{
+		{name: "cleanup", token: "scheduler", body: `{"command": "cleanup"}`, expect: http.StatusOK, runs: []string{"cleanup false [] .*"}},
+		{name: "flags", token: "scheduler", body: `{"command": "mark", "flags": {"dry-run": true, "zones": ["a", "b"]}}`, expect: http.StatusOK, runs: []string{"mark true [a b] .*"}},
+		{name: "configured", token: "scheduler", body: `{"command": "mark", "flags": {"name-regex": "^pvc-"}}`, expect: http.StatusOK, runs: []string{"mark false [] ^pvc-"}},
+		{name: "invalid configuration", token: "scheduler", body: `{"command": "mark", "flags": {"name-regex": "("}}`, expect: http.StatusBadRequest, response: "invalid request: error parsing regexp"},
+		{name: "startup flag", token: "scheduler", body: `{"command": "mark", "flags": {"store": "gs://other"}}`, expect: http.StatusBadRequest, response: "invalid request: flag store only takes effect when serve starts"},
+		{name: "failed run", token: "scheduler", body: `{"command": "mark"}`, runErr: "boom", expect: http.StatusInternalServerError, response: `"error":"boom"`, runs: []string{"mark false [] .*"}},
+		{name: "get", method: http.MethodGet, token: "scheduler", expect: http.StatusMethodNotAllowed},
+		{name: "no token", body: `{"command": "cleanup"}`, expect: http.StatusUnauthorized, response: "missing bearer token"},
+		{name: "invalid token", token: "forged", body: `{"command": "cleanup"}`, expect: http.StatusUnauthorized, response: "invalid ID token"},
+		{name: "caller not allowed", token: "other", body: `{"command": "cleanup"}`, expect: http.StatusForbidden, response: "not allowed"},
+		{name: "unverified email", token: "unverified", body: `{"command": "cleanup"}`, expect: http.StatusForbidden, response: "no verified email"},
+		{name: "any caller", token: "other", anyCaller: true, body: `{"command": "cleanup"}`, expect: http.StatusOK, runs: []string{"cleanup false [] .*"}},
+		{name: "any caller with unverified email", token: "unverified", anyCaller: true, body: `{"command": "cleanup"}`, expect: http.StatusForbidden, response: "no verified email"},
+		{name: "unknown command", token: "scheduler", body: `{"command": "status"}`, expect: http.StatusBadRequest, response: "command must be mark or cleanup"},
+		{name: "unknown field", token: "scheduler", body: `{"command": "cleanup", "dryRun": true}`, expect: http.StatusBadRequest, response: "unknown field"},
+		{name: "unknown flag", token: "scheduler", body: `{"command": "cleanup", "flags": {"dry-runn": true}}`, expect: http.StatusBadRequest, response: `unknown flag "dry-runn"`},
+		{name: "invalid flag", token: "scheduler", body: `{"command": "cleanup", "flags": {"dry-run": "maybe"}}`, expect: http.StatusBadRequest, response: "flag dry-run"},
+		{name: "running", token: "scheduler", body: `{"command": "cleanup"}`, running: true, expect: http.StatusConflict},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fs := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+			dryRun := fs.Bool("dry-run", false, "")
+			zones := fs.StringSlice("zones", nil, "")
+			nameRegex := fs.String("name-regex", ".*", "")
+			var selector *regexp.Regexp
+			configure := func() error {
+				var err error
+				selector, err = regexp.Compile(*nameRegex)
+				return err
+			}
+			require.NoError(t, configure())
+			var runs []string
+			tr := &trigger{
+				Flags:       fs,
+				Audience:    "https://cleanup.example.run.app",
+				Callers:     []string{"scheduler@testing.iam.gserviceaccount.com"},
+				Validate:    validate,
+				StartupOnly: []string{"store"},
+				Configure:   configure,
+				Run: func(_ context.Context, command string) runStatus {
+					runs = append(runs, fmt.Sprintf("%s %t %v %s", command, *dryRun, *zones, selector))
+					var err error
+					if tt.runErr != "" {
+						err = xerrors.New(tt.runErr)
+					}
+					return newRunStatus(command, time.Now(), time.Now(), *dryRun, nil, err)
+				},
+			}
+			if tt.running {
+				tr.running = 1
+			}
+			if tt.anyCaller {
+				tr.Callers = nil
+			}
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/run", strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			tr.handler(context.Background()).ServeHTTP(rec, req)
+
+			require.Equal(t, tt.expect, rec.Code, rec.Body.String())
+			require.Contains(t, rec.Body.String(), tt.response)
+			require.Equal(t, tt.runs, runs)
+			// overrides only apply to the triggered run
+			require.False(t, *dryRun)
+			require.Empty(t, *zones)
+			require.False(t, fs.Lookup("dry-run").Changed)
+			require.Equal(t, ".*", selector.String(), "configured again once restored")
+		})
+	}
+}
+
+func Test_TriggerNoAuth(t *testing.T) {
+	t.Parallel()
+
+	var ran bool
+	tr := &trigger{
+		Flags: pflag.NewFlagSet("serve", pflag.ContinueOnError),
+		Run: func(_ context.Context, command string) runStatus {
+			ran = true
+			return newRunStatus(command, time.Now(), time.Now(), false, nil, nil)
+		},
+	}
+	rec := httptest.NewRecorder()
+	tr.handler(context.Background()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"command": "mark"}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.True(t, ran)
+}
+
+func Test_SetFlags(t *testing.T) {
+	t.Parallel()
+
+	fs := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	gracePeriod := fs.Duration("grace-period", time.Hour, "")
+	zones := fs.StringSlice("zones", nil, "")
+	require.NoError(t, fs.Parse([]string{"--zones=a,b"}))
+
+	restore, err := setFlags(fs, map[string]string{"grace-period": "2h", "zones": "c"})
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Hour, *gracePeriod)
+	require.Equal(t, []string{"c"}, *zones, "lists are replaced, not extended")
+	restore()
+	require.Equal(t, time.Hour, *gracePeriod)
+	require.Equal(t, []string{"a", "b"}, *zones)
+	require.False(t, fs.Lookup("grace-period").Changed)
+	require.True(t, fs.Lookup("zones").Changed)
+
+	_, err = setFlags(fs, map[string]string{"grace-period": "3h", "zones": "d", "zonez": "e"})
+	require.EqualError(t, err, `unknown flag "zonez"`)
+	require.Equal(t, time.Hour, *gracePeriod, "restored on error")
+	require.Equal(t, []string{"a", "b"}, *zones)
+}
+
+func Test_StartupFlags(t *testing.T) {
+	t.Parallel()
+
+	serve, _, err := NewRootCommand(Options{}).Find([]string{"serve"})
+	require.NoError(t, err)
+	for _, name := range startupFlags {
+		require.NotNil(t, serve.Flag(name), name)
+	}
+	for _, name := range []string{"name-regex", "tenant", "include-file", "min-size-gb", "page-size", "qps", "dry-run", "zones"} {
+		require.NotContains(t, startupFlags, name, "configured for every run")
+	}
+}
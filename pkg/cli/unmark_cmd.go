@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// unmarkConfig holds the flags of unmark.
+type unmarkConfig struct {
+	filter string
+	remove bool
+}
+
+func newUnmarkCommand(a *app) *cobra.Command {
+	var c unmarkConfig
+	unmarkCmd := &cobra.Command{
+		Use:   "unmark [disk-name...]",
+		Short: "cancel the pending deletion of marked disks, given by name or --filter",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && c.filter == "" {
+				return xerrors.Errorf("give the names of the disks to unmark or --filter")
+			}
+			targetZones, err := a.zones()
+			if err != nil {
+				return err
+			}
+			projects, err := a.projects(cmd.Context())
+			if err != nil {
+				return err
+			}
+			var names []string
+			if len(args) > 0 {
+				names = args
+			}
+			summary := a.startSummary(cmd.Context(), "unmark")
+			marker := cleanup.NewMarker(a.disksClient, a.bus)
+			err = forEachProject(projects, func(projectID string) (cleanup.Stats, error) {
+				return marker.UnmarkDisks(cmd.Context(), cleanup.UnmarkOptions{
+					ProjectID:   projectID,
+					Zones:       targetZones,
+					Filter:      c.filter,
+					Tenant:      a.tenant,
+					Selector:    a.selector,
+					AllFields:   a.cfg.allDiskFields,
+					PageSize:    a.cfg.pageSize,
+					Names:       names,
+					Remove:      c.remove,
+					Concurrency: a.cfg.concurrency,
+					MaxRetries:  a.cfg.maxRetries,
+					DryRun:      a.cfg.dryRun,
+				})
+			})
+			summary.log(a.cfg.dryRun, nil)
+			return err
+		},
+	}
+	unmarkCmd.PersistentFlags().StringVar(&c.filter, "filter", "", "unmark the marked disks matching this list disk request filter, e.g. labels.team=payments")
+	unmarkCmd.PersistentFlags().BoolVar(&c.remove, "remove", false, "remove the marked-for-deletion label, so that mark may mark the disk again, instead of setting it to false, which keeps mark from marking it again")
+	return unmarkCmd
+}
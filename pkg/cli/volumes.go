@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/kube"
+)
+
+// loadVolumes lists the PersistentVolumes of the cluster given by kubeconfig
+// or, if inCluster is set, the cluster we are running in. It returns nil if
+// neither is set.
+func loadVolumes(ctx context.Context, kubeconfig string, inCluster bool) (*cleanup.VolumeIndex, error) {
+	if kubeconfig == "" && !inCluster {
+		return nil, nil
+	}
+	client, cfg, err := newKubeClient(ctx, kubeconfig, inCluster)
+	if err != nil {
+		return nil, err
+	}
+	pvs, err := client.ListPersistentVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	volumes := volumeIndex(pvs)
+	log.Info().Str("server", cfg.Server).Int("persistentVolumes", len(pvs)).Int("disks", volumes.Len()).Msg("loaded persistent volumes")
+	return volumes, nil
+}
+
+// newKubeClient returns a client for the cluster given by kubeconfig or, if
+// inCluster is set, the cluster we are running in. An empty kubeconfig means
+// the default one.
+func newKubeClient(ctx context.Context, kubeconfig string, inCluster bool) (*kube.Client, *kube.Config, error) {
+	var cfg *kube.Config
+	var err error
+	switch {
+	case kubeconfig != "" && inCluster:
+		return nil, nil, xerrors.Errorf("--kubeconfig and --in-cluster are mutually exclusive")
+	case inCluster:
+		cfg, err = kube.InClusterConfig()
+	default:
+		cfg, err = kube.LoadKubeconfig(ctx, kubeconfig)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := kube.NewClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, cfg, nil
+}
+
+// volumeIndex returns the GCE disks backing pvs.
+func volumeIndex(pvs []kube.PersistentVolume) *cleanup.VolumeIndex {
+	volumes := cleanup.NewVolumeIndex()
+	for _, pv := range pvs {
+		diskID := pv.DiskID()
+		if diskID == "" {
+			continue
+		}
+		volumes.Add(diskID, cleanup.VolumeOwner{PersistentVolume: pv.Metadata.Name, Claim: pv.Claim()})
+	}
+	return volumes
+}
@@ -0,0 +1,94 @@
+package diskerr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Category groups errors by what an operator does about them, e.g. raise a
+// quota or grant a permission.
+type Category string
+
+const (
+	// CategoryQuota means a request was rejected for exceeding a rate limit
+	// or quota.
+	CategoryQuota Category = "quota"
+	// CategoryPermission means a request was denied.
+	CategoryPermission Category = "permission"
+	// CategoryInUse means the disk is still in use, by an instance, a
+	// PersistentVolume or another resource.
+	CategoryInUse Category = "in-use"
+	// CategoryNotFound means the resource no longer exists.
+	CategoryNotFound Category = "not-found"
+	// CategoryAPI means any other failed API call.
+	CategoryAPI Category = "api"
+	// CategoryCheck means a check of the disk decided its outcome, without
+	// an API call failing, e.g. it is within the cutoff.
+	CategoryCheck Category = "check"
+)
+
+// quotaReasons are the error reasons with which the Compute API rejects
+// requests over quota, with status 403 rather than 429.
+var quotaReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"quotaExceeded":         true,
+}
+
+// IsQuotaReason reports whether reason is one with which the Compute API
+// rejects requests over quota.
+func IsQuotaReason(reason string) bool {
+	return quotaReasons[reason]
+}
+
+// ReasonInUse is the error reason with which the Compute API rejects changing
+// a disk that another resource, e.g. an instance, uses.
+const ReasonInUse = "resourceInUseByAnotherResource"
+
+// Class is the classification of an error, so that the errors of a run can
+// be counted by cause rather than logged one by one.
+type Class struct {
+	Category Category
+	// Reason is the error reason of a failed API call, e.g.
+	// resourceInUseByAnotherResource or HTTP 500 if it has none, or else
+	// the Code of the error.
+	Reason string
+}
+
+func (c Class) String() string {
+	return fmt.Sprintf("%s: %s", c.Category, c.Reason)
+}
+
+// Classify returns the class of err, by the failed API call in its chain if
+// any, or else by its Code.
+func Classify(err error) Class {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		reason := fmt.Sprintf("HTTP %d", apiErr.Code)
+		if len(apiErr.Errors) > 0 && apiErr.Errors[0].Reason != "" {
+			reason = apiErr.Errors[0].Reason
+		}
+		switch {
+		case apiErr.Code == http.StatusTooManyRequests || IsQuotaReason(reason):
+			return Class{Category: CategoryQuota, Reason: reason}
+		case apiErr.Code == http.StatusForbidden || apiErr.Code == http.StatusUnauthorized:
+			return Class{Category: CategoryPermission, Reason: reason}
+		case reason == ReasonInUse:
+			return Class{Category: CategoryInUse, Reason: reason}
+		case apiErr.Code == http.StatusNotFound:
+			return Class{Category: CategoryNotFound, Reason: reason}
+		}
+		return Class{Category: CategoryAPI, Reason: reason}
+	}
+	code := CodeOf(err)
+	switch code {
+	case CodeInUse, CodeAttached:
+		return Class{Category: CategoryInUse, Reason: string(code)}
+	case CodeAPI, CodeIterator:
+		return Class{Category: CategoryAPI, Reason: string(code)}
+	}
+	return Class{Category: CategoryCheck, Reason: string(code)}
+}
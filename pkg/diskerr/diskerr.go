@@ -0,0 +1,170 @@
+// Package diskerr defines the errors returned while marking and cleaning up
+// disks. Every error carries a Code so that callers can branch on the outcome
+// with errors.Is or errors.As instead of matching on error strings.
+package diskerr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code classifies an Error.
+type Code string
+
+const (
+	// CodeUnknown is returned by CodeOf for errors that are not an *Error.
+	CodeUnknown Code = "UNKNOWN"
+	// CodeAlreadyMarked means the disk already carries the deletion mark.
+	CodeAlreadyMarked Code = "ALREADY_MARKED"
+	// CodeWithinCutoff means the disk was last attached within the cutoff.
+	CodeWithinCutoff Code = "WITHIN_CUTOFF"
+	// CodeKeptByPolicy means the rules of --mark-policy did not find the
+	// disk abandoned.
+	CodeKeptByPolicy Code = "KEPT_BY_POLICY"
+	// CodeUnmarked means the disk was explicitly unmarked for deletion.
+	CodeUnmarked Code = "UNMARKED"
+	// CodeNotMarked means the disk does not carry the deletion mark required
+	// for cleanup.
+	CodeNotMarked Code = "NOT_MARKED"
+	// CodeLabelBudgetExhausted means a label could not be written because
+	// the disk already carries the maximum number of labels.
+	CodeLabelBudgetExhausted Code = "LABEL_BUDGET_EXHAUSTED"
+	// CodeWithinRetention means a snapshot was created within the retention
+	// period.
+	CodeWithinRetention Code = "WITHIN_RETENTION"
+	// CodeArchived means a snapshot is the archive snapshot of a disk
+	// deleted by cleanup --mode archive, which is kept to thaw the disk.
+	CodeArchived Code = "ARCHIVED"
+	// CodeInUse means the disk backs an existing Kubernetes PersistentVolume.
+	CodeInUse Code = "IN_USE"
+	// CodeBeingDeleted means the disk is already being deleted, e.g. by a
+	// run that was killed before the deletion completed.
+	CodeBeingDeleted Code = "BEING_DELETED"
+	// CodeDeferred means the deletion of a disk was deferred to a later run,
+	// e.g. until a recent snapshot of it exists.
+	CodeDeferred Code = "DEFERRED"
+	// CodeSnapshotComplete means the snapshot phase of a cleanup already
+	// took a snapshot of the disk.
+	CodeSnapshotComplete Code = "SNAPSHOT_COMPLETE"
+	// CodeSnapshotUnverified means the snapshot taken of a disk before
+	// deleting it is not ready, or not of that disk, so the disk was not
+	// deleted.
+	CodeSnapshotUnverified Code = "SNAPSHOT_UNVERIFIED"
+	// CodeBootDisk means the disk looks like the boot disk of an instance,
+	// which is never marked or deleted unless boot disks are included.
+	CodeBootDisk Code = "BOOT_DISK"
+	// CodeManaged means the disk is managed by infrastructure as code, e.g.
+	// Terraform or Config Connector, and must not be deleted out-of-band.
+	CodeManaged Code = "MANAGED"
+	// CodeRegional means the disk is a regional disk, replicated across two
+	// zones, which is listed with --all-zones but never marked or deleted.
+	CodeRegional Code = "REGIONAL"
+	// CodeClusterUnknown means the GKE cluster a load balancer resource was
+	// created for could not be told, so it is never marked or deleted.
+	CodeClusterUnknown Code = "CLUSTER_UNKNOWN"
+	// CodeNotPlanned means cleanup executes a reviewed plan which does not
+	// delete the disk.
+	CodeNotPlanned Code = "NOT_PLANNED"
+	// CodePlanStale means the disk changed since the plan that deletes it was
+	// made, so the plan must be made and reviewed again.
+	CodePlanStale Code = "PLAN_STALE"
+	// CodeBudgetExhausted means the deletion budget of the cleanup run was
+	// exhausted, so the disk was not deleted.
+	CodeBudgetExhausted Code = "BUDGET_EXHAUSTED"
+	// CodeExempt means the disk carries the exempt label and is never marked
+	// or deleted.
+	CodeExempt Code = "EXEMPT"
+	// CodeWithinGracePeriod means the disk was marked for deletion too
+	// recently to be deleted.
+	CodeWithinGracePeriod Code = "WITHIN_GRACE_PERIOD"
+	// CodeAttached means the disk is attached to an instance right now.
+	CodeAttached Code = "ATTACHED"
+	// CodeLowScore means the disk is past its cutoff, but scored below the
+	// threshold of the score model.
+	CodeLowScore Code = "LOW_SCORE"
+	// CodeTenantMismatch means a disk or snapshot does not belong to the
+	// tenant the run is scoped to, and must not be changed.
+	CodeTenantMismatch Code = "TENANT_MISMATCH"
+	// CodeDryRun means a write operation was skipped because dry run is enabled.
+	CodeDryRun Code = "DRY_RUN"
+	// CodeInvalidTimestamp means a disk timestamp could not be parsed.
+	CodeInvalidTimestamp Code = "INVALID_TIMESTAMP"
+	// CodeIterator means listing disks failed.
+	CodeIterator Code = "ITERATOR"
+	// CodeZoneMismatch means a request for a disk was about to be sent to a
+	// zone other than the one the disk lives in, or one that was not
+	// requested.
+	CodeZoneMismatch Code = "ZONE_MISMATCH"
+	// CodeAPI means a compute API call failed.
+	CodeAPI Code = "API"
+)
+
+// Sentinel errors for use with errors.Is. Any *Error with the same code
+// matches, regardless of its message or cause.
+var (
+	ErrAlreadyMarked = New(CodeAlreadyMarked, "disk already labelled")
+	ErrWithinCutoff  = New(CodeWithinCutoff, "disk last attached within cutoff")
+	ErrKeptByPolicy  = New(CodeKeptByPolicy, "disk kept by the mark policy")
+	ErrUnmarked      = New(CodeUnmarked, "disk explicitly unmarked for deletion")
+	ErrDryRun        = New(CodeDryRun, "dry run enabled")
+
+	ErrLabelBudgetExhausted = New(CodeLabelBudgetExhausted, "disk label limit reached")
+	ErrInUse                = New(CodeInUse, "disk backs an existing persistent volume")
+	ErrWithinRetention      = New(CodeWithinRetention, "snapshot created within retention period")
+	ErrArchived             = New(CodeArchived, "snapshot archives a deleted disk")
+	ErrBeingDeleted         = New(CodeBeingDeleted, "disk is already being deleted")
+	ErrDeferred             = New(CodeDeferred, "disk deletion deferred to a later run")
+	ErrExempt               = New(CodeExempt, "disk is exempt from cleanup")
+	ErrWithinGracePeriod    = New(CodeWithinGracePeriod, "disk marked for deletion within grace period")
+	ErrAttached             = New(CodeAttached, "disk is attached to an instance")
+	ErrSnapshotUnverified   = New(CodeSnapshotUnverified, "snapshot of disk could not be verified")
+	ErrBootDisk             = New(CodeBootDisk, "disk is a boot disk")
+	ErrManaged              = New(CodeManaged, "disk is managed by infrastructure as code")
+	ErrRegional             = New(CodeRegional, "disk is a regional disk")
+	ErrLowScore             = New(CodeLowScore, "disk scored below the threshold")
+)
+
+// Error is an error with a Code and an optional underlying cause.
+type Error struct {
+	Code Code
+	Msg  string
+	Err  error
+}
+
+// New returns an *Error with the given code and formatted message.
+func New(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Wrap returns an *Error with the given code and formatted message that
+// wraps err.
+func Wrap(code Code, err error, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error with the same code, so that
+// errors.Is(err, ErrDryRun) matches any dry run error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// CodeOf returns the code of the first *Error in err's chain, or CodeUnknown.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
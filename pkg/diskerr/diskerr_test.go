@@ -0,0 +1,82 @@
+package diskerr
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	"google.golang.org/api/googleapi"
+)
+
+func Test_Error(t *testing.T) {
+	t.Parallel()
+
+	t.Run("message", func(t *testing.T) {
+		t.Parallel()
+		require.EqualError(t, ErrDryRun, "dry run enabled")
+		require.EqualError(t, New(CodeNotMarked, "disk %s: missing required label", "test-disk"), "disk test-disk: missing required label")
+		require.EqualError(t, Wrap(CodeAPI, xerrors.Errorf("google says no"), "failed to delete disk %s", "test-disk"), "failed to delete disk test-disk: google says no")
+	})
+
+	t.Run("is", func(t *testing.T) {
+		t.Parallel()
+		err := xerrors.Errorf("outer: %w", New(CodeDryRun, "not deleting"))
+		require.True(t, errors.Is(err, ErrDryRun))
+		require.False(t, errors.Is(err, ErrAlreadyMarked))
+	})
+
+	t.Run("as", func(t *testing.T) {
+		t.Parallel()
+		cause := xerrors.Errorf("google says no")
+		err := xerrors.Errorf("outer: %w", Wrap(CodeAPI, cause, "error updating disk labels"))
+		var e *Error
+		require.True(t, errors.As(err, &e))
+		require.Equal(t, CodeAPI, e.Code)
+		require.True(t, errors.Is(err, cause))
+	})
+
+	t.Run("code of", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, CodeAlreadyMarked, CodeOf(ErrAlreadyMarked))
+		require.Equal(t, CodeUnknown, CodeOf(xerrors.Errorf("test error")))
+		require.Equal(t, CodeUnknown, CodeOf(nil))
+	})
+}
+
+func Test_Classify(t *testing.T) {
+	t.Parallel()
+
+	apiErr := func(code int, reason string) error {
+		err := &googleapi.Error{Code: code}
+		if reason != "" {
+			err.Errors = []googleapi.ErrorItem{{Reason: reason}}
+		}
+		return Wrap(CodeAPI, err, "failed to delete disk test-disk")
+	}
+	tests := []struct {
+		name     string
+		err      error
+		expected Class
+	}{
+		{"too many requests", apiErr(http.StatusTooManyRequests, ""), Class{CategoryQuota, "HTTP 429"}},
+		{"quota exceeded", apiErr(http.StatusForbidden, "quotaExceeded"), Class{CategoryQuota, "quotaExceeded"}},
+		{"forbidden", apiErr(http.StatusForbidden, "forbidden"), Class{CategoryPermission, "forbidden"}},
+		{"in use", apiErr(http.StatusBadRequest, ReasonInUse), Class{CategoryInUse, ReasonInUse}},
+		{"not found", apiErr(http.StatusNotFound, "notFound"), Class{CategoryNotFound, "notFound"}},
+		{"server error", apiErr(http.StatusInternalServerError, ""), Class{CategoryAPI, "HTTP 500"}},
+		{"attached", ErrAttached, Class{CategoryInUse, "ATTACHED"}},
+		{"api without response", New(CodeAPI, "boom"), Class{CategoryAPI, "API"}},
+		{"check", ErrWithinCutoff, Class{CategoryCheck, "WITHIN_CUTOFF"}},
+		{"unknown", xerrors.New("boom"), Class{CategoryCheck, "UNKNOWN"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expected, Classify(tt.err))
+		})
+	}
+	require.Equal(t, "in-use: resourceInUseByAnotherResource", Class{CategoryInUse, ReasonInUse}.String())
+}
@@ -0,0 +1,131 @@
+// Package events implements a small synchronous event bus. The mark and
+// cleanup engine publishes an Event for every significant step, and outputs
+// such as logs, metrics and reports subscribe to the bus instead of being
+// wired into the engine itself.
+package events
+
+import (
+	"sync"
+	"time"
+
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+)
+
+// Type identifies the kind of an Event.
+type Type string
+
+const (
+	// DiskScanned is published once per disk after the engine decided what
+	// to do with it. Action holds the decision and Err the reason for
+	// skipping, if any.
+	DiskScanned Type = "DiskScanned"
+	// DiskProcessed is published once per disk after all work on it is done.
+	// Action holds the decision and Err the reason it was not carried out,
+	// if any.
+	DiskProcessed Type = "DiskProcessed"
+	// DiskMarked is published after a disk was labelled for deletion.
+	DiskMarked Type = "DiskMarked"
+	// DiskUnmarked is published after a deletion mark was removed from a disk.
+	DiskUnmarked Type = "DiskUnmarked"
+	// SnapshotCreated is published after a pre-deletion snapshot completed.
+	SnapshotCreated Type = "SnapshotCreated"
+	// DiskExported is published after a disk was exported to Cloud Storage
+	// before its deletion. Export is set.
+	DiskExported Type = "DiskExported"
+	// DiskDeleted is published after a disk was deleted. Snapshot is set if
+	// the disk was snapshotted before, possibly with only its name.
+	DiskDeleted Type = "DiskDeleted"
+	// DiskRestored is published after a disk was recreated from a snapshot.
+	// Both Disk and Snapshot are set.
+	DiskRestored Type = "DiskRestored"
+	// SnapshotDeleted is published after a snapshot was pruned. Snapshot is
+	// set instead of Disk.
+	SnapshotDeleted Type = "SnapshotDeleted"
+	// Error is published when processing a disk or snapshot failed. Err
+	// holds the cause.
+	Error Type = "Error"
+)
+
+// Event describes something that happened to a disk.
+type Event struct {
+	Type      Type
+	Time      time.Time
+	ProjectID string
+	Zone      string
+	Disk      *computepb.Disk
+	Snapshot  *computepb.Snapshot
+	Action    string
+	DryRun    bool
+	Err       error
+	// Operation is the name of the Compute Engine operation that made the
+	// change, if known.
+	Operation string
+	// Score is the confidence that the disk is unused, from 0 to 1, on the
+	// DiskScanned and DiskProcessed events of a disk rated by a score model.
+	Score *float64
+	// Export is where the disk of a DiskExported event was exported to.
+	Export *Export
+}
+
+// Export is a disk image exported to a Cloud Storage object, with the
+// checksums Cloud Storage computed for the object.
+type Export struct {
+	// URI is the object, e.g. gs://bucket/disk.tar.gz.
+	URI       string
+	SizeBytes int64
+	// MD5 and CRC32C are the base64-encoded checksums of the object.
+	MD5    string
+	CRC32C string
+}
+
+// Handler receives published events. Handlers are called synchronously on the
+// publishing goroutine and must be safe for concurrent use.
+type Handler func(Event)
+
+// Bus dispatches events to subscribed handlers. The zero value is not usable;
+// create one with NewBus. A nil *Bus silently drops all events.
+type Bus struct {
+	mu       sync.RWMutex
+	all      []Handler
+	handlers map[Type][]Handler
+}
+
+// NewBus returns an empty Bus.
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[Type][]Handler)}
+}
+
+// Subscribe registers h for the given event types, or for all events if no
+// types are given.
+func (b *Bus) Subscribe(h Handler, types ...Type) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(types) == 0 {
+		b.all = append(b.all, h)
+		return
+	}
+	for _, t := range types {
+		b.handlers[t] = append(b.handlers[t], h)
+	}
+}
+
+// Publish delivers e to every handler subscribed to its type, in
+// subscription order. The event time defaults to now. Publish may be called
+// concurrently, e.g. by an engine processing several disks at a time, so
+// handlers must be safe for concurrent use.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, h := range b.all {
+		h(e)
+	}
+	for _, h := range b.handlers[e.Type] {
+		h(e)
+	}
+}
@@ -0,0 +1,39 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Bus(t *testing.T) {
+	t.Parallel()
+
+	t.Run("dispatch", func(t *testing.T) {
+		t.Parallel()
+		bus := NewBus()
+		var all, deleted []Type
+		bus.Subscribe(func(e Event) { all = append(all, e.Type) })
+		bus.Subscribe(func(e Event) { deleted = append(deleted, e.Type) }, DiskDeleted, Error)
+
+		bus.Publish(Event{Type: DiskScanned})
+		bus.Publish(Event{Type: DiskDeleted})
+		bus.Publish(Event{Type: Error})
+
+		require.Equal(t, []Type{DiskScanned, DiskDeleted, Error}, all)
+		require.Equal(t, []Type{DiskDeleted, Error}, deleted)
+	})
+
+	t.Run("time defaults to now", func(t *testing.T) {
+		t.Parallel()
+		bus := NewBus()
+		bus.Subscribe(func(e Event) { require.False(t, e.Time.IsZero()) })
+		bus.Publish(Event{Type: DiskScanned})
+	})
+
+	t.Run("nil bus", func(t *testing.T) {
+		t.Parallel()
+		var bus *Bus
+		require.NotPanics(t, func() { bus.Publish(Event{Type: DiskScanned}) })
+	})
+}
@@ -0,0 +1,125 @@
+// Package history records the changes made by gke-disk-cleanup in a JSON
+// lines file in a store, so that later commands such as reconcile can tell which
+// changes were made by this tool.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/store"
+)
+
+// Record is a single change made to a disk.
+type Record struct {
+	Time time.Time `json:"time"`
+	// RunID is shared by all records written by one Writer.
+	RunID     string      `json:"runID"`
+	Type      events.Type `json:"type"`
+	ProjectID string      `json:"projectID"`
+	Zone      string      `json:"zone"`
+	DiskName  string      `json:"diskName"`
+	SelfLink  string      `json:"selfLink,omitempty"`
+}
+
+// ResourceName returns the disk's resource name as used in Cloud Audit Logs,
+// e.g. projects/p/zones/us-east1-a/disks/d.
+func (r Record) ResourceName() string {
+	return path.Join("projects", r.ProjectID, "zones", r.Zone, "disks", r.DiskName)
+}
+
+// recorded are the event types that change a disk.
+var recorded = map[events.Type]bool{
+	events.DiskMarked:   true,
+	events.DiskUnmarked: true,
+	events.DiskDeleted:  true,
+	events.DiskRestored: true,
+}
+
+// Writer appends a Record for every change published on the event bus.
+type Writer struct {
+	// ctx is used to append records, as event handlers do not take a
+	// context.
+	ctx   context.Context
+	s     store.Store
+	path  string
+	runID string
+
+	mu  sync.Mutex
+	err error
+}
+
+// Open returns a Writer appending to the file at path in s, which is created
+// on the first change if it does not exist.
+func Open(ctx context.Context, s store.Store, path string) *Writer {
+	return &Writer{ctx: ctx, s: s, path: path, runID: uuid.New().String()}
+}
+
+// Handle is an events.Handler that records changes to disks.
+func (w *Writer) Handle(e events.Event) {
+	if !recorded[e.Type] || e.DryRun {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return
+	}
+	data, err := json.Marshal(Record{
+		Time:      e.Time,
+		RunID:     w.runID,
+		Type:      e.Type,
+		ProjectID: e.ProjectID,
+		Zone:      e.Zone,
+		DiskName:  e.Disk.GetName(),
+		SelfLink:  e.Disk.GetSelfLink(),
+	})
+	if err != nil {
+		w.err = err
+		return
+	}
+	w.err = w.s.Append(w.ctx, w.path, append(data, '\n'))
+}
+
+// Close returns the first error writing to the file, if any.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return xerrors.Errorf("write history file: %w", w.err)
+	}
+	return nil
+}
+
+// Read returns all records in the history file at path in s.
+func Read(ctx context.Context, s store.Store, path string) ([]Record, error) {
+	data, err := s.Get(ctx, path)
+	if err != nil {
+		return nil, xerrors.Errorf("open history file: %w", err)
+	}
+	var records []Record
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, xerrors.Errorf("history file %s line %d: %w", path, line, err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.Errorf("read history file: %w", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,44 @@
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/store"
+)
+
+func Test_WriterRead(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	disk := &computepb.Disk{Name: pointer.String("test-disk")}
+
+	w := Open(ctx, store.Local{}, path)
+	w.Handle(events.Event{Type: events.DiskScanned, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk})
+	w.Handle(events.Event{Type: events.DiskDeleted, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, DryRun: true})
+	w.Handle(events.Event{Type: events.DiskDeleted, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk})
+	require.NoError(t, w.Close())
+
+	// a second run appends
+	w = Open(ctx, store.Local{}, path)
+	w.Handle(events.Event{Type: events.DiskMarked, Time: now, ProjectID: "testing", Zone: "us-east1-c", Disk: disk})
+	require.NoError(t, w.Close())
+
+	records, err := Read(ctx, store.Local{}, path)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, events.DiskDeleted, records[0].Type)
+	require.Equal(t, "projects/testing/zones/us-east1-b/disks/test-disk", records[0].ResourceName())
+	require.True(t, now.Equal(records[0].Time))
+	require.Equal(t, events.DiskMarked, records[1].Type)
+	require.NotEqual(t, records[0].RunID, records[1].RunID)
+}
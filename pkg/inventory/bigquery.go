@@ -0,0 +1,135 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/bqtable"
+)
+
+// schema is the schema of the table, with a column per JSON field of Row.
+// Columns may be added, but never changed or removed, as existing tables are
+// only ever extended.
+var schema = []*bigquery.TableFieldSchema{
+	{Name: "time", Type: "TIMESTAMP", Mode: "REQUIRED", Description: "when the disk was processed"},
+	{Name: "runID", Type: "STRING", Mode: "REQUIRED", Description: "ID shared by the rows of a run"},
+	{Name: "seq", Type: "INTEGER", Mode: "REQUIRED", Description: "number of the row in its run"},
+	{Name: "command", Type: "STRING", Description: "mark, cleanup or unmark"},
+	{Name: "projectID", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "zone", Type: "STRING"},
+	{Name: "cluster", Type: "STRING", Description: "GKE cluster the disk was created for, if known"},
+	{Name: "disk", Type: "STRING", Mode: "REQUIRED"},
+	{Name: "diskID", Type: "STRING"},
+	{Name: "type", Type: "STRING", Description: "disk type, e.g. pd-balanced"},
+	{Name: "sizeGB", Type: "INTEGER"},
+	{Name: "source", Type: "STRING", Description: "what the disk was created from, e.g. image"},
+	{Name: "lastUsed", Type: "TIMESTAMP", Description: "when the disk was last created, attached or detached"},
+	{Name: "labels", Type: "RECORD", Mode: "REPEATED", Fields: []*bigquery.TableFieldSchema{
+		{Name: "key", Type: "STRING"},
+		{Name: "value", Type: "STRING"},
+	}},
+	{Name: "action", Type: "STRING", Description: "action taken on the disk, e.g. MARK, DELETE or SKIP"},
+	{Name: "code", Type: "STRING", Description: "why the disk was skipped or failed, e.g. WITHIN_CUTOFF"},
+	{Name: "error", Type: "STRING"},
+	{Name: "dryRun", Type: "BOOLEAN"},
+	{Name: "score", Type: "FLOAT", Description: "rating of the disk by the score model, if scored"},
+	{Name: "monthlyCostUSD", Type: "FLOAT", Description: "estimated monthly cost of the disk"},
+	{Name: "namespace", Type: "STRING", Description: "Kubernetes namespace of the PersistentVolumeClaim the disk was provisioned for"},
+	{Name: "pvc", Type: "STRING", Description: "name of the PersistentVolumeClaim the disk was provisioned for"},
+	{Name: "pv", Type: "STRING", Description: "name of the PersistentVolume of the disk"},
+}
+
+// BigQuery streams rows into a BigQuery table whose schema it manages.
+type BigQuery struct {
+	table *bqtable.Table
+}
+
+// NewBigQuery returns a BigQuery sink inserting into table, e.g.
+// my-project.inventory.disks. The table is created, partitioned by day, if
+// it does not exist, and the columns it lacks are added if it does. The
+// dataset must exist.
+func NewBigQuery(ctx context.Context, table string, opts ...option.ClientOption) (*BigQuery, error) {
+	t, err := bqtable.Open(ctx, table, "inventory", opts...)
+	if err != nil {
+		return nil, err
+	}
+	b := &BigQuery{table: t}
+	if err := b.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *BigQuery) String() string {
+	return b.table.String()
+}
+
+// ensureTable creates the table, or adds the columns of schema it lacks.
+func (b *BigQuery) ensureTable(ctx context.Context) error {
+	ref := b.table
+	t, err := ref.Svc.Tables.Get(ref.ProjectID, ref.DatasetID, ref.TableID).Context(ctx).Do()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		_, err = ref.Svc.Tables.Insert(ref.ProjectID, ref.DatasetID, &bigquery.Table{
+			TableReference:   &bigquery.TableReference{ProjectId: ref.ProjectID, DatasetId: ref.DatasetID, TableId: ref.TableID},
+			Description:      "Disks evaluated by gke-disk-cleanup runs and the decisions taken on them",
+			Schema:           &bigquery.TableSchema{Fields: schema},
+			TimePartitioning: &bigquery.TimePartitioning{Type: "DAY", Field: "time"},
+			Clustering:       &bigquery.Clustering{Fields: []string{"projectID", "action"}},
+		}).Context(ctx).Do()
+		if err != nil {
+			return xerrors.Errorf("create table %s: %w", b, err)
+		}
+		log.Info().Str("table", b.String()).Msg("created inventory table")
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("get table %s: %w", b, err)
+	}
+	var fields []*bigquery.TableFieldSchema
+	if t.Schema != nil {
+		fields = t.Schema.Fields
+	}
+	existing := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		existing[f.Name] = true
+	}
+	var added []string
+	for _, f := range schema {
+		if !existing[f.Name] {
+			// columns added to an existing table must be nullable
+			column := *f
+			if column.Mode == "REQUIRED" {
+				column.Mode = "NULLABLE"
+			}
+			fields = append(fields, &column)
+			added = append(added, f.Name)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	_, err = ref.Svc.Tables.Patch(ref.ProjectID, ref.DatasetID, ref.TableID, &bigquery.Table{Schema: &bigquery.TableSchema{Fields: fields}}).Context(ctx).Do()
+	if err != nil {
+		return xerrors.Errorf("add columns %v to table %s: %w", added, b, err)
+	}
+	log.Info().Str("table", b.String()).Strs("columns", added).Msg("added columns to inventory table")
+	return nil
+}
+
+// Insert inserts rows. Every row carries an insert ID made of its run and
+// sequence number, with which BigQuery drops rows inserted twice.
+func (b *BigQuery) Insert(ctx context.Context, rows []Row) error {
+	bqRows := make([]bqtable.Row, 0, len(rows))
+	for _, r := range rows {
+		bqRows = append(bqRows, bqtable.Row{InsertID: bqtable.InsertID(r.RunID, r.Seq), Value: r})
+	}
+	return b.table.Insert(ctx, bqRows)
+}
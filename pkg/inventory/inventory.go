@@ -0,0 +1,206 @@
+// Package inventory exports every disk evaluated by a run, with its decision,
+// to a BigQuery table, so that the trends of abandoned disks across projects
+// can be charted over time, e.g. in Looker.
+package inventory
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+	"gke-disk-cleanup/pkg/pricing"
+)
+
+// batchSize is how many rows are buffered before they are inserted.
+const batchSize = 500
+
+// closeTimeout bounds inserting the last rows on Close, which happens even if
+// the run was interrupted.
+const closeTimeout = 30 * time.Second
+
+// Label is a label of a disk.
+type Label struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Row is a disk evaluated by a run and the decision taken on it. Its JSON
+// fields are the columns of the table, see schema.
+type Row struct {
+	Time time.Time `json:"time"`
+	// RunID is shared by all rows of a run, and Seq numbers them from 1.
+	RunID     string `json:"runID"`
+	Seq       int64  `json:"seq"`
+	Command   string `json:"command"`
+	ProjectID string `json:"projectID"`
+	Zone      string `json:"zone,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+	// Namespace and PVC are the PersistentVolumeClaim and PV the
+	// PersistentVolume the disk was provisioned for, if known.
+	Namespace string `json:"namespace,omitempty"`
+	PVC       string `json:"pvc,omitempty"`
+	PV        string `json:"pv,omitempty"`
+	Disk      string `json:"disk"`
+	DiskID    string `json:"diskID,omitempty"`
+	Type      string `json:"type,omitempty"`
+	SizeGB    int64  `json:"sizeGB"`
+	Source    string `json:"source,omitempty"`
+	// LastUsed is when the disk was last in use, see cleanup.LastUsed.
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+	Labels   []Label    `json:"labels,omitempty"`
+	// Action is the action taken, and Code classifies Error, e.g.
+	// WITHIN_CUTOFF for a deliberate skip.
+	Action string   `json:"action"`
+	Code   string   `json:"code,omitempty"`
+	Error  string   `json:"error,omitempty"`
+	DryRun bool     `json:"dryRun"`
+	Score  *float64 `json:"score,omitempty"`
+	// MonthlyCostUSD is what the disk costs per month at the prices of the
+	// run.
+	MonthlyCostUSD float64 `json:"monthlyCostUSD"`
+}
+
+// newRow returns the row of e, a DiskProcessed event.
+func newRow(e events.Event, prices *pricing.Table) Row {
+	disk := e.Disk
+	r := Row{
+		Time:           e.Time.UTC(),
+		ProjectID:      e.ProjectID,
+		Zone:           e.Zone,
+		Cluster:        cleanup.Cluster(disk),
+		Disk:           disk.GetName(),
+		SizeGB:         disk.GetSizeGb(),
+		Source:         string(cleanup.DiskSource(disk)),
+		Action:         e.Action,
+		DryRun:         e.DryRun,
+		Score:          e.Score,
+		MonthlyCostUSD: prices.DiskMonthlyCost(disk.GetType(), disk.GetSizeGb()),
+	}
+	claim := cleanup.ClaimOf(disk)
+	r.Namespace, r.PVC, r.PV = claim.Namespace, claim.Name, claim.Volume
+	if disk.Id != nil {
+		r.DiskID = strconv.FormatUint(disk.GetId(), 10)
+	}
+	if diskType := disk.GetType(); diskType != "" {
+		r.Type = path.Base(diskType)
+	}
+	if lastUsed, err := time.Parse(time.RFC3339, cleanup.LastUsed(disk)); err == nil {
+		lastUsed = lastUsed.UTC()
+		r.LastUsed = &lastUsed
+	}
+	for key, value := range disk.GetLabels() {
+		r.Labels = append(r.Labels, Label{Key: key, Value: value})
+	}
+	sort.Slice(r.Labels, func(i, j int) bool { return r.Labels[i].Key < r.Labels[j].Key })
+	if e.Err != nil {
+		r.Error = e.Err.Error()
+		r.Code = string(diskerr.CodeOf(e.Err))
+	}
+	return r
+}
+
+// Sink stores rows.
+type Sink interface {
+	// Insert appends rows. Inserting the same rows again, e.g. after a
+	// failure, must not duplicate any.
+	Insert(ctx context.Context, rows []Row) error
+}
+
+// Exporter inserts a Row for every disk processed, as published on the event
+// bus, into its sink in batches.
+type Exporter struct {
+	// ctx is used to insert full batches, as event handlers do not take a
+	// context.
+	ctx  context.Context
+	sink Sink
+
+	mu      sync.Mutex
+	runID   string
+	command string
+	// prices may be nil for the built-in prices.
+	prices  *pricing.Table
+	seq     int64
+	pending []Row
+}
+
+// NewExporter returns an Exporter inserting into sink.
+func NewExporter(ctx context.Context, sink Sink) *Exporter {
+	return &Exporter{ctx: ctx, sink: sink}
+}
+
+// Begin starts a new run of command, using prices for the costs. Rows of the
+// previous run that were not inserted yet are kept. It is safe to call on a
+// nil *Exporter.
+func (x *Exporter) Begin(command string, prices *pricing.Table) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.runID, x.command, x.prices, x.seq = uuid.New().String(), command, prices, 0
+}
+
+// Handle is an events.Handler that exports processed disks.
+func (x *Exporter) Handle(e events.Event) {
+	if e.Type != events.DiskProcessed || e.Disk == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.runID == "" {
+		x.runID = uuid.New().String()
+	}
+	r := newRow(e, x.prices)
+	x.seq++
+	r.RunID, r.Seq, r.Command = x.runID, x.seq, x.command
+	x.pending = append(x.pending, r)
+	if len(x.pending)%batchSize == 0 {
+		if err := x.flush(x.ctx); err != nil {
+			log.Error().Err(err).Int("rows", len(x.pending)).Msg("unable to export disks, retrying with the next batch")
+		}
+	}
+}
+
+// Flush inserts the buffered rows, e.g. at the end of a run. A nil *Exporter
+// does nothing.
+func (x *Exporter) Flush(ctx context.Context) error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.flush(ctx)
+}
+
+// flush inserts the pending rows. x.mu must be held.
+func (x *Exporter) flush(ctx context.Context) error {
+	if len(x.pending) == 0 {
+		return nil
+	}
+	if err := x.sink.Insert(ctx, x.pending); err != nil {
+		return err
+	}
+	x.pending = nil
+	return nil
+}
+
+// Close inserts the buffered rows, even if the context of the Exporter is
+// done, and returns an error if any row could not be inserted in the end.
+func (x *Exporter) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	if err := x.Flush(ctx); err != nil {
+		return xerrors.Errorf("export disks: %w", err)
+	}
+	return nil
+}
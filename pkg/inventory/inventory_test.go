@@ -0,0 +1,252 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// fakeSink records the batches inserted, and fails while failing is set.
+type fakeSink struct {
+	mu      sync.Mutex
+	batches [][]Row
+	failing bool
+}
+
+func (s *fakeSink) Insert(_ context.Context, rows []Row) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return xerrors.New("sink unavailable")
+	}
+	s.batches = append(s.batches, append([]Row(nil), rows...))
+	return nil
+}
+
+func Test_Exporter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	id := uint64(123)
+	disk := &computepb.Disk{
+		Name:                pointer.String("test-disk"),
+		Id:                  &id,
+		Type:                pointer.String("https://www.googleapis.com/compute/v1/projects/testing/zones/us-east1-b/diskTypes/pd-ssd"),
+		SizeGb:              pointer.Int64(10),
+		Labels:              map[string]string{"team": "payments", "owner": "jdoe"},
+		CreationTimestamp:   pointer.String("2021-12-01T12:00:00Z"),
+		LastAttachTimestamp: pointer.String("2022-01-30T12:00:00-05:00"),
+	}
+
+	t.Run("exports processed disks", func(t *testing.T) {
+		t.Parallel()
+
+		sink := &fakeSink{}
+		x := NewExporter(context.Background(), sink)
+		x.Begin("mark", nil)
+		x.Handle(events.Event{Type: events.DiskScanned, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk})
+		x.Handle(events.Event{Type: events.DiskProcessed, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Action: "MARK"})
+		x.Handle(events.Event{Type: events.DiskProcessed, Time: now, ProjectID: "testing", Zone: "us-east1-b", Disk: disk, Action: "SKIP", DryRun: true, Err: diskerr.ErrWithinCutoff})
+		require.Empty(t, sink.batches, "rows are buffered")
+		require.NoError(t, x.Close())
+
+		require.Len(t, sink.batches, 1)
+		rows := sink.batches[0]
+		require.Len(t, rows, 2)
+		runID := rows[0].RunID
+		require.NotEmpty(t, runID)
+		lastUsed := time.Date(2022, 1, 30, 17, 0, 0, 0, time.UTC)
+		require.InDelta(t, 1.7, rows[0].MonthlyCostUSD, 1e-9)
+		require.Equal(t, Row{
+			Time:           now,
+			RunID:          runID,
+			Seq:            1,
+			Command:        "mark",
+			ProjectID:      "testing",
+			Zone:           "us-east1-b",
+			Disk:           "test-disk",
+			DiskID:         "123",
+			Type:           "pd-ssd",
+			SizeGB:         10,
+			Source:         "blank",
+			LastUsed:       &lastUsed,
+			Labels:         []Label{{Key: "owner", Value: "jdoe"}, {Key: "team", Value: "payments"}},
+			Action:         "MARK",
+			MonthlyCostUSD: rows[0].MonthlyCostUSD,
+		}, rows[0])
+		require.Equal(t, int64(2), rows[1].Seq)
+		require.Equal(t, "WITHIN_CUTOFF", rows[1].Code)
+		require.Equal(t, "disk last attached within cutoff", rows[1].Error)
+		require.True(t, rows[1].DryRun)
+
+		// every run has an ID of its own
+		x.Begin("cleanup", nil)
+		x.Handle(events.Event{Type: events.DiskProcessed, Time: now, ProjectID: "testing", Disk: disk, Action: "DELETE"})
+		require.NoError(t, x.Flush(context.Background()))
+		require.Len(t, sink.batches, 2)
+		require.NotEqual(t, runID, sink.batches[1][0].RunID)
+		require.Equal(t, int64(1), sink.batches[1][0].Seq)
+		require.Equal(t, "cleanup", sink.batches[1][0].Command)
+	})
+
+	t.Run("inserts full batches and retries", func(t *testing.T) {
+		t.Parallel()
+
+		sink := &fakeSink{failing: true}
+		x := NewExporter(context.Background(), sink)
+		x.Begin("mark", nil)
+		for i := 0; i < batchSize; i++ {
+			x.Handle(events.Event{Type: events.DiskProcessed, Time: now, ProjectID: "testing", Disk: disk, Action: "MARK"})
+		}
+		require.Empty(t, sink.batches)
+		sink.failing = false
+		x.Handle(events.Event{Type: events.DiskProcessed, Time: now, ProjectID: "testing", Disk: disk, Action: "MARK"})
+		require.NoError(t, x.Flush(context.Background()))
+		require.Len(t, sink.batches, 1)
+		require.Len(t, sink.batches[0], batchSize+1, "the failed rows are inserted with the next")
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+
+		var x *Exporter
+		x.Begin("mark", nil)
+		require.NoError(t, x.Flush(context.Background()))
+	})
+}
+
+func Test_BigQuery(t *testing.T) {
+	t.Parallel()
+
+	const tablePath = "/bigquery/v2/projects/inventory-project/datasets/inventory/tables"
+
+	for _, tt := range []struct {
+		name string
+		// existing are the columns of the existing table, nil if there is
+		// none
+		existing []string
+		expect   []string
+	}{
+		{name: "creates table", expect: []string{"POST " + tablePath}},
+		{name: "adds columns", existing: []string{"time", "runID", "disk"}, expect: []string{"PATCH " + tablePath + "/disks"}},
+		{name: "up to date", existing: columns()},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls []string
+			var table bigquery.Table
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					require.Equal(t, tablePath+"/disks", r.URL.Path)
+					if tt.existing == nil {
+						http.Error(w, `{"error":{"code":404,"message":"Not found: Table inventory-project:inventory.disks"}}`, http.StatusNotFound)
+						return
+					}
+					existing := &bigquery.Table{Schema: &bigquery.TableSchema{}}
+					for _, name := range tt.existing {
+						existing.Schema.Fields = append(existing.Schema.Fields, &bigquery.TableFieldSchema{Name: name, Type: "STRING"})
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(existing))
+					return
+				}
+				calls = append(calls, r.Method+" "+r.URL.Path)
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&table))
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer srv.Close()
+
+			_, err := NewBigQuery(context.Background(), "inventory-project:inventory.disks", option.WithEndpoint(srv.URL+"/bigquery/v2/"), option.WithoutAuthentication())
+			require.NoError(t, err)
+			require.Equal(t, tt.expect, calls)
+			if calls == nil {
+				return
+			}
+			var names []string
+			for _, f := range table.Schema.Fields {
+				names = append(names, f.Name)
+				if tt.existing != nil {
+					require.NotEqual(t, "REQUIRED", f.Mode, "%s added as required", f.Name)
+				}
+			}
+			require.ElementsMatch(t, columns(), names)
+			if tt.existing == nil {
+				require.Equal(t, "time", table.TimePartitioning.Field)
+			}
+		})
+	}
+
+	t.Run("insert", func(t *testing.T) {
+		t.Parallel()
+
+		var reject bool
+		var got bigquery.TableDataInsertAllRequest
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(`{}`))
+				return
+			}
+			if r.Method == http.MethodPatch {
+				_, _ = w.Write([]byte(`{}`))
+				return
+			}
+			require.Equal(t, tablePath+"/disks/insertAll", r.URL.Path)
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			if reject {
+				_, _ = w.Write([]byte(`{"insertErrors":[{"index":1,"errors":[{"message":"no such field: foo"}]}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		defer srv.Close()
+
+		opts := []option.ClientOption{option.WithEndpoint(srv.URL + "/bigquery/v2/"), option.WithoutAuthentication()}
+		sink, err := NewBigQuery(context.Background(), "inventory-project.inventory.disks", opts...)
+		require.NoError(t, err)
+		now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+		rows := []Row{
+			{Time: now, RunID: "run", Seq: 1, ProjectID: "testing", Disk: "a", Action: "MARK", Labels: []Label{{Key: "team", Value: "payments"}}},
+			{Time: now, RunID: "run", Seq: 2, ProjectID: "testing", Disk: "b", Action: "SKIP", Code: "WITHIN_CUTOFF"},
+		}
+		require.NoError(t, sink.Insert(context.Background(), rows))
+		require.Len(t, got.Rows, 2)
+		require.Equal(t, "run-1", got.Rows[0].InsertId)
+		require.Equal(t, "2022-03-01T10:00:00Z", got.Rows[0].Json["time"])
+		require.Equal(t, []interface{}{map[string]interface{}{"key": "team", "value": "payments"}}, got.Rows[0].Json["labels"])
+		require.NotContains(t, got.Rows[0].Json, "code")
+		require.Equal(t, "WITHIN_CUTOFF", got.Rows[1].Json["code"])
+
+		reject = true
+		err = sink.Insert(context.Background(), rows)
+		require.ErrorContains(t, err, "insert into inventory-project.inventory.disks: 1 of 2 rows rejected, e.g. row 1: no such field: foo")
+
+		for _, table := range []string{"inventory.disks", "a.b.c.d"} {
+			_, err := NewBigQuery(context.Background(), table, opts...)
+			require.ErrorContains(t, err, "invalid inventory table", table)
+		}
+	})
+}
+
+// columns returns the names of the columns of schema.
+func columns() []string {
+	names := make([]string, 0, len(schema))
+	for _, f := range schema {
+		names = append(names, f.Name)
+	}
+	return names
+}
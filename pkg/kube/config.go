@@ -0,0 +1,268 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// InClusterConfig returns the config for the cluster the process runs in,
+// authenticated as the pod's service account.
+func InClusterConfig() (*Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, xerrors.Errorf("not running in a cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, xerrors.Errorf("read service account CA: %w", err)
+	}
+	return &Config{
+		Server: "https://" + net.JoinHostPort(host, port),
+		CAData: ca,
+		// the projected token is rotated, so read it again for every request
+		TokenSource: fileTokenSource(filepath.Join(serviceAccountDir, "token")),
+	}, nil
+}
+
+// InClusterPod returns the namespace and name of the pod the process runs
+// in: $POD_NAMESPACE and $POD_NAME if set through the downward API, or else
+// the namespace of the pod's service account and the hostname.
+func InClusterPod() (namespace, name string, err error) {
+	namespace, name = os.Getenv("POD_NAMESPACE"), os.Getenv("POD_NAME")
+	if namespace == "" {
+		raw, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return "", "", xerrors.Errorf("read service account namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(raw))
+	}
+	if name == "" {
+		if name, err = os.Hostname(); err != nil {
+			return "", "", xerrors.Errorf("get pod name: %w", err)
+		}
+	}
+	return namespace, name, nil
+}
+
+// kubeconfig is the subset of a kubeconfig file used here.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+			AuthProvider          *struct {
+				Name string `yaml:"name"`
+			} `yaml:"auth-provider"`
+			Exec *execConfig `yaml:"exec"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+type execConfig struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Env     []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
+}
+
+// LoadKubeconfig returns the config for the current context of the kubeconfig
+// file at path. An empty path means $KUBECONFIG or ~/.kube/config.
+//
+// Besides static tokens and client certificates, exec credential plugins
+// such as gke-gcloud-auth-plugin are supported. The legacy "gcp" auth
+// provider uses application default credentials.
+func LoadKubeconfig(ctx context.Context, path string) (*Config, error) {
+	if path == "" {
+		path = defaultKubeconfigPath()
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read kubeconfig: %w", err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(raw, &kc); err != nil {
+		return nil, xerrors.Errorf("parse kubeconfig %s: %w", path, err)
+	}
+	// relative file references are relative to the kubeconfig itself
+	dir := filepath.Dir(path)
+
+	var clusterName, userName string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+			break
+		}
+	}
+	if !found {
+		return nil, xerrors.Errorf("kubeconfig %s: current context %q not found", path, kc.CurrentContext)
+	}
+
+	cfg := &Config{}
+	found = false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		cfg.Server = c.Cluster.Server
+		cfg.Insecure = c.Cluster.InsecureSkipTLSVerify
+		cfg.CAData, err = dataOrFile(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, dir)
+		if err != nil {
+			return nil, xerrors.Errorf("cluster %s: certificate authority: %w", clusterName, err)
+		}
+		break
+	}
+	if !found {
+		return nil, xerrors.Errorf("kubeconfig %s: cluster %q not found", path, clusterName)
+	}
+
+	found = false
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		found = true
+		user := u.User
+		cfg.ClientCertData, err = dataOrFile(user.ClientCertificateData, user.ClientCertificate, dir)
+		if err != nil {
+			return nil, xerrors.Errorf("user %s: client certificate: %w", userName, err)
+		}
+		cfg.ClientKeyData, err = dataOrFile(user.ClientKeyData, user.ClientKey, dir)
+		if err != nil {
+			return nil, xerrors.Errorf("user %s: client key: %w", userName, err)
+		}
+		switch {
+		case user.Token != "":
+			cfg.TokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: user.Token})
+		case user.TokenFile != "":
+			cfg.TokenSource = fileTokenSource(resolvePath(user.TokenFile, dir))
+		case user.Exec != nil:
+			cfg.TokenSource = oauth2.ReuseTokenSource(nil, &execTokenSource{ctx: ctx, cfg: *user.Exec})
+		case user.AuthProvider != nil && user.AuthProvider.Name == "gcp":
+			cfg.TokenSource, err = google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+			if err != nil {
+				return nil, xerrors.Errorf("user %s: application default credentials: %w", userName, err)
+			}
+		case user.AuthProvider != nil:
+			return nil, xerrors.Errorf("user %s: unsupported auth provider %q", userName, user.AuthProvider.Name)
+		}
+		break
+	}
+	if !found {
+		return nil, xerrors.Errorf("kubeconfig %s: user %q not found", path, userName)
+	}
+	return cfg, nil
+}
+
+func defaultKubeconfigPath() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		// only the first file of a list is used
+		return filepath.SplitList(env)[0]
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".kube", "config")
+}
+
+// dataOrFile returns the base64 decoded data, or the contents of file if
+// data is empty.
+func dataOrFile(data, file, dir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(resolvePath(file, dir))
+	}
+	return nil, nil
+}
+
+func resolvePath(path, dir string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// fileTokenSource reads the token from a file on every call.
+type fileTokenSource string
+
+func (f fileTokenSource) Token() (*oauth2.Token, error) {
+	raw, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, xerrors.Errorf("read token file: %w", err)
+	}
+	return &oauth2.Token{AccessToken: strings.TrimSpace(string(raw))}, nil
+}
+
+// execTokenSource runs a client-go exec credential plugin.
+type execTokenSource struct {
+	ctx context.Context
+	cfg execConfig
+}
+
+func (e *execTokenSource) Token() (*oauth2.Token, error) {
+	cmd := exec.CommandContext(e.ctx, e.cfg.Command, e.cfg.Args...)
+	cmd.Env = os.Environ()
+	for _, env := range e.cfg.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	cmd.Env = append(cmd.Env, `KUBERNETES_EXEC_INFO={"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","spec":{"interactive":false}}`)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, xerrors.Errorf("run credential plugin %s: %w: %s", e.cfg.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	var cred struct {
+		Status struct {
+			Token               string    `json:"token"`
+			ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &cred); err != nil {
+		return nil, xerrors.Errorf("parse credential plugin %s output: %w", e.cfg.Command, err)
+	}
+	if cred.Status.Token == "" {
+		return nil, xerrors.Errorf("credential plugin %s returned no token", e.cfg.Command)
+	}
+	return &oauth2.Token{AccessToken: cred.Status.Token, Expiry: cred.Status.ExpirationTimestamp}, nil
+}
@@ -0,0 +1,84 @@
+package kube
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadKubeconfig(t *testing.T) {
+	t.Parallel()
+
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "config")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("token", func(t *testing.T) {
+		t.Parallel()
+		path := write(t, `
+current-context: prod
+clusters:
+- name: staging
+  cluster:
+    server: https://staging.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com
+    insecure-skip-tls-verify: true
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+users:
+- name: admin
+  user:
+    token: secret
+`)
+		cfg, err := LoadKubeconfig(context.Background(), path)
+		require.NoError(t, err)
+		require.Equal(t, "https://prod.example.com", cfg.Server)
+		require.True(t, cfg.Insecure)
+		tok, err := cfg.TokenSource.Token()
+		require.NoError(t, err)
+		require.Equal(t, "secret", tok.AccessToken)
+	})
+
+	t.Run("relative token file", func(t *testing.T) {
+		t.Parallel()
+		path := write(t, `
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+    certificate-authority-data: bm90IGEgcmVhbCBjZXJ0
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev}
+users:
+- name: dev
+  user:
+    tokenFile: token
+`)
+		require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(path), "token"), []byte("from-file\n"), 0o600))
+		cfg, err := LoadKubeconfig(context.Background(), path)
+		require.NoError(t, err)
+		require.Equal(t, []byte("not a real cert"), cfg.CAData)
+		tok, err := cfg.TokenSource.Token()
+		require.NoError(t, err)
+		require.Equal(t, "from-file", tok.AccessToken)
+	})
+
+	t.Run("missing context", func(t *testing.T) {
+		t.Parallel()
+		path := write(t, "current-context: nope\n")
+		_, err := LoadKubeconfig(context.Background(), path)
+		require.EqualError(t, err, "kubeconfig "+path+`: current context "nope" not found`)
+	})
+}
@@ -0,0 +1,230 @@
+// Package kube is a minimal client for the Kubernetes API. It lists
+// PersistentVolumes, to avoid marking disks that still back a volume in a
+// cluster, looks up the disk behind a claim, and reports the outcome of runs on the object that owns the pod
+// they run in.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/xerrors"
+)
+
+// CSIDriverGCEPD is the CSI driver that provisions GCE persistent disks.
+const CSIDriverGCEPD = "pd.csi.storage.gke.io"
+
+// PersistentVolume is the subset of a Kubernetes PersistentVolume used here.
+type PersistentVolume struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		ClaimRef *struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"claimRef"`
+		GCEPersistentDisk *struct {
+			PDName string `json:"pdName"`
+		} `json:"gcePersistentDisk"`
+		CSI *struct {
+			Driver       string `json:"driver"`
+			VolumeHandle string `json:"volumeHandle"`
+		} `json:"csi"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// Claim returns the namespace/name of the claim bound to pv, or an empty
+// string if there is none.
+func (pv PersistentVolume) Claim() string {
+	ref := pv.Spec.ClaimRef
+	if ref == nil {
+		return ""
+	}
+	return ref.Namespace + "/" + ref.Name
+}
+
+// DiskID returns the GCE disk backing pv: the pdName of an in-tree volume or
+// the volume handle (projects/p/zones/z/disks/d) of a PD CSI volume. It
+// returns an empty string for volumes not backed by a GCE disk.
+func (pv PersistentVolume) DiskID() string {
+	if pd := pv.Spec.GCEPersistentDisk; pd != nil {
+		return pd.PDName
+	}
+	if csi := pv.Spec.CSI; csi != nil && csi.Driver == CSIDriverGCEPD {
+		return csi.VolumeHandle
+	}
+	return ""
+}
+
+// PersistentVolumeClaim is the subset of a Kubernetes PersistentVolumeClaim
+// used here.
+type PersistentVolumeClaim struct {
+	Spec struct {
+		// VolumeName is the PersistentVolume bound to the claim, empty
+		// while it is pending.
+		VolumeName string `json:"volumeName"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+type persistentVolumeList struct {
+	Metadata struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+	Items []PersistentVolume `json:"items"`
+}
+
+// Config holds what is needed to connect to a cluster.
+type Config struct {
+	// Server is the API server URL, e.g. https://10.0.0.1.
+	Server string
+	// CAData is the PEM encoded CA bundle of the API server. The system
+	// roots are used when empty.
+	CAData []byte
+	// ClientCertData and ClientKeyData are an optional PEM encoded client
+	// certificate.
+	ClientCertData []byte
+	ClientKeyData  []byte
+	// TokenSource provides bearer tokens, may be nil.
+	TokenSource oauth2.TokenSource
+	// Insecure skips verification of the server certificate.
+	Insecure bool
+}
+
+// Client lists objects from the Kubernetes API.
+type Client struct {
+	server string
+	http   *http.Client
+}
+
+// pageSize is the number of volumes requested per list call.
+const pageSize = 500
+
+// NewClient returns a Client for cfg.
+func NewClient(cfg *Config) (*Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+	if len(cfg.CAData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cfg.CAData) {
+			return nil, xerrors.Errorf("no certificates found in cluster CA data")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(cfg.ClientCertData) > 0 {
+		cert, err := tls.X509KeyPair(cfg.ClientCertData, cfg.ClientKeyData)
+		if err != nil {
+			return nil, xerrors.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	if cfg.TokenSource != nil {
+		transport = &oauth2.Transport{Source: cfg.TokenSource, Base: transport}
+	}
+	return &Client{
+		server: strings.TrimSuffix(cfg.Server, "/"),
+		http:   &http.Client{Transport: transport, Timeout: time.Minute},
+	}, nil
+}
+
+// ListPersistentVolumes returns all PersistentVolumes in the cluster.
+func (c *Client) ListPersistentVolumes(ctx context.Context) ([]PersistentVolume, error) {
+	var pvs []PersistentVolume
+	var cont string
+	for {
+		q := url.Values{"limit": {strconv.Itoa(pageSize)}}
+		if cont != "" {
+			q.Set("continue", cont)
+		}
+		var list persistentVolumeList
+		if err := c.get(ctx, "/api/v1/persistentvolumes?"+q.Encode(), &list); err != nil {
+			return nil, xerrors.Errorf("list persistent volumes: %w", err)
+		}
+		pvs = append(pvs, list.Items...)
+		cont = list.Metadata.Continue
+		if cont == "" {
+			return pvs, nil
+		}
+	}
+}
+
+// GetPersistentVolume returns the PersistentVolume name.
+func (c *Client) GetPersistentVolume(ctx context.Context, name string) (PersistentVolume, error) {
+	var pv PersistentVolume
+	if err := c.get(ctx, "/api/v1/persistentvolumes/"+url.PathEscape(name), &pv); err != nil {
+		return PersistentVolume{}, xerrors.Errorf("get persistent volume %s: %w", name, err)
+	}
+	return pv, nil
+}
+
+// GetPersistentVolumeClaim returns the PersistentVolumeClaim name in
+// namespace.
+func (c *Client) GetPersistentVolumeClaim(ctx context.Context, namespace, name string) (PersistentVolumeClaim, error) {
+	var pvc PersistentVolumeClaim
+	path := "/api/v1/namespaces/" + url.PathEscape(namespace) + "/persistentvolumeclaims/" + url.PathEscape(name)
+	if err := c.get(ctx, path, &pvc); err != nil {
+		return PersistentVolumeClaim{}, xerrors.Errorf("get persistent volume claim %s/%s: %w", namespace, name, err)
+	}
+	return pvc, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	return c.do(ctx, http.MethodGet, path, "", nil, v)
+}
+
+// do sends body, if not nil, encoded as JSON with contentType and decodes
+// the response into v, if not nil.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body, v interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// the API server returns a Status object describing the error
+		var status struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&status)
+		return xerrors.Errorf("unexpected status %s: %s", resp.Status, status.Message)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,94 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func Test_ListPersistentVolumes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("paginated", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/api/v1/persistentvolumes", r.URL.Path)
+			require.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+			if r.URL.Query().Get("continue") == "" {
+				fmt.Fprint(w, `{"metadata":{"continue":"page-2"},"items":[
+					{"metadata":{"name":"pv-a"},"spec":{"claimRef":{"namespace":"default","name":"data"},"gcePersistentDisk":{"pdName":"gke-disk-a"}},"status":{"phase":"Bound"}}
+				]}`)
+				return
+			}
+			fmt.Fprint(w, `{"metadata":{},"items":[
+				{"metadata":{"name":"pv-b"},"spec":{"csi":{"driver":"pd.csi.storage.gke.io","volumeHandle":"projects/p/zones/z/disks/disk-b"}},"status":{"phase":"Available"}},
+				{"metadata":{"name":"pv-c"},"spec":{"csi":{"driver":"filestore.csi.storage.gke.io","volumeHandle":"modeInstance/z/nfs/vol"}}}
+			]}`)
+		}))
+		t.Cleanup(srv.Close)
+
+		client, err := NewClient(&Config{Server: srv.URL, TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"})})
+		require.NoError(t, err)
+		pvs, err := client.ListPersistentVolumes(context.Background())
+		require.NoError(t, err)
+		require.Len(t, pvs, 3)
+
+		require.Equal(t, "pv-a", pvs[0].Metadata.Name)
+		require.Equal(t, "gke-disk-a", pvs[0].DiskID())
+		require.Equal(t, "default/data", pvs[0].Claim())
+		require.Equal(t, "projects/p/zones/z/disks/disk-b", pvs[1].DiskID())
+		require.Empty(t, pvs[1].Claim())
+		require.Empty(t, pvs[2].DiskID())
+	})
+
+	t.Run("forbidden", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"kind":"Status","message":"persistentvolumes is forbidden"}`)
+		}))
+		t.Cleanup(srv.Close)
+
+		client, err := NewClient(&Config{Server: srv.URL})
+		require.NoError(t, err)
+		_, err = client.ListPersistentVolumes(context.Background())
+		require.EqualError(t, err, "list persistent volumes: unexpected status 403 Forbidden: persistentvolumes is forbidden")
+	})
+}
+
+func Test_GetPersistentVolumeClaim(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/team-a/persistentvolumeclaims/data":
+			fmt.Fprint(w, `{"spec":{"volumeName":"pvc-0b5e"},"status":{"phase":"Bound"}}`)
+		case "/api/v1/persistentvolumes/pvc-0b5e":
+			fmt.Fprint(w, `{"metadata":{"name":"pvc-0b5e"},"spec":{"claimRef":{"namespace":"team-a","name":"data"},"csi":{"driver":"pd.csi.storage.gke.io","volumeHandle":"projects/p/zones/z/disks/pvc-0b5e"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","message":"persistentvolumeclaims \"missing\" not found"}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(&Config{Server: srv.URL})
+	require.NoError(t, err)
+	pvc, err := client.GetPersistentVolumeClaim(context.Background(), "team-a", "data")
+	require.NoError(t, err)
+	require.Equal(t, "pvc-0b5e", pvc.Spec.VolumeName)
+	require.Equal(t, "Bound", pvc.Status.Phase)
+
+	pv, err := client.GetPersistentVolume(context.Background(), pvc.Spec.VolumeName)
+	require.NoError(t, err)
+	require.Equal(t, "projects/p/zones/z/disks/pvc-0b5e", pv.DiskID())
+	require.Equal(t, "team-a/data", pv.Claim())
+
+	_, err = client.GetPersistentVolumeClaim(context.Background(), "team-a", "missing")
+	require.EqualError(t, err, `get persistent volume claim team-a/missing: unexpected status 404 Not Found: persistentvolumeclaims "missing" not found`)
+}
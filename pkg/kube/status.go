@@ -0,0 +1,134 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// maxOwnerDepth bounds the owner references followed by Owner, e.g. Pod,
+// Job, CronJob.
+const maxOwnerDepth = 5
+
+// ObjectReference identifies a namespaced object.
+type ObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	UID        string `json:"uid,omitempty"`
+}
+
+func (r ObjectReference) String() string {
+	return r.Kind + " " + r.Namespace + "/" + r.Name
+}
+
+// path returns the API path of r. Only resources whose plural is the kind
+// with an s appended are supported, which covers pods and the workloads
+// owning them.
+func (r ObjectReference) path() string {
+	group := "/apis/" + r.APIVersion
+	if r.APIVersion == "v1" {
+		group = "/api/v1"
+	}
+	return group + "/namespaces/" + url.PathEscape(r.Namespace) + "/" + strings.ToLower(r.Kind) + "s/" + url.PathEscape(r.Name)
+}
+
+type objectMetadata struct {
+	Metadata struct {
+		UID             string `json:"uid"`
+		OwnerReferences []struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Name       string `json:"name"`
+			Controller bool   `json:"controller"`
+		} `json:"ownerReferences"`
+	} `json:"metadata"`
+}
+
+// Owner returns the top-level controller of the pod, e.g. the CronJob of its
+// Job or the Deployment of its ReplicaSet, or the pod itself if it has no
+// controller.
+func (c *Client) Owner(ctx context.Context, namespace, pod string) (ObjectReference, error) {
+	ref := ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: namespace, Name: pod}
+	for i := 0; i < maxOwnerDepth; i++ {
+		var obj objectMetadata
+		if err := c.get(ctx, ref.path(), &obj); err != nil {
+			return ObjectReference{}, xerrors.Errorf("get %s: %w", ref, err)
+		}
+		ref.UID = obj.Metadata.UID
+		var owner *ObjectReference
+		for _, o := range obj.Metadata.OwnerReferences {
+			if o.Controller {
+				owner = &ObjectReference{APIVersion: o.APIVersion, Kind: o.Kind, Namespace: namespace, Name: o.Name}
+				break
+			}
+		}
+		if owner == nil {
+			return ref, nil
+		}
+		ref = *owner
+	}
+	return ref, nil
+}
+
+// Annotate sets annotations on the object ref, keeping its other
+// annotations.
+func (c *Client) Annotate(ctx context.Context, ref ObjectReference, annotations map[string]string) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	}
+	if err := c.do(ctx, http.MethodPatch, ref.path(), "application/merge-patch+json", patch, nil); err != nil {
+		return xerrors.Errorf("annotate %s: %w", ref, err)
+	}
+	return nil
+}
+
+// Event types.
+const (
+	EventNormal  = "Normal"
+	EventWarning = "Warning"
+)
+
+// Event is a Kubernetes Event about an object, as shown by kubectl describe.
+type Event struct {
+	Object ObjectReference
+	// Type is EventNormal or EventWarning.
+	Type string
+	// Reason is a short CamelCase reason, e.g. RunSucceeded.
+	Reason  string
+	Message string
+	// Component is the source of the event.
+	Component string
+	Time      time.Time
+}
+
+// CreateEvent records e in the namespace of its object.
+func (c *Client) CreateEvent(ctx context.Context, e Event) error {
+	ts := e.Time.UTC().Format(time.RFC3339)
+	body := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata": map[string]interface{}{
+			"generateName": strings.ToLower(e.Object.Name) + ".",
+			"namespace":    e.Object.Namespace,
+		},
+		"involvedObject": e.Object,
+		"type":           e.Type,
+		"reason":         e.Reason,
+		"message":        e.Message,
+		"source":         map[string]string{"component": e.Component},
+		"firstTimestamp": ts,
+		"lastTimestamp":  ts,
+		"count":          1,
+	}
+	path := "/api/v1/namespaces/" + url.PathEscape(e.Object.Namespace) + "/events"
+	if err := c.do(ctx, http.MethodPost, path, "application/json", body, nil); err != nil {
+		return xerrors.Errorf("create event for %s: %w", e.Object, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Owner(t *testing.T) {
+	t.Parallel()
+
+	objects := map[string]string{
+		"/api/v1/namespaces/ops/pods/cleanup-28000-abcde":  `{"metadata":{"uid":"pod-uid","ownerReferences":[{"apiVersion":"batch/v1","kind":"Job","name":"cleanup-28000","controller":true}]}}`,
+		"/apis/batch/v1/namespaces/ops/jobs/cleanup-28000": `{"metadata":{"uid":"job-uid","ownerReferences":[{"apiVersion":"batch/v1","kind":"CronJob","name":"cleanup","controller":true}]}}`,
+		"/apis/batch/v1/namespaces/ops/cronjobs/cleanup":   `{"metadata":{"uid":"cronjob-uid"}}`,
+		"/api/v1/namespaces/ops/pods/standalone":           `{"metadata":{"uid":"standalone-uid","ownerReferences":[{"apiVersion":"v1","kind":"Node","name":"node-1"}]}}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		obj, ok := objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"kind":"Status","message":"%s not found"}`, r.URL.Path)
+			return
+		}
+		fmt.Fprint(w, obj)
+	}))
+	t.Cleanup(srv.Close)
+	client, err := NewClient(&Config{Server: srv.URL})
+	require.NoError(t, err)
+
+	t.Run("cronjob", func(t *testing.T) {
+		t.Parallel()
+		owner, err := client.Owner(context.Background(), "ops", "cleanup-28000-abcde")
+		require.NoError(t, err)
+		require.Equal(t, ObjectReference{APIVersion: "batch/v1", Kind: "CronJob", Namespace: "ops", Name: "cleanup", UID: "cronjob-uid"}, owner)
+	})
+
+	t.Run("no controller", func(t *testing.T) {
+		t.Parallel()
+		owner, err := client.Owner(context.Background(), "ops", "standalone")
+		require.NoError(t, err)
+		require.Equal(t, ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "ops", Name: "standalone", UID: "standalone-uid"}, owner)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		t.Parallel()
+		_, err := client.Owner(context.Background(), "ops", "gone")
+		require.EqualError(t, err, "get Pod ops/gone: unexpected status 404 Not Found: /api/v1/namespaces/ops/pods/gone not found")
+	})
+}
+
+func Test_ReportStatus(t *testing.T) {
+	t.Parallel()
+
+	cronJob := ObjectReference{APIVersion: "batch/v1", Kind: "CronJob", Namespace: "ops", Name: "cleanup", UID: "cronjob-uid"}
+
+	t.Run("annotate", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPatch, r.Method)
+			require.Equal(t, "/apis/batch/v1/namespaces/ops/cronjobs/cleanup", r.URL.Path)
+			require.Equal(t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+			var patch map[string]map[string]map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+			require.Equal(t, map[string]string{"example.com/last-run": "{}"}, patch["metadata"]["annotations"])
+			fmt.Fprint(w, `{}`)
+		}))
+		t.Cleanup(srv.Close)
+		client, err := NewClient(&Config{Server: srv.URL})
+		require.NoError(t, err)
+		require.NoError(t, client.Annotate(context.Background(), cronJob, map[string]string{"example.com/last-run": "{}"}))
+	})
+
+	t.Run("event", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "/api/v1/namespaces/ops/events", r.URL.Path)
+			var event struct {
+				Metadata struct {
+					GenerateName string `json:"generateName"`
+				} `json:"metadata"`
+				InvolvedObject ObjectReference `json:"involvedObject"`
+				Type           string          `json:"type"`
+				Reason         string          `json:"reason"`
+				Message        string          `json:"message"`
+				LastTimestamp  string          `json:"lastTimestamp"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+			require.Equal(t, "cleanup.", event.Metadata.GenerateName)
+			require.Equal(t, cronJob, event.InvolvedObject)
+			require.Equal(t, EventWarning, event.Type)
+			require.Equal(t, "RunFailed", event.Reason)
+			require.Equal(t, "cleanup failed", event.Message)
+			require.Equal(t, "2022-03-01T12:00:00Z", event.LastTimestamp)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{}`)
+		}))
+		t.Cleanup(srv.Close)
+		client, err := NewClient(&Config{Server: srv.URL})
+		require.NoError(t, err)
+		require.NoError(t, client.CreateEvent(context.Background(), Event{
+			Object:    cronJob,
+			Type:      EventWarning,
+			Reason:    "RunFailed",
+			Message:   "cleanup failed",
+			Component: "gke-disk-cleanup",
+			Time:      time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC),
+		}))
+	})
+}
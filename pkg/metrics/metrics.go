@@ -0,0 +1,225 @@
+// Package metrics exposes what the engine did as Prometheus metrics. It
+// subscribes to the event bus like the other outputs and writes the
+// Prometheus text format itself, as only counters and gauges are needed.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+// Prefix is the common prefix of all metric names.
+const Prefix = "gke_disk_cleanup_"
+
+// contentType is the Prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	counter = "counter"
+	gauge   = "gauge"
+)
+
+// family is a metric with all its label combinations.
+type family struct {
+	name string
+	help string
+	typ  string
+	// values is keyed by the rendered labels, e.g. {project="p"}.
+	values map[string]float64
+}
+
+// Metric names, without Prefix.
+const (
+	disksScanned     = "disks_scanned_total"
+	disksMarked      = "disks_marked_total"
+	disksUnmarked    = "disks_unmarked_total"
+	disksDeleted     = "disks_deleted_total"
+	snapshotsCreated = "snapshots_created_total"
+	snapshotBytes    = "snapshot_bytes_total"
+	errorsTotal      = "errors_total"
+	runDuration      = "run_duration_seconds"
+	runLastTime      = "run_last_timestamp_seconds"
+	runSuccess       = "run_success"
+	deletionRate     = "deletion_rate_limit_per_hour"
+	paceWait         = "pace_wait_seconds_total"
+)
+
+// Registry holds the metrics of the current process. It is safe for
+// concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	byName   map[string]*family
+}
+
+// NewRegistry returns a Registry with all metrics at zero.
+func NewRegistry() *Registry {
+	r := &Registry{byName: make(map[string]*family)}
+	r.register(disksScanned, counter, "Disks processed by mark or cleanup.")
+	r.register(disksMarked, counter, "Disks labelled for deletion.")
+	r.register(disksUnmarked, counter, "Disks whose deletion mark was removed.")
+	r.register(disksDeleted, counter, "Disks deleted.")
+	r.register(snapshotsCreated, counter, "Snapshots taken before deleting a disk.")
+	r.register(snapshotBytes, counter, "Size of the disks snapshotted before deletion in bytes, an upper bound for the snapshot storage.")
+	r.register(errorsTotal, counter, "Disks or snapshots that could not be processed, by error code, e.g. API.")
+	r.register(runDuration, gauge, "Duration of the last mark or cleanup run in seconds.")
+	r.register(runLastTime, gauge, "Unix time the last mark or cleanup run ended.")
+	r.register(runSuccess, gauge, "Whether the last mark or cleanup run succeeded (1) or failed (0).")
+	r.register(deletionRate, gauge, "Maximum number of disks soak deletes per hour.")
+	r.register(paceWait, counter, "Time spent waiting to delete the next disk at the soak rate in seconds.")
+	return r
+}
+
+func (r *Registry) register(name, typ, help string) {
+	f := &family{name: Prefix + name, help: help, typ: typ, values: make(map[string]float64)}
+	r.families = append(r.families, f)
+	r.byName[name] = f
+}
+
+// labels renders label pairs, given as name, value, ..., in the text format.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", pairs[i], labelEscaper.Replace(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelEscaper escapes label values as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (r *Registry) add(name, labels string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byName[name].values[labels] += v
+}
+
+func (r *Registry) set(name, labels string, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byName[name].values[labels] = v
+}
+
+// Handle counts engine events. Changes are only counted when they were
+// carried out, i.e. not in dry run mode.
+func (r *Registry) Handle(e events.Event) {
+	diskLabels := labels("project", e.ProjectID, "cluster", cleanup.Cluster(e.Disk))
+	switch e.Type {
+	case events.DiskProcessed:
+		r.add(disksScanned, diskLabels, 1)
+	case events.DiskMarked:
+		r.add(disksMarked, diskLabels, 1)
+	case events.DiskUnmarked:
+		r.add(disksUnmarked, diskLabels, 1)
+	case events.DiskDeleted:
+		r.add(disksDeleted, diskLabels, 1)
+	case events.SnapshotCreated:
+		r.add(snapshotsCreated, diskLabels, 1)
+		r.add(snapshotBytes, diskLabels, float64(e.Disk.GetSizeGb())*(1<<30))
+	case events.Error:
+		r.add(errorsTotal, labels("project", e.ProjectID, "code", string(diskerr.CodeOf(e.Err))), 1)
+	}
+}
+
+// ObserveRun records that a run of command took duration and ended with
+// err.
+func (r *Registry) ObserveRun(command string, duration time.Duration, err error) {
+	l := labels("command", command)
+	r.set(runDuration, l, duration.Seconds())
+	r.set(runLastTime, l, float64(time.Now().Unix()))
+	success := 1.0
+	if err != nil {
+		success = 0
+	}
+	r.set(runSuccess, l, success)
+}
+
+// SetDeletionRate records the maximum number of disks deleted per hour.
+func (r *Registry) SetDeletionRate(perHour int) {
+	r.set(deletionRate, "", float64(perHour))
+}
+
+// Pace returns p, recording the time spent waiting on it.
+func (r *Registry) Pace(p cleanup.Pacer) cleanup.Pacer {
+	return meteredPacer{pacer: p, r: r}
+}
+
+type meteredPacer struct {
+	pacer cleanup.Pacer
+	r     *Registry
+}
+
+func (p meteredPacer) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := p.pacer.Wait(ctx)
+	p.r.add(paceWait, "", time.Since(start).Seconds())
+	return err
+}
+
+// WriteTo writes all metrics to w in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	var b bytes.Buffer
+	for _, f := range r.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		keys := make([]string, 0, len(f.values))
+		for k := range f.values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s%s %g\n", f.name, k, f.values[k])
+		}
+	}
+	r.mu.Unlock()
+	return b.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics for scraping.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	_, _ = r.WriteTo(w)
+}
+
+// Push replaces the metrics of job on the Prometheus Pushgateway at pushURL,
+// e.g. at the end of a one-shot run.
+func (r *Registry) Push(ctx context.Context, pushURL, job string) error {
+	var b bytes.Buffer
+	if _, err := r.WriteTo(&b); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(pushURL, "/")+"/metrics/job/"+url.PathEscape(job), &b)
+	if err != nil {
+		return xerrors.Errorf("push metrics: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return xerrors.Errorf("push metrics: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+	"gke-disk-cleanup/pkg/events"
+)
+
+func Test_Registry(t *testing.T) {
+	t.Parallel()
+
+	disk := &computepb.Disk{
+		Name:   pointer.String("test-disk"),
+		SizeGb: pointer.Int64(10),
+		Labels: map[string]string{cleanup.LabelClusterName: "prod"},
+	}
+	r := NewRegistry()
+	r.Handle(events.Event{Type: events.DiskProcessed, ProjectID: "testing", Disk: disk})
+	r.Handle(events.Event{Type: events.DiskProcessed, ProjectID: "testing", Disk: disk})
+	r.Handle(events.Event{Type: events.SnapshotCreated, ProjectID: "testing", Disk: disk})
+	r.Handle(events.Event{Type: events.DiskDeleted, ProjectID: "testing", Disk: disk})
+	r.Handle(events.Event{Type: events.Error, ProjectID: "testing", Disk: disk, Err: diskerr.Wrap(diskerr.CodeAPI, xerrors.New("boom"), "failed")})
+	r.ObserveRun("cleanup", 90*time.Second, nil)
+	r.ObserveRun("mark", time.Second, xerrors.New("boom"))
+	r.SetDeletionRate(10)
+	require.NoError(t, r.Pace(cleanup.NewRate(10, time.Hour)).Wait(context.Background()))
+
+	var b bytes.Buffer
+	_, err := r.WriteTo(&b)
+	require.NoError(t, err)
+	out := b.String()
+	require.Contains(t, out, "# TYPE gke_disk_cleanup_disks_scanned_total counter\n")
+	require.Contains(t, out, `gke_disk_cleanup_disks_scanned_total{project="testing",cluster="prod"} 2`+"\n")
+	require.Contains(t, out, `gke_disk_cleanup_disks_deleted_total{project="testing",cluster="prod"} 1`+"\n")
+	require.Contains(t, out, `gke_disk_cleanup_snapshot_bytes_total{project="testing",cluster="prod"} 1.073741824e+10`+"\n")
+	require.Contains(t, out, `gke_disk_cleanup_errors_total{project="testing",code="API"} 1`+"\n")
+	require.Contains(t, out, `gke_disk_cleanup_run_duration_seconds{command="cleanup"} 90`+"\n")
+	require.Contains(t, out, `gke_disk_cleanup_run_success{command="cleanup"} 1`+"\n")
+	require.Contains(t, out, `gke_disk_cleanup_run_success{command="mark"} 0`+"\n")
+	require.Contains(t, out, "gke_disk_cleanup_deletion_rate_limit_per_hour 10\n")
+	require.Contains(t, out, "gke_disk_cleanup_pace_wait_seconds_total ")
+	// metrics without values are still described
+	require.Contains(t, out, "# HELP gke_disk_cleanup_disks_marked_total ")
+	require.NotContains(t, out, "gke_disk_cleanup_disks_marked_total{")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, contentType, rec.Header().Get("Content-Type"))
+	require.Equal(t, out, rec.Body.String())
+}
+
+func Test_Labels(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, `{a="x",b="q\"\\\n"}`, labels("a", "x", "b", "q\"\\\n"))
+}
+
+func Test_Push(t *testing.T) {
+	t.Parallel()
+
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, http.MethodPut, req.Method)
+		if req.URL.Path != "/metrics/job/gke-disk-cleanup" {
+			http.Error(w, "unknown job", http.StatusBadRequest)
+			return
+		}
+		body, _ = io.ReadAll(req.Body)
+	}))
+	defer srv.Close()
+
+	r := NewRegistry()
+	require.NoError(t, r.Push(context.Background(), srv.URL+"/", "gke-disk-cleanup"))
+	require.Contains(t, string(body), "# TYPE gke_disk_cleanup_run_success gauge")
+
+	err := r.Push(context.Background(), srv.URL, "other job")
+	require.ErrorContains(t, err, "push metrics: 400 Bad Request: unknown job")
+}
@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"path"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/parser"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// Expression is a cleanup.MarkPolicy that marks the disks for which a CEL
+// expression, see https://github.com/google/cel-spec, is true, e.g.
+//
+//	disk.sizeGb > 100 && ageDays(disk.lastUsed) > 14 && !('keep' in disk.labels)
+//
+// The expression sees the disk as the map disk, see activation, and the time
+// of the run as now. ageDays(t) is how many whole days ago the timestamp t
+// was.
+type Expression struct {
+	source  string
+	program cel.Program
+}
+
+// ageDays expands ageDays(t) to (now - t).getHours() / 24.
+var ageDays = parser.NewGlobalMacro("ageDays", 1, func(eh parser.ExprHelper, _ *exprpb.Expr, args []*exprpb.Expr) (*exprpb.Expr, *common.Error) {
+	age := eh.GlobalCall(operators.Subtract, eh.Ident("now"), args[0])
+	return eh.GlobalCall(operators.Divide, eh.ReceiverCall("getHours", age), eh.LiteralInt(24)), nil
+})
+
+var expressionEnv = func() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Declarations(
+			decls.NewVar("disk", decls.NewMapType(decls.String, decls.Dyn)),
+			decls.NewVar("now", decls.Timestamp),
+		),
+		cel.Macros(ageDays),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}()
+
+// CompileExpression compiles source, which must evaluate to a bool.
+func CompileExpression(source string) (*Expression, error) {
+	ast, issues := expressionEnv.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, xerrors.Errorf("invalid expression: %w", issues.Err())
+	}
+	if t := ast.ResultType(); t.GetPrimitive() != exprpb.Type_BOOL && t.GetDyn() == nil {
+		return nil, xerrors.Errorf("invalid expression: evaluates to %v, expected a bool", t)
+	}
+	program, err := expressionEnv.Program(ast)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid expression: %w", err)
+	}
+	return &Expression{source: source, program: program}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Evaluate marks the disk if the expression is true for it. A disk the
+// expression fails for, e.g. as it reads a timestamp the disk does not have,
+// is kept.
+func (e *Expression) Evaluate(c cleanup.Candidate) cleanup.Action {
+	out, _, err := e.program.Eval(activation(c))
+	if err != nil {
+		log.Warn().Err(err).Str("disk", c.Disk.GetName()).Str("expression", e.source).Msg("unable to evaluate mark policy expression, keeping disk")
+		return cleanup.ActionSkip
+	}
+	if marked, ok := out.Value().(bool); ok && marked {
+		return cleanup.ActionMark
+	}
+	return cleanup.ActionSkip
+}
+
+// activation returns the variables of the expression for c. The timestamps
+// of the disk are only set if the disk has them.
+func activation(c cleanup.Candidate) map[string]interface{} {
+	disk := c.Disk
+	labels := disk.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	claim := cleanup.ClaimOf(disk)
+	vars := map[string]interface{}{
+		"name":       disk.GetName(),
+		"zone":       path.Base(disk.GetZone()),
+		"type":       path.Base(disk.GetType()),
+		"sizeGb":     disk.GetSizeGb(),
+		"labels":     labels,
+		"source":     string(cleanup.DiskSource(disk)),
+		"cluster":    cleanup.Cluster(disk),
+		"namespace":  claim.Namespace,
+		"pvc":        claim.Name,
+		"users":      disk.GetUsers(),
+		"lastUsed":   c.LastUsed,
+		"cutoffDays": int64(c.Cutoff / (24 * time.Hour)),
+	}
+	for name, value := range map[string]string{
+		"creationTimestamp": disk.GetCreationTimestamp(),
+		"lastAttach":        disk.GetLastAttachTimestamp(),
+		"lastDetach":        disk.GetLastDetachTimestamp(),
+	} {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			vars[name] = t
+		}
+	}
+	return map[string]interface{}{"disk": vars, "now": c.Now}
+}
@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+func Test_Expression(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	candidate := cleanup.Candidate{
+		Disk: &computepb.Disk{
+			Name:                pointer.String("pvc-0b5e"),
+			Zone:                pointer.String("https://www.googleapis.com/compute/v1/projects/p/zones/us-east1-b"),
+			SizeGb:              pointer.Int64(200),
+			Labels:              map[string]string{"env": "dev"},
+			CreationTimestamp:   pointer.String(now.AddDate(0, 0, -100).Format(time.RFC3339)),
+			LastAttachTimestamp: pointer.String(now.AddDate(0, 0, -20).Format(time.RFC3339)),
+			Description:         pointer.String(`{"kubernetes.io/created-for/pvc/namespace":"ci-1234","kubernetes.io/created-for/pvc/name":"data"}`),
+		},
+		LastUsed: now.AddDate(0, 0, -20),
+		Cutoff:   30 * 24 * time.Hour,
+		Now:      now,
+	}
+	tests := []struct {
+		expression string
+		expected   cleanup.Action
+	}{
+		{`disk.sizeGb > 100 && ageDays(disk.lastAttach) > 14 && !('keep' in disk.labels)`, cleanup.ActionMark},
+		{`ageDays(disk.lastUsed) >= disk.cutoffDays`, cleanup.ActionSkip},
+		{`ageDays(disk.creationTimestamp) == 100 && disk.zone == 'us-east1-b'`, cleanup.ActionMark},
+		{`disk.namespace.startsWith('ci-') && disk.pvc == 'data'`, cleanup.ActionMark},
+		{`disk.labels.env == 'prod'`, cleanup.ActionSkip},
+		// the disk was never detached
+		{`ageDays(disk.lastDetach) > 1`, cleanup.ActionSkip},
+		{`has(disk.lastDetach) || size(disk.users) == 0`, cleanup.ActionMark},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.expression, func(t *testing.T) {
+			t.Parallel()
+			e, err := CompileExpression(tt.expression)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, e.Evaluate(candidate))
+		})
+	}
+
+	_, err := CompileExpression(`disk.sizeGb >`)
+	require.ErrorContains(t, err, "invalid expression")
+	_, err = CompileExpression(`ageDays(now)`)
+	require.ErrorContains(t, err, "expected a bool")
+	_, err = CompileExpression(`size > 1`)
+	require.ErrorContains(t, err, "undeclared reference")
+}
+
+func Test_ExpressionRule(t *testing.T) {
+	t.Parallel()
+
+	policy, err := Rule{All: []Rule{
+		{LastAttachedDays: pointer.Int64(0)},
+		{Expression: `!('keep' in disk.labels)`},
+	}}.MarkPolicy()
+	require.NoError(t, err)
+	disk := &computepb.Disk{Labels: map[string]string{"keep": "true"}}
+	candidate := cleanup.Candidate{Disk: disk, Cutoff: 24 * time.Hour, Now: time.Now()}
+	require.Equal(t, cleanup.ActionSkip, policy.Evaluate(candidate))
+	delete(disk.Labels, "keep")
+	require.Equal(t, cleanup.ActionMark, policy.Evaluate(candidate))
+
+	_, err = Rule{Expression: `disk.sizeGb`}.MarkPolicy()
+	require.NoError(t, err, "a dyn expression is only checked when evaluated")
+	_, err = Rule{Expression: `'a'`}.MarkPolicy()
+	require.ErrorContains(t, err, "expected a bool")
+}
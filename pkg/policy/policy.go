@@ -0,0 +1,268 @@
+// Package policy tests the mark policy, i.e. the options that decide which
+// disks are marked, against disk fixtures, so that teams can keep their
+// policies under test alongside their configuration.
+package policy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+	computepb "google.golang.org/genproto/googleapis/cloud/compute/v1"
+	"gopkg.in/yaml.v3"
+	"k8s.io/utils/pointer"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+// Policy is the part of the mark options that decides what happens to a
+// disk. The list filter is applied by the API and cannot be tested here.
+type Policy struct {
+	// CutoffDays is how many days a disk must not have been attached to be
+	// marked. Defaults to 30, like --cutoff.
+	CutoffDays int64 `yaml:"cutoffDays"`
+	// SourceCutoffDays overrides CutoffDays for the disks created from a
+	// source, e.g. image: 90, like --cutoff-by-source.
+	SourceCutoffDays map[string]int64 `yaml:"sourceCutoffDays"`
+	// Rules decide which disks are abandoned, like --mark-policy. Defaults
+	// to the disks not used within their cutoff.
+	Rules *Rule `yaml:"rules"`
+	// ScoreModel only marks the disks past the cutoff that score at least
+	// its threshold, like --score-model. The flapping and I/O signals have
+	// no data here and are left out.
+	ScoreModel *cleanup.ScoreModel `yaml:"scoreModel"`
+	// LabelBudgetPolicy is skip or evict, like --label-budget-policy.
+	// Defaults to skip.
+	LabelBudgetPolicy string `yaml:"labelBudgetPolicy"`
+	// ExemptLabel is the label that exempts disks, like --exempt-label.
+	// Defaults to gke-disk-cleanup-exempt.
+	ExemptLabel string `yaml:"exemptLabel"`
+	// IncludeBootDisks marks boot disks too, like --include-boot-disks.
+	IncludeBootDisks bool `yaml:"includeBootDisks"`
+	// IncludeManaged marks disks managed by Terraform or Config Connector
+	// too, like --skip-managed=false.
+	IncludeManaged bool `yaml:"includeManaged"`
+	// Volumes lists the disks backing PersistentVolumes, as pdName or
+	// projects/p/zones/z/disks/d, which are never marked.
+	Volumes []string `yaml:"volumes"`
+}
+
+// Fixture is a disk with the action the policy is expected to take for it.
+type Fixture struct {
+	// Name defaults to the file name.
+	Name string `yaml:"name"`
+	Disk struct {
+		Name      string            `yaml:"name"`
+		ProjectID string            `yaml:"projectID"`
+		Zone      string            `yaml:"zone"`
+		Labels    map[string]string `yaml:"labels"`
+		// The timestamps are RFC 3339 times. Fixtures that should not go
+		// stale use the DaysAgo fields instead.
+		CreationTimestamp   string `yaml:"creationTimestamp"`
+		CreatedDaysAgo      *int   `yaml:"createdDaysAgo"`
+		LastAttachTimestamp string `yaml:"lastAttachTimestamp"`
+		LastAttachedDaysAgo *int   `yaml:"lastAttachedDaysAgo"`
+		LastDetachTimestamp string `yaml:"lastDetachTimestamp"`
+		LastDetachedDaysAgo *int   `yaml:"lastDetachedDaysAgo"`
+		// The sources tell what the disk was created from, see
+		// cleanup.DiskSource. A disk without one is blank.
+		SourceImage    string `yaml:"sourceImage"`
+		SourceSnapshot string `yaml:"sourceSnapshot"`
+		SourceDisk     string `yaml:"sourceDisk"`
+		SizeGB         int64  `yaml:"sizeGB"`
+		// Namespace is the Kubernetes namespace the disk was created for.
+		Namespace string `yaml:"namespace"`
+	} `yaml:"disk"`
+	// Expect is the expected action, e.g. MARK or SKIP.
+	Expect cleanup.Action `yaml:"expect"`
+	// ExpectCode optionally is the expected reason for a skip, e.g.
+	// WITHIN_CUTOFF.
+	ExpectCode diskerr.Code `yaml:"expectCode"`
+}
+
+// Result is the outcome of evaluating a Fixture.
+type Result struct {
+	Fixture Fixture
+	Action  cleanup.Action
+	// Code is the reason for a skip, empty otherwise.
+	Code diskerr.Code
+	Err  error
+}
+
+// Passed reports whether the policy took the expected action.
+func (r Result) Passed() bool {
+	if r.Action != r.Fixture.Expect {
+		return false
+	}
+	return r.Fixture.ExpectCode == "" || r.Fixture.ExpectCode == r.Code
+}
+
+// Load reads a policy from a YAML or JSON file.
+func Load(path string) (Policy, error) {
+	var p Policy
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, xerrors.Errorf("read policy: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return p, xerrors.Errorf("parse policy %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// LoadFixtures reads every .yaml, .yml and .json file in dir as a Fixture,
+// in file name order.
+func LoadFixtures(dir string) ([]Fixture, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("read fixtures: %w", err)
+	}
+	var fixtures []Fixture
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, xerrors.Errorf("read fixture: %w", err)
+		}
+		var f Fixture
+		if err := yaml.Unmarshal(data, &f); err != nil {
+			return nil, xerrors.Errorf("parse fixture %s: %w", path, err)
+		}
+		if f.Expect == "" {
+			return nil, xerrors.Errorf("fixture %s: expect is required", path)
+		}
+		if f.Name == "" {
+			f.Name = strings.TrimSuffix(entry.Name(), ext)
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+// Run evaluates every fixture against p.
+func Run(p Policy, fixtures []Fixture) ([]Result, error) {
+	opts, err := p.markOptions()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(fixtures))
+	for _, f := range fixtures {
+		opts := opts
+		opts.ProjectID = f.Disk.ProjectID
+		action, err := cleanup.Decide(f.disk(), opts)
+		result := Result{Fixture: f, Action: action, Err: err}
+		if err != nil {
+			result.Code = diskerr.CodeOf(err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (p Policy) markOptions() (cleanup.MarkOptions, error) {
+	cutoffDays := p.CutoffDays
+	if cutoffDays == 0 {
+		cutoffDays = 30
+	}
+	budgetPolicy := cleanup.LabelBudgetSkip
+	if p.LabelBudgetPolicy != "" {
+		var err error
+		if budgetPolicy, err = cleanup.ParseLabelBudgetPolicy(p.LabelBudgetPolicy); err != nil {
+			return cleanup.MarkOptions{}, err
+		}
+	}
+	exemptLabel := p.ExemptLabel
+	if exemptLabel == "" {
+		exemptLabel = cleanup.DefaultExemptLabel
+	}
+	opts := cleanup.MarkOptions{
+		Cutoff:            24 * time.Hour * time.Duration(cutoffDays),
+		LabelBudgetPolicy: budgetPolicy,
+		ExemptLabel:       exemptLabel,
+		IncludeBootDisks:  p.IncludeBootDisks,
+		IncludeManaged:    p.IncludeManaged,
+	}
+	if p.Rules != nil {
+		policy, err := p.Rules.MarkPolicy()
+		if err != nil {
+			return cleanup.MarkOptions{}, xerrors.Errorf("invalid rules: %w", err)
+		}
+		opts.Policy = policy
+	}
+	if p.ScoreModel != nil {
+		if err := p.ScoreModel.Validate(); err != nil {
+			return cleanup.MarkOptions{}, err
+		}
+		opts.ScoreModel = p.ScoreModel
+	}
+	for name, days := range p.SourceCutoffDays {
+		source, err := cleanup.ParseSource(name)
+		if err != nil {
+			return cleanup.MarkOptions{}, err
+		}
+		if opts.SourceCutoffs == nil {
+			opts.SourceCutoffs = make(map[cleanup.Source]time.Duration, len(p.SourceCutoffDays))
+		}
+		opts.SourceCutoffs[source] = 24 * time.Hour * time.Duration(days)
+	}
+	if len(p.Volumes) > 0 {
+		opts.Volumes = cleanup.NewVolumeIndex()
+		for _, diskID := range p.Volumes {
+			opts.Volumes.Add(diskID, cleanup.VolumeOwner{PersistentVolume: diskID})
+		}
+	}
+	return opts, nil
+}
+
+// disk returns the disk described by the fixture.
+func (f Fixture) disk() *computepb.Disk {
+	disk := &computepb.Disk{
+		Name:   pointer.String(f.Disk.Name),
+		Labels: f.Disk.Labels,
+	}
+	if f.Disk.Zone != "" {
+		disk.Zone = pointer.String(f.Disk.Zone)
+	}
+	if f.Disk.SourceImage != "" {
+		disk.SourceImage = pointer.String(f.Disk.SourceImage)
+	}
+	if f.Disk.SourceSnapshot != "" {
+		disk.SourceSnapshot = pointer.String(f.Disk.SourceSnapshot)
+	}
+	if f.Disk.SourceDisk != "" {
+		disk.SourceDisk = pointer.String(f.Disk.SourceDisk)
+	}
+	if f.Disk.SizeGB != 0 {
+		disk.SizeGb = pointer.Int64(f.Disk.SizeGB)
+	}
+	if f.Disk.Namespace != "" {
+		description, _ := json.Marshal(map[string]string{"kubernetes.io/created-for/pvc/namespace": f.Disk.Namespace})
+		disk.Description = pointer.String(string(description))
+	}
+	now := time.Now()
+	disk.CreationTimestamp = timestamp(f.Disk.CreationTimestamp, f.Disk.CreatedDaysAgo, now)
+	disk.LastAttachTimestamp = timestamp(f.Disk.LastAttachTimestamp, f.Disk.LastAttachedDaysAgo, now)
+	disk.LastDetachTimestamp = timestamp(f.Disk.LastDetachTimestamp, f.Disk.LastDetachedDaysAgo, now)
+	return disk
+}
+
+// timestamp returns the timestamp daysAgo days before now if set, or else
+// ts, or nil if neither is set.
+func timestamp(ts string, daysAgo *int, now time.Time) *string {
+	switch {
+	case daysAgo != nil:
+		return pointer.String(now.AddDate(0, 0, -*daysAgo).Format(time.RFC3339))
+	case ts != "":
+		return pointer.String(ts)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,198 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/cleanup"
+	"gke-disk-cleanup/pkg/diskerr"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func Test_Run(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	policyFile := writeFile(t, dir, "policy.yaml", `
+cutoffDays: 14
+sourceCutoffDays:
+  image: 60
+volumes:
+  - projects/testing/zones/us-east1-b/disks/bound
+`)
+	fixtures := filepath.Join(dir, "fixtures")
+	require.NoError(t, os.Mkdir(fixtures, 0o755))
+	writeFile(t, fixtures, "a-stale.yaml", `
+disk:
+  name: stale
+  lastAttachedDaysAgo: 20
+expect: MARK
+`)
+	writeFile(t, fixtures, "b-recent.json", `{"disk": {"name": "recent", "lastAttachedDaysAgo": 7}, "expect": "SKIP"}`)
+	writeFile(t, fixtures, "c-bound.yaml", `
+name: bound volume
+disk:
+  name: bound
+  projectID: testing
+  lastAttachedDaysAgo: 90
+expect: SKIP
+expectCode: IN_USE
+`)
+	writeFile(t, fixtures, "d-reattached.yaml", `
+disk:
+  name: reattached
+  labels:
+    marked-for-deletion: "true"
+  lastAttachTimestamp: "2999-01-01T00:00:00Z"
+expect: UNMARK
+`)
+	writeFile(t, fixtures, "e-wrong.yaml", `
+disk:
+  name: wrong
+  lastAttachedDaysAgo: 20
+expect: SKIP
+`)
+	writeFile(t, fixtures, "f-exempt.yaml", `
+disk:
+  name: exempt
+  labels:
+    gke-disk-cleanup-exempt: "true"
+  lastAttachedDaysAgo: 90
+expect: SKIP
+expectCode: EXEMPT
+`)
+	writeFile(t, fixtures, "g-fresh.yaml", `
+name: never attached disk gets the cutoff from its creation
+disk:
+  name: fresh
+  createdDaysAgo: 3
+expect: SKIP
+`)
+	writeFile(t, fixtures, "h-detached.yaml", `
+disk:
+  name: detached
+  createdDaysAgo: 120
+  lastAttachedDaysAgo: 90
+  lastDetachedDaysAgo: 1
+expect: SKIP
+`)
+	writeFile(t, fixtures, "i-boot.yaml", `
+name: disks created from an image get a longer cutoff
+disk:
+  name: boot
+  sourceImage: projects/debian-cloud/global/images/debian-11
+  lastAttachedDaysAgo: 20
+expect: SKIP
+`)
+	writeFile(t, fixtures, "README.md", "not a fixture")
+
+	p, err := Load(policyFile)
+	require.NoError(t, err)
+	loaded, err := LoadFixtures(fixtures)
+	require.NoError(t, err)
+	require.Len(t, loaded, 9)
+	require.Equal(t, "a-stale", loaded[0].Name)
+	require.Equal(t, "bound volume", loaded[2].Name)
+
+	results, err := Run(p, loaded)
+	require.NoError(t, err)
+	var passed []bool
+	for _, r := range results {
+		passed = append(passed, r.Passed())
+	}
+	require.Equal(t, []bool{true, true, true, true, false, true, true, true, true}, passed)
+	require.Equal(t, cleanup.ActionMark, results[4].Action)
+	require.Equal(t, diskerr.CodeInUse, results[2].Code)
+}
+
+func Test_Defaults(t *testing.T) {
+	t.Parallel()
+
+	opts, err := Policy{}.markOptions()
+	require.NoError(t, err)
+	require.Equal(t, cleanup.LabelBudgetSkip, opts.LabelBudgetPolicy)
+	require.Equal(t, cleanup.DefaultExemptLabel, opts.ExemptLabel)
+	require.Nil(t, opts.Volumes)
+
+	_, err = Run(Policy{LabelBudgetPolicy: "drop"}, nil)
+	require.EqualError(t, err, `unknown label budget policy "drop"`)
+
+	_, err = Run(Policy{SourceCutoffDays: map[string]int64{"iso": 90}}, nil)
+	require.EqualError(t, err, `unknown creation source "iso", expected one of blank, image, snapshot, disk`)
+}
+
+func Test_LoadFixtures(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, dir, "missing.yaml", "disk:\n  name: test-disk\n")
+	_, err := LoadFixtures(dir)
+	require.ErrorContains(t, err, "expect is required")
+
+	_, err = LoadFixtures(filepath.Join(dir, "missing"))
+	require.ErrorContains(t, err, "read fixtures")
+}
+
+func Test_ScoreModel(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	policyFile := writeFile(t, dir, "policy.yaml", `
+cutoffDays: 30
+scoreModel:
+  threshold: 0.5
+  size:
+    weight: 1
+    saturationGB: 100
+  namespace:
+    weight: 1
+    classes:
+      - pattern: ci-*
+        score: 1
+      - pattern: prod-*
+        score: 0
+`)
+	fixtures := filepath.Join(dir, "fixtures")
+	require.NoError(t, os.Mkdir(fixtures, 0o755))
+	writeFile(t, fixtures, "a-ci.yaml", `
+disk:
+  name: ci
+  sizeGB: 50
+  namespace: ci-1234
+  lastAttachedDaysAgo: 40
+expect: MARK
+`)
+	writeFile(t, fixtures, "b-prod.yaml", `
+disk:
+  name: prod
+  sizeGB: 50
+  namespace: prod-db
+  lastAttachedDaysAgo: 40
+expect: SKIP
+expectCode: LOW_SCORE
+`)
+
+	p, err := Load(policyFile)
+	require.NoError(t, err)
+	loaded, err := LoadFixtures(fixtures)
+	require.NoError(t, err)
+
+	results, err := Run(p, loaded)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, r := range results {
+		require.True(t, r.Passed(), "%s: %s %s %v", r.Fixture.Name, r.Action, r.Code, r.Err)
+	}
+
+	_, err = Run(Policy{ScoreModel: &cleanup.ScoreModel{Threshold: 0.5}}, nil)
+	require.EqualError(t, err, "score model has no signal with a weight")
+}
@@ -0,0 +1,164 @@
+package policy
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+// Rule describes a cleanup.MarkPolicy. Exactly one of its fields is set, e.g.
+//
+//	all:
+//	  - lastAttachedDays: 30
+//	  - any:
+//	      - sizeGB: {min: 100}
+//	      - label: {key: env, value: dev}
+//	  - not:
+//	      label: {key: keep}
+type Rule struct {
+	// All marks the disks every rule marks, Any those any rule marks and
+	// Not those its rule keeps.
+	All []Rule `yaml:"all"`
+	Any []Rule `yaml:"any"`
+	Not *Rule  `yaml:"not"`
+	// LastAttachedDays marks the disks not used for that many days. 0
+	// stands for the cutoff of the disk, i.e. --cutoff or
+	// --cutoff-by-source.
+	LastAttachedDays *int64 `yaml:"lastAttachedDays"`
+	// CreatedDays marks the disks created at least that many days ago.
+	CreatedDays *int64 `yaml:"createdDays"`
+	// SizeGB marks the disks of a size within its range.
+	SizeGB *SizeRule `yaml:"sizeGB"`
+	// Label marks the disks with a label, set to a value if given.
+	Label *LabelRule `yaml:"label"`
+	// Expression marks the disks for which a CEL expression is true, see
+	// Expression.
+	Expression string `yaml:"expression"`
+}
+
+// SizeRule is a range of disk sizes. Max 0 means no upper bound.
+type SizeRule struct {
+	Min int64 `yaml:"min"`
+	Max int64 `yaml:"max"`
+}
+
+// LabelRule matches the label Key, if set to Value or to anything if Value
+// is empty.
+type LabelRule struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+}
+
+// MarkPolicy returns the policy described by r.
+func (r Rule) MarkPolicy() (cleanup.MarkPolicy, error) {
+	var policies []cleanup.MarkPolicy
+	if r.All != nil {
+		allOf, err := markPolicies(r.All)
+		if err != nil {
+			return nil, xerrors.Errorf("all: %w", err)
+		}
+		policies = append(policies, cleanup.AllOf(allOf))
+	}
+	if r.Any != nil {
+		anyOf, err := markPolicies(r.Any)
+		if err != nil {
+			return nil, xerrors.Errorf("any: %w", err)
+		}
+		policies = append(policies, cleanup.AnyOf(anyOf))
+	}
+	if r.Not != nil {
+		not, err := r.Not.MarkPolicy()
+		if err != nil {
+			return nil, xerrors.Errorf("not: %w", err)
+		}
+		policies = append(policies, cleanup.Not{Policy: not})
+	}
+	if r.LastAttachedDays != nil {
+		if *r.LastAttachedDays < 0 {
+			return nil, xerrors.Errorf("lastAttachedDays must not be negative")
+		}
+		policies = append(policies, cleanup.LastAttachAge{MinAge: days(*r.LastAttachedDays)})
+	}
+	if r.CreatedDays != nil {
+		if *r.CreatedDays < 0 {
+			return nil, xerrors.Errorf("createdDays must not be negative")
+		}
+		policies = append(policies, cleanup.CreationAge{MinAge: days(*r.CreatedDays)})
+	}
+	if r.SizeGB != nil {
+		if r.SizeGB.Min < 0 || r.SizeGB.Max < 0 || (r.SizeGB.Max != 0 && r.SizeGB.Max < r.SizeGB.Min) {
+			return nil, xerrors.Errorf("invalid sizeGB range %d-%d", r.SizeGB.Min, r.SizeGB.Max)
+		}
+		policies = append(policies, cleanup.SizeRange{MinGB: r.SizeGB.Min, MaxGB: r.SizeGB.Max})
+	}
+	if r.Label != nil {
+		if r.Label.Key == "" {
+			return nil, xerrors.Errorf("label: key is required")
+		}
+		policies = append(policies, cleanup.LabelMatch{Key: r.Label.Key, Value: r.Label.Value})
+	}
+	if r.Expression != "" {
+		expression, err := CompileExpression(r.Expression)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, expression)
+	}
+	switch len(policies) {
+	case 0:
+		return nil, xerrors.Errorf("empty rule: expected one of all, any, not, lastAttachedDays, createdDays, sizeGB, label or expression")
+	case 1:
+		return policies[0], nil
+	default:
+		return nil, xerrors.Errorf("a rule sets one of all, any, not, lastAttachedDays, createdDays, sizeGB, label or expression; combine several with all or any")
+	}
+}
+
+func markPolicies(rules []Rule) ([]cleanup.MarkPolicy, error) {
+	if len(rules) == 0 {
+		return nil, xerrors.Errorf("no rules")
+	}
+	policies := make([]cleanup.MarkPolicy, 0, len(rules))
+	for i, rule := range rules {
+		policy, err := rule.MarkPolicy()
+		if err != nil {
+			return nil, xerrors.Errorf("rule %d: %w", i+1, err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func days(n int64) time.Duration {
+	return 24 * time.Hour * time.Duration(n)
+}
+
+// LoadRule reads and validates the Rule of a mark policy from a YAML or JSON
+// file.
+func LoadRule(path string) (Rule, error) {
+	var r Rule
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, xerrors.Errorf("read mark policy: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return r, xerrors.Errorf("parse mark policy %s: %w", path, err)
+	}
+	if _, err := r.MarkPolicy(); err != nil {
+		return r, xerrors.Errorf("invalid mark policy %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// LoadRules reads the Rule of a mark policy from a YAML or JSON file.
+func LoadRules(path string) (cleanup.MarkPolicy, error) {
+	r, err := LoadRule(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.MarkPolicy()
+}
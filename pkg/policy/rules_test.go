@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gke-disk-cleanup/pkg/cleanup"
+)
+
+func Test_LoadRules(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := writeFile(t, dir, "rules.yaml", `
+all:
+  - lastAttachedDays: 0
+  - any:
+      - sizeGB: {min: 100, max: 500}
+      - label: {key: env, value: dev}
+  - not:
+      createdDays: 7
+`)
+	policy, err := LoadRules(path)
+	require.NoError(t, err)
+	require.Equal(t, cleanup.AllOf{
+		cleanup.LastAttachAge{},
+		cleanup.AnyOf{
+			cleanup.SizeRange{MinGB: 100, MaxGB: 500},
+			cleanup.LabelMatch{Key: "env", Value: "dev"},
+		},
+		cleanup.Not{Policy: cleanup.CreationAge{MinAge: 7 * 24 * time.Hour}},
+	}, policy)
+
+	for content, expected := range map[string]string{
+		`{}`:                                  "empty rule",
+		`{createdDays: 7, label: {key: env}}`: "a rule sets one of",
+		`{all: []}`:                           "all: no rules",
+		`{any: [{label: {value: dev}}]}`:      "any: rule 1: label: key is required",
+		`{sizeGB: {min: 100, max: 10}}`:       "invalid sizeGB range 100-10",
+		`{not: {lastAttachedDays: -1}}`:       "not: lastAttachedDays must not be negative",
+	} {
+		path := writeFile(t, dir, "invalid.yaml", content)
+		_, err := LoadRules(path)
+		require.ErrorContains(t, err, expected, content)
+	}
+
+	_, err = LoadRules(filepath.Join(dir, "missing.yaml"))
+	require.ErrorContains(t, err, "read mark policy")
+}
+
+func Test_Rules(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	policyFile := writeFile(t, dir, "policy.yaml", `
+rules:
+  any:
+    - lastAttachedDays: 90
+    - all:
+        - lastAttachedDays: 0
+        - label: {key: env, value: dev}
+`)
+	fixtures := filepath.Join(dir, "fixtures")
+	require.NoError(t, os.Mkdir(fixtures, 0o755))
+	writeFile(t, fixtures, "a-dev.yaml", `
+disk:
+  name: dev
+  labels: {env: dev}
+  lastAttachedDaysAgo: 40
+expect: MARK
+`)
+	writeFile(t, fixtures, "b-prod.yaml", `
+disk:
+  name: prod
+  labels: {env: prod}
+  lastAttachedDaysAgo: 40
+expect: SKIP
+`)
+	writeFile(t, fixtures, "c-stale.yaml", `
+disk:
+  name: stale
+  lastAttachedDaysAgo: 100
+expect: MARK
+`)
+
+	p, err := Load(policyFile)
+	require.NoError(t, err)
+	loaded, err := LoadFixtures(fixtures)
+	require.NoError(t, err)
+
+	results, err := Run(p, loaded)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, r := range results {
+		require.True(t, r.Passed(), "%s: %s %s %v", r.Fixture.Name, r.Action, r.Code, r.Err)
+	}
+
+	_, err = Run(Policy{Rules: &Rule{}}, nil)
+	require.ErrorContains(t, err, "invalid rules: empty rule")
+}
@@ -0,0 +1,215 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/xerrors"
+	cloudbilling "google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/option"
+
+	"gke-disk-cleanup/pkg/store"
+)
+
+// computeService is the Cloud Billing Catalog name of the Compute Engine
+// service.
+const computeService = "services/6F81-5844-456A"
+
+// skuDiskTypes maps the description of a zonal persistent disk SKU to the disk
+// type it prices. Outside us-central1, descriptions carry a suffix such as
+// " in Frankfurt".
+var skuDiskTypes = map[string]string{
+	"Storage PD Capacity":    "pd-standard",
+	"Balanced PD Capacity":   "pd-balanced",
+	"SSD backed PD Capacity": "pd-ssd",
+	"Extreme PD Capacity":    "pd-extreme",
+}
+
+// skuSnapshot is the description of the snapshot storage SKU.
+const skuSnapshot = "Storage PD Snapshot"
+
+// usageUnitGBMonth is the usage unit of storage SKUs.
+const usageUnitGBMonth = "GiBy.mo"
+
+// Fetch returns the current prices in region from the Cloud Billing Catalog
+// API. Disk types without a SKU in the region keep their Default price.
+func Fetch(ctx context.Context, region string, opts ...option.ClientOption) (*Table, error) {
+	svc, err := cloudbilling.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init cloud billing client: %w", err)
+	}
+	var skus []*cloudbilling.Sku
+	err = svc.Services.Skus.List(computeService).CurrencyCode("USD").Pages(ctx, func(resp *cloudbilling.ListSkusResponse) error {
+		skus = append(skus, resp.Skus...)
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("list compute engine skus: %w", err)
+	}
+	return tableFromSkus(skus, region, time.Now().UTC())
+}
+
+// tableFromSkus returns the prices of the persistent disk and snapshot SKUs
+// available in region.
+func tableFromSkus(skus []*cloudbilling.Sku, region string, fetched time.Time) (*Table, error) {
+	t := &Table{
+		Region:             region,
+		DiskPerGBMonth:     make(map[string]float64, len(Default.DiskPerGBMonth)),
+		SnapshotPerGBMonth: Default.SnapshotPerGBMonth,
+		Fetched:            fetched,
+	}
+	found := 0
+	for _, sku := range skus {
+		if sku.Category == nil || sku.Category.UsageType != "OnDemand" || !contains(sku.ServiceRegions, region) {
+			continue
+		}
+		price, ok := monthlyPrice(sku)
+		if !ok {
+			continue
+		}
+		if hasDescription(sku, skuSnapshot) {
+			t.SnapshotPerGBMonth = price
+			continue
+		}
+		for description, diskType := range skuDiskTypes {
+			if hasDescription(sku, description) {
+				t.DiskPerGBMonth[diskType] = price
+				found++
+			}
+		}
+	}
+	if found == 0 {
+		return nil, xerrors.Errorf("no persistent disk skus found in region %s", region)
+	}
+	for diskType, price := range Default.DiskPerGBMonth {
+		if _, ok := t.DiskPerGBMonth[diskType]; !ok {
+			t.DiskPerGBMonth[diskType] = price
+		}
+	}
+	return t, nil
+}
+
+// hasDescription reports whether sku is described as description, optionally
+// followed by the location, e.g. "Storage PD Capacity in Frankfurt". This
+// excludes e.g. "Regional Storage PD Capacity".
+func hasDescription(sku *cloudbilling.Sku, description string) bool {
+	return sku.Description == description || strings.HasPrefix(sku.Description, description+" in ")
+}
+
+// monthlyPrice returns the price per GB and month of the highest usage tier of
+// a storage SKU; lower tiers may be free.
+func monthlyPrice(sku *cloudbilling.Sku) (float64, bool) {
+	if len(sku.PricingInfo) == 0 || sku.PricingInfo[0].PricingExpression == nil {
+		return 0, false
+	}
+	expr := sku.PricingInfo[0].PricingExpression
+	if expr.UsageUnit != usageUnitGBMonth || len(expr.TieredRates) == 0 {
+		return 0, false
+	}
+	rate := expr.TieredRates[0]
+	for _, r := range expr.TieredRates[1:] {
+		if r.StartUsageAmount > rate.StartUsageAmount {
+			rate = r
+		}
+	}
+	if rate.UnitPrice == nil {
+		return 0, false
+	}
+	return float64(rate.UnitPrice.Units) + float64(rate.UnitPrice.Nanos)/1e9, true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadOptions configures Load.
+type LoadOptions struct {
+	Region string
+	// CacheFile holds the prices of the last fetch. Prices are only fetched
+	// again once it is older than MaxAge.
+	CacheFile string
+	// Store holds CacheFile. Defaults to the local filesystem.
+	Store         store.Store
+	MaxAge        time.Duration
+	ClientOptions []option.ClientOption
+}
+
+// Load returns the prices in opts.Region from the cache file if it is recent
+// enough, or else fetches them and updates the cache. If fetching fails, e.g.
+// when offline, cached prices of any age are used, or Default if there are
+// none, so Load always returns a Table.
+func Load(ctx context.Context, opts LoadOptions) *Table {
+	return load(ctx, opts, func(ctx context.Context) (*Table, error) {
+		return Fetch(ctx, opts.Region, opts.ClientOptions...)
+	})
+}
+
+func load(ctx context.Context, opts LoadOptions, fetch func(context.Context) (*Table, error)) *Table {
+	logger := log.With().Str("region", opts.Region).Str("cacheFile", opts.CacheFile).Logger()
+	s := opts.Store
+	if s == nil {
+		s = store.Local{}
+	}
+	cached, err := readCache(ctx, s, opts.CacheFile)
+	if err != nil {
+		logger.Warn().Err(err).Msg("ignoring pricing cache")
+	}
+	if cached != nil && cached.Region == opts.Region && time.Since(cached.Fetched) < opts.MaxAge {
+		logger.Debug().Time("fetched", cached.Fetched).Msg("using cached prices")
+		return cached
+	}
+
+	t, err := fetch(ctx)
+	if err == nil {
+		logger.Info().Interface("diskPerGBMonth", t.DiskPerGBMonth).Float64("snapshotPerGBMonth", t.SnapshotPerGBMonth).Msg("fetched prices from cloud billing catalog")
+		if err := writeCache(ctx, s, opts.CacheFile, t); err != nil {
+			logger.Warn().Err(err).Msg("failed to cache prices")
+		}
+		return t
+	}
+	if cached != nil && cached.Region == opts.Region {
+		logger.Warn().Err(err).Time("fetched", cached.Fetched).Msg("failed to fetch prices, using cached prices")
+		return cached
+	}
+	logger.Warn().Err(err).Str("defaultRegion", Default.Region).Msg("failed to fetch prices, using built-in prices")
+	return Default
+}
+
+// readCache returns the cached prices, or nil if there are none.
+func readCache(ctx context.Context, s store.Store, path string) (*Table, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := s.Get(ctx, path)
+	if errors.Is(err, store.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, xerrors.Errorf("parse %s: %w", path, err)
+	}
+	return &t, nil
+}
+
+func writeCache(ctx context.Context, s store.Store, path string, t *Table) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, path, data)
+}
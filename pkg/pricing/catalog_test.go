@@ -0,0 +1,101 @@
+package pricing
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+	cloudbilling "google.golang.org/api/cloudbilling/v1"
+)
+
+func sku(description, region string, tiers ...*cloudbilling.TierRate) *cloudbilling.Sku {
+	return &cloudbilling.Sku{
+		Description:    description,
+		Category:       &cloudbilling.Category{ResourceFamily: "Storage", UsageType: "OnDemand"},
+		ServiceRegions: []string{region},
+		PricingInfo: []*cloudbilling.PricingInfo{{
+			PricingExpression: &cloudbilling.PricingExpression{UsageUnit: "GiBy.mo", TieredRates: tiers},
+		}},
+	}
+}
+
+func rate(start float64, units, nanos int64) *cloudbilling.TierRate {
+	return &cloudbilling.TierRate{StartUsageAmount: start, UnitPrice: &cloudbilling.Money{CurrencyCode: "USD", Units: units, Nanos: nanos}}
+}
+
+func Test_TableFromSkus(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	preemptible := sku("SSD backed PD Capacity", "europe-west3", rate(0, 0, 1))
+	preemptible.Category.UsageType = "Preemptible"
+	skus := []*cloudbilling.Sku{
+		sku("Storage PD Capacity in Frankfurt", "europe-west3", rate(0, 0, 0), rate(1, 0, 52000000)),
+		sku("SSD backed PD Capacity in Frankfurt", "europe-west3", rate(0, 0, 221000000)),
+		sku("Regional SSD backed PD Capacity in Frankfurt", "europe-west3", rate(0, 0, 442000000)),
+		sku("Storage PD Snapshot in Frankfurt", "europe-west3", rate(0, 0, 34000000)),
+		sku("SSD backed PD Capacity", "us-central1", rate(0, 0, 170000000)),
+		preemptible,
+	}
+
+	table, err := tableFromSkus(skus, "europe-west3", now)
+	require.NoError(t, err)
+	require.Equal(t, "europe-west3", table.Region)
+	require.Equal(t, now, table.Fetched)
+	require.InDelta(t, 0.052, table.DiskPerGBMonth["pd-standard"], 1e-9)
+	require.InDelta(t, 0.221, table.DiskPerGBMonth["pd-ssd"], 1e-9)
+	require.InDelta(t, 0.034, table.SnapshotPerGBMonth, 1e-9)
+	// no sku in the region
+	require.Equal(t, Default.DiskPerGBMonth["pd-balanced"], table.DiskPerGBMonth["pd-balanced"])
+
+	_, err = tableFromSkus(skus, "asia-east1", now)
+	require.EqualError(t, err, "no persistent disk skus found in region asia-east1")
+}
+
+func Test_Load(t *testing.T) {
+	t.Parallel()
+
+	fetched := &Table{Region: "europe-west3", DiskPerGBMonth: map[string]float64{"pd-standard": 0.05}, Fetched: time.Now()}
+	fetchOK := func(calls *int) func(context.Context) (*Table, error) {
+		return func(context.Context) (*Table, error) {
+			*calls++
+			return fetched, nil
+		}
+	}
+	fetchErr := func(context.Context) (*Table, error) {
+		return nil, xerrors.New("offline")
+	}
+
+	t.Run("cache", func(t *testing.T) {
+		t.Parallel()
+		opts := LoadOptions{Region: "europe-west3", CacheFile: filepath.Join(t.TempDir(), "cache", "pricing.json"), MaxAge: time.Hour}
+		var calls int
+		table := load(context.Background(), opts, fetchOK(&calls))
+		require.Equal(t, 0.05, table.DiskPerGBMonth["pd-standard"])
+		// served from the cache
+		table = load(context.Background(), opts, fetchOK(&calls))
+		require.Equal(t, 0.05, table.DiskPerGBMonth["pd-standard"])
+		require.Equal(t, 1, calls)
+
+		// stale cache is refreshed
+		opts.MaxAge = 0
+		load(context.Background(), opts, fetchOK(&calls))
+		require.Equal(t, 2, calls)
+
+		// offline, the stale cache is used
+		table = load(context.Background(), opts, fetchErr)
+		require.Equal(t, 0.05, table.DiskPerGBMonth["pd-standard"])
+
+		// a cache of another region is not
+		opts.Region = "us-east1"
+		require.Equal(t, Default, load(context.Background(), opts, fetchErr))
+	})
+
+	t.Run("offline without cache", func(t *testing.T) {
+		t.Parallel()
+		require.Equal(t, Default, load(context.Background(), LoadOptions{Region: "europe-west3"}, fetchErr))
+	})
+}
@@ -0,0 +1,63 @@
+// Package pricing estimates what persistent disks and snapshots cost per
+// month, to report the savings of a cleanup run.
+package pricing
+
+import (
+	"path"
+	"time"
+)
+
+// DefaultDiskType is assumed for disks that do not report their type.
+const DefaultDiskType = "pd-standard"
+
+// Table holds the prices estimates are based on, in USD.
+type Table struct {
+	// Region the prices apply to, e.g. us-central1.
+	Region string `json:"region"`
+	// DiskPerGBMonth is the price per GB and month of zonal persistent disks
+	// by disk type.
+	DiskPerGBMonth map[string]float64 `json:"diskPerGBMonth"`
+	// SnapshotPerGBMonth is the price per GB and month of snapshot storage.
+	SnapshotPerGBMonth float64 `json:"snapshotPerGBMonth"`
+	// Fetched is when the prices were fetched from the Cloud Billing Catalog
+	// API, zero for the built-in Default prices.
+	Fetched time.Time `json:"fetched,omitempty"`
+}
+
+// Default holds the list prices in us-central1 at the time of writing. Actual
+// prices vary by region and contract, so estimates based on it are
+// indicative only; see Load for current prices.
+var Default = &Table{
+	Region: "us-central1",
+	DiskPerGBMonth: map[string]float64{
+		"pd-standard": 0.04,
+		"pd-balanced": 0.10,
+		"pd-ssd":      0.17,
+		"pd-extreme":  0.125,
+	},
+	SnapshotPerGBMonth: 0.026,
+}
+
+// DiskMonthlyCost returns the estimated monthly cost of a disk of the given
+// type and size. diskType may be a disk type name or URL; unknown types are
+// priced as DefaultDiskType. A nil Table uses the Default prices.
+func (t *Table) DiskMonthlyCost(diskType string, sizeGB int64) float64 {
+	if t == nil {
+		t = Default
+	}
+	price, ok := t.DiskPerGBMonth[path.Base(diskType)]
+	if !ok {
+		price = t.DiskPerGBMonth[DefaultDiskType]
+	}
+	return price * float64(sizeGB)
+}
+
+// SnapshotMonthlyCost returns the estimated monthly cost of a snapshot of a
+// disk of sizeGB. Snapshots are compressed and incremental, so this is an
+// upper bound. A nil Table uses the Default prices.
+func (t *Table) SnapshotMonthlyCost(sizeGB int64) float64 {
+	if t == nil {
+		t = Default
+	}
+	return t.SnapshotPerGBMonth * float64(sizeGB)
+}
@@ -0,0 +1,19 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DiskMonthlyCost(t *testing.T) {
+	t.Parallel()
+
+	require.InDelta(t, 17.0, Default.DiskMonthlyCost("https://www.googleapis.com/compute/v1/projects/p/zones/z/diskTypes/pd-ssd", 100), 1e-9)
+	require.InDelta(t, 10.0, Default.DiskMonthlyCost("pd-balanced", 100), 1e-9)
+	require.InDelta(t, 4.0, Default.DiskMonthlyCost("", 100), 1e-9)
+
+	var nilTable *Table
+	require.InDelta(t, 4.0, nilTable.DiskMonthlyCost("pd-standard", 100), 1e-9)
+	require.InDelta(t, 2.6, nilTable.SnapshotMonthlyCost(100), 1e-9)
+}
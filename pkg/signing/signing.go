@@ -0,0 +1,194 @@
+// Package signing signs the records gke-disk-cleanup produces for auditors,
+// such as deletion certificates, with an HMAC key or a Cloud KMS key.
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+
+	"golang.org/x/xerrors"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+// Algorithms of a Signature.
+const (
+	// AlgorithmHMACSHA256 is an HMAC-SHA256 of the payload.
+	AlgorithmHMACSHA256 = "HMAC_SHA256"
+	// AlgorithmKMS is a Cloud KMS asymmetric signature of the SHA-256
+	// digest of the payload. The algorithm is that of the key version.
+	AlgorithmKMS = "KMS_ASYMMETRIC_SHA256"
+)
+
+// Signature is a signature of a payload.
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	// KeyID identifies the key: the key version name for Cloud KMS, or a
+	// fingerprint of the HMAC key.
+	KeyID string `json:"keyID"`
+	// Value is the base64-encoded signature.
+	Value string `json:"value"`
+}
+
+// Signer signs payloads.
+type Signer interface {
+	Sign(ctx context.Context, payload []byte) (Signature, error)
+}
+
+// Verifier verifies signatures, accepting only those of its own key.
+type Verifier interface {
+	Verify(ctx context.Context, payload []byte, sig Signature) error
+}
+
+// Key signs payloads and verifies their signatures.
+type Key interface {
+	Signer
+	Verifier
+}
+
+// HMAC signs with a shared secret key.
+type HMAC struct {
+	key []byte
+}
+
+// NewHMAC returns a Signer using key, which must not be empty.
+func NewHMAC(key []byte) (*HMAC, error) {
+	if len(key) == 0 {
+		return nil, xerrors.Errorf("hmac key is empty")
+	}
+	return &HMAC{key: key}, nil
+}
+
+// keyID returns a fingerprint of the key that does not reveal it.
+func (h *HMAC) keyID() string {
+	sum := sha256.Sum256(h.key)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (h *HMAC) mac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, h.key)
+	_, _ = mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (h *HMAC) Sign(_ context.Context, payload []byte) (Signature, error) {
+	return Signature{
+		Algorithm: AlgorithmHMACSHA256,
+		KeyID:     h.keyID(),
+		Value:     base64.StdEncoding.EncodeToString(h.mac(payload)),
+	}, nil
+}
+
+// Verify checks that sig is a signature of payload with this key.
+func (h *HMAC) Verify(_ context.Context, payload []byte, sig Signature) error {
+	if sig.Algorithm != AlgorithmHMACSHA256 {
+		return xerrors.Errorf("unexpected signature algorithm %q, expected %s", sig.Algorithm, AlgorithmHMACSHA256)
+	}
+	if keyID := h.keyID(); sig.KeyID != keyID {
+		return xerrors.Errorf("signed by %q, expected %s", sig.KeyID, keyID)
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return xerrors.Errorf("decode signature: %w", err)
+	}
+	if !hmac.Equal(value, h.mac(payload)) {
+		return xerrors.Errorf("signature does not match")
+	}
+	return nil
+}
+
+// KMS signs with an asymmetric Cloud KMS key version.
+type KMS struct {
+	versions   *cloudkms.ProjectsLocationsKeyRingsCryptoKeysCryptoKeyVersionsService
+	keyVersion string
+}
+
+// NewKMS returns a Signer using keyVersion, e.g.
+// projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1, which
+// must be a signing key with a SHA-256 digest.
+func NewKMS(ctx context.Context, keyVersion string, opts ...option.ClientOption) (*KMS, error) {
+	svc, err := cloudkms.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init kms client: %w", err)
+	}
+	return &KMS{versions: svc.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions, keyVersion: keyVersion}, nil
+}
+
+func (k *KMS) Sign(ctx context.Context, payload []byte) (Signature, error) {
+	digest := sha256.Sum256(payload)
+	resp, err := k.versions.AsymmetricSign(k.keyVersion, &cloudkms.AsymmetricSignRequest{
+		Digest: &cloudkms.Digest{Sha256: base64.StdEncoding.EncodeToString(digest[:])},
+	}).Context(ctx).Do()
+	if err != nil {
+		return Signature{}, xerrors.Errorf("sign with %s: %w", k.keyVersion, err)
+	}
+	return Signature{Algorithm: AlgorithmKMS, KeyID: resp.Name, Value: resp.Signature}, nil
+}
+
+// Verify checks that sig is a signature of payload with this key version, so
+// that only records signed by an authorized key are accepted. The public key
+// is fetched from Cloud KMS.
+func (k *KMS) Verify(ctx context.Context, payload []byte, sig Signature) error {
+	if sig.Algorithm != AlgorithmKMS {
+		return xerrors.Errorf("unexpected signature algorithm %q, expected %s", sig.Algorithm, AlgorithmKMS)
+	}
+	if sig.KeyID != k.keyVersion {
+		return xerrors.Errorf("signed by %q, expected %s", sig.KeyID, k.keyVersion)
+	}
+	pub, err := k.versions.GetPublicKey(k.keyVersion).Context(ctx).Do()
+	if err != nil {
+		return xerrors.Errorf("get public key of %s: %w", k.keyVersion, err)
+	}
+	return verifyPublicKey(pub.Pem, pub.Algorithm, payload, sig.Value)
+}
+
+// verifyPublicKey checks that value, a base64-encoded signature by a key
+// version with the given Cloud KMS algorithm, signs the SHA-256 digest of
+// payload with the PEM-encoded public key.
+func verifyPublicKey(pemKey, algorithm string, payload []byte, value string) error {
+	if !strings.HasSuffix(algorithm, "_SHA256") {
+		return xerrors.Errorf("unsupported key algorithm %s, expected a SHA-256 digest", algorithm)
+	}
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return xerrors.Errorf("decode public key: no PEM data")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return xerrors.Errorf("parse public key: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return xerrors.Errorf("decode signature: %w", err)
+	}
+	digest := sha256.Sum256(payload)
+
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return xerrors.Errorf("signature does not match")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if strings.HasPrefix(algorithm, "RSA_SIGN_PSS_") {
+			err = rsa.VerifyPSS(key, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+		}
+		if err != nil {
+			return xerrors.Errorf("signature does not match")
+		}
+		return nil
+	default:
+		return xerrors.Errorf("unsupported public key type %T", key)
+	}
+}
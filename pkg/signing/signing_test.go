@@ -0,0 +1,153 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+func Test_HMAC(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHMAC(nil)
+	require.EqualError(t, err, "hmac key is empty")
+
+	h, err := NewHMAC([]byte("secret"))
+	require.NoError(t, err)
+	sig, err := h.Sign(context.Background(), []byte("payload"))
+	require.NoError(t, err)
+	require.Equal(t, AlgorithmHMACSHA256, sig.Algorithm)
+	require.Len(t, sig.KeyID, 16)
+	require.NotContains(t, sig.KeyID, "secret")
+	require.NoError(t, h.Verify(context.Background(), []byte("payload"), sig))
+
+	require.EqualError(t, h.Verify(context.Background(), []byte("tampered"), sig), "signature does not match")
+	other, err := NewHMAC([]byte("other"))
+	require.NoError(t, err)
+	require.NotEqual(t, sig.KeyID, other.keyID())
+	require.EqualError(t, other.Verify(context.Background(), []byte("payload"), sig), fmt.Sprintf("signed by %q, expected %s", sig.KeyID, other.keyID()))
+	forged := sig
+	forged.KeyID = other.keyID()
+	require.EqualError(t, other.Verify(context.Background(), []byte("payload"), forged), "signature does not match")
+	sig.Algorithm = AlgorithmKMS
+	require.EqualError(t, h.Verify(context.Background(), []byte("payload"), sig), `unexpected signature algorithm "KMS_ASYMMETRIC_SHA256", expected HMAC_SHA256`)
+}
+
+func Test_VerifyPublicKey(t *testing.T) {
+	t.Parallel()
+
+	encode := func(t *testing.T, pub interface{}) string {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	digest := sha256.Sum256([]byte("payload"))
+
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ec, digest[:])
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pssSig, err := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	require.NoError(t, err)
+	pkcs1Sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		pem       string
+		algorithm string
+		payload   string
+		sig       []byte
+		err       string
+	}{
+		{name: "ecdsa", pem: encode(t, &ec.PublicKey), algorithm: "EC_SIGN_P256_SHA256", payload: "payload", sig: ecSig},
+		{name: "rsa pss", pem: encode(t, &rsaKey.PublicKey), algorithm: "RSA_SIGN_PSS_2048_SHA256", payload: "payload", sig: pssSig},
+		{name: "rsa pkcs1", pem: encode(t, &rsaKey.PublicKey), algorithm: "RSA_SIGN_PKCS1_2048_SHA256", payload: "payload", sig: pkcs1Sig},
+		{name: "tampered", pem: encode(t, &ec.PublicKey), algorithm: "EC_SIGN_P256_SHA256", payload: "tampered", sig: ecSig, err: "signature does not match"},
+		{name: "wrong padding", pem: encode(t, &rsaKey.PublicKey), algorithm: "RSA_SIGN_PKCS1_2048_SHA256", payload: "payload", sig: pssSig, err: "signature does not match"},
+		{name: "sha384", pem: encode(t, &ec.PublicKey), algorithm: "EC_SIGN_P384_SHA384", payload: "payload", sig: ecSig, err: "unsupported key algorithm EC_SIGN_P384_SHA384, expected a SHA-256 digest"},
+		{name: "no pem", pem: "garbage", algorithm: "EC_SIGN_P256_SHA256", payload: "payload", sig: ecSig, err: "decode public key: no PEM data"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := verifyPublicKey(tt.pem, tt.algorithm, []byte(tt.payload), base64.StdEncoding.EncodeToString(tt.sig))
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_KMS(t *testing.T) {
+	t.Parallel()
+
+	const keyVersion = "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&ec.PublicKey)
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/"+keyVersion+":asymmetricSign"):
+			var req cloudkms.AsymmetricSignRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			digest, err := base64.StdEncoding.DecodeString(req.Digest.Sha256)
+			require.NoError(t, err)
+			sig, err := ecdsa.SignASN1(rand.Reader, ec, digest)
+			require.NoError(t, err)
+			_ = json.NewEncoder(w).Encode(cloudkms.AsymmetricSignResponse{Name: keyVersion, Signature: base64.StdEncoding.EncodeToString(sig)})
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/"+keyVersion+"/publicKey"):
+			_ = json.NewEncoder(w).Encode(cloudkms.PublicKey{
+				Name:      keyVersion,
+				Algorithm: "EC_SIGN_P256_SHA256",
+				Pem:       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	opts := []option.ClientOption{option.WithEndpoint(srv.URL), option.WithoutAuthentication()}
+	k, err := NewKMS(ctx, keyVersion, opts...)
+	require.NoError(t, err)
+	sig, err := k.Sign(ctx, []byte("payload"))
+	require.NoError(t, err)
+	require.Equal(t, Signature{Algorithm: AlgorithmKMS, KeyID: keyVersion, Value: sig.Value}, sig)
+	require.NoError(t, k.Verify(ctx, []byte("payload"), sig))
+	require.EqualError(t, k.Verify(ctx, []byte("tampered"), sig), "signature does not match")
+
+	other, err := NewKMS(ctx, strings.TrimSuffix(keyVersion, "1")+"2", opts...)
+	require.NoError(t, err)
+	require.EqualError(t, other.Verify(ctx, []byte("payload"), sig), fmt.Sprintf("signed by %q, expected %s", keyVersion, other.keyVersion))
+
+	h, err := NewHMAC([]byte("secret"))
+	require.NoError(t, err)
+	hmacSig, err := h.Sign(ctx, []byte("payload"))
+	require.NoError(t, err)
+	require.EqualError(t, k.Verify(ctx, []byte("payload"), hmacSig), `unexpected signature algorithm "HMAC_SHA256", expected KMS_ASYMMETRIC_SHA256`)
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"golang.org/x/xerrors"
+	firestore "google.golang.org/api/firestore/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// firestoreStore stores objects as documents in a Firestore collection. A
+// document holds at most 1 MiB.
+type firestoreStore struct {
+	docs       *firestore.ProjectsDatabasesDocumentsService
+	parent     string
+	collection string
+}
+
+func newFirestore(ctx context.Context, projectID, collection string, opts ...option.ClientOption) (*firestoreStore, error) {
+	svc, err := firestore.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init firestore client: %w", err)
+	}
+	return &firestoreStore{
+		docs:       svc.Projects.Databases.Documents,
+		parent:     "projects/" + projectID + "/databases/(default)/documents",
+		collection: collection,
+	}, nil
+}
+
+// documentID returns the ID of the document for key. Keys may contain
+// slashes, which document IDs may not, so they are encoded.
+func documentID(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func (f *firestoreStore) name(key string) string {
+	return f.parent + "/" + f.collection + "/" + documentID(key)
+}
+
+// document returns the document holding data. The key is stored as well to
+// make the collection readable.
+func document(key string, data []byte) *firestore.Document {
+	return &firestore.Document{Fields: map[string]firestore.Value{
+		"key":  {StringValue: key},
+		"data": {BytesValue: base64.StdEncoding.EncodeToString(data)},
+	}}
+}
+
+func (f *firestoreStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, _, err := f.get(ctx, key)
+	return data, err
+}
+
+// get returns the object at key and when it was last updated.
+func (f *firestoreStore) get(ctx context.Context, key string) ([]byte, string, error) {
+	doc, err := f.docs.Get(f.name(key)).Context(ctx).Do()
+	if hasStatus(err, http.StatusNotFound) {
+		return nil, "", xerrors.Errorf("get %s: %w", key, ErrNotExist)
+	}
+	if err != nil {
+		return nil, "", xerrors.Errorf("get %s: %w", key, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(doc.Fields["data"].BytesValue)
+	if err != nil {
+		return nil, "", xerrors.Errorf("decode %s: %w", key, err)
+	}
+	return data, doc.UpdateTime, nil
+}
+
+func (f *firestoreStore) Put(ctx context.Context, key string, data []byte) error {
+	if _, err := f.docs.Patch(f.name(key), document(key, data)).Context(ctx).Do(); err != nil {
+		return xerrors.Errorf("write %s: %w", key, err)
+	}
+	return nil
+}
+
+func (f *firestoreStore) Create(ctx context.Context, key string, data []byte) error {
+	_, err := f.docs.CreateDocument(f.parent, f.collection, document(key, data)).
+		DocumentId(documentID(key)).
+		Context(ctx).
+		Do()
+	if hasStatus(err, http.StatusConflict) {
+		return xerrors.Errorf("create %s: %w", key, ErrExist)
+	}
+	if err != nil {
+		return xerrors.Errorf("create %s: %w", key, err)
+	}
+	return nil
+}
+
+// Append replaces the document only if it was not changed since it was read,
+// and starts over otherwise.
+func (f *firestoreStore) Append(ctx context.Context, key string, data []byte) error {
+	for i := 0; ; i++ {
+		old, updateTime, err := f.get(ctx, key)
+		if err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+		call := f.docs.Patch(f.name(key), document(key, append(old, data...))).Context(ctx)
+		if updateTime == "" {
+			call = call.CurrentDocumentExists(false)
+		} else {
+			call = call.CurrentDocumentUpdateTime(updateTime)
+		}
+		_, err = call.Do()
+		if err == nil {
+			return nil
+		}
+		if !isConflict(err) || i == maxConflicts {
+			return xerrors.Errorf("append to %s: %w", key, err)
+		}
+	}
+}
+
+// isConflict reports whether err is a failed precondition of a write.
+func isConflict(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return true
+	case http.StatusBadRequest:
+		return strings.Contains(apiErr.Body, "FAILED_PRECONDITION")
+	}
+	return false
+}
+
+func (f *firestoreStore) Delete(ctx context.Context, key string) error {
+	_, err := f.docs.Delete(f.name(key)).Context(ctx).Do()
+	if err != nil && !hasStatus(err, http.StatusNotFound) {
+		return xerrors.Errorf("delete %s: %w", key, err)
+	}
+	return nil
+}
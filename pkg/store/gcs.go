@@ -0,0 +1,117 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// maxConflicts is how often Append retries after a concurrent change.
+const maxConflicts = 10
+
+// gcs stores objects in a Cloud Storage bucket under a prefix.
+type gcs struct {
+	svc    *storage.Service
+	bucket string
+	prefix string
+}
+
+func newGCS(ctx context.Context, bucket, prefix string, opts ...option.ClientOption) (*gcs, error) {
+	svc, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, xerrors.Errorf("init storage client: %w", err)
+	}
+	return &gcs{svc: svc, bucket: bucket, prefix: prefix}, nil
+}
+
+func (g *gcs) object(key string) string {
+	return path.Join(g.prefix, key)
+}
+
+func (g *gcs) Get(ctx context.Context, key string) ([]byte, error) {
+	data, _, err := g.get(ctx, key)
+	return data, err
+}
+
+// get returns the object at key and its generation.
+func (g *gcs) get(ctx context.Context, key string) ([]byte, int64, error) {
+	resp, err := g.svc.Objects.Get(g.bucket, g.object(key)).Context(ctx).Download()
+	if hasStatus(err, http.StatusNotFound) {
+		return nil, 0, xerrors.Errorf("get gs://%s/%s: %w", g.bucket, g.object(key), ErrNotExist)
+	}
+	if err != nil {
+		return nil, 0, xerrors.Errorf("get gs://%s/%s: %w", g.bucket, g.object(key), err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, xerrors.Errorf("read gs://%s/%s: %w", g.bucket, g.object(key), err)
+	}
+	generation, _ := strconv.ParseInt(resp.Header.Get("X-Goog-Generation"), 10, 64)
+	return data, generation, nil
+}
+
+func (g *gcs) Put(ctx context.Context, key string, data []byte) error {
+	return g.insert(ctx, key, data, -1)
+}
+
+func (g *gcs) Create(ctx context.Context, key string, data []byte) error {
+	err := g.insert(ctx, key, data, 0)
+	if hasStatus(err, http.StatusPreconditionFailed) {
+		return xerrors.Errorf("create gs://%s/%s: %w", g.bucket, g.object(key), ErrExist)
+	}
+	return err
+}
+
+// Append replaces the object only if it was not changed since it was read,
+// and starts over otherwise.
+func (g *gcs) Append(ctx context.Context, key string, data []byte) error {
+	for i := 0; ; i++ {
+		old, generation, err := g.get(ctx, key)
+		if err != nil && !errors.Is(err, ErrNotExist) {
+			return err
+		}
+		err = g.insert(ctx, key, append(old, data...), generation)
+		if !hasStatus(err, http.StatusPreconditionFailed) || i == maxConflicts {
+			return err
+		}
+	}
+}
+
+// insert writes the object at key if its generation is generation, where 0
+// means that it must not exist and -1 skips the check.
+func (g *gcs) insert(ctx context.Context, key string, data []byte, generation int64) error {
+	call := g.svc.Objects.Insert(g.bucket, &storage.Object{Name: g.object(key)}).
+		Media(bytes.NewReader(data)).
+		Context(ctx)
+	if generation >= 0 {
+		call = call.IfGenerationMatch(generation)
+	}
+	if _, err := call.Do(); err != nil {
+		return xerrors.Errorf("write gs://%s/%s: %w", g.bucket, g.object(key), err)
+	}
+	return nil
+}
+
+func (g *gcs) Delete(ctx context.Context, key string) error {
+	err := g.svc.Objects.Delete(g.bucket, g.object(key)).Context(ctx).Do()
+	if err != nil && !hasStatus(err, http.StatusNotFound) {
+		return xerrors.Errorf("delete gs://%s/%s: %w", g.bucket, g.object(key), err)
+	}
+	return nil
+}
+
+// hasStatus reports whether err is a Google API error with HTTP status code.
+func hasStatus(err error, code int) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+)
+
+// Local stores objects as files in Dir, or as files at their keys if Dir is
+// empty.
+type Local struct {
+	Dir string
+}
+
+func (l Local) path(key string) string {
+	return filepath.Join(l.Dir, filepath.FromSlash(key))
+}
+
+func (l Local) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(l.path(key))
+	if err != nil {
+		return nil, xerrors.Errorf("read %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// Put replaces the file atomically, so that a process killed while writing
+// leaves the previous content intact.
+func (l Local) Put(_ context.Context, key string, data []byte) error {
+	path := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return xerrors.Errorf("write %s: %w", key, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return xerrors.Errorf("write %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return xerrors.Errorf("write %s: %w", key, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return xerrors.Errorf("sync %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return xerrors.Errorf("write %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return xerrors.Errorf("replace %s: %w", key, err)
+	}
+	return nil
+}
+
+func (l Local) Create(_ context.Context, key string, data []byte) error {
+	return l.write(key, data, os.O_CREATE|os.O_EXCL|os.O_WRONLY)
+}
+
+func (l Local) Append(_ context.Context, key string, data []byte) error {
+	return l.write(key, data, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+}
+
+func (l Local) write(key string, data []byte, flag int) error {
+	path := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return xerrors.Errorf("write %s: %w", key, err)
+	}
+	f, err := os.OpenFile(path, flag, 0o644)
+	if err != nil {
+		return xerrors.Errorf("open %s: %w", key, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return xerrors.Errorf("write %s: %w", key, err)
+	}
+	if err := f.Close(); err != nil {
+		return xerrors.Errorf("write %s: %w", key, err)
+	}
+	return nil
+}
+
+func (l Local) Delete(_ context.Context, key string) error {
+	if err := os.Remove(l.path(key)); err != nil && !os.IsNotExist(err) {
+		return xerrors.Errorf("remove %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrLocked is returned, wrapped, when a lock is held by someone else.
+var ErrLocked = errors.New("locked")
+
+// lockInfo is the content of a lock.
+type lockInfo struct {
+	Owner    string    `json:"owner"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Lock is held on a key of a Store.
+type Lock struct {
+	s   Store
+	key string
+}
+
+// Acquire takes the lock at key in s for at most ttl. A lock that expired,
+// e.g. as its owner was killed, is taken over.
+func Acquire(ctx context.Context, s Store, key string, ttl time.Duration) (*Lock, error) {
+	hostname, _ := os.Hostname()
+	now := time.Now().UTC()
+	data, err := json.Marshal(lockInfo{
+		Owner:    fmt.Sprintf("%s/%d", hostname, os.Getpid()),
+		Acquired: now,
+		Expires:  now.Add(ttl),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("encode lock: %w", err)
+	}
+	err = s.Create(ctx, key, data)
+	if errors.Is(err, ErrExist) {
+		var held lockInfo
+		existing, getErr := s.Get(ctx, key)
+		if getErr != nil {
+			return nil, xerrors.Errorf("read lock: %w", getErr)
+		}
+		if err := json.Unmarshal(existing, &held); err != nil {
+			return nil, xerrors.Errorf("parse lock %s: %w", key, err)
+		}
+		if now.Before(held.Expires) {
+			return nil, xerrors.Errorf("%s is held by %s since %s: %w", key, held.Owner, held.Acquired.Format(time.RFC3339), ErrLocked)
+		}
+		if err := s.Delete(ctx, key); err != nil {
+			return nil, err
+		}
+		err = s.Create(ctx, key, data)
+	}
+	if errors.Is(err, ErrExist) {
+		return nil, xerrors.Errorf("%s was taken over concurrently: %w", key, ErrLocked)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("acquire lock: %w", err)
+	}
+	return &Lock{s: s, key: key}, nil
+}
+
+// Release gives up the lock.
+func (l *Lock) Release(ctx context.Context) error {
+	return l.s.Delete(ctx, l.key)
+}
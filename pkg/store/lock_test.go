@@ -0,0 +1,33 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Acquire(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := Local{Dir: t.TempDir()}
+
+	lock, err := Acquire(ctx, s, "run.lock", time.Hour)
+	require.NoError(t, err)
+	_, err = Acquire(ctx, s, "run.lock", time.Hour)
+	require.True(t, errors.Is(err, ErrLocked))
+	require.Contains(t, err.Error(), "run.lock is held by ")
+
+	require.NoError(t, lock.Release(ctx))
+	_, err = Acquire(ctx, s, "run.lock", -time.Second)
+	require.NoError(t, err)
+
+	// an expired lock is taken over
+	_, err = Acquire(ctx, s, "run.lock", time.Hour)
+	require.NoError(t, err)
+	_, err = Acquire(ctx, s, "run.lock", time.Hour)
+	require.True(t, errors.Is(err, ErrLocked))
+}
@@ -0,0 +1,73 @@
+// Package store keeps the state of gke-disk-cleanup, i.e. checkpoints, the
+// history, locks and caches, as small objects under keys in a backend that
+// the organisation allows: the local filesystem, Cloud Storage or Firestore.
+package store
+
+import (
+	"context"
+	"io/fs"
+	"net/url"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"google.golang.org/api/option"
+)
+
+var (
+	// ErrNotExist is returned, wrapped, when getting a key that does not
+	// exist.
+	ErrNotExist = fs.ErrNotExist
+	// ErrExist is returned, wrapped, when creating a key that exists.
+	ErrExist = fs.ErrExist
+)
+
+// Store holds objects under keys such as mark.checkpoint. Keys may contain
+// slashes.
+type Store interface {
+	// Get returns the object at key.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put creates or atomically replaces the object at key.
+	Put(ctx context.Context, key string, data []byte) error
+	// Create creates the object at key unless it exists.
+	Create(ctx context.Context, key string, data []byte) error
+	// Append adds data to the end of the object at key, creating it if it
+	// does not exist. Concurrent appends are not lost.
+	Append(ctx context.Context, key string, data []byte) error
+	// Delete removes the object at key. Deleting a key that does not exist
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Open returns the store at location:
+//
+//   - "" for the local filesystem, with keys being paths
+//   - a directory, or file:///dir, for files in that directory
+//   - gs://bucket/prefix for objects in a Cloud Storage bucket
+//   - firestore://project/collection for documents in a Firestore collection
+//     of the default database
+func Open(ctx context.Context, location string, opts ...option.ClientOption) (Store, error) {
+	if location == "" {
+		return Local{}, nil
+	}
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme == "" {
+		return Local{Dir: location}, nil
+	}
+	switch u.Scheme {
+	case "file":
+		return Local{Dir: u.Path}, nil
+	case "gs":
+		if u.Host == "" {
+			return nil, xerrors.Errorf("store %s: bucket is missing", location)
+		}
+		return newGCS(ctx, u.Host, strings.Trim(u.Path, "/"), opts...)
+	case "firestore":
+		collection := strings.Trim(u.Path, "/")
+		if u.Host == "" || collection == "" {
+			return nil, xerrors.Errorf("store %s: expected firestore://project/collection", location)
+		}
+		return newFirestore(ctx, u.Host, collection, opts...)
+	default:
+		return nil, xerrors.Errorf("store %s: unsupported scheme %q, expected a directory, gs:// or firestore://", location, u.Scheme)
+	}
+}
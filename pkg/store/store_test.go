@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Open(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	for _, tt := range []struct {
+		location string
+		want     Store
+		err      string
+	}{
+		{location: "", want: Local{}},
+		{location: "/var/lib/gke-disk-cleanup", want: Local{Dir: "/var/lib/gke-disk-cleanup"}},
+		{location: "state", want: Local{Dir: "state"}},
+		{location: "file:///var/lib/gke-disk-cleanup", want: Local{Dir: "/var/lib/gke-disk-cleanup"}},
+		{location: "gs:///prefix", err: "store gs:///prefix: bucket is missing"},
+		{location: "firestore://project", err: "store firestore://project: expected firestore://project/collection"},
+		{location: "s3://bucket", err: `store s3://bucket: unsupported scheme "s3", expected a directory, gs:// or firestore://`},
+	} {
+		s, err := Open(ctx, tt.location)
+		if tt.err != "" {
+			require.EqualError(t, err, tt.err, tt.location)
+			continue
+		}
+		require.NoError(t, err, tt.location)
+		require.Equal(t, tt.want, s, tt.location)
+	}
+}
+
+func Test_Local(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := Local{Dir: dir}
+
+	_, err := s.Get(ctx, "runs/mark.checkpoint")
+	require.True(t, errors.Is(err, ErrNotExist))
+
+	require.NoError(t, s.Put(ctx, "runs/mark.checkpoint", []byte("a")))
+	require.NoError(t, s.Put(ctx, "runs/mark.checkpoint", []byte("b")))
+	data, err := s.Get(ctx, "runs/mark.checkpoint")
+	require.NoError(t, err)
+	require.Equal(t, "b", string(data))
+	// no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "runs"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	require.NoError(t, s.Create(ctx, "lock", []byte("held")))
+	err = s.Create(ctx, "lock", []byte("held"))
+	require.True(t, errors.Is(err, ErrExist))
+
+	require.NoError(t, s.Append(ctx, "history.jsonl", []byte("1\n")))
+	require.NoError(t, s.Append(ctx, "history.jsonl", []byte("2\n")))
+	data, err = s.Get(ctx, "history.jsonl")
+	require.NoError(t, err)
+	require.Equal(t, "1\n2\n", string(data))
+
+	require.NoError(t, s.Delete(ctx, "lock"))
+	require.NoError(t, s.Delete(ctx, "lock"))
+	_, err = s.Get(ctx, "lock")
+	require.True(t, errors.Is(err, ErrNotExist))
+}